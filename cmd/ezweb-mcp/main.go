@@ -4,8 +4,13 @@ import (
 	"log"
 	"os"
 
+	"ezweb/internal/backup"
+	"ezweb/internal/caddy"
+	"ezweb/internal/config"
 	"ezweb/internal/db"
 	mcptools "ezweb/internal/mcp"
+	"ezweb/internal/models"
+	"ezweb/internal/templates"
 
 	"github.com/joho/godotenv"
 	"github.com/mark3labs/mcp-go/server"
@@ -14,10 +19,18 @@ import (
 func main() {
 	_ = godotenv.Load()
 
+	// Resolve relative paths the same way the web app does; cron and MCP
+	// clients rarely start this binary in the install directory.
+	dataDir, err := config.DataDir()
+	if err != nil {
+		log.Fatalf("failed to resolve DATA_DIR: %v", err)
+	}
 	dbPath := os.Getenv("DB_PATH")
 	if dbPath == "" {
-		dbPath = "./ezweb.db"
+		dbPath = "ezweb.db"
 	}
+	dbPath = config.ResolvePath(dataDir, dbPath)
+	log.Printf("using database %s", dbPath)
 
 	database, err := db.Open(dbPath, 25, 5)
 	if err != nil {
@@ -25,13 +38,49 @@ func main() {
 	}
 	defer database.Close()
 
+	// Server SSH secrets are encrypted at rest when the web app has a key set.
+	if key := os.Getenv("ENCRYPTION_KEY"); key != "" {
+		if err := models.SetEncryptionKey(key); err != nil {
+			log.Fatalf("invalid ENCRYPTION_KEY: %v", err)
+		}
+	}
+
+	// Deploys use the compose templates stored by the web app first.
+	templates.SetSource(models.TemplateSource(database))
+
 	s := server.NewMCPServer(
 		"ezweb",
 		"1.0.0",
 		server.WithToolCapabilities(true),
 	)
 
-	mcptools.RegisterTools(s, database)
+	backupDir := os.Getenv("BACKUP_DIR")
+	if backupDir == "" {
+		backupDir = "backups"
+	}
+	backupDir = config.ResolvePath(dataDir, backupDir)
+	backupMgr, err := backup.NewManager(backupDir, database)
+	if err != nil {
+		log.Fatalf("failed to initialize backup manager: %v", err)
+	}
+
+	// create_site rewrites and reloads the same Caddyfile as the web app, and
+	// validate_caddy_config checks what it would write, so the global options
+	// and snippets must match too.
+	caddyfilePath := os.Getenv("CADDYFILE_PATH")
+	if caddyfilePath == "" {
+		caddyfilePath = "/etc/caddy/Caddyfile"
+	}
+	caddyMgr := caddy.NewManager(config.ResolvePath(dataDir, caddyfilePath), os.Getenv("ACME_EMAIL"))
+	caddyMgr.MaintenancePage = config.ResolvePath(dataDir, os.Getenv("MAINTENANCE_PAGE"))
+	caddyMgr.GlobalOptions = config.EnvLines("CADDY_GLOBAL_OPTIONS")
+	snippets, err := caddy.LoadSnippets(config.ResolvePath(dataDir, os.Getenv("CADDY_SNIPPETS_DIR")))
+	if err != nil {
+		log.Fatalf("invalid CADDY_SNIPPETS_DIR: %v", err)
+	}
+	caddyMgr.Snippets = snippets
+
+	mcptools.RegisterTools(s, database, dbPath, backupMgr, caddyMgr)
 
 	if err := server.ServeStdio(s); err != nil {
 		log.Fatalf("server error: %v", err)
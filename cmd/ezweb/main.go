@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -16,46 +17,131 @@ import (
 	"ezweb/internal/domain"
 	"ezweb/internal/handlers"
 	"ezweb/internal/health"
+	"ezweb/internal/logging"
 	"ezweb/internal/metrics"
 	"ezweb/internal/models"
 	"ezweb/internal/portal"
+	"ezweb/internal/scheduler"
+	"ezweb/internal/templates"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/csrf"
+	"github.com/gofiber/fiber/v2/middleware/etag"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 )
 
+// scheduledJobShutdownTimeout is how long shutdown waits for a scheduled job,
+// such as a backup writing its archives, to finish.
+const scheduledJobShutdownTimeout = 60 * time.Second
+
+// runConfigCheck prints the problems config.Check finds and returns the
+// process exit code: 1 if any of them is fatal.
+func runConfigCheck(cfg *config.Config) int {
+	problems := cfg.Check()
+	errs := 0
+	for _, p := range problems {
+		level := "WARN "
+		if p.Fatal {
+			level = "ERROR"
+			errs++
+		}
+		fmt.Printf("%s  %s: %s\n", level, p.Setting, p.Message)
+	}
+	fmt.Printf("Configuration check: %d error(s), %d warning(s)\n", errs, len(problems)-errs)
+	if errs > 0 {
+		return 1
+	}
+	return 0
+}
+
 func main() {
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// Handle --check: report configuration problems and exit, so deploy
+	// scripts and CI can catch them before the service starts.
+	if len(os.Args) > 1 && os.Args[1] == "--check" {
+		os.Exit(runConfigCheck(cfg))
+	}
+
+	logCloser, err := logging.Setup(logging.Options{
+		Level:      cfg.LogLevel,
+		Output:     cfg.LogOutput,
+		FilePath:   cfg.LogFile,
+		MaxSizeMB:  cfg.LogMaxSizeMB,
+		MaxBackups: cfg.LogMaxBackups,
+		Format:     cfg.LogFormat,
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	defer logCloser.Close()
+
 	database, err := db.Open(cfg.DBPath, cfg.DBMaxOpenConns, cfg.DBMaxIdleConns)
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
 	defer database.Close()
 
+	// Optional read-only handle so the health checker's scan and the
+	// dashboard aggregates don't hold connections the write path needs.
+	readDB := database
+	if cfg.DBReadConns > 0 {
+		readDB, err = db.OpenReadOnly(cfg.DBPath, cfg.DBReadConns)
+		if err != nil {
+			log.Fatalf("Failed to open read-only database: %v", err)
+		}
+		defer readDB.Close()
+	}
+
+	// Enable at-rest encryption of server and env var secrets and encrypt any
+	// rows written before the key was configured.
+	if cfg.EncryptionKey != "" {
+		if err := models.SetEncryptionKey(cfg.EncryptionKey); err != nil {
+			log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+		}
+		n, err := models.EncryptServerSecrets(database)
+		if err != nil {
+			log.Fatalf("Failed to encrypt server secrets: %v", err)
+		}
+		if n > 0 {
+			logging.Infof("Encrypted SSH secrets for %d existing server(s)", n)
+		}
+		n, err = models.EncryptEnvVarSecrets(database)
+		if err != nil {
+			log.Fatalf("Failed to encrypt env var secrets: %v", err)
+		}
+		if n > 0 {
+			logging.Infof("Encrypted %d existing secret env var(s)", n)
+		}
+	}
+
+	// Compose templates added or edited from the templates page take
+	// precedence over the ones built into the binary.
+	templates.SetSource(models.TemplateSource(database))
+
 	// Handle --backup CLI flag for use by the systemd backup timer.
 	if len(os.Args) > 1 && os.Args[1] == "--backup" {
 		mgr, err := backup.NewManager(cfg.BackupDir, database)
 		if err != nil {
 			log.Fatalf("Backup manager init failed: %v", err)
 		}
-		results, err := mgr.RunFullBackup(cfg.DBPath)
+		report, err := mgr.RunFullBackup(cfg.DBPath)
 		if err != nil {
 			log.Fatalf("Full backup failed: %v", err)
 		}
-		log.Printf("Backup complete: %d file(s)", len(results))
+		logging.Infof("Backup complete: %d file(s)", len(report.Backups()))
 		return
 	}
 
-	// Set bcrypt cost from config before any password hashing occurs
+	// Set the hashing settings from config before any password hashing occurs
 	auth.BcryptCost = cfg.BcryptCost
+	auth.PasswordAlgorithm = cfg.PasswordHash
 
 	// EnsureAdminExists hashes the password internally and updates the stored
 	// hash when the .env password has changed since the last run.
@@ -70,14 +156,36 @@ func main() {
 	lockout := auth.NewLockoutTracker(cfg.LockoutMaxAttempts, time.Duration(cfg.LockoutDurationMin)*time.Minute)
 	userLockout := auth.NewLockoutTracker(cfg.LockoutMaxAttempts, time.Duration(cfg.LockoutDurationMin)*time.Minute)
 
+	// Sliding login sessions: short-lived access tokens renewed from a
+	// refresh token that expires after JWT_EXPIRY_HOURS of inactivity, or
+	// sooner when SESSION_IDLE_MINUTES is set.
+	session := &auth.Session{
+		DB:            database,
+		Secret:        cfg.JWTSecret,
+		AccessTTL:     time.Duration(cfg.JWTAccessMinutes) * time.Minute,
+		RefreshTTL:    time.Duration(cfg.JWTExpiryHours) * time.Hour,
+		IdleTimeout:   time.Duration(cfg.SessionIdleMinutes) * time.Minute,
+		SecureCookies: cfg.SecureCookies,
+	}
+
 	// Backup manager
 	backupMgr, err := backup.NewManager(cfg.BackupDir, database)
 	if err != nil {
 		log.Fatalf("Failed to initialize backup manager: %v", err)
 	}
+	if n := backupMgr.CleanPartialBackups(); n > 0 {
+		logging.Infof("Removed %d partial backup file(s) left by an interrupted backup", n)
+	}
 
 	// Caddy manager
 	caddyMgr := caddy.NewManager(cfg.CaddyfilePath, cfg.AcmeEmail)
+	caddyMgr.MaintenancePage = cfg.MaintenancePage
+	caddyMgr.GlobalOptions = cfg.CaddyGlobalOptions
+	snippets, err := caddy.LoadSnippets(cfg.CaddySnippetsDir)
+	if err != nil {
+		log.Fatalf("Invalid CADDY_SNIPPETS_DIR: %v", err)
+	}
+	caddyMgr.Snippets = snippets
 
 	// Domain price comparison manager
 	domainMgr := domain.NewManager(database)
@@ -85,30 +193,59 @@ func main() {
 	// Start background health checker
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	emailSender := health.NewEmailSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPFrom, cfg.AlertEmail, cfg.SMTPUsername, cfg.SMTPPassword)
-	checker := health.NewChecker(database, time.Duration(cfg.HealthCheckInterval)*time.Minute, cfg.WebhookURL, cfg.WebhookFormat, cfg.AlertThreshold, cfg.HealthRetentionDays, cfg.ActivityRetentionDays, emailSender)
+	emailSender := health.NewEmailSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPFrom, cfg.AlertEmail, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPTLS)
+	notifiers := health.BuildNotifiers(cfg.WebhookURL, cfg.WebhookFormat, cfg.WebhookURLs, cfg.WebhookFormats, cfg.WebhookSecret, emailSender)
+	checker := health.NewChecker(database, time.Duration(cfg.HealthCheckInterval)*time.Minute, notifiers, cfg.AlertThreshold, cfg.HealthRetentionDays, cfg.ActivityRetentionDays, cfg.HealthCheckConcurrency)
+	checker.ReadDB = readDB
+	checker.AutoEnableSSL = cfg.SSLAutoEnable
+	checker.Client.Timeout = time.Duration(cfg.HealthCheckTimeout) * time.Second
+	checker.TrashRetentionDays = cfg.SiteTrashDays
+	for _, m := range cfg.AlertEscalationMinutes {
+		checker.Escalation = append(checker.Escalation, time.Duration(m)*time.Minute)
+	}
 	go checker.Start(ctx)
 
+	// Scheduled full backups run alongside the health checker.
+	jobs := scheduler.New()
+	if cfg.BackupSchedule != "" {
+		schedule, _ := scheduler.Parse(cfg.BackupSchedule) // validated by config.Load
+		jobs.Add("full backup", schedule, func(context.Context) error {
+			return backupMgr.RunScheduledBackup(cfg.DBPath)
+		})
+		logging.Infof("Scheduled backups enabled (%s), next at %s", cfg.BackupSchedule,
+			schedule.Next(time.Now()).Format("2006-01-02 15:04"))
+	}
+	go jobs.Start(ctx)
+
+	allowIPs, err := config.ParseIPRanges(cfg.AdminAllowIPs)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_ALLOW_IPS: %v", err)
+	}
+	denyIPs, err := config.ParseIPRanges(cfg.AdminDenyIPs)
+	if err != nil {
+		log.Fatalf("Invalid ADMIN_DENY_IPS: %v", err)
+	}
+	ipFilter := auth.NewIPFilter(allowIPs, denyIPs, cfg.AdminIPExemptPaths)
+
 	app := fiber.New(fiber.Config{
 		// Trust X-Forwarded-For from local reverse proxies (e.g. Caddy) so
-		// the rate limiter sees the real client IP instead of 127.0.0.1.
-		ProxyHeader:    "X-Forwarded-For",
-		TrustedProxies: []string{"127.0.0.1", "::1"},
+		// the rate limiter and IP filter see the real client IP instead of
+		// 127.0.0.1. Without the check the header would be believed from
+		// any client. IP validation makes c.IP() the first valid address in
+		// the header rather than the raw, possibly comma-separated, value.
+		ProxyHeader:             "X-Forwarded-For",
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          []string{"127.0.0.1", "::1"},
+		EnableIPValidation:      true,
 
 		// Server-side timeouts.  WriteTimeout is generous to accommodate the
-		// SSE deploy stream, which can run for several minutes.
+		// SSE deploy stream and live log tail, which can run for several
+		// minutes.
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 10 * time.Minute,
 		IdleTimeout:  60 * time.Second,
 
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
-			log.Printf("HTTP %d: %v", code, err)
-			return c.Status(code).SendString("An error occurred")
-		},
+		ErrorHandler: handlers.ErrorHandler,
 	})
 
 	// Global middleware
@@ -128,15 +265,35 @@ func main() {
 		CrossOriginOpenerPolicy: "same-origin-allow-popups",
 	}))
 
+	// Per-request access logs are only written in structured mode, where
+	// they can be filtered by field instead of cluttering the text log.
+	if logging.JSON() {
+		app.Use(logging.RequestLogger())
+	}
+
 	// Metrics middleware (counts requests, tracks latency)
 	if cfg.MetricsEnabled {
 		app.Use(metrics.Middleware())
 	}
 
-	// Static files
-	app.Static("/static", "./static")
+	// Response compression (skips the SSE deploy stream)
+	app.Use(handlers.Compress())
+
+	// JSON error bodies for /api routes and clients that accept JSON.
+	// Registered inside Compress so the rewritten body is the one compressed.
+	app.Use(handlers.JSONErrors())
 
-	// Health probe — unauthenticated, before any auth middleware.
+	// IP allow/deny lists for the admin UI, checked before any route so
+	// blocked clients never reach the login page.
+	if ipFilter != nil {
+		app.Use(ipFilter.Middleware())
+	}
+
+	// Static files, with ETags so unchanged assets revalidate with a 304
+	app.Use("/static", etag.New())
+	app.Static("/static", cfg.StaticDir)
+
+	// Liveness probe — unauthenticated, before any auth middleware.
 	app.Get("/healthz", func(c *fiber.Ctx) error {
 		if err := database.Ping(); err != nil {
 			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
@@ -146,6 +303,9 @@ func main() {
 		}
 		return c.JSON(fiber.Map{"status": "ok", "db": "connected"})
 	})
+	// Readiness probe — 503 until the Caddyfile, backup directory and a first
+	// health check round are in place.
+	app.Get("/readyz", handlers.Readyz(database, checker, cfg.CaddyfilePath, cfg.BackupDir))
 
 	// Prometheus metrics endpoint (unauthenticated for scraping)
 	if cfg.MetricsEnabled {
@@ -155,6 +315,18 @@ func main() {
 	// Public status API (unauthenticated, for external dashboards)
 	app.Get("/api/status", handlers.PublicStatus(database, cfg.PublicDomainFilter))
 
+	// Token-authenticated read-only API for external monitors. Registered
+	// before the protected group so its cookie middleware does not redirect
+	// bearer-token requests to the login page.
+	apiLimiter := limiter.New(limiter.Config{
+		Max:        60,
+		Expiration: 1 * time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return c.IP()
+		},
+	})
+	app.Get("/api/status/full", apiLimiter, session.APIMiddleware(), handlers.FullStatus(database))
+
 	// Rate limit on login
 	loginLimiter := limiter.New(limiter.Config{
 		Max:        10,
@@ -166,10 +338,11 @@ func main() {
 
 	// Public routes
 	app.Get("/login", handlers.LoginPage)
-	app.Post("/login", loginLimiter, handlers.LoginPost(database, cfg, lockout, userLockout))
+	app.Post("/login", loginLimiter, handlers.LoginPost(database, cfg, session, lockout, userLockout))
 	app.Get("/login/2fa", handlers.TOTPVerifyPage)
-	app.Post("/login/2fa", loginLimiter, handlers.TOTPVerifyPost(database, cfg, lockout))
-	app.Get("/logout", handlers.Logout(cfg, database))
+	app.Post("/login/2fa", loginLimiter, handlers.TOTPVerifyPost(database, cfg, session, lockout))
+	app.Post("/auth/refresh", loginLimiter, handlers.RefreshToken(session))
+	app.Get("/logout", handlers.Logout(cfg, session))
 
 	// Public quote routes (no auth required)
 	app.Get("/q/:publicId", handlers.PublicQuote(database))
@@ -212,12 +385,17 @@ func main() {
 	app.Post("/portal/login", loginLimiter, handlers.PortalLoginSubmit(database))
 	app.Get("/portal/verify/:token", handlers.PortalVerifyToken(database))
 
+	// Read-only customer portal links. Registered before the cookie-auth
+	// group below, whose middleware would otherwise redirect to the login
+	// page; the length constraint keeps /portal/dashboard out of this route.
+	app.Get("/portal/:token<len(64)>", handlers.PortalAccess(database))
+
 	// Authenticated client portal routes (client_token cookie required)
 	clientPortal := app.Group("/portal", portal.ClientAuthMiddleware(database))
 	clientPortal.Get("/dashboard", handlers.PortalDashboard(database))
 
 	// Protected routes
-	protected := app.Group("/", auth.AuthMiddleware(cfg.JWTSecret, database))
+	protected := app.Group("/", session.Middleware())
 
 	// General rate limiter for protected routes
 	protected.Use(limiter.New(limiter.Config{
@@ -243,7 +421,8 @@ func main() {
 	}))
 
 	// Dashboard
-	protected.Get("/dashboard", handlers.Dashboard(database))
+	protected.Get("/dashboard", handlers.Dashboard(readDB))
+	protected.Get("/activity", handlers.ListActivity(database))
 
 	// 2FA settings
 	protected.Get("/settings/2fa", handlers.TOTPSetupPage(database, cfg))
@@ -253,20 +432,32 @@ func main() {
 	protected.Get("/quotes/:id", handlers.QuoteDetail(database))
 	protected.Get("/quotes/:id/pdf", handlers.QuotePDF(database))
 	protected.Get("/settings", handlers.SettingsPage(database))
+
+	// API tokens are scoped to the current user, so viewers may manage their
+	// own; a viewer's tokens are always read-only.
+	protected.Get("/settings/tokens", handlers.APITokensPage(database))
+	protected.Post("/settings/tokens", handlers.CreateAPITokenHandler(database))
+	protected.Post("/settings/tokens/:id/revoke", handlers.RevokeAPITokenHandler(database))
 	protected.Get("/customers", handlers.ListCustomers(database))
 	protected.Get("/customers/:id/edit", handlers.EditCustomerForm(database))
 	protected.Get("/customers/:id/cancel", handlers.CancelEditCustomer(database))
+	protected.Get("/customers/:id/portal-links", handlers.CustomerPortalLinks(database))
 	protected.Get("/servers", handlers.ListServers(database))
 	protected.Get("/servers/:id", handlers.ServerDetail(database))
 	protected.Get("/servers/:id/edit", handlers.EditServerForm(database))
 	protected.Get("/servers/:id/row", handlers.CancelEditServer(database))
 	protected.Get("/sites", handlers.ListSites(database))
 	protected.Get("/sites/new", handlers.CreateSiteForm(database))
+	protected.Get("/sites/trash", handlers.ListTrash(database, cfg.SiteTrashDays))
 	protected.Get("/sites/:id", handlers.SiteDetail(database))
-	protected.Get("/sites/:id/deploy/stream", handlers.DeploySSE(database))
+	protected.Get("/sites/:id/deploy/stream", handlers.DeploySSE(database, cfg.ComposeLintPolicy))
 	protected.Get("/sites/:id/logs", handlers.GetSiteLogs(database))
+	protected.Get("/sites/:id/logs/stream", handlers.StreamSiteLogs(database))
 	protected.Get("/sites/:id/health", handlers.GetSiteHealth(database))
+	protected.Get("/sites/:id/health/timeseries", handlers.GetSiteHealthTimeSeries(database))
 	protected.Get("/sites/:id/env", handlers.ListSiteEnvVars(database))
+	protected.Get("/sites/:id/export.json", handlers.ExportSiteConfig(database))
+	protected.Get("/sites/:id/compose/preview", handlers.ComposePreview(database))
 	protected.Get("/import", handlers.ImportPage())
 	protected.Get("/payments", handlers.ListPayments(database))
 	protected.Get("/payments/:id/edit", handlers.EditPaymentForm(database))
@@ -279,12 +470,16 @@ func main() {
 	protected.Get("/backups", handlers.BackupsPage(backupMgr))
 	protected.Get("/backups/:name/download", handlers.DownloadBackup(backupMgr))
 	protected.Get("/api/templates", handlers.ListTemplates(database))
+	protected.Get("/templates", handlers.TemplatesPage(database))
+	protected.Get("/templates/:slug", handlers.TemplateDetailPage(database))
 	protected.Get("/domains", handlers.DomainsPage(database))
 	protected.Post("/domains/search", handlers.SearchDomains(domainMgr))
 	protected.Post("/api/domains/search", handlers.SearchDomainsJSON(domainMgr))
 
 	// Write routes (admin only via WriteProtect)
-	write := protected.Group("/", auth.WriteProtect())
+	// Every write is recorded in the activity log, including ones that
+	// WriteProtect refuses.
+	write := protected.Group("/", handlers.AuditWrites(database), auth.WriteProtect())
 
 	// 2FA writes
 	write.Post("/settings/2fa/enable", handlers.TOTPEnable(database))
@@ -305,35 +500,49 @@ func main() {
 	write.Post("/customers", handlers.CreateCustomer(database))
 	write.Put("/customers/:id", handlers.UpdateCustomer(database))
 	write.Delete("/customers/:id", handlers.DeleteCustomer(database))
+	write.Post("/customers/:id/portal-links", handlers.CreatePortalLink(database))
+	write.Delete("/customers/:id/portal-links/:tokenId", handlers.RevokePortalLink(database))
 
 	// Server writes
 	write.Post("/servers", handlers.CreateServerHandler(database, cfg.SSHKeyDir))
-	write.Put("/servers/:id", handlers.UpdateServerHandler(database, cfg.SSHKeyDir))
+	write.Post("/servers/test-all", handlers.TestAllServersHandler(database))
+	write.Put("/servers/:id", handlers.UpdateServerHandler(database, caddyMgr, cfg.SSHKeyDir))
 	write.Delete("/servers/:id", handlers.DeleteServerHandler(database))
 	write.Post("/servers/:id/test", handlers.TestServerConnection(database))
+	write.Post("/servers/:id/host-key", handlers.RepinServerHostKey(database))
 	write.Post("/servers/:id/discover", handlers.DiscoverServerProjects(database))
-	write.Post("/servers/:id/import", handlers.ImportRemoteProject(database, caddyMgr))
+	write.Post("/servers/:id/import", handlers.ImportRemoteProject(database, caddyMgr, cfg.ComposeLintPolicy))
+	write.Post("/servers/:id/drain", handlers.DrainServer(database, caddyMgr))
+	write.Post("/servers/:id/resume", handlers.ResumeServer(database, caddyMgr))
 
 	// Site writes
 	write.Post("/sites/bulk", handlers.BulkSiteAction(database))
 	write.Post("/sites", handlers.CreateSite(database, caddyMgr))
+	write.Post("/sites/import.json", handlers.ImportSiteConfig(database))
 	write.Put("/sites/:id", handlers.UpdateSite(database, caddyMgr))
-	write.Delete("/sites/:id", handlers.DeleteSite(database, caddyMgr))
-	write.Post("/sites/:id/deploy", handlers.DeploySite(database))
+	write.Put("/sites/:id/git", handlers.UpdateSiteGitSource(database, cfg.SSHKeyDir))
+	write.Delete("/sites/:id", handlers.DeleteSite(database, caddyMgr, cfg.SiteTrashDays))
+	write.Post("/sites/:id/restore", handlers.RestoreSite(database, caddyMgr))
+	write.Post("/sites/:id/clone", handlers.CloneSite(database))
+	write.Post("/sites/:id/deploy", handlers.DeploySite(database, cfg.ComposeLintPolicy))
+	write.Post("/sites/:id/rollback/:deployId", handlers.RollbackSite(database))
 	write.Post("/sites/:id/start", handlers.StartSite(database))
 	write.Post("/sites/:id/stop", handlers.StopSite(database))
 	write.Post("/sites/:id/restart", handlers.RestartSite(database))
+	write.Post("/sites/:id/maintenance", handlers.ToggleSiteMaintenance(database, caddyMgr))
 
 	// Site env var writes
 	write.Post("/sites/:id/env", handlers.CreateSiteEnvVar(database))
 	write.Delete("/sites/:id/env/:varId", handlers.DeleteSiteEnvVar(database))
+	write.Post("/sites/:id/env/:varId/reveal", handlers.RevealSiteEnvVar(database))
 
 	// Import writes
 	write.Post("/import/scan", handlers.ScanProjects(database))
-	write.Post("/import", handlers.ImportProject(database, caddyMgr))
+	write.Post("/import", handlers.ImportProject(database, caddyMgr, cfg.ComposeLintPolicy))
 
 	// Payment writes
 	write.Post("/payments", handlers.CreatePayment(database))
+	write.Post("/payments/bulk", handlers.BulkPaymentAction(database))
 	write.Put("/payments/:id", handlers.UpdatePayment(database))
 	write.Post("/payments/:id/mark-paid", handlers.MarkPaid(database))
 	write.Delete("/payments/:id", handlers.DeletePayment(database))
@@ -357,15 +566,24 @@ func main() {
 		return models.GetSiteByID(database, id)
 	}))
 	write.Delete("/backups/:name", handlers.DeleteBackup(backupMgr))
-	write.Post("/backups/:name/restore", handlers.RestoreBackup(backupMgr, cfg.DBPath))
+	write.Post("/backups/:name/restore", handlers.RestoreBackup(backupMgr, cfg.DBPath, database, caddyMgr, checker))
+	write.Post("/backups/:name/restore-site", handlers.RestoreSiteBackup(backupMgr, database))
 
 	// User management (admin only — extra AdminOnly guard)
 	adminOnly := protected.Group("/", auth.AdminOnly())
-	adminOnly.Get("/users", handlers.ListUsers(database))
+	adminOnly.Post("/templates", handlers.CreateTemplateHandler(database))
+	adminOnly.Put("/templates/:slug", handlers.UpdateTemplateHandler(database))
+	adminOnly.Delete("/templates/:slug", handlers.DeleteTemplateHandler(database))
+	adminOnly.Get("/users", handlers.ListUsers(database, lockout, userLockout))
+	adminOnly.Post("/users/lockouts/clear", handlers.ClearLockout(database, lockout, userLockout))
 	adminOnly.Post("/users", handlers.CreateUser(database))
 	adminOnly.Delete("/users/:id", handlers.DeleteUserHandler(database))
 	adminOnly.Put("/users/:id/password", handlers.ChangePassword(database))
 	adminOnly.Put("/users/:id/role", handlers.UpdateUserRoleHandler(database))
+	adminOnly.Post("/settings/alerts/test", handlers.TestAlerts(database, notifiers))
+	adminOnly.Get("/sites/:id/env/rendered", handlers.RenderedSiteEnv(database))
+	adminOnly.Get("/caddy/preview", handlers.CaddyPreview(database, caddyMgr))
+	adminOnly.Post("/caddy/regenerate", handlers.RegenerateCaddy(database, caddyMgr))
 
 	// Redirect root to dashboard
 	app.Get("/", func(c *fiber.Ctx) error {
@@ -377,11 +595,15 @@ func main() {
 		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 		<-sigChan
-		log.Println("Shutting down...")
+		logging.Infof("Shutting down...")
 		cancel()
+		// Let a scheduled backup that is writing files finish first.
+		if !jobs.Wait(scheduledJobShutdownTimeout) {
+			logging.Warnf("Scheduled job still running after %s, exiting anyway", scheduledJobShutdownTimeout)
+		}
 		_ = app.Shutdown()
 	}()
 
-	log.Printf("EzWeb starting on port %s", cfg.Port)
+	logging.Infof("EzWeb starting on port %s", cfg.Port)
 	log.Fatal(app.Listen(":" + cfg.Port))
 }
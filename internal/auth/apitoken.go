@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APITokenPrefix marks EzWeb API tokens so they are recognisable in configs
+// and secret scanners.
+const APITokenPrefix = "ezw_"
+
+// APIToken is a long-lived bearer token owned by a user. The plaintext is
+// only available when the token is created; the database keeps its hash.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Role       string
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+// ValidAPITokenRole reports whether role can be assigned to an API token.
+func ValidAPITokenRole(role string) bool {
+	return role == "admin" || role == "viewer"
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken mints a new token for userID and returns its plaintext. A
+// token cannot be given more access than its owner: an admin token requested
+// by a viewer is stored as a viewer token.
+func CreateAPIToken(db *sql.DB, userID int, name, role string) (string, *APIToken, error) {
+	if !ValidAPITokenRole(role) {
+		return "", nil, fmt.Errorf("invalid token role %q", role)
+	}
+	var userRole string
+	if err := db.QueryRow("SELECT COALESCE(role, 'admin') FROM users WHERE id = ?", userID).Scan(&userRole); err != nil {
+		return "", nil, fmt.Errorf("failed to load user %d: %w", userID, err)
+	}
+	if userRole != "admin" {
+		role = "viewer"
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	plain := APITokenPrefix + hex.EncodeToString(b)
+
+	res, err := db.Exec(
+		"INSERT INTO api_tokens (user_id, name, token_hash, role) VALUES (?, ?, ?, ?)",
+		userID, name, hashAPIToken(plain), role,
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to store API token: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	return plain, &APIToken{ID: int(id), UserID: userID, Name: name, Role: role, CreatedAt: time.Now()}, nil
+}
+
+// ListAPITokens returns the user's tokens, newest first, including revoked
+// ones so the settings page can show their history.
+func ListAPITokens(db *sql.DB, userID int) ([]APIToken, error) {
+	rows, err := db.Query(
+		"SELECT id, user_id, name, role, last_used_at, revoked_at, created_at FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC, id DESC",
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.UserID, &t.Name, &t.Role, &t.LastUsedAt, &t.RevokedAt, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes one of userID's tokens. Revoking a token that does
+// not belong to the user, or is already revoked, returns sql.ErrNoRows.
+func RevokeAPIToken(db *sql.DB, userID, id int) error {
+	res, err := db.Exec(
+		"UPDATE api_tokens SET revoked_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ? AND revoked_at IS NULL",
+		id, userID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API token %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ValidateAPIToken looks up an unrevoked token and returns claims for its
+// owner. The role is the token's role, downgraded to viewer if the owner has
+// since lost admin rights.
+func ValidateAPIToken(db *sql.DB, token string) (*Claims, int, error) {
+	if !strings.HasPrefix(token, APITokenPrefix) {
+		return nil, 0, errors.New("not an API token")
+	}
+	var (
+		id, userID                int
+		tokenRole, username, role string
+	)
+	err := db.QueryRow(`
+		SELECT t.id, t.user_id, t.role, u.username, COALESCE(u.role, 'admin')
+		FROM api_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = ? AND t.revoked_at IS NULL`,
+		hashAPIToken(token),
+	).Scan(&id, &userID, &tokenRole, &username, &role)
+	if err == sql.ErrNoRows {
+		return nil, 0, errors.New("unknown or revoked API token")
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to look up API token: %w", err)
+	}
+	if role != "admin" {
+		tokenRole = "viewer"
+	}
+
+	db.Exec("UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	return &Claims{UserID: userID, Username: username, Role: tokenRole}, id, nil
+}
+
+// APIMiddleware authenticates API routes that external tools call. It
+// accepts "Authorization: Bearer <token>" with an API token, and otherwise
+// falls back to the access token cookie so the same routes work from a
+// logged-in browser. Failures get a 401 JSON response instead of a redirect
+// to the login page. The role stored in locals is the token's role, so
+// AdminOnly and WriteProtect apply to token requests unchanged.
+func (s *Session) APIMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if header := c.Get(fiber.HeaderAuthorization); header != "" {
+			token, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				return apiUnauthorized(c)
+			}
+			claims, id, err := ValidateAPIToken(s.DB, strings.TrimSpace(token))
+			if err != nil {
+				return apiUnauthorized(c)
+			}
+			setClaimsLocals(c, claims)
+			c.Locals("api_token_id", id)
+			return c.Next()
+		}
+
+		if tokenStr := c.Cookies(AccessCookie); tokenStr != "" {
+			if claims, err := validateAccessToken(s.DB, tokenStr, s.Secret); err == nil {
+				if err := s.touch(claims.SessionID); err != nil {
+					s.Revoke(c)
+					return apiUnauthorized(c)
+				}
+				setClaimsLocals(c, claims)
+				return c.Next()
+			}
+		}
+		return apiUnauthorized(c)
+	}
+}
+
+func apiUnauthorized(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Bearer realm="ezweb"`)
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or missing API token"})
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newAPITokenTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := newSessionTestDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE api_tokens (id INTEGER PRIMARY KEY AUTOINCREMENT, user_id INTEGER NOT NULL, name TEXT NOT NULL, token_hash TEXT NOT NULL UNIQUE, role TEXT NOT NULL DEFAULT 'viewer', last_used_at DATETIME, revoked_at DATETIME, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+		INSERT INTO users (id, username, role) VALUES (2, 'viewer', 'viewer');
+	`)
+	if err != nil {
+		t.Fatalf("create api_tokens table: %v", err)
+	}
+	return db
+}
+
+func bearerRequest(method, token string) *http.Request {
+	req := httptest.NewRequest(method, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAPIMiddleware_ReadOnlyTokenCannotWrite(t *testing.T) {
+	db := newAPITokenTestDB(t)
+	token, _, err := CreateAPIToken(db, 1, "monitor", "viewer")
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	app := newApp(newTestSession(db).APIMiddleware(), WriteProtect())
+
+	resp, err := app.Test(bearerRequest(http.MethodGet, token))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET with read-only token: got %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = app.Test(bearerRequest(http.MethodPost, token))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("POST with read-only token: got %d, want 403", resp.StatusCode)
+	}
+
+	tokens, err := ListAPITokens(db, 1)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("ListAPITokens = %v, %v", tokens, err)
+	}
+	if !tokens[0].LastUsedAt.Valid {
+		t.Error("last_used_at not recorded")
+	}
+}
+
+func TestAPIMiddleware_RejectsRevokedAndUnknownTokens(t *testing.T) {
+	db := newAPITokenTestDB(t)
+	token, created, err := CreateAPIToken(db, 1, "monitor", "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if err := RevokeAPIToken(db, 2, created.ID); err != sql.ErrNoRows {
+		t.Errorf("revoking another user's token: got %v, want sql.ErrNoRows", err)
+	}
+	if err := RevokeAPIToken(db, 1, created.ID); err != nil {
+		t.Fatalf("RevokeAPIToken: %v", err)
+	}
+
+	app := newApp(newTestSession(db).APIMiddleware())
+	for _, tok := range []string{token, APITokenPrefix + "deadbeef", "not-a-token", ""} {
+		resp, err := app.Test(bearerRequest(http.MethodGet, tok))
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: got %d, want 401", tok, resp.StatusCode)
+		}
+	}
+}
+
+func TestCreateAPIToken_CappedByOwnerRole(t *testing.T) {
+	db := newAPITokenTestDB(t)
+	token, created, err := CreateAPIToken(db, 2, "ci", "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if created.Role != "viewer" {
+		t.Errorf("viewer minted a %q token", created.Role)
+	}
+
+	// An admin token loses write access when its owner is demoted.
+	adminToken, _, err := CreateAPIToken(db, 1, "deploy", "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIToken: %v", err)
+	}
+	if _, err := db.Exec("UPDATE users SET role = 'viewer' WHERE id = 1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tok := range []string{token, adminToken} {
+		claims, _, err := ValidateAPIToken(db, tok)
+		if err != nil {
+			t.Fatalf("ValidateAPIToken: %v", err)
+		}
+		if claims.Role != "viewer" {
+			t.Errorf("effective role = %q, want viewer", claims.Role)
+		}
+	}
+}
@@ -11,7 +11,29 @@ import (
 // Configurable at startup via config.
 var BcryptCost = bcrypt.DefaultCost
 
+// Password hashing algorithms accepted by PasswordAlgorithm.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// PasswordAlgorithm is the algorithm HashPassword uses for new hashes.
+// CheckPassword accepts either, so it can be changed at any time; stored
+// hashes move over as their users log in (see NeedsRehash).
+var PasswordAlgorithm = AlgorithmBcrypt
+
+// HashPassword hashes a login password with PasswordAlgorithm.
 func HashPassword(password string) (string, error) {
+	if PasswordAlgorithm == AlgorithmArgon2id {
+		return hashArgon2id(password)
+	}
+	return HashBcrypt(password)
+}
+
+// HashBcrypt hashes password with bcrypt at BcryptCost whatever
+// PasswordAlgorithm is, for consumers such as Caddy's basic_auth that only
+// understand bcrypt.
+func HashBcrypt(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
 	if err != nil {
 		return "", err
@@ -19,11 +41,30 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), nil
 }
 
+// CheckPassword reports whether password matches hashed, which may be a
+// bcrypt or an argon2id hash.
 func CheckPassword(hashed, password string) bool {
+	if isArgon2idHash(hashed) {
+		return checkArgon2id(hashed, password)
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(hashed), []byte(password))
 	return err == nil
 }
 
+// NeedsRehash reports whether hashed was made with another algorithm or
+// weaker parameters than HashPassword now uses. Call it after a successful
+// CheckPassword and store a fresh hash of the password when it is true.
+func NeedsRehash(hashed string) bool {
+	if PasswordAlgorithm == AlgorithmArgon2id {
+		return !isArgon2idHash(hashed) || !argon2idCurrent(hashed)
+	}
+	if isArgon2idHash(hashed) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hashed))
+	return err != nil || cost != BcryptCost
+}
+
 // ValidatePasswordStrength checks that a password meets complexity requirements.
 // Returns nil if valid, or a descriptive error.
 func ValidatePasswordStrength(password string) error {
@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrSessionIdle is returned when a session has gone longer than the idle
+// timeout without a request.
+var ErrSessionIdle = errors.New("session expired after inactivity")
+
+// activityWriteInterval is how often a busy session's last-seen time is
+// written to session_activity. Requests in between are only checked
+// against the in-memory copy, so the idle timeout is accurate to within
+// this interval.
+const activityWriteInterval = time.Minute
+
+// activityCacheStore holds the last-seen time last written for each
+// session, so the hot auth path does not query session_activity on every
+// request.
+type activityCacheStore struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+var globalActivityCache = &activityCacheStore{
+	seen: make(map[string]time.Time),
+}
+
+func (c *activityCacheStore) get(sid string) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.seen[sid]
+	return t, ok
+}
+
+// set stores t for sid and, at most once per activityWriteInterval, drops
+// entries older than maxAge, which belong to sessions that have ended.
+func (c *activityCacheStore) set(sid string, t time.Time, maxAge time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seen[sid] = t
+	if t.Sub(c.lastSweep) < activityWriteInterval {
+		return
+	}
+	c.lastSweep = t
+	for id, seen := range c.seen {
+		if t.Sub(seen) > maxAge {
+			delete(c.seen, id)
+		}
+	}
+}
+
+func (c *activityCacheStore) evict(sid string) {
+	c.mu.Lock()
+	delete(c.seen, sid)
+	c.mu.Unlock()
+}
+
+// touch records a request on session sid. It returns ErrSessionIdle when
+// the session's previous request was more than IdleTimeout ago, and nil
+// when no idle timeout is configured or the token carries no session.
+// Like IsRevoked it fails open on database errors.
+func (s *Session) touch(sid string) error {
+	if s.IdleTimeout <= 0 || sid == "" {
+		return nil
+	}
+	now := time.Now()
+
+	last, ok := globalActivityCache.get(sid)
+	if !ok {
+		var seen string
+		err := s.DB.QueryRow("SELECT last_seen_at FROM session_activity WHERE session_id = ?", sid).Scan(&seen)
+		switch {
+		case err == sql.ErrNoRows:
+			// A new login, or one from before the idle timeout was
+			// enabled: its idle time starts now.
+			s.recordActivity(sid, now)
+			return nil
+		case err != nil:
+			return nil
+		}
+		if last, err = time.Parse(time.RFC3339, seen); err != nil {
+			s.recordActivity(sid, now)
+			return nil
+		}
+	}
+
+	if now.Sub(last) > s.IdleTimeout {
+		globalActivityCache.evict(sid)
+		if _, err := s.DB.Exec("DELETE FROM session_activity WHERE session_id = ?", sid); err != nil {
+			log.Printf("failed to delete activity of idle session: %v", err)
+		}
+		return ErrSessionIdle
+	}
+	if now.Sub(last) >= activityWriteInterval {
+		s.recordActivity(sid, now)
+	} else if !ok {
+		globalActivityCache.set(sid, last, s.IdleTimeout)
+	}
+	return nil
+}
+
+// activityTTL is how long a session_activity row is kept after the last
+// request it records. touch reads a missing row as a session it has never
+// seen, so the row must outlive every token of the session, not just the
+// idle timeout: otherwise CleanupExpiredTokens would delete exactly the
+// rows of idle sessions and their next request would start afresh. A
+// refresh token lasts RefreshTTL from its last rotation, which is at most
+// activityWriteInterval after the last recorded request.
+func (s *Session) activityTTL() time.Duration {
+	return max(s.RefreshTTL, s.IdleTimeout) + activityWriteInterval
+}
+
+// recordActivity stores now as the last-seen time of session sid. The row
+// is kept until no token of the session can still be valid; see
+// activityTTL.
+func (s *Session) recordActivity(sid string, now time.Time) {
+	_, err := s.DB.Exec(
+		`INSERT INTO session_activity (session_id, last_seen_at, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(session_id) DO UPDATE SET last_seen_at = excluded.last_seen_at, expires_at = excluded.expires_at`,
+		sid, now.UTC().Format(time.RFC3339), now.Add(s.activityTTL()).UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		log.Printf("failed to record session activity: %v", err)
+		return
+	}
+	globalActivityCache.set(sid, now, s.IdleTimeout)
+}
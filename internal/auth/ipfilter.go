@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// IPFilter limits the admin UI to clients whose address is allowed.
+type IPFilter struct {
+	allow  []*net.IPNet
+	deny   []*net.IPNet
+	exempt []string
+}
+
+// NewIPFilter builds a filter from allow and deny lists of ranges, as
+// config.ParseIPRanges returns them. exempt lists path prefixes the filter
+// never applies to. A nil filter is returned when both lists are empty.
+func NewIPFilter(allow, deny []*net.IPNet, exempt []string) *IPFilter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	f := &IPFilter{allow: allow, deny: deny}
+	for _, p := range exempt {
+		if p = strings.TrimRight(strings.TrimSpace(p), "/"); p != "" {
+			f.exempt = append(f.exempt, p)
+		}
+	}
+	return f
+}
+
+// Allowed reports whether a client at ip may reach the admin UI: it is not
+// on the deny list, and it is on the allow list if there is one. Addresses
+// that do not parse are refused.
+func (f *IPFilter) Allowed(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, n := range f.deny {
+		if n.Contains(addr) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, n := range f.allow {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Exempt reports whether path is under one of the exempt prefixes.
+func (f *IPFilter) Exempt(path string) bool {
+	for _, p := range f.exempt {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware answers 403 to blocked clients on every path that is not
+// exempt. It runs before authentication, so a blocked client never sees
+// the login page. The client address is c.IP(), which honours
+// X-Forwarded-For only from the trusted local proxies and, with Fiber's
+// EnableIPValidation, takes the first valid address in it; a request from
+// one of them without the header is a local connection and is judged by
+// its own address.
+func (f *IPFilter) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if f.Exempt(c.Path()) {
+			return c.Next()
+		}
+		ip := c.IP()
+		if ip == "" {
+			ip = c.Context().RemoteIP().String()
+		}
+		if !f.Allowed(ip) {
+			return c.Status(fiber.StatusForbidden).SendString("Forbidden")
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// cidrs parses CIDR ranges for a test filter.
+func cidrs(t *testing.T, ranges ...string) []*net.IPNet {
+	t.Helper()
+	var nets []*net.IPNet
+	for _, r := range ranges {
+		_, n, err := net.ParseCIDR(r)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%q): %v", r, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+func TestIPFilter_Allowed(t *testing.T) {
+	f := NewIPFilter(cidrs(t, "203.0.113.0/24", "198.51.100.7/32", "2001:db8::/32"), cidrs(t, "203.0.113.66/32"), nil)
+	cases := map[string]bool{
+		"203.0.113.10":          true,
+		"203.0.113.66":          false, // denied inside an allowed range
+		"198.51.100.7":          true,
+		"198.51.100.8":          false,
+		"2001:db8::1":           true,
+		"192.0.2.1":             false,
+		"":                      false,
+		"1.2.3.4, 203.0.113.10": false, // an unparsed forwarding chain is refused
+	}
+	for ip, want := range cases {
+		if got := f.Allowed(ip); got != want {
+			t.Errorf("Allowed(%q) = %v, want %v", ip, got, want)
+		}
+	}
+}
+
+func TestIPFilter_DenyOnly(t *testing.T) {
+	f := NewIPFilter(nil, cidrs(t, "192.0.2.0/24"), nil)
+	if f.Allowed("192.0.2.5") {
+		t.Error("denied address allowed")
+	}
+	if !f.Allowed("198.51.100.1") {
+		t.Error("without an allow list, other addresses should be allowed")
+	}
+}
+
+func TestNewIPFilter_Empty(t *testing.T) {
+	if f := NewIPFilter(nil, nil, []string{"/healthz"}); f != nil {
+		t.Errorf("NewIPFilter with empty lists = %v, want nil", f)
+	}
+}
+
+func TestIPFilter_Middleware(t *testing.T) {
+	f := NewIPFilter(cidrs(t, "203.0.113.0/24"), nil, []string{"/healthz", "/api/status/"})
+	app := fiber.New(fiber.Config{
+		DisableStartupMessage:   true,
+		ProxyHeader:             "X-Forwarded-For",
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          []string{"0.0.0.0"}, // app.Test's remote address
+		EnableIPValidation:      true,
+	})
+	app.Use(f.Middleware())
+	for _, p := range []string{"/login", "/healthz", "/healthzx", "/api/status", "/api/status/summary"} {
+		app.Get(p, func(c *fiber.Ctx) error { return c.SendString("ok") })
+	}
+
+	cases := []struct {
+		path, ip string
+		want     int
+	}{
+		{"/login", "203.0.113.9", http.StatusOK},
+		{"/login", "192.0.2.1", http.StatusForbidden},
+		{"/login", "unknown, 203.0.113.9", http.StatusOK},
+		{"/login", "192.0.2.1, 203.0.113.9", http.StatusForbidden},
+		{"/healthz", "192.0.2.1", http.StatusOK},
+		{"/healthzx", "192.0.2.1", http.StatusForbidden},
+		{"/api/status", "192.0.2.1", http.StatusOK},
+		{"/api/status/summary", "192.0.2.1", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.Header.Set("X-Forwarded-For", tc.ip)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test: %v", err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Errorf("GET %s from %s = %d, want %d", tc.path, tc.ip, resp.StatusCode, tc.want)
+		}
+	}
+}
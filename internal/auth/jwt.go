@@ -75,31 +75,127 @@ func (c *revocationCacheStore) evict(jti string) {
 	c.mu.Unlock()
 }
 
+// Token types carried in the "typ" claim. Tokens issued before refresh
+// tokens existed have no type and are treated as access tokens.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
+// refreshReuseGrace is how long a refresh token stays usable after it has
+// been rotated. Several HTMX requests can hit an expired access token at the
+// same moment; the grace window lets all of them refresh instead of logging
+// the user out because one of them rotated the token first.
+const refreshReuseGrace = 30 * time.Second
+
 type Claims struct {
-	UserID   int    `json:"user_id"`
-	Username string `json:"username"`
-	Role     string `json:"role"`
+	UserID    int    `json:"user_id"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	TokenType string `json:"typ,omitempty"`
+	// SessionID ties the access and refresh tokens of one login together
+	// across refreshes, for the idle timeout. Tokens not issued by Session
+	// have none.
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// IsRefresh reports whether the claims belong to a refresh token.
+func (c *Claims) IsRefresh() bool {
+	return c.TokenType == TokenTypeRefresh
+}
+
 func GenerateToken(userID int, username, role, secret string, expiryHours int) (string, error) {
-	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		Role:     role,
+	signed, _, err := signToken(userID, username, role, TokenTypeAccess, "", secret, time.Duration(expiryHours)*time.Hour)
+	return signed, err
+}
+
+func signToken(userID int, username, role, tokenType, sid, secret string, ttl time.Duration) (string, *Claims, error) {
+	now := time.Now()
+	claims := &Claims{
+		UserID:    userID,
+		Username:  username,
+		Role:      role,
+		TokenType: tokenType,
+		SessionID: sid,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ID:        uuid.NewString(),
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(expiryHours) * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := token.SignedString([]byte(secret))
 	if err != nil {
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		return "", nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, claims, nil
+}
+
+// GenerateRefreshToken signs a refresh token and records its JTI in
+// refresh_tokens so it can be looked up, rotated, and revoked. sid is the
+// login session the token belongs to.
+func GenerateRefreshToken(db *sql.DB, userID int, username, role, sid, secret string, ttl time.Duration) (string, *Claims, error) {
+	signed, claims, err := signToken(userID, username, role, TokenTypeRefresh, sid, secret, ttl)
+	if err != nil {
+		return "", nil, err
+	}
+	_, err = db.Exec(
+		"INSERT INTO refresh_tokens (jti, user_id, expires_at) VALUES (?, ?, ?)",
+		claims.ID, userID, claims.ExpiresAt.UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return signed, claims, nil
+}
+
+// ValidateRefreshToken checks a refresh token's signature and type, that it
+// has not been revoked, and that it is still on record. A token that has
+// already been rotated is accepted only within refreshReuseGrace.
+func ValidateRefreshToken(db *sql.DB, tokenString, secret string) (*Claims, error) {
+	claims, err := ValidateToken(tokenString, secret)
+	if err != nil {
+		return nil, err
+	}
+	if !claims.IsRefresh() {
+		return nil, fmt.Errorf("not a refresh token")
+	}
+	if IsRevoked(db, claims.ID) {
+		return nil, fmt.Errorf("refresh token has been revoked")
+	}
+
+	var rotatedAt sql.NullString
+	err = db.QueryRow("SELECT rotated_at FROM refresh_tokens WHERE jti = ?", claims.ID).Scan(&rotatedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("unknown refresh token")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+	if rotatedAt.Valid {
+		t, err := time.Parse(time.RFC3339, rotatedAt.String)
+		if err != nil || time.Since(t) > refreshReuseGrace {
+			return nil, fmt.Errorf("refresh token has already been used")
+		}
+	}
+	return claims, nil
+}
+
+// markRefreshTokenRotated flags a refresh token as replaced. It reports false
+// if the token had already been rotated, in which case the caller should not
+// issue another replacement.
+func markRefreshTokenRotated(db *sql.DB, jti string) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE refresh_tokens SET rotated_at = ? WHERE jti = ? AND rotated_at IS NULL",
+		time.Now().UTC().Format(time.RFC3339), jti,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to rotate refresh token: %w", err)
 	}
-	return signed, nil
+	n, _ := res.RowsAffected()
+	return n == 1, nil
 }
 
 func ValidateToken(tokenString, secret string) (*Claims, error) {
@@ -161,7 +257,11 @@ func IsRevoked(db *sql.DB, jti string) bool {
 	return revoked
 }
 
-// CleanupExpiredTokens removes revoked token entries that have already expired.
+// CleanupExpiredTokens removes revoked token, refresh token and session
+// activity entries that have already expired.
 func CleanupExpiredTokens(db *sql.DB) {
-	db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now().UTC().Format(time.RFC3339))
+	now := time.Now().UTC().Format(time.RFC3339)
+	db.Exec("DELETE FROM revoked_tokens WHERE expires_at < ?", now)
+	db.Exec("DELETE FROM refresh_tokens WHERE expires_at < ?", now)
+	db.Exec("DELETE FROM session_activity WHERE expires_at < ?", now)
 }
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"sort"
 	"sync"
 	"time"
 )
@@ -11,6 +12,14 @@ type loginAttempt struct {
 	LockedAt time.Time
 }
 
+// Lockout describes a key that is currently locked out.
+type Lockout struct {
+	Key      string
+	Failures int
+	LockedAt time.Time
+	Until    time.Time
+}
+
 type LockoutTracker struct {
 	mu       sync.Mutex
 	attempts map[string]*loginAttempt
@@ -47,8 +56,9 @@ func (lt *LockoutTracker) IsLocked(key string) bool {
 	return false
 }
 
-// RecordFailure increments the failure count for a key.
-func (lt *LockoutTracker) RecordFailure(key string) {
+// RecordFailure increments the failure count for a key and reports whether
+// this failure is the one that locked it.
+func (lt *LockoutTracker) RecordFailure(key string) bool {
 	lt.mu.Lock()
 	defer lt.mu.Unlock()
 
@@ -64,6 +74,7 @@ func (lt *LockoutTracker) RecordFailure(key string) {
 	if a.Count >= lt.maxFails {
 		a.LockedAt = time.Now()
 	}
+	return a.Count == lt.maxFails
 }
 
 // Reset clears the failure count for a key (called on successful login).
@@ -72,3 +83,39 @@ func (lt *LockoutTracker) Reset(key string) {
 	defer lt.mu.Unlock()
 	delete(lt.attempts, key)
 }
+
+// Locked returns the keys that are currently locked out, most recently
+// locked first. Expired lockouts are dropped along the way.
+func (lt *LockoutTracker) Locked() []Lockout {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	var out []Lockout
+	for key, a := range lt.attempts {
+		if a.Count < lt.maxFails {
+			continue
+		}
+		until := a.LockedAt.Add(lt.lockDur)
+		if !time.Now().Before(until) {
+			delete(lt.attempts, key)
+			continue
+		}
+		out = append(out, Lockout{Key: key, Failures: a.Count, LockedAt: a.LockedAt, Until: until})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].LockedAt.After(out[j].LockedAt) })
+	return out
+}
+
+// Clear lifts a lockout early, also forgetting earlier failures, and reports
+// whether the key was locked.
+func (lt *LockoutTracker) Clear(key string) bool {
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	a, ok := lt.attempts[key]
+	if !ok {
+		return false
+	}
+	delete(lt.attempts, key)
+	return a.Count >= lt.maxFails && time.Since(a.LockedAt) < lt.lockDur
+}
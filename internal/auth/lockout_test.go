@@ -59,3 +59,33 @@ func TestLockout_ResetClearsLockout(t *testing.T) {
 		t.Error("should not be locked after reset")
 	}
 }
+
+func TestLockout_LockedAndClear(t *testing.T) {
+	lt := NewLockoutTracker(2, 5*time.Minute)
+
+	if lt.RecordFailure("alice") {
+		t.Error("first failure should not lock")
+	}
+	if !lt.RecordFailure("alice") {
+		t.Error("second failure should report the lock")
+	}
+	lt.RecordFailure("bob")
+
+	locked := lt.Locked()
+	if len(locked) != 1 || locked[0].Key != "alice" || locked[0].Failures != 2 {
+		t.Fatalf("Locked() = %+v, want only alice with 2 failures", locked)
+	}
+	if !locked[0].Until.After(locked[0].LockedAt) {
+		t.Errorf("Until %s should be after LockedAt %s", locked[0].Until, locked[0].LockedAt)
+	}
+
+	if lt.Clear("bob") {
+		t.Error("Clear should report false for a key that was not locked")
+	}
+	if !lt.Clear("alice") {
+		t.Error("Clear should report true for a locked key")
+	}
+	if lt.IsLocked("alice") || len(lt.Locked()) != 0 {
+		t.Error("alice should no longer be locked")
+	}
+}
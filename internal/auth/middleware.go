@@ -2,6 +2,7 @@ package auth
 
 import (
 	"database/sql"
+	"errors"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -12,31 +13,47 @@ func AuthMiddleware(secret string, db ...*sql.DB) fiber.Handler {
 		database = db[0]
 	}
 	return func(c *fiber.Ctx) error {
-		tokenStr := c.Cookies("token")
+		tokenStr := c.Cookies(AccessCookie)
 		if tokenStr == "" {
 			return c.Redirect("/login")
 		}
 
-		claims, err := ValidateToken(tokenStr, secret)
+		claims, err := validateAccessToken(database, tokenStr, secret)
 		if err != nil {
-			c.ClearCookie("token")
+			c.ClearCookie(AccessCookie)
 			return c.Redirect("/login")
 		}
 
-		// Check token revocation blocklist
-		if database != nil && claims.ID != "" && IsRevoked(database, claims.ID) {
-			c.ClearCookie("token")
-			return c.Redirect("/login")
-		}
-
-		c.Locals("user_id", claims.UserID)
-		c.Locals("username", claims.Username)
-		c.Locals("role", claims.Role)
-		c.Locals("token_claims", claims)
+		setClaimsLocals(c, claims)
 		return c.Next()
 	}
 }
 
+// validateAccessToken validates tokenStr as an access token: a valid
+// signature, not a refresh token, and not on the revocation blocklist.
+func validateAccessToken(db *sql.DB, tokenStr, secret string) (*Claims, error) {
+	claims, err := ValidateToken(tokenStr, secret)
+	if err != nil {
+		return nil, err
+	}
+	// A refresh token must only ever be exchanged at the refresh endpoint.
+	if claims.IsRefresh() {
+		return nil, errors.New("refresh token used as access token")
+	}
+	// Check token revocation blocklist
+	if db != nil && claims.ID != "" && IsRevoked(db, claims.ID) {
+		return nil, errors.New("token has been revoked")
+	}
+	return claims, nil
+}
+
+func setClaimsLocals(c *fiber.Ctx, claims *Claims) {
+	c.Locals("user_id", claims.UserID)
+	c.Locals("username", claims.Username)
+	c.Locals("role", claims.Role)
+	c.Locals("token_claims", claims)
+}
+
 // AdminOnly is a middleware that restricts access to admin-role users only.
 // It must be used after AuthMiddleware so that role is already set in locals.
 func AdminOnly() fiber.Handler {
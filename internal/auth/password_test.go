@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -36,3 +37,53 @@ func TestCheckPassword_WrongPassword(t *testing.T) {
 		t.Error("CheckPassword returned true for the wrong password")
 	}
 }
+
+func TestNeedsRehash_AcrossCostAndAlgorithm(t *testing.T) {
+	defer func(cost int, algo string) { BcryptCost, PasswordAlgorithm = cost, algo }(BcryptCost, PasswordAlgorithm)
+
+	BcryptCost, PasswordAlgorithm = 4, AlgorithmBcrypt
+	oldBcrypt, err := HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if NeedsRehash(oldBcrypt) {
+		t.Error("a hash at the current cost should not need a rehash")
+	}
+
+	BcryptCost = 5
+	if !NeedsRehash(oldBcrypt) {
+		t.Error("a hash at an older cost should need a rehash")
+	}
+	if !CheckPassword(oldBcrypt, "correct-password") {
+		t.Error("an older bcrypt hash should still verify")
+	}
+
+	PasswordAlgorithm = AlgorithmArgon2id
+	if !NeedsRehash(oldBcrypt) {
+		t.Error("a bcrypt hash should need a rehash once argon2id is selected")
+	}
+	argonHash, err := HashPassword("correct-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(argonHash, "$argon2id$v=19$m=65536,t=3,p=2$") {
+		t.Errorf("unexpected argon2id encoding %q", argonHash)
+	}
+	if !CheckPassword(argonHash, "correct-password") || CheckPassword(argonHash, "wrong-password") {
+		t.Error("argon2id hash did not verify correctly")
+	}
+	if NeedsRehash(argonHash) {
+		t.Error("a current argon2id hash should not need a rehash")
+	}
+
+	PasswordAlgorithm = AlgorithmBcrypt
+	if !NeedsRehash(argonHash) {
+		t.Error("an argon2id hash should need a rehash once bcrypt is selected")
+	}
+	if !CheckPassword(argonHash, "correct-password") {
+		t.Error("an argon2id hash should still verify after switching back to bcrypt")
+	}
+	if bcryptHash, err := HashBcrypt("correct-password"); err != nil || !strings.HasPrefix(bcryptHash, "$2a$05$") {
+		t.Errorf("HashBcrypt = %q, %v; want a cost 5 bcrypt hash", bcryptHash, err)
+	}
+}
@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Cookie names for the two halves of a login session.
+const (
+	AccessCookie  = "token"
+	RefreshCookie = "refresh_token"
+)
+
+// Session issues and renews sliding login sessions. Each login gets a
+// short-lived access token, checked on every request, and a longer-lived
+// refresh token that is stored by JTI. When the access token expires the
+// refresh token is exchanged for a new pair, so an active user stays logged
+// in while a session left idle for longer than RefreshTTL expires.
+//
+// When IdleTimeout is set, a session that goes that long without a request
+// is also expired, even while its tokens are still valid; see touch.
+type Session struct {
+	DB            *sql.DB
+	Secret        string
+	AccessTTL     time.Duration
+	RefreshTTL    time.Duration
+	IdleTimeout   time.Duration
+	SecureCookies bool
+}
+
+// Issue mints a new access/refresh token pair for the user and sets both
+// cookies on the response. Each call starts a new session.
+func (s *Session) Issue(c *fiber.Ctx, userID int, username, role string) error {
+	sid := uuid.NewString()
+	refresh, refreshClaims, err := GenerateRefreshToken(s.DB, userID, username, role, sid, s.Secret, s.RefreshTTL)
+	if err != nil {
+		return err
+	}
+	if _, err := s.issueAccess(c, userID, username, role, sid); err != nil {
+		return err
+	}
+	s.setCookie(c, RefreshCookie, refresh, refreshClaims.ExpiresAt.Time)
+	if s.IdleTimeout > 0 {
+		s.recordActivity(sid, time.Now())
+	}
+	return nil
+}
+
+func (s *Session) issueAccess(c *fiber.Ctx, userID int, username, role, sid string) (*Claims, error) {
+	access, claims, err := signToken(userID, username, role, TokenTypeAccess, sid, s.Secret, s.AccessTTL)
+	if err != nil {
+		return nil, err
+	}
+	s.setCookie(c, AccessCookie, access, claims.ExpiresAt.Time)
+	return claims, nil
+}
+
+// Refresh exchanges the refresh token cookie for a new access token. The
+// refresh token is rotated at the same time, which slides the session
+// forward. The user's current username and role are re-read so role changes
+// take effect at the next refresh. It returns the new access token's claims.
+// A session that has been idle for longer than IdleTimeout is revoked and
+// ErrSessionIdle returned.
+func (s *Session) Refresh(c *fiber.Ctx) (*Claims, error) {
+	tokenStr := c.Cookies(RefreshCookie)
+	if tokenStr == "" {
+		return nil, errors.New("no refresh token")
+	}
+	old, err := ValidateRefreshToken(s.DB, tokenStr, s.Secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.touch(old.SessionID); err != nil {
+		s.Revoke(c)
+		return nil, err
+	}
+	// Refresh tokens issued before sessions had IDs start one here.
+	sid := old.SessionID
+	if sid == "" {
+		sid = uuid.NewString()
+	}
+
+	var username, role string
+	err = s.DB.QueryRow("SELECT username, role FROM users WHERE id = ?", old.UserID).Scan(&username, &role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user %d for refresh: %w", old.UserID, err)
+	}
+
+	rotated, err := markRefreshTokenRotated(s.DB, old.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !rotated {
+		// A concurrent request already rotated this token inside the grace
+		// window and set the replacement cookie; only mint an access token.
+		return s.issueAccess(c, old.UserID, username, role, sid)
+	}
+
+	refresh, refreshClaims, err := GenerateRefreshToken(s.DB, old.UserID, username, role, sid, s.Secret, s.RefreshTTL)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.issueAccess(c, old.UserID, username, role, sid)
+	if err != nil {
+		return nil, err
+	}
+	s.setCookie(c, RefreshCookie, refresh, refreshClaims.ExpiresAt.Time)
+	return claims, nil
+}
+
+// Revoke adds the JTIs of both the access and refresh token cookies to the
+// revocation blocklist and clears the cookies.
+func (s *Session) Revoke(c *fiber.Ctx) {
+	for _, name := range []string{AccessCookie, RefreshCookie} {
+		tokenStr := c.Cookies(name)
+		if tokenStr == "" {
+			continue
+		}
+		claims, err := ValidateToken(tokenStr, s.Secret)
+		if err != nil || claims.ID == "" {
+			continue
+		}
+		expiresAt := time.Now().Add(s.RefreshTTL)
+		if claims.ExpiresAt != nil {
+			expiresAt = claims.ExpiresAt.Time
+		}
+		if err := RevokeToken(s.DB, claims.ID, expiresAt); err != nil {
+			log.Printf("failed to revoke %s on logout: %v", name, err)
+		}
+	}
+	s.clearCookies(c)
+}
+
+// Middleware authenticates requests like AuthMiddleware, but when the access
+// token is missing or expired it transparently renews the session from the
+// refresh token instead of sending the user back to the login page. A
+// session idle for longer than IdleTimeout is revoked and sent to the login
+// page either way.
+func (s *Session) Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if tokenStr := c.Cookies(AccessCookie); tokenStr != "" {
+			if claims, err := validateAccessToken(s.DB, tokenStr, s.Secret); err == nil {
+				if err := s.touch(claims.SessionID); err != nil {
+					s.Revoke(c)
+					return c.Redirect("/login")
+				}
+				setClaimsLocals(c, claims)
+				return c.Next()
+			}
+		}
+
+		if c.Cookies(RefreshCookie) != "" {
+			claims, err := s.Refresh(c)
+			if err == nil {
+				setClaimsLocals(c, claims)
+				return c.Next()
+			}
+		}
+
+		if c.Cookies(AccessCookie) != "" || c.Cookies(RefreshCookie) != "" {
+			s.clearCookies(c)
+		}
+		return c.Redirect("/login")
+	}
+}
+
+func (s *Session) setCookie(c *fiber.Ctx, name, value string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		HTTPOnly: true,
+		Secure:   s.SecureCookies,
+		SameSite: "Lax",
+		Expires:  expires,
+		Path:     "/",
+	})
+}
+
+func (s *Session) clearCookies(c *fiber.Ctx) {
+	s.setCookie(c, AccessCookie, "", time.Now().Add(-1*time.Hour))
+	s.setCookie(c, RefreshCookie, "", time.Now().Add(-1*time.Hour))
+}
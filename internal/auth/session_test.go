@@ -0,0 +1,277 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newSessionTestDB extends newTestDB with the users, refresh_tokens and
+// session_activity tables and a single user with ID 1.
+func newSessionTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db := newTestDB(t)
+	_, err := db.Exec(`
+		CREATE TABLE users (id INTEGER PRIMARY KEY, username TEXT, role TEXT);
+		CREATE TABLE refresh_tokens (jti TEXT PRIMARY KEY, user_id INTEGER NOT NULL, expires_at DATETIME NOT NULL, rotated_at DATETIME, created_at DATETIME DEFAULT CURRENT_TIMESTAMP);
+		CREATE TABLE session_activity (session_id TEXT PRIMARY KEY, last_seen_at DATETIME NOT NULL, expires_at DATETIME NOT NULL);
+		INSERT INTO users (id, username, role) VALUES (1, 'jaden', 'admin');
+	`)
+	if err != nil {
+		t.Fatalf("create session tables: %v", err)
+	}
+	return db
+}
+
+func newTestSession(db *sql.DB) *Session {
+	return &Session{DB: db, Secret: testSecret, AccessTTL: time.Minute, RefreshTTL: time.Hour}
+}
+
+// issueCookies runs Session.Issue inside a throwaway request and returns the
+// resulting cookie values by name.
+func issueCookies(t *testing.T, s *Session) map[string]string {
+	t.Helper()
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return s.Issue(c, 1, "jaden", "admin")
+	})
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	return responseCookies(resp)
+}
+
+func responseCookies(resp *http.Response) map[string]string {
+	out := map[string]string{}
+	for _, ck := range resp.Cookies() {
+		out[ck.Name] = ck.Value
+	}
+	return out
+}
+
+func TestSessionMiddleware_RefreshesWhenAccessTokenMissing(t *testing.T) {
+	db := newSessionTestDB(t)
+	s := newTestSession(db)
+	cookies := issueCookies(t, s)
+	if cookies[AccessCookie] == "" || cookies[RefreshCookie] == "" {
+		t.Fatalf("Issue did not set both cookies: %v", cookies)
+	}
+
+	app := newApp(s.Middleware())
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", RefreshCookie+"="+cookies[RefreshCookie])
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 after transparent refresh, got %d", resp.StatusCode)
+	}
+
+	renewed := responseCookies(resp)
+	if renewed[AccessCookie] == "" {
+		t.Error("expected a new access token cookie")
+	}
+	if renewed[RefreshCookie] == "" || renewed[RefreshCookie] == cookies[RefreshCookie] {
+		t.Error("expected the refresh token to be rotated")
+	}
+}
+
+func TestSessionMiddleware_RejectsRefreshTokenAsAccessToken(t *testing.T) {
+	db := newSessionTestDB(t)
+	s := newTestSession(db)
+	cookies := issueCookies(t, s)
+
+	app := newApp(AuthMiddleware(testSecret, db))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Cookie", AccessCookie+"="+cookies[RefreshCookie])
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("expected 302 when a refresh token is sent as access token, got %d", resp.StatusCode)
+	}
+}
+
+func TestValidateRefreshToken_RotatedTokenExpiresAfterGrace(t *testing.T) {
+	db := newSessionTestDB(t)
+	tok, claims, err := GenerateRefreshToken(db, 1, "jaden", "admin", "", testSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken: %v", err)
+	}
+
+	if _, err := ValidateRefreshToken(db, tok, testSecret); err != nil {
+		t.Fatalf("fresh refresh token rejected: %v", err)
+	}
+
+	stale := time.Now().Add(-2 * refreshReuseGrace).UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE refresh_tokens SET rotated_at = ? WHERE jti = ?", stale, claims.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateRefreshToken(db, tok, testSecret); err == nil {
+		t.Error("expected a refresh token rotated outside the grace window to be rejected")
+	}
+}
+
+func TestSessionRevoke_RevokesBothTokens(t *testing.T) {
+	db := newSessionTestDB(t)
+	s := newTestSession(db)
+	cookies := issueCookies(t, s)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/logout", func(c *fiber.Ctx) error {
+		s.Revoke(c)
+		return c.SendString("bye")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/logout", nil)
+	req.Header.Set("Cookie", strings.Join([]string{
+		AccessCookie + "=" + cookies[AccessCookie],
+		RefreshCookie + "=" + cookies[RefreshCookie],
+	}, "; "))
+	if _, err := app.Test(req); err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+
+	for _, name := range []string{AccessCookie, RefreshCookie} {
+		claims, err := ValidateToken(cookies[name], testSecret)
+		if err != nil {
+			t.Fatalf("ValidateToken(%s): %v", name, err)
+		}
+		if !IsRevoked(db, claims.ID) {
+			t.Errorf("%s was not revoked", name)
+		}
+	}
+	if _, err := ValidateRefreshToken(db, cookies[RefreshCookie], testSecret); err == nil {
+		t.Error("expected revoked refresh token to be rejected")
+	}
+}
+
+// sessionRequest builds a GET / request carrying the named cookies.
+func sessionRequest(cookies map[string]string, names ...string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	var parts []string
+	for _, name := range names {
+		parts = append(parts, name+"="+cookies[name])
+	}
+	req.Header.Set("Cookie", strings.Join(parts, "; "))
+	return req
+}
+
+func TestSessionMiddleware_IdleTimeout(t *testing.T) {
+	db := newSessionTestDB(t)
+	s := newTestSession(db)
+	s.IdleTimeout = 10 * time.Minute
+	cookies := issueCookies(t, s)
+	access, err := ValidateToken(cookies[AccessCookie], testSecret)
+	if err != nil || access.SessionID == "" {
+		t.Fatalf("access token has no session: %v", err)
+	}
+
+	app := newApp(s.Middleware())
+	resp, err := app.Test(sessionRequest(cookies, RefreshCookie))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("active session: got %d, want 200", resp.StatusCode)
+	}
+	renewed := responseCookies(resp)
+	refreshed, err := ValidateToken(renewed[AccessCookie], testSecret)
+	if err != nil || refreshed.SessionID != access.SessionID {
+		t.Fatalf("refreshed access token session = %v, %v; want %q", refreshed, err, access.SessionID)
+	}
+
+	idle := time.Now().Add(-20 * time.Minute).UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE session_activity SET last_seen_at = ? WHERE session_id = ?", idle, access.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	globalActivityCache.evict(access.SessionID)
+
+	resp, err = app.Test(sessionRequest(renewed, AccessCookie, RefreshCookie))
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "/login" {
+		t.Fatalf("idle session: got %d to %q, want a redirect to /login", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	for _, name := range []string{AccessCookie, RefreshCookie} {
+		claims, err := ValidateToken(renewed[name], testSecret)
+		if err != nil {
+			t.Fatalf("ValidateToken(%s): %v", name, err)
+		}
+		if !IsRevoked(db, claims.ID) {
+			t.Errorf("%s of the idle session was not revoked", name)
+		}
+	}
+}
+
+func TestSessionRefresh_IdleSessionRejected(t *testing.T) {
+	db := newSessionTestDB(t)
+	s := newTestSession(db)
+	s.IdleTimeout = 10 * time.Minute
+	cookies := issueCookies(t, s)
+	refresh, err := ValidateToken(cookies[RefreshCookie], testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idle := time.Now().Add(-11 * time.Minute).UTC().Format(time.RFC3339)
+	if _, err := db.Exec("UPDATE session_activity SET last_seen_at = ? WHERE session_id = ?", idle, refresh.SessionID); err != nil {
+		t.Fatal(err)
+	}
+	globalActivityCache.evict(refresh.SessionID)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	var refreshErr error
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, refreshErr = s.Refresh(c)
+		return nil
+	})
+	if _, err := app.Test(sessionRequest(cookies, RefreshCookie)); err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if !errors.Is(refreshErr, ErrSessionIdle) {
+		t.Errorf("Refresh error = %v, want ErrSessionIdle", refreshErr)
+	}
+	if !IsRevoked(db, refresh.ID) {
+		t.Error("refresh token of the idle session was not revoked")
+	}
+}
+
+func TestSessionRefresh_IdleSessionSurvivesCleanup(t *testing.T) {
+	db := newSessionTestDB(t)
+	s := newTestSession(db)
+	s.IdleTimeout = 10 * time.Minute
+	cookies := issueCookies(t, s)
+	refresh, err := ValidateToken(cookies[RefreshCookie], testSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last request was 11 minutes ago; since then the cleanup has run
+	// and the in-memory copy is gone, as after a restart.
+	s.recordActivity(refresh.SessionID, time.Now().Add(-11*time.Minute))
+	CleanupExpiredTokens(db)
+	globalActivityCache.evict(refresh.SessionID)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	var refreshErr error
+	app.Get("/", func(c *fiber.Ctx) error {
+		_, refreshErr = s.Refresh(c)
+		return nil
+	})
+	if _, err := app.Test(sessionRequest(cookies, RefreshCookie)); err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	if !errors.Is(refreshErr, ErrSessionIdle) {
+		t.Errorf("Refresh error = %v, want ErrSessionIdle", refreshErr)
+	}
+}
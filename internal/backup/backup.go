@@ -3,6 +3,7 @@ package backup
 import (
 	"compress/gzip"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,8 +12,10 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"ezweb/internal/logging"
 	"ezweb/internal/models"
 )
 
@@ -29,6 +32,11 @@ type Manager struct {
 	backupDir string
 	db        *sql.DB
 	maxAge    time.Duration
+	freeSpace func(dir string) (uint64, error) // availableBytes; replaced in tests
+	restoreMu sync.Mutex                       // serialises database restores
+
+	reportMu   sync.Mutex
+	lastReport *FullBackupReport
 }
 
 func NewManager(backupDir string, db *sql.DB) (*Manager, error) {
@@ -39,6 +47,7 @@ func NewManager(backupDir string, db *sql.DB) (*Manager, error) {
 		backupDir: backupDir,
 		db:        db,
 		maxAge:    30 * 24 * time.Hour, // 30 days retention
+		freeSpace: availableBytes,
 	}, nil
 }
 
@@ -55,13 +64,18 @@ func (m *Manager) BackupDatabase(dbPath string) (*BackupInfo, error) {
 		log.Printf("wal_checkpoint before backup failed (non-fatal): %v", err)
 	}
 
+	if err := m.ensureSpace("the database", fileSize(dbPath)+fileSize(dbPath+"-wal")); err != nil {
+		return nil, err
+	}
+
 	src, err := os.Open(dbPath)
 	if err != nil {
 		return nil, fmt.Errorf("open db: %w", err)
 	}
 	defer src.Close()
 
-	dst, err := os.Create(outPath)
+	partial := m.partialPath(name)
+	dst, err := os.Create(partial)
 	if err != nil {
 		return nil, fmt.Errorf("create backup: %w", err)
 	}
@@ -69,16 +83,26 @@ func (m *Manager) BackupDatabase(dbPath string) (*BackupInfo, error) {
 
 	gz, err := gzip.NewWriterLevel(dst, gzip.BestCompression)
 	if err != nil {
-		os.Remove(outPath)
+		os.Remove(partial)
 		return nil, fmt.Errorf("gzip writer: %w", err)
 	}
 
 	if _, err := io.Copy(gz, src); err != nil {
 		gz.Close()
-		os.Remove(outPath)
+		os.Remove(partial)
 		return nil, fmt.Errorf("copy db: %w", err)
 	}
-	gz.Close()
+	if err := gz.Close(); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("copy db: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("write backup: %w", err)
+	}
+	if err := commitBackup(partial, outPath); err != nil {
+		return nil, err
+	}
 
 	var size int64
 	if info, err := os.Stat(outPath); err == nil {
@@ -95,27 +119,39 @@ func (m *Manager) BackupDatabase(dbPath string) (*BackupInfo, error) {
 
 // BackupSite creates a tar.gz backup of a site's Docker volumes/compose dir.
 func (m *Manager) BackupSite(site models.Site) (*BackupInfo, error) {
-	ts := time.Now().Format("20060102-150405")
-	safeName := strings.ReplaceAll(site.Domain, ".", "-")
-	name := fmt.Sprintf("site-%s-%s.tar.gz", safeName, ts)
+	name := siteBackupPrefix(site) + time.Now().Format("20060102-150405") + ".tar.gz"
 	outPath := filepath.Join(m.backupDir, name)
 
+	// ComposePath is the compose project directory itself (compose commands
+	// run with it as their working directory), so archive it directly.
 	var srcDir string
 	if site.IsLocal && site.ComposePath != "" {
-		srcDir = filepath.Dir(site.ComposePath)
+		srcDir = site.ComposePath
 	} else {
 		srcDir = filepath.Join("/opt/ezweb", site.ContainerName)
 	}
 
 	if _, err := os.Stat(srcDir); err != nil {
-		return nil, fmt.Errorf("source directory not found: %s", srcDir)
+		return nil, fmt.Errorf("%w: %s", errNoSource, srcDir)
 	}
 
-	cmd := exec.Command("tar", "czf", outPath, "-C", filepath.Dir(srcDir), filepath.Base(srcDir))
+	estimate, err := dirSize(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("measure %s: %w", srcDir, err)
+	}
+	if err := m.ensureSpace("site "+site.Domain, estimate); err != nil {
+		return nil, err
+	}
+
+	partial := m.partialPath(name)
+	cmd := exec.Command("tar", "czf", partial, "-C", filepath.Dir(srcDir), filepath.Base(srcDir))
 	if out, err := cmd.CombinedOutput(); err != nil {
-		os.Remove(outPath)
+		os.Remove(partial)
 		return nil, fmt.Errorf("tar failed: %s: %w", string(out), err)
 	}
+	if err := commitBackup(partial, outPath); err != nil {
+		return nil, err
+	}
 
 	var size int64
 	if info, err := os.Stat(outPath); err == nil {
@@ -140,7 +176,7 @@ func (m *Manager) ListBackups() ([]BackupInfo, error) {
 
 	var backups []BackupInfo
 	for _, e := range entries {
-		if e.IsDir() {
+		if e.IsDir() || !isBackupName(e.Name()) {
 			continue
 		}
 		info, err := e.Info()
@@ -175,87 +211,6 @@ func (m *Manager) ListBackups() ([]BackupInfo, error) {
 	return backups, nil
 }
 
-// RestoreDatabase replaces the current database file with a backup.
-// The caller must ensure the database is not in active use.
-func (m *Manager) RestoreDatabase(backupName, dbPath string) error {
-	// Prevent path traversal
-	if strings.Contains(backupName, "/") || strings.Contains(backupName, "..") {
-		return fmt.Errorf("invalid backup name")
-	}
-
-	backupPath := filepath.Join(m.backupDir, backupName)
-	if _, err := os.Stat(backupPath); err != nil {
-		return fmt.Errorf("backup not found: %w", err)
-	}
-
-	// Only allow restoring database backups
-	if !strings.HasPrefix(backupName, "ezweb-db-") {
-		return fmt.Errorf("can only restore database backups")
-	}
-
-	// Flush WAL to main DB file before creating the safety backup.
-	if _, err := m.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
-		log.Printf("wal_checkpoint before restore failed (non-fatal): %v", err)
-	}
-
-	// Create a safety backup of the current database before overwriting
-	safetyName := fmt.Sprintf("ezweb-db-pre-restore-%s.sql.gz", time.Now().Format("20060102-150405"))
-	safetyPath := filepath.Join(m.backupDir, safetyName)
-
-	srcFile, err := os.Open(dbPath)
-	if err != nil {
-		return fmt.Errorf("open current db: %w", err)
-	}
-
-	safetyFile, err := os.Create(safetyPath)
-	if err != nil {
-		srcFile.Close()
-		return fmt.Errorf("create safety backup: %w", err)
-	}
-
-	gz, err := gzip.NewWriterLevel(safetyFile, gzip.BestSpeed)
-	if err != nil {
-		srcFile.Close()
-		safetyFile.Close()
-		return fmt.Errorf("gzip writer: %w", err)
-	}
-
-	if _, err := io.Copy(gz, srcFile); err != nil {
-		gz.Close()
-		srcFile.Close()
-		safetyFile.Close()
-		return fmt.Errorf("safety backup copy: %w", err)
-	}
-	gz.Close()
-	srcFile.Close()
-	safetyFile.Close()
-
-	// Decompress the backup and write to the database path
-	backupFile, err := os.Open(backupPath)
-	if err != nil {
-		return fmt.Errorf("open backup: %w", err)
-	}
-	defer backupFile.Close()
-
-	gzReader, err := gzip.NewReader(backupFile)
-	if err != nil {
-		return fmt.Errorf("gzip reader: %w", err)
-	}
-	defer gzReader.Close()
-
-	dstFile, err := os.Create(dbPath)
-	if err != nil {
-		return fmt.Errorf("create db file: %w", err)
-	}
-	defer dstFile.Close()
-
-	if _, err := io.Copy(dstFile, gzReader); err != nil {
-		return fmt.Errorf("restore copy: %w", err)
-	}
-
-	return nil
-}
-
 // DeleteBackup removes a specific backup file.
 func (m *Manager) DeleteBackup(name string) error {
 	// Prevent path traversal
@@ -276,6 +231,9 @@ func (m *Manager) CleanOldBackups() int {
 
 	removed := 0
 	for _, e := range entries {
+		if !isBackupName(e.Name()) {
+			continue // partials are CleanPartialBackups' job
+		}
 		info, err := e.Info()
 		if err != nil {
 			continue
@@ -289,42 +247,215 @@ func (m *Manager) CleanOldBackups() int {
 	return removed
 }
 
-// RunFullBackup performs a database backup and all site backups.
-func (m *Manager) RunFullBackup(dbPath string) ([]BackupInfo, error) {
-	var results []BackupInfo
+// partialSuffix ends the name a backup is written under until it is
+// complete. Backups are renamed into place only once fully written, as the
+// Caddyfile is, so a killed process or a full disk leaves a hidden partial
+// behind rather than a truncated backup that looks valid.
+const partialSuffix = ".tmp"
+
+// partialStaleAfter is how long a partial must go unmodified before
+// CleanPartialBackups removes it, so a backup still being written by
+// another process (the --backup timer, say) is left alone.
+const partialStaleAfter = 10 * time.Minute
+
+// partialPath is where the backup called name is written before commitBackup
+// moves it into place.
+func (m *Manager) partialPath(name string) string {
+	return filepath.Join(m.backupDir, "."+name+partialSuffix)
+}
+
+// commitBackup flushes a completed partial to disk and renames it to its
+// final path. The partial is removed if that fails.
+func commitBackup(partial, final string) error {
+	f, err := os.Open(partial)
+	if err == nil {
+		err = f.Sync()
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(partial, final)
+	}
+	if err != nil {
+		os.Remove(partial)
+		return fmt.Errorf("finish backup %s: %w", filepath.Base(final), err)
+	}
+	return nil
+}
+
+// isBackupName reports whether name is a finished backup. Hidden files are
+// partials and the temporary copies restores make.
+func isBackupName(name string) bool {
+	return !strings.HasPrefix(name, ".") && !strings.HasSuffix(name, partialSuffix)
+}
 
-	// Database backup
-	dbBackup, err := m.BackupDatabase(dbPath)
+// CleanPartialBackups removes partial backups and leftover restore temp
+// files that have not been touched for partialStaleAfter, and returns how
+// many it removed. It runs at startup and before each full backup.
+func (m *Manager) CleanPartialBackups() int {
+	entries, err := os.ReadDir(m.backupDir)
 	if err != nil {
-		log.Printf("database backup failed: %v", err)
+		return 0
+	}
+	cutoff := time.Now().Add(-partialStaleAfter)
+	removed := 0
+	for _, e := range entries {
+		if e.IsDir() || isBackupName(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(m.backupDir, e.Name())); err == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// errNoSource is returned by BackupSite when the site has no directory to
+// archive.
+var errNoSource = errors.New("source directory not found")
+
+// BackupResult is the outcome of one item of a full backup.
+type BackupResult struct {
+	Name   string      // "database" or the site's domain
+	Backup *BackupInfo // nil when the item failed
+	Err    error
+}
+
+// FullBackupReport describes a RunFullBackup run item by item. The database
+// is kept apart from the sites: without it nothing else can be restored.
+type FullBackupReport struct {
+	Started  time.Time
+	Finished time.Time
+	Database BackupResult
+	Sites    []BackupResult
+}
+
+// Backups returns the files the run wrote.
+func (r *FullBackupReport) Backups() []BackupInfo {
+	var out []BackupInfo
+	if r.Database.Backup != nil {
+		out = append(out, *r.Database.Backup)
+	}
+	for _, s := range r.Sites {
+		if s.Backup != nil {
+			out = append(out, *s.Backup)
+		}
+	}
+	return out
+}
+
+// FailedSites returns the site results that have an error.
+func (r *FullBackupReport) FailedSites() []BackupResult {
+	var out []BackupResult
+	for _, s := range r.Sites {
+		if s.Err != nil {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Err combines every failure of the run, or returns nil when everything was
+// backed up. The item errors are wrapped, so errors.Is finds
+// ErrInsufficientSpace if any item ran out of room.
+func (r *FullBackupReport) Err() error {
+	var errs []error
+	if r.Database.Err != nil {
+		errs = append(errs, fmt.Errorf("database backup failed: %w", r.Database.Err))
+	}
+	if failed := r.FailedSites(); len(failed) > 0 {
+		errs = append(errs, fmt.Errorf("%d of %d site backup(s) failed", len(failed), len(r.Sites)))
+		for _, s := range failed {
+			errs = append(errs, fmt.Errorf("%s: %w", s.Name, s.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LastFullBackup returns the report of the most recent full backup run by
+// this process, or nil if none has run.
+func (m *Manager) LastFullBackup() *FullBackupReport {
+	m.reportMu.Lock()
+	defer m.reportMu.Unlock()
+	return m.lastReport
+}
+
+// RunFullBackup performs a database backup and all site backups. Failures
+// do not stop the run; they are listed in the report, and the returned error
+// is the report's Err. The report is nil only if the sites could not be
+// listed.
+func (m *Manager) RunFullBackup(dbPath string) (*FullBackupReport, error) {
+	report := &FullBackupReport{Started: time.Now(), Database: BackupResult{Name: "database"}}
+
+	if n := m.CleanPartialBackups(); n > 0 {
+		logging.Infof("removed %d partial backup file(s) left by an interrupted run", n)
+	}
+
+	report.Database.Backup, report.Database.Err = m.BackupDatabase(dbPath)
+	if err := report.Database.Err; err != nil {
+		logging.Errorf("database backup failed: %v", err)
 	} else {
-		results = append(results, *dbBackup)
-		log.Printf("database backup: %s (%d bytes)", dbBackup.Name, dbBackup.Size)
+		logging.Infof("database backup: %s (%d bytes)", report.Database.Backup.Name, report.Database.Backup.Size)
 	}
 
-	// Site backups
 	sites, err := models.GetAllSites(m.db)
 	if err != nil {
-		return results, fmt.Errorf("list sites: %w", err)
+		return nil, fmt.Errorf("list sites: %w", err)
 	}
 
+	// Each site is checked for space just before its tarball is written, so a
+	// run that starts with room stops short of filling the disk. Smaller sites
+	// later in the list may still fit, so a space failure does not end the run.
 	for _, site := range sites {
-		bi, err := m.BackupSite(site)
-		if err != nil {
-			log.Printf("backup failed for site %s: %v", site.Domain, err)
-			continue
+		res := BackupResult{Name: site.Domain}
+		res.Backup, res.Err = m.BackupSite(site)
+		if res.Err != nil {
+			log.Printf("backup failed for site %s: %v", site.Domain, res.Err)
+		} else {
+			logging.Infof("site backup: %s (%d bytes)", res.Backup.Name, res.Backup.Size)
 		}
-		results = append(results, *bi)
-		log.Printf("site backup: %s (%d bytes)", bi.Name, bi.Size)
+		report.Sites = append(report.Sites, res)
 	}
 
 	// Clean old backups
 	removed := m.CleanOldBackups()
 	if removed > 0 {
-		log.Printf("cleaned %d old backups", removed)
+		logging.Infof("cleaned %d old backups", removed)
 	}
 
-	return results, nil
+	report.Finished = time.Now()
+	m.reportMu.Lock()
+	m.lastReport = report
+	m.reportMu.Unlock()
+	return report, report.Err()
+}
+
+// RunScheduledBackup is RunFullBackup for the backup scheduler. The outcome
+// is recorded in the activity log, since no one is watching the result.
+func (m *Manager) RunScheduledBackup(dbPath string) error {
+	start := time.Now()
+	report, err := m.RunFullBackup(dbPath)
+
+	var results []BackupInfo
+	if report != nil {
+		results = report.Backups()
+	}
+	var size int64
+	for _, r := range results {
+		size += r.Size
+	}
+	details := fmt.Sprintf("Scheduled backup wrote %d file(s), %s, in %s",
+		len(results), FormatSize(size), time.Since(start).Round(time.Second))
+	action := "completed"
+	if err != nil {
+		action = "failed"
+		details += ": " + err.Error()
+	}
+	models.LogActivityWithContext(m.db, "backup", 0, action, details, "", "")
+	return err
 }
 
 // FormatSize returns a human-readable file size.
@@ -0,0 +1,131 @@
+package backup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+)
+
+func TestRunFullBackup_ReportsEachFailure(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "ezweb.db")
+	database, err := db.Open(dbPath, 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	project := filepath.Join(dir, "shop")
+	if err := os.MkdirAll(project, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(project, "docker-compose.yml"), []byte("services: {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	good := &models.Site{Domain: "shop.example.com", ContainerName: "shop", Port: 8080, Status: "running", IsLocal: true, ComposePath: project}
+	gone := &models.Site{Domain: "gone.example.com", ContainerName: "gone", Port: 8081, Status: "running", IsLocal: true, ComposePath: filepath.Join(dir, "missing")}
+	for _, s := range []*models.Site{good, gone} {
+		if err := models.CreateSite(database, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := NewManager(filepath.Join(dir, "backups"), database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := m.RunFullBackup(dbPath)
+	if report == nil {
+		t.Fatalf("no report: %v", err)
+	}
+	if report.Database.Err != nil || report.Database.Backup == nil {
+		t.Errorf("database backup failed: %v", report.Database.Err)
+	}
+	failed := report.FailedSites()
+	if len(report.Sites) != 2 || len(failed) != 1 || failed[0].Name != "gone.example.com" {
+		t.Fatalf("site results = %+v, want only gone.example.com failed", report.Sites)
+	}
+	if !errors.Is(failed[0].Err, errNoSource) {
+		t.Errorf("missing directory: err=%v, want errNoSource", failed[0].Err)
+	}
+	if len(report.Backups()) != 2 {
+		t.Errorf("backups written = %d, want database and shop", len(report.Backups()))
+	}
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 site backup(s) failed\ngone.example.com: ") || strings.Contains(err.Error(), "database") {
+		t.Errorf("err = %v", err)
+	}
+	if m.LastFullBackup() != report {
+		t.Error("LastFullBackup does not return the run's report")
+	}
+
+	report, err = m.RunFullBackup(filepath.Join(dir, "nope.db"))
+	if report == nil || report.Database.Err == nil {
+		t.Fatalf("expected the database backup to fail, got %+v", report)
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "database backup failed: ") {
+		t.Errorf("err = %v, want the database failure first", err)
+	}
+}
+
+func TestPartialBackupsHiddenAndCleaned(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "ezweb.db")
+	database, err := db.Open(dbPath, 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	m, err := NewManager(filepath.Join(dir, "backups"), database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := m.BackupDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("BackupDatabase: %v", err)
+	}
+
+	// What an interrupted run leaves behind: a stale truncated database
+	// backup, and one still being written by another process.
+	stale := m.partialPath("ezweb-db-20240101-000000.sql.gz")
+	fresh := m.partialPath("site-shop-example-com-20240101-000000.tar.gz")
+	for _, p := range []string{stale, fresh} {
+		if err := os.WriteFile(p, []byte("truncated"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-2 * partialStaleAfter)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := m.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 || backups[0].Name != done.Name {
+		t.Errorf("ListBackups = %+v, want only %s", backups, done.Name)
+	}
+	if err := m.RestoreDatabase(filepath.Base(stale), dbPath); err == nil {
+		t.Error("RestoreDatabase accepted a partial backup")
+	}
+
+	if n := m.CleanPartialBackups(); n != 1 {
+		t.Errorf("CleanPartialBackups removed %d file(s), want 1", n)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale partial still present: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("partial still being written was removed: %v", err)
+	}
+	if _, err := os.Stat(done.Path); err != nil {
+		t.Errorf("finished backup removed: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package backup
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ErrInsufficientSpace is returned when the backup directory does not have
+// room for a backup plus diskReserveBytes of headroom.
+var ErrInsufficientSpace = errors.New("insufficient disk space for backup")
+
+// errSpaceUnknown is returned by availableBytes on platforms where free space
+// cannot be queried; the check is skipped rather than blocking backups.
+var errSpaceUnknown = errors.New("free space check not supported on this platform")
+
+// diskReserveBytes is left free on top of the estimated backup size so a
+// backup never pushes the disk to the point where SQLite writes start failing.
+const diskReserveBytes int64 = 100 << 20 // 100 MB
+
+// ensureSpace refuses a backup of roughly estimate bytes if it would not fit
+// in the backup directory with diskReserveBytes to spare. Estimates use the
+// uncompressed size, so they err on the side of refusing. If free space
+// cannot be determined the backup is allowed and the problem is logged.
+func (m *Manager) ensureSpace(what string, estimate int64) error {
+	avail, err := m.freeSpace(m.backupDir)
+	if err != nil {
+		if !errors.Is(err, errSpaceUnknown) {
+			log.Printf("could not check free space in %s before backing up %s: %v", m.backupDir, what, err)
+		}
+		return nil
+	}
+	need := estimate + diskReserveBytes
+	if uint64(need) > avail {
+		return fmt.Errorf("%w: %s needs about %s (including %s reserve) but only %s is free in %s",
+			ErrInsufficientSpace, what, FormatSize(need), FormatSize(diskReserveBytes), FormatSize(int64(avail)), m.backupDir)
+	}
+	return nil
+}
+
+// fileSize returns the size of path, or 0 if it does not exist.
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// dirSize sums the sizes of regular files under dir, like `du -sb`. Symlinks
+// are not followed, matching what tar archives.
+func dirSize(dir string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable entries are skipped by tar too; don't fail the estimate.
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+		}
+		return nil
+	})
+	return total, err
+}
@@ -0,0 +1,7 @@
+//go:build !unix
+
+package backup
+
+func availableBytes(dir string) (uint64, error) {
+	return 0, errSpaceUnknown
+}
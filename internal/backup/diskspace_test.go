@@ -0,0 +1,41 @@
+package backup
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnsureSpace(t *testing.T) {
+	const estimate = 50 << 20
+	tests := []struct {
+		name    string
+		avail   uint64
+		err     error
+		wantErr bool
+	}{
+		{"plenty", 1 << 40, nil, false},
+		{"exactly enough", estimate + uint64(diskReserveBytes), nil, false},
+		{"one byte short", estimate + uint64(diskReserveBytes) - 1, nil, true},
+		{"fits without the reserve", estimate, nil, true},
+		{"check fails", 0, errors.New("statfs: permission denied"), false},
+		{"check unsupported", 0, errSpaceUnknown, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewManager(filepath.Join(t.TempDir(), "backups"), nil)
+			if err != nil {
+				t.Fatalf("NewManager: %v", err)
+			}
+			m.freeSpace = func(string) (uint64, error) { return tt.avail, tt.err }
+
+			err = m.ensureSpace("the database", estimate)
+			if tt.wantErr != errors.Is(err, ErrInsufficientSpace) {
+				t.Errorf("ensureSpace with %d bytes free = %v, want insufficient space: %v", tt.avail, err, tt.wantErr)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("ensureSpace = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package backup
+
+import "syscall"
+
+// availableBytes returns the space available to unprivileged users on the
+// filesystem containing dir.
+func availableBytes(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
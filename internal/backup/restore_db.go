@@ -0,0 +1,230 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ezweb/internal/db"
+
+	"modernc.org/sqlite"
+)
+
+// restoreTimeout bounds how long a restore waits for other connections to
+// finish their writes before it takes over the database.
+const restoreTimeout = 30 * time.Second
+
+// onlineRestorer is implemented by modernc.org/sqlite connections. It copies
+// another database file into the connection's database with SQLite's online
+// backup API.
+type onlineRestorer interface {
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// RestoreDatabase replaces the contents of the live database with a database
+// backup while the app keeps running. The backup is decompressed to a
+// temporary file and checked first, and a snapshot of the current database
+// is saved as a pre-restore backup. The pages are then copied into the open
+// database with SQLite's online backup API, which holds the write lock for
+// the whole copy: other connections in the pool see either the old database
+// or the restored one, never a mix, and the WAL and open handles stay valid.
+// Finally the schema is migrated, since the backup may predate newer columns.
+func (m *Manager) RestoreDatabase(backupName, dbPath string) error {
+	// Prevent path traversal
+	if strings.Contains(backupName, "/") || strings.Contains(backupName, "..") {
+		return fmt.Errorf("invalid backup name")
+	}
+	// Only allow restoring finished database backups
+	if !strings.HasPrefix(backupName, "ezweb-db-") || !isBackupName(backupName) {
+		return fmt.Errorf("can only restore database backups")
+	}
+
+	backupPath := filepath.Join(m.backupDir, backupName)
+	if _, err := os.Stat(backupPath); err != nil {
+		return fmt.Errorf("backup not found: %w", err)
+	}
+
+	m.restoreMu.Lock()
+	defer m.restoreMu.Unlock()
+
+	restored, err := m.extractDatabase(backupPath)
+	if err != nil {
+		return err
+	}
+	defer removeDatabaseFiles(restored)
+
+	if err := checkDatabaseFile(restored); err != nil {
+		return fmt.Errorf("backup %s is not a usable database: %w", backupName, err)
+	}
+
+	safetyName, err := m.snapshotDatabase(dbPath)
+	if err != nil {
+		return fmt.Errorf("pre-restore backup: %w", err)
+	}
+
+	if err := restoreInto(m.db, restored); err != nil {
+		return fmt.Errorf("restore copy (current database unchanged, pre-restore backup %s): %w", safetyName, err)
+	}
+
+	if err := db.Migrate(m.db); err != nil {
+		return fmt.Errorf("migrate restored database: %w", err)
+	}
+	return nil
+}
+
+// extractDatabase decompresses a database backup into a temporary file in
+// the backup directory and returns its path.
+func (m *Manager) extractDatabase(backupPath string) (string, error) {
+	src, err := os.Open(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("open backup: %w", err)
+	}
+	defer src.Close()
+
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return "", fmt.Errorf("gzip reader: %w", err)
+	}
+	defer gz.Close()
+
+	dst, err := os.CreateTemp(m.backupDir, ".restore-*.db")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	if _, err := io.Copy(dst, gz); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("decompress backup: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", fmt.Errorf("write temp file: %w", err)
+	}
+	return dst.Name(), nil
+}
+
+// checkDatabaseFile opens path as a SQLite database and verifies that it is
+// intact and looks like an EzWeb database.
+func checkDatabaseFile(path string) error {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var result string
+	if err := conn.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return err
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	var tables int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('users', 'sites')").Scan(&tables); err != nil {
+		return err
+	}
+	if tables != 2 {
+		return errors.New("users and sites tables not found")
+	}
+	return nil
+}
+
+// snapshotDatabase saves a consistent copy of the live database as a
+// pre-restore backup and returns its name. VACUUM INTO reads inside a
+// transaction, so writes that land while it runs cannot tear the copy.
+func (m *Manager) snapshotDatabase(dbPath string) (string, error) {
+	if err := m.ensureSpace("the pre-restore safety copy", fileSize(dbPath)+fileSize(dbPath+"-wal")); err != nil {
+		return "", err
+	}
+
+	snapshot := filepath.Join(m.backupDir, fmt.Sprintf(".pre-restore-%d.db", time.Now().UnixNano()))
+	defer os.Remove(snapshot)
+	if _, err := m.db.Exec("VACUUM INTO ?", snapshot); err != nil {
+		return "", fmt.Errorf("snapshot db: %w", err)
+	}
+
+	name := fmt.Sprintf("ezweb-db-pre-restore-%s.sql.gz", time.Now().Format("20060102-150405"))
+	partial := m.partialPath(name)
+	if err := gzipFile(snapshot, partial); err != nil {
+		os.Remove(partial)
+		return "", err
+	}
+	if err := commitBackup(partial, filepath.Join(m.backupDir, name)); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func gzipFile(srcPath, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", srcPath, err)
+	}
+	defer src.Close()
+
+	dst, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", dstPath, err)
+	}
+	defer dst.Close()
+
+	gz, err := gzip.NewWriterLevel(dst, gzip.BestSpeed)
+	if err != nil {
+		return fmt.Errorf("gzip writer: %w", err)
+	}
+	if _, err := io.Copy(gz, src); err != nil {
+		gz.Close()
+		return fmt.Errorf("compress %s: %w", srcPath, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("compress %s: %w", srcPath, err)
+	}
+	return dst.Close()
+}
+
+// restoreInto copies the database at srcPath over the database behind conn
+// in a single step. If the copy fails SQLite rolls it back and the live
+// database is left as it was.
+func restoreInto(conn *sql.DB, srcPath string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), restoreTimeout)
+	defer cancel()
+
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer c.Close()
+
+	// Wait for in-flight writers rather than failing with SQLITE_BUSY.
+	if _, err := c.ExecContext(ctx, fmt.Sprintf("PRAGMA busy_timeout = %d", restoreTimeout.Milliseconds())); err != nil {
+		return fmt.Errorf("set busy_timeout: %w", err)
+	}
+
+	return c.Raw(func(driverConn any) error {
+		r, ok := driverConn.(onlineRestorer)
+		if !ok {
+			return errors.New("database driver does not support online restore")
+		}
+		b, err := r.NewRestore(srcPath)
+		if err != nil {
+			return err
+		}
+		_, stepErr := b.Step(-1)
+		return errors.Join(stepErr, b.Finish())
+	})
+}
+
+// removeDatabaseFiles deletes a SQLite database file and its WAL sidecars.
+func removeDatabaseFiles(path string) {
+	for _, p := range []string{path, path + "-wal", path + "-shm"} {
+		os.Remove(p)
+	}
+}
@@ -0,0 +1,118 @@
+package backup
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func countUsers(t *testing.T, m *Manager) int {
+	t.Helper()
+	var n int
+	if err := m.db.QueryRow("SELECT COUNT(*) FROM users").Scan(&n); err != nil {
+		t.Fatalf("count users: %v", err)
+	}
+	return n
+}
+
+func TestRestoreDatabase_LiveConnectionSeesBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "ezweb.db")
+	database, err := db.Open(dbPath, 4, 2)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	m, err := NewManager(filepath.Join(dir, "backups"), database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Exec("INSERT INTO users (username, password) VALUES ('alice', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.BackupDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("BackupDatabase: %v", err)
+	}
+
+	// Changes made after the backup, left in the WAL, must be replaced.
+	if _, err := database.Exec("INSERT INTO users (username, password) VALUES ('bob', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+	if got := countUsers(t, m); got != 2 {
+		t.Fatalf("users before restore = %d, want 2", got)
+	}
+
+	if err := m.RestoreDatabase(b.Name, dbPath); err != nil {
+		t.Fatalf("RestoreDatabase: %v", err)
+	}
+	if got := countUsers(t, m); got != 1 {
+		t.Errorf("users after restore = %d, want 1", got)
+	}
+
+	// The pool keeps working against the restored database.
+	if _, err := database.Exec("INSERT INTO users (username, password) VALUES ('carol', 'x')"); err != nil {
+		t.Fatalf("write after restore: %v", err)
+	}
+	var mode string
+	if err := database.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Errorf("journal_mode after restore = %q, %v; want wal", mode, err)
+	}
+
+	backups, err := m.ListBackups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var safety bool
+	for _, bi := range backups {
+		if strings.HasPrefix(bi.Name, ".") {
+			t.Errorf("temporary file %s left in backup directory", bi.Name)
+		}
+		if strings.HasPrefix(bi.Name, "ezweb-db-pre-restore-") {
+			safety = true
+		}
+	}
+	if !safety {
+		t.Error("no pre-restore backup was written")
+	}
+}
+
+func TestRestoreDatabase_RejectsInvalidBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "ezweb.db")
+	database, err := db.Open(dbPath, 4, 2)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	m, err := NewManager(filepath.Join(dir, "backups"), database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := database.Exec("INSERT INTO users (username, password) VALUES ('alice', 'x')"); err != nil {
+		t.Fatal(err)
+	}
+
+	name := "ezweb-db-20240101-000000.sql.gz"
+	f, err := os.Create(filepath.Join(m.backupDir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte("definitely not a sqlite database"))
+	gz.Close()
+	f.Close()
+
+	if err := m.RestoreDatabase(name, dbPath); err == nil {
+		t.Fatal("expected restoring a corrupt backup to fail")
+	}
+	if got := countUsers(t, m); got != 1 {
+		t.Errorf("users after failed restore = %d, want 1", got)
+	}
+}
@@ -0,0 +1,333 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+	sshutil "ezweb/internal/ssh"
+
+	"github.com/pkg/sftp"
+)
+
+// siteBackupNameRe matches the names BackupSite produces.
+var siteBackupNameRe = regexp.MustCompile(`^site-[A-Za-z0-9-]+-\d{8}-\d{6}\.tar\.gz$`)
+
+// archiveTopDirRe limits the top-level directory of a site archive to names
+// that are safe to use unquoted in a remote shell command.
+var archiveTopDirRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// siteBackupPrefix is the part of a site backup name before the timestamp.
+func siteBackupPrefix(site models.Site) string {
+	return "site-" + strings.ReplaceAll(models.PrimaryDomain(site.Domain), ".", "-") + "-"
+}
+
+// IsSiteBackupFor reports whether name is a site backup taken of site.
+// Different domains can map to the same name (a-b.com and a.b-com), so a
+// backup may match more than one site.
+func IsSiteBackupFor(name string, site models.Site) bool {
+	if !siteBackupNameRe.MatchString(name) || !strings.HasPrefix(name, siteBackupPrefix(site)) {
+		return false
+	}
+	// The rest must be exactly the timestamp, not another domain label.
+	rest := strings.TrimPrefix(name, siteBackupPrefix(site))
+	return len(rest) == len("20060102-150405.tar.gz")
+}
+
+// RestoreSite replaces a site's compose directory with the contents of a site
+// backup. The archive is validated and must hold the site directory itself
+// before anything is touched, and the current directory is saved as a new
+// site backup before it is replaced; that backup is returned (nil if the
+// directory did not exist). server is nil for local sites. The caller should
+// stop the site first and recreate its containers afterwards.
+func (m *Manager) RestoreSite(name string, site models.Site, server *models.Server) (*BackupInfo, error) {
+	if !IsSiteBackupFor(name, site) {
+		return nil, fmt.Errorf("%s is not a backup of %s", name, site.Domain)
+	}
+	archive := filepath.Join(m.backupDir, name)
+	if _, err := os.Stat(archive); err != nil {
+		return nil, fmt.Errorf("backup not found: %w", err)
+	}
+	top, err := validateSiteArchive(archive)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to restore %s: %w", name, err)
+	}
+
+	var want string
+	if server == nil {
+		if !site.IsLocal || site.ComposePath == "" {
+			return nil, fmt.Errorf("site %s has no local compose directory", site.Domain)
+		}
+		want = filepath.Base(site.ComposePath)
+	} else {
+		dir, err := docker.RemoteSiteDir(server.DeployPath, site.ContainerName)
+		if err != nil {
+			return nil, err
+		}
+		want = path.Base(dir)
+	}
+	// Older versions archived the directory above the site's, so a backup
+	// taken then holds every sibling site. Extracting it would nest them all
+	// in this site's directory.
+	if top != want {
+		return nil, fmt.Errorf("refusing to restore %s: it holds directory %q, not the site directory %q", name, top, want)
+	}
+
+	if server == nil {
+		return m.restoreSiteLocal(archive, top, site)
+	}
+	return m.restoreSiteRemote(archive, top, site, server)
+}
+
+// validateSiteArchive checks that a site tarball has a single top-level
+// directory, contains only regular files, directories and links that stay
+// inside it, and is readable to the end. It returns the top-level directory.
+func validateSiteArchive(archive string) (string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", fmt.Errorf("not a gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	var top string
+	symlinks := make(map[string]bool)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("corrupt archive: %w", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if path.IsAbs(name) || escapes(name) {
+			return "", fmt.Errorf("entry %q escapes the archive directory", hdr.Name)
+		}
+		first, _, nested := strings.Cut(name, "/")
+		if top == "" {
+			top = first
+		} else if first != top {
+			return "", fmt.Errorf("archive has more than one top-level entry (%q and %q)", top, first)
+		}
+		if !nested && hdr.Typeflag != tar.TypeDir {
+			return "", fmt.Errorf("top-level entry %q is not a directory", name)
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				return "", fmt.Errorf("entry %q is inside symlink %q", name, dir)
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir, tar.TypeReg:
+		case tar.TypeSymlink:
+			target := hdr.Linkname
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(name), target)
+			}
+			if path.IsAbs(target) || escapes(target) || !strings.HasPrefix(target+"/", top+"/") {
+				return "", fmt.Errorf("symlink %q points outside the archive (%q)", name, hdr.Linkname)
+			}
+			symlinks[name] = true
+		case tar.TypeLink:
+			target := path.Clean(hdr.Linkname)
+			if path.IsAbs(target) || escapes(target) || !strings.HasPrefix(target, top+"/") {
+				return "", fmt.Errorf("hard link %q points outside the archive (%q)", name, hdr.Linkname)
+			}
+		default:
+			return "", fmt.Errorf("entry %q has unsupported type %q", name, hdr.Typeflag)
+		}
+
+		// Read every body so a truncated archive fails here, not mid-restore.
+		if _, err := io.Copy(io.Discard, tr); err != nil {
+			return "", fmt.Errorf("corrupt archive at %q: %w", name, err)
+		}
+	}
+
+	if top == "" {
+		return "", errors.New("archive is empty")
+	}
+	if !archiveTopDirRe.MatchString(top) {
+		return "", fmt.Errorf("unexpected top-level directory name %q", top)
+	}
+	return top, nil
+}
+
+// escapes reports whether a cleaned relative path climbs out of its root.
+func escapes(p string) bool {
+	return p == ".." || strings.HasPrefix(p, "../")
+}
+
+// restoreSiteLocal extracts the archive next to the site's compose directory
+// and swaps it into place, so a failed extraction leaves the site untouched.
+func (m *Manager) restoreSiteLocal(archive, top string, site models.Site) (*BackupInfo, error) {
+	dir := site.ComposePath
+	parent := filepath.Dir(dir)
+
+	staging, err := os.MkdirTemp(parent, "."+filepath.Base(dir)+".restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	if out, err := exec.Command("tar", "xzf", archive, "-C", staging).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("extract failed: %s: %w", string(out), err)
+	}
+
+	var safety *BackupInfo
+	if _, err := os.Stat(dir); err == nil {
+		safety, err = m.BackupSite(site)
+		if err != nil {
+			return nil, fmt.Errorf("pre-restore backup failed: %w", err)
+		}
+	}
+
+	old := staging + "-old"
+	if err := os.Rename(dir, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return safety, fmt.Errorf("move current directory aside: %w", err)
+	}
+	if err := os.Rename(filepath.Join(staging, top), dir); err != nil {
+		if rbErr := os.Rename(old, dir); rbErr != nil && !errors.Is(rbErr, os.ErrNotExist) {
+			return safety, fmt.Errorf("move restored directory into place: %w (and putting the original back failed: %v)", err, rbErr)
+		}
+		return safety, fmt.Errorf("move restored directory into place: %w", err)
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return safety, fmt.Errorf("restored, but removing the old directory %s failed: %w", old, err)
+	}
+	return safety, nil
+}
+
+// restoreSiteRemote uploads the archive to the site's server over SFTP,
+// downloads a tarball of the current directory into the backup directory, and
+// then extracts and swaps the archive into place on the server.
+func (m *Manager) restoreSiteRemote(archive, top string, site models.Site, server *models.Server) (*BackupInfo, error) {
+	dir, err := docker.RemoteSiteDir(server.DeployPath, site.ContainerName)
+	if err != nil {
+		return nil, err
+	}
+	upload := dir + ".restore.tar.gz"
+	snapshot := dir + ".pre-restore.tar.gz"
+	staging := dir + ".restore"
+
+	client, err := sshutil.NewClientWithHostKey(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey)
+	if err != nil {
+		return nil, fmt.Errorf("SSH connect failed: %w", err)
+	}
+	defer client.Close()
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SFTP session: %w", err)
+	}
+	defer sftpClient.Close()
+
+	if err := uploadFile(sftpClient, archive, upload); err != nil {
+		return nil, err
+	}
+	defer sshutil.RunCommand(client, fmt.Sprintf("rm -rf %s %s %s", upload, snapshot, staging))
+
+	var safety *BackupInfo
+	if _, err := sftpClient.Stat(dir); err == nil {
+		cmd := fmt.Sprintf("tar czf %s -C %s %s", snapshot, path.Dir(dir), path.Base(dir))
+		if out, err := sshutil.RunCommand(client, cmd); err != nil {
+			return nil, fmt.Errorf("pre-restore backup failed on server: %s: %w", out, err)
+		}
+		safety, err = m.downloadSiteBackup(sftpClient, snapshot, site)
+		if err != nil {
+			return nil, fmt.Errorf("pre-restore backup failed: %w", err)
+		}
+	}
+
+	cmd := fmt.Sprintf("rm -rf %[1]s && mkdir -p %[1]s && tar xzf %[2]s -C %[1]s && rm -rf %[3]s && mv %[1]s/%[4]s %[3]s",
+		staging, upload, dir, top)
+	if out, err := sshutil.RunCommand(client, cmd); err != nil {
+		return safety, fmt.Errorf("restore on server failed: %s: %w", out, err)
+	}
+	return safety, nil
+}
+
+func uploadFile(sftpClient *sftp.Client, local, remote string) error {
+	src, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := sftpClient.Create(remote)
+	if err != nil {
+		return fmt.Errorf("failed to create remote file %s: %w", remote, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to upload %s: %w", remote, err)
+	}
+	return dst.Close()
+}
+
+// downloadSiteBackup copies a tarball taken on the server into the backup
+// directory under the usual site backup name.
+func (m *Manager) downloadSiteBackup(sftpClient *sftp.Client, remote string, site models.Site) (*BackupInfo, error) {
+	info, err := sftpClient.Stat(remote)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.ensureSpace("site "+site.Domain, info.Size()); err != nil {
+		return nil, err
+	}
+
+	src, err := sftpClient.Open(remote)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	name := siteBackupPrefix(site) + time.Now().Format("20060102-150405") + ".tar.gz"
+	outPath := filepath.Join(m.backupDir, name)
+	partial := m.partialPath(name)
+	dst, err := os.Create(partial)
+	if err != nil {
+		return nil, fmt.Errorf("create backup: %w", err)
+	}
+	n, err := io.Copy(dst, src)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("download %s: %w", remote, err)
+	}
+	if err := commitBackup(partial, outPath); err != nil {
+		return nil, err
+	}
+	return &BackupInfo{
+		Name:      name,
+		Path:      outPath,
+		Size:      n,
+		CreatedAt: time.Now(),
+		Type:      "site",
+		SiteName:  site.Domain,
+	}, nil
+}
@@ -0,0 +1,213 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/models"
+)
+
+type tarEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	link     string
+}
+
+func writeArchive(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Linkname: e.link, Mode: 0644, Size: int64(len(e.body))}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+			hdr.Size = 0
+		}
+		if e.typeflag == tar.TypeSymlink || e.typeflag == tar.TypeLink {
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsSiteBackupFor(t *testing.T) {
+	site := models.Site{Domain: "shop.example.com"}
+	if !IsSiteBackupFor("site-shop-example-com-20240501-120000.tar.gz", site) {
+		t.Error("expected backup of the site to match")
+	}
+	for _, name := range []string{
+		"site-blog-shop-example-com-20240501-120000.tar.gz",
+		"site-shop-example-com-extra-20240501-120000.tar.gz",
+		"site-shop-example-com-20240501.tar.gz",
+		"ezweb-db-20240501-120000.sql.gz",
+		"site-shop-example-com-20240501-120000.tar.gz/../x",
+	} {
+		if IsSiteBackupFor(name, site) {
+			t.Errorf("IsSiteBackupFor(%q) = true, want false", name)
+		}
+	}
+}
+
+func TestValidateSiteArchive(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		wantErr string
+	}{
+		{"valid", []tarEntry{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "app/docker-compose.yml", typeflag: tar.TypeReg, body: "services: {}"},
+			{name: "app/current", typeflag: tar.TypeSymlink, link: "docker-compose.yml"},
+		}, ""},
+		{"traversal", []tarEntry{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "app/../../etc/passwd", typeflag: tar.TypeReg, body: "x"},
+		}, "escapes"},
+		{"absolute", []tarEntry{{name: "/etc/passwd", typeflag: tar.TypeReg, body: "x"}}, "escapes"},
+		{"two top-level dirs", []tarEntry{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "other/", typeflag: tar.TypeDir},
+		}, "more than one"},
+		{"symlink outside", []tarEntry{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "app/etc", typeflag: tar.TypeSymlink, link: "/etc"},
+		}, "outside"},
+		{"write through symlink", []tarEntry{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "app/data", typeflag: tar.TypeSymlink, link: "."},
+			{name: "app/data/file", typeflag: tar.TypeReg, body: "x"},
+		}, "inside symlink"},
+		{"device", []tarEntry{
+			{name: "app/", typeflag: tar.TypeDir},
+			{name: "app/sda", typeflag: tar.TypeBlock},
+		}, "unsupported"},
+		{"empty", nil, "empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".tar.gz")
+			writeArchive(t, path, tt.entries)
+			top, err := validateSiteArchive(path)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if top != "app" {
+					t.Errorf("top = %q, want app", top)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRestoreSite_LocalSwapsDirectoryAndKeepsSafetyCopy(t *testing.T) {
+	root := t.TempDir()
+	backupDir := filepath.Join(root, "backups")
+	m, err := NewManager(backupDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	siteDir := filepath.Join(root, "sites", "shop")
+	if err := os.MkdirAll(siteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siteDir, "docker-compose.yml"), []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	site := models.Site{Domain: "shop.example.com", IsLocal: true, ComposePath: siteDir}
+
+	name := "site-shop-example-com-20240501-120000.tar.gz"
+	writeArchive(t, filepath.Join(backupDir, name), []tarEntry{
+		{name: "shop/", typeflag: tar.TypeDir},
+		{name: "shop/docker-compose.yml", typeflag: tar.TypeReg, body: "restored"},
+	})
+
+	safety, err := m.RestoreSite(name, site, nil)
+	if err != nil {
+		t.Fatalf("RestoreSite: %v", err)
+	}
+	got, err := os.ReadFile(filepath.Join(siteDir, "docker-compose.yml"))
+	if err != nil || string(got) != "restored" {
+		t.Errorf("compose file after restore = %q, %v; want restored", got, err)
+	}
+	if safety == nil {
+		t.Fatal("expected a pre-restore backup of the existing directory")
+	}
+	if _, err := os.Stat(safety.Path); err != nil {
+		t.Errorf("pre-restore backup missing: %v", err)
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(root, "sites", ".shop.restore-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("staging directories left behind: %v", leftovers)
+	}
+}
+
+func TestRestoreSite_RejectsParentDirectoryArchive(t *testing.T) {
+	root := t.TempDir()
+	backupDir := filepath.Join(root, "backups")
+	m, err := NewManager(backupDir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	siteDir := filepath.Join(root, "sites", "shop")
+	if err := os.MkdirAll(siteDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siteDir, "docker-compose.yml"), []byte("current"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	site := models.Site{Domain: "shop.example.com", IsLocal: true, ComposePath: siteDir}
+
+	// The layout of backups taken before site archives were rooted at the
+	// site directory: the whole sites directory, siblings included.
+	name := "site-shop-example-com-20240101-120000.tar.gz"
+	writeArchive(t, filepath.Join(backupDir, name), []tarEntry{
+		{name: "sites/", typeflag: tar.TypeDir},
+		{name: "sites/shop/", typeflag: tar.TypeDir},
+		{name: "sites/shop/docker-compose.yml", typeflag: tar.TypeReg, body: "restored"},
+		{name: "sites/blog/", typeflag: tar.TypeDir},
+		{name: "sites/blog/docker-compose.yml", typeflag: tar.TypeReg, body: "blog"},
+	})
+
+	if _, err := m.RestoreSite(name, site, nil); err == nil || !strings.Contains(err.Error(), `"sites"`) {
+		t.Fatalf("RestoreSite = %v, want a refusal naming the archive's directory", err)
+	}
+	got, err := os.ReadFile(filepath.Join(siteDir, "docker-compose.yml"))
+	if err != nil || string(got) != "current" {
+		t.Errorf("compose file after refused restore = %q, %v; want it untouched", got, err)
+	}
+	if entries, _ := os.ReadDir(siteDir); len(entries) != 1 {
+		t.Errorf("site directory has %d entries after a refused restore, want 1", len(entries))
+	}
+}
@@ -3,9 +3,13 @@ package caddy
 import (
 	"database/sql"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -40,10 +44,105 @@ func validateExtraDirective(d string) error {
 	return nil
 }
 
+// validateUpstream checks that a reverse_proxy upstream is a plain host:port
+// (optionally prefixed with http:// or https://) or a unix socket in Caddy's
+// "unix//absolute/path" form. Whitespace, braces, and quotes are rejected
+// because they would let the value escape the directive, and link-local
+// addresses are refused so a routing config cannot be pointed at cloud
+// metadata endpoints such as 169.254.169.254. Hostnames are not resolved, so
+// this does not defend against DNS records that point at link-local space.
+func validateUpstream(u string) error {
+	if u == "" {
+		return fmt.Errorf("upstream must not be empty")
+	}
+	if strings.ContainsAny(u, " \t\n\r{}\"'`") {
+		return fmt.Errorf("upstream must not contain whitespace, braces, or quotes: %q", u)
+	}
+
+	if path, ok := strings.CutPrefix(u, "unix/"); ok {
+		if !strings.HasPrefix(path, "/") || strings.Contains(path, "..") {
+			return fmt.Errorf("unix socket upstream must be an absolute path: %q", u)
+		}
+		return nil
+	}
+
+	hostPort := u
+	if rest, ok := strings.CutPrefix(u, "http://"); ok {
+		hostPort = rest
+	} else if rest, ok := strings.CutPrefix(u, "https://"); ok {
+		hostPort = rest
+	}
+
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return fmt.Errorf("upstream must be host:port: %q", u)
+	}
+	if p, err := strconv.Atoi(port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("upstream port must be 1-65535: %q", u)
+	}
+	if host == "" {
+		return fmt.Errorf("upstream host must not be empty: %q", u)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			return fmt.Errorf("upstream must not target a link-local address: %q", u)
+		}
+		return nil
+	}
+	if !upstreamHostRe.MatchString(host) {
+		return fmt.Errorf("upstream host is not a valid hostname: %q", u)
+	}
+	if strings.EqualFold(strings.TrimSuffix(host, "."), "metadata.google.internal") {
+		return fmt.Errorf("upstream must not target a cloud metadata endpoint: %q", u)
+	}
+	return nil
+}
+
+// basicAuthUserRe limits basic auth usernames to characters that are safe
+// as a bare Caddyfile token.
+var basicAuthUserRe = regexp.MustCompile(`^[A-Za-z0-9._@-]{1,64}$`)
+
+// bcryptHashRe matches a bcrypt hash as produced by auth.HashBcrypt.
+var bcryptHashRe = regexp.MustCompile(`^\$2[aby]\$\d{2}\$[./A-Za-z0-9]{53}$`)
+
+// validateBasicAuth rejects credentials that would break the Caddyfile and
+// refuses anything other than a bcrypt hash, so a plaintext password can
+// never be written out.
+func validateBasicAuth(ba *models.BasicAuth) error {
+	if ba == nil {
+		return nil
+	}
+	if !basicAuthUserRe.MatchString(ba.Username) {
+		return fmt.Errorf("invalid basic auth username %q", ba.Username)
+	}
+	if ba.Password != "" || !bcryptHashRe.MatchString(ba.PasswordHash) {
+		return fmt.Errorf("basic auth for %q must use a bcrypt password hash", ba.Username)
+	}
+	return nil
+}
+
+// upstreamHostRe matches DNS hostnames: dot-separated labels of letters,
+// digits, and hyphens.
+var upstreamHostRe = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?)*\.?$`)
+
 type Manager struct {
 	CaddyfilePath string
 	AcmeEmail     string
-	mu            sync.Mutex
+	// MaintenancePage is an absolute path to an HTML file served to sites in
+	// maintenance mode. When empty a built-in page is used.
+	MaintenancePage string
+	// GlobalOptions are extra lines for the global options block, such as
+	// "admin off" or "acme_ca <staging directory URL>".
+	GlobalOptions []string
+	// Snippets are defined after the global block, keyed by name, so site
+	// extra directives can "import" them.
+	Snippets map[string][]string
+	mu       sync.Mutex
+
+	batchMu sync.Mutex
+	pending *reloadBatch // reload waiting for its quiet period, if any
+	holds   int          // open Batches; the pending reload waits for them
 }
 
 func NewManager(caddyfilePath string, acmeEmail string) *Manager {
@@ -57,12 +156,15 @@ func NewManager(caddyfilePath string, acmeEmail string) *Manager {
 func (m *Manager) GenerateCaddyfile(sites []models.Site) (string, error) {
 	var b strings.Builder
 
-	b.WriteString("{\n")
-	if m.AcmeEmail != "" {
-		b.WriteString(fmt.Sprintf("\temail %s\n", m.AcmeEmail))
+	if err := m.writeGlobalBlock(&b); err != nil {
+		return "", err
 	}
-	b.WriteString("}\n\n")
 
+	if err := validateMaintenancePage(m.MaintenancePage); err != nil {
+		return "", err
+	}
+
+	claims := make(domainClaims)
 	for _, site := range sites {
 		if site.Domain == "" || site.Status == "pending" {
 			continue
@@ -76,9 +178,9 @@ func (m *Manager) GenerateCaddyfile(sites []models.Site) (string, error) {
 
 		rc := site.RoutingConfig
 
-		// Sanitize redirect domains and validate extra directives up front so
-		// that a bad value causes the whole reload to fail rather than writing
-		// a corrupted Caddyfile.
+		// Sanitize redirect domains and validate extra directives and upstreams
+		// up front so that a bad value causes the whole reload to fail rather
+		// than writing a corrupted Caddyfile.
 		if rc != nil {
 			sanitized := make([]string, 0, len(rc.RedirectDomains))
 			for _, rd := range rc.RedirectDomains {
@@ -88,11 +190,26 @@ func (m *Manager) GenerateCaddyfile(sites []models.Site) (string, error) {
 			}
 			rc.RedirectDomains = sanitized
 
+			if err := rc.ValidateProxyModes(); err != nil {
+				return "", fmt.Errorf("site %q: %w", site.Domain, err)
+			}
 			for _, d := range rc.ExtraDirectives {
 				if err := validateExtraDirective(d); err != nil {
 					return "", fmt.Errorf("site %q: %w", site.Domain, err)
 				}
 			}
+			for i, rule := range rc.Rules {
+				if err := validateUpstream(rule.Upstream); err != nil {
+					return "", fmt.Errorf("site %q: rule %d: %w", site.Domain, i+1, err)
+				}
+				if err := validateBasicAuth(rule.BasicAuth); err != nil {
+					return "", fmt.Errorf("site %q: rule %d: %w", site.Domain, i+1, err)
+				}
+			}
+		}
+
+		if err := claims.claim(site); err != nil {
+			return "", err
 		}
 
 		// Redirect blocks (e.g. www → non-www)
@@ -103,10 +220,16 @@ func (m *Manager) GenerateCaddyfile(sites []models.Site) (string, error) {
 		}
 
 		// Main site block
-		if rc != nil && len(rc.Rules) > 0 {
+		if site.Maintenance {
+			writeMaintenanceSite(&b, site, m.MaintenancePage)
+		} else if rc != nil && len(rc.Rules) > 0 {
 			writeComplexSite(&b, site)
 		} else if site.Port > 0 {
-			writeSimpleSite(&b, site)
+			upstream, err := simpleUpstream(site)
+			if err != nil {
+				return "", fmt.Errorf("site %q: %w", site.Domain, err)
+			}
+			writeSimpleSite(&b, site, upstream)
 		}
 	}
 
@@ -114,19 +237,14 @@ func (m *Manager) GenerateCaddyfile(sites []models.Site) (string, error) {
 }
 
 func primaryDomain(domain string) string {
-	parts := strings.SplitN(domain, ",", 2)
-	return strings.TrimSpace(parts[0])
+	return models.PrimaryDomain(domain)
 }
 
-// siteAddress builds the address line from a potentially comma-separated domain field.
+// siteAddress builds the address line from a potentially comma-separated
+// domain field, dropping empty and repeated entries.
 func siteAddress(domain string, httpOnly bool) string {
-	parts := strings.Split(domain, ",")
 	var addrs []string
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
-		}
+	for _, p := range models.SplitDomains(domain) {
 		if httpOnly {
 			addrs = append(addrs, "http://"+p)
 		} else {
@@ -142,11 +260,76 @@ func writeRedirectBlock(b *strings.Builder, from, to string) {
 	b.WriteString("}\n\n")
 }
 
-func writeSimpleSite(b *strings.Builder, site models.Site) {
+// simpleUpstream returns the host:port a simple site proxies to: localhost,
+// or the assigned server's host when the site's upstream is remote.
+func simpleUpstream(site models.Site) (string, error) {
+	rc := site.RoutingConfig
+	if rc == nil || !rc.RemoteUpstream || site.IsLocal {
+		return fmt.Sprintf("localhost:%d", site.Port), nil
+	}
+	if site.ServerHost == "" {
+		return "", fmt.Errorf("remote upstream needs an assigned server")
+	}
+	upstream := net.JoinHostPort(site.ServerHost, strconv.Itoa(site.Port))
+	if err := validateUpstream(upstream); err != nil {
+		return "", err
+	}
+	return upstream, nil
+}
+
+func writeSimpleSite(b *strings.Builder, site models.Site, upstream string) {
 	httpOnly := site.RoutingConfig != nil && site.RoutingConfig.HTTPOnly
 	b.WriteString(fmt.Sprintf("%s {\n", siteAddress(site.Domain, httpOnly)))
 	writeTLSDirective(b, site.RoutingConfig)
-	b.WriteString(fmt.Sprintf("\treverse_proxy localhost:%d\n", site.Port))
+	writeSecurityHeaders(b, site.RoutingConfig)
+	if rc := site.RoutingConfig; rc != nil {
+		writeProxy(b, "\t", upstream, rc.WebSocket, rc.GRPC)
+	} else {
+		writeProxy(b, "\t", upstream, false, false)
+	}
+	b.WriteString("}\n\n")
+}
+
+// maintenanceRetryAfter is the Retry-After value, in seconds, sent with the
+// maintenance page.
+const maintenanceRetryAfter = 300
+
+const defaultMaintenanceHTML = `<!DOCTYPE html><html><head><meta charset="utf-8"><title>Down for maintenance</title></head>` +
+	`<body style="font-family:sans-serif;text-align:center;padding:4em"><h1>Down for maintenance</h1>` +
+	`<p>This site is undergoing scheduled maintenance. Please check back soon.</p></body></html>`
+
+// validateMaintenancePage rejects a maintenance page path that is relative or
+// contains characters that would break out of the Caddyfile token.
+func validateMaintenancePage(path string) error {
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("maintenance page %q must be an absolute path", path)
+	}
+	if strings.ContainsAny(path, " \t\r\n{}\"`") {
+		return fmt.Errorf("maintenance page %q contains characters not allowed in a Caddyfile", path)
+	}
+	return nil
+}
+
+// writeMaintenanceSite replaces the site's proxy with a 503 response. The
+// address and TLS settings are kept so certificates stay in place.
+func writeMaintenanceSite(b *strings.Builder, site models.Site, page string) {
+	rc := site.RoutingConfig
+	httpOnly := rc != nil && rc.HTTPOnly
+	b.WriteString(fmt.Sprintf("%s {\n", siteAddress(site.Domain, httpOnly)))
+	writeTLSDirective(b, rc)
+	writeSecurityHeaders(b, rc)
+	b.WriteString(fmt.Sprintf("\theader Retry-After %d\n", maintenanceRetryAfter))
+	if page != "" {
+		b.WriteString(fmt.Sprintf("\troot * %s\n", filepath.Dir(page)))
+		b.WriteString(fmt.Sprintf("\trewrite * /%s\n", filepath.Base(page)))
+		b.WriteString("\tfile_server {\n\t\tstatus 503\n\t}\n")
+	} else {
+		b.WriteString("\theader Content-Type \"text/html; charset=utf-8\"\n")
+		b.WriteString(fmt.Sprintf("\trespond `%s` 503\n", defaultMaintenanceHTML))
+	}
 	b.WriteString("}\n\n")
 }
 
@@ -154,6 +337,7 @@ func writeComplexSite(b *strings.Builder, site models.Site) {
 	rc := site.RoutingConfig
 	b.WriteString(fmt.Sprintf("%s {\n", siteAddress(site.Domain, rc.HTTPOnly)))
 	writeTLSDirective(b, rc)
+	writeSecurityHeaders(b, rc)
 
 	for _, d := range rc.ExtraDirectives {
 		b.WriteString("\t" + d + "\n")
@@ -192,6 +376,24 @@ func writeTLSDirective(b *strings.Builder, rc *models.RoutingConfig) {
 	}
 }
 
+// hstsMaxAge is the Strict-Transport-Security max-age, one year.
+const hstsMaxAge = 31536000
+
+// writeSecurityHeaders adds the security header preset to a site block. HSTS
+// is left out for HTTP-only sites, where browsers ignore it anyway.
+func writeSecurityHeaders(b *strings.Builder, rc *models.RoutingConfig) {
+	if rc == nil || !rc.SecurityHeaders {
+		return
+	}
+	b.WriteString("\theader {\n")
+	if !rc.HTTPOnly {
+		b.WriteString(fmt.Sprintf("\t\tStrict-Transport-Security \"max-age=%d; includeSubDomains\"\n", hstsMaxAge))
+	}
+	b.WriteString("\t\tX-Content-Type-Options \"nosniff\"\n")
+	b.WriteString("\t\tReferrer-Policy \"strict-origin-when-cross-origin\"\n")
+	b.WriteString("\t}\n")
+}
+
 func writePathBlock(b *strings.Builder, rule models.RoutingRule, index int) {
 	// Build the path matcher — ensure it ends with * for prefix matching
 	pathMatcher := rule.PathPrefix
@@ -205,6 +407,7 @@ func writePathBlock(b *strings.Builder, rule models.RoutingRule, index int) {
 	if rule.CORS != nil {
 		writeCORSPreflight(b, rule.CORS, index)
 	}
+	writeBasicAuth(b, rule, index)
 
 	// Path manipulation
 	if rule.RewritePath != "" {
@@ -232,6 +435,7 @@ func writeCatchAllBlock(b *strings.Builder, rule models.RoutingRule) {
 		writeCORSPreflight(b, rule.CORS, 99)
 		writeCORSResponseHeaders(b, rule.CORS)
 	}
+	writeBasicAuth(b, rule, 99)
 
 	writeResponseHeaders(b, rule.Headers)
 	writeReverseProxy(b, rule)
@@ -239,6 +443,26 @@ func writeCatchAllBlock(b *strings.Builder, rule models.RoutingRule) {
 	b.WriteString("\t}\n\n")
 }
 
+// writeBasicAuth emits a basic_auth directive for the rule. Caddy runs
+// basic_auth before nested handle blocks, so when CORS is configured the
+// directive gets a matcher that lets unauthenticated preflight requests
+// through.
+func writeBasicAuth(b *strings.Builder, rule models.RoutingRule, index int) {
+	ba := rule.BasicAuth
+	if ba == nil {
+		return
+	}
+	if rule.CORS != nil {
+		name := fmt.Sprintf("auth_%d", index)
+		b.WriteString(fmt.Sprintf("\t\t@%s not method OPTIONS\n", name))
+		b.WriteString(fmt.Sprintf("\t\tbasic_auth @%s {\n", name))
+	} else {
+		b.WriteString("\t\tbasic_auth {\n")
+	}
+	b.WriteString(fmt.Sprintf("\t\t\t%s %s\n", ba.Username, ba.PasswordHash))
+	b.WriteString("\t\t}\n")
+}
+
 func writeCORSPreflight(b *strings.Builder, cors *models.CORSConfig, index int) {
 	name := fmt.Sprintf("preflight_%d", index)
 	b.WriteString(fmt.Sprintf("\t\t@%s method OPTIONS\n", name))
@@ -283,12 +507,27 @@ func writeResponseHeaders(b *strings.Builder, headers map[string]string) {
 }
 
 func writeReverseProxy(b *strings.Builder, rule models.RoutingRule) {
-	b.WriteString(fmt.Sprintf("\t\treverse_proxy %s", rule.Upstream))
-	if rule.WebSocket {
+	writeProxy(b, "\t\t", rule.Upstream, rule.WebSocket, rule.GRPC)
+}
+
+// writeProxy emits a reverse_proxy directive at the given indent. WebSocket
+// disables response buffering so frames pass straight through; gRPC switches
+// the transport to h2c, cleartext HTTP/2, which gRPC servers expect behind a
+// TLS-terminating proxy.
+func writeProxy(b *strings.Builder, indent, upstream string, websocket, grpc bool) {
+	b.WriteString(fmt.Sprintf("%sreverse_proxy %s", indent, upstream))
+	if websocket || grpc {
 		b.WriteString(" {\n")
-		b.WriteString("\t\t\tflush_interval -1\n")
-		b.WriteString("\t\t\theader_up X-Real-IP {remote_host}\n")
-		b.WriteString("\t\t}")
+		if websocket {
+			b.WriteString(indent + "\tflush_interval -1\n")
+			b.WriteString(indent + "\theader_up X-Real-IP {remote_host}\n")
+		}
+		if grpc {
+			b.WriteString(indent + "\ttransport http {\n")
+			b.WriteString(indent + "\t\tversions h2c 2\n")
+			b.WriteString(indent + "\t}\n")
+		}
+		b.WriteString(indent + "}")
 	}
 	b.WriteString("\n")
 }
@@ -308,10 +547,9 @@ func (m *Manager) Reload(sites []models.Site) error {
 		return fmt.Errorf("failed to write Caddyfile: %w", err)
 	}
 
-	out, err := exec.Command("caddy", "validate", "--config", tmpPath).CombinedOutput()
-	if err != nil {
+	if out, err := validateCaddyfile(tmpPath); err != nil {
 		os.Remove(tmpPath)
-		return fmt.Errorf("Caddyfile validation failed: %w\n%s", err, string(out))
+		return fmt.Errorf("Caddyfile validation failed: %w\n%s", err, out)
 	}
 
 	if err := os.Rename(tmpPath, m.CaddyfilePath); err != nil {
@@ -319,7 +557,7 @@ func (m *Manager) Reload(sites []models.Site) error {
 		return fmt.Errorf("failed to move Caddyfile into place: %w", err)
 	}
 
-	out, err = exec.Command("caddy", "reload", "--config", m.CaddyfilePath).CombinedOutput()
+	out, err := exec.Command("caddy", "reload", "--config", m.CaddyfilePath).CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("Caddy reload failed: %w\n%s", err, string(out))
 	}
@@ -327,24 +565,83 @@ func (m *Manager) Reload(sites []models.Site) error {
 	return nil
 }
 
-func (m *Manager) AddSite(db *sql.DB, site models.Site) error {
-	sites, err := models.GetAllSites(db)
+// validateCaddyfile runs `caddy validate` against the file at path and
+// returns the combined output alongside any error.
+func validateCaddyfile(path string) (string, error) {
+	out, err := exec.Command("caddy", "validate", "--config", path).CombinedOutput()
+	return string(out), err
+}
+
+// Preview is the result of a dry-run Caddyfile generation.
+type Preview struct {
+	Content          string     // the Caddyfile that Reload would write
+	Current          string     // the live Caddyfile, empty if it does not exist yet
+	Valid            bool       // whether `caddy validate` accepted Content
+	ValidationOutput string     // output from `caddy validate`, or the generation error
+	Diff             []DiffLine // line diff from Current to Content
+}
+
+// Changed reports whether the generated Caddyfile differs from the live one.
+func (p *Preview) Changed() bool {
+	return p.Content != p.Current
+}
+
+// Preview generates and validates the Caddyfile for sites without writing
+// to CaddyfilePath or reloading Caddy, so it is safe to call at any time.
+// Generation and validation failures are reported in the result rather than
+// as an error; the error return is reserved for I/O problems.
+func (m *Manager) Preview(sites []models.Site) (*Preview, error) {
+	p := &Preview{}
+
+	current, err := os.ReadFile(m.CaddyfilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read current Caddyfile: %w", err)
+	}
+	p.Current = string(current)
+
+	content, err := m.GenerateCaddyfile(sites)
 	if err != nil {
-		return fmt.Errorf("failed to get sites for Caddy reload: %w", err)
+		p.ValidationOutput = err.Error()
+		return p, nil
 	}
-	return m.Reload(sites)
-}
+	p.Content = content
+	p.Diff = DiffLines(p.Current, p.Content)
 
-func (m *Manager) RemoveSite(db *sql.DB, domain string) error {
-	sites, err := models.GetAllSites(db)
+	// Validate a private temp copy so the live file and Reload's .tmp are
+	// never touched. The "Caddyfile" prefix lets caddy pick the right adapter.
+	tmp, err := os.CreateTemp("", "Caddyfile.preview-*")
 	if err != nil {
-		return fmt.Errorf("failed to get sites for Caddy reload: %w", err)
+		return nil, fmt.Errorf("failed to create preview file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("failed to write preview file: %w", err)
 	}
-	var filtered []models.Site
-	for _, s := range sites {
-		if s.Domain != domain {
-			filtered = append(filtered, s)
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write preview file: %w", err)
+	}
+
+	out, err := validateCaddyfile(tmp.Name())
+	p.ValidationOutput = strings.TrimSpace(out)
+	if err != nil {
+		if p.ValidationOutput == "" {
+			p.ValidationOutput = err.Error()
 		}
+		return p, nil
 	}
-	return m.Reload(filtered)
+	p.Valid = true
+	return p, nil
+}
+
+// AddSite reloads Caddy with every site in db after site was created or
+// changed. Calls in quick succession share one reload (see scheduleReload).
+func (m *Manager) AddSite(db *sql.DB, site models.Site) error {
+	return m.scheduleReload(db, "")
+}
+
+// RemoveSite reloads Caddy without the site serving domain, which may not
+// have left db yet. Like AddSite it shares a reload with nearby calls.
+func (m *Manager) RemoveSite(db *sql.DB, domain string) error {
+	return m.scheduleReload(db, domain)
 }
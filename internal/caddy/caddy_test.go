@@ -1,7 +1,13 @@
 package caddy
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"ezweb/internal/auth"
+	"ezweb/internal/models"
 )
 
 func TestSanitizeDomain_StripsInjectionChars(t *testing.T) {
@@ -73,3 +79,378 @@ func TestValidateExtraDirective_RejectsBraces(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateUpstream_AcceptsValid(t *testing.T) {
+	cases := []string{
+		"localhost:8090",
+		"45.126.38.75:20091",
+		"[::1]:8080",
+		"http://app.internal:3000",
+		"https://backend.example.com:443",
+		"unix//run/app.sock",
+	}
+	for _, u := range cases {
+		if err := validateUpstream(u); err != nil {
+			t.Errorf("validateUpstream(%q) returned unexpected error: %v", u, err)
+		}
+	}
+}
+
+func TestValidateUpstream_RejectsInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"localhost",
+		"localhost:0",
+		"localhost:99999",
+		"localhost:8080 {",
+		"localhost:8080\nrespond 200",
+		"bad_host!:8080",
+		"unix/relative.sock",
+		"169.254.169.254:80",
+		"http://169.254.169.254:80",
+		"[fe80::1]:8080",
+		"metadata.google.internal:80",
+	}
+	for _, u := range cases {
+		if err := validateUpstream(u); err == nil {
+			t.Errorf("validateUpstream(%q) should have returned an error", u)
+		}
+	}
+}
+
+func TestGenerateCaddyfile_BadUpstreamFailsWholeConfig(t *testing.T) {
+	m := NewManager("", "")
+	sites := []models.Site{{
+		Domain: "example.com",
+		Status: "running",
+		RoutingConfig: &models.RoutingConfig{
+			Rules: []models.RoutingRule{{Upstream: "169.254.169.254:80"}},
+		},
+	}}
+	if _, err := m.GenerateCaddyfile(sites); err == nil {
+		t.Error("GenerateCaddyfile should fail when a rule has a link-local upstream")
+	}
+}
+
+func TestGenerateCaddyfile_DomainConflictNamesBothSites(t *testing.T) {
+	m := NewManager("", "")
+	tests := []struct {
+		name  string
+		sites []models.Site
+		want  []string
+	}{
+		{"comma list overlaps another site", []models.Site{
+			{ID: 1, Domain: "example.com", Status: "running", Port: 8080},
+			{ID: 2, Domain: "shop.example.com, Example.com", Status: "running", Port: 8081},
+		}, []string{"example.com", `"example.com" (#1)`, `"shop.example.com" (#2)`}},
+		{"redirect domain overlaps another site", []models.Site{
+			{ID: 3, Domain: "www.example.com", Status: "running", Port: 8080},
+			{ID: 4, Domain: "example.com", Status: "running", Port: 8081,
+				RoutingConfig: &models.RoutingConfig{RedirectDomains: []string{"www.example.com"}}},
+		}, []string{"www.example.com", "#3", "#4"}},
+		{"one site redirects its own domain", []models.Site{
+			{ID: 5, Domain: "a.example.com", Status: "running", Port: 8080,
+				RoutingConfig: &models.RoutingConfig{RedirectDomains: []string{"A.example.com"}}},
+		}, []string{"listed twice", "#5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := m.GenerateCaddyfile(tt.sites)
+			if err == nil {
+				t.Fatal("expected a domain conflict error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+
+	// Pending sites are not written, so they cannot conflict.
+	sites := []models.Site{
+		{ID: 1, Domain: "example.com", Status: "running", Port: 8080},
+		{ID: 2, Domain: "example.com", Status: "pending", Port: 8081},
+	}
+	if _, err := m.GenerateCaddyfile(sites); err != nil {
+		t.Errorf("pending duplicate should be ignored: %v", err)
+	}
+	if err := FindDomainConflict(sites); err == nil {
+		t.Error("FindDomainConflict should consider every site it is given")
+	}
+}
+
+func TestGenerateCaddyfile_MultipleDomains(t *testing.T) {
+	m := NewManager("", "")
+	site := models.Site{Domain: "example.com, www.example.com,Example.com", Status: "running", Port: 8080,
+		RoutingConfig: &models.RoutingConfig{RedirectDomains: []string{"old.example.com"}}}
+
+	out, err := m.GenerateCaddyfile([]models.Site{site})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "example.com, www.example.com {\n") {
+		t.Errorf("site address should list each domain once:\n%s", out)
+	}
+	if !strings.Contains(out, "redir https://example.com{uri} permanent") {
+		t.Errorf("redirect should point at the primary domain:\n%s", out)
+	}
+}
+
+func TestGenerateCaddyfile_MaintenanceReplacesProxy(t *testing.T) {
+	m := NewManager("", "")
+	site := models.Site{Domain: "shop.example.com", Status: "running", Port: 8080, Maintenance: true}
+
+	out, err := m.GenerateCaddyfile([]models.Site{site})
+	if err != nil {
+		t.Fatalf("GenerateCaddyfile: %v", err)
+	}
+	if strings.Contains(out, "reverse_proxy") {
+		t.Errorf("maintenance site should not be proxied:\n%s", out)
+	}
+	for _, want := range []string{"header Retry-After 300", "` 503", "Down for maintenance"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	m.MaintenancePage = "/srv/ezweb/maintenance.html"
+	out, err = m.GenerateCaddyfile([]models.Site{site})
+	if err != nil {
+		t.Fatalf("GenerateCaddyfile with page: %v", err)
+	}
+	for _, want := range []string{"root * /srv/ezweb", "rewrite * /maintenance.html", "status 503"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	m.MaintenancePage = "/srv/ezweb/page.html\n}\nevil {"
+	if _, err := m.GenerateCaddyfile([]models.Site{site}); err == nil {
+		t.Error("expected an unsafe maintenance page path to be rejected")
+	}
+}
+
+func TestGenerateCaddyfile_SecurityHeaders(t *testing.T) {
+	m := NewManager("", "")
+	secure := models.Site{Domain: "shop.example.com", Status: "running", Port: 8080,
+		RoutingConfig: &models.RoutingConfig{SecurityHeaders: true}}
+	plain := models.Site{Domain: "intranet.example.com", Status: "running", Port: 8081,
+		RoutingConfig: &models.RoutingConfig{SecurityHeaders: true, HTTPOnly: true}}
+	off := models.Site{Domain: "blog.example.com", Status: "running", Port: 8082}
+
+	for _, tc := range []struct {
+		site models.Site
+		want []string
+		skip []string
+	}{
+		{secure, []string{"Strict-Transport-Security \"max-age=31536000; includeSubDomains\"", "X-Content-Type-Options \"nosniff\"", "Referrer-Policy"}, nil},
+		{plain, []string{"X-Content-Type-Options \"nosniff\"", "Referrer-Policy"}, []string{"Strict-Transport-Security"}},
+		{off, nil, []string{"header {"}},
+	} {
+		out, err := m.GenerateCaddyfile([]models.Site{tc.site})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.site.Domain, err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("%s: output missing %q:\n%s", tc.site.Domain, want, out)
+			}
+		}
+		for _, skip := range tc.skip {
+			if strings.Contains(out, skip) {
+				t.Errorf("%s: output should not contain %q:\n%s", tc.site.Domain, skip, out)
+			}
+		}
+	}
+}
+
+func TestGenerateCaddyfile_SimpleSiteProxyModes(t *testing.T) {
+	m := NewManager("", "")
+	for _, tc := range []struct {
+		rc   *models.RoutingConfig
+		want string
+	}{
+		{nil, "\treverse_proxy localhost:8080\n}"},
+		{&models.RoutingConfig{WebSocket: true},
+			"\treverse_proxy localhost:8080 {\n\t\tflush_interval -1\n\t\theader_up X-Real-IP {remote_host}\n\t}\n}"},
+		{&models.RoutingConfig{GRPC: true},
+			"\treverse_proxy localhost:8080 {\n\t\ttransport http {\n\t\t\tversions h2c 2\n\t\t}\n\t}\n}"},
+	} {
+		site := models.Site{Domain: "app.example.com", Status: "running", Port: 8080, RoutingConfig: tc.rc}
+		out, err := m.GenerateCaddyfile([]models.Site{site})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tc.want) {
+			t.Errorf("%+v: output missing %q:\n%s", tc.rc, tc.want, out)
+		}
+	}
+
+	for _, rc := range []*models.RoutingConfig{
+		{GRPC: true, HTTPOnly: true},
+		{GRPC: true, WebSocket: true},
+	} {
+		site := models.Site{Domain: "app.example.com", Status: "running", Port: 8080, RoutingConfig: rc}
+		if _, err := m.GenerateCaddyfile([]models.Site{site}); err == nil {
+			t.Errorf("%+v: expected a conflicting proxy mode to be rejected", rc)
+		}
+	}
+}
+
+func TestGenerateCaddyfile_RemoteUpstream(t *testing.T) {
+	m := NewManager("", "")
+	remote := &models.RoutingConfig{RemoteUpstream: true}
+	for _, tc := range []struct {
+		site models.Site
+		want string
+	}{
+		{models.Site{ServerHost: "10.0.0.5", RoutingConfig: remote}, "\treverse_proxy 10.0.0.5:8080\n}"},
+		{models.Site{ServerHost: "2001:db8::5", RoutingConfig: remote}, "\treverse_proxy [2001:db8::5]:8080\n}"},
+		{models.Site{ServerHost: "10.0.0.5"}, "\treverse_proxy localhost:8080\n}"},
+		{models.Site{ServerHost: "10.0.0.5", IsLocal: true, RoutingConfig: remote}, "\treverse_proxy localhost:8080\n}"},
+	} {
+		site := tc.site
+		site.Domain, site.Status, site.Port = "app.example.com", "running", 8080
+		out, err := m.GenerateCaddyfile([]models.Site{site})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tc.want) {
+			t.Errorf("host %q local=%v: output missing %q:\n%s", site.ServerHost, site.IsLocal, tc.want, out)
+		}
+	}
+
+	site := models.Site{Domain: "app.example.com", Status: "running", Port: 8080, RoutingConfig: remote}
+	if _, err := m.GenerateCaddyfile([]models.Site{site}); err == nil {
+		t.Error("remote upstream without a server host should be rejected")
+	}
+}
+
+func TestGenerateCaddyfile_GlobalOptionsAndSnippets(t *testing.T) {
+	dir := t.TempDir()
+	snippet := "# shared by client sites\nencode gzip\n\nheader -Server\n"
+	if err := os.WriteFile(filepath.Join(dir, "common.caddy"), []byte(snippet), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	snippets, err := LoadSnippets(dir)
+	if err != nil {
+		t.Fatalf("LoadSnippets: %v", err)
+	}
+
+	m := NewManager("", "ops@example.com")
+	m.GlobalOptions = []string{"admin off", "acme_ca https://acme-staging-v02.api.letsencrypt.org/directory"}
+	m.Snippets = snippets
+	site := models.Site{Domain: "shop.example.com", Status: "running", Port: 8080,
+		RoutingConfig: &models.RoutingConfig{
+			ExtraDirectives: []string{"import common"},
+			Rules:           []models.RoutingRule{{Upstream: "localhost:8080"}},
+		}}
+	out, err := m.GenerateCaddyfile([]models.Site{site})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n\temail ops@example.com\n\tadmin off\n\tacme_ca https://acme-staging-v02.api.letsencrypt.org/directory\n}\n\n" +
+		"(common) {\n\tencode gzip\n\theader -Server\n}\n\n"
+	if !strings.HasPrefix(out, want) {
+		t.Errorf("Caddyfile should open with the global block and snippet:\n%s", out)
+	}
+	if !strings.Contains(out, "\timport common\n") {
+		t.Errorf("site block missing the import:\n%s", out)
+	}
+
+	for _, bad := range []struct {
+		options  []string
+		snippets map[string][]string
+	}{
+		{options: []string{"admin off } evil.example.com {"}},
+		{options: []string{"servers {"}},
+		{snippets: map[string][]string{"common": {"respond 200 }"}}},
+		{snippets: map[string][]string{"bad name) {": {"encode gzip"}}},
+	} {
+		m.GlobalOptions, m.Snippets = bad.options, bad.snippets
+		if _, err := m.GenerateCaddyfile([]models.Site{site}); err == nil {
+			t.Errorf("GenerateCaddyfile accepted options %q, snippets %q", bad.options, bad.snippets)
+		}
+	}
+}
+
+func TestGenerateCaddyfile_BasicAuth(t *testing.T) {
+	hash, err := auth.HashBcrypt("s3cret-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager("", "")
+	site := models.Site{
+		Domain: "example.com",
+		Status: "running",
+		RoutingConfig: &models.RoutingConfig{Rules: []models.RoutingRule{
+			{PathPrefix: "/admin", Upstream: "localhost:8080", BasicAuth: &models.BasicAuth{Username: "ops", PasswordHash: hash}},
+			{Upstream: "localhost:8080", CORS: &models.CORSConfig{Methods: "GET"}, BasicAuth: &models.BasicAuth{Username: "ops", PasswordHash: hash}},
+		}},
+	}
+
+	out, err := m.GenerateCaddyfile([]models.Site{site})
+	if err != nil {
+		t.Fatalf("GenerateCaddyfile: %v", err)
+	}
+	for _, want := range []string{"\t\tbasic_auth {\n\t\t\tops " + hash, "@auth_99 not method OPTIONS", "basic_auth @auth_99 {"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+
+	site.RoutingConfig.Rules[0].BasicAuth = &models.BasicAuth{Username: "ops", PasswordHash: "s3cret-pass"}
+	if _, err := m.GenerateCaddyfile([]models.Site{site}); err == nil {
+		t.Error("a non-bcrypt password should be rejected")
+	}
+	site.RoutingConfig.Rules[0].BasicAuth = &models.BasicAuth{Username: "ops }", PasswordHash: hash}
+	if _, err := m.GenerateCaddyfile([]models.Site{site}); err == nil {
+		t.Error("an unsafe username should be rejected")
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	a := "{\n}\n\nold.com {\n\treverse_proxy localhost:8080\n}\n"
+	b := "{\n}\n\nnew.com {\n\treverse_proxy localhost:8080\n}\n"
+
+	var got string
+	for _, l := range DiffLines(a, b) {
+		got += string(l.Op) + l.Text + "\n"
+	}
+	want := " {\n }\n \n-old.com {\n+new.com {\n \treverse_proxy localhost:8080\n }\n"
+	if got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPreview_DoesNotTouchLiveCaddyfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "Caddyfile")
+	const live = "{\n}\n"
+	if err := os.WriteFile(path, []byte(live), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(path, "")
+	p, err := m.Preview([]models.Site{{Domain: "example.com", Port: 8080, Status: "running"}})
+	if err != nil {
+		t.Fatalf("Preview: %v", err)
+	}
+	if p.Current != live {
+		t.Errorf("Current = %q, want %q", p.Current, live)
+	}
+	if !p.Changed() || len(p.Diff) == 0 {
+		t.Error("expected the preview to differ from the live Caddyfile")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != live {
+		t.Errorf("live Caddyfile was modified: %q", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Preview must not leave a .tmp file next to the live Caddyfile")
+	}
+}
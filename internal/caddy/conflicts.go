@@ -0,0 +1,118 @@
+package caddy
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"ezweb/internal/models"
+)
+
+// ErrDomainConflict is matched by the errors CheckDomainConflict and
+// CreateSite return when a host name is already taken.
+var ErrDomainConflict = errors.New("domain conflict")
+
+// conflictError keeps the message naming the sites involved while matching
+// ErrDomainConflict.
+type conflictError struct{ error }
+
+func (conflictError) Is(target error) bool { return target == ErrDomainConflict }
+
+// domainClaims records which site owns each host name written to the
+// Caddyfile. Caddy refuses a config in which two site blocks share an
+// address, with an error that does not say which sites are involved, so
+// conflicts are caught here first.
+type domainClaims map[string]models.Site
+
+// siteHosts returns the host names a site's blocks answer on: every distinct
+// entry of its comma-separated domain plus its redirect domains. Names are
+// lower-cased and stripped of any scheme and trailing dot, as Caddy compares
+// them.
+func siteHosts(site models.Site) []string {
+	names := models.SplitDomains(site.Domain)
+	if site.RoutingConfig != nil {
+		names = append(names, site.RoutingConfig.RedirectDomains...)
+	}
+	var hosts []string
+	for _, n := range names {
+		n = strings.TrimSpace(strings.ToLower(n))
+		n = strings.TrimPrefix(strings.TrimPrefix(n, "https://"), "http://")
+		n = strings.TrimSuffix(n, ".")
+		if n != "" {
+			hosts = append(hosts, n)
+		}
+	}
+	return hosts
+}
+
+func siteLabel(site models.Site) string {
+	if site.ID == 0 {
+		return fmt.Sprintf("new site %q", primaryDomain(site.Domain))
+	}
+	return fmt.Sprintf("site %q (#%d)", primaryDomain(site.Domain), site.ID)
+}
+
+// claim registers the site's hosts, returning an error naming both sites if
+// one of them is already taken.
+func (c domainClaims) claim(site models.Site) error {
+	for _, host := range siteHosts(site) {
+		if owner, ok := c[host]; ok {
+			if owner.ID == site.ID && owner.Domain == site.Domain {
+				return fmt.Errorf("domain %s is listed twice by %s", host, siteLabel(site))
+			}
+			return fmt.Errorf("domain %s is used by both %s and %s", host, siteLabel(owner), siteLabel(site))
+		}
+		c[host] = site
+	}
+	return nil
+}
+
+// FindDomainConflict returns an error if two of the sites, or one site
+// twice, claim the same host name through their domains or redirect domains.
+func FindDomainConflict(sites []models.Site) error {
+	claims := make(domainClaims)
+	for _, site := range sites {
+		if err := claims.claim(site); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckDomainConflict returns an error naming both sites if site would
+// answer on a host name another site already uses, through its domain or a
+// redirect domain. GenerateCaddyfile refuses such configs, so one conflicting
+// site would block every later reload; checking before saving keeps it out
+// of the database. A trashed site still holds its domain, so taking it is a
+// conflict as well.
+func CheckDomainConflict(db *sql.DB, site models.Site) error {
+	if trashed, err := models.GetTrashedSiteByDomain(db, site.Domain); err == nil && trashed.ID != site.ID {
+		return conflictError{fmt.Errorf("domain %s belongs to a site in the trash; restore that site or wait until it is purged", site.Domain)}
+	}
+	sites, err := models.GetAllSites(db)
+	if err != nil {
+		log.Printf("failed to load sites for domain conflict check: %v", err)
+		return nil
+	}
+	others := make([]models.Site, 0, len(sites)+1)
+	for _, s := range sites {
+		if s.ID != site.ID {
+			others = append(others, s)
+		}
+	}
+	if err := FindDomainConflict(append(others, site)); err != nil {
+		return conflictError{err}
+	}
+	return nil
+}
+
+// CreateSite saves a new site once CheckDomainConflict has found its host
+// names free. Every path that creates a site goes through it.
+func CreateSite(db *sql.DB, site *models.Site) error {
+	if err := CheckDomainConflict(db, *site); err != nil {
+		return err
+	}
+	return models.CreateSite(db, site)
+}
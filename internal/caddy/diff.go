@@ -0,0 +1,71 @@
+package caddy
+
+import "strings"
+
+// DiffOp identifies how a line changed between two Caddyfiles.
+type DiffOp byte
+
+const (
+	DiffEqual  DiffOp = ' '
+	DiffAdd    DiffOp = '+'
+	DiffRemove DiffOp = '-'
+)
+
+// DiffLine is one line of a line-based diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// DiffLines returns a line diff that turns a into b, computed from the longest
+// common subsequence. Caddyfiles are small, so the O(n*m) table is fine.
+func DiffLines(a, b string) []DiffLine {
+	x, y := splitLines(a), splitLines(b)
+	n, m := len(x), len(y)
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]DiffLine, 0, max(n, m))
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case x[i] == y[j]:
+			diff = append(diff, DiffLine{DiffEqual, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffRemove, x[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffAdd, y[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		diff = append(diff, DiffLine{DiffRemove, x[i]})
+	}
+	for ; j < m; j++ {
+		diff = append(diff, DiffLine{DiffAdd, y[j]})
+	}
+	return diff
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,116 @@
+package caddy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// snippetNameRe limits snippet names to characters that are safe inside the
+// "(name)" definition and as the argument of an import directive.
+var snippetNameRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// validateGlobalLine applies the extra directive guards to a global option or
+// snippet line, and also refuses a closing brace, which would end the global
+// block or snippet early and let the rest of the line escape it.
+func validateGlobalLine(line string) error {
+	if err := validateExtraDirective(line); err != nil {
+		return err
+	}
+	if strings.Contains(line, "}") {
+		return fmt.Errorf("line must not contain '}': %q", line)
+	}
+	return nil
+}
+
+// LoadSnippets reads every *.caddy file in dir as a named snippet: the file
+// name without its extension is the name, and each non-blank line that is not
+// a # comment is one directive. Sites pull a snippet in with an
+// "import <name>" extra directive. An empty dir yields no snippets.
+func LoadSnippets(dir string) (map[string][]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("failed to read snippets directory: %w", err)
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.caddy"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snippets: %w", err)
+	}
+
+	snippets := make(map[string][]string, len(paths))
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".caddy")
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snippet %q: %w", name, err)
+		}
+		var lines []string
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		snippets[name] = lines
+	}
+	if err := validateSnippets(snippets); err != nil {
+		return nil, err
+	}
+	return snippets, nil
+}
+
+func validateSnippets(snippets map[string][]string) error {
+	for name, lines := range snippets {
+		if !snippetNameRe.MatchString(name) {
+			return fmt.Errorf("invalid snippet name %q", name)
+		}
+		for _, line := range lines {
+			if err := validateGlobalLine(line); err != nil {
+				return fmt.Errorf("snippet %q: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// writeGlobalBlock writes the global options block that must open the
+// Caddyfile, followed by the snippet definitions in name order.
+func (m *Manager) writeGlobalBlock(b *strings.Builder) error {
+	for _, opt := range m.GlobalOptions {
+		if err := validateGlobalLine(opt); err != nil {
+			return fmt.Errorf("global option: %w", err)
+		}
+	}
+	if err := validateSnippets(m.Snippets); err != nil {
+		return err
+	}
+
+	b.WriteString("{\n")
+	if m.AcmeEmail != "" {
+		b.WriteString(fmt.Sprintf("\temail %s\n", m.AcmeEmail))
+	}
+	for _, opt := range m.GlobalOptions {
+		b.WriteString(fmt.Sprintf("\t%s\n", opt))
+	}
+	b.WriteString("}\n\n")
+
+	names := make([]string, 0, len(m.Snippets))
+	for name := range m.Snippets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString(fmt.Sprintf("(%s) {\n", name))
+		for _, line := range m.Snippets[name] {
+			b.WriteString(fmt.Sprintf("\t%s\n", line))
+		}
+		b.WriteString("}\n\n")
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package caddy
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"ezweb/internal/models"
+)
+
+// Site changes reload Caddy once they stop arriving for reloadQuiet, so a
+// run of imports or edits costs one validate and reload instead of one per
+// site. A steady stream of changes is still reloaded after reloadMaxWait.
+// Code that changes many sites in one go opens a Batch instead, which
+// reloads once when it is committed.
+var (
+	reloadQuiet   = 250 * time.Millisecond
+	reloadMaxWait = 2 * time.Second
+)
+
+// reloadBatch is one pending reload and the callers waiting on it.
+type reloadBatch struct {
+	db      *sql.DB
+	exclude map[string]bool // domains to leave out, from RemoveSite
+	first   time.Time
+	timer   *time.Timer
+	done    chan struct{}
+	err     error
+}
+
+// scheduleReload joins the pending reload, or starts one, and waits for it.
+// The sites are read from db when the reload runs, so it covers every change
+// committed before its callers asked. Each caller gets the reload's error.
+func (m *Manager) scheduleReload(db *sql.DB, exclude string) error {
+	m.batchMu.Lock()
+	b := m.joinLocked(db)
+	if exclude != "" {
+		b.exclude[exclude] = true
+	}
+	if m.holds == 0 {
+		m.armLocked(b)
+	}
+	m.batchMu.Unlock()
+
+	<-b.done
+	return b.err
+}
+
+// joinLocked returns the pending reload, starting one if there is none.
+func (m *Manager) joinLocked(db *sql.DB) *reloadBatch {
+	b := m.pending
+	if b == nil {
+		b = &reloadBatch{exclude: make(map[string]bool), first: time.Now(), done: make(chan struct{})}
+		m.pending = b
+	}
+	b.db = db
+	return b
+}
+
+// armLocked (re)starts b's quiet period, cut short so b runs no later than
+// reloadMaxWait after its first caller.
+func (m *Manager) armLocked(b *reloadBatch) {
+	wait := reloadQuiet
+	if left := time.Until(b.first.Add(reloadMaxWait)); left < wait {
+		wait = max(left, 0)
+	}
+	if b.timer == nil {
+		b.timer = time.AfterFunc(wait, func() { m.flush(b) })
+		return
+	}
+	b.timer.Reset(wait)
+}
+
+// flush runs batch b's reload. A timer reset just as b fired can call it a
+// second time; only the first call, which detaches b, does anything. While a
+// Batch is open the reload waits for its Commit instead.
+func (m *Manager) flush(b *reloadBatch) {
+	m.batchMu.Lock()
+	if m.pending != b || m.holds > 0 {
+		m.batchMu.Unlock()
+		return
+	}
+	m.pending = nil
+	m.batchMu.Unlock()
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	b.err = m.reloadFrom(b.db, b.exclude)
+	close(b.done)
+}
+
+// Batch is an explicit reload scope for code that changes many sites in one
+// go, such as a drain or a database restore. While a Batch is open no reload
+// runs, however far apart the changes are; site changes made meanwhile join
+// the reload its Commit runs.
+type Batch struct {
+	m  *Manager
+	db *sql.DB
+}
+
+// Begin opens a Batch. Every Batch must be committed, or reloads stop.
+func (m *Manager) Begin(db *sql.DB) *Batch {
+	m.batchMu.Lock()
+	m.holds++
+	m.batchMu.Unlock()
+	return &Batch{m: m, db: db}
+}
+
+// Commit closes b and reloads Caddy with every site in b's database, without
+// waiting for a quiet period. If other Batches are still open the reload
+// waits for the last of them. It returns the reload's error.
+func (b *Batch) Commit() error {
+	m := b.m
+	m.batchMu.Lock()
+	m.holds--
+	pending := m.joinLocked(b.db)
+	last := m.holds == 0
+	m.batchMu.Unlock()
+
+	if last {
+		m.flush(pending)
+	}
+	<-pending.done
+	return pending.err
+}
+
+// ReloadAll reloads Caddy with every site in db right away, sharing the
+// reload with any changes already waiting for one.
+func (m *Manager) ReloadAll(db *sql.DB) error {
+	return m.Begin(db).Commit()
+}
+
+func (m *Manager) reloadFrom(db *sql.DB, exclude map[string]bool) error {
+	sites, err := models.GetAllSites(db)
+	if err != nil {
+		return fmt.Errorf("failed to get sites for Caddy reload: %w", err)
+	}
+	filtered := sites[:0]
+	for _, s := range sites {
+		if !exclude[s.Domain] {
+			filtered = append(filtered, s)
+		}
+	}
+	return m.Reload(filtered)
+}
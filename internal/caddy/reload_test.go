@@ -0,0 +1,179 @@
+package caddy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+)
+
+// fakeCaddy puts a caddy on PATH that accepts every Caddyfile and logs each
+// call to the returned file. A reload fails while the file "fail" exists in
+// the same directory.
+func fakeCaddy(t *testing.T) (logPath, failPath string) {
+	t.Helper()
+	bin := t.TempDir()
+	logPath = filepath.Join(bin, "calls")
+	failPath = filepath.Join(bin, "fail")
+	script := "#!/bin/sh\necho \"$1\" >> " + logPath + "\n" +
+		"if [ \"$1\" = reload ] && [ -e " + failPath + " ]; then echo 'admin endpoint refused'; exit 1; fi\n"
+	if err := os.WriteFile(filepath.Join(bin, "caddy"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return logPath, failPath
+}
+
+func countReloads(t *testing.T, logPath string) int {
+	t.Helper()
+	data, err := os.ReadFile(logPath)
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(data), "reload\n")
+}
+
+func TestAddSite_CoalescesReloads(t *testing.T) {
+	logPath, failPath := fakeCaddy(t)
+	quiet := reloadQuiet
+	reloadQuiet = 50 * time.Millisecond
+	defer func() { reloadQuiet = quiet }()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	m := NewManager(filepath.Join(t.TempDir(), "Caddyfile"), "")
+
+	// A burst of imports ends in a single reload that includes every site.
+	sites := make([]models.Site, 10)
+	for i := range sites {
+		sites[i] = models.Site{Domain: "s" + string(rune('a'+i)) + ".example.com", ContainerName: "s" + string(rune('a'+i)), Port: 8100 + i, Status: "running"}
+		if err := models.CreateSite(database, &sites[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	errs := make([]error, len(sites))
+	for i, site := range sites {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.AddSite(database, site)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("AddSite %d: %v", i, err)
+		}
+	}
+	if n := countReloads(t, logPath); n != 1 {
+		t.Errorf("burst caused %d reloads, want 1", n)
+	}
+	data, err := os.ReadFile(m.CaddyfilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "reverse_proxy"); got != 10 {
+		t.Errorf("Caddyfile proxies %d sites, want 10", got)
+	}
+
+	// An isolated change is reloaded after the quiet period, and its error
+	// reaches the caller.
+	if err := os.WriteFile(failPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err = m.RemoveSite(database, "sa.example.com")
+	if err == nil || !strings.Contains(err.Error(), "admin endpoint refused") {
+		t.Errorf("RemoveSite err = %v, want the reload failure", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("isolated reload took %s", d)
+	}
+	if n := countReloads(t, logPath); n != 2 {
+		t.Errorf("reloads = %d, want 2", n)
+	}
+	data, _ = os.ReadFile(m.CaddyfilePath)
+	if strings.Contains(string(data), "sa.example.com") {
+		t.Error("removed domain is still in the Caddyfile")
+	}
+}
+
+func TestBatch_ReloadsOnceAtCommit(t *testing.T) {
+	logPath, _ := fakeCaddy(t)
+	quiet := reloadQuiet
+	reloadQuiet = 20 * time.Millisecond
+	defer func() { reloadQuiet = quiet }()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	m := NewManager(filepath.Join(t.TempDir(), "Caddyfile"), "")
+
+	// Changes spaced well past the quiet period would each reload on their
+	// own; inside a batch they wait for its Commit.
+	batch := m.Begin(database)
+	var wg sync.WaitGroup
+	errs := make([]error, 3)
+	for i := range errs {
+		site := models.Site{Domain: "b" + string(rune('a'+i)) + ".example.com", ContainerName: "b" + string(rune('a'+i)), Port: 8200 + i, Status: "running"}
+		if err := models.CreateSite(database, &site); err != nil {
+			t.Fatal(err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = m.AddSite(database, site)
+		}()
+		time.Sleep(3 * reloadQuiet)
+	}
+	if n := countReloads(t, logPath); n != 0 {
+		t.Fatalf("%d reloads before Commit, want 0", n)
+	}
+
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("AddSite %d: %v", i, err)
+		}
+	}
+	if n := countReloads(t, logPath); n != 1 {
+		t.Errorf("batch caused %d reloads, want 1", n)
+	}
+	data, err := os.ReadFile(m.CaddyfilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Count(string(data), "reverse_proxy"); got != 3 {
+		t.Errorf("Caddyfile proxies %d sites, want 3", got)
+	}
+
+	// With no batch open, ReloadAll reloads straight away.
+	reloadQuiet = time.Second
+	start := time.Now()
+	if err := m.ReloadAll(database); err != nil {
+		t.Fatalf("ReloadAll: %v", err)
+	}
+	if d := time.Since(start); d >= reloadQuiet {
+		t.Errorf("ReloadAll waited %s", d)
+	}
+	if n := countReloads(t, logPath); n != 2 {
+		t.Errorf("reloads = %d, want 2", n)
+	}
+}
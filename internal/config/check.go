@@ -0,0 +1,218 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"ezweb/internal/scheduler"
+)
+
+// Problem is one finding of Check, keyed by the environment variable to fix.
+type Problem struct {
+	Setting string
+	Message string
+	Fatal   bool // false for warnings
+}
+
+// Check verifies the prerequisites of each subsystem that Load only warns
+// about, or does not look at, so a deployment can be vetted (ezweb --check)
+// before it starts serving. Problems that would make a feature fail are
+// fatal; ones that only weaken security or disable a feature are warnings.
+func (c *Config) Check() []Problem {
+	var p []Problem
+	fail := func(setting, format string, args ...any) {
+		p = append(p, Problem{Setting: setting, Message: fmt.Sprintf(format, args...), Fatal: true})
+	}
+	warn := func(setting, format string, args ...any) {
+		p = append(p, Problem{Setting: setting, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		fail("PORT", "%q is not a valid port", c.Port)
+	}
+
+	// Secrets. Load refuses to start without them, so only strength is left.
+	if len(c.JWTSecret) < 32 {
+		warn("JWT_SECRET", "shorter than 32 characters")
+	}
+	if len(c.AdminPass) < 8 {
+		warn("ADMIN_PASS", "shorter than 8 characters")
+	}
+	if c.EncryptionKey == "" {
+		warn("ENCRYPTION_KEY", "not set; SSH key paths, host keys and secret env vars are stored in plaintext")
+	} else if len(c.EncryptionKey) < 32 {
+		warn("ENCRYPTION_KEY", "shorter than 32 characters")
+	}
+	if !c.SecureCookies {
+		warn("SECURE_COOKIES", "false; auth cookies are sent over plain HTTP")
+	}
+
+	// Admin IP filter. main refuses to start with an invalid entry.
+	if _, err := ParseIPRanges(c.AdminAllowIPs); err != nil {
+		fail("ADMIN_ALLOW_IPS", "%v", err)
+	}
+	if _, err := ParseIPRanges(c.AdminDenyIPs); err != nil {
+		fail("ADMIN_DENY_IPS", "%v", err)
+	}
+
+	// Database: SQLite needs to create the -wal and -shm files next to it.
+	if err := dirWritable(filepath.Dir(c.DBPath)); err != nil {
+		fail("DB_PATH", "database directory: %v", err)
+	}
+
+	// Static assets: a relative STATIC_DIR follows DATA_DIR, which may not
+	// be the install directory the assets were shipped in.
+	if info, err := os.Stat(c.StaticDir); err != nil || !info.IsDir() {
+		warn("STATIC_DIR", "%s is not a directory; the UI will load without styles or scripts", c.StaticDir)
+	}
+
+	// Caddy: the whole file is rewritten on every site change.
+	if err := CaddyfileWritable(c.CaddyfilePath); err != nil {
+		fail("CADDYFILE_PATH", "%v", err)
+	}
+	if c.MaintenancePage != "" {
+		if f, err := os.Open(c.MaintenancePage); err != nil {
+			fail("MAINTENANCE_PAGE", "not readable: %v", err)
+		} else {
+			f.Close()
+		}
+	}
+
+	if c.CaddySnippetsDir != "" {
+		if info, err := os.Stat(c.CaddySnippetsDir); err != nil {
+			fail("CADDY_SNIPPETS_DIR", "%v", err)
+		} else if !info.IsDir() {
+			fail("CADDY_SNIPPETS_DIR", "%s is not a directory", c.CaddySnippetsDir)
+		}
+	}
+
+	// Backups. Load resets an invalid schedule, so look at the raw value.
+	if c.BackupDir == "" {
+		warn("BACKUP_DIR", "not set; backups are disabled")
+	} else if err := dirWritable(c.BackupDir); err != nil {
+		fail("BACKUP_DIR", "%v", err)
+	}
+	if expr := getEnv("BACKUP_SCHEDULE", ""); expr != "" {
+		if _, err := scheduler.Parse(expr); err != nil {
+			fail("BACKUP_SCHEDULE", "%v", err)
+		}
+	}
+
+	// SSH keys for remote servers.
+	if c.SSHKeyDir != "" {
+		if info, err := os.Stat(c.SSHKeyDir); err != nil {
+			fail("SSH_KEY_DIR", "%v", err)
+		} else if !info.IsDir() {
+			fail("SSH_KEY_DIR", "%s is not a directory", c.SSHKeyDir)
+		} else if info.Mode().Perm()&0o077 != 0 {
+			warn("SSH_KEY_DIR", "%s is accessible to other users (mode %s); use 0700", c.SSHKeyDir, info.Mode().Perm())
+		}
+	}
+
+	// Email alerts.
+	switch {
+	case c.SMTPHost != "" && c.SMTPFrom == "":
+		fail("SMTP_FROM", "required when SMTP_HOST is set")
+	case c.SMTPHost == "" && (c.SMTPFrom != "" || c.AlertEmail != ""):
+		warn("SMTP_HOST", "not set; SMTP_FROM and ALERT_EMAIL are ignored and no alert emails are sent")
+	}
+	if c.SMTPHost != "" {
+		if c.AlertEmail == "" {
+			warn("ALERT_EMAIL", "not set; SMTP is configured but no alert emails are sent")
+		}
+		if c.SMTPPort < 1 || c.SMTPPort > 65535 {
+			fail("SMTP_PORT", "%d is not a valid port", c.SMTPPort)
+		}
+		if c.SMTPUsername != "" && c.SMTPPassword == "" {
+			fail("SMTP_PASSWORD", "required when SMTP_USERNAME is set")
+		}
+		if c.SMTPTLS == "none" && c.SMTPUsername != "" && c.SMTPHost != "localhost" && c.SMTPHost != "127.0.0.1" {
+			fail("SMTP_TLS", "none, but credentials are only sent over TLS; use starttls or tls")
+		}
+	}
+
+	// Webhook alerts.
+	if c.WebhookURL != "" {
+		if err := checkWebhookURL(c.WebhookURL); err != nil {
+			fail("WEBHOOK_URL", "%v", err)
+		}
+	}
+	for i, u := range c.WebhookURLs {
+		if u == "" {
+			continue // skipped when notifiers are built
+		}
+		if err := checkWebhookURL(u); err != nil {
+			fail("WEBHOOK_URLS", "entry %d: %v", i+1, err)
+		}
+	}
+	if len(c.WebhookFormats) > len(c.WebhookURLs) {
+		warn("WEBHOOK_FORMATS", "has %d entries for %d URLs; the extra formats are ignored", len(c.WebhookFormats), len(c.WebhookURLs))
+	}
+
+	// Logging. The file is only opened once logging is set up.
+	if strings.EqualFold(strings.TrimSpace(c.LogOutput), "file") {
+		if c.LogFile == "" {
+			fail("LOG_FILE", "required when LOG_OUTPUT=file")
+		} else if err := dirWritable(filepath.Dir(c.LogFile)); err != nil && !os.IsNotExist(err) {
+			fail("LOG_FILE", "log directory: %v", err)
+		}
+	}
+
+	return p
+}
+
+// CaddyfileWritable reports why the Caddyfile at path cannot be rewritten, or
+// nil if it can. The directory must accept new files as well, since a missing
+// Caddyfile is created on first write.
+func CaddyfileWritable(path string) error {
+	if err := dirWritable(filepath.Dir(path)); err != nil {
+		return fmt.Errorf("Caddyfile directory: %w", err)
+	}
+	return fileWritable(path)
+}
+
+// dirWritable reports why files cannot be created in dir, or nil if they can.
+func dirWritable(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".ezweb-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// fileWritable reports why an existing file cannot be written. A missing file
+// is fine; it is created on first write.
+func fileWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", path, err)
+	}
+	return f.Close()
+}
+
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", raw)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	t.Setenv("BACKUP_SCHEDULE", "")
+	dir := t.TempDir()
+	good := &Config{
+		Port:          "3000",
+		JWTSecret:     "0123456789abcdef0123456789abcdef",
+		AdminPass:     "correct horse",
+		EncryptionKey: "0123456789abcdef0123456789abcdef",
+		SecureCookies: true,
+		DBPath:        filepath.Join(dir, "ezweb.db"),
+		CaddyfilePath: filepath.Join(dir, "Caddyfile"),
+		BackupDir:     dir,
+		StaticDir:     dir,
+		SMTPPort:      587,
+	}
+	if p := good.Check(); len(p) != 0 {
+		t.Fatalf("valid config reported problems: %+v", p)
+	}
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	bad := *good
+	bad.CaddyfilePath = filepath.Join(dir, "missing", "Caddyfile")
+	bad.BackupDir = filepath.Join(dir, "missing")
+	bad.SMTPHost = "smtp.example.com"
+	bad.AlertEmail = "ops@example.com"
+	bad.SSHKeyDir = keyFile
+	bad.WebhookURLs = []string{"https://hooks.example.com/a", "", "ftp://example.com"}
+
+	fatal := make(map[string]bool)
+	for _, p := range bad.Check() {
+		if p.Fatal {
+			fatal[p.Setting] = true
+		}
+	}
+	for _, want := range []string{"CADDYFILE_PATH", "BACKUP_DIR", "SMTP_FROM", "SSH_KEY_DIR", "WEBHOOK_URLS"} {
+		if !fatal[want] {
+			t.Errorf("no fatal problem for %s; got %v", want, fatal)
+		}
+	}
+	if len(fatal) != 5 {
+		t.Errorf("fatal problems = %v, want exactly 5", fatal)
+	}
+}
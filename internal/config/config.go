@@ -2,10 +2,14 @@ package config
 
 import (
 	"fmt"
-	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+
+	"ezweb/internal/logging"
+	"ezweb/internal/scheduler"
 
 	"github.com/joho/godotenv"
 )
@@ -15,35 +19,81 @@ type Config struct {
 	JWTSecret      string
 	AdminUser      string
 	AdminPass      string
+	DataDir        string // base for relative path settings; the working directory when unset
 	DBPath         string
+	StaticDir      string
 	CaddyfilePath  string
 	AcmeEmail      string
+	MaintenancePage string
+	CaddyGlobalOptions []string
+	CaddySnippetsDir   string
 	SecureCookies  bool
 	WebhookURL     string
 	WebhookFormat  string
+	WebhookURLs    []string
+	WebhookFormats []string
+	WebhookSecret  string
 	AlertThreshold int
+	// AlertEscalationMinutes is when a site that stays down is alerted
+	// again: the first entry after the down alert, each later one after the
+	// previous repeat, the last repeating. Empty alerts only once.
+	AlertEscalationMinutes []int
 	BackupDir      string
+	BackupSchedule string // cron expression; empty disables scheduled backups
 	SSHKeyDir      string
+	// ComposeLintPolicy is what happens when an imported compose file, or
+	// that of a local compose site being deployed, has risky settings:
+	// "warn" asks for confirmation, "block" refuses it.
+	ComposeLintPolicy string
 	MetricsEnabled        bool
 	HealthCheckInterval   int
+	HealthCheckTimeout    int // seconds
+	// HealthCheckConcurrency is how many sites a health check round probes
+	// at once.
+	HealthCheckConcurrency int
+	SSLAutoEnable         bool
 	JWTExpiryHours        int
+	JWTAccessMinutes      int
+	SessionIdleMinutes    int // 0 = no idle timeout
 	DBMaxOpenConns        int
 	DBMaxIdleConns        int
+	DBReadConns           int // 0 = heavy reads share the main pool
 	ActivityRetentionDays int
 	HealthRetentionDays   int
+	SiteTrashDays         int
 	LockoutMaxAttempts    int
 	LockoutDurationMin    int
 	BcryptCost            int
+	PasswordHash          string // "bcrypt" or "argon2id", for new password hashes
 	SMTPHost     string
 	SMTPPort     int
 	SMTPFrom     string
 	SMTPUsername string
 	SMTPPassword string
+	SMTPTLS      string // auto, none, starttls or tls
 	AlertEmail   string
 	PublicDomainFilter string
 	TOTPIssuer        string
 	CORSOrigins       string
+	AdminAllowIPs      []string // IPs and CIDR ranges allowed to reach the admin UI; empty allows all
+	AdminDenyIPs       []string
+	AdminIPExemptPaths []string // path prefixes the allow/deny lists do not apply to
 	APIKey            string
+	LogLevel          string
+	LogOutput         string
+	LogFile           string
+	LogMaxSizeMB      int
+	LogMaxBackups     int
+	LogFormat         string
+	EncryptionKey     string
+}
+
+// DefaultIPExemptPaths is ADMIN_IP_EXEMPT_PATHS when it is unset: the public
+// endpoints the admin IP filter lets through, namely probes, metrics, the
+// status API, the client portal, public quotes and the static assets they use.
+var DefaultIPExemptPaths = []string{
+	"/healthz", "/readyz", "/metrics", "/api/status",
+	"/portal", "/q", "/quote-requests", "/static",
 }
 
 func Load() (*Config, error) {
@@ -54,35 +104,67 @@ func Load() (*Config, error) {
 		JWTSecret:      getEnv("JWT_SECRET", ""),
 		AdminUser:      getEnv("ADMIN_USER", "admin"),
 		AdminPass:      getEnv("ADMIN_PASS", ""),
-		DBPath:         getEnv("DB_PATH", "./ezweb.db"),
+		DBPath:         getEnv("DB_PATH", "ezweb.db"),
+		StaticDir:      getEnv("STATIC_DIR", "static"),
 		CaddyfilePath:  getEnv("CADDYFILE_PATH", "/etc/caddy/Caddyfile"),
 		AcmeEmail:      getEnv("ACME_EMAIL", ""),
+		MaintenancePage: getEnv("MAINTENANCE_PAGE", ""),
+		CaddyGlobalOptions: EnvLines("CADDY_GLOBAL_OPTIONS"),
+		CaddySnippetsDir:   getEnv("CADDY_SNIPPETS_DIR", ""),
 		SecureCookies:  getEnv("SECURE_COOKIES", "true") == "true",
 		WebhookURL:     getEnv("WEBHOOK_URL", ""),
 		WebhookFormat:  getEnv("WEBHOOK_FORMAT", "discord"),
+		WebhookURLs:    getEnvList("WEBHOOK_URLS"),
+		WebhookFormats: getEnvList("WEBHOOK_FORMATS"),
+		WebhookSecret:  getEnv("WEBHOOK_SECRET", ""),
 		AlertThreshold: getEnvInt("ALERT_THRESHOLD", 3),
-		BackupDir:      getEnv("BACKUP_DIR", "./backups"),
+		BackupDir:      getEnv("BACKUP_DIR", "backups"),
+		BackupSchedule: getEnv("BACKUP_SCHEDULE", ""),
 		SSHKeyDir:      getEnv("SSH_KEY_DIR", ""),
+		ComposeLintPolicy: strings.ToLower(getEnv("COMPOSE_LINT_POLICY", "warn")),
 		MetricsEnabled:        getEnv("METRICS_ENABLED", "false") == "true",
 		HealthCheckInterval:   getEnvInt("HEALTH_CHECK_INTERVAL", 5),
+		HealthCheckTimeout:    getEnvInt("HEALTH_CHECK_TIMEOUT", 10),
+		HealthCheckConcurrency: getEnvInt("HEALTH_CHECK_CONCURRENCY", 10),
+		SSLAutoEnable:         getEnv("SSL_AUTO_ENABLE", "true") == "true",
 		JWTExpiryHours:        getEnvInt("JWT_EXPIRY_HOURS", 24),
+		JWTAccessMinutes:      getEnvInt("JWT_ACCESS_MINUTES", 15),
+		SessionIdleMinutes:    getEnvInt("SESSION_IDLE_MINUTES", 0),
 		DBMaxOpenConns:        getEnvInt("DB_MAX_OPEN_CONNS", 25),
 		DBMaxIdleConns:        getEnvInt("DB_MAX_IDLE_CONNS", 5),
+		DBReadConns:           getEnvInt("DB_READ_CONNS", 0),
 		ActivityRetentionDays: getEnvInt("ACTIVITY_RETENTION_DAYS", 90),
 		HealthRetentionDays:   getEnvInt("HEALTH_RETENTION_DAYS", 30),
+		SiteTrashDays:         getEnvInt("SITE_TRASH_DAYS", 7),
 		LockoutMaxAttempts:    getEnvInt("LOCKOUT_MAX_ATTEMPTS", 5),
 		LockoutDurationMin:    getEnvInt("LOCKOUT_DURATION_MIN", 15),
 		BcryptCost:            getEnvInt("BCRYPT_COST", 12),
+		PasswordHash:          strings.ToLower(getEnv("PASSWORD_HASH", "bcrypt")),
 		SMTPHost:     getEnv("SMTP_HOST", ""),
 		SMTPPort:     getEnvInt("SMTP_PORT", 587),
 		SMTPFrom:     getEnv("SMTP_FROM", ""),
 		SMTPUsername: getEnv("SMTP_USERNAME", ""),
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		SMTPTLS:      strings.ToLower(getEnv("SMTP_TLS", "auto")),
 		AlertEmail:   getEnv("ALERT_EMAIL", ""),
 		PublicDomainFilter: getEnv("PUBLIC_DOMAIN_FILTER", ""),
 		TOTPIssuer:        getEnv("TOTP_ISSUER", "EzWeb"),
 		CORSOrigins:       getEnv("CORS_ORIGINS", ""),
+		AdminAllowIPs:      getEnvList("ADMIN_ALLOW_IPS"),
+		AdminDenyIPs:       getEnvList("ADMIN_DENY_IPS"),
+		AdminIPExemptPaths: getEnvList("ADMIN_IP_EXEMPT_PATHS"),
 		APIKey:            getEnv("API_KEY", ""),
+		LogLevel:          getEnv("LOG_LEVEL", "info"),
+		LogOutput:         getEnv("LOG_OUTPUT", "stderr"),
+		LogFile:           getEnv("LOG_FILE", "logs/ezweb.log"),
+		LogMaxSizeMB:      getEnvInt("LOG_MAX_SIZE_MB", 10),
+		LogMaxBackups:     getEnvInt("LOG_MAX_BACKUPS", 5),
+		LogFormat:         getEnv("LOG_FORMAT", "text"),
+		EncryptionKey:     getEnv("ENCRYPTION_KEY", ""),
+	}
+
+	if err := cfg.resolvePaths(); err != nil {
+		return nil, err
 	}
 
 	if cfg.JWTSecret == "" {
@@ -92,35 +174,170 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("ADMIN_PASS is required")
 	}
 	if len(cfg.AdminPass) < 8 {
-		log.Println("WARNING: ADMIN_PASS is shorter than 8 characters — use a stronger password in production")
+		logging.Warnf("ADMIN_PASS is shorter than 8 characters — use a stronger password in production")
 	}
 
 	if len(cfg.JWTSecret) < 32 {
-		log.Println("WARNING: JWT_SECRET is shorter than 32 characters — use a longer secret in production")
+		logging.Warnf("JWT_SECRET is shorter than 32 characters — use a longer secret in production")
+	}
+
+	if cfg.JWTAccessMinutes < 1 {
+		logging.Warnf("JWT_ACCESS_MINUTES=%d is invalid — using 15", cfg.JWTAccessMinutes)
+		cfg.JWTAccessMinutes = 15
+	}
+
+	if cfg.SessionIdleMinutes < 0 {
+		logging.Warnf("SESSION_IDLE_MINUTES=%d is invalid — disabling the idle timeout", cfg.SessionIdleMinutes)
+		cfg.SessionIdleMinutes = 0
+	}
+
+	if raw := getEnvList("ALERT_ESCALATION_MINUTES"); raw != nil {
+		steps, err := parseMinutesList(raw)
+		if err != nil {
+			logging.Warnf("ALERT_ESCALATION_MINUTES is invalid (%v) — alerting only once per outage", err)
+		} else {
+			cfg.AlertEscalationMinutes = steps
+		}
+	}
+
+	if cfg.HealthCheckTimeout < 1 || cfg.HealthCheckTimeout > 120 {
+		logging.Warnf("HEALTH_CHECK_TIMEOUT=%d is invalid — using 10", cfg.HealthCheckTimeout)
+		cfg.HealthCheckTimeout = 10
+	}
+	if cfg.HealthCheckConcurrency < 1 {
+		logging.Warnf("HEALTH_CHECK_CONCURRENCY=%d is invalid — using 10", cfg.HealthCheckConcurrency)
+		cfg.HealthCheckConcurrency = 10
+	}
+
+	if cfg.SiteTrashDays < 0 {
+		logging.Warnf("SITE_TRASH_DAYS=%d is invalid — using 7", cfg.SiteTrashDays)
+		cfg.SiteTrashDays = 7
+	}
+
+	if cfg.EncryptionKey == "" {
+		logging.Warnf("ENCRYPTION_KEY is not set — server SSH key paths, host keys and secret env vars are stored in plaintext")
+	} else if len(cfg.EncryptionKey) < 32 {
+		logging.Warnf("ENCRYPTION_KEY is shorter than 32 characters — use a longer key in production")
 	}
 
 	if !cfg.SecureCookies {
-		log.Println("WARNING: SECURE_COOKIES is false — auth cookies will be sent over plain HTTP. Set to true in production.")
+		logging.Warnf("SECURE_COOKIES is false — auth cookies will be sent over plain HTTP. Set to true in production.")
 	}
 
 	if cfg.BcryptCost < 10 || cfg.BcryptCost > 14 {
-		log.Printf("WARNING: BCRYPT_COST=%d is outside recommended range (10-14)", cfg.BcryptCost)
+		logging.Warnf("BCRYPT_COST=%d is outside recommended range (10-14)", cfg.BcryptCost)
+	}
+
+	if cfg.PasswordHash != "bcrypt" && cfg.PasswordHash != "argon2id" {
+		logging.Warnf("PASSWORD_HASH=%q is not bcrypt or argon2id — using bcrypt", cfg.PasswordHash)
+		cfg.PasswordHash = "bcrypt"
+	}
+
+	// Unset keeps the public endpoints reachable; set to "" (or any list)
+	// to choose exactly which ones are.
+	if _, ok := os.LookupEnv("ADMIN_IP_EXEMPT_PATHS"); !ok {
+		cfg.AdminIPExemptPaths = DefaultIPExemptPaths
+	}
+
+	switch cfg.SMTPTLS {
+	case "auto", "none", "starttls", "tls":
+	default:
+		logging.Warnf("SMTP_TLS=%q is not auto, none, starttls or tls — using auto", cfg.SMTPTLS)
+		cfg.SMTPTLS = "auto"
+	}
+
+	switch cfg.ComposeLintPolicy {
+	case "warn", "block":
+	default:
+		logging.Warnf("COMPOSE_LINT_POLICY=%q is not warn or block — using warn", cfg.ComposeLintPolicy)
+		cfg.ComposeLintPolicy = "warn"
 	}
 
 	if cfg.BackupDir != "" {
 		if err := os.MkdirAll(cfg.BackupDir, 0750); err != nil {
-			log.Printf("WARNING: could not create BACKUP_DIR %q: %v", cfg.BackupDir, err)
+			logging.Warnf("could not create BACKUP_DIR %q: %v", cfg.BackupDir, err)
+		}
+	}
+
+	if cfg.BackupSchedule != "" {
+		if _, err := scheduler.Parse(cfg.BackupSchedule); err != nil {
+			logging.Warnf("BACKUP_SCHEDULE is invalid (%v) — scheduled backups are disabled", err)
+			cfg.BackupSchedule = ""
 		}
 	}
 
 	caddyParent := filepath.Dir(cfg.CaddyfilePath)
 	if _, err := os.Stat(caddyParent); os.IsNotExist(err) {
-		log.Printf("WARNING: CADDYFILE_PATH parent directory %q does not exist — Caddy config writes will fail", caddyParent)
+		logging.Warnf("CADDYFILE_PATH parent directory %q does not exist — Caddy config writes will fail", caddyParent)
+	}
+
+	if cfg.MaintenancePage != "" {
+		if _, err := os.Stat(cfg.MaintenancePage); err != nil {
+			logging.Warnf("MAINTENANCE_PAGE %q is not readable — Caddy will fail to serve it: %v", cfg.MaintenancePage, err)
+		}
 	}
 
 	return cfg, nil
 }
 
+// DataDir returns DATA_DIR as an absolute path, or the working directory
+// when it is unset.
+func DataDir() (string, error) {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" {
+		return os.Getwd()
+	}
+	return filepath.Abs(dir)
+}
+
+// ResolvePath returns p joined onto base unless it is empty or already
+// absolute.
+func ResolvePath(base, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(base, p)
+}
+
+// resolvePaths makes every path setting absolute against DATA_DIR, so the
+// files used do not depend on the directory EzWeb was started from (systemd
+// and cron rarely start it in the install directory). Each relative path is
+// logged with what it resolved to.
+func (cfg *Config) resolvePaths() error {
+	dir, err := DataDir()
+	if err != nil {
+		return fmt.Errorf("failed to resolve DATA_DIR: %w", err)
+	}
+	cfg.DataDir = dir
+	logging.Infof("relative paths resolve against %s", dir)
+	if os.Getenv("DATA_DIR") != "" {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			logging.Warnf("could not create DATA_DIR %q: %v", dir, err)
+		}
+	}
+
+	for _, p := range []struct {
+		setting string
+		value   *string
+	}{
+		{"DB_PATH", &cfg.DBPath},
+		{"STATIC_DIR", &cfg.StaticDir},
+		{"BACKUP_DIR", &cfg.BackupDir},
+		{"LOG_FILE", &cfg.LogFile},
+		{"SSH_KEY_DIR", &cfg.SSHKeyDir},
+		{"CADDYFILE_PATH", &cfg.CaddyfilePath},
+		{"CADDY_SNIPPETS_DIR", &cfg.CaddySnippetsDir},
+		{"MAINTENANCE_PAGE", &cfg.MaintenancePage},
+	} {
+		resolved := ResolvePath(dir, *p.value)
+		if resolved != *p.value {
+			logging.Infof("%s %q resolved to %s", p.setting, *p.value, resolved)
+			*p.value = resolved
+		}
+	}
+	return nil
+}
+
 func getEnv(key, fallback string) string {
 	if val, ok := os.LookupEnv(key); ok {
 		return val
@@ -128,6 +345,77 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+// getEnvList splits a comma-separated variable into trimmed entries. Empty
+// positions are preserved so that parallel lists stay aligned.
+func getEnvList(key string) []string {
+	val, ok := os.LookupEnv(key)
+	if !ok || strings.TrimSpace(val) == "" {
+		return nil
+	}
+	parts := strings.Split(val, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+// EnvLines splits a semicolon-separated variable into trimmed, non-empty
+// lines, for values whose entries may themselves contain commas. It is
+// exported for ezweb-mcp, which reads its few settings without Load.
+func EnvLines(key string) []string {
+	var lines []string
+	for _, line := range strings.Split(os.Getenv(key), ";") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// parseMinutesList parses a list of positive whole minutes, such as the
+// entries of ALERT_ESCALATION_MINUTES.
+func parseMinutesList(entries []string) ([]int, error) {
+	minutes := make([]int, 0, len(entries))
+	for _, e := range entries {
+		m, err := strconv.Atoi(e)
+		if err != nil || m < 1 {
+			return nil, fmt.Errorf("%q is not a positive number of minutes", e)
+		}
+		minutes = append(minutes, m)
+	}
+	return minutes, nil
+}
+
+// ParseIPRanges parses IP addresses and CIDR ranges, such as the entries of
+// ADMIN_ALLOW_IPS. A bare address is a range of one. Empty entries are
+// skipped.
+func ParseIPRanges(entries []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, e := range entries {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		if !strings.Contains(e, "/") {
+			ip := net.ParseIP(e)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or CIDR range", e)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(e)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", e)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
 func getEnvInt(key string, fallback int) int {
 	if val, ok := os.LookupEnv(key); ok {
 		if i, err := strconv.Atoi(val); err == nil {
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadResolvesRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DATA_DIR", dir)
+	t.Setenv("JWT_SECRET", "0123456789abcdef0123456789abcdef")
+	t.Setenv("ADMIN_PASS", "correct horse")
+	t.Setenv("DB_PATH", "data/ezweb.db")
+	t.Setenv("BACKUP_DIR", "backups")
+	t.Setenv("STATIC_DIR", "static")
+	t.Setenv("CADDYFILE_PATH", "/etc/caddy/Caddyfile")
+	t.Setenv("SSH_KEY_DIR", "")
+	t.Setenv("BACKUP_SCHEDULE", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	for _, c := range []struct{ name, got, want string }{
+		{"DataDir", cfg.DataDir, dir},
+		{"DBPath", cfg.DBPath, filepath.Join(dir, "data", "ezweb.db")},
+		{"BackupDir", cfg.BackupDir, filepath.Join(dir, "backups")},
+		{"StaticDir", cfg.StaticDir, filepath.Join(dir, "static")},
+		{"CaddyfilePath", cfg.CaddyfilePath, "/etc/caddy/Caddyfile"},
+		{"SSHKeyDir", cfg.SSHKeyDir, ""},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %q, want %q", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestParseIPRanges(t *testing.T) {
+	nets, err := ParseIPRanges([]string{"203.0.113.0/24", " 198.51.100.7 ", "", "2001:db8::1"})
+	if err != nil {
+		t.Fatalf("ParseIPRanges: %v", err)
+	}
+	var got []string
+	for _, n := range nets {
+		got = append(got, n.String())
+	}
+	want := []string{"203.0.113.0/24", "198.51.100.7/32", "2001:db8::1/128"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("ParseIPRanges = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"10.0.0", "10.0.0.0/33", "office"} {
+		if _, err := ParseIPRanges([]string{bad}); err == nil {
+			t.Errorf("ParseIPRanges(%q) accepted an invalid entry", bad)
+		}
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"database/sql"
 	_ "embed"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
+	"ezweb/internal/logging"
+
 	_ "modernc.org/sqlite"
 )
 
@@ -14,47 +17,82 @@ import (
 var schema string
 
 func Open(dbPath string, maxOpenConns, maxIdleConns int) (*sql.DB, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	// Pragmas go in the DSN so every pooled connection gets them, not just
+	// the one that happens to run a PRAGMA statement. WAL mode gives better
+	// concurrent read/write performance, and busy_timeout waits up to 5s for
+	// locks instead of failing immediately with SQLITE_BUSY.
+	dsn := "file:" + (&url.URL{Path: dbPath}).EscapedPath() +
+		"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-
-	// Enable WAL mode for better concurrent read/write performance
-	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+	if err := db.Ping(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to enable WAL mode: %w", err)
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	// Wait up to 5s for locks instead of failing immediately with SQLITE_BUSY
-	if _, err := db.Exec("PRAGMA busy_timeout = 5000"); err != nil {
+	// Connection pool tuning for SQLite
+	db.SetMaxOpenConns(maxOpenConns)
+	db.SetMaxIdleConns(maxIdleConns)
+	db.SetConnMaxLifetime(5 * time.Minute)
+
+	if err := Migrate(db); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to set busy_timeout: %w", err)
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// OpenReadOnly opens a second, read-only handle on a database that Open has
+// already created, for long read paths (the health checker's site scan, the
+// dashboard aggregates) that should not hold connections the write path
+// needs. SQLite allows it because the database is in WAL mode: readers never
+// block the writer and the writer never blocks readers.
+//
+// Every statement on this handle reads a snapshot taken when it starts, so
+// it sees all writes committed through the main handle before then and none
+// made while it runs. Two queries issued one after the other may therefore
+// see different snapshots, as they already could on the main pool. A very
+// long read also stops checkpoints from getting past its snapshot, so the
+// -wal file grows until it finishes.
+func OpenReadOnly(dbPath string, maxOpenConns int) (*sql.DB, error) {
+	// Pragmas go in the DSN so every pooled connection gets them, not just
+	// the first. query_only guards against a write slipping through.
+	dsn := "file:" + (&url.URL{Path: dbPath}).EscapedPath() +
+		"?mode=ro&_pragma=busy_timeout(5000)&_pragma=query_only(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open read-only database: %w", err)
 	}
-	if _, err := db.Exec("PRAGMA foreign_keys = ON"); err != nil {
+	if err := db.Ping(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to enable foreign keys: %w", err)
+		return nil, fmt.Errorf("failed to open read-only database: %w", err)
 	}
 
-	// Connection pool tuning for SQLite
 	db.SetMaxOpenConns(maxOpenConns)
-	db.SetMaxIdleConns(maxIdleConns)
+	db.SetMaxIdleConns(maxOpenConns)
 	db.SetConnMaxLifetime(5 * time.Minute)
+	return db, nil
+}
 
+// Migrate brings an open database up to the current schema. Open calls it;
+// it is also run after a backup is restored into a live database, since the
+// backup may predate later columns.
+func Migrate(db *sql.DB) error {
 	// Execute the embedded schema
 	if _, err := db.Exec(schema); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to execute schema: %w", err)
+		return fmt.Errorf("failed to execute schema: %w", err)
 	}
 
 	// Apply incremental column additions for existing databases. SQLite has no
 	// "ADD COLUMN IF NOT EXISTS", so we attempt the ALTER and ignore the error
 	// when the column already exists (duplicate column error).
 	if err := migrateSchema(db); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to migrate schema: %w", err)
+		return fmt.Errorf("failed to migrate schema: %w", err)
 	}
-
-	return db, nil
+	return nil
 }
 
 // migrateSchema applies additive schema changes that cannot be expressed as
@@ -68,6 +106,35 @@ func migrateSchema(db *sql.DB) error {
 		"ALTER TABLE activity_log ADD COLUMN user_agent TEXT",
 		"ALTER TABLE users ADD COLUMN totp_secret TEXT",
 		"ALTER TABLE users ADD COLUMN totp_enabled INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE sites ADD COLUMN deploy_timeout_sec INTEGER",
+		"ALTER TABLE sites ADD COLUMN last_deployed_at DATETIME",
+		"ALTER TABLE sites ADD COLUMN health_check_method TEXT",
+		"ALTER TABLE sites ADD COLUMN health_check_expect TEXT",
+		"ALTER TABLE servers ADD COLUMN deploy_path TEXT",
+		"ALTER TABLE health_checks ADD COLUMN restart_count INTEGER",
+		"ALTER TABLE health_checks ADD COLUMN container_started_at TEXT",
+		"ALTER TABLE sites ADD COLUMN maintenance INTEGER DEFAULT 0",
+		"ALTER TABLE sites ADD COLUMN deleted_at DATETIME",
+		"ALTER TABLE servers ADD COLUMN tags TEXT",
+		"ALTER TABLE payments ADD COLUMN recurrence TEXT DEFAULT 'none'",
+		"ALTER TABLE payments ADD COLUMN next_payment_id INTEGER",
+		"ALTER TABLE payments ADD COLUMN anchor_day INTEGER",
+		"ALTER TABLE sites ADD COLUMN quiet_hours TEXT",
+		"ALTER TABLE sites ADD COLUMN quiet_hours_tz TEXT",
+		"ALTER TABLE sites ADD COLUMN health_check_insecure INTEGER DEFAULT 0",
+		"ALTER TABLE sites ADD COLUMN health_check_no_redirect INTEGER DEFAULT 0",
+		"ALTER TABLE site_env_vars ADD COLUMN is_secret INTEGER DEFAULT 0",
+		"ALTER TABLE sites ADD COLUMN container_image TEXT",
+		"ALTER TABLE sites ADD COLUMN drained TEXT",
+		"ALTER TABLE sites ADD COLUMN compose_services TEXT",
+		"ALTER TABLE health_checks ADD COLUMN service_status TEXT",
+		"ALTER TABLE health_checks ADD COLUMN services_down INTEGER DEFAULT 0",
+		"ALTER TABLE servers ADD COLUMN deploy_mode TEXT DEFAULT 'compose'",
+		"ALTER TABLE servers ADD COLUMN docker_sudo INTEGER DEFAULT 0",
+		"ALTER TABLE site_templates ADD COLUMN compose TEXT",
+		"ALTER TABLE sites ADD COLUMN git_url TEXT",
+		"ALTER TABLE sites ADD COLUMN git_branch TEXT",
+		"ALTER TABLE sites ADD COLUMN git_key_path TEXT",
 	}
 	for _, stmt := range alterations {
 		if _, err := db.Exec(stmt); err != nil {
@@ -78,9 +145,101 @@ func migrateSchema(db *sql.DB) error {
 			}
 		}
 	}
+	if err := addHealthCheckVerdict(db); err != nil {
+		return err
+	}
+	return ensureUniqueContainerNames(db)
+}
+
+// addHealthCheckVerdict adds health_checks.is_up, the checker's verdict on
+// each check. Rows from before it existed get the verdict their stored
+// fields imply, the rule the queries applied until then.
+func addHealthCheckVerdict(db *sql.DB) error {
+	if _, err := db.Exec("ALTER TABLE health_checks ADD COLUMN is_up INTEGER"); err != nil {
+		if isDuplicateColumnError(err) {
+			return nil
+		}
+		return fmt.Errorf("migration failed (add health_checks.is_up): %w", err)
+	}
+	_, err := db.Exec(`UPDATE health_checks SET is_up =
+		(http_status BETWEEN 1 AND 399 AND COALESCE(container_status,'') NOT IN ('not_found','exited') AND COALESCE(services_down,0) = 0)`)
+	if err != nil {
+		return fmt.Errorf("failed to backfill health check verdicts: %w", err)
+	}
+	return nil
+}
+
+// ensureUniqueContainerNames adds the unique index on sites.container_name.
+// It is not in schema.sql because databases from before the index existed may
+// already contain duplicates, which would make CREATE INDEX fail. Those are
+// renamed first: the oldest site keeps the name and each later one gets the
+// smallest free "-2", "-3", ... suffix, the same rule FreeContainerName
+// applies to new sites. Renamed sites need a redeploy to pick up the name.
+func ensureUniqueContainerNames(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id, container_name FROM sites
+		WHERE container_name IN (SELECT container_name FROM sites
+			WHERE container_name IS NOT NULL AND container_name != ''
+			GROUP BY container_name HAVING COUNT(*) > 1)
+		ORDER BY container_name, id`)
+	if err != nil {
+		return fmt.Errorf("failed to check for duplicate container names: %w", err)
+	}
+	type site struct {
+		id   int
+		name string
+	}
+	var dupes []site
+	for rows.Next() {
+		var s site
+		if err := rows.Scan(&s.id, &s.name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan container name: %w", err)
+		}
+		dupes = append(dupes, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to check for duplicate container names: %w", err)
+	}
+
+	for i, s := range dupes {
+		if i == 0 || dupes[i-1].name != s.name {
+			continue // the oldest site keeps the name
+		}
+		name, err := freeContainerName(db, s.name)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec("UPDATE sites SET container_name = ? WHERE id = ?", name, s.id); err != nil {
+			return fmt.Errorf("failed to rename container of site %d: %w", s.id, err)
+		}
+		logging.Warnf("site %d shared container name %s; renamed it to %s — redeploy the site to apply", s.id, s.name, name)
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_sites_container_name_unique
+		ON sites(container_name) WHERE container_name IS NOT NULL AND container_name != ''`)
+	if err != nil {
+		return fmt.Errorf("failed to create container name index: %w", err)
+	}
 	return nil
 }
 
+// freeContainerName returns base with the smallest numeric suffix that no
+// site uses.
+func freeContainerName(db *sql.DB, base string) (string, error) {
+	for i := 2; i <= 100; i++ {
+		name := fmt.Sprintf("%s-%d", base, i)
+		var n int
+		if err := db.QueryRow("SELECT COUNT(*) FROM sites WHERE container_name = ?", name).Scan(&n); err != nil {
+			return "", fmt.Errorf("failed to check container name: %w", err)
+		}
+		if n == 0 {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no free container name for %s", base)
+}
+
 func isDuplicateColumnError(err error) bool {
 	if err == nil {
 		return false
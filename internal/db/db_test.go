@@ -0,0 +1,125 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ezweb.db")
+	rw, err := Open(path, 1, 1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer rw.Close()
+
+	ro, err := OpenReadOnly(path, 2)
+	if err != nil {
+		t.Fatalf("OpenReadOnly: %v", err)
+	}
+	defer ro.Close()
+
+	if _, err := rw.Exec("INSERT INTO customers (name) VALUES ('Acme')"); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := ro.QueryRow("SELECT COUNT(*) FROM customers").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("read-only handle sees %d customers, want the committed 1", n)
+	}
+
+	if _, err := ro.Exec("DELETE FROM customers"); err == nil {
+		t.Error("write through the read-only handle succeeded")
+	}
+}
+
+func TestMigrate_BackfillsHealthCheckVerdict(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// Recreate a database from before the verdict was stored.
+	if _, err := db.Exec("ALTER TABLE health_checks DROP COLUMN is_up"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO sites (domain, container_name, port) VALUES ('a.example.com', 'a', 8080)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO health_checks (site_id, http_status, container_status, services_down) VALUES
+		(1, 200, 'running', 0), (1, 502, 'running', 0), (1, 200, 'exited', 0), (1, 200, 'running', 1)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	rows, err := db.Query("SELECT is_up FROM health_checks ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []bool
+	for rows.Next() {
+		var up bool
+		if err := rows.Scan(&up); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, up)
+	}
+	if want := []bool{true, false, false, false}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("backfilled is_up = %v, want %v", got, want)
+	}
+}
+
+func TestMigrate_RenamesDuplicateContainerNames(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+
+	// Recreate a database from before container names had to be unique.
+	if _, err := db.Exec("DROP INDEX idx_sites_container_name_unique"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO sites (domain, container_name, port) VALUES
+		('a.example.com', 'shop', 8080),
+		('b.example.com', 'shop', 8081),
+		('c.example.com', 'shop-2', 8082),
+		('d.example.com', 'shop', 8083),
+		('e.example.com', 'blog', 8084),
+		('f.example.com', '', 8085),
+		('g.example.com', '', 8086)`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	rows, err := db.Query("SELECT container_name FROM sites ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, name)
+	}
+	want := []string{"shop", "shop-3", "shop-2", "shop-4", "blog", "", ""}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("container names = %q, want %q", got, want)
+	}
+
+	if _, err := db.Exec("INSERT INTO sites (domain, container_name, port) VALUES ('h.example.com', 'blog', 8087)"); err == nil {
+		t.Error("duplicate container name inserted after Migrate; want the unique index to refuse it")
+	}
+}
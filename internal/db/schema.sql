@@ -15,15 +15,22 @@ CREATE TABLE IF NOT EXISTS servers (
     ssh_key_path TEXT NOT NULL,
     status TEXT DEFAULT 'unknown',
     ssh_host_key TEXT,
+    deploy_path TEXT,
+    tags TEXT,
+    deploy_mode TEXT DEFAULT 'compose',
+    docker_sudo INTEGER DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- compose is the template's compose file when it was added or edited from
+-- the templates page; NULL uses the one built into the binary.
 CREATE TABLE IF NOT EXISTS site_templates (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     slug TEXT NOT NULL UNIQUE,
     label TEXT NOT NULL,
     description TEXT,
+    compose TEXT,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -51,6 +58,22 @@ CREATE TABLE IF NOT EXISTS sites (
     compose_path TEXT,
     routing_config TEXT,
     ssl_expiry DATETIME,
+    deploy_timeout_sec INTEGER,
+    last_deployed_at DATETIME,
+    health_check_method TEXT,
+    health_check_expect TEXT,
+    maintenance INTEGER DEFAULT 0,
+    quiet_hours TEXT,
+    quiet_hours_tz TEXT,
+    health_check_insecure INTEGER DEFAULT 0,
+    health_check_no_redirect INTEGER DEFAULT 0,
+    container_image TEXT,
+    drained TEXT,
+    compose_services TEXT,
+    git_url TEXT,
+    git_branch TEXT,
+    git_key_path TEXT,
+    deleted_at DATETIME,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
@@ -64,6 +87,9 @@ CREATE TABLE IF NOT EXISTS payments (
     paid_at DATETIME,
     status TEXT DEFAULT 'pending',
     notes TEXT,
+    recurrence TEXT DEFAULT 'none',
+    next_payment_id INTEGER,
+    anchor_day INTEGER,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -72,6 +98,7 @@ CREATE TABLE IF NOT EXISTS site_env_vars (
     site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
     key TEXT NOT NULL,
     value TEXT NOT NULL,
+    is_secret INTEGER DEFAULT 0,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     UNIQUE(site_id, key)
 );
@@ -84,9 +111,31 @@ CREATE TABLE IF NOT EXISTS health_checks (
     http_status INTEGER,
     latency_ms INTEGER,
     container_status TEXT,
+    restart_count INTEGER,
+    container_started_at TEXT,
+    service_status TEXT,
+    services_down INTEGER DEFAULT 0,
+    is_up INTEGER,
     checked_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
+-- One row per deploy or rollback of a site. compose holds the file that was
+-- uploaded; it is cleared on all but the newest rows of each site to bound
+-- the table's size (see models.DeployHistoryKeep).
+CREATE TABLE IF NOT EXISTS deployments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    site_id INTEGER NOT NULL REFERENCES sites(id) ON DELETE CASCADE,
+    username TEXT,
+    template_slug TEXT,
+    compose TEXT,
+    status TEXT NOT NULL,
+    error TEXT,
+    rollback_of INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_deployments_site_id ON deployments(site_id);
+
 CREATE TABLE IF NOT EXISTS activity_log (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
     entity_type TEXT NOT NULL,
@@ -113,6 +162,44 @@ CREATE TABLE IF NOT EXISTS revoked_tokens (
 
 CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_at);
 
+-- Refresh tokens are recorded by JTI so they can be rotated and revoked.
+-- rotated_at is set when a token is exchanged for a new one.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at DATETIME NOT NULL,
+    rotated_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires ON refresh_tokens(expires_at);
+
+-- Last request of each login session, for SESSION_IDLE_MINUTES. A session
+-- spans every access and refresh token issued from one login. expires_at is
+-- when the session would be idle, after which the row can be dropped.
+CREATE TABLE IF NOT EXISTS session_activity (
+    session_id TEXT PRIMARY KEY,
+    last_seen_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_session_activity_expires ON session_activity(expires_at);
+
+-- Long-lived API tokens for scripts and external monitors. Only the SHA-256
+-- hash of a token is stored. role is capped by the owner's role at use.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    role TEXT NOT NULL DEFAULT 'viewer',
+    last_used_at DATETIME,
+    revoked_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens(user_id);
+
 -- Add ip_address and user_agent to activity_log if upgrading from an older schema.
 -- SQLite does not support ADD COLUMN IF NOT EXISTS, so we ignore the error
 -- if the column already exists (handled by the Go migration code).
@@ -120,6 +207,7 @@ CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires ON revoked_tokens(expires_
 CREATE INDEX IF NOT EXISTS idx_activity_log_created_at ON activity_log(created_at);
 CREATE INDEX IF NOT EXISTS idx_activity_log_entity ON activity_log(entity_type, entity_id);
 CREATE INDEX IF NOT EXISTS idx_activity_log_entity_time ON activity_log(entity_type, entity_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_activity_log_entity_id_time ON activity_log(entity_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_sites_domain ON sites(domain);
 
 CREATE TABLE IF NOT EXISTS totp_used_codes (
@@ -292,6 +380,20 @@ CREATE TABLE IF NOT EXISTS client_tokens (
 CREATE INDEX IF NOT EXISTS idx_client_tokens_hash ON client_tokens(token_hash);
 CREATE INDEX IF NOT EXISTS idx_client_tokens_expires ON client_tokens(expires_at);
 
+-- Read-only portal links handed to customers, one row per link. Only the
+-- SHA-256 of the token is stored; revoking a link deletes its row.
+CREATE TABLE IF NOT EXISTS portal_access_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_id INTEGER NOT NULL REFERENCES customers(id) ON DELETE CASCADE,
+    token_hash TEXT NOT NULL UNIQUE,
+    token_prefix TEXT NOT NULL,
+    created_by TEXT,
+    last_used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_portal_access_tokens_customer ON portal_access_tokens(customer_id);
+
 -- Portfolio items for client portal
 CREATE TABLE IF NOT EXISTS portfolio_items (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -2,17 +2,27 @@ package docker
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"os"
+	"path"
 	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"text/template"
+	"text/template/parse"
+	"time"
 
 	"ezweb/internal/templates"
 
 	sshutil "ezweb/internal/ssh"
 
 	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
 )
 
 // containerNameRe matches valid container names: starts with an alphanumeric
@@ -33,6 +43,47 @@ func ValidateContainerName(name string) error {
 	return nil
 }
 
+// DefaultRemoteBasePath is the directory on remote servers under which each
+// site gets a <container name> subdirectory holding its compose files.
+const DefaultRemoteBasePath = "/opt/ezweb"
+
+// remoteBasePathRe allows only characters that are safe to interpolate into
+// a shell command unquoted.
+var remoteBasePathRe = regexp.MustCompile(`^/[a-zA-Z0-9_.\-/]*$`)
+
+// ValidateRemoteBasePath returns an error unless p is an absolute, clean
+// path made of alphanumerics, underscores, dots, hyphens, and slashes. The
+// path is interpolated into remote shell commands, so anything else is
+// refused. An empty path is valid and means DefaultRemoteBasePath.
+func ValidateRemoteBasePath(p string) error {
+	if p == "" {
+		return nil
+	}
+	if !remoteBasePathRe.MatchString(p) {
+		return fmt.Errorf("invalid remote path %q: must be absolute and contain only alphanumerics, underscores, dots, hyphens, and slashes", p)
+	}
+	if p == "/" || path.Clean(p) != p {
+		return fmt.Errorf("invalid remote path %q: must be a clean path below /, without trailing slashes or .. segments", p)
+	}
+	return nil
+}
+
+// RemoteSiteDir returns the directory holding a site's compose files on a
+// remote server, after validating both components. An empty basePath means
+// DefaultRemoteBasePath.
+func RemoteSiteDir(basePath, containerName string) (string, error) {
+	if err := ValidateContainerName(containerName); err != nil {
+		return "", err
+	}
+	if err := ValidateRemoteBasePath(basePath); err != nil {
+		return "", err
+	}
+	if basePath == "" {
+		basePath = DefaultRemoteBasePath
+	}
+	return path.Join(basePath, containerName), nil
+}
+
 // ComposeVars holds the variables injected into Docker Compose templates.
 type ComposeVars struct {
 	ContainerName  string
@@ -40,6 +91,10 @@ type ComposeVars struct {
 	Domain         string
 	DBPassword     string
 	DBRootPassword string
+	// Extra holds user-provided variables, referenced in templates as
+	// {{ .Extra.IMAGE_TAG }}. Referencing one that is not set fails the
+	// render rather than leaving "<no value>" in the file.
+	Extra map[string]string
 }
 
 // RenderCompose loads the embedded compose template for the given slug
@@ -49,8 +104,11 @@ func RenderCompose(templateSlug string, vars ComposeVars) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("failed to load compose template %q: %w", templateSlug, err)
 	}
+	return renderComposeTemplate(templateSlug, tmplContent, vars)
+}
 
-	tmpl, err := template.New(templateSlug).Parse(tmplContent)
+func renderComposeTemplate(templateSlug, tmplContent string, vars ComposeVars) (string, error) {
+	tmpl, err := template.New(templateSlug).Option("missingkey=error").Parse(tmplContent)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse compose template %q: %w", templateSlug, err)
 	}
@@ -63,6 +121,170 @@ func RenderCompose(templateSlug string, vars ComposeVars) (string, error) {
 	return buf.String(), nil
 }
 
+// composeFields are the ComposeVars fields a compose template may use.
+var composeFields = []string{"ContainerName", "Port", "Domain", "DBPassword", "DBRootPassword", "Extra"}
+
+// ValidateComposeTemplate checks that content parses as a compose template
+// and only uses the fields of ComposeVars: {{.Port}}, {{.Extra.NAME}} and
+// so on. Fields are checked by name wherever they appear, so one read from
+// inside a range or with block must still be a ComposeVars field.
+func ValidateComposeTemplate(content string) error {
+	if strings.TrimSpace(content) == "" {
+		return fmt.Errorf("compose template is empty")
+	}
+	tmpl, err := template.New("compose").Option("missingkey=error").Parse(content)
+	if err != nil {
+		return err
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		if err := checkTemplateFields(t.Tree.Root); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkTemplateFields walks a parsed template and rejects any field that is
+// not in composeFields. Extra is the only field with fields of its own.
+func checkTemplateFields(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkTemplateFields(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkTemplateFields(n.Pipe)
+	case *parse.IfNode:
+		return checkBranchFields(&n.BranchNode)
+	case *parse.RangeNode:
+		return checkBranchFields(&n.BranchNode)
+	case *parse.WithNode:
+		return checkBranchFields(&n.BranchNode)
+	case *parse.TemplateNode:
+		return checkTemplateFields(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := checkTemplateFields(arg); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.FieldNode:
+		return checkFieldPath(n.Ident)
+	case *parse.VariableNode:
+		// $ is the top-level ComposeVars; other variables are set inside
+		// the template and their fields cannot be checked here.
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			return checkFieldPath(n.Ident[1:])
+		}
+	case *parse.ChainNode:
+		if err := checkTemplateFields(n.Node); err != nil {
+			return err
+		}
+		return fmt.Errorf("compose template uses (...).%s; use the fields of ComposeVars directly", strings.Join(n.Field, "."))
+	}
+	return nil
+}
+
+func checkBranchFields(n *parse.BranchNode) error {
+	for _, child := range []parse.Node{n.Pipe, n.List, n.ElseList} {
+		if err := checkTemplateFields(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkFieldPath(ident []string) error {
+	ok := slices.Contains(composeFields, ident[0]) &&
+		(len(ident) == 1 || (ident[0] == "Extra" && len(ident) == 2))
+	if !ok {
+		return fmt.Errorf("compose template uses .%s, which is not a template variable", strings.Join(ident, "."))
+	}
+	return nil
+}
+
+// RenderSiteCompose renders a site's compose file as a deploy uploads it,
+// with freshly generated database passwords. extra becomes ComposeVars.Extra.
+func RenderSiteCompose(templateSlug, containerName, domain string, sitePort int, extra map[string]string) (string, error) {
+	rendered, _, err := renderSiteCompose(templateSlug, containerName, domain, sitePort, extra)
+	return rendered, err
+}
+
+// MaskedSecret stands in for generated secrets in a compose preview.
+const MaskedSecret = "********"
+
+// PreviewSiteCompose renders a site's compose file as RenderSiteCompose does,
+// along with a mask function that replaces the generated passwords with
+// MaskedSecret in the file or in anything derived from it, for showing to a
+// user. The unmasked file is for validation only; a deploy generates new
+// passwords.
+func PreviewSiteCompose(templateSlug, containerName, domain string, sitePort int, extra map[string]string) (rendered string, mask func(string) string, err error) {
+	rendered, vars, err := renderSiteCompose(templateSlug, containerName, domain, sitePort, extra)
+	if err != nil {
+		return "", nil, err
+	}
+	return rendered, strings.NewReplacer(vars.DBPassword, MaskedSecret, vars.DBRootPassword, MaskedSecret).Replace, nil
+}
+
+func renderSiteCompose(templateSlug, containerName, domain string, sitePort int, extra map[string]string) (string, ComposeVars, error) {
+	vars := ComposeVars{
+		ContainerName:  containerName,
+		Port:           sitePort,
+		Domain:         domain,
+		DBPassword:     generatePassword(16),
+		DBRootPassword: generatePassword(20),
+		Extra:          extra,
+	}
+	rendered, err := RenderCompose(templateSlug, vars)
+	if err != nil {
+		return "", vars, fmt.Errorf("failed to render compose for %s: %w", containerName, err)
+	}
+	return rendered, vars, nil
+}
+
+// composeValidateTimeout bounds ValidateComposeRemote.
+const composeValidateTimeout = 30 * time.Second
+
+// ValidateComposeRemote runs "docker compose config" on the server against
+// rendered, which is passed on stdin so nothing in the site's directory is
+// touched. The site's .env is not available there, so variables it would
+// set are reported as unset, which compose only warns about. The returned
+// output explains what is wrong when the file is rejected.
+func ValidateComposeRemote(host string, port int, user string, keyPath string, hostKey string, sudo bool, containerName string, rendered string) (string, error) {
+	if err := ValidateContainerName(containerName); err != nil {
+		return "", err
+	}
+
+	sshClient, err := sshutil.NewClientWithHostKey(host, port, user, keyPath, hostKey)
+	if err != nil {
+		return "", fmt.Errorf("SSH connect failed for %s:%d: %w", host, port, err)
+	}
+	defer sshClient.Close()
+
+	timer := time.AfterFunc(composeValidateTimeout, func() { sshClient.Close() })
+	defer timer.Stop()
+
+	out, err := sshutil.RunCommandInput(sshClient,
+		fmt.Sprintf("%s compose -p %s -f - config --quiet", sshutil.Docker(sudo), containerName), strings.NewReader(rendered))
+	if err != nil {
+		return out, fmt.Errorf("docker compose config failed for %s: %w", containerName, err)
+	}
+	return out, nil
+}
+
 // generatePassword creates a random hex string of the specified length.
 func generatePassword(length int) string {
 	b := make([]byte, length)
@@ -70,25 +292,72 @@ func generatePassword(length int) string {
 	return hex.EncodeToString(b)[:length]
 }
 
+// DeployOptions adjusts how a deploy starts the site containers.
+type DeployOptions struct {
+	// Pull runs "docker compose pull" before "up -d", so a new image pushed
+	// under an existing tag is fetched instead of the cached one being reused.
+	Pull bool
+	// Progress, when set, receives the pull output as it is produced.
+	Progress io.Writer
+	// Compose, when set, is uploaded as the compose file instead of a fresh
+	// render of the template. Callers that record what they deployed render
+	// it with RenderSiteCompose first; a rollback passes an earlier file.
+	Compose string
+	// Remote is how the server runs docker. In DeployModeSwarm the compose
+	// file is deployed as a stack, and Pull is ignored because stack deploy
+	// resolves each image tag against its registry anyway.
+	Remote Remote
+	// Git, when set, deploys the site from a repository: its branch is
+	// checked out in the site directory and the compose file there is used,
+	// so nothing is rendered or uploaded but the .env. The git output goes
+	// to Progress.
+	Git *GitSource
+}
+
 // DeploySite renders a compose template, uploads it to the remote server via
 // SFTP, and runs docker compose up to start the site containers. If envContent
 // is non-empty, it is written as a .env file alongside the compose file.
-func DeploySite(host string, port int, user string, keyPath string, hostKey string, domain string, templateSlug string, containerName string, sitePort int, envContent ...string) error {
-	if err := ValidateContainerName(containerName); err != nil {
+//
+// timeout bounds the whole deploy, including the optional pull and "docker
+// compose up" (which is where missing images are pulled). When it elapses the
+// SSH session is closed and an error is returned. A timeout of zero means no
+// limit.
+func DeploySite(timeout time.Duration, host string, port int, user string, keyPath string, hostKey string, basePath string, domain string, templateSlug string, containerName string, sitePort int, envContent ...string) error {
+	return DeploySiteContext(context.Background(), timeout, DeployOptions{}, host, port, user, keyPath, hostKey, basePath, domain, templateSlug, containerName, sitePort, envContent...)
+}
+
+// DeploySiteContext is DeploySite with cancellation and options. Cancelling
+// ctx aborts the deploy while it is still connecting, uploading files or
+// pulling images (the SSH session is closed). Once "docker compose up" has
+// started the deploy is past the point of no return and only the timeout can
+// stop it, so a viewer going away never leaves containers half-created.
+func DeploySiteContext(ctx context.Context, timeout time.Duration, opts DeployOptions, host string, port int, user string, keyPath string, hostKey string, basePath string, domain string, templateSlug string, containerName string, sitePort int, envContent ...string) error {
+	remotePath, err := RemoteSiteDir(basePath, containerName)
+	if err != nil {
 		return err
 	}
 
-	vars := ComposeVars{
-		ContainerName:  containerName,
-		Port:           sitePort,
-		Domain:         domain,
-		DBPassword:     generatePassword(16),
-		DBRootPassword: generatePassword(20),
+	rendered := opts.Compose
+	if rendered == "" && opts.Git == nil {
+		if rendered, err = RenderSiteCompose(templateSlug, containerName, domain, sitePort, nil); err != nil {
+			return err
+		}
 	}
 
-	rendered, err := RenderCompose(templateSlug, vars)
-	if err != nil {
-		return fmt.Errorf("failed to render compose for %s: %w", containerName, err)
+	var deployKey []byte
+	if opts.Git != nil {
+		if err := ValidateGitSource(*opts.Git); err != nil {
+			return err
+		}
+		if opts.Git.KeyPath != "" {
+			if deployKey, err = os.ReadFile(opts.Git.KeyPath); err != nil {
+				return fmt.Errorf("failed to read deploy key: %w", err)
+			}
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("deploy of %s cancelled before connecting: %w", containerName, err)
 	}
 
 	sshClient, err := sshutil.NewClientWithHostKey(host, port, user, keyPath, hostKey)
@@ -97,90 +366,153 @@ func DeploySite(host string, port int, user string, keyPath string, hostKey stri
 	}
 	defer sshClient.Close()
 
-	remotePath := fmt.Sprintf("/opt/ezweb/%s", containerName)
+	var timedOut atomic.Bool
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			timedOut.Store(true)
+			sshClient.Close()
+		})
+		defer timer.Stop()
+	}
+
+	// Until compose up starts, cancelling ctx tears down the SSH session so any
+	// in-flight command or SFTP write fails promptly.
+	stopWatch := context.AfterFunc(ctx, func() { sshClient.Close() })
+	defer stopWatch()
+
+	// beforeUp reports a failure from before compose up. When ctx was
+	// cancelled, closing the session is what made the step fail, so the
+	// error says so and wraps ctx.Err() for callers checking for it.
+	beforeUp := func(err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil && !timedOut.Load() {
+			return fmt.Errorf("deploy of %s cancelled before compose up (%v): %w", containerName, err, ctxErr)
+		}
+		return err
+	}
+
 	if _, err := sshutil.RunCommand(sshClient, fmt.Sprintf("mkdir -p %s", remotePath)); err != nil {
-		return fmt.Errorf("failed to create remote directory %s: %w", remotePath, err)
+		return beforeUp(fmt.Errorf("failed to create remote directory %s: %w", remotePath, err))
 	}
 
 	sftpClient, err := sftp.NewClient(sshClient)
 	if err != nil {
-		return fmt.Errorf("failed to create SFTP session: %w", err)
+		return beforeUp(fmt.Errorf("failed to create SFTP session: %w", err))
 	}
 	defer sftpClient.Close()
 
-	composeFile := fmt.Sprintf("%s/docker-compose.yml", remotePath)
-	f, err := sftpClient.Create(composeFile)
-	if err != nil {
-		return fmt.Errorf("failed to create remote file %s: %w", composeFile, err)
+	progress := opts.Progress
+	if progress == nil {
+		progress = io.Discard
 	}
-	if _, err := f.Write([]byte(rendered)); err != nil {
+
+	if opts.Git != nil {
+		if err := syncGitSource(sshClient, sftpClient, *opts.Git, deployKey, remotePath, progress); err != nil {
+			if timedOut.Load() {
+				return fmt.Errorf("deploy of %s timed out after %s while fetching from git", containerName, timeout)
+			}
+			if ctx.Err() != nil {
+				return fmt.Errorf("deploy of %s cancelled while fetching from git: %w", containerName, ctx.Err())
+			}
+			return fmt.Errorf("git checkout failed for %s: %w", containerName, err)
+		}
+	} else {
+		composeFile := fmt.Sprintf("%s/docker-compose.yml", remotePath)
+		f, err := sftpClient.Create(composeFile)
+		if err != nil {
+			return beforeUp(fmt.Errorf("failed to create remote file %s: %w", composeFile, err))
+		}
+		if _, err := f.Write([]byte(rendered)); err != nil {
+			f.Close()
+			return beforeUp(fmt.Errorf("failed to write compose file: %w", err))
+		}
 		f.Close()
-		return fmt.Errorf("failed to write compose file: %w", err)
 	}
-	f.Close()
 
 	// Upload .env file if env vars are provided
 	if len(envContent) > 0 && envContent[0] != "" {
 		envFile := fmt.Sprintf("%s/.env", remotePath)
 		ef, err := sftpClient.Create(envFile)
 		if err != nil {
-			return fmt.Errorf("failed to create remote .env file: %w", err)
+			return beforeUp(fmt.Errorf("failed to create remote .env file: %w", err))
 		}
 		if _, err := ef.Write([]byte(envContent[0])); err != nil {
 			ef.Close()
-			return fmt.Errorf("failed to write .env file: %w", err)
+			return beforeUp(fmt.Errorf("failed to write .env file: %w", err))
 		}
 		ef.Close()
 	}
 
-	if _, err := sshutil.RunCommand(sshClient, fmt.Sprintf("cd %s && docker compose up -d", remotePath)); err != nil {
-		return fmt.Errorf("docker compose up failed for %s: %w", containerName, err)
+	// Pulling only replaces images, not containers, so it can still be
+	// cancelled.
+	if opts.Pull && opts.Remote.Mode != DeployModeSwarm {
+		if err := sshutil.RunCommandStream(sshClient, fmt.Sprintf("cd %s && %s compose pull", remotePath, opts.Remote.Docker()), progress); err != nil {
+			if timedOut.Load() {
+				return fmt.Errorf("deploy of %s timed out after %s while pulling images", containerName, timeout)
+			}
+			if ctx.Err() != nil {
+				return fmt.Errorf("deploy of %s cancelled while pulling images: %w", containerName, ctx.Err())
+			}
+			return fmt.Errorf("docker compose pull failed for %s: %w", containerName, err)
+		}
 	}
 
-	return nil
-}
-
-// StopSiteRemote stops the site containers on a remote server.
-func StopSiteRemote(host string, port int, user string, keyPath string, hostKey string, containerName string) error {
-	if err := ValidateContainerName(containerName); err != nil {
-		return err
+	// Point of no return: detach from ctx before starting the containers. If
+	// the watcher already fired the session is closed and we must stop here.
+	if !stopWatch() {
+		return fmt.Errorf("deploy of %s cancelled before compose up: %w", containerName, ctx.Err())
 	}
 
-	sshClient, err := sshutil.NewClientWithHostKey(host, port, user, keyPath, hostKey)
-	if err != nil {
-		return fmt.Errorf("SSH connect failed: %w", err)
+	if _, err := sshutil.RunCommand(sshClient, remoteSiteCommand(opts.Remote, actionUp, remotePath, containerName)); err != nil {
+		if timedOut.Load() {
+			return fmt.Errorf("deploy of %s timed out after %s", containerName, timeout)
+		}
+		if opts.Remote.Mode == DeployModeSwarm {
+			return fmt.Errorf("docker stack deploy failed for %s: %w", containerName, err)
+		}
+		return fmt.Errorf("docker compose up failed for %s: %w", containerName, err)
 	}
-	defer sshClient.Close()
 
-	remotePath := fmt.Sprintf("/opt/ezweb/%s", containerName)
-	if _, err := sshutil.RunCommand(sshClient, fmt.Sprintf("cd %s && docker compose stop", remotePath)); err != nil {
-		return fmt.Errorf("docker compose stop failed for %s: %w", containerName, err)
-	}
 	return nil
 }
 
-// StartSiteRemote starts the site containers on a remote server.
-func StartSiteRemote(host string, port int, user string, keyPath string, hostKey string, containerName string) error {
-	if err := ValidateContainerName(containerName); err != nil {
-		return err
+// syncGitSource checks out the latest commit of g's branch in remotePath,
+// writing git's output to w. A deploy key is uploaded for the fetch and
+// removed again whether or not it succeeds.
+func syncGitSource(sshClient *ssh.Client, sftpClient *sftp.Client, g GitSource, deployKey []byte, remotePath string, w io.Writer) error {
+	if out, err := sshutil.RunCommand(sshClient, gitInitCommand(remotePath)); err != nil {
+		return fmt.Errorf("git init failed (is git installed on the server?): %s: %w", out, err)
 	}
 
-	sshClient, err := sshutil.NewClientWithHostKey(host, port, user, keyPath, hostKey)
-	if err != nil {
-		return fmt.Errorf("SSH connect failed: %w", err)
+	var keyFile string
+	if len(deployKey) > 0 {
+		keyFile = path.Join(remotePath, gitKeyFile)
+		kf, err := sftpClient.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+		if err != nil {
+			return fmt.Errorf("failed to create deploy key file: %w", err)
+		}
+		// ssh refuses a key that others can read.
+		if err := kf.Chmod(0o600); err != nil {
+			kf.Close()
+			_ = sftpClient.Remove(keyFile)
+			return fmt.Errorf("failed to restrict deploy key file: %w", err)
+		}
+		if _, err := kf.Write(deployKey); err != nil {
+			kf.Close()
+			_ = sftpClient.Remove(keyFile)
+			return fmt.Errorf("failed to write deploy key: %w", err)
+		}
+		kf.Close()
+		defer sftpClient.Remove(keyFile)
 	}
-	defer sshClient.Close()
 
-	remotePath := fmt.Sprintf("/opt/ezweb/%s", containerName)
-	if _, err := sshutil.RunCommand(sshClient, fmt.Sprintf("cd %s && docker compose start", remotePath)); err != nil {
-		return fmt.Errorf("docker compose start failed for %s: %w", containerName, err)
-	}
-	return nil
+	return sshutil.RunCommandStream(sshClient, gitSyncCommand(g, remotePath, keyFile), w)
 }
 
-// RestartSiteRemote restarts the site containers on a remote server.
-func RestartSiteRemote(host string, port int, user string, keyPath string, hostKey string, containerName string) error {
-	if err := ValidateContainerName(containerName); err != nil {
+// runRemoteSiteAction runs action on a site on a remote server. what names
+// the step in the returned error.
+func runRemoteSiteAction(host string, port int, user string, keyPath string, hostKey string, basePath string, containerName string, r Remote, action string, what string) error {
+	remotePath, err := RemoteSiteDir(basePath, containerName)
+	if err != nil {
 		return err
 	}
 
@@ -190,28 +522,40 @@ func RestartSiteRemote(host string, port int, user string, keyPath string, hostK
 	}
 	defer sshClient.Close()
 
-	remotePath := fmt.Sprintf("/opt/ezweb/%s", containerName)
-	if _, err := sshutil.RunCommand(sshClient, fmt.Sprintf("cd %s && docker compose restart", remotePath)); err != nil {
-		return fmt.Errorf("docker compose restart failed for %s: %w", containerName, err)
+	if r.Mode == DeployModeSwarm {
+		what = "swarm " + action
+	}
+	if _, err := sshutil.RunCommand(sshClient, remoteSiteCommand(r, action, remotePath, containerName)); err != nil {
+		return fmt.Errorf("%s failed for %s: %w", what, containerName, err)
 	}
 	return nil
 }
 
-// RemoveSiteRemote tears down the site containers and removes volumes on a remote server.
-func RemoveSiteRemote(host string, port int, user string, keyPath string, hostKey string, containerName string) error {
-	if err := ValidateContainerName(containerName); err != nil {
-		return err
-	}
+// StopSiteRemote stops the site containers on a remote server. In swarm mode
+// the stack's services are scaled to zero.
+func StopSiteRemote(host string, port int, user string, keyPath string, hostKey string, basePath string, containerName string, r Remote) error {
+	return runRemoteSiteAction(host, port, user, keyPath, hostKey, basePath, containerName, r, actionStop, "docker compose stop")
+}
 
-	sshClient, err := sshutil.NewClientWithHostKey(host, port, user, keyPath, hostKey)
-	if err != nil {
-		return fmt.Errorf("SSH connect failed: %w", err)
-	}
-	defer sshClient.Close()
+// StartSiteRemote starts the site containers on a remote server. In swarm
+// mode the stack is redeployed, restoring its replica counts.
+func StartSiteRemote(host string, port int, user string, keyPath string, hostKey string, basePath string, containerName string, r Remote) error {
+	return runRemoteSiteAction(host, port, user, keyPath, hostKey, basePath, containerName, r, actionStart, "docker compose start")
+}
 
-	remotePath := fmt.Sprintf("/opt/ezweb/%s", containerName)
-	if _, err := sshutil.RunCommand(sshClient, fmt.Sprintf("cd %s && docker compose down -v", remotePath)); err != nil {
-		return fmt.Errorf("docker compose down failed for %s: %w", containerName, err)
-	}
-	return nil
+// RestartSiteRemote restarts the site containers on a remote server.
+func RestartSiteRemote(host string, port int, user string, keyPath string, hostKey string, basePath string, containerName string, r Remote) error {
+	return runRemoteSiteAction(host, port, user, keyPath, hostKey, basePath, containerName, r, actionRestart, "docker compose restart")
+}
+
+// RecreateSiteRemote brings the site up on a remote server with new
+// containers, so they pick up a replaced site directory.
+func RecreateSiteRemote(host string, port int, user string, keyPath string, hostKey string, basePath string, containerName string, r Remote) error {
+	return runRemoteSiteAction(host, port, user, keyPath, hostKey, basePath, containerName, r, actionRecreate, "docker compose up")
+}
+
+// RemoveSiteRemote tears down the site containers and removes volumes on a
+// remote server. In swarm mode the stack is removed and its volumes are kept.
+func RemoveSiteRemote(host string, port int, user string, keyPath string, hostKey string, basePath string, containerName string, r Remote) error {
+	return runRemoteSiteAction(host, port, user, keyPath, hostKey, basePath, containerName, r, actionDown, "docker compose down")
 }
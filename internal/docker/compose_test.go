@@ -1,8 +1,12 @@
 package docker
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+
+	"ezweb/internal/templates"
 )
 
 // --- ValidateContainerName ---
@@ -128,6 +132,31 @@ func TestRenderCompose_StaticTemplate(t *testing.T) {
 	}
 }
 
+func TestRenderCompose_ExtraVariables(t *testing.T) {
+	const tmpl = "image: \"myapp:{{ .Extra.IMAGE_TAG }}\"\ncontainer_name: \"{{.ContainerName}}\"\n"
+	vars := ComposeVars{
+		ContainerName: "app",
+		Extra:         map[string]string{"IMAGE_TAG": "1.4.2"},
+	}
+
+	out, err := renderComposeTemplate("extra", tmpl, vars)
+	if err != nil {
+		t.Fatalf("renderComposeTemplate returned unexpected error: %v", err)
+	}
+	if want := "image: \"myapp:1.4.2\"\ncontainer_name: \"app\"\n"; out != want {
+		t.Errorf("output = %q, want %q", out, want)
+	}
+
+	// A variable the site does not set must fail the render, not leave
+	// "<no value>" in the file.
+	for _, extra := range []map[string]string{nil, {"OTHER": "x"}} {
+		vars.Extra = extra
+		if out, err := renderComposeTemplate("extra", tmpl, vars); err == nil {
+			t.Errorf("Extra=%v: expected an error, got %q", extra, out)
+		}
+	}
+}
+
 func TestRenderCompose_UnknownSlugReturnsError(t *testing.T) {
 	vars := ComposeVars{
 		ContainerName: "test",
@@ -139,3 +168,143 @@ func TestRenderCompose_UnknownSlugReturnsError(t *testing.T) {
 		t.Error("RenderCompose with unknown slug should return an error")
 	}
 }
+
+func TestRenderCompose_StoredTemplateFirst(t *testing.T) {
+	templates.SetSource(func(slug string) (string, bool, error) {
+		if slug == "static" {
+			return "container_name: \"{{.ContainerName}}-custom\"\n", true, nil
+		}
+		return "", false, nil
+	})
+	defer templates.SetSource(nil)
+
+	out, err := RenderCompose("static", ComposeVars{ContainerName: "site"})
+	if err != nil || out != "container_name: \"site-custom\"\n" {
+		t.Errorf("stored template: got %q, %v", out, err)
+	}
+	// Slugs the source does not have fall back to the embedded template.
+	if out, err := RenderCompose("wordpress", ComposeVars{ContainerName: "wp", Port: 8080}); err != nil || !strings.Contains(out, "wordpress") {
+		t.Errorf("embedded fallback: got %q, %v", out, err)
+	}
+}
+
+// --- ValidateComposeTemplate ---
+
+func TestValidateComposeTemplate_EmbeddedTemplates(t *testing.T) {
+	entries, err := templates.ComposeFS.ReadDir("composes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		slug := strings.TrimSuffix(e.Name(), ".yml")
+		content, err := templates.GetEmbeddedTemplate(slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ValidateComposeTemplate(content); err != nil {
+			t.Errorf("%s: %v", slug, err)
+		}
+	}
+}
+
+func TestValidateComposeTemplate(t *testing.T) {
+	valid := []string{
+		"image: \"app:{{ .Extra.TAG }}\"\nports: [\"{{.Port}}:80\"]\n",
+		"{{ if .Extra.DEBUG }}debug: true{{ end }}\nname: {{ $.ContainerName }}\n",
+		"name: {{ index .Extra \"TAG\" }}\n",
+	}
+	for _, content := range valid {
+		if err := ValidateComposeTemplate(content); err != nil {
+			t.Errorf("ValidateComposeTemplate(%q) = %v, want nil", content, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"name: {{ .ContainerName \n",
+		"name: {{ .Secret }}\n",
+		"name: {{ .Domain.Host }}\n",
+		"name: {{ .Extra.A.B }}\n",
+		"{{ range .Extra }}{{ .Anything }}{{ end }}",
+		"name: {{ $.Nope }}\n",
+	}
+	for _, content := range invalid {
+		if err := ValidateComposeTemplate(content); err == nil {
+			t.Errorf("ValidateComposeTemplate(%q) = nil, want an error", content)
+		}
+	}
+}
+
+// --- RemoteSiteDir ---
+
+func TestRemoteSiteDir_DefaultsBasePath(t *testing.T) {
+	got, err := RemoteSiteDir("", "my-site")
+	if err != nil {
+		t.Fatalf("RemoteSiteDir: %v", err)
+	}
+	if got != "/opt/ezweb/my-site" {
+		t.Errorf("RemoteSiteDir = %q, want /opt/ezweb/my-site", got)
+	}
+
+	got, err = RemoteSiteDir("/srv/apps", "my-site")
+	if err != nil {
+		t.Fatalf("RemoteSiteDir: %v", err)
+	}
+	if got != "/srv/apps/my-site" {
+		t.Errorf("RemoteSiteDir = %q, want /srv/apps/my-site", got)
+	}
+}
+
+func TestValidateRemoteBasePath_RejectsUnsafePaths(t *testing.T) {
+	bad := []string{
+		"srv/apps",
+		"/",
+		"/srv/apps/",
+		"/srv/../etc",
+		"/srv/apps; rm -rf /",
+		"/srv/$(whoami)",
+		"/srv/apps && id",
+		"/srv/my apps",
+		"/srv/`id`",
+	}
+	for _, p := range bad {
+		if err := ValidateRemoteBasePath(p); err == nil {
+			t.Errorf("ValidateRemoteBasePath(%q) should have returned an error", p)
+		}
+	}
+}
+
+// --- DeploySiteContext ---
+
+func TestDeploySiteContext_CancelledBeforeConnect(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// The host is unroutable; a cancelled context must return before dialing.
+	err := DeploySiteContext(ctx, 0, DeployOptions{}, "192.0.2.1", 22, "root", "/nonexistent", "", "", "example.com", "static", "example", 8080)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DeploySiteContext with cancelled ctx = %v, want context.Canceled", err)
+	}
+}
+
+// --- PreviewSiteCompose ---
+
+func TestPreviewSiteCompose_MasksGeneratedPasswords(t *testing.T) {
+	rendered, mask, err := PreviewSiteCompose("wordpress", "blog", "blog.example.com", 8080, nil)
+	if err != nil {
+		t.Fatalf("PreviewSiteCompose: %v", err)
+	}
+	masked := mask(rendered)
+	if !strings.Contains(masked, `MYSQL_PASSWORD: "`+MaskedSecret+`"`) || !strings.Contains(masked, `MYSQL_ROOT_PASSWORD: "`+MaskedSecret+`"`) {
+		t.Errorf("passwords not masked in preview:\n%s", masked)
+	}
+	if strings.Contains(rendered, MaskedSecret) {
+		t.Error("the unmasked file contains the mask")
+	}
+	if !strings.Contains(masked, `container_name: "blog"`) || !strings.Contains(masked, `"8080:80"`) {
+		t.Errorf("preview lost the site's own values:\n%s", masked)
+	}
+	if rendered == masked {
+		t.Error("mask changed nothing")
+	}
+}
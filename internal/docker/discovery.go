@@ -44,11 +44,12 @@ type remoteContainerJSON struct {
 	Created string `json:"Created"`
 }
 
-// ScanRemoteProjects runs `docker compose ls` on the remote host and returns a
-// slice of ScannedProject values. If Docker Compose is not available on the
-// remote host the function returns an empty slice rather than an error.
-func ScanRemoteProjects(client *ssh.Client) ([]ScannedProject, error) {
-	out, err := sshutil.RunCommand(client, "docker compose ls --format json --all")
+// ScanRemoteProjects runs `docker compose ls` on the remote host, through sudo
+// when sudo is set, and returns a slice of ScannedProject values. If Docker
+// Compose is not available on the remote host the function returns an empty
+// slice rather than an error.
+func ScanRemoteProjects(client *ssh.Client, sudo bool) ([]ScannedProject, error) {
+	out, err := sshutil.RunCommand(client, sshutil.Docker(sudo)+" compose ls --format json --all")
 	if err != nil {
 		// Treat a missing docker/compose binary as a non-fatal condition so
 		// callers can still display partial server information.
@@ -88,12 +89,12 @@ func ScanRemoteProjects(client *ssh.Client) ([]ScannedProject, error) {
 	return result, nil
 }
 
-// GetRemoteContainers runs `docker ps -a` on the remote host and returns all
-// containers regardless of their state.
-func GetRemoteContainers(client *ssh.Client) ([]RemoteContainer, error) {
+// GetRemoteContainers runs `docker ps -a` on the remote host, through sudo
+// when sudo is set, and returns all containers regardless of their state.
+func GetRemoteContainers(client *ssh.Client, sudo bool) ([]RemoteContainer, error) {
 	// Each line is a self-contained JSON object produced by the Go template.
 	const format = `{"ID":"{{.ID}}","Name":"{{.Names}}","Image":"{{.Image}}","Status":"{{.Status}}","State":"{{.State}}","Ports":"{{.Ports}}","Created":"{{.CreatedAt}}"}`
-	cmd := `docker ps -a --format '` + format + `'`
+	cmd := sshutil.Docker(sudo) + ` ps -a --format '` + format + `'`
 
 	out, err := sshutil.RunCommand(client, cmd)
 	if err != nil {
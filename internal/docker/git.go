@@ -0,0 +1,151 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultGitBranch is the branch deployed when a site's git source names
+// none.
+const DefaultGitBranch = "main"
+
+// GitSource is a repository a site is deployed from instead of a template:
+// the branch is fetched into the site directory on the server and the
+// compose file it contains is brought up there.
+type GitSource struct {
+	URL string
+	// Branch is the branch deployed; empty means DefaultGitBranch.
+	Branch string
+	// KeyPath is a private deploy key on the EzWeb host for a private
+	// repository. It is copied to the server for the fetch only.
+	KeyPath string
+}
+
+// BranchName returns the branch deployed.
+func (g GitSource) BranchName() string {
+	if g.Branch == "" {
+		return DefaultGitBranch
+	}
+	return g.Branch
+}
+
+// Repository URLs accepted for a git source. Every part is limited to
+// characters that are safe inside a single-quoted shell word, and none may
+// start with "-", so a URL can never be read as a git option.
+var (
+	gitHTTPSURLRe = regexp.MustCompile(`^https://([a-zA-Z0-9][a-zA-Z0-9.\-]*)(:[0-9]{1,5})?/([a-zA-Z0-9_.~\-/]+)$`)
+	gitSSHURLRe   = regexp.MustCompile(`^ssh://[a-zA-Z0-9_.\-]+@([a-zA-Z0-9][a-zA-Z0-9.\-]*)(:[0-9]{1,5})?/([a-zA-Z0-9_.~\-/]+)$`)
+	gitSCPURLRe   = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+@([a-zA-Z0-9][a-zA-Z0-9.\-]*):([a-zA-Z0-9_.~\-/]+)$`)
+)
+
+// gitURLIsSSH reports whether a valid repository URL is fetched over SSH,
+// either as ssh://user@host/path or as user@host:path.
+func gitURLIsSSH(u string) bool {
+	return !strings.HasPrefix(u, "https://")
+}
+
+// ValidateGitURL returns an error unless u is an https:// repository URL or
+// an SSH one (git@github.com:owner/repo.git or ssh://git@host/owner/repo).
+// Credentials in an https URL are refused; private repositories use a
+// deploy key over SSH instead, so no token is stored in plain text.
+func ValidateGitURL(u string) error {
+	if u == "" {
+		return fmt.Errorf("repository URL must not be empty")
+	}
+	if len(u) > 500 {
+		return fmt.Errorf("repository URL is too long")
+	}
+	var m []string
+	switch {
+	case strings.HasPrefix(u, "https://"):
+		if strings.Contains(strings.SplitN(strings.TrimPrefix(u, "https://"), "/", 2)[0], "@") {
+			return fmt.Errorf("repository URL must not contain credentials; use an SSH URL with a deploy key for private repositories")
+		}
+		m = gitHTTPSURLRe.FindStringSubmatch(u)
+	case strings.HasPrefix(u, "ssh://"):
+		m = gitSSHURLRe.FindStringSubmatch(u)
+	case strings.Contains(u, "://"):
+		return fmt.Errorf("invalid repository URL %q: only https:// and SSH URLs are supported", u)
+	default:
+		m = gitSCPURLRe.FindStringSubmatch(u)
+	}
+	if m == nil {
+		return fmt.Errorf("invalid repository URL %q: expected https://host/owner/repo.git or git@host:owner/repo.git", u)
+	}
+	repoPath := m[len(m)-1]
+	for _, seg := range strings.Split(repoPath, "/") {
+		if seg == ".." {
+			return fmt.Errorf("invalid repository URL %q: path must not contain .. segments", u)
+		}
+	}
+	return nil
+}
+
+var gitBranchRe = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.\-/]*$`)
+
+// ValidateGitBranch returns an error unless b is a plain branch name that
+// git accepts and that is safe to put in a shell command. An empty branch is
+// valid and means DefaultGitBranch.
+func ValidateGitBranch(b string) error {
+	if b == "" {
+		return nil
+	}
+	if len(b) > 200 || !gitBranchRe.MatchString(b) {
+		return fmt.Errorf("invalid branch %q: only alphanumerics, underscores, dots, hyphens, and slashes are allowed", b)
+	}
+	if strings.Contains(b, "..") || strings.HasSuffix(b, ".") {
+		return fmt.Errorf("invalid branch %q", b)
+	}
+	for _, seg := range strings.Split(b, "/") {
+		if seg == "" || strings.HasPrefix(seg, ".") || strings.HasSuffix(seg, ".lock") {
+			return fmt.Errorf("invalid branch %q", b)
+		}
+	}
+	return nil
+}
+
+// ValidateGitSource checks the URL and branch of g. A deploy key can only be
+// used with an SSH URL.
+func ValidateGitSource(g GitSource) error {
+	if err := ValidateGitURL(g.URL); err != nil {
+		return err
+	}
+	if err := ValidateGitBranch(g.Branch); err != nil {
+		return err
+	}
+	if g.KeyPath != "" && !gitURLIsSSH(g.URL) {
+		return fmt.Errorf("a deploy key needs an SSH repository URL, such as git@github.com:owner/repo.git")
+	}
+	return nil
+}
+
+// gitKeyFile is where the deploy key is put on the server while a deploy
+// fetches, relative to the site directory. Inside .git it is never part of
+// the checkout.
+const gitKeyFile = ".git/ezweb-deploy-key"
+
+// gitInitCommand makes remotePath a git repository, on the first deploy
+// from git, so the branch can be fetched into a directory that may already
+// hold files from a template deploy. It does nothing to an existing one.
+func gitInitCommand(remotePath string) string {
+	return fmt.Sprintf("cd %s && git init -q", remotePath)
+}
+
+// gitSyncCommand returns the shell command that checks out the latest commit
+// of g's branch in the repository at remotePath. The branch is fetched and
+// reset to, so files from a template deploy are replaced and local edits
+// are discarded, while files the repository does not track, such as the
+// .env a deploy writes, are kept. keyFile, when set, is the deploy key on
+// the server.
+//
+// git never prompts: an https repository that needs credentials fails, and
+// an SSH host key is trusted on first use the way a server's is pinned.
+func gitSyncCommand(g GitSource, remotePath, keyFile string) string {
+	sshCmd := "ssh -o BatchMode=yes -o StrictHostKeyChecking=accept-new"
+	if keyFile != "" {
+		sshCmd += " -o IdentitiesOnly=yes -i " + keyFile
+	}
+	return fmt.Sprintf("cd %s && GIT_TERMINAL_PROMPT=0 GIT_SSH_COMMAND='%s' git fetch --depth 1 '%s' 'refs/heads/%s' && git reset --hard FETCH_HEAD",
+		remotePath, sshCmd, g.URL, g.BranchName())
+}
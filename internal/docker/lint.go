@@ -0,0 +1,170 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	sshutil "ezweb/internal/ssh"
+
+	"github.com/pkg/sftp"
+	"gopkg.in/yaml.v3"
+)
+
+// Compose lint policies, set with COMPOSE_LINT_POLICY.
+const (
+	// ComposeLintWarn shows the findings and imports or deploys once the
+	// user confirms them.
+	ComposeLintWarn = "warn"
+	// ComposeLintBlock refuses a compose file with any finding.
+	ComposeLintBlock = "block"
+)
+
+// maxComposeFileBytes bounds the compose file read for a lint.
+const maxComposeFileBytes = 1 << 20
+
+// remoteComposeFileNames are the names docker compose looks for in a project
+// directory, in the order it tries them.
+var remoteComposeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// ComposeFinding is a risky setting LintCompose found in one service.
+type ComposeFinding struct {
+	Service string `json:"service"`
+	Message string `json:"message"`
+}
+
+func (f ComposeFinding) String() string {
+	return f.Service + ": " + f.Message
+}
+
+// composeLintFile is the part of a compose file LintCompose reads. Fields
+// are decoded loosely, as compose itself accepts "true" as well as true.
+type composeLintFile struct {
+	Services map[string]struct {
+		Privileged  any    `yaml:"privileged"`
+		NetworkMode string `yaml:"network_mode"`
+		Volumes     []any  `yaml:"volumes"`
+	} `yaml:"services"`
+}
+
+// LintCompose parses a compose file and reports the settings that hand a
+// container control of the host: privileged mode, the host network, a bind
+// mount of / and a mount of the Docker socket. Findings are sorted by
+// service. An error means content is not a compose file.
+func LintCompose(content []byte) ([]ComposeFinding, error) {
+	var f composeLintFile
+	if err := yaml.Unmarshal(content, &f); err != nil {
+		return nil, fmt.Errorf("invalid compose file: %w", err)
+	}
+	if len(f.Services) == 0 {
+		return nil, fmt.Errorf("invalid compose file: no services defined")
+	}
+
+	names := make([]string, 0, len(f.Services))
+	for name := range f.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var findings []ComposeFinding
+	for _, name := range names {
+		svc := f.Services[name]
+		add := func(msg string) {
+			findings = append(findings, ComposeFinding{Service: name, Message: msg})
+		}
+		if svc.Privileged == true || svc.Privileged == "true" {
+			add("runs privileged, with full access to the host's devices and kernel")
+		}
+		if svc.NetworkMode == "host" {
+			add("uses the host network, so it can bind any port and reach services on localhost")
+		}
+		for _, v := range svc.Volumes {
+			switch source := volumeSource(v); {
+			case source == "":
+			case path.Clean(source) == "/":
+				add("bind-mounts the host's root filesystem")
+			case path.Base(source) == "docker.sock":
+				add(fmt.Sprintf("mounts the Docker socket (%s), which gives root on the host", source))
+			}
+		}
+	}
+	return findings, nil
+}
+
+// volumeSource returns the host path a service volume mounts, from either
+// the short "source:target[:mode]" syntax or the long one, or "" for a named
+// volume, a tmpfs or an entry that cannot be read.
+func volumeSource(v any) string {
+	switch v := v.(type) {
+	case string:
+		source, _, ok := strings.Cut(v, ":")
+		if !ok || !strings.HasPrefix(source, "/") {
+			return ""
+		}
+		return source
+	case map[string]any:
+		if t, _ := v["type"].(string); t != "bind" {
+			return ""
+		}
+		source, _ := v["source"].(string)
+		return source
+	}
+	return ""
+}
+
+// ReadLocalComposeFile reads the compose file of a local project, the
+// docker-compose.yml that the LocalCompose functions run.
+func ReadLocalComposeFile(composePath string) ([]byte, error) {
+	file, err := os.Open(filepath.Join(composePath, "docker-compose.yml"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open compose file: %w", err)
+	}
+	defer file.Close()
+	return readComposeFile(file)
+}
+
+// ReadRemoteComposeFile reads the compose file of a project directory on a
+// server over SFTP, trying the names docker compose does.
+func ReadRemoteComposeFile(host string, port int, user string, keyPath string, hostKey string, composePath string) ([]byte, error) {
+	sshClient, err := sshutil.NewClientWithHostKey(host, port, user, keyPath, hostKey)
+	if err != nil {
+		return nil, fmt.Errorf("SSH connect failed for %s:%d: %w", host, port, err)
+	}
+	defer sshClient.Close()
+
+	sftpClient, err := sftp.NewClient(sshClient)
+	if err != nil {
+		return nil, fmt.Errorf("SFTP session failed: %w", err)
+	}
+	defer sftpClient.Close()
+
+	for _, name := range remoteComposeFileNames {
+		file, err := sftpClient.Open(path.Join(composePath, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to open compose file: %w", err)
+		}
+		defer file.Close()
+		return readComposeFile(file)
+	}
+	return nil, fmt.Errorf("no compose file found in %s", composePath)
+}
+
+func readComposeFile(r io.Reader) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, maxComposeFileBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compose file: %w", err)
+	}
+	if len(content) > maxComposeFileBytes {
+		return nil, fmt.Errorf("compose file is larger than %d bytes", maxComposeFileBytes)
+	}
+	return content, nil
+}
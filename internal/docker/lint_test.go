@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLintCompose(t *testing.T) {
+	content := `
+services:
+  web:
+    image: nginx
+    volumes:
+      - ./html:/usr/share/nginx/html:ro
+      - data:/data
+  agent:
+    image: portainer/agent
+    privileged: "true"
+    network_mode: host
+    volumes:
+      - /var/run/docker.sock:/var/run/docker.sock
+      - type: bind
+        source: /
+        target: /host
+        read_only: true
+  backup:
+    image: restic/restic
+    volumes:
+      - /:/rootfs:ro
+      - type: volume
+        source: backups
+        target: /backups
+volumes:
+  data:
+  backups:
+`
+	findings, err := LintCompose([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, f.Service+": "+strings.SplitN(f.Message, ",", 2)[0])
+	}
+	want := []string{
+		"agent: runs privileged",
+		"agent: uses the host network",
+		"agent: mounts the Docker socket (/var/run/docker.sock)",
+		"agent: bind-mounts the host's root filesystem",
+		"backup: bind-mounts the host's root filesystem",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("findings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLintCompose_Clean(t *testing.T) {
+	findings, err := LintCompose([]byte("services:\n  app:\n    image: app\n    privileged: false\n    network_mode: bridge\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 0 {
+		t.Errorf("findings = %v, want none", findings)
+	}
+}
+
+func TestLintCompose_Invalid(t *testing.T) {
+	for _, content := range []string{"services: [", "version: '3'\n", ""} {
+		if _, err := LintCompose([]byte(content)); err == nil {
+			t.Errorf("LintCompose(%q) = nil error, want one", content)
+		}
+	}
+}
+
+func TestReadLocalComposeFile(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ReadLocalComposeFile(dir); err == nil {
+		t.Error("expected an error for a directory without docker-compose.yml")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "docker-compose.yml"), []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ReadLocalComposeFile(dir)
+	if err != nil || string(content) != "services: {}\n" {
+		t.Errorf("ReadLocalComposeFile = %q, %v", content, err)
+	}
+}
@@ -3,8 +3,11 @@ package docker
 import (
 	"context"
 	"fmt"
+	"io"
 	"os/exec"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func runCompose(ctx context.Context, composePath string, args ...string) (string, error) {
@@ -23,6 +26,27 @@ func LocalComposeUp(ctx context.Context, composePath string) error {
 	return err
 }
 
+// LocalComposePull fetches the latest images for the project, copying the
+// pull progress to w.
+func LocalComposePull(ctx context.Context, composePath string, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, "docker", "compose", "-f", composePath+"/docker-compose.yml", "pull")
+	cmd.Dir = composePath
+	cmd.Stdout = w
+	cmd.Stderr = w
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker compose pull failed in %s: %w", composePath, err)
+	}
+	return nil
+}
+
+// LocalComposeRecreate starts the project with new containers even if the
+// compose file is unchanged, e.g. after its directory was replaced.
+func LocalComposeRecreate(ctx context.Context, composePath string) error {
+	_, err := runCompose(ctx, composePath, "up", "-d", "--force-recreate")
+	return err
+}
+
 func LocalComposeStop(ctx context.Context, composePath string) error {
 	_, err := runCompose(ctx, composePath, "stop")
 	return err
@@ -47,6 +71,23 @@ func LocalComposeLogs(ctx context.Context, composePath string, tail int) (string
 	return runCompose(ctx, composePath, "logs", "--tail", fmt.Sprintf("%d", tail), "--no-color")
 }
 
+// LocalComposeLogsFollow streams the project's logs to w, starting with the
+// last tail lines, until every container stops or ctx is done. Cancelling
+// ctx kills the docker process.
+func LocalComposeLogsFollow(ctx context.Context, composePath string, tail int, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, "docker", "compose", "-f", composePath+"/docker-compose.yml",
+		"logs", "--follow", "--tail", strconv.Itoa(tail), "--no-color")
+	cmd.Dir = composePath
+	cmd.Stdout = w
+	cmd.Stderr = w
+	// Don't wait on output copying forever if a child holds the pipe open.
+	cmd.WaitDelay = 5 * time.Second
+	if err := cmd.Run(); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("docker compose logs failed in %s: %w", composePath, err)
+	}
+	return nil
+}
+
 func LocalComposePS(ctx context.Context, composePath string) (string, error) {
 	return runCompose(ctx, composePath, "ps", "--format", "table")
 }
@@ -0,0 +1,181 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	sshutil "ezweb/internal/ssh"
+)
+
+// Deploy modes of a remote server. Compose servers run each site with
+// "docker compose" in its site directory; swarm servers deploy the same
+// compose file as a stack with "docker stack deploy".
+const (
+	DeployModeCompose = "compose"
+	DeployModeSwarm   = "swarm"
+)
+
+// ValidDeployMode reports whether mode is a known deploy mode. Empty means
+// DeployModeCompose.
+func ValidDeployMode(mode string) bool {
+	return mode == "" || mode == DeployModeCompose || mode == DeployModeSwarm
+}
+
+// Remote is how docker is run on a remote server.
+type Remote struct {
+	// Mode is the server's deploy mode; empty means DeployModeCompose.
+	Mode string
+	// Sudo runs docker through "sudo -n", for SSH users that are not in the
+	// docker group (see sshutil.Docker).
+	Sudo bool
+}
+
+// Docker returns the command that runs docker on the server.
+func (r Remote) Docker() string {
+	return sshutil.Docker(r.Sudo)
+}
+
+// stackNamespaceLabel is the label docker stack deploy puts on each service
+// with the name of the stack it belongs to.
+const stackNamespaceLabel = "com.docker.stack.namespace"
+
+// StackName returns the swarm stack a site is deployed as. Stack names may
+// not contain dots, which container names derived from domains can.
+func StackName(containerName string) string {
+	return strings.ReplaceAll(containerName, ".", "-")
+}
+
+// Site actions run on a remote server by remoteSiteCommand.
+const (
+	actionUp       = "up"
+	actionStop     = "stop"
+	actionStart    = "start"
+	actionRestart  = "restart"
+	actionRecreate = "recreate"
+	actionDown     = "down"
+)
+
+// swarmDeploy deploys the compose file in the current directory as stack.
+// docker stack deploy does not read .env, so "docker compose config" renders
+// the file with the site's variables substituted first, unescaping them the
+// same way a compose deploy would.
+func swarmDeploy(docker, stack string) string {
+	return fmt.Sprintf("%[1]s compose config | %[1]s stack deploy --with-registry-auth --prune -c - %[2]s", docker, stack)
+}
+
+// swarmEachService runs docker service cmd for every service of stack; cmd
+// receives the service ID as {}.
+func swarmEachService(docker, stack, cmd string) string {
+	return fmt.Sprintf("%[1]s stack services -q %[2]s | xargs -r -I{} %[1]s service %[3]s", docker, stack, cmd)
+}
+
+// remoteSiteCommand returns the shell command that performs action on the
+// site in remotePath. Swarm has no stopped state, so stop scales every
+// service to zero and start redeploys the stack, which restores the replica
+// counts in the compose file.
+func remoteSiteCommand(r Remote, action, remotePath, containerName string) string {
+	docker := r.Docker()
+	if r.Mode != DeployModeSwarm {
+		var args string
+		switch action {
+		case actionUp:
+			args = "up -d"
+		case actionRecreate:
+			args = "up -d --force-recreate"
+		case actionDown:
+			args = "down -v"
+		default:
+			args = action
+		}
+		return fmt.Sprintf("cd %s && %s compose %s", remotePath, docker, args)
+	}
+
+	stack := StackName(containerName)
+	switch action {
+	case actionStop:
+		return swarmEachService(docker, stack, "scale --detach {}=0")
+	case actionRestart:
+		return swarmEachService(docker, stack, "update --detach --force {}")
+	case actionRecreate:
+		return fmt.Sprintf("cd %s && %s && %s", remotePath, swarmDeploy(docker, stack), swarmEachService(docker, stack, "update --detach --force {}"))
+	case actionDown:
+		// Stack volumes live on whichever nodes ran the tasks and are still
+		// in use while the tasks shut down, so they are left in place.
+		return fmt.Sprintf("%s stack rm %s", docker, stack)
+	default: // actionUp, actionStart
+		return fmt.Sprintf("cd %s && %s", remotePath, swarmDeploy(docker, stack))
+	}
+}
+
+// RemoteLogsCommand returns the command printing the last tail log lines of
+// a remote site's containers, or of every service of its stack in swarm mode.
+func RemoteLogsCommand(r Remote, remotePath, containerName string, tail int) string {
+	if r.Mode == DeployModeSwarm {
+		return swarmEachService(r.Docker(), StackName(containerName), fmt.Sprintf("logs --no-task-ids --tail %d {} 2>&1", tail))
+	}
+	return fmt.Sprintf("cd %s && %s compose logs --no-color --tail %d 2>&1", remotePath, r.Docker(), tail)
+}
+
+// RemoteFollowLogsCommand is RemoteLogsCommand following the logs for at
+// most timeoutSec seconds. timeout(1) is a backstop in case the SSH
+// connection dies without the remote sshd noticing.
+func RemoteFollowLogsCommand(r Remote, remotePath, containerName string, tail, timeoutSec int) string {
+	if r.Mode == DeployModeSwarm {
+		// Each service's log is followed by its own process, all in parallel.
+		return fmt.Sprintf("exec timeout %[1]d sh -c '%[2]s stack services -q %[3]s | xargs -r -P 0 -I{} %[2]s service logs --follow --no-task-ids --tail %[4]d {}' 2>&1",
+			timeoutSec, r.Docker(), StackName(containerName), tail)
+	}
+	return fmt.Sprintf("cd %s && exec timeout %d %s compose logs --follow --no-color --tail %d 2>&1",
+		remotePath, timeoutSec, r.Docker(), tail)
+}
+
+// SwarmService is one service of a stack as listed by SwarmServicesCommand.
+type SwarmService struct {
+	Service string // name within the stack, e.g. "db"
+	Running int
+	Desired int
+	Image   string
+}
+
+// State is "running" when every desired replica is running, and otherwise
+// the replica count, e.g. "0/1 replicas".
+func (s SwarmService) State() string {
+	if s.Desired > 0 && s.Running >= s.Desired {
+		return "running"
+	}
+	return fmt.Sprintf("%d/%d replicas", s.Running, s.Desired)
+}
+
+// SwarmServicesCommand lists the services of a site's stack for
+// ParseSwarmServices.
+func SwarmServicesCommand(r Remote, containerName string) string {
+	return fmt.Sprintf("%s service ls --filter label=%s=%s --format '{{.Name}}|{{.Replicas}}|{{.Image}}'",
+		r.Docker(), stackNamespaceLabel, StackName(containerName))
+}
+
+// ParseSwarmServices parses SwarmServicesCommand output, sorted by service.
+// Global services report their replicas the same way ("2/2").
+func ParseSwarmServices(containerName, output string) []SwarmService {
+	prefix := StackName(containerName) + "_"
+	var services []SwarmService
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "|", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		svc := SwarmService{Service: strings.TrimPrefix(parts[0], prefix)}
+		// Replicas may carry a note, e.g. "1/1 (max 1 per node)".
+		replicas, _, _ := strings.Cut(parts[1], " ")
+		running, desired, _ := strings.Cut(replicas, "/")
+		svc.Running, _ = strconv.Atoi(running)
+		svc.Desired, _ = strconv.Atoi(desired)
+		if len(parts) > 2 {
+			svc.Image = parts[2]
+		}
+		services = append(services, svc)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Service < services[j].Service })
+	return services
+}
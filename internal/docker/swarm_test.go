@@ -0,0 +1,76 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRemoteSiteCommand_ComposeMode(t *testing.T) {
+	tests := map[string]string{
+		actionUp:       "cd /opt/ezweb/shop && docker compose up -d",
+		actionStop:     "cd /opt/ezweb/shop && docker compose stop",
+		actionRecreate: "cd /opt/ezweb/shop && docker compose up -d --force-recreate",
+		actionDown:     "cd /opt/ezweb/shop && docker compose down -v",
+	}
+	for action, want := range tests {
+		for _, mode := range []string{"", DeployModeCompose} {
+			if got := remoteSiteCommand(Remote{Mode: mode}, action, "/opt/ezweb/shop", "shop"); got != want {
+				t.Errorf("remoteSiteCommand(%q, %q) = %q, want %q", mode, action, got, want)
+			}
+		}
+	}
+}
+
+func TestRemoteSiteCommand_SwarmMode(t *testing.T) {
+	swarm := Remote{Mode: DeployModeSwarm}
+	deploy := remoteSiteCommand(swarm, actionUp, "/opt/ezweb/shop.example.com", "shop.example.com")
+	if !strings.HasPrefix(deploy, "cd /opt/ezweb/shop.example.com && docker compose config | docker stack deploy") ||
+		!strings.HasSuffix(deploy, " -c - shop-example-com") {
+		t.Errorf("swarm deploy = %q", deploy)
+	}
+	if got := remoteSiteCommand(swarm, actionStart, "/opt/ezweb/shop.example.com", "shop.example.com"); got != deploy {
+		t.Errorf("swarm start = %q, want the deploy command", got)
+	}
+	if got := remoteSiteCommand(swarm, actionDown, "/opt/ezweb/shop.example.com", "shop.example.com"); got != "docker stack rm shop-example-com" {
+		t.Errorf("swarm remove = %q", got)
+	}
+	stop := remoteSiteCommand(swarm, actionStop, "/opt/ezweb/shop.example.com", "shop.example.com")
+	if !strings.Contains(stop, "docker stack services -q shop-example-com") || !strings.Contains(stop, "scale --detach {}=0") {
+		t.Errorf("swarm stop = %q", stop)
+	}
+}
+
+func TestRemoteSiteCommand_Sudo(t *testing.T) {
+	if got := remoteSiteCommand(Remote{Sudo: true}, actionUp, "/opt/ezweb/shop", "shop"); got != "cd /opt/ezweb/shop && sudo -n docker compose up -d" {
+		t.Errorf("compose up with sudo = %q", got)
+	}
+	// Every docker in a swarm pipeline goes through sudo, not just the first.
+	stop := remoteSiteCommand(Remote{Mode: DeployModeSwarm, Sudo: true}, actionStop, "/opt/ezweb/shop", "shop")
+	if n := strings.Count(stop, "sudo -n docker "); n != 2 || strings.Count(stop, "docker ") != 2 {
+		t.Errorf("swarm stop with sudo = %q", stop)
+	}
+	if got := RemoteLogsCommand(Remote{Sudo: true}, "/opt/ezweb/shop", "shop", 50); !strings.Contains(got, "&& sudo -n docker compose logs") {
+		t.Errorf("logs with sudo = %q", got)
+	}
+}
+
+func TestParseSwarmServices(t *testing.T) {
+	out := "shop-example-com_db|0/1|postgres:16\n" +
+		"shop-example-com_app|2/2 (max 1 per node)|ghcr.io/acme/shop:1.4\n" +
+		"\n"
+	got := ParseSwarmServices("shop.example.com", out)
+	want := []SwarmService{
+		{Service: "app", Running: 2, Desired: 2, Image: "ghcr.io/acme/shop:1.4"},
+		{Service: "db", Running: 0, Desired: 1, Image: "postgres:16"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("ParseSwarmServices = %v, want %v", got, want)
+	}
+	if got[0].State() != "running" || got[1].State() != "0/1 replicas" {
+		t.Errorf("states = %q, %q", got[0].State(), got[1].State())
+	}
+	if st := (SwarmService{Service: "app"}).State(); st != "0/0 replicas" {
+		t.Errorf("scaled-down state = %q", st)
+	}
+}
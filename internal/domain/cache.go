@@ -2,8 +2,9 @@ package domain
 
 import (
 	"database/sql"
-	"log"
 	"time"
+
+	"ezweb/internal/logging"
 )
 
 const (
@@ -100,7 +101,7 @@ func (c *Cache) CleanExpired() error {
 		return err
 	}
 	if n, _ := res.RowsAffected(); n > 0 {
-		log.Printf("domain cache: pruned %d expired entries", n)
+		logging.Debugf("domain cache: pruned %d expired entries", n)
 	}
 	return nil
 }
@@ -7,6 +7,8 @@ import (
 	"os"
 	"sort"
 	"sync"
+
+	"ezweb/internal/logging"
 )
 
 // Manager holds the set of configured domain providers and an SQLite-backed
@@ -32,7 +34,7 @@ func NewManager(db *sql.DB) *Manager {
 	if cfToken != "" && cfAccount != "" {
 		m.providers = append(m.providers, NewCloudflareProvider(cfToken, cfAccount))
 		m.realProviders++
-		log.Println("domain: cloudflare provider enabled")
+		logging.Infof("domain: cloudflare provider enabled")
 	}
 
 	// Namecheap — requires API user and key.
@@ -41,7 +43,7 @@ func NewManager(db *sql.DB) *Manager {
 	if ncUser != "" && ncKey != "" {
 		m.providers = append(m.providers, NewNamecheapProvider(ncUser, ncKey))
 		m.realProviders++
-		log.Println("domain: namecheap provider enabled")
+		logging.Infof("domain: namecheap provider enabled")
 	}
 
 	// Porkbun — requires API key and secret.
@@ -50,7 +52,7 @@ func NewManager(db *sql.DB) *Manager {
 	if pbKey != "" && pbSecret != "" {
 		m.providers = append(m.providers, NewPorkbunProvider(pbKey, pbSecret))
 		m.realProviders++
-		log.Println("domain: porkbun provider enabled")
+		logging.Infof("domain: porkbun provider enabled")
 	}
 
 	// Static provider is always the final fallback.
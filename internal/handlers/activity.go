@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ezweb/internal/models"
+	"ezweb/views/pages"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ListActivity renders the full activity log with optional filters for entity
+// type, entity ID, a date range, and a substring search over the details.
+// Dates are YYYY-MM-DD in UTC; the until date is inclusive, so
+// until=2024-05-01 covers the whole of May 1st.
+func ListActivity(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		page, _ := strconv.Atoi(c.Query("page", "1"))
+		if page < 1 {
+			page = 1
+		}
+
+		filter := pages.ActivityFilter{
+			EntityType: strings.TrimSpace(c.Query("entity_type")),
+			EntityID:   strings.TrimSpace(c.Query("entity_id")),
+			Since:      strings.TrimSpace(c.Query("since")),
+			Until:      strings.TrimSpace(c.Query("until")),
+			Search:     strings.TrimSpace(c.Query("q")),
+		}
+
+		var entityID int
+		if filter.EntityID != "" {
+			id, err := strconv.Atoi(filter.EntityID)
+			if err != nil || id <= 0 {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid entity ID")
+			}
+			entityID = id
+		}
+
+		var since, until time.Time
+		if filter.Since != "" {
+			t, err := time.Parse("2006-01-02", filter.Since)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid since date (expected YYYY-MM-DD)")
+			}
+			since = t
+		}
+		if filter.Until != "" {
+			t, err := time.Parse("2006-01-02", filter.Until)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid until date (expected YYYY-MM-DD)")
+			}
+			until = t.AddDate(0, 0, 1)
+		}
+
+		offset := (page - 1) * perPage
+		activities, total, err := models.SearchActivities(db, models.ActivityQuery{
+			EntityType: filter.EntityType,
+			EntityID:   entityID,
+			Since:      since,
+			Until:      until,
+			Search:     filter.Search,
+		}, perPage, offset)
+		if err != nil {
+			log.Printf("failed to search activity log: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load activity")
+		}
+
+		c.Set("Content-Type", "text/html")
+		return pages.ActivityLog(activities, filter, page, total, perPage).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"ezweb/internal/auth"
+	"ezweb/internal/models"
+	"ezweb/views/pages"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const maxAPITokenNameLen = 64
+
+// APITokensPage handles GET /settings/tokens and lists the current user's
+// API tokens.
+func APITokensPage(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return renderAPITokens(c, db, "", "")
+	}
+}
+
+// CreateAPITokenHandler handles POST /settings/tokens. The plaintext token is
+// rendered once in the response and cannot be retrieved afterwards.
+func CreateAPITokenHandler(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		name := strings.TrimSpace(c.FormValue("name"))
+		role := c.FormValue("role", "viewer")
+
+		if name == "" || len(name) > maxAPITokenNameLen {
+			return renderAPITokens(c, db, "", fmt.Sprintf("Token name is required and must be at most %d characters.", maxAPITokenNameLen))
+		}
+		if !auth.ValidAPITokenRole(role) {
+			return renderAPITokens(c, db, "", "Invalid token role.")
+		}
+
+		plain, token, err := auth.CreateAPIToken(db, userID, name, role)
+		if err != nil {
+			log.Printf("failed to create API token for user %d: %v", userID, err)
+			return renderAPITokens(c, db, "", "Failed to create token.")
+		}
+
+		models.LogActivityWithContext(db, "user", userID, "api_token_created",
+			fmt.Sprintf("Created %s API token %q", token.Role, token.Name),
+			c.IP(), c.Get("User-Agent"))
+		return renderAPITokens(c, db, plain, "")
+	}
+}
+
+// RevokeAPITokenHandler handles POST /settings/tokens/:id/revoke.
+func RevokeAPITokenHandler(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID := c.Locals("user_id").(int)
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid token ID")
+		}
+
+		if err := auth.RevokeAPIToken(db, userID, id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return c.Status(fiber.StatusNotFound).SendString("Token not found")
+			}
+			log.Printf("failed to revoke API token %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to revoke token")
+		}
+
+		models.LogActivityWithContext(db, "user", userID, "api_token_revoked",
+			fmt.Sprintf("Revoked API token #%d", id),
+			c.IP(), c.Get("User-Agent"))
+		return c.Redirect("/settings/tokens")
+	}
+}
+
+func renderAPITokens(c *fiber.Ctx, db *sql.DB, newToken, errMsg string) error {
+	userID := c.Locals("user_id").(int)
+	tokens, err := auth.ListAPITokens(db, userID)
+	if err != nil {
+		log.Printf("failed to list API tokens for user %d: %v", userID, err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to load API tokens")
+	}
+	isAdmin := c.Locals("role") == "admin"
+
+	c.Set("Content-Type", "text/html")
+	return pages.APITokens(tokens, newToken, isAdmin, errMsg).Render(c.Context(), c.Response().BodyWriter())
+}
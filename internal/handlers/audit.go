@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AuditWrites records every mutating request (POST, PUT, PATCH, DELETE) in
+// the activity log as a "request" entry with the method, path, user and
+// resulting status, whether the handler succeeded, failed or was refused.
+// Handlers still log their own entity-specific entries; this is the
+// complete trail underneath them. It must run after the session middleware,
+// so the user is known, and before WriteProtect, so denied writes are seen.
+func AuditWrites(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		default:
+			return c.Next()
+		}
+
+		method, path := c.Method(), c.Path()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			// The app's error handler has not written the response yet.
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+
+		action := "request"
+		switch {
+		case status == fiber.StatusUnauthorized || status == fiber.StatusForbidden:
+			action = "request_denied"
+		case status >= 400:
+			action = "request_failed"
+		}
+
+		user, _ := c.Locals("username").(string)
+		if user == "" {
+			user = "unknown user"
+		}
+		if tokenID, ok := c.Locals("api_token_id").(int); ok {
+			user = fmt.Sprintf("%s (API token #%d)", user, tokenID)
+		}
+
+		models.LogActivityWithContext(db, "request", 0, action,
+			fmt.Sprintf("%s %s by %s: %d", method, path, user, status),
+			c.IP(), c.Get("User-Agent"))
+		return err
+	}
+}
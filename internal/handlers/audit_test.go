@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/auth"
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestAuditWrites(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("username", "alice")
+		c.Locals("role", c.Get("X-Role"))
+		return c.Next()
+	})
+	app.Use(AuditWrites(database), auth.WriteProtect())
+	app.Get("/sites", func(c *fiber.Ctx) error { return c.SendString("list") })
+	app.Post("/sites", func(c *fiber.Ctx) error { return c.SendString("created") })
+	app.Delete("/sites/:id", func(c *fiber.Ctx) error { return fiber.ErrNotFound })
+
+	tests := []struct {
+		method, path, role string
+		wantAction         string
+	}{
+		{http.MethodGet, "/sites", "admin", ""},
+		{http.MethodPost, "/sites", "admin", "request"},
+		{http.MethodPost, "/sites", "viewer", "request_denied"},
+		{http.MethodDelete, "/sites/7", "admin", "request_failed"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-Role", tt.role)
+		if _, err := app.Test(req); err != nil {
+			t.Fatal(err)
+		}
+
+		entries, _, err := models.SearchActivities(database, models.ActivityQuery{EntityType: "request"}, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.wantAction == "" {
+			if len(entries) != 0 {
+				t.Errorf("%s %s: read request was logged: %+v", tt.method, tt.path, entries[0])
+			}
+			continue
+		}
+		if len(entries) == 0 || entries[0].Action != tt.wantAction {
+			t.Errorf("%s %s as %s: latest entry = %+v, want action %q", tt.method, tt.path, tt.role, entries, tt.wantAction)
+		}
+	}
+
+	// Audit entries stay out of the dashboard feed.
+	recent, err := models.GetRecentActivities(database, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 0 {
+		t.Errorf("dashboard feed includes %d request entries", len(recent))
+	}
+}
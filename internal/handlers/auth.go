@@ -8,6 +8,7 @@ import (
 
 	"ezweb/internal/auth"
 	"ezweb/internal/config"
+	"ezweb/internal/logging"
 	"ezweb/internal/models"
 	"ezweb/views/pages"
 
@@ -19,7 +20,7 @@ func LoginPage(c *fiber.Ctx) error {
 	return pages.Login("").Render(c.Context(), c.Response().BodyWriter())
 }
 
-func LoginPost(db *sql.DB, cfg *config.Config, lockout *auth.LockoutTracker, userLockout *auth.LockoutTracker) fiber.Handler {
+func LoginPost(db *sql.DB, cfg *config.Config, session *auth.Session, lockout *auth.LockoutTracker, userLockout *auth.LockoutTracker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		username := c.FormValue("username")
 		password := c.FormValue("password")
@@ -34,18 +35,34 @@ func LoginPost(db *sql.DB, cfg *config.Config, lockout *auth.LockoutTracker, use
 
 		user, err := models.GetUserByUsername(db, username)
 		if err != nil || !auth.CheckPassword(user.Password, password) {
-			lockout.RecordFailure(clientIP)
-			userLockout.RecordFailure(strings.ToLower(username))
+			ipLocked := lockout.RecordFailure(clientIP)
+			userLocked := userLockout.RecordFailure(strings.ToLower(username))
 			log.Printf("failed login attempt for user %q from %s", safeUser, clientIP)
 			models.LogActivityWithContext(db, "auth", 0, "login_failed", "Failed login for user "+safeUser, clientIP, c.Get("User-Agent"))
+			if ipLocked {
+				models.LogActivityWithContext(db, "auth", 0, "locked_out", "Locked out IP "+clientIP+" after repeated failed logins", clientIP, c.Get("User-Agent"))
+			}
+			if userLocked {
+				models.LogActivityWithContext(db, "auth", 0, "locked_out", "Locked out user "+safeUser+" after repeated failed logins", clientIP, c.Get("User-Agent"))
+			}
 			c.Set("Content-Type", "text/html")
 			return pages.Login("Invalid username or password").Render(c.Context(), c.Response().BodyWriter())
 		}
 
 		lockout.Reset(clientIP)
 		userLockout.Reset(strings.ToLower(username))
+
+		// Upgrade a hash made with an older cost or algorithm while the
+		// plaintext is at hand; a failure only delays it to the next login.
+		if auth.NeedsRehash(user.Password) {
+			if hash, err := auth.HashPassword(password); err != nil {
+				log.Printf("failed to rehash password for user %d: %v", user.ID, err)
+			} else if err := models.UpdateUserPassword(db, user.ID, hash); err != nil {
+				log.Printf("failed to store rehashed password for user %d: %v", user.ID, err)
+			}
+		}
 		safeDBUser := strings.ReplaceAll(strings.ReplaceAll(user.Username, "\n", ""), "\r", "")
-		log.Printf("successful login for user %q from %s", safeDBUser, clientIP)
+		logging.Infof("successful login for user %q from %s", safeDBUser, clientIP)
 
 		// If 2FA is enabled, redirect to TOTP verification
 		if user.TOTPEnabled {
@@ -66,22 +83,12 @@ func LoginPost(db *sql.DB, cfg *config.Config, lockout *auth.LockoutTracker, use
 			return c.Redirect("/login/2fa")
 		}
 
-		token, err := auth.GenerateToken(user.ID, user.Username, user.Role, cfg.JWTSecret, cfg.JWTExpiryHours)
-		if err != nil {
+		if err := session.Issue(c, user.ID, user.Username, user.Role); err != nil {
+			log.Printf("failed to issue session for user %d: %v", user.ID, err)
 			c.Set("Content-Type", "text/html")
 			return pages.Login("Internal server error").Render(c.Context(), c.Response().BodyWriter())
 		}
 
-		c.Cookie(&fiber.Cookie{
-			Name:     "token",
-			Value:    token,
-			HTTPOnly: true,
-			Secure:   cfg.SecureCookies,
-			SameSite: "Lax",
-			Expires:  time.Now().Add(time.Duration(cfg.JWTExpiryHours) * time.Hour),
-			Path:     "/",
-		})
-
 		return c.Redirect("/dashboard")
 	}
 }
@@ -95,7 +102,15 @@ func TOTPVerifyPage(c *fiber.Ctx) error {
 	return pages.TOTPVerify("").Render(c.Context(), c.Response().BodyWriter())
 }
 
-func TOTPVerifyPost(db *sql.DB, cfg *config.Config, lockout *auth.LockoutTracker) fiber.Handler {
+// recordTOTPFailure counts a bad 2FA code against the client's IP and logs
+// the lockout when it is the one that triggers it.
+func recordTOTPFailure(db *sql.DB, c *fiber.Ctx, lockout *auth.LockoutTracker, key string) {
+	if lockout.RecordFailure(key) {
+		models.LogActivityWithContext(db, "auth", 0, "locked_out", "Locked out IP "+c.IP()+" after repeated failed 2FA codes", c.IP(), c.Get("User-Agent"))
+	}
+}
+
+func TOTPVerifyPost(db *sql.DB, cfg *config.Config, session *auth.Session, lockout *auth.LockoutTracker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		pendingToken := c.Cookies("totp_pending")
 		if pendingToken == "" {
@@ -139,13 +154,13 @@ func TOTPVerifyPost(db *sql.DB, cfg *config.Config, lockout *auth.LockoutTracker
 			return pages.TOTPVerify("Internal server error").Render(c.Context(), c.Response().BodyWriter())
 		}
 		if used {
-			lockout.RecordFailure(lockoutKey)
+			recordTOTPFailure(db, c, lockout, lockoutKey)
 			c.Set("Content-Type", "text/html")
 			return pages.TOTPVerify("Code already used. Wait for a new code.").Render(c.Context(), c.Response().BodyWriter())
 		}
 
 		if !auth.ValidateTOTPCode(code, user.TOTPSecret) {
-			lockout.RecordFailure(lockoutKey)
+			recordTOTPFailure(db, c, lockout, lockoutKey)
 			log.Printf("failed 2FA attempt for user %d from %s", userID, clientIP)
 			c.Set("Content-Type", "text/html")
 			return pages.TOTPVerify("Invalid verification code").Render(c.Context(), c.Response().BodyWriter())
@@ -166,53 +181,41 @@ func TOTPVerifyPost(db *sql.DB, cfg *config.Config, lockout *auth.LockoutTracker
 			Path:     "/login",
 		})
 
-		// Issue full JWT
-		token, err := auth.GenerateToken(user.ID, user.Username, user.Role, cfg.JWTSecret, cfg.JWTExpiryHours)
-		if err != nil {
+		// Issue full session (access + refresh token)
+		if err := session.Issue(c, user.ID, user.Username, user.Role); err != nil {
+			log.Printf("failed to issue session for user %d: %v", user.ID, err)
 			c.Set("Content-Type", "text/html")
 			return pages.TOTPVerify("Internal server error").Render(c.Context(), c.Response().BodyWriter())
 		}
 
-		c.Cookie(&fiber.Cookie{
-			Name:     "token",
-			Value:    token,
-			HTTPOnly: true,
-			Secure:   cfg.SecureCookies,
-			SameSite: "Lax",
-			Expires:  time.Now().Add(time.Duration(cfg.JWTExpiryHours) * time.Hour),
-			Path:     "/",
-		})
-
 		return c.Redirect("/dashboard")
 	}
 }
 
-// Logout returns a handler that revokes the current JWT and clears the cookie.
-func Logout(cfg *config.Config, db *sql.DB) fiber.Handler {
+// RefreshToken handles POST /auth/refresh.
+// It exchanges the refresh token cookie for a new access token, rotating the
+// refresh token so the session slides forward. Browser requests are normally
+// refreshed transparently by the session middleware; this endpoint lets
+// scripted clients renew ahead of expiry.
+func RefreshToken(session *auth.Session) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Parse and revoke the token so it cannot be reused even if stolen
-		tokenStr := c.Cookies("token")
-		if tokenStr != "" {
-			if claims, err := auth.ValidateToken(tokenStr, cfg.JWTSecret); err == nil && claims.ID != "" {
-				expiresAt := time.Now().Add(time.Duration(cfg.JWTExpiryHours) * time.Hour)
-				if claims.ExpiresAt != nil {
-					expiresAt = claims.ExpiresAt.Time
-				}
-				if err := auth.RevokeToken(db, claims.ID, expiresAt); err != nil {
-					log.Printf("failed to revoke token on logout: %v", err)
-				}
-			}
+		claims, err := session.Refresh(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid or expired refresh token"})
 		}
-
-		c.Cookie(&fiber.Cookie{
-			Name:     "token",
-			Value:    "",
-			HTTPOnly: true,
-			Secure:   cfg.SecureCookies,
-			SameSite: "Lax",
-			Expires:  time.Now().Add(-1 * time.Hour),
-			Path:     "/",
+		return c.JSON(fiber.Map{
+			"expires_at": claims.ExpiresAt.Time.UTC().Format(time.RFC3339),
 		})
+	}
+}
+
+// Logout returns a handler that revokes the current access and refresh
+// tokens and clears their cookies.
+func Logout(cfg *config.Config, session *auth.Session) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		// Revoke both tokens so neither can be reused even if stolen
+		session.Revoke(c)
+
 		c.Cookie(&fiber.Cookie{
 			Name:     "totp_pending",
 			Value:    "",
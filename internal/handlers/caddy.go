@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"ezweb/internal/caddy"
+	"ezweb/internal/models"
+	"ezweb/views/pages"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CaddyPreview handles GET /caddy/preview.
+// It generates and validates the Caddyfile for the current sites and renders
+// it as a diff against the live file. Nothing is written or reloaded.
+func CaddyPreview(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sites, err := models.GetAllSites(db)
+		if err != nil {
+			log.Printf("failed to load sites for Caddyfile preview: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load sites")
+		}
+
+		preview, err := caddyMgr.Preview(sites)
+		if err != nil {
+			log.Printf("failed to preview Caddyfile: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to preview Caddyfile")
+		}
+
+		c.Set("Content-Type", "text/html")
+		return pages.CaddyPreview(preview, caddyMgr.CaddyfilePath).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
+
+// RegenerateCaddy handles POST /caddy/regenerate. It rewrites the whole
+// Caddyfile from every site and reloads Caddy, for when the live file has
+// drifted from the database. The validation or reload error, if any, is
+// reported back rather than treated as a server failure.
+func RegenerateCaddy(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sites, err := models.GetAllSites(db)
+		if err != nil {
+			log.Printf("failed to load sites for Caddyfile regeneration: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load sites")
+		}
+
+		var result string
+		if err := caddyMgr.ReloadAll(db); err != nil {
+			log.Printf("Caddyfile regeneration failed: %v", err)
+			result = err.Error()
+			models.LogActivityWithContext(db, "caddy", 0, "regenerate_failed",
+				fmt.Sprintf("Caddyfile regeneration for %d sites failed", len(sites)),
+				c.IP(), c.Get("User-Agent"))
+		} else {
+			models.LogActivityWithContext(db, "caddy", 0, "regenerated",
+				fmt.Sprintf("Regenerated Caddyfile for %d sites", len(sites)),
+				c.IP(), c.Get("User-Agent"))
+		}
+
+		if c.Get("HX-Request") == "" {
+			return c.JSON(fiber.Map{"ok": result == "", "sites": len(sites), "error": result})
+		}
+		c.Set("Content-Type", "text/html")
+		return pages.CaddyRegenerateResult(result).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
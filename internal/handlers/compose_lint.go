@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"strings"
+
+	"ezweb/internal/docker"
+
+	"github.com/a-h/templ"
+	"github.com/gofiber/fiber/v2"
+)
+
+// lintComposeFile lints a compose file as read by docker.ReadLocalComposeFile
+// or docker.ReadRemoteComposeFile. A file that cannot be read or parsed is
+// reported as a finding of its own, so the lint policy decides whether a
+// project that could not be checked goes ahead.
+func lintComposeFile(content []byte, readErr error) []docker.ComposeFinding {
+	if readErr == nil {
+		findings, err := docker.LintCompose(content)
+		if err == nil {
+			return findings
+		}
+		readErr = err
+	}
+	return []docker.ComposeFinding{{Service: "compose file", Message: "could not be checked: " + readErr.Error()}}
+}
+
+// joinFindings lists findings on one line for an error message or the
+// activity log.
+func joinFindings(findings []docker.ComposeFinding) string {
+	parts := make([]string, len(findings))
+	for i, f := range findings {
+		parts[i] = f.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// checkImportLint applies the compose lint policy to an import. It reports
+// whether the import may go ahead; when it may not, the response has been
+// written and err is what the handler returns. Under the warn policy an
+// HTMX request gets confirm, which posts the import again with
+// accept_risks=1, and other clients a 422 that says to do so; under block
+// every finding refuses the import.
+func checkImportLint(c *fiber.Ctx, policy string, findings []docker.ComposeFinding, confirm templ.Component) (ok bool, err error) {
+	if len(findings) == 0 {
+		return true, nil
+	}
+	if policy == docker.ComposeLintBlock {
+		return false, c.Status(fiber.StatusUnprocessableEntity).SendString("Import refused, the compose file has risky settings: " + joinFindings(findings))
+	}
+	if formFlag(c, "accept_risks", false) {
+		return true, nil
+	}
+	if c.Get("HX-Request") != "" {
+		c.Set("Content-Type", "text/html")
+		return false, confirm.Render(c.Context(), c.Response().BodyWriter())
+	}
+	return false, c.Status(fiber.StatusUnprocessableEntity).SendString("The compose file has risky settings: " + joinFindings(findings) + ". Send accept_risks=1 to import it anyway")
+}
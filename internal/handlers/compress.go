@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+)
+
+// Compress gzip/brotli-encodes responses for clients that accept it. Only
+// text-like content types are compressed, so images and archives pass
+// through untouched.
+//
+// Server-sent event streams are skipped: the compressor wraps a streamed body
+// in an encoder that holds output back until its buffer fills, so deploy logs
+// would stop arriving live. The decision has to be made before the handler
+// runs, when the response Content-Type is not known yet, so streams are
+// recognised by their path and by the Accept header EventSource sends.
+func Compress() fiber.Handler {
+	return compress.New(compress.Config{
+		Level: compress.LevelBestSpeed,
+		Next:  isEventStreamRequest,
+	})
+}
+
+func isEventStreamRequest(c *fiber.Ctx) bool {
+	return strings.HasSuffix(c.Path(), "/stream") ||
+		strings.Contains(c.Get(fiber.HeaderAccept), "text/event-stream")
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCompress_SkipsEventStreams(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(Compress())
+	page := strings.Repeat("<tr><td>example.com</td></tr>", 200)
+	app.Get("/sites", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "text/html")
+		return c.SendString(page)
+	})
+	app.Get("/sites/:id/deploy/stream", func(c *fiber.Ctx) error {
+		c.Set("Content-Type", "text/event-stream")
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			w.WriteString("data: " + page + "\n\n")
+			w.Flush()
+		})
+		return nil
+	})
+
+	tests := []struct {
+		path     string
+		accept   string
+		wantGzip bool
+	}{
+		{"/sites", "text/html", true},
+		{"/sites/1/deploy/stream", "", false},
+		{"/sites/1/deploy/stream", "text/event-stream", false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("app.Test(%s): %v", tt.path, err)
+		}
+		gotGzip := resp.Header.Get("Content-Encoding") == "gzip"
+		if gotGzip != tt.wantGzip {
+			t.Errorf("%s: gzip = %v, want %v", tt.path, gotGzip, tt.wantGzip)
+		}
+	}
+}
@@ -12,33 +12,34 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// Dashboard renders the overview page. It only reads, so it can be given
+// the read-only database handle.
 func Dashboard(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		var customerCount, siteCount, serverCount, overdueCount int
+		var customerCount, serverCount, overdueCount int
 		var runningCount, stoppedCount, errorCount int
 		var serversOnline, serversOffline, serversUnknown int
 		var activeQuotes, quoteRequestsNew int
 		var monthlyRevenue float64
 
 		// Aggregate site counts in a single query.
-		if err := db.QueryRow(`SELECT
-			COUNT(*),
-			SUM(CASE WHEN status = 'running' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status = 'stopped' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END)
-			FROM sites`).Scan(&siteCount, &runningCount, &stoppedCount, &errorCount); err != nil {
+		siteCounts, siteCount, err := models.CountSitesByStatus(db, "")
+		if err != nil {
 			log.Printf("dashboard sites query failed: %v", err)
 		}
+		runningCount = siteCounts["running"]
+		stoppedCount = siteCounts["stopped"]
+		errorCount = siteCounts["error"]
 
 		// Aggregate server counts in a single query.
-		if err := db.QueryRow(`SELECT
-			COUNT(*),
-			SUM(CASE WHEN status IN ('online','active') THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status = 'offline' THEN 1 ELSE 0 END),
-			SUM(CASE WHEN status NOT IN ('online','active','offline') THEN 1 ELSE 0 END)
-			FROM servers`).Scan(&serverCount, &serversOnline, &serversOffline, &serversUnknown); err != nil {
+		serverCounts, err := models.CountServersByStatus(db)
+		if err != nil {
 			log.Printf("dashboard servers query failed: %v", err)
 		}
+		serverCount = serverCounts.Total
+		serversOnline = serverCounts.Online
+		serversOffline = serverCounts.Offline
+		serversUnknown = serverCounts.Unknown
 
 		// Customer and overdue payment counts.
 		if err := db.QueryRow("SELECT COUNT(*) FROM customers").Scan(&customerCount); err != nil {
@@ -58,6 +59,11 @@ func Dashboard(db *sql.DB) fiber.Handler {
 			log.Printf("dashboard: failed to load activities: %v", err)
 		}
 
+		expiringCerts, err := models.GetSitesWithExpiringCerts(db, models.CertExpiryWindowDays)
+		if err != nil {
+			log.Printf("dashboard: failed to load expiring certificates: %v", err)
+		}
+
 		revenueStr := fmt.Sprintf("$%.2f", monthlyRevenue)
 
 		data := pages.DashboardData{
@@ -75,6 +81,7 @@ func Dashboard(db *sql.DB) fiber.Handler {
 			QuoteRequestsNew: quoteRequestsNew,
 			MonthlyRevenue:   revenueStr,
 			Activities:       activities,
+			ExpiringCerts:    expiringCerts,
 		}
 
 		c.Set("Content-Type", "text/html")
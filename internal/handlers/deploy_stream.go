@@ -2,20 +2,78 @@ package handlers
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"ezweb/internal/docker"
+	"ezweb/internal/logging"
 	"ezweb/internal/models"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func DeploySSE(db *sql.DB) fiber.Handler {
+// sseHeartbeatInterval is how often the deploy stream writes a keep-alive
+// comment. It bounds how long a closed browser tab goes unnoticed.
+const sseHeartbeatInterval = 5 * time.Second
+
+// deployAbandoned reports whether a deploy the viewer walked away from
+// stopped before compose up. DeploySiteContext wraps context.Canceled only
+// for the steps before it, so any other failure, including one after the
+// viewer left, is a real deploy failure and is recorded as one.
+func deployAbandoned(deployErr error) bool {
+	return errors.Is(deployErr, context.Canceled)
+}
+
+// sseLineWriter turns command output into one message per line. Carriage
+// returns also end a line, so progress output that redraws itself in place
+// still arrives as it happens.
+type sseLineWriter struct {
+	mu   sync.Mutex
+	buf  []byte
+	emit func(line string)
+}
+
+func (w *sseLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexAny(w.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+		if line := strings.TrimSpace(string(w.buf[:i])); line != "" {
+			w.emit(line)
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits a final line that had no line ending.
+func (w *sseLineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if line := strings.TrimSpace(string(w.buf)); line != "" {
+		w.emit(line)
+	}
+	w.buf = nil
+}
+
+// DeploySSE deploys a site and streams progress as server-sent events. With
+// ?pull=1 the latest images are pulled first and the pull output is streamed
+// too; the pull counts against the site's deploy timeout. The compose file
+// of a local compose site is linted first, and lintPolicy decides whether
+// its findings are streamed as warnings or stop the deploy.
+func DeploySSE(db *sql.DB, lintPolicy string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
@@ -36,22 +94,98 @@ func DeploySSE(db *sql.DB) fiber.Handler {
 
 		clientIP := c.IP()
 		userAgent := c.Get("User-Agent")
+		username, _ := c.Locals("username").(string)
+
+		pull := c.QueryBool("pull")
+		prevStatus := site.Status
+		// Computed before the status flips to deploying so a first deploy
+		// still gets the longer image-pull allowance.
+		timeout := site.DeployTimeout()
+		reqDone := c.Context().Done()
 
 		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+
+			// clientCtx is cancelled when the viewer goes away. Only the
+			// connect/upload phase of a remote deploy honours it; local
+			// compose runs and anything past compose up finish regardless.
+			clientCtx, clientGone := context.WithCancel(ctx)
+			defer clientGone()
+
+			var mu sync.Mutex
+			disconnected := false
+			write := func(frame string) {
+				mu.Lock()
+				defer mu.Unlock()
+				if disconnected {
+					return
+				}
+				fmt.Fprint(w, frame)
+				if err := w.Flush(); err != nil {
+					disconnected = true
+					clientGone()
+				}
+			}
 			writeLine := func(msg string) {
-				fmt.Fprintf(w, "data: %s\n\n", msg)
-				_ = w.Flush()
+				write(fmt.Sprintf("data: %s\n\n", msg))
+			}
+			clientLeft := func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return disconnected
 			}
 
-			writeLine("Starting deployment...")
+			// Nothing is written while SSH is connecting, so a periodic SSE
+			// comment is what surfaces a closed tab as a write error.
+			go func() {
+				ticker := time.NewTicker(sseHeartbeatInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-clientCtx.Done():
+						return
+					case <-reqDone:
+						mu.Lock()
+						disconnected = true
+						mu.Unlock()
+						clientGone()
+						return
+					case <-ticker.C:
+						write(": ping\n\n")
+					}
+				}
+			}()
 
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-			defer cancel()
+			writeLine("Starting deployment...")
+			progress := &sseLineWriter{emit: writeLine}
 
 			var deployErr error
+			var compose string // what was uploaded, for the deploy history
+			details := "Deployed site " + site.Domain
 			if site.IsLocal && site.ComposePath != "" {
-				writeLine("Running docker compose up for local site...")
-				deployErr = docker.LocalComposeUp(ctx, site.ComposePath)
+				findings := lintComposeFile(docker.ReadLocalComposeFile(site.ComposePath))
+				if len(findings) > 0 && lintPolicy == docker.ComposeLintBlock {
+					writeLine("ERROR: Deploy refused, the compose file has risky settings: " + joinFindings(findings))
+					_ = models.UpdateSiteStatus(db, id, prevStatus)
+					writeLine("[DONE]")
+					return
+				}
+				for _, f := range findings {
+					writeLine("WARNING: " + f.String())
+				}
+				if len(findings) > 0 {
+					details += " despite compose warnings: " + joinFindings(findings)
+				}
+				if pull {
+					writeLine("Pulling latest images...")
+					deployErr = docker.LocalComposePull(ctx, site.ComposePath, progress)
+					progress.Flush()
+				}
+				if deployErr == nil {
+					writeLine("Running docker compose up for local site...")
+					deployErr = docker.LocalComposeUp(ctx, site.ComposePath)
+				}
 			} else {
 				if !site.ServerID.Valid {
 					writeLine("ERROR: No server assigned to this site")
@@ -68,25 +202,67 @@ func DeploySSE(db *sql.DB) fiber.Handler {
 					return
 				}
 
+				envContent, envErr := models.RenderDeployEnvFile(db, id, site.TemplateSlug)
+				if envErr != nil {
+					// Nothing has been touched yet, so keep the old status.
+					log.Printf("SSE deploy of site %d (%s) not started: %v", id, site.Domain, envErr)
+					writeLine(fmt.Sprintf("ERROR: %s", envErr.Error()))
+					_ = models.UpdateSiteStatus(db, id, prevStatus)
+					writeLine("[DONE]")
+					return
+				}
+
 				writeLine(fmt.Sprintf("Connecting to server %s...", server.Name))
-				writeLine("Deploying containers...")
-				envContent, _ := models.RenderEnvFile(db, id)
-				deployErr = docker.DeploySite(
-					server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey,
+				if site.IsGit() {
+					writeLine(fmt.Sprintf("Checking out %s (%s)...", site.GitURL, site.GitBranchLabel()))
+				}
+				if pull {
+					writeLine("Pulling latest images, then deploying containers...")
+				} else {
+					writeLine("Deploying containers...")
+				}
+				var extra map[string]string
+				extra, deployErr = models.ComposeExtraVars(db, id, site.TemplateSlug)
+				if deployErr == nil && !site.IsGit() {
+					compose, deployErr = docker.RenderSiteCompose(site.TemplateSlug, site.ContainerName, site.Domain, site.Port, extra)
+				}
+				if deployErr != nil {
+					log.Printf("SSE deploy of site %d (%s) not started: %v", id, site.Domain, deployErr)
+					writeLine(fmt.Sprintf("ERROR: %s", deployErr.Error()))
+					_ = models.UpdateSiteStatus(db, id, prevStatus)
+					writeLine("[DONE]")
+					return
+				}
+				deployErr = docker.DeploySiteContext(clientCtx, timeout, docker.DeployOptions{Pull: pull, Progress: progress, Compose: compose, Remote: server.DockerRemote(), Git: site.GitSource()},
+					server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath,
 					site.Domain, site.TemplateSlug, site.ContainerName, site.Port, envContent,
 				)
 			}
 
+			progress.Flush()
+
+			if clientLeft() && ctx.Err() == nil && deployAbandoned(deployErr) {
+				// The viewer left before compose up started; nothing was
+				// changed on the server's containers, so restore the old status.
+				log.Printf("SSE deploy cancelled for site %d (%s): client disconnected: %v", id, site.Domain, deployErr)
+				_ = models.UpdateSiteStatus(db, id, prevStatus)
+				return
+			}
+
+			recordDeploy(db, site, username, site.TemplateSlug, compose, 0, deployErr)
 			if deployErr != nil {
 				log.Printf("SSE deploy failed for site %d (%s): %v", id, site.Domain, deployErr)
 				writeLine(fmt.Sprintf("ERROR: %s", deployErr.Error()))
 				_ = models.UpdateSiteStatus(db, id, "error")
 			} else {
 				writeLine("Deployment completed successfully!")
-				_ = models.UpdateSiteStatus(db, id, "running")
-				models.LogActivityWithContext(db, "site", id, "deployed", "Deployed site "+site.Domain, clientIP, userAgent)
+				_ = models.MarkSiteDeployed(db, id)
+				models.LogActivityWithContext(db, "site", id, "deployed", details, clientIP, userAgent)
 			}
 
+			if clientLeft() {
+				logging.Infof("SSE deploy for site %d (%s) finished after client disconnected", id, site.Domain)
+			}
 			writeLine("[DONE]")
 		})
 
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSSELineWriter(t *testing.T) {
+	var got []string
+	w := &sseLineWriter{emit: func(line string) { got = append(got, line) }}
+
+	w.Write([]byte("web Pulling\nweb 12%\rweb 80"))
+	w.Write([]byte("%\rweb Pulled\r\n\n"))
+	w.Write([]byte("db Skipped"))
+	w.Flush()
+
+	want := []string{"web Pulling", "web 12%", "web 80%", "web Pulled", "db Skipped"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestDeployAbandoned(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{fmt.Errorf("deploy of web cancelled before compose up: %w", context.Canceled), true},
+		{fmt.Errorf("deploy of web cancelled before compose up (failed to write compose file: EOF): %w", context.Canceled), true},
+		{errors.New("docker compose up failed for web: exit status 1"), false},
+		{errors.New("deploy of web timed out after 5m0s"), false},
+	}
+	for _, tc := range cases {
+		if got := deployAbandoned(tc.err); got != tc.want {
+			t.Errorf("deployAbandoned(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+	"ezweb/internal/templates"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// siteHistoryLimit is how many deployments the site page lists.
+const siteHistoryLimit = 20
+
+// recordDeploy stores the outcome of a deploy or rollback in the site's
+// history. compose is the file that was uploaded, empty for local sites.
+// A failure to record is logged; it never fails the deploy itself.
+func recordDeploy(db *sql.DB, site *models.Site, username, templateSlug, compose string, rollbackOf int, deployErr error) {
+	d := &models.Deployment{
+		SiteID:       site.ID,
+		Username:     username,
+		TemplateSlug: templateSlug,
+		Compose:      compose,
+		Status:       models.DeploySucceeded,
+		RollbackOf:   rollbackOf,
+	}
+	if deployErr != nil {
+		d.Status = models.DeployFailed
+		d.Error = deployErr.Error()
+	}
+	if err := models.RecordDeployment(db, d); err != nil {
+		log.Printf("failed to record deployment of site %d: %v", site.ID, err)
+	}
+}
+
+// RollbackSite handles POST /sites/:id/rollback/:deployId. It uploads the
+// compose file of an earlier successful deployment and runs docker compose
+// up with it, along with the site's current env vars. The rollback is itself
+// recorded as a deployment.
+func RollbackSite(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+		deployID, err := strconv.Atoi(c.Params("deployId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid deployment ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+		target, err := models.GetDeployment(db, id, deployID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Deployment not found")
+		}
+		// Uploading an old compose file next to the checkout would not
+		// roll the repository back, only confuse which file is used.
+		if site.IsGit() {
+			return c.Status(fiber.StatusBadRequest).SendString("Sites deployed from git are rolled back by deploying an earlier commit to their branch")
+		}
+		if !target.CanRollBack() {
+			return c.Status(fiber.StatusBadRequest).SendString("Only successful deployments that still have their compose file can be rolled back to")
+		}
+		if !site.ServerID.Valid {
+			return c.Status(fiber.StatusBadRequest).SendString("No server assigned to this site")
+		}
+		server, err := models.GetServerByID(db, int(site.ServerID.Int64))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Assigned server not found")
+		}
+
+		envContent, err := models.RenderDeployEnvFile(db, id, target.TemplateSlug)
+		if err != nil {
+			var missing *templates.MissingVariablesError
+			if errors.As(err, &missing) {
+				return c.Status(fiber.StatusBadRequest).SendString("Cannot roll back: " + missing.Error() + ". Add them as environment variables.")
+			}
+			log.Printf("failed to render env file for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load environment variables")
+		}
+
+		username, _ := c.Locals("username").(string)
+		deployErr := docker.DeploySiteContext(context.Background(), site.DeployTimeout(), docker.DeployOptions{Compose: target.Compose, Remote: server.DockerRemote()},
+			server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath,
+			site.Domain, target.TemplateSlug, site.ContainerName, site.Port, envContent,
+		)
+		recordDeploy(db, site, username, target.TemplateSlug, target.Compose, target.ID, deployErr)
+		if deployErr != nil {
+			log.Printf("rollback of site %d (%s) to deployment %d failed: %v", id, site.Domain, target.ID, deployErr)
+			_ = models.UpdateSiteStatus(db, id, "error")
+			return c.Status(fiber.StatusInternalServerError).SendString("Rollback failed")
+		}
+
+		_ = models.MarkSiteDeployed(db, id)
+		models.LogActivityWithContext(db, "site", id, "rolled_back",
+			fmt.Sprintf("Rolled back site %s to deployment #%d", site.Domain, target.ID), c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/sites/"+strconv.Itoa(id))
+			return c.SendString("")
+		}
+		return c.Redirect("/sites/" + strconv.Itoa(id))
+	}
+}
+
+// ComposePreview handles GET /sites/:id/compose/preview. It returns the
+// compose file a deploy of the site would upload, with the generated
+// database passwords masked. With validate=1 the file is also checked with
+// "docker compose config" on the site's server; the result is prepended as
+// YAML comments, and a rejected file is answered with 422. A site without a
+// server is previewed unvalidated.
+func ComposePreview(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+		if site.IsLocal && site.ComposePath != "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Local sites deploy their own compose file: " + site.ComposePath)
+		}
+		if site.IsGit() {
+			return c.Status(fiber.StatusBadRequest).SendString("Git sites deploy the compose file in their repository: " + site.GitURL)
+		}
+
+		extra, err := models.ComposeExtraVars(db, id, site.TemplateSlug)
+		if err != nil {
+			log.Printf("failed to load compose variables for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load environment variables")
+		}
+		rendered, mask, err := docker.PreviewSiteCompose(site.TemplateSlug, site.ContainerName, site.Domain, site.Port, extra)
+		if err != nil {
+			log.Printf("compose preview failed for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to render compose file: " + err.Error())
+		}
+		masked := mask(rendered)
+
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		if c.Query("validate") != "1" {
+			return c.SendString(masked)
+		}
+
+		if !site.ServerID.Valid {
+			return c.SendString("# not validated: no server assigned to this site\n\n" + masked)
+		}
+		server, err := models.GetServerByID(db, int(site.ServerID.Int64))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Assigned server not found")
+		}
+
+		out, err := docker.ValidateComposeRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.UseSudo,
+			site.ContainerName, rendered)
+		header := "# docker compose config on " + server.Name + ": OK\n"
+		status := fiber.StatusOK
+		if err != nil {
+			log.Printf("compose validation failed for site %d on server %d: %v", id, server.ID, err)
+			header = "# docker compose config on " + server.Name + ": FAILED\n"
+			status = fiber.StatusUnprocessableEntity
+		}
+		if out != "" {
+			// The output can quote the file, passwords included.
+			header += "# " + strings.ReplaceAll(mask(out), "\n", "\n# ") + "\n"
+		}
+		return c.Status(status).SendString(header + "\n" + masked)
+	}
+}
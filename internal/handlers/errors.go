@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"ezweb/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// internalErrorMessage is the message of every 500 sent as JSON.
+const internalErrorMessage = "Internal server error"
+
+// wantsJSON reports whether errors for this request should be sent as JSON:
+// for the /api routes, and for any request that asks for JSON in its Accept
+// header. HTMX requests always get the plain text their error toast shows.
+func wantsJSON(c *fiber.Ctx) bool {
+	if c.Get("HX-Request") != "" {
+		return false
+	}
+	if p := c.Path(); p == "/api" || strings.HasPrefix(p, "/api/") {
+		return true
+	}
+	return strings.Contains(c.Get(fiber.HeaderAccept), fiber.MIMEApplicationJSON)
+}
+
+// errorCode is the machine-readable code sent with a JSON error: the HTTP
+// status text in snake case, e.g. "not_found" or "too_many_requests".
+func errorCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(utils.StatusMessage(status)), " ", "_")
+}
+
+// sendJSONError writes {"error": message, "code": code}. 4xx messages
+// describe what was wrong with the request and are passed through; a 5xx
+// message may carry internal detail, so only its status text is sent.
+func sendJSONError(c *fiber.Ctx, status int, message string) error {
+	switch {
+	case status == fiber.StatusInternalServerError:
+		message = internalErrorMessage
+	case status >= 500 || message == "":
+		message = utils.StatusMessage(status)
+	}
+	return c.Status(status).JSON(fiber.Map{"error": message, "code": errorCode(status)})
+}
+
+// ErrorHandler is the app's fiber.ErrorHandler for errors returned by
+// handlers. Clients that want JSON get {"error", "code"}, with the message
+// of a 4xx *fiber.Error; everyone else gets the plain "An error occurred".
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	code := fiber.StatusInternalServerError
+	message := ""
+	var e *fiber.Error
+	if errors.As(err, &e) {
+		code = e.Code
+		message = e.Message
+	}
+	logging.Log(logging.LevelError, "request failed",
+		"status", code,
+		"method", c.Method(),
+		"path", c.Path(),
+		"error", err.Error(),
+	)
+	if wantsJSON(c) {
+		return sendJSONError(c, code, message)
+	}
+	return c.Status(code).SendString("An error occurred")
+}
+
+// JSONErrors turns the error responses handlers write themselves into
+// ErrorHandler's JSON shape for clients that want JSON: a plain-text error
+// becomes {"error", "code"}, and a JSON {"error"} body gets its code. HTML
+// error pages and successful responses are left as they are.
+func JSONErrors() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := c.Next(); err != nil {
+			return err
+		}
+		status := c.Response().StatusCode()
+		if status < 400 || !wantsJSON(c) {
+			return nil
+		}
+
+		contentType := string(c.Response().Header.ContentType())
+		switch {
+		case strings.HasPrefix(contentType, fiber.MIMETextPlain):
+			return sendJSONError(c, status, strings.TrimSpace(string(c.Response().Body())))
+		case strings.HasPrefix(contentType, fiber.MIMEApplicationJSON):
+			var body map[string]any
+			if json.Unmarshal(c.Response().Body(), &body) != nil || body["error"] == nil || body["code"] != nil {
+				return nil
+			}
+			body["code"] = errorCode(status)
+			return c.Status(status).JSON(body)
+		}
+		return nil
+	}
+}
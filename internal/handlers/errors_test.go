@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestJSONErrors(t *testing.T) {
+	app := fiber.New(fiber.Config{DisableStartupMessage: true, ErrorHandler: ErrorHandler})
+	app.Use(JSONErrors())
+	badRequest := func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusBadRequest).SendString("Domain is required")
+	}
+	app.Get("/api/sites", badRequest)
+	app.Get("/sites", badRequest)
+	app.Get("/api/broken", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to query sites: database is locked")
+	})
+	app.Get("/api/failed", func(c *fiber.Ctx) error {
+		return errors.New("database is locked")
+	})
+	app.Get("/api/denied", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid token"})
+	})
+
+	tests := []struct {
+		name     string
+		path     string
+		headers  map[string]string
+		status   int
+		wantJSON bool
+		wantErr  string
+		wantCode string
+	}{
+		{"api text error", "/api/sites", nil, 400, true, "Domain is required", "bad_request"},
+		{"accept json", "/sites", map[string]string{"Accept": "application/json"}, 400, true, "Domain is required", "bad_request"},
+		{"htmx stays text", "/api/sites", map[string]string{"HX-Request": "true"}, 400, false, "Domain is required", ""},
+		{"browser stays text", "/sites", map[string]string{"Accept": "text/html"}, 400, false, "Domain is required", ""},
+		{"500 hides detail", "/api/broken", nil, 500, true, internalErrorMessage, "internal_server_error"},
+		{"returned error", "/api/failed", nil, 500, true, internalErrorMessage, "internal_server_error"},
+		{"returned error for browser", "/failed", map[string]string{"Accept": "text/html"}, 404, false, "An error occurred", ""},
+		{"unknown api route", "/api/nope", nil, 404, true, "Cannot GET /api/nope", "not_found"},
+		{"json error gets code", "/api/denied", nil, 401, true, "Invalid token", "unauthorized"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			body, _ := io.ReadAll(resp.Body)
+
+			if !tt.wantJSON {
+				if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+					t.Errorf("Content-Type = %q, want text/plain", ct)
+				}
+				if string(body) != tt.wantErr {
+					t.Errorf("body = %q, want %q", body, tt.wantErr)
+				}
+				return
+			}
+			var got struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+			}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("body %q is not JSON: %v", body, err)
+			}
+			if got.Error != tt.wantErr || got.Code != tt.wantCode {
+				t.Errorf("got {%q, %q}, want {%q, %q}", got.Error, got.Code, tt.wantErr, tt.wantCode)
+			}
+		})
+	}
+}
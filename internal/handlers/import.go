@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"html"
 	"log"
 	"strings"
@@ -13,6 +14,7 @@ import (
 	"ezweb/internal/docker"
 	"ezweb/internal/models"
 	"ezweb/views/pages"
+	"ezweb/views/partials"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -53,7 +55,10 @@ func ScanProjects(db *sql.DB) fiber.Handler {
 	}
 }
 
-func ImportProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+// ImportProject creates a site from a local compose project. The project's
+// compose file is linted first and lintPolicy, a docker.ComposeLint policy,
+// decides what its findings do.
+func ImportProject(db *sql.DB, caddyMgr *caddy.Manager, lintPolicy string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		composePath := strings.TrimSpace(c.FormValue("compose_path"))
 		domain := strings.TrimSpace(c.FormValue("domain"))
@@ -62,11 +67,23 @@ func ImportProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		if composePath == "" || domain == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("Compose path and domain are required")
 		}
-		if !validateDomain(domain) {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid domain format")
+		domain, err := models.NormalizeDomains(domain)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+
+		if existing, err := models.GetImportedSite(db, 0, composePath); err == nil {
+			return c.Status(fiber.StatusConflict).SendString(alreadyImported(existing))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("failed to check for an existing import of %s: %v", composePath, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to import project")
 		}
 
-		containerName := strings.ReplaceAll(domain, ".", "-")
+		containerName, err := models.FreeContainerName(db, strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-"))
+		if err != nil {
+			log.Printf("failed to pick a container name for %s: %v", domain, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to import project")
+		}
 
 		var routingConfig *models.RoutingConfig
 		if routingJSON != "" {
@@ -74,9 +91,18 @@ func ImportProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 			if err := json.Unmarshal([]byte(routingJSON), &rc); err != nil {
 				return c.Status(fiber.StatusBadRequest).SendString("Invalid routing config JSON")
 			}
+			if err := rc.HashBasicAuth(); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid routing config: " + err.Error())
+			}
 			routingConfig = &rc
 		}
 
+		findings := lintComposeFile(docker.ReadLocalComposeFile(composePath))
+		confirm := partials.ComposeImportRisks(findings, "/import", domain, composePath, routingJSON, "#scan-results", "innerHTML", false)
+		if ok, err := checkImportLint(c, lintPolicy, findings, confirm); !ok {
+			return err
+		}
+
 		site := &models.Site{
 			Domain:        domain,
 			ContainerName: containerName,
@@ -86,9 +112,12 @@ func ImportProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 			RoutingConfig: routingConfig,
 		}
 
-		if err := models.CreateSite(db, site); err != nil {
-			log.Printf("failed to import project: %v", err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to import project")
+		if ok, err := createSite(c, db, site, "Failed to import project"); !ok {
+			return err
+		}
+
+		if len(findings) > 0 {
+			log.Printf("imported %s from %s despite compose warnings: %s", domain, composePath, joinFindings(findings))
 		}
 
 		// Trigger Caddy reload
@@ -105,3 +134,13 @@ func ImportProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		return c.Redirect("/sites")
 	}
 }
+
+// alreadyImported is the conflict message for importing a compose project
+// that already backs site.
+func alreadyImported(site *models.Site) string {
+	msg := "This project is already imported as " + site.Domain
+	if site.DeletedAt.Valid {
+		msg += " (in the trash)"
+	}
+	return msg
+}
@@ -1,15 +1,20 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"ezweb/internal/docker"
+	"ezweb/internal/logging"
 	"ezweb/internal/models"
 	sshutil "ezweb/internal/ssh"
 	"ezweb/views/partials"
@@ -59,6 +64,11 @@ func GetSiteLogs(db *sql.DB) fiber.Handler {
 				return c.Status(fiber.StatusInternalServerError).SendString("Failed to get server")
 			}
 
+			remotePath, err := docker.RemoteSiteDir(server.DeployPath, site.ContainerName)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid remote site path: " + err.Error())
+			}
+
 			client, err := sshutil.NewClientWithHostKey(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey)
 			if err != nil {
 				log.Printf("SSH connection failed for site %d: %v", id, err)
@@ -66,11 +76,7 @@ func GetSiteLogs(db *sql.DB) fiber.Handler {
 			}
 			defer client.Close()
 
-			if err := docker.ValidateContainerName(site.ContainerName); err != nil {
-				return c.Status(fiber.StatusBadRequest).SendString("Invalid container name")
-			}
-
-			output, err = sshutil.RunCommand(client, fmt.Sprintf("cd /opt/ezweb/%s && docker compose logs --tail %d 2>&1", site.ContainerName, lines))
+			output, err = sshutil.RunCommand(client, docker.RemoteLogsCommand(server.DockerRemote(), remotePath, site.ContainerName, lines))
 			if err != nil {
 				log.Printf("failed to get remote logs for site %d: %v", id, err)
 				return c.Status(fiber.StatusInternalServerError).SendString("Failed to get logs")
@@ -93,6 +99,165 @@ func GetSiteLogs(db *sql.DB) fiber.Handler {
 	}
 }
 
+// logStreamMaxDuration caps a live log tail. It is kept under the server's
+// 10 minute WriteTimeout so the stream ends with a message rather than a
+// dropped connection; the viewer can start another one.
+const logStreamMaxDuration = 9 * time.Minute
+
+// StreamSiteLogs follows a site's compose logs and sends each line as an SSE
+// event, ending with "[DONE]". The docker process, local or over SSH, is
+// stopped when the viewer disconnects or the stream reaches
+// logStreamMaxDuration.
+func StreamSiteLogs(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+
+		tail := c.QueryInt("lines", 100)
+		if tail < 0 {
+			tail = 0
+		}
+		if tail > 2000 {
+			tail = 2000
+		}
+
+		var follow func(ctx context.Context, w io.Writer) error
+		if site.IsLocal && site.ComposePath != "" {
+			follow = func(ctx context.Context, w io.Writer) error {
+				return docker.LocalComposeLogsFollow(ctx, site.ComposePath, tail, w)
+			}
+		} else {
+			if !site.ServerID.Valid {
+				return c.Status(fiber.StatusBadRequest).SendString("Site has no server assigned")
+			}
+
+			server, err := models.GetServerByID(db, int(site.ServerID.Int64))
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to get server")
+			}
+
+			remotePath, err := docker.RemoteSiteDir(server.DeployPath, site.ContainerName)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid remote site path: " + err.Error())
+			}
+
+			// timeout(1) is a backstop in case the SSH connection dies
+			// without the remote sshd noticing, so logs -f can never outlive
+			// the stream by more than a minute.
+			cmd := docker.RemoteFollowLogsCommand(server.DockerRemote(), remotePath, site.ContainerName,
+				tail, int((logStreamMaxDuration + time.Minute).Seconds()))
+			follow = func(ctx context.Context, w io.Writer) error {
+				client, err := sshutil.NewClientWithHostKey(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey)
+				if err != nil {
+					return fmt.Errorf("SSH connection failed: %w", err)
+				}
+				defer client.Close()
+				return sshutil.StreamCommand(ctx, client, cmd, w)
+			}
+		}
+
+		c.Set("Content-Type", "text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("Transfer-Encoding", "chunked")
+
+		reqDone := c.Context().Done()
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			ctx, cancel := context.WithTimeout(context.Background(), logStreamMaxDuration)
+			defer cancel()
+
+			var mu sync.Mutex
+			disconnected := false
+			write := func(frame string) bool {
+				mu.Lock()
+				defer mu.Unlock()
+				if disconnected {
+					return false
+				}
+				fmt.Fprint(w, frame)
+				if err := w.Flush(); err != nil {
+					disconnected = true
+					cancel()
+					return false
+				}
+				return true
+			}
+			writeLine := func(msg string) bool {
+				return write(fmt.Sprintf("data: %s\n\n", msg))
+			}
+
+			// A quiet container writes nothing, so a periodic SSE comment is
+			// what surfaces a closed tab as a write error.
+			go func() {
+				ticker := time.NewTicker(sseHeartbeatInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-reqDone:
+						mu.Lock()
+						disconnected = true
+						mu.Unlock()
+						cancel()
+						return
+					case <-ticker.C:
+						write(": ping\n\n")
+					}
+				}
+			}()
+
+			pr, pw := io.Pipe()
+			followErr := make(chan error, 1)
+			go func() {
+				err := follow(ctx, pw)
+				pw.Close()
+				followErr <- err
+			}()
+
+			scanner := bufio.NewScanner(pr)
+			scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+			for scanner.Scan() {
+				if !writeLine(strings.TrimRight(scanner.Text(), "\r")) {
+					break
+				}
+			}
+
+			timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+			cancel()
+			pr.Close()
+			err := <-followErr
+
+			mu.Lock()
+			left := disconnected
+			mu.Unlock()
+			switch {
+			case left:
+				logging.Debugf("Log stream for site %d (%s) closed by client", id, site.Domain)
+				return
+			case timedOut:
+				writeLine(fmt.Sprintf("Live tail stopped after %d minutes", int(logStreamMaxDuration.Minutes())))
+			case err != nil:
+				log.Printf("log stream failed for site %d (%s): %v", id, site.Domain, err)
+				writeLine("ERROR: " + err.Error())
+			default:
+				writeLine("Log stream ended")
+			}
+			writeLine("[DONE]")
+		})
+
+		return nil
+	}
+}
+
 func GetSiteHealth(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
@@ -109,3 +274,71 @@ func GetSiteHealth(db *sql.DB) fiber.Handler {
 		return partials.HealthChecks(checks).Render(c.Context(), c.Response().BodyWriter())
 	}
 }
+
+// maxHealthSeriesHours caps the time-series range; beyond a week the chart
+// becomes unreadable and the query scans most of the retention window.
+const maxHealthSeriesHours = 168
+
+// GetSiteHealthTimeSeries returns a site's health history as evenly spaced
+// buckets of average latency and up/down ratio for charting. The bucket width
+// is 5 minutes for short ranges and widens so a range never exceeds ~288
+// points. Buckets with no checks are included with null values.
+func GetSiteHealthTimeSeries(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid site ID"})
+		}
+
+		if _, err := models.GetSiteByID(db, id); err != nil {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Site not found"})
+		}
+
+		hours := c.QueryInt("hours", 24)
+		if hours < 1 {
+			hours = 1
+		}
+		if hours > maxHealthSeriesHours {
+			hours = maxHealthSeriesHours
+		}
+
+		bucketSeconds := 300
+		if perPoint := hours * 3600 / 288; perPoint > bucketSeconds {
+			// Round up to a whole number of 5-minute slots.
+			bucketSeconds = (perPoint + 299) / 300 * 300
+		}
+
+		until := time.Now().UTC()
+		since := until.Add(-time.Duration(hours) * time.Hour)
+
+		buckets, err := models.GetHealthTimeSeries(db, id, since, until, bucketSeconds)
+		if err != nil {
+			log.Printf("failed to build health time series for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to load health history"})
+		}
+
+		type bucketJSON struct {
+			Time         string   `json:"t"`
+			Checks       int      `json:"checks"`
+			AvgLatencyMs *float64 `json:"avg_latency_ms"`
+			UpRatio      *float64 `json:"up_ratio"`
+		}
+
+		points := make([]bucketJSON, 0, len(buckets))
+		for _, b := range buckets {
+			points = append(points, bucketJSON{
+				Time:         b.Start.Format(time.RFC3339),
+				Checks:       b.Checks,
+				AvgLatencyMs: b.AvgLatencyMs,
+				UpRatio:      b.UpRatio,
+			})
+		}
+
+		return c.JSON(fiber.Map{
+			"site_id":        id,
+			"hours":          hours,
+			"bucket_seconds": bucketSeconds,
+			"buckets":        points,
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamSiteLogs_Local(t *testing.T) {
+	// A stand-in docker that prints two lines and exits, as compose logs -f
+	// does once every container has stopped.
+	bin := t.TempDir()
+	script := "#!/bin/sh\necho \"web-1  | $*\"\necho 'web-1  | listening on :3000'\n"
+	if err := os.WriteFile(filepath.Join(bin, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	site := &models.Site{
+		Domain:        "shop.example.com",
+		TemplateSlug:  "nodejs",
+		ContainerName: "shop-example-com",
+		Port:          3100,
+		Status:        "running",
+		IsLocal:       true,
+		ComposePath:   t.TempDir(),
+	}
+	if err := models.CreateSite(database, site); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/sites/:id/logs/stream", StreamSiteLogs(database))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/sites/"+strconv.Itoa(site.ID)+"/logs/stream?lines=5", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		"data: web-1  | compose -f " + site.ComposePath + "/docker-compose.yml logs --follow --tail 5 --no-color\n\n",
+		"data: web-1  | listening on :3000\n\n",
+		"data: Log stream ended\n\ndata: [DONE]\n\n",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("stream missing %q:\n%s", want, body)
+		}
+	}
+}
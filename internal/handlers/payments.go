@@ -3,7 +3,10 @@ package handlers
 import (
 	"database/sql"
 	"log"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"ezweb/internal/models"
 	"ezweb/views/pages"
@@ -19,10 +22,32 @@ func ListPayments(db *sql.DB) fiber.Handler {
 			page = 1
 		}
 
-		total, _ := models.CountPayments(db)
-		offset := (page - 1) * perPage
+		filter := models.PaymentFilter{
+			Query:   strings.TrimSpace(c.Query("q")),
+			Status:  strings.TrimSpace(c.Query("status")),
+			DueFrom: strings.TrimSpace(c.Query("due_from")),
+			DueTo:   strings.TrimSpace(c.Query("due_to")),
+		}
+		if filter.Status != "" && !slices.Contains(models.PaymentStatuses, filter.Status) {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid status filter")
+		}
+		if cid := c.Query("customer_id"); cid != "" {
+			id, err := strconv.Atoi(cid)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid customer ID")
+			}
+			filter.CustomerID = id
+		}
+		for _, d := range []string{filter.DueFrom, filter.DueTo} {
+			if d == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", d); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Due dates must be YYYY-MM-DD")
+			}
+		}
 
-		payments, err := models.GetPaymentsPaginated(db, perPage, offset)
+		payments, total, err := models.SearchPayments(db, filter, page, perPage)
 		if err != nil {
 			log.Printf("failed to list payments: %v", err)
 			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load payments")
@@ -41,7 +66,7 @@ func ListPayments(db *sql.DB) fiber.Handler {
 		}
 
 		c.Set("Content-Type", "text/html")
-		return pages.Payments(payments, customers, sites, page, total, perPage).Render(c.Context(), c.Response().BodyWriter())
+		return pages.Payments(payments, customers, sites, page, total, perPage, filter).Render(c.Context(), c.Response().BodyWriter())
 	}
 }
 
@@ -67,11 +92,17 @@ func CreatePayment(db *sql.DB) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).SendString("Notes must be 1000 characters or less")
 		}
 
+		recurrence := c.FormValue("recurrence", models.PaymentRecurrenceNone)
+		if !models.ValidPaymentRecurrence(recurrence) {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid recurrence")
+		}
+
 		p := &models.Payment{
 			CustomerID: customerID,
 			Amount:     amount,
 			DueDate:    dueDate,
 			Notes:      notes,
+			Recurrence: recurrence,
 		}
 
 		// Handle optional site_id
@@ -160,12 +191,18 @@ func UpdatePayment(db *sql.DB) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).SendString("Notes must be 1000 characters or less")
 		}
 
+		recurrence := c.FormValue("recurrence", models.PaymentRecurrenceNone)
+		if !models.ValidPaymentRecurrence(recurrence) {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid recurrence")
+		}
+
 		p := &models.Payment{
 			ID:         id,
 			CustomerID: customerID,
 			Amount:     amount,
 			DueDate:    dueDate,
 			Notes:      notes,
+			Recurrence: recurrence,
 		}
 
 		if siteIDStr := c.FormValue("site_id"); siteIDStr != "" {
@@ -210,6 +247,12 @@ func MarkPaid(db *sql.DB) fiber.Handler {
 
 		models.LogActivityWithContext(db, "payment", id, "paid", "Marked payment as paid", c.IP(), c.Get("User-Agent"))
 
+		// A recurring payment gets its next period as soon as it is paid
+		// rather than waiting for the background job.
+		if _, err := models.SpawnRecurringPayment(db, id, c.IP(), c.Get("User-Agent")); err != nil {
+			log.Printf("failed to generate next payment for #%d: %v", id, err)
+		}
+
 		payment, err := models.GetPaymentByID(db, id)
 		if err != nil {
 			log.Printf("failed to reload payment %d: %v", id, err)
@@ -224,6 +267,63 @@ func MarkPaid(db *sql.DB) fiber.Handler {
 	}
 }
 
+// BulkPaymentAction handles POST /payments/bulk. action is "mark-paid" or
+// "delete" and payment_ids may repeat. The action runs in one transaction;
+// payments that are already paid are left alone. The response reports how
+// many payments were changed.
+func BulkPaymentAction(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		action := c.FormValue("action")
+		if action != "mark-paid" && action != "delete" {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid action: " + action)
+		}
+
+		var ids []int
+		for _, rawID := range c.Request().PostArgs().PeekMulti("payment_ids") {
+			id, err := strconv.Atoi(string(rawID))
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			return c.Status(fiber.StatusBadRequest).SendString("No payments selected")
+		}
+
+		var changed []int
+		var err error
+		if action == "mark-paid" {
+			changed, err = models.MarkPaymentsPaid(db, ids)
+		} else {
+			changed, err = models.DeletePayments(db, ids)
+		}
+		if err != nil {
+			log.Printf("bulk %s failed: %v", action, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to update payments")
+		}
+
+		for _, id := range changed {
+			if action == "delete" {
+				models.LogActivityWithContext(db, "payment", id, "deleted", "Bulk deleted payment", c.IP(), c.Get("User-Agent"))
+				continue
+			}
+			models.LogActivityWithContext(db, "payment", id, "paid", "Bulk marked payment as paid", c.IP(), c.Get("User-Agent"))
+			if _, err := models.SpawnRecurringPayment(db, id, c.IP(), c.Get("User-Agent")); err != nil {
+				log.Printf("failed to generate next payment for #%d: %v", id, err)
+			}
+		}
+
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/payments")
+			return c.SendString("")
+		}
+		return c.JSON(fiber.Map{
+			"action":    action,
+			"processed": len(changed),
+		})
+	}
+}
+
 func CancelEditPayment(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
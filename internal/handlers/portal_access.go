@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"ezweb/internal/models"
+	"ezweb/internal/portal"
+	"ezweb/views/pages"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// portalTokenPrefixLen is how much of a portal link's token is kept in the
+// clear so the admin can tell links apart.
+const portalTokenPrefixLen = 8
+
+// CustomerPortalLinks handles GET /customers/:id/portal-links — lists the
+// customer's read-only portal links.
+func CustomerPortalLinks(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid customer ID")
+		}
+		customer, err := models.GetCustomerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Customer not found")
+		}
+		tokens, err := models.GetPortalAccessTokensByCustomerID(db, customer.ID)
+		if err != nil {
+			log.Printf("failed to load portal links for customer %d: %v", customer.ID, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load portal links")
+		}
+
+		c.Set("Content-Type", "text/html")
+		return pages.CustomerPortalLinks(*customer, tokens).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
+
+// CreatePortalLink handles POST /customers/:id/portal-links. The new link is
+// returned once, in the refreshed list; only its hash is stored.
+func CreatePortalLink(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid customer ID")
+		}
+		customer, err := models.GetCustomerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Customer not found")
+		}
+		plain, hash, err := portal.GenerateMagicToken()
+		if err != nil {
+			log.Printf("failed to generate portal link token: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to create portal link")
+		}
+		username, _ := c.Locals("username").(string)
+		token := &models.PortalAccessToken{
+			CustomerID:  customer.ID,
+			TokenHash:   hash,
+			TokenPrefix: plain[:portalTokenPrefixLen],
+			CreatedBy:   username,
+		}
+		if err := models.CreatePortalAccessToken(db, token); err != nil {
+			log.Printf("failed to store portal link for customer %d: %v", customer.ID, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to create portal link")
+		}
+
+		models.LogActivityWithContext(db, "customer", customer.ID, "portal_link_created",
+			fmt.Sprintf("Created portal link %s… for %s", token.TokenPrefix, customer.Name),
+			c.IP(), c.Get("User-Agent"))
+
+		return renderPortalLinkList(db, c, customer, c.BaseURL()+"/portal/"+plain)
+	}
+}
+
+// RevokePortalLink handles DELETE /customers/:id/portal-links/:tokenId. The
+// link stops working immediately.
+func RevokePortalLink(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid customer ID")
+		}
+		customer, err := models.GetCustomerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Customer not found")
+		}
+		tokenID, err := strconv.Atoi(c.Params("tokenId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid portal link ID")
+		}
+		if err := models.RevokePortalAccessToken(db, customer.ID, tokenID); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return c.Status(fiber.StatusNotFound).SendString("Portal link not found")
+			}
+			log.Printf("failed to revoke portal link %d: %v", tokenID, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to revoke portal link")
+		}
+
+		models.LogActivityWithContext(db, "customer", customer.ID, "portal_link_revoked",
+			fmt.Sprintf("Revoked portal link #%d for %s", tokenID, customer.Name),
+			c.IP(), c.Get("User-Agent"))
+
+		return renderPortalLinkList(db, c, customer, "")
+	}
+}
+
+func renderPortalLinkList(db *sql.DB, c *fiber.Ctx, customer *models.Customer, newLink string) error {
+	tokens, err := models.GetPortalAccessTokensByCustomerID(db, customer.ID)
+	if err != nil {
+		log.Printf("failed to load portal links for customer %d: %v", customer.ID, err)
+		return c.Status(fiber.StatusInternalServerError).SendString("Failed to load portal links")
+	}
+	c.Set("Content-Type", "text/html")
+	return pages.PortalLinkList(*customer, tokens, newLink).Render(c.Context(), c.Response().BodyWriter())
+}
+
+// PortalAccess handles GET /portal/:token — the read-only status page a
+// customer reaches through a portal link. It shows the customer's sites and
+// unpaid invoices and nothing else; unknown or revoked tokens get a 404.
+func PortalAccess(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, err := models.GetPortalAccessTokenByHash(db, portal.HashToken(c.Params("token")))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("This link is invalid or has been revoked.")
+		}
+		customer, err := models.GetCustomerByID(db, token.CustomerID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("This link is invalid or has been revoked.")
+		}
+
+		if err := models.TouchPortalAccessToken(db, token.ID); err != nil {
+			log.Printf("portal access: %v", err)
+		}
+		models.LogActivityWithContext(db, "customer", customer.ID, "portal_viewed",
+			fmt.Sprintf("Portal link %s… opened", token.TokenPrefix),
+			c.IP(), c.Get("User-Agent"))
+
+		sites, err := models.GetSitesByCustomerID(db, customer.ID)
+		if err != nil {
+			log.Printf("portal access: failed to load sites: %v", err)
+		}
+		payments, err := models.GetPaymentsByCustomerID(db, customer.ID)
+		if err != nil {
+			log.Printf("portal access: failed to load payments: %v", err)
+		}
+		var outstanding []models.Payment
+		for _, p := range payments {
+			if p.Status != "paid" {
+				outstanding = append(outstanding, p)
+			}
+		}
+
+		name, settings := portalSettings(db)
+		c.Set("Content-Type", "text/html")
+		c.Set("Referrer-Policy", "no-referrer")
+		c.Set("X-Robots-Tag", "noindex")
+		return pages.PortalStatus(customer, sites, outstanding, name, settings).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
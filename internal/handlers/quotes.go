@@ -562,7 +562,7 @@ func ConvertQuote(db *sql.DB) fiber.Handler {
 
 		containerName := strings.ReplaceAll(domain, ".", "-")
 
-		port, err := nextAvailablePort(db)
+		port, err := models.NextAvailablePort(db, false)
 		if err != nil {
 			log.Printf("failed to assign port for converted site (quote %d): %v", id, err)
 			port = 8080
@@ -574,12 +574,12 @@ func ConvertQuote(db *sql.DB) fiber.Handler {
 			CustomerID:    sql.NullInt64{Int64: int64(customerID), Valid: true},
 			ContainerName: containerName,
 			Port:          port,
+			AutoPort:      true,
 			Status:        "pending",
 		}
 
-		if err := models.CreateSite(db, site); err != nil {
-			log.Printf("failed to create site during quote %d conversion: %v", id, err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to create site record")
+		if ok, err := createSite(c, db, site, "Failed to create site record"); !ok {
+			return err
 		}
 
 		models.LogActivityWithContext(db, "site", site.ID, "created",
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+
+	"ezweb/internal/config"
+	"ezweb/internal/health"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Readyz is the readiness probe. Unlike /healthz, which only confirms the
+// process can reach its database, it answers 503 until the instance can do
+// its job: the Caddyfile can be rewritten, the backup directory exists and
+// the health checker has finished a first round, so site states are current.
+// Failures are logged with detail but reported to the unauthenticated caller
+// only by name.
+func Readyz(db *sql.DB, checker *health.Checker, caddyfilePath, backupDir string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ready := true
+		checks := fiber.Map{}
+		report := func(name string, err error, failure string) {
+			if err != nil {
+				log.Printf("readiness: %s: %v", name, err)
+				checks[name] = failure
+				ready = false
+				return
+			}
+			checks[name] = "ok"
+		}
+
+		report("db", db.Ping(), "unreachable")
+		report("caddyfile", config.CaddyfileWritable(caddyfilePath), "not writable")
+		if backupDir == "" {
+			checks["backup_dir"] = "disabled"
+		} else {
+			report("backup_dir", backupDirExists(backupDir), "missing")
+		}
+		if checker.Ready() {
+			checks["health_checker"] = "ok"
+		} else {
+			checks["health_checker"] = "starting"
+			ready = false
+		}
+
+		if !ready {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+				"status": "not ready",
+				"checks": checks,
+			})
+		}
+		return c.JSON(fiber.Map{"status": "ready", "checks": checks})
+	}
+}
+
+func backupDirExists(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
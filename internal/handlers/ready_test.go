@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+	"ezweb/internal/health"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestReadyz(t *testing.T) {
+	dir := t.TempDir()
+	database, err := db.Open(filepath.Join(dir, "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	checker := health.NewChecker(database, time.Hour, nil, 3, 30, 90, 0)
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/readyz", Readyz(database, checker, filepath.Join(dir, "Caddyfile"), dir))
+	app.Get("/readyz-nobackups", Readyz(database, checker, filepath.Join(dir, "Caddyfile"), filepath.Join(dir, "missing")))
+
+	status := func(path string) int {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if got := status("/readyz"); got != fiber.StatusServiceUnavailable {
+		t.Fatalf("before the first health round: status %d, want 503", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.Start(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for !checker.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("health checker never finished its first round")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := status("/readyz"); got != fiber.StatusOK {
+		t.Errorf("after the first health round: status %d, want 200", got)
+	}
+	if got := status("/readyz-nobackups"); got != fiber.StatusServiceUnavailable {
+		t.Errorf("missing backup dir: status %d, want 503", got)
+	}
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"ezweb/internal/caddy"
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxConcurrentDrains bounds how many sites a drain or resume stops or
+// starts at once, so a busy server is not hit with one SSH session per site.
+const maxConcurrentDrains = 4
+
+// forEachSiteBounded runs fn for every site, at most maxConcurrentDrains at a
+// time, and returns the errors in the order of sites.
+func forEachSiteBounded(sites []models.Site, fn func(models.Site) error) []error {
+	errs := make([]error, len(sites))
+	sem := make(chan struct{}, maxConcurrentDrains)
+	var wg sync.WaitGroup
+	for i := range sites {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = fn(sites[i])
+		}(i)
+	}
+	wg.Wait()
+	return errs
+}
+
+// setSiteContainers stops or starts a site's containers, through its local
+// compose file or over SSH on server, as StopSite and StartSite do.
+func setSiteContainers(server *models.Server, site models.Site, start bool) error {
+	if site.IsLocal && site.ComposePath != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		if start {
+			return docker.LocalComposeStart(ctx, site.ComposePath)
+		}
+		return docker.LocalComposeStop(ctx, site.ComposePath)
+	}
+	if start {
+		return docker.StartSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote())
+	}
+	return docker.StopSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote())
+}
+
+// DrainServer handles POST /servers/:id/drain. It stops every running site
+// on the server, a few at a time, and marks each one stopped and drained so
+// ResumeServer can bring back exactly those sites. With maintenance=1 the
+// sites are also put in maintenance mode and Caddy is reloaded, so visitors
+// get the maintenance page rather than a 502.
+func DrainServer(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid server ID")
+		}
+
+		server, err := models.GetServerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Server not found")
+		}
+
+		all, err := models.GetSitesByServerID(db, id)
+		if err != nil {
+			log.Printf("failed to get sites for server %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load sites")
+		}
+		var sites []models.Site
+		for _, s := range all {
+			if s.Status == "running" && s.Drained == "" {
+				sites = append(sites, s)
+			}
+		}
+
+		// Sites already in maintenance stay that way after a resume, so the
+		// drain only records maintenance for the ones it switches on.
+		maintenance := formFlag(c, "maintenance", false)
+		ip, ua := c.IP(), c.Get("User-Agent")
+		errs := forEachSiteBounded(sites, func(site models.Site) error {
+			if err := setSiteContainers(server, site, false); err != nil {
+				return err
+			}
+			if err := models.MarkSiteDrained(db, site.ID, maintenance && !site.Maintenance); err != nil {
+				return err
+			}
+			models.LogActivityWithContext(db, "site", site.ID, "stopped",
+				fmt.Sprintf("Stopped site %s (draining server %s)", site.Domain, server.Name), ip, ua)
+			return nil
+		})
+
+		drained := 0
+		for i, err := range errs {
+			if err != nil {
+				log.Printf("drain: failed to stop site %s on server %d: %v", sites[i].Domain, id, err)
+				continue
+			}
+			drained++
+		}
+
+		if maintenance && drained > 0 && caddyMgr != nil {
+			if err := caddyMgr.ReloadAll(db); err != nil {
+				log.Printf("caddy reload failed after draining server %d: %v", id, err)
+			}
+		}
+
+		details := fmt.Sprintf("Drained server %s: stopped %d of %d running site(s)", server.Name, drained, len(sites))
+		if maintenance {
+			details += ", maintenance page on"
+		}
+		models.LogActivityWithContext(db, "server", id, "drained", details, ip, ua)
+
+		if drained < len(sites) {
+			return c.Status(fiber.StatusBadGateway).SendString(
+				fmt.Sprintf("Stopped %d of %d sites; %d failed (see the log)", drained, len(sites), len(sites)-drained))
+		}
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/servers/"+strconv.Itoa(id))
+			return c.SendString("")
+		}
+		return c.Redirect("/servers/" + strconv.Itoa(id))
+	}
+}
+
+// ResumeServer handles POST /servers/:id/resume. It starts the sites a drain
+// stopped, marks them running, and takes them out of the maintenance mode the
+// drain turned on. Sites that were stopped before the drain stay stopped.
+func ResumeServer(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid server ID")
+		}
+
+		server, err := models.GetServerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Server not found")
+		}
+
+		all, err := models.GetSitesByServerID(db, id)
+		if err != nil {
+			log.Printf("failed to get sites for server %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load sites")
+		}
+		var sites []models.Site
+		for _, s := range all {
+			if s.Drained != "" {
+				sites = append(sites, s)
+			}
+		}
+
+		ip, ua := c.IP(), c.Get("User-Agent")
+		errs := forEachSiteBounded(sites, func(site models.Site) error {
+			if err := setSiteContainers(server, site, true); err != nil {
+				return err
+			}
+			if err := models.ResumeDrainedSite(db, site.ID); err != nil {
+				return err
+			}
+			models.LogActivityWithContext(db, "site", site.ID, "started",
+				fmt.Sprintf("Started site %s (resuming server %s)", site.Domain, server.Name), ip, ua)
+			return nil
+		})
+
+		resumed, reload := 0, false
+		for i, err := range errs {
+			if err != nil {
+				log.Printf("resume: failed to start site %s on server %d: %v", sites[i].Domain, id, err)
+				continue
+			}
+			resumed++
+			if sites[i].Drained == models.DrainMaintenance {
+				reload = true
+			}
+		}
+
+		if reload && caddyMgr != nil {
+			if err := caddyMgr.ReloadAll(db); err != nil {
+				log.Printf("caddy reload failed after resuming server %d: %v", id, err)
+			}
+		}
+
+		models.LogActivityWithContext(db, "server", id, "resumed",
+			fmt.Sprintf("Resumed server %s: started %d of %d drained site(s)", server.Name, resumed, len(sites)), ip, ua)
+
+		if resumed < len(sites) {
+			return c.Status(fiber.StatusBadGateway).SendString(
+				fmt.Sprintf("Started %d of %d sites; %d failed (see the log)", resumed, len(sites), len(sites)-resumed))
+		}
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/servers/"+strconv.Itoa(id))
+			return c.SendString("")
+		}
+		return c.Redirect("/servers/" + strconv.Itoa(id))
+	}
+}
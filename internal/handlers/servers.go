@@ -3,6 +3,8 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"html"
 	"log"
 	"os"
@@ -12,6 +14,8 @@ import (
 
 	"ezweb/internal/caddy"
 	"ezweb/internal/docker"
+	"ezweb/internal/health"
+	"ezweb/internal/logging"
 	"ezweb/internal/models"
 	sshutil "ezweb/internal/ssh"
 	"ezweb/views/pages"
@@ -42,16 +46,57 @@ func validateSSHKeyPath(keyPath string, allowedDir string) string {
 	return ""
 }
 
+// reloadRemoteUpstreams reloads Caddy when any site on server id proxies to
+// the server's host rather than localhost. Failures are logged; the server
+// update itself has already been saved.
+func reloadRemoteUpstreams(db *sql.DB, caddyMgr *caddy.Manager, id int) {
+	sites, err := models.GetSitesByServerID(db, id)
+	if err != nil {
+		log.Printf("failed to get sites for server %d: %v", id, err)
+		return
+	}
+	for _, site := range sites {
+		if site.IsLocal || site.RoutingConfig == nil || !site.RoutingConfig.RemoteUpstream {
+			continue
+		}
+		if err := caddyMgr.ReloadAll(db); err != nil {
+			log.Printf("caddy reload failed after changing host of server %d: %v", id, err)
+		}
+		return
+	}
+}
+
+// ListServers handles GET /servers. An optional ?tag= query narrows the list
+// to servers carrying that tag.
 func ListServers(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		servers, err := models.GetAllServers(db)
+		tag := strings.ToLower(strings.TrimSpace(c.Query("tag")))
+
+		var (
+			servers []models.Server
+			err     error
+		)
+		if tag != "" {
+			servers, err = models.GetServersByTag(db, tag)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid tag filter")
+			}
+		} else {
+			servers, err = models.GetAllServers(db)
+			if err != nil {
+				log.Printf("failed to list servers: %v", err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to load servers")
+			}
+		}
+
+		allTags, err := models.GetAllServerTags(db)
 		if err != nil {
-			log.Printf("failed to list servers: %v", err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load servers")
+			log.Printf("failed to list server tags: %v", err)
 		}
+
 		localInfo := docker.GetLocalServerInfo(context.Background())
 		c.Set("Content-Type", "text/html")
-		return pages.Servers(localInfo, servers).Render(c.Context(), c.Response().BodyWriter())
+		return pages.Servers(localInfo, servers, allTags, tag).Render(c.Context(), c.Response().BodyWriter())
 	}
 }
 
@@ -72,6 +117,9 @@ func CreateServerHandler(db *sql.DB, sshKeyDir ...string) fiber.Handler {
 			SSHPort:    port,
 			SSHUser:    c.FormValue("ssh_user", "root"),
 			SSHKeyPath: c.FormValue("ssh_key_path"),
+			DeployPath: strings.TrimSpace(c.FormValue("deploy_path")),
+			DeployMode: c.FormValue("deploy_mode", docker.DeployModeCompose),
+			UseSudo:    formFlag(c, "use_sudo", false),
 			Status:     "unknown",
 		}
 
@@ -79,10 +127,30 @@ func CreateServerHandler(db *sql.DB, sshKeyDir ...string) fiber.Handler {
 			return c.Status(fiber.StatusBadRequest).SendString("Name, host, and SSH key path are required")
 		}
 
+		host, err := sshutil.NormalizeHost(s.Host)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid host: " + err.Error())
+		}
+		s.Host = host
+
 		if msg := validateSSHKeyPath(s.SSHKeyPath, allowedDir); msg != "" {
 			return c.Status(fiber.StatusBadRequest).SendString(msg)
 		}
 
+		if err := docker.ValidateRemoteBasePath(s.DeployPath); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid deploy path: " + err.Error())
+		}
+
+		if !docker.ValidDeployMode(s.DeployMode) {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid deploy mode")
+		}
+
+		tags, err := models.NormalizeServerTags(c.FormValue("tags"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid tags: " + err.Error())
+		}
+		s.Tags = tags
+
 		if _, err := os.Stat(s.SSHKeyPath); err != nil {
 			return c.Status(fiber.StatusBadRequest).SendString("SSH key file not found")
 		}
@@ -126,7 +194,9 @@ func EditServerForm(db *sql.DB) fiber.Handler {
 	}
 }
 
-func UpdateServerHandler(db *sql.DB, sshKeyDir ...string) fiber.Handler {
+// UpdateServerHandler handles PUT /servers/:id. Sites with a remote upstream
+// proxy to the server's host, so a host change reloads Caddy for them.
+func UpdateServerHandler(db *sql.DB, caddyMgr *caddy.Manager, sshKeyDir ...string) fiber.Handler {
 	allowedDir := ""
 	if len(sshKeyDir) > 0 {
 		allowedDir = sshKeyDir[0]
@@ -149,16 +219,56 @@ func UpdateServerHandler(db *sql.DB, sshKeyDir ...string) fiber.Handler {
 			SSHPort:    port,
 			SSHUser:    c.FormValue("ssh_user", "root"),
 			SSHKeyPath: c.FormValue("ssh_key_path"),
+			DeployPath: strings.TrimSpace(c.FormValue("deploy_path")),
+			DeployMode: c.FormValue("deploy_mode", docker.DeployModeCompose),
 		}
 
 		if s.Name == "" || s.Host == "" || s.SSHKeyPath == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("Name, host, and SSH key path are required")
 		}
 
+		host, err := sshutil.NormalizeHost(s.Host)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid host: " + err.Error())
+		}
+		s.Host = host
+
 		if msg := validateSSHKeyPath(s.SSHKeyPath, allowedDir); msg != "" {
 			return c.Status(fiber.StatusBadRequest).SendString(msg)
 		}
 
+		if err := docker.ValidateRemoteBasePath(s.DeployPath); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid deploy path: " + err.Error())
+		}
+
+		if !docker.ValidDeployMode(s.DeployMode) {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid deploy mode")
+		}
+
+		// Sites already on the server were deployed the other way, and would
+		// be stopped or removed with the wrong commands after the switch.
+		current, err := models.GetServerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Server not found")
+		}
+		s.UseSudo = formFlag(c, "use_sudo", current.UseSudo)
+		if current.DeployMode != s.DeployMode {
+			hasSites, err := models.ServerHasSites(db, id)
+			if err != nil {
+				log.Printf("failed to check sites of server %d: %v", id, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to update server")
+			}
+			if hasSites {
+				return c.Status(fiber.StatusConflict).SendString("Move or delete this server's sites (including any in the trash) before changing its deploy mode")
+			}
+		}
+
+		tags, err := models.NormalizeServerTags(c.FormValue("tags"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid tags: " + err.Error())
+		}
+		s.Tags = tags
+
 		if err := models.UpdateServer(db, s); err != nil {
 			log.Printf("failed to update server %d: %v", id, err)
 			return c.Status(fiber.StatusInternalServerError).SendString("Failed to update server")
@@ -166,6 +276,10 @@ func UpdateServerHandler(db *sql.DB, sshKeyDir ...string) fiber.Handler {
 
 		models.LogActivityWithContext(db, "server", id, "updated", "Updated server "+s.Name, c.IP(), c.Get("User-Agent"))
 
+		if current.Host != s.Host && caddyMgr != nil {
+			reloadRemoteUpstreams(db, caddyMgr, id)
+		}
+
 		server, err := models.GetServerByID(db, id)
 		if err != nil {
 			log.Printf("failed to reload server %d: %v", id, err)
@@ -265,6 +379,7 @@ func ServerDetail(db *sql.DB) fiber.Handler {
 		var stats docker.RemoteServerStats
 		var projects []docker.ScannedProject
 		var containers []docker.RemoteContainer
+		var keyMismatch *sshutil.HostKeyMismatchError
 
 		// Only fetch remote data if we have a host key (connection was tested).
 		if server.SSHHostKey != "" {
@@ -272,15 +387,16 @@ func ServerDetail(db *sql.DB) fiber.Handler {
 			if sshErr == nil {
 				defer sshClient.Close()
 				stats, _ = docker.GetRemoteServerStats(sshClient)
-				projects, _ = docker.ScanRemoteProjects(sshClient)
-				containers, _ = docker.GetRemoteContainers(sshClient)
+				projects, _ = docker.ScanRemoteProjects(sshClient, server.UseSudo)
+				containers, _ = docker.GetRemoteContainers(sshClient, server.UseSudo)
 			} else {
 				log.Printf("SSH connect for server detail %d failed: %v", id, sshErr)
+				errors.As(sshErr, &keyMismatch)
 			}
 		}
 
 		c.Set("Content-Type", "text/html")
-		return pages.ServerDetailPage(*server, sites, stats, projects, containers).Render(c.Context(), c.Response().BodyWriter())
+		return pages.ServerDetailPage(*server, sites, stats, projects, containers, keyMismatch).Render(c.Context(), c.Response().BodyWriter())
 	}
 }
 
@@ -308,9 +424,12 @@ func DiscoverServerProjects(db *sql.DB) fiber.Handler {
 		}
 		defer sshClient.Close()
 
-		projects, err := docker.ScanRemoteProjects(sshClient)
+		projects, err := docker.ScanRemoteProjects(sshClient, server.UseSudo)
 		if err != nil {
 			log.Printf("remote project scan failed for server %d: %v", id, err)
+			if errors.Is(err, sshutil.ErrSudoPassword) {
+				return c.Status(fiber.StatusBadGateway).SendString("Failed to scan remote projects: " + sshutil.ErrSudoPassword.Error())
+			}
 			return c.Status(fiber.StatusInternalServerError).SendString("Failed to scan remote projects")
 		}
 
@@ -321,7 +440,7 @@ func DiscoverServerProjects(db *sql.DB) fiber.Handler {
 
 // ImportRemoteProject creates a new site from a discovered Docker project on
 // a remote server.
-func ImportRemoteProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+func ImportRemoteProject(db *sql.DB, caddyMgr *caddy.Manager, lintPolicy string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
@@ -334,8 +453,9 @@ func ImportRemoteProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		if domain == "" || composePath == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("Domain and compose path are required")
 		}
-		if !validateDomain(domain) {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid domain format")
+		domain, err = models.NormalizeDomains(domain)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 		}
 
 		server, err := models.GetServerByID(db, id)
@@ -343,7 +463,24 @@ func ImportRemoteProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 			return c.Status(fiber.StatusNotFound).SendString("Server not found")
 		}
 
-		containerName := strings.ReplaceAll(domain, ".", "-")
+		if existing, err := models.GetImportedSite(db, server.ID, composePath); err == nil {
+			return c.Status(fiber.StatusConflict).SendString(alreadyImported(existing))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("failed to check for an existing import of %s: %v", composePath, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to import project")
+		}
+
+		findings := lintComposeFile(docker.ReadRemoteComposeFile(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, composePath))
+		confirm := partials.ComposeImportRisks(findings, fmt.Sprintf("/servers/%d/import", server.ID), domain, composePath, "", "", "", true)
+		if ok, err := checkImportLint(c, lintPolicy, findings, confirm); !ok {
+			return err
+		}
+
+		containerName, err := models.FreeContainerName(db, strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-"))
+		if err != nil {
+			log.Printf("failed to pick a container name for %s: %v", domain, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to import project")
+		}
 
 		site := &models.Site{
 			Domain:        domain,
@@ -353,12 +490,15 @@ func ImportRemoteProject(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 			ComposePath:   composePath,
 		}
 
-		if err := models.CreateSite(db, site); err != nil {
-			log.Printf("failed to import remote project: %v", err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to import project")
+		if ok, err := createSite(c, db, site, "Failed to import project"); !ok {
+			return err
 		}
 
-		models.LogActivityWithContext(db, "site", site.ID, "created", "Imported remote project "+domain+" from server "+server.Name, c.IP(), c.Get("User-Agent"))
+		details := "Imported remote project " + domain + " from server " + server.Name
+		if len(findings) > 0 {
+			details += " despite compose warnings: " + joinFindings(findings)
+		}
+		models.LogActivityWithContext(db, "site", site.ID, "created", details, c.IP(), c.Get("User-Agent"))
 
 		if caddyMgr != nil {
 			if err := caddyMgr.AddSite(db, *site); err != nil {
@@ -387,28 +527,34 @@ func TestServerConnection(db *sql.DB) fiber.Handler {
 		}
 
 		// Fetch and pin host key on first connection, then authenticate with the pinned key.
-		if server.SSHHostKey == "" {
-			hostKey, hkErr := sshutil.GetHostKey(server.Host, server.SSHPort)
-			if hkErr != nil {
-				log.Printf("failed to probe host key for server %d (%s): %v", id, server.Host, hkErr)
-				if err := models.UpdateServerStatus(db, id, "offline"); err != nil {
-					log.Printf("failed to update status for server %d: %v", id, err)
-				}
-				return c.Status(fiber.StatusBadRequest).SendString("Failed to retrieve host key: " + hkErr.Error())
-			}
-			if dbErr := models.UpdateServerHostKey(db, id, hostKey); dbErr != nil {
-				log.Printf("failed to store host key for server %d: %v", id, dbErr)
+		if hkErr := health.PinHostKey(db, server); hkErr != nil {
+			log.Printf("failed to probe host key for server %d (%s): %v", id, server.Host, hkErr)
+			if err := models.UpdateServerStatus(db, id, "offline"); err != nil {
+				log.Printf("failed to update status for server %d: %v", id, err)
 			}
-			server.SSHHostKey = hostKey
+			return c.Status(fiber.StatusBadRequest).SendString("Failed to retrieve host key: " + hkErr.Error())
 		}
 
-		version, err := sshutil.TestConnection(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey)
+		version, err := sshutil.TestConnection(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.UseSudo)
 		status := "online"
-		if err != nil {
+		var mismatch *sshutil.HostKeyMismatchError
+		if errors.As(err, &mismatch) {
+			log.Printf("connection test for server %d: %v", id, err)
+			if err := models.UpdateServerStatus(db, id, "offline"); err != nil {
+				log.Printf("failed to update status for server %d: %v", id, err)
+			}
+			return c.Status(fiber.StatusConflict).SendString("Host key changed; review and re-pin it on the server page")
+		} else if errors.Is(err, sshutil.ErrSudoPassword) {
+			log.Printf("connection test for server %d: %v", id, err)
+			if err := models.UpdateServerStatus(db, id, "offline"); err != nil {
+				log.Printf("failed to update status for server %d: %v", id, err)
+			}
+			return c.Status(fiber.StatusBadGateway).SendString("Docker check failed: " + sshutil.ErrSudoPassword.Error())
+		} else if err != nil {
 			log.Printf("connection test failed for server %d (%s): %v", id, server.Host, err)
 			status = "offline"
 		} else {
-			log.Printf("server %d (%s) is online, Docker %s", id, server.Host, version)
+			logging.Infof("server %d (%s) is online, Docker %s", id, server.Host, version)
 		}
 
 		if err := models.UpdateServerStatus(db, id, status); err != nil {
@@ -428,3 +574,75 @@ func TestServerConnection(db *sql.DB) fiber.Handler {
 		return c.Redirect("/servers")
 	}
 }
+
+// RepinServerHostKey handles POST /servers/:id/host-key. It pins the key the
+// server presents now in place of the stored one, provided its fingerprint is
+// the one the admin confirmed (form field "fingerprint").
+func RepinServerHostKey(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid server ID")
+		}
+
+		server, err := models.GetServerByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Server not found")
+		}
+
+		confirmed := strings.TrimSpace(c.FormValue("fingerprint"))
+		if confirmed == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Fingerprint is required")
+		}
+
+		oldFP, newFP, err := health.RepinHostKey(db, server, confirmed)
+		if errors.Is(err, health.ErrHostKeyChanged) {
+			log.Printf("host key re-pin for server %d refused: confirmed %s, server offers %s", id, confirmed, newFP)
+			return c.Status(fiber.StatusConflict).SendString("The host key changed again; reload the page and check it")
+		}
+		if err != nil {
+			log.Printf("failed to re-pin host key for server %d: %v", id, err)
+			return c.Status(fiber.StatusBadGateway).SendString("Failed to re-pin host key")
+		}
+
+		models.LogActivityWithContext(db, "server", id, "host_key_repinned",
+			fmt.Sprintf("Re-pinned host key of %s: %s replaced %s", server.Name, newFP, oldFP), c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/servers/"+strconv.Itoa(id))
+			return c.SendString("")
+		}
+		return c.Redirect("/servers/" + strconv.Itoa(id))
+	}
+}
+
+// TestAllServersHandler handles POST /servers/test-all. It re-tests every
+// server concurrently, each under its own timeout, and renders a summary of
+// which servers came online or went offline.
+func TestAllServersHandler(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		servers, err := models.GetAllServers(db)
+		if err != nil {
+			log.Printf("failed to list servers: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load servers")
+		}
+
+		results := health.TestAllServers(db, servers)
+
+		online := 0
+		for _, r := range results {
+			if r.Status == "online" {
+				online++
+			}
+		}
+		models.LogActivityWithContext(db, "server", 0, "test_all",
+			fmt.Sprintf("Tested %d server(s): %d online, %d offline", len(results), online, len(results)-online),
+			c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("Content-Type", "text/html")
+			return partials.ServerTestResults(results).Render(c.Context(), c.Response().BodyWriter())
+		}
+		return c.Redirect("/servers")
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ezweb/internal/caddy"
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpdateServer_HostChangeReloadsRemoteUpstreams(t *testing.T) {
+	// A stand-in caddy that accepts every Caddyfile and logs each call.
+	bin := t.TempDir()
+	calls := filepath.Join(bin, "calls")
+	script := "#!/bin/sh\necho \"$1\" >> " + calls + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "caddy"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	keyDir := t.TempDir()
+	server := &models.Server{Name: "edge", Host: "10.0.0.5", SSHPort: 22, SSHUser: "root", SSHKeyPath: filepath.Join(keyDir, "id_ed25519")}
+	if err := models.CreateServer(database, server); err != nil {
+		t.Fatal(err)
+	}
+	site := &models.Site{
+		Domain:        "shop.example.com",
+		TemplateSlug:  "nodejs",
+		ContainerName: "shop-example-com",
+		Port:          3100,
+		Status:        "running",
+		ServerID:      sql.NullInt64{Int64: int64(server.ID), Valid: true},
+		RoutingConfig: &models.RoutingConfig{RemoteUpstream: true},
+	}
+	if err := models.CreateSite(database, site); err != nil {
+		t.Fatal(err)
+	}
+
+	caddyfile := filepath.Join(t.TempDir(), "Caddyfile")
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Put("/servers/:id", UpdateServerHandler(database, caddy.NewManager(caddyfile, ""), keyDir))
+
+	update := func(host string) {
+		t.Helper()
+		form := url.Values{"name": {"edge"}, "host": {host}, "ssh_key_path": {server.SSHKeyPath}}
+		req := httptest.NewRequest("PUT", "/servers/"+strconv.Itoa(server.ID), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := app.Test(req, int((5 * time.Second).Milliseconds()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != fiber.StatusFound {
+			t.Fatalf("update to %s: status %d", host, resp.StatusCode)
+		}
+	}
+
+	// Renaming the server leaves the upstream alone, so Caddy is not touched.
+	update("10.0.0.5")
+	if _, err := os.Stat(calls); !os.IsNotExist(err) {
+		t.Fatalf("caddy ran without a host change (stat err %v)", err)
+	}
+
+	update("10.0.0.9")
+	data, err := os.ReadFile(calls)
+	if err != nil {
+		t.Fatalf("caddy never ran after the host change: %v", err)
+	}
+	if !strings.Contains(string(data), "reload\n") {
+		t.Errorf("caddy calls = %q, want a reload", data)
+	}
+	written, err := os.ReadFile(caddyfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), "reverse_proxy 10.0.0.9:3100") {
+		t.Errorf("Caddyfile does not proxy to the new host:\n%s", written)
+	}
+}
@@ -10,8 +10,10 @@ import (
 	"strings"
 	"time"
 
+	"ezweb/internal/health"
 	"ezweb/internal/models"
 	"ezweb/views/pages"
+	"ezweb/views/partials"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -46,6 +48,36 @@ func SettingsPage(db *sql.DB) fiber.Handler {
 	}
 }
 
+// TestAlerts handles POST /settings/alerts/test.
+// It sends a sample down alert through every configured notifier and reports
+// the outcome per channel, including the exact error for channels that failed,
+// so webhook and SMTP settings can be verified without waiting for an outage.
+func TestAlerts(db *sql.DB, notifiers []health.Notifier) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		results := health.SendTestAlerts(notifiers)
+
+		failed := 0
+		for _, r := range results {
+			if !r.OK {
+				failed++
+				log.Printf("test alert via %s failed: %s", r.Channel, r.Error)
+			}
+		}
+		models.LogActivityWithContext(db, "settings", 0, "alert_test",
+			fmt.Sprintf("Sent test alert to %d channel(s), %d failed", len(results), failed),
+			c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("Content-Type", "text/html")
+			return partials.AlertTestResults(results).Render(c.Context(), c.Response().BodyWriter())
+		}
+		return c.JSON(fiber.Map{
+			"configured": len(results) > 0,
+			"results":    results,
+		})
+	}
+}
+
 // SaveSettings handles POST /settings.
 // It reads every known setting key from the form and bulk-upserts them.
 func SaveSettings(db *sql.DB) fiber.Handler {
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// siteConfigVersion is bumped when the export format changes incompatibly.
+const siteConfigVersion = 1
+
+// maxSiteConfigBytes caps the size of an uploaded site configuration.
+const maxSiteConfigBytes = 1 << 20
+
+// siteConfigFile is the JSON document produced by ExportSiteConfig and read
+// by ImportSiteConfig. It describes a site well enough to recreate it on
+// another EzWeb install. Install-specific references (server, customer) and
+// runtime state (status, SSL expiry, health history) are left out.
+type siteConfigFile struct {
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	Warning    string          `json:"warning,omitempty"`
+	Site       siteConfig      `json:"site"`
+	EnvVars    []siteConfigVar `json:"env_vars"`
+}
+
+type siteConfig struct {
+	Domain                string                `json:"domain"`
+	TemplateSlug          string                `json:"template_slug,omitempty"`
+	ContainerName         string                `json:"container_name"`
+	Port                  int                   `json:"port"`
+	IsLocal               bool                  `json:"is_local"`
+	ComposePath           string                `json:"compose_path,omitempty"`
+	RoutingConfig         *models.RoutingConfig `json:"routing_config,omitempty"`
+	DeployTimeoutSec      int                   `json:"deploy_timeout_sec,omitempty"`
+	HealthCheckMethod     string                `json:"health_check_method,omitempty"`
+	HealthCheckExpect     string                `json:"health_check_expect,omitempty"`
+	HealthCheckInsecure   bool                  `json:"health_check_insecure,omitempty"`
+	HealthCheckNoRedirect bool                  `json:"health_check_no_redirect,omitempty"`
+	QuietHours            string                `json:"quiet_hours,omitempty"`
+	QuietHoursTZ          string                `json:"quiet_hours_tz,omitempty"`
+	ComposeServices       string                `json:"compose_services,omitempty"`
+	// The deploy key of a git source is a file on the exporting host, so
+	// only the repository and branch are exported.
+	GitURL    string `json:"git_url,omitempty"`
+	GitBranch string `json:"git_branch,omitempty"`
+}
+
+// siteConfigVar is an environment variable in an export. Values are often
+// credentials, so every one is marked sensitive; Secret records whether the
+// variable is stored encrypted and masked in the UI.
+type siteConfigVar struct {
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	Sensitive bool   `json:"sensitive"`
+	Secret    bool   `json:"secret,omitempty"`
+}
+
+// validEnvKey reports whether key is a usable environment variable name:
+// letters, digits and underscores only.
+func validEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, ch := range key {
+		if !((ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// ExportSiteConfig downloads a site's configuration as JSON for
+// ImportSiteConfig on another install. Environment variable values are
+// included, so the file must be handled like a secret.
+func ExportSiteConfig(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+
+		envVars, err := models.GetEnvVarsBySiteID(db, id)
+		if err != nil {
+			log.Printf("failed to load env vars for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load env vars")
+		}
+
+		out := siteConfigFile{
+			Version:    siteConfigVersion,
+			ExportedAt: time.Now().UTC(),
+			Site: siteConfig{
+				Domain:                site.Domain,
+				TemplateSlug:          site.TemplateSlug,
+				ContainerName:         site.ContainerName,
+				Port:                  site.Port,
+				IsLocal:               site.IsLocal,
+				ComposePath:           site.ComposePath,
+				RoutingConfig:         site.RoutingConfig,
+				DeployTimeoutSec:      site.DeployTimeoutSec,
+				HealthCheckMethod:     site.HealthCheckMethod,
+				HealthCheckExpect:     site.HealthCheckExpect,
+				HealthCheckInsecure:   site.HealthCheckInsecure,
+				HealthCheckNoRedirect: site.HealthCheckNoRedirect,
+				QuietHours:            site.QuietHours,
+				QuietHoursTZ:          site.QuietHoursTZ,
+				ComposeServices:       site.ComposeServices,
+				GitURL:                site.GitURL,
+				GitBranch:             site.GitBranch,
+			},
+			EnvVars: make([]siteConfigVar, 0, len(envVars)),
+		}
+		for _, v := range envVars {
+			val, err := v.PlainValue()
+			if err != nil {
+				log.Printf("failed to decrypt env var for site %d: %v", id, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to decrypt env vars")
+			}
+			out.EnvVars = append(out.EnvVars, siteConfigVar{Key: v.Key, Value: val, Sensitive: true, Secret: v.IsSecret})
+		}
+		if len(out.EnvVars) > 0 {
+			out.Warning = "env_vars contains plaintext values that may include credentials; store and transfer this file securely"
+		}
+
+		models.LogActivityWithContext(db, "site", id, "exported",
+			fmt.Sprintf("Exported configuration of %s (%d env vars)", site.Domain, len(envVars)),
+			c.IP(), c.Get("User-Agent"))
+
+		filename := strings.ReplaceAll(site.Domain, ",", "_")
+		c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".ezweb.json"))
+		return c.JSON(out)
+	}
+}
+
+// readSiteConfig reads an export from an uploaded "file" form field or, if
+// there is none, from the request body.
+func readSiteConfig(c *fiber.Ctx) (*siteConfigFile, error) {
+	data := c.Body()
+	if fh, err := c.FormFile("file"); err == nil {
+		if fh.Size > maxSiteConfigBytes {
+			return nil, fmt.Errorf("file is too large")
+		}
+		f, err := fh.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read upload")
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(io.LimitReader(f, maxSiteConfigBytes)); err != nil {
+			return nil, fmt.Errorf("failed to read upload")
+		}
+	}
+	if len(data) > maxSiteConfigBytes {
+		return nil, fmt.Errorf("configuration is too large")
+	}
+
+	var cfg siteConfigFile
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	if cfg.Version != siteConfigVersion {
+		return nil, fmt.Errorf("unsupported export version %d", cfg.Version)
+	}
+	return &cfg, nil
+}
+
+// ImportSiteConfig recreates a site from an ExportSiteConfig document, sent
+// as the request body or uploaded as "file". A domain query parameter or form
+// field overrides the exported domain. The site gets a fresh port and container
+// name so it never collides with an existing one, and is created pending:
+// it has no server assigned and must be reviewed and deployed.
+func ImportSiteConfig(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg, err := readSiteConfig(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site configuration: " + err.Error())
+		}
+		src := cfg.Site
+
+		domain := strings.TrimSpace(c.Query("domain", c.FormValue("domain")))
+		if domain == "" {
+			domain = strings.TrimSpace(src.Domain)
+		}
+		if domain == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Domain is required")
+		}
+		domain, err = models.NormalizeDomains(domain)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		if src.TemplateSlug == "" && src.ComposePath == "" && src.GitURL == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Template, git repository or compose path is required")
+		}
+		if src.GitURL != "" {
+			if src.ComposePath != "" {
+				return c.Status(fiber.StatusBadRequest).SendString("A site imported from a compose file cannot also be deployed from git")
+			}
+			if err := docker.ValidateGitSource(docker.GitSource{URL: src.GitURL, Branch: src.GitBranch}); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid git source: " + err.Error())
+			}
+		} else {
+			src.GitBranch = ""
+		}
+		if src.TemplateSlug != "" {
+			if _, err := models.GetTemplateBySlug(db, src.TemplateSlug); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Unknown template: " + src.TemplateSlug)
+			}
+		}
+		if !models.ValidateComposePath(src.ComposePath) {
+			return c.Status(fiber.StatusBadRequest).SendString("Compose path must be an absolute path with no traversal")
+		}
+		if !validateDeployTimeout(src.DeployTimeoutSec) {
+			return c.Status(fiber.StatusBadRequest).SendString(deployTimeoutError)
+		}
+		healthMethod := strings.ToUpper(strings.TrimSpace(src.HealthCheckMethod))
+		if msg := validateHealthCheck(healthMethod, src.HealthCheckExpect); msg != "" {
+			return c.Status(fiber.StatusBadRequest).SendString(msg)
+		}
+		quietHours, err := models.NormalizeQuietHours(src.QuietHours)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Quiet hours: " + err.Error())
+		}
+		if err := models.ValidateQuietHoursTZ(src.QuietHoursTZ); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Quiet hours: " + err.Error())
+		}
+		composeServices, err := models.NormalizeComposeServices(src.ComposeServices)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		if err := src.RoutingConfig.HashBasicAuth(); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid routing config: " + err.Error())
+		}
+		if err := src.RoutingConfig.ValidateProxyModes(); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid routing config: " + err.Error())
+		}
+		for _, v := range cfg.EnvVars {
+			if !validEnvKey(v.Key) {
+				return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid env var key %q", v.Key))
+			}
+			if err := models.ValidateEnvValue(v.Value); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Invalid value for env var %s: %s", v.Key, err))
+			}
+		}
+
+		containerName := strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-")
+		if err := docker.ValidateContainerName(containerName); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid container name: " + err.Error())
+		}
+		containerName, err = models.FreeContainerName(db, containerName)
+		if err != nil {
+			log.Printf("failed to pick container name for imported site %s: %v", domain, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to assign container name")
+		}
+
+		port, err := models.NextAvailablePort(db, src.IsLocal)
+		if err != nil {
+			log.Printf("failed to assign port for imported site %s: %v", domain, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("No free port available")
+		}
+
+		// CloneFor re-points upstreams at the new port but drops the domain
+		// specific settings, which still apply to a moved site.
+		routing := src.RoutingConfig.CloneFor(src.Port, port)
+		if routing != nil {
+			routing.RedirectDomains = src.RoutingConfig.RedirectDomains
+			routing.TLSCertPath = src.RoutingConfig.TLSCertPath
+			routing.TLSKeyPath = src.RoutingConfig.TLSKeyPath
+		}
+
+		site := &models.Site{
+			Domain:            domain,
+			TemplateSlug:      src.TemplateSlug,
+			ContainerName:     containerName,
+			Port:              port,
+			AutoPort:          true,
+			Status:            "pending",
+			IsLocal:           src.IsLocal,
+			ComposePath:       src.ComposePath,
+			RoutingConfig:     routing,
+			DeployTimeoutSec:  src.DeployTimeoutSec,
+			HealthCheckMethod: healthMethod,
+			HealthCheckExpect: src.HealthCheckExpect,
+			QuietHours:        quietHours,
+			QuietHoursTZ:      src.QuietHoursTZ,
+
+			HealthCheckInsecure:   src.HealthCheckInsecure,
+			HealthCheckNoRedirect: src.HealthCheckNoRedirect,
+			ComposeServices:       composeServices,
+			GitURL:                src.GitURL,
+			GitBranch:             src.GitBranch,
+		}
+		if ok, err := createSite(c, db, site, "Failed to create site"); !ok {
+			return err
+		}
+		for _, v := range cfg.EnvVars {
+			if err := models.CreateEnvVar(db, site.ID, v.Key, v.Value, v.Secret); err != nil {
+				log.Printf("failed to import env var %s to site %d: %v", v.Key, site.ID, err)
+				// Don't leave behind a site that silently lacks configuration.
+				if delErr := models.DeleteSite(db, site.ID); delErr != nil {
+					log.Printf("failed to remove incomplete import %d: %v", site.ID, delErr)
+				}
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to import env vars")
+			}
+		}
+
+		models.LogActivityWithContext(db, "site", site.ID, "created",
+			fmt.Sprintf("Imported site %s from configuration export (%d env vars)", site.Domain, len(cfg.EnvVars)),
+			c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", fmt.Sprintf("/sites/%d", site.ID))
+			return c.SendString("")
+		}
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"id":             site.ID,
+			"domain":         site.Domain,
+			"container_name": site.ContainerName,
+			"port":           site.Port,
+			"status":         site.Status,
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSiteConfig_ExportImportRoundTrip(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	src := &models.Site{
+		Domain:        "shop.example.com",
+		TemplateSlug:  "nodejs",
+		ContainerName: "shop-example-com",
+		Port:          3100,
+		Status:        "running",
+		RoutingConfig: &models.RoutingConfig{
+			Rules:           []models.RoutingRule{{Upstream: "localhost:3100"}},
+			RedirectDomains: []string{"www.shop.example.com"},
+		},
+		QuietHours: "02:00-04:00",
+	}
+	if err := models.CreateSite(database, src); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateEnvVar(database, src.ID, "API_KEY", "s3cret", false); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/sites/:id/export.json", ExportSiteConfig(database))
+	app.Post("/sites/import.json", ImportSiteConfig(database))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/sites/1/export.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("export status = %d: %s", resp.StatusCode, exported)
+	}
+	var file siteConfigFile
+	if err := json.Unmarshal(exported, &file); err != nil {
+		t.Fatalf("export is not JSON: %v", err)
+	}
+	if len(file.EnvVars) != 1 || !file.EnvVars[0].Sensitive || file.EnvVars[0].Value != "s3cret" {
+		t.Errorf("env vars = %+v, want API_KEY flagged sensitive", file.EnvVars)
+	}
+
+	post := func(query string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/sites/import.json"+query, strings.NewReader(string(exported)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// The original domain is still in use on this install.
+	if resp := post(""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("import over existing domain: status = %d, want 409", resp.StatusCode)
+	}
+	if resp := post("?domain=not_a_domain"); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("import with invalid domain: status = %d, want 400", resp.StatusCode)
+	}
+	// A redirect domain claimed by the original is a conflict too.
+	if resp := post("?domain=www.shop.example.com"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("import onto a redirect domain: status = %d, want 409", resp.StatusCode)
+	}
+
+	// Free the redirect domain so a copy can be imported.
+	src.RoutingConfig.RedirectDomains = nil
+	if err := models.UpdateSite(database, src); err != nil {
+		t.Fatal(err)
+	}
+	resp = post("?domain=shop2.example.com")
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("import status = %d: %s", resp.StatusCode, body)
+	}
+	var created struct {
+		ID int `json:"id"`
+	}
+	json.Unmarshal(body, &created)
+
+	got, err := models.GetSiteByID(database, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "pending" || got.TemplateSlug != "nodejs" || got.QuietHours != "02:00-04:00" {
+		t.Errorf("imported site = %+v", got)
+	}
+	if got.Port == src.Port || got.ContainerName == src.ContainerName {
+		t.Errorf("imported site reuses port %d / container %q", got.Port, got.ContainerName)
+	}
+	if up := got.RoutingConfig.Rules[0].Upstream; up != "localhost:"+strconv.Itoa(got.Port) {
+		t.Errorf("upstream = %q, want the new port", up)
+	}
+	if d := got.RoutingConfig.RedirectDomains; len(d) != 1 || d[0] != "www.shop.example.com" {
+		t.Errorf("redirect domains = %v, want them kept", d)
+	}
+	vars, _ := models.GetEnvVarsBySiteID(database, got.ID)
+	if len(vars) != 1 || vars[0].Key != "API_KEY" || vars[0].Value != "s3cret" {
+		t.Errorf("env vars = %+v", vars)
+	}
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// UpdateSiteGitSource handles PUT /sites/:id/git. It sets the repository,
+// branch and deploy key a site is deployed from; an empty git_url switches
+// the site back to its template. The deploy key must be a file inside the
+// SSH key directory, the same as a server's SSH key, since a deploy copies
+// it to the site's server.
+func UpdateSiteGitSource(db *sql.DB, sshKeyDir string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+
+		g := docker.GitSource{
+			URL:     strings.TrimSpace(c.FormValue("git_url")),
+			Branch:  strings.TrimSpace(c.FormValue("git_branch")),
+			KeyPath: strings.TrimSpace(c.FormValue("git_key_path")),
+		}
+		details := "Switched site " + site.Domain + " to deploy from its template"
+		if g.URL != "" {
+			if site.ComposePath != "" {
+				return c.Status(fiber.StatusBadRequest).SendString("A site imported from a compose file cannot also be deployed from git")
+			}
+			if err := docker.ValidateGitSource(g); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid git source: " + err.Error())
+			}
+			if g.KeyPath != "" {
+				if msg := validateSSHKeyPath(g.KeyPath, sshKeyDir); msg != "" {
+					return c.Status(fiber.StatusBadRequest).SendString(strings.Replace(msg, "SSH key path", "Deploy key path", 1))
+				}
+				if _, err := os.Stat(g.KeyPath); err != nil {
+					return c.Status(fiber.StatusBadRequest).SendString("Deploy key file not found")
+				}
+			}
+			details = fmt.Sprintf("Set site %s to deploy %s from %s", site.Domain, g.BranchName(), g.URL)
+		} else if site.TemplateSlug == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("The site has no template to deploy from; pick one before removing the git source")
+		}
+
+		if err := models.UpdateSiteGitSource(db, id, g.URL, g.Branch, g.KeyPath); err != nil {
+			log.Printf("failed to update git source of site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to update git source")
+		}
+
+		models.LogActivityWithContext(db, "site", id, "updated", details, c.IP(), c.Get("User-Agent"))
+
+		target := fmt.Sprintf("/sites/%d", id)
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", target)
+			return c.SendString("")
+		}
+		return c.Redirect(target)
+	}
+}
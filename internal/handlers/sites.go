@@ -3,55 +3,84 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"html"
+	"io"
 	"log"
-	"path/filepath"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"ezweb/internal/caddy"
 	"ezweb/internal/docker"
+	"ezweb/internal/health"
 	"ezweb/internal/models"
+	"ezweb/internal/templates"
 	"ezweb/views/pages"
 	"ezweb/views/partials"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-var domainRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
-
-func validateDomain(domain string) bool {
-	if len(domain) == 0 || len(domain) > 253 {
-		return false
-	}
-	return domainRegex.MatchString(domain)
+// validateDeployTimeout accepts 0 (use the default) or a timeout in seconds
+// within the bounds allowed for a per-site override.
+func validateDeployTimeout(sec int) bool {
+	return sec == 0 || (sec >= models.MinDeployTimeoutSec && sec <= models.MaxDeployTimeoutSec)
 }
 
-func validatePort(port int) bool {
-	return port >= 1024 && port <= 65535
+var deployTimeoutError = fmt.Sprintf("Deploy timeout must be between %d and %d seconds, or blank for the default",
+	models.MinDeployTimeoutSec, models.MaxDeployTimeoutSec)
+
+// formFlag reads a checkbox field. Forms send a hidden "0" alongside the
+// checkbox so that unchecking it is distinguishable from omitting the field,
+// in which case current is kept.
+func formFlag(c *fiber.Ctx, name string, current bool) bool {
+	args := c.Request().PostArgs()
+	if !args.Has(name) {
+		return current
+	}
+	for _, v := range args.PeekMulti(name) {
+		if string(v) == "1" || string(v) == "on" {
+			return true
+		}
+	}
+	return false
 }
 
-// validateComposePath checks that a compose path is absolute, clean, and
-// contains no path traversal components.
-func validateComposePath(p string) bool {
-	if p == "" {
-		return true
+// validateHealthCheck checks a site's health check method and expected body
+// substring, returning an error message or "" when they are acceptable. HEAD
+// responses have no body, so they cannot be combined with a body check.
+func validateHealthCheck(method, expect string) string {
+	if method != "" && !slices.Contains(models.HealthCheckMethods, method) {
+		return "Health check method must be one of " + strings.Join(models.HealthCheckMethods, ", ")
 	}
-	if !filepath.IsAbs(p) {
-		return false
+	if len(expect) > models.MaxHealthCheckExpectLen {
+		return fmt.Sprintf("Expected response text must be at most %d characters", models.MaxHealthCheckExpectLen)
 	}
-	cleaned := filepath.Clean(p)
-	if cleaned != p {
-		return false
+	if method == "HEAD" && expect != "" {
+		return "Expected response text cannot be used with HEAD health checks"
 	}
-	for _, part := range strings.Split(cleaned, string(filepath.Separator)) {
-		if part == ".." {
-			return false
-		}
+	return ""
+}
+
+// createSite saves a new site through caddy.CreateSite. It reports whether
+// the site was created; when it was not, the response has been written and
+// err is what the handler returns: 409 for a host name or port another site
+// holds, 500 with failMsg otherwise.
+func createSite(c *fiber.Ctx, db *sql.DB, site *models.Site, failMsg string) (ok bool, err error) {
+	err = caddy.CreateSite(db, site)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, caddy.ErrDomainConflict):
+		return false, c.Status(fiber.StatusConflict).SendString(err.Error())
+	case errors.Is(err, models.ErrPortTaken):
+		return false, c.Status(fiber.StatusConflict).SendString(fmt.Sprintf("Port %d is already used by another site", site.Port))
 	}
-	return true
+	log.Printf("failed to create site %s: %v", site.Domain, err)
+	return false, c.Status(fiber.StatusInternalServerError).SendString(failMsg)
 }
 
 func ListSites(db *sql.DB) fiber.Handler {
@@ -118,44 +147,78 @@ func CreateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		if domain == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("Domain is required")
 		}
-		if !validateDomain(domain) {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid domain format")
+		domain, err := models.NormalizeDomains(domain)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 		}
 
 		templateSlug := c.FormValue("template_slug")
 		composePath := strings.TrimSpace(c.FormValue("compose_path"))
 		isLocal := c.FormValue("is_local") == "1" || c.FormValue("is_local") == "on"
 
-		if !validateComposePath(composePath) {
+		if !models.ValidateComposePath(composePath) {
 			return c.Status(fiber.StatusBadRequest).SendString("Compose path must be an absolute path with no traversal")
 		}
 
+		// A site deployed from git uses the compose file in its repository.
+		// The deploy key, if it needs one, is set on the site page.
+		gitURL := strings.TrimSpace(c.FormValue("git_url"))
+		gitBranch := strings.TrimSpace(c.FormValue("git_branch"))
+		if gitURL != "" {
+			if composePath != "" {
+				return c.Status(fiber.StatusBadRequest).SendString("A site imported from a compose file cannot also be deployed from git")
+			}
+			if err := docker.ValidateGitSource(docker.GitSource{URL: gitURL, Branch: gitBranch}); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Invalid git source: " + err.Error())
+			}
+		} else {
+			gitBranch = ""
+		}
+
 		// Template is required only for non-imported sites (no compose_path)
-		if templateSlug == "" && composePath == "" {
-			return c.Status(fiber.StatusBadRequest).SendString("Template or compose path is required")
+		// that are not deployed from git.
+		if templateSlug == "" && composePath == "" && gitURL == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Template, git repository or compose path is required")
 		}
 
 		containerName := c.FormValue("container_name")
 		if containerName == "" {
-			containerName = strings.ReplaceAll(domain, ".", "-")
+			containerName = strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-")
 		}
 
 		if err := docker.ValidateContainerName(containerName); err != nil {
 			return c.Status(fiber.StatusBadRequest).SendString("Invalid container name: " + err.Error())
 		}
+		// Two sites sharing a container name would clobber each other's
+		// containers on deploy.
+		if taken, err := models.ContainerNameTaken(db, containerName, 0); err != nil {
+			log.Printf("failed to check container name %q: %v", containerName, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to validate container name")
+		} else if taken {
+			return c.Status(fiber.StatusBadRequest).SendString("Container name is already used by another site")
+		}
 
 		port, err := strconv.Atoi(c.FormValue("port", "0"))
-		if err != nil || port == 0 {
-			port, err = nextAvailablePort(db)
+		autoPort := err != nil || port == 0
+		if autoPort {
+			port, err = models.NextAvailablePort(db, isLocal)
 			if err != nil {
 				log.Printf("failed to assign port: %v", err)
 				port = 8080
 			}
 		}
-		if !validatePort(port) {
+		if !models.ValidatePort(port) {
 			return c.Status(fiber.StatusBadRequest).SendString("Port must be between 1024 and 65535")
 		}
 
+		deployTimeout := 0
+		if v := strings.TrimSpace(c.FormValue("deploy_timeout")); v != "" {
+			deployTimeout, err = strconv.Atoi(v)
+			if err != nil || !validateDeployTimeout(deployTimeout) {
+				return c.Status(fiber.StatusBadRequest).SendString(deployTimeoutError)
+			}
+		}
+
 		var serverID sql.NullInt64
 		if sid := c.FormValue("server_id"); sid != "" {
 			if v, err := strconv.ParseInt(sid, 10, 64); err == nil {
@@ -170,22 +233,56 @@ func CreateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 			}
 		}
 
-		site := &models.Site{
-			Domain:        domain,
-			ServerID:      serverID,
-			TemplateSlug:  templateSlug,
-			CustomerID:    customerID,
-			ContainerName: containerName,
-			Port:          port,
-			Status:        "pending",
-			SSLEnabled:    false,
-			IsLocal:       isLocal,
-			ComposePath:   composePath,
+		// Values for the template's declared variables come in as env_<NAME>
+		// fields and are saved as site env vars. Checking them now fails the
+		// create instead of a later deploy.
+		var templateVars map[string]string
+		if composePath == "" {
+			templateVars = make(map[string]string)
+			for _, v := range templates.Variables(templateSlug) {
+				if val := strings.TrimSpace(c.FormValue("env_" + v.Name)); val != "" {
+					if err := models.ValidateEnvValue(val); err != nil {
+						return c.Status(fiber.StatusBadRequest).SendString(v.Name + ": " + err.Error())
+					}
+					templateVars[v.Name] = val
+				}
+			}
+			if _, err := templates.Resolve(templateSlug, templateVars); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Missing variables: " + err.Error())
+			}
 		}
 
-		if err := models.CreateSite(db, site); err != nil {
-			log.Printf("failed to create site: %v", err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to create site")
+		site := &models.Site{
+			Domain:           domain,
+			ServerID:         serverID,
+			TemplateSlug:     templateSlug,
+			CustomerID:       customerID,
+			ContainerName:    containerName,
+			Port:             port,
+			AutoPort:         autoPort,
+			Status:           "pending",
+			SSLEnabled:       false,
+			IsLocal:          isLocal,
+			ComposePath:      composePath,
+			DeployTimeoutSec: deployTimeout,
+			GitURL:           gitURL,
+			GitBranch:        gitBranch,
+		}
+
+		if ok, err := createSite(c, db, site, "Failed to create site"); !ok {
+			return err
+		}
+
+		// Without its variables the site would deploy broken, so a failure to
+		// save them undoes the create.
+		for key, val := range templateVars {
+			if err := models.CreateEnvVar(db, site.ID, key, val, false); err != nil {
+				log.Printf("failed to save env var %s for site %d: %v", key, site.ID, err)
+				if err := models.DeleteSite(db, site.ID); err != nil {
+					log.Printf("failed to remove site %d after its env vars failed to save: %v", site.ID, err)
+				}
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to save template variables")
+			}
 		}
 
 		// Trigger Caddy reload
@@ -211,6 +308,122 @@ func CreateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 	}
 }
 
+// CloneSite handles POST /sites/:id/clone.
+// It copies a site under a new domain, including its template or git source, server,
+// customer, deploy timeout, routing config, and env vars, with a fresh port
+// and container name. The clone is created in pending status and is not
+// deployed. SSL expiry and health history are not copied.
+func CloneSite(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		src, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+		// An imported site is defined by its compose file on disk; a clone
+		// would share that file and control the original's containers.
+		if src.ComposePath != "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Sites imported from a compose file cannot be cloned")
+		}
+
+		domain := strings.TrimSpace(c.FormValue("domain"))
+		if domain == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Domain is required")
+		}
+		domain, err = models.NormalizeDomains(domain)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+		}
+		containerName := strings.TrimSpace(c.FormValue("container_name"))
+		if containerName == "" {
+			containerName = strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-")
+		}
+		if err := docker.ValidateContainerName(containerName); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid container name: " + err.Error())
+		}
+		if taken, err := models.ContainerNameTaken(db, containerName, 0); err != nil {
+			log.Printf("failed to check container name %q: %v", containerName, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to validate container name")
+		} else if taken {
+			return c.Status(fiber.StatusBadRequest).SendString("Container name is already used by another site")
+		}
+
+		envVars, err := models.GetEnvVarsBySiteID(db, id)
+		if err != nil {
+			log.Printf("failed to load env vars for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load env vars")
+		}
+
+		port, err := models.NextAvailablePort(db, src.IsLocal)
+		if err != nil {
+			log.Printf("failed to assign port for clone of site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("No free port available")
+		}
+
+		clone := &models.Site{
+			Domain:            domain,
+			ServerID:          src.ServerID,
+			TemplateSlug:      src.TemplateSlug,
+			CustomerID:        src.CustomerID,
+			ContainerName:     containerName,
+			Port:              port,
+			AutoPort:          true,
+			Status:            "pending",
+			IsLocal:           src.IsLocal,
+			RoutingConfig:     src.RoutingConfig.CloneFor(src.Port, port),
+			DeployTimeoutSec:  src.DeployTimeoutSec,
+			HealthCheckMethod: src.HealthCheckMethod,
+			HealthCheckExpect: src.HealthCheckExpect,
+			QuietHours:        src.QuietHours,
+			QuietHoursTZ:      src.QuietHoursTZ,
+
+			HealthCheckInsecure:   src.HealthCheckInsecure,
+			HealthCheckNoRedirect: src.HealthCheckNoRedirect,
+			ComposeServices:       src.ComposeServices,
+			GitURL:                src.GitURL,
+			GitBranch:             src.GitBranch,
+			GitKeyPath:            src.GitKeyPath,
+		}
+
+		if ok, err := createSite(c, db, clone, "Failed to create site"); !ok {
+			return err
+		}
+
+		for _, v := range envVars {
+			val, err := v.PlainValue()
+			if err == nil {
+				err = models.CreateEnvVar(db, clone.ID, v.Key, val, v.IsSecret)
+			}
+			if err != nil {
+				log.Printf("failed to copy env var %s to site %d: %v", v.Key, clone.ID, err)
+				// Don't leave behind a clone that silently lacks configuration.
+				if delErr := models.DeleteSite(db, clone.ID); delErr != nil {
+					log.Printf("failed to remove incomplete clone %d: %v", clone.ID, delErr)
+				}
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to copy env vars")
+			}
+		}
+
+		// Pending sites are skipped by the Caddyfile generator, so there is
+		// nothing to reload until the clone is deployed.
+
+		models.LogActivityWithContext(db, "site", clone.ID, "created",
+			fmt.Sprintf("Cloned site %s from %s (%d env vars)", clone.Domain, src.Domain, len(envVars)),
+			c.IP(), c.Get("User-Agent"))
+
+		target := fmt.Sprintf("/sites/%d", clone.ID)
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", target)
+			return c.SendString("")
+		}
+		return c.Redirect(target)
+	}
+}
+
 func SiteDetail(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
@@ -226,13 +439,20 @@ func SiteDetail(db *sql.DB) fiber.Handler {
 		servers, _ := models.GetAllServers(db)
 		templates, _ := models.GetAllTemplates(db)
 		customers, _ := models.GetAllCustomers(db)
+		deployments, err := models.GetDeploymentsBySiteID(db, id, siteHistoryLimit)
+		if err != nil {
+			log.Printf("failed to load deployments for site %d: %v", id, err)
+		}
 
 		c.Set("Content-Type", "text/html")
-		return pages.SiteDetailPage(*site, servers, templates, customers).Render(c.Context(), c.Response().BodyWriter())
+		return pages.SiteDetailPage(*site, servers, templates, customers, deployments).Render(c.Context(), c.Response().BodyWriter())
 	}
 }
 
-func DeploySite(db *sql.DB) fiber.Handler {
+// DeploySite deploys a site. The compose file of a local compose site is
+// linted first: under the block policy a finding refuses the deploy, under
+// warn the findings are recorded in the activity log.
+func DeploySite(db *sql.DB, lintPolicy string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
@@ -244,10 +464,33 @@ func DeploySite(db *sql.DB) fiber.Handler {
 			return c.Status(fiber.StatusNotFound).SendString("Site not found")
 		}
 
+		// pull=1 fetches the latest images before starting the containers.
+		pull := c.FormValue("pull") == "1"
+		username, _ := c.Locals("username").(string)
+
+		details := "Deployed site " + site.Domain
 		if site.IsLocal && site.ComposePath != "" {
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+			findings := lintComposeFile(docker.ReadLocalComposeFile(site.ComposePath))
+			if len(findings) > 0 {
+				if lintPolicy == docker.ComposeLintBlock {
+					return c.Status(fiber.StatusUnprocessableEntity).SendString("Deploy refused, the compose file has risky settings: " + joinFindings(findings))
+				}
+				details += " despite compose warnings: " + joinFindings(findings)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), site.DeployTimeout())
 			defer cancel()
-			if err := docker.LocalComposeUp(ctx, site.ComposePath); err != nil {
+			if pull {
+				if err := docker.LocalComposePull(ctx, site.ComposePath, io.Discard); err != nil {
+					log.Printf("local image pull failed for site %d (%s): %v", id, site.Domain, err)
+					recordDeploy(db, site, username, site.TemplateSlug, "", 0, err)
+					_ = models.UpdateSiteStatus(db, id, "error")
+					return c.Status(fiber.StatusInternalServerError).SendString("Pulling images failed")
+				}
+			}
+			err := docker.LocalComposeUp(ctx, site.ComposePath)
+			recordDeploy(db, site, username, site.TemplateSlug, "", 0, err)
+			if err != nil {
 				log.Printf("local deploy failed for site %d (%s): %v", id, site.Domain, err)
 				_ = models.UpdateSiteStatus(db, id, "error")
 				return c.Status(fiber.StatusInternalServerError).SendString("Deploy failed")
@@ -262,19 +505,43 @@ func DeploySite(db *sql.DB) fiber.Handler {
 				return c.Status(fiber.StatusNotFound).SendString("Assigned server not found")
 			}
 
-			envContent, _ := models.RenderEnvFile(db, id)
-			if err := docker.DeploySite(
-				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey,
+			envContent, err := models.RenderDeployEnvFile(db, id, site.TemplateSlug)
+			if err != nil {
+				var missing *templates.MissingVariablesError
+				if errors.As(err, &missing) {
+					return c.Status(fiber.StatusBadRequest).SendString("Cannot deploy: " + missing.Error() + ". Add them as environment variables.")
+				}
+				log.Printf("failed to render env file for site %d: %v", id, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to load environment variables")
+			}
+			extra, err := models.ComposeExtraVars(db, id, site.TemplateSlug)
+			if err != nil {
+				log.Printf("failed to load compose variables for site %d: %v", id, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to load environment variables")
+			}
+			// A git site deploys the compose file in its repository.
+			var compose string
+			if !site.IsGit() {
+				compose, err = docker.RenderSiteCompose(site.TemplateSlug, site.ContainerName, site.Domain, site.Port, extra)
+				if err != nil {
+					log.Printf("failed to render compose file for site %d: %v", id, err)
+					return c.Status(fiber.StatusInternalServerError).SendString("Failed to render compose file: " + err.Error())
+				}
+			}
+			err = docker.DeploySiteContext(context.Background(), site.DeployTimeout(), docker.DeployOptions{Pull: pull, Compose: compose, Remote: server.DockerRemote(), Git: site.GitSource()},
+				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath,
 				site.Domain, site.TemplateSlug, site.ContainerName, site.Port, envContent,
-			); err != nil {
+			)
+			recordDeploy(db, site, username, site.TemplateSlug, compose, 0, err)
+			if err != nil {
 				log.Printf("deploy failed for site %d (%s): %v", id, site.Domain, err)
 				_ = models.UpdateSiteStatus(db, id, "error")
 				return c.Status(fiber.StatusInternalServerError).SendString("Deployment failed")
 			}
 		}
 
-		_ = models.UpdateSiteStatus(db, id, "running")
-		models.LogActivityWithContext(db, "site", id, "deployed", "Deployed site "+site.Domain, c.IP(), c.Get("User-Agent"))
+		_ = models.MarkSiteDeployed(db, id)
+		models.LogActivityWithContext(db, "site", id, "deployed", details, c.IP(), c.Get("User-Agent"))
 
 		site, _ = models.GetSiteByID(db, id)
 		if c.Get("HX-Request") != "" {
@@ -315,7 +582,7 @@ func StartSite(db *sql.DB) fiber.Handler {
 			}
 
 			if err := docker.StartSiteRemote(
-				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName,
+				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote(),
 			); err != nil {
 				log.Printf("start failed for site %d: %v", id, err)
 				return c.Status(fiber.StatusInternalServerError).SendString("Start failed")
@@ -364,7 +631,7 @@ func StopSite(db *sql.DB) fiber.Handler {
 			}
 
 			if err := docker.StopSiteRemote(
-				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName,
+				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote(),
 			); err != nil {
 				log.Printf("stop failed for site %d: %v", id, err)
 				return c.Status(fiber.StatusInternalServerError).SendString("Stop failed")
@@ -383,6 +650,52 @@ func StopSite(db *sql.DB) fiber.Handler {
 	}
 }
 
+// ToggleSiteMaintenance switches a site in or out of maintenance mode and
+// reloads Caddy so visitors get the maintenance page (or the site again). The
+// flag is rolled back if the reload fails.
+func ToggleSiteMaintenance(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+
+		on := !site.Maintenance
+		if err := models.SetSiteMaintenance(db, id, on); err != nil {
+			log.Printf("failed to toggle maintenance for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to update maintenance mode")
+		}
+
+		if caddyMgr != nil {
+			if err := caddyMgr.AddSite(db, *site); err != nil {
+				log.Printf("caddy reload failed after toggling maintenance for site %s: %v", site.Domain, err)
+				if rbErr := models.SetSiteMaintenance(db, id, !on); rbErr != nil {
+					log.Printf("failed to roll back maintenance for site %d: %v", id, rbErr)
+				}
+				return c.Status(fiber.StatusInternalServerError).SendString("Caddy reload failed")
+			}
+		}
+
+		action, details := "maintenance_off", "Took site "+site.Domain+" out of maintenance"
+		if on {
+			action, details = "maintenance_on", "Put site "+site.Domain+" into maintenance"
+		}
+		models.LogActivityWithContext(db, "site", id, action, details, c.IP(), c.Get("User-Agent"))
+
+		site, _ = models.GetSiteByID(db, id)
+		if c.Get("HX-Request") != "" {
+			c.Set("Content-Type", "text/html")
+			return partials.SiteRow(*site).Render(c.Context(), c.Response().BodyWriter())
+		}
+		return c.Redirect("/sites/" + strconv.Itoa(id))
+	}
+}
+
 func RestartSite(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
@@ -413,7 +726,7 @@ func RestartSite(db *sql.DB) fiber.Handler {
 			}
 
 			if err := docker.RestartSiteRemote(
-				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName,
+				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote(),
 			); err != nil {
 				log.Printf("restart failed for site %d: %v", id, err)
 				return c.Status(fiber.StatusInternalServerError).SendString("Restart failed")
@@ -432,7 +745,12 @@ func RestartSite(db *sql.DB) fiber.Handler {
 	}
 }
 
-func DeleteSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+// DeleteSite handles DELETE /sites/:id. With a trash window (trashDays > 0)
+// the site is moved to the trash: it is dropped from the Caddyfile and its
+// containers are stopped, unless keep_running=1 is sent, but nothing is
+// destroyed until the health checker purges it. With trashDays 0 the site is
+// purged immediately.
+func DeleteSite(db *sql.DB, caddyMgr *caddy.Manager, trashDays int) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
 		if err != nil {
@@ -443,32 +761,30 @@ func DeleteSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		if err != nil {
 			return c.Status(fiber.StatusNotFound).SendString("Site not found")
 		}
+		domain := site.Domain
 
-		// Attempt remote cleanup if a server is assigned (non-local)
-		if !site.IsLocal && site.ServerID.Valid {
-			server, err := models.GetServerByID(db, int(site.ServerID.Int64))
-			if err == nil {
-				if rmErr := docker.RemoveSiteRemote(
-					server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName,
-				); rmErr != nil {
-					log.Printf("remote cleanup failed for site %d: %v (continuing with DB delete)", id, rmErr)
+		if trashDays > 0 {
+			if err := models.TrashSite(db, id); err != nil {
+				log.Printf("failed to trash site %d: %v", id, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to delete site")
+			}
+			if c.FormValue("keep_running") != "1" {
+				if err := stopSiteContainers(db, site); err != nil {
+					log.Printf("failed to stop trashed site %d: %v", id, err)
+				} else {
+					_ = models.UpdateSiteStatus(db, id, "stopped")
 				}
 			}
+			models.LogActivityWithContext(db, "site", id, "trashed",
+				fmt.Sprintf("Moved site %s to the trash (purged after %d day(s))", domain, trashDays), c.IP(), c.Get("User-Agent"))
+		} else {
+			if err := health.PurgeSite(db, site); err != nil {
+				log.Printf("failed to delete site %d: %v", id, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to delete site")
+			}
+			models.LogActivityWithContext(db, "site", id, "deleted", "Deleted site "+domain, c.IP(), c.Get("User-Agent"))
 		}
 
-		domain := site.Domain
-
-		if err := models.DeleteSite(db, id); err != nil {
-			log.Printf("failed to delete site %d: %v", id, err)
-			return c.Status(fiber.StatusInternalServerError).SendString("Failed to delete site")
-		}
-
-		// Clean up orphaned activity_log entries (no FK cascade for activity_log).
-		if _, err := db.Exec("DELETE FROM activity_log WHERE entity_type = 'site' AND entity_id = ?", id); err != nil {
-			log.Printf("failed to clean activity log for site %d: %v", id, err)
-		}
-		models.LogActivityWithContext(db, "site", id, "deleted", "Deleted site "+domain, c.IP(), c.Get("User-Agent"))
-
 		// Trigger Caddy reload
 		if caddyMgr != nil {
 			if err := caddyMgr.RemoveSite(db, domain); err != nil {
@@ -483,6 +799,82 @@ func DeleteSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 	}
 }
 
+// stopSiteContainers stops a site's containers without removing them.
+func stopSiteContainers(db *sql.DB, site *models.Site) error {
+	if site.IsLocal && site.ComposePath != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+		defer cancel()
+		return docker.LocalComposeStop(ctx, site.ComposePath)
+	}
+	if !site.ServerID.Valid {
+		return nil
+	}
+	server, err := models.GetServerByID(db, int(site.ServerID.Int64))
+	if err != nil {
+		return err
+	}
+	return docker.StopSiteRemote(
+		server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote(),
+	)
+}
+
+// ListTrash handles GET /sites/trash.
+func ListTrash(db *sql.DB, trashDays int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		sites, err := models.GetTrashedSites(db)
+		if err != nil {
+			log.Printf("failed to list trashed sites: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load trash")
+		}
+		c.Set("Content-Type", "text/html")
+		return pages.Trash(sites, trashDays).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
+
+// RestoreSite handles POST /sites/:id/restore. The site comes back in the
+// state it was trashed in (usually stopped) and is added back to Caddy.
+func RestoreSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		trashed, err := models.GetTrashedSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site is not in the trash")
+		}
+		// Another site may have taken one of its host names since it was
+		// trashed; restoring it then would break the Caddy config.
+		if err := caddy.CheckDomainConflict(db, *trashed); err != nil {
+			return c.Status(fiber.StatusConflict).SendString(err.Error())
+		}
+
+		if err := models.RestoreTrashedSite(db, id); err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site is not in the trash")
+		}
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			log.Printf("failed to load restored site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Site restored but failed to reload")
+		}
+
+		if caddyMgr != nil {
+			if err := caddyMgr.AddSite(db, *site); err != nil {
+				log.Printf("caddy reload failed after restoring site %s: %v", site.Domain, err)
+			}
+		}
+
+		models.LogActivityWithContext(db, "site", id, "restored", "Restored site "+site.Domain+" from the trash", c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/sites/"+strconv.Itoa(id))
+			return c.SendStatus(fiber.StatusOK)
+		}
+		return c.Redirect("/sites/" + strconv.Itoa(id))
+	}
+}
+
 func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		id, err := strconv.Atoi(c.Params("id"))
@@ -499,8 +891,9 @@ func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		if domain == "" {
 			domain = existing.Domain
 		}
-		if !validateDomain(domain) {
-			return c.Status(fiber.StatusBadRequest).SendString("Invalid domain format")
+		domain, err = models.NormalizeDomains(domain)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString(err.Error())
 		}
 
 		templateSlug := c.FormValue("template_slug")
@@ -515,12 +908,18 @@ func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		if err := docker.ValidateContainerName(containerName); err != nil {
 			return c.Status(fiber.StatusBadRequest).SendString("Invalid container name: " + err.Error())
 		}
+		if taken, err := models.ContainerNameTaken(db, containerName, id); err != nil {
+			log.Printf("failed to check container name %q: %v", containerName, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to validate container name")
+		} else if taken {
+			return c.Status(fiber.StatusBadRequest).SendString("Container name is already used by another site")
+		}
 
 		composePath := strings.TrimSpace(c.FormValue("compose_path"))
 		if composePath == "" {
 			composePath = existing.ComposePath
 		}
-		if !validateComposePath(composePath) {
+		if !models.ValidateComposePath(composePath) {
 			return c.Status(fiber.StatusBadRequest).SendString("Compose path must be an absolute path with no traversal")
 		}
 
@@ -529,6 +928,90 @@ func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 			port = existing.Port
 		}
 
+		// An explicit 0 resets the timeout to the default; a blank field keeps it.
+		deployTimeout := existing.DeployTimeoutSec
+		if v := strings.TrimSpace(c.FormValue("deploy_timeout")); v != "" {
+			deployTimeout, err = strconv.Atoi(v)
+			if err != nil || !validateDeployTimeout(deployTimeout) {
+				return c.Status(fiber.StatusBadRequest).SendString(deployTimeoutError)
+			}
+		}
+
+		healthMethod := strings.ToUpper(strings.TrimSpace(c.FormValue("health_check_method")))
+		if healthMethod == "" {
+			healthMethod = existing.HealthCheckMethod
+		}
+		// Unlike the other fields, a submitted blank clears the expected text,
+		// so only a request that omits the field entirely keeps it.
+		healthExpect := existing.HealthCheckExpect
+		if c.Request().PostArgs().Has("health_check_expect") {
+			healthExpect = strings.TrimSpace(c.FormValue("health_check_expect"))
+		}
+		if msg := validateHealthCheck(healthMethod, healthExpect); msg != "" {
+			return c.Status(fiber.StatusBadRequest).SendString(msg)
+		}
+
+		// Quiet hours, like the expected text, are cleared by a blank value.
+		quietHours, quietTZ := existing.QuietHours, existing.QuietHoursTZ
+		if c.Request().PostArgs().Has("quiet_hours") {
+			quietHours, err = models.NormalizeQuietHours(c.FormValue("quiet_hours"))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Quiet hours: " + err.Error())
+			}
+		}
+		if c.Request().PostArgs().Has("quiet_hours_tz") {
+			quietTZ = strings.TrimSpace(c.FormValue("quiet_hours_tz"))
+			if err := models.ValidateQuietHoursTZ(quietTZ); err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString("Quiet hours: " + err.Error())
+			}
+		}
+
+		// Compose services, too, are cleared by a blank value.
+		composeServices := existing.ComposeServices
+		if c.Request().PostArgs().Has("compose_services") {
+			composeServices, err = models.NormalizeComposeServices(c.FormValue("compose_services"))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).SendString(err.Error())
+			}
+		}
+
+		insecure := formFlag(c, "health_check_insecure", existing.HealthCheckInsecure)
+		noRedirect := formFlag(c, "health_check_no_redirect", existing.HealthCheckNoRedirect)
+
+		routing := existing.RoutingConfig
+		hadSecurityHeaders := routing != nil && routing.SecurityHeaders
+		securityHeaders := formFlag(c, "security_headers", hadSecurityHeaders)
+		if securityHeaders != hadSecurityHeaders {
+			if routing == nil {
+				routing = &models.RoutingConfig{}
+			}
+			routing.SecurityHeaders = securityHeaders
+		}
+		// WebSocket and gRPC only change how a simple site proxies; routed
+		// sites set them per rule.
+		hadWebSocket := routing != nil && routing.WebSocket
+		hadGRPC := routing != nil && routing.GRPC
+		websocket := formFlag(c, "websocket", hadWebSocket)
+		grpc := formFlag(c, "grpc", hadGRPC)
+		if websocket != hadWebSocket || grpc != hadGRPC {
+			if routing == nil {
+				routing = &models.RoutingConfig{}
+			}
+			routing.WebSocket = websocket
+			routing.GRPC = grpc
+		}
+		hadRemoteUpstream := routing != nil && routing.RemoteUpstream
+		remoteUpstream := formFlag(c, "remote_upstream", hadRemoteUpstream)
+		if remoteUpstream != hadRemoteUpstream {
+			if routing == nil {
+				routing = &models.RoutingConfig{}
+			}
+			routing.RemoteUpstream = remoteUpstream
+		}
+		if err := routing.ValidateProxyModes(); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid proxy mode: " + err.Error())
+		}
+
 		var serverID sql.NullInt64
 		if sid := c.FormValue("server_id"); sid != "" {
 			if v, err := strconv.ParseInt(sid, 10, 64); err == nil {
@@ -553,18 +1036,35 @@ func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		}
 
 		site := &models.Site{
-			ID:            id,
-			Domain:        domain,
-			ServerID:      serverID,
-			TemplateSlug:  templateSlug,
-			CustomerID:    customerID,
-			ContainerName: containerName,
-			Port:          port,
-			Status:        existing.Status,
-			SSLEnabled:    existing.SSLEnabled,
-			IsLocal:       isLocal,
-			ComposePath:   composePath,
-			RoutingConfig: existing.RoutingConfig,
+			ID:                id,
+			Domain:            domain,
+			ServerID:          serverID,
+			TemplateSlug:      templateSlug,
+			CustomerID:        customerID,
+			ContainerName:     containerName,
+			Port:              port,
+			Status:            existing.Status,
+			SSLEnabled:        existing.SSLEnabled,
+			IsLocal:           isLocal,
+			ComposePath:       composePath,
+			RoutingConfig:     routing,
+			DeployTimeoutSec:  deployTimeout,
+			HealthCheckMethod: healthMethod,
+			HealthCheckExpect: healthExpect,
+			QuietHours:        quietHours,
+			QuietHoursTZ:      quietTZ,
+
+			HealthCheckInsecure:   insecure,
+			HealthCheckNoRedirect: noRedirect,
+			ComposeServices:       composeServices,
+		}
+
+		if remoteUpstream && !isLocal && !serverID.Valid {
+			return c.Status(fiber.StatusBadRequest).SendString("Proxying to the server host needs an assigned server")
+		}
+
+		if err := caddy.CheckDomainConflict(db, *site); err != nil {
+			return c.Status(fiber.StatusConflict).SendString(err.Error())
 		}
 
 		if err := models.UpdateSite(db, site); err != nil {
@@ -575,7 +1075,9 @@ func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 		models.LogActivityWithContext(db, "site", id, "updated", "Updated site "+domain, c.IP(), c.Get("User-Agent"))
 
 		// Trigger Caddy reload if domain, port, or routing changed
-		needsReload := domain != existing.Domain || port != existing.Port
+		needsReload := domain != existing.Domain || port != existing.Port || securityHeaders != hadSecurityHeaders ||
+			websocket != hadWebSocket || grpc != hadGRPC || remoteUpstream != hadRemoteUpstream ||
+			(remoteUpstream && serverID != existing.ServerID)
 		if caddyMgr != nil && needsReload {
 			if err := caddyMgr.AddSite(db, *site); err != nil {
 				log.Printf("caddy reload failed after updating site %s: %v", domain, err)
@@ -595,36 +1097,6 @@ func UpdateSite(db *sql.DB, caddyMgr *caddy.Manager) fiber.Handler {
 	}
 }
 
-// nextAvailablePort returns the next unused port starting from 8080.
-// The SELECT runs inside a transaction so concurrent site creations read a
-// consistent snapshot of the current maximum, reducing (though not eliminating)
-// the window for a port collision. The UNIQUE index on sites(port) acts as the
-// final guard — the INSERT will fail fast on a true collision and the caller
-// can surface an appropriate error.
-func nextAvailablePort(db *sql.DB) (int, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return 0, err
-	}
-	defer tx.Rollback() //nolint:errcheck
-
-	var maxPort sql.NullInt64
-	if err := tx.QueryRow("SELECT MAX(port) FROM sites").Scan(&maxPort); err != nil {
-		return 0, err
-	}
-
-	port := 8080
-	if maxPort.Valid && maxPort.Int64 >= 8080 {
-		port = int(maxPort.Int64) + 1
-	}
-
-	// Commit the read-only transaction; the actual write happens in CreateSite.
-	if err := tx.Commit(); err != nil {
-		return 0, err
-	}
-	return port, nil
-}
-
 // --- Environment Variable Handlers ---
 
 func ListSiteEnvVars(db *sql.DB) fiber.Handler {
@@ -646,11 +1118,23 @@ func ListSiteEnvVars(db *sql.DB) fiber.Handler {
 
 		out := "<div class='space-y-2'>"
 		for _, v := range vars {
+			varURL := "/sites/" + strconv.Itoa(id) + "/env/" + strconv.Itoa(v.ID)
 			out += "<div class='flex items-center justify-between p-2 bg-gray-50 rounded-lg'>"
-			out += "<div class='font-mono text-sm'><span class='font-semibold text-gray-700'>" + html.EscapeString(v.Key) + "</span> = <span class='text-gray-500'>" + html.EscapeString(v.Value) + "</span></div>"
-			out += "<button hx-delete='/sites/" + strconv.Itoa(id) + "/env/" + strconv.Itoa(v.ID) + "' hx-target='#env-list' hx-swap='innerHTML' hx-confirm='Delete this variable?' "
+			out += "<div class='font-mono text-sm'><span class='font-semibold text-gray-700'>" + html.EscapeString(v.Key) + "</span> = "
+			if v.IsSecret {
+				// Secret values never reach the page until explicitly revealed.
+				out += "<span id='env-value-" + strconv.Itoa(v.ID) + "' class='text-gray-500'>••••</span>"
+			} else {
+				out += "<span class='text-gray-500'>" + html.EscapeString(v.Value) + "</span>"
+			}
+			out += "</div><div class='flex items-center gap-1'>"
+			if v.IsSecret {
+				out += "<button hx-post='" + varURL + "/reveal' hx-target='#env-value-" + strconv.Itoa(v.ID) + "' hx-swap='innerHTML' "
+				out += "class='px-2 py-1 text-xs text-gray-600 hover:bg-gray-100 rounded transition-colors'>Reveal</button>"
+			}
+			out += "<button hx-delete='" + varURL + "' hx-target='#env-list' hx-swap='innerHTML' hx-confirm='Delete this variable?' "
 			out += "class='px-2 py-1 text-xs text-red-600 hover:bg-red-50 rounded transition-colors'>Remove</button>"
-			out += "</div>"
+			out += "</div></div>"
 		}
 		out += "</div>"
 
@@ -668,19 +1152,21 @@ func CreateSiteEnvVar(db *sql.DB) fiber.Handler {
 
 		key := strings.TrimSpace(c.FormValue("key"))
 		value := c.FormValue("value")
+		secret := c.FormValue("is_secret") == "1" || c.FormValue("is_secret") == "on"
 
 		if key == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("Key is required")
 		}
 
-		// Validate key format (alphanumeric + underscores only)
-		for _, ch := range key {
-			if !((ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '_') {
-				return c.Status(fiber.StatusBadRequest).SendString("Key must contain only letters, numbers, and underscores")
-			}
+		if !validEnvKey(key) {
+			return c.Status(fiber.StatusBadRequest).SendString("Key must contain only letters, numbers, and underscores")
+		}
+
+		if err := models.ValidateEnvValue(value); err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid value: " + err.Error())
 		}
 
-		if err := models.CreateEnvVar(db, id, key, value); err != nil {
+		if err := models.CreateEnvVar(db, id, key, value, secret); err != nil {
 			log.Printf("failed to create env var for site %d: %v", id, err)
 			return c.Status(fiber.StatusInternalServerError).SendString("Failed to save environment variable")
 		}
@@ -724,7 +1210,7 @@ func BulkSiteAction(db *sql.DB) fiber.Handler {
 				} else if site.ServerID.Valid {
 					server, sErr := models.GetServerByID(db, int(site.ServerID.Int64))
 					if sErr == nil {
-						err = docker.StartSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName)
+						err = docker.StartSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote())
 					}
 				}
 				if err == nil {
@@ -739,7 +1225,7 @@ func BulkSiteAction(db *sql.DB) fiber.Handler {
 				} else if site.ServerID.Valid {
 					server, sErr := models.GetServerByID(db, int(site.ServerID.Int64))
 					if sErr == nil {
-						err = docker.StopSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName)
+						err = docker.StopSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote())
 					}
 				}
 				if err == nil {
@@ -754,7 +1240,7 @@ func BulkSiteAction(db *sql.DB) fiber.Handler {
 				} else if site.ServerID.Valid {
 					server, sErr := models.GetServerByID(db, int(site.ServerID.Int64))
 					if sErr == nil {
-						err = docker.RestartSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, site.ContainerName)
+						err = docker.RestartSiteRemote(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote())
 					}
 				}
 				if err == nil {
@@ -780,6 +1266,79 @@ func BulkSiteAction(db *sql.DB) fiber.Handler {
 	}
 }
 
+// RevealSiteEnvVar returns the plaintext value of a secret env var for the
+// site page's reveal button. Every reveal is recorded in the activity log.
+func RevealSiteEnvVar(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		siteID, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		varID, err := strconv.Atoi(c.Params("varId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid variable ID")
+		}
+
+		v, err := models.GetEnvVar(db, varID, siteID)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Variable not found")
+		}
+		value, err := v.PlainValue()
+		if err != nil {
+			log.Printf("failed to decrypt env var %d: %v", varID, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to decrypt variable")
+		}
+
+		if v.IsSecret {
+			models.LogActivityWithContext(db, "site", siteID, "env_revealed", "Revealed secret env var "+v.Key, c.IP(), c.Get("User-Agent"))
+		}
+
+		c.Set("Content-Type", "text/html")
+		c.Set("Cache-Control", "no-store")
+		return c.SendString(html.EscapeString(value))
+	}
+}
+
+// RenderedSiteEnv returns the .env file a deploy of the site would upload,
+// with secret values masked, so an admin can check which variables it sets
+// without redeploying. Every view is recorded in the activity log.
+func RenderedSiteEnv(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.Atoi(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).SendString("Invalid site ID")
+		}
+
+		site, err := models.GetSiteByID(db, id)
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Site not found")
+		}
+		if site.IsLocal && site.ComposePath != "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Local sites deploy their own compose file and .env: " + site.ComposePath)
+		}
+
+		content, err := models.RenderMaskedDeployEnvFile(db, id, site.TemplateSlug)
+		if err != nil {
+			var missing *templates.MissingVariablesError
+			if errors.As(err, &missing) {
+				return c.Status(fiber.StatusUnprocessableEntity).SendString("Cannot render: " + missing.Error() + ". Add them as environment variables.")
+			}
+			log.Printf("failed to render env file for site %d: %v", id, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load environment variables")
+		}
+		if content == "" {
+			content = "# no environment variables; the deploy uploads no .env file\n"
+		}
+
+		models.LogActivityWithContext(db, "site", id, "env_viewed", "Viewed rendered env file", c.IP(), c.Get("User-Agent"))
+
+		c.Set("Content-Type", "text/plain; charset=utf-8")
+		c.Set("Cache-Control", "no-store")
+		return c.SendString(content)
+	}
+}
+
 func DeleteSiteEnvVar(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		siteID, err := strconv.Atoi(c.Params("id"))
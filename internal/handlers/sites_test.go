@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestTrashedSiteDomainConflicts(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	old := &models.Site{
+		Domain:        "shop.example.com",
+		TemplateSlug:  "nodejs",
+		ContainerName: "shop-example-com",
+		Port:          3100,
+		Status:        "running",
+		RoutingConfig: &models.RoutingConfig{
+			Rules:           []models.RoutingRule{{Upstream: "localhost:3100"}},
+			RedirectDomains: []string{"www.shop.example.com"},
+		},
+	}
+	if err := models.CreateSite(database, old); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/sites/:id/export.json", ExportSiteConfig(database))
+	app.Post("/sites/import.json", ImportSiteConfig(database))
+	app.Post("/sites/:id/restore", RestoreSite(database, nil))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/sites/1/export.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := io.ReadAll(resp.Body)
+	if err := models.TrashSite(database, old.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	// The trashed site still holds its domain in the database.
+	if code, body := send(http.MethodPost, "/sites/import.json", string(exported)); code != http.StatusConflict || !strings.Contains(body, "trash") {
+		t.Errorf("import onto a trashed site's domain = %d %q, want 409 naming the trash", code, body)
+	}
+
+	// Its redirect domain is free to take, which then blocks the restore.
+	taken := &models.Site{Domain: "www.shop.example.com", ContainerName: "www-shop", Port: 3101, Status: "running"}
+	if err := models.CreateSite(database, taken); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := send(http.MethodPost, "/sites/1/restore", ""); code != http.StatusConflict {
+		t.Errorf("restore over a taken host name = %d %q, want 409", code, body)
+	}
+	if _, err := models.GetTrashedSiteByID(database, old.ID); err != nil {
+		t.Errorf("site left the trash despite the conflict: %v", err)
+	}
+
+	if err := models.DeleteSite(database, taken.ID); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := send(http.MethodPost, "/sites/1/restore", ""); code != http.StatusFound {
+		t.Errorf("restore = %d %q, want a redirect", code, body)
+	}
+	if _, err := models.GetSiteByID(database, old.ID); err != nil {
+		t.Errorf("restored site not found: %v", err)
+	}
+}
+
+// TestCreatePaths_DomainConflict posts a site that would answer on another
+// site's redirect domain through every handler that creates one. Each must
+// refuse it with a 409 and leave the database as it was.
+func TestCreatePaths_DomainConflict(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	owner := &models.Site{
+		Domain:        "shop.example.com",
+		TemplateSlug:  "nodejs",
+		ContainerName: "shop-example-com",
+		Port:          3100,
+		Status:        "running",
+		RoutingConfig: &models.RoutingConfig{
+			Rules:           []models.RoutingRule{{Upstream: "localhost:3100"}},
+			RedirectDomains: []string{"www.shop.example.com"},
+		},
+	}
+	if err := models.CreateSite(database, owner); err != nil {
+		t.Fatal(err)
+	}
+	server := &models.Server{Name: "edge", Host: "127.0.0.1", SSHPort: 1, SSHUser: "root", SSHKeyPath: "/nonexistent", SSHHostKey: "pinned", Status: "online"}
+	if err := models.CreateServer(database, server); err != nil {
+		t.Fatal(err)
+	}
+	composeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(composeDir, "docker-compose.yml"), []byte("services:\n  app:\n    image: app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/sites/:id/export.json", ExportSiteConfig(database))
+	app.Post("/sites/import.json", ImportSiteConfig(database))
+	app.Post("/sites/:id/clone", CloneSite(database))
+	app.Post("/import", ImportProject(database, nil, "warn"))
+	app.Post("/servers/:id/import", ImportRemoteProject(database, nil, "warn"))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/sites/1/export.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported, _ := io.ReadAll(resp.Body)
+
+	const taken = "www.shop.example.com"
+	const formType = "application/x-www-form-urlencoded"
+	tests := []struct {
+		name, target string
+		body, ctype  string
+	}{
+		{"config import", "/sites/import.json?domain=" + taken, string(exported), "application/json"},
+		{"clone", "/sites/1/clone", url.Values{"domain": {taken}}.Encode(), formType},
+		{"local project import", "/import", url.Values{"domain": {taken}, "compose_path": {composeDir}}.Encode(), formType},
+		// The remote compose file cannot be read, which the warn policy lets
+		// through once accepted.
+		{"remote project import", "/servers/1/import", url.Values{"domain": {taken}, "compose_path": {"/srv/shop"}, "accept_risks": {"1"}}.Encode(), formType},
+	}
+
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.ctype)
+		resp, err := app.Test(req, 10000)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusConflict || !strings.Contains(string(body), taken) {
+			t.Errorf("%s: status %d %q, want 409 naming %s", tc.name, resp.StatusCode, body, taken)
+		}
+	}
+	if n, _ := models.CountSites(database); n != 1 {
+		t.Errorf("CountSites = %d after refused creates, want 1", n)
+	}
+}
+
+func TestCreateSite_TemplateVariables(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Post("/sites", CreateSite(database, nil))
+	create := func(form url.Values) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/sites", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := app.Test(req, 10000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// Ghost declares MAIL_FROM as required, with no default.
+	status, body := create(url.Values{"domain": {"blog.example.com"}, "template_slug": {"ghost"}, "env_SMTP_HOST": {"smtp.example.com"}})
+	if status != http.StatusBadRequest || !strings.Contains(body, "MAIL_FROM") {
+		t.Errorf("create without MAIL_FROM: status %d %q, want 400 naming MAIL_FROM", status, body)
+	}
+
+	// A site whose variables cannot be saved would deploy broken, so the
+	// create is undone.
+	if _, err := database.Exec("CREATE TRIGGER fail_env BEFORE INSERT ON site_env_vars BEGIN SELECT RAISE(ABORT, 'disk full'); END"); err != nil {
+		t.Fatal(err)
+	}
+	status, body = create(url.Values{"domain": {"blog.example.com"}, "template_slug": {"ghost"},
+		"env_SMTP_HOST": {"smtp.example.com"}, "env_MAIL_FROM": {"blog@example.com"}})
+	if status != http.StatusInternalServerError {
+		t.Errorf("create with failing env vars: status %d %q, want 500", status, body)
+	}
+	if n, _ := models.CountSites(database); n != 0 {
+		t.Errorf("CountSites = %d after a failed create, want 0", n)
+	}
+}
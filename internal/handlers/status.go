@@ -19,9 +19,25 @@ import (
 // domainFilter controls which domains are shown verbatim. When empty, all
 // domains are masked. When set, only domains containing the filter string are
 // shown; all others are replaced with a generic placeholder.
+//
+// With ?summary=1 it returns the aggregate StatusSummary object instead.
 func PublicStatus(db *sql.DB, domainFilter string) fiber.Handler {
+	summary := StatusSummary(db, domainFilter)
 	return func(c *fiber.Ctx) error {
-		sites, err := models.GetAllSites(db)
+		if c.QueryBool("summary") {
+			return summary(c)
+		}
+		hidden := 0
+		result, err := siteStatuses(db, func(site models.Site) siteStatusJSON {
+			domain := site.Domain
+			// Mask domain when no filter is set (hide everything) or when the
+			// domain does not match the configured filter string.
+			if domainFilter == "" || !strings.Contains(domain, domainFilter) {
+				hidden++
+				domain = fmt.Sprintf("client-site-%d.example", hidden)
+			}
+			return siteStatusJSON{Domain: domain}
+		})
 		if err != nil {
 			log.Printf("failed to list sites for public status: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -29,52 +45,140 @@ func PublicStatus(db *sql.DB, domainFilter string) fiber.Handler {
 			})
 		}
 
-		type statusJSON struct {
-			Domain          string `json:"domain"`
-			Status          string `json:"status"`
-			Template        string `json:"template"`
-			HTTPStatus      int    `json:"http_status"`
-			LatencyMs       int    `json:"latency_ms"`
-			ContainerStatus string `json:"container_status"`
-			CheckedAt       string `json:"checked_at"`
-		}
+		c.Set("Cache-Control", "public, max-age=300")
+		c.Set("Last-Modified", time.Now().UTC().Format(time.RFC1123))
+		return c.JSON(result)
+	}
+}
 
-		// Batch-fetch latest health checks to avoid N+1 queries.
-		healthMap, err := models.GetLatestHealthChecks(db)
+// FullStatus is the authenticated counterpart of PublicStatus for monitors
+// holding an API token. Domains are never masked, each entry carries the
+// site ID and maintenance flag, and the response is not publicly cacheable.
+func FullStatus(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		result, err := siteStatuses(db, func(site models.Site) siteStatusJSON {
+			return siteStatusJSON{ID: site.ID, Domain: site.Domain, Maintenance: site.Maintenance}
+		})
 		if err != nil {
-			log.Printf("failed to batch-load health checks: %v", err)
-			healthMap = make(map[int]*models.HealthCheck)
+			log.Printf("failed to list sites for status: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load site status",
+			})
 		}
 
-		result := make([]statusJSON, 0, len(sites))
-		hidden := 0
-		for _, site := range sites {
-			domain := site.Domain
-			// Mask domain when no filter is set (hide everything) or when the
-			// domain does not match the configured filter string.
-			if domainFilter == "" || !strings.Contains(domain, domainFilter) {
-				hidden++
-				domain = fmt.Sprintf("client-site-%d.example", hidden)
-			}
+		c.Set("Cache-Control", "private, no-store")
+		return c.JSON(result)
+	}
+}
 
-			entry := statusJSON{
-				Domain:   domain,
-				Status:   site.Status,
-				Template: site.TemplateSlug,
-			}
+type siteStatusJSON struct {
+	ID              int    `json:"id,omitempty"`
+	Domain          string `json:"domain"`
+	Status          string `json:"status"`
+	Template        string `json:"template"`
+	Maintenance     bool   `json:"maintenance,omitempty"`
+	HTTPStatus      int    `json:"http_status"`
+	LatencyMs       int    `json:"latency_ms"`
+	ContainerStatus string `json:"container_status"`
+	CheckedAt       string `json:"checked_at"`
+}
 
-			if hc, ok := healthMap[site.ID]; ok {
-				entry.HTTPStatus = hc.HTTPStatus
-				entry.LatencyMs = hc.LatencyMs
-				entry.ContainerStatus = hc.ContainerStatus
-				entry.CheckedAt = hc.CheckedAt
-			}
+// siteStatuses builds one status entry per site. identify fills in the
+// identifying fields, which differ between the public and private views;
+// status and health data are added here.
+func siteStatuses(db *sql.DB, identify func(models.Site) siteStatusJSON) ([]siteStatusJSON, error) {
+	sites, err := models.GetAllSites(db)
+	if err != nil {
+		return nil, err
+	}
 
-			result = append(result, entry)
+	// Batch-fetch latest health checks to avoid N+1 queries.
+	healthMap, err := models.GetLatestHealthChecks(db)
+	if err != nil {
+		log.Printf("failed to batch-load health checks: %v", err)
+		healthMap = make(map[int]*models.HealthCheck)
+	}
+
+	result := make([]siteStatusJSON, 0, len(sites))
+	for _, site := range sites {
+		entry := identify(site)
+		entry.Status = site.Status
+		entry.Template = site.TemplateSlug
+
+		if hc, ok := healthMap[site.ID]; ok {
+			entry.HTTPStatus = hc.HTTPStatus
+			entry.LatencyMs = hc.LatencyMs
+			entry.ContainerStatus = hc.ContainerStatus
+			entry.CheckedAt = hc.CheckedAt
 		}
 
-		c.Set("Cache-Control", "public, max-age=300")
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// StatusSummary returns aggregate site and server counts plus an overall
+// state for external uptime pages, served by PublicStatus for
+// GET /api/status?summary=1. It exposes no per-site data, so nothing
+// needs masking. domainFilter is PublicStatus's filter: when set, only the
+// sites PublicStatus shows by name are counted and decide the overall state,
+// so the client sites it masks cannot mark the public page degraded. When
+// empty, every site is counted.
+//
+// The overall state is derived from the verdict the checker stored with each
+// active site's latest health check: "operational" when none are failing,
+// "down" when every checked site is failing, and "degraded" in between.
+func StatusSummary(db *sql.DB, domainFilter string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		byStatus, total, err := models.CountSitesByStatus(db, domainFilter)
+		if err != nil {
+			log.Printf("status summary: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load status",
+			})
+		}
+		servers, err := models.CountServersByStatus(db)
+		if err != nil {
+			log.Printf("status summary: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load status",
+			})
+		}
+		health, err := models.GetHealthSummary(db, domainFilter)
+		if err != nil {
+			log.Printf("status summary: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to load status",
+			})
+		}
+
+		c.Set("Cache-Control", "public, max-age=60")
 		c.Set("Last-Modified", time.Now().UTC().Format(time.RFC1123))
-		return c.JSON(result)
+		return c.JSON(fiber.Map{
+			"status": overallStatus(health),
+			"sites": fiber.Map{
+				"total":     total,
+				"by_status": byStatus,
+				"checked":   health.Checked,
+				"failing":   health.Failing,
+			},
+			"servers": fiber.Map{
+				"total":   servers.Total,
+				"online":  servers.Online,
+				"offline": servers.Offline,
+				"unknown": servers.Unknown,
+			},
+		})
+	}
+}
+
+func overallStatus(h models.HealthSummary) string {
+	switch {
+	case h.Failing == 0:
+		return "operational"
+	case h.Failing >= h.Checked:
+		return "down"
+	default:
+		return "degraded"
 	}
 }
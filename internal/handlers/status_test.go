@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStatusSummary_DomainFilter(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	sites := []struct {
+		domain string
+		http   int
+	}{
+		{"www.example.dev", 200},
+		{"api.example.dev", 200},
+		{"client-shop.com", 502},
+	}
+	for i, s := range sites {
+		site := &models.Site{Domain: s.domain, ContainerName: s.domain, Port: 8080 + i, Status: "running"}
+		if err := models.CreateSite(database, site); err != nil {
+			t.Fatal(err)
+		}
+		if err := models.CreateHealthCheck(database, &models.HealthCheck{SiteID: site.ID, HTTPStatus: s.http, ContainerStatus: "running", Up: s.http < 400}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type summary struct {
+		Status string `json:"status"`
+		Sites  struct {
+			Total    int            `json:"total"`
+			ByStatus map[string]int `json:"by_status"`
+			Checked  int            `json:"checked"`
+			Failing  int            `json:"failing"`
+		} `json:"sites"`
+	}
+	get := func(filter string) summary {
+		t.Helper()
+		app := fiber.New(fiber.Config{DisableStartupMessage: true})
+		app.Get("/api/status", PublicStatus(database, filter))
+		resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/status?summary=1", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d", resp.StatusCode)
+		}
+		var got summary
+		if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	// Without a filter the failing client site counts.
+	if got := get(""); got.Status != "degraded" || got.Sites.Total != 3 || got.Sites.Checked != 3 || got.Sites.Failing != 1 {
+		t.Errorf("unfiltered summary = %+v, want 3 sites, 1 failing, degraded", got)
+	}
+	// With one, only the sites /api/status shows by name do.
+	got := get("example.dev")
+	if got.Status != "operational" || got.Sites.Total != 2 || got.Sites.ByStatus["running"] != 2 || got.Sites.Checked != 2 || got.Sites.Failing != 0 {
+		t.Errorf("filtered summary = %+v, want 2 sites, none failing, operational", got)
+	}
+
+	// The checker's stored verdict decides, not the HTTP status: a site that
+	// answered 200 but whose container the checker found down is failing.
+	down := &models.Site{Domain: "db.example.dev", ContainerName: "db", Port: 8090, Status: "running"}
+	if err := models.CreateSite(database, down); err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateHealthCheck(database, &models.HealthCheck{SiteID: down.ID, HTTPStatus: 200, ContainerStatus: "exited", Up: false}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get("example.dev"); got.Status != "degraded" || got.Sites.Failing != 1 {
+		t.Errorf("summary with a site down = %+v, want 1 failing, degraded", got)
+	}
+
+	// Without ?summary the endpoint still lists the sites.
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Get("/api/status", PublicStatus(database, "example.dev"))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/status", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil || len(list) != 4 {
+		t.Errorf("GET /api/status = %d entries, %v; want the 4 sites", len(list), err)
+	}
+}
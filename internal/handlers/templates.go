@@ -2,17 +2,25 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
+	"strings"
 
+	"ezweb/internal/docker"
 	"ezweb/internal/models"
+	"ezweb/internal/templates"
+	"ezweb/views/pages"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// ListTemplates returns a JSON list of available site templates.
+// ListTemplates returns a JSON list of available site templates, with the
+// environment variables each one requires.
 func ListTemplates(db *sql.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		templates, err := models.GetAllTemplates(db)
+		all, err := models.GetAllTemplates(db)
 		if err != nil {
 			log.Printf("failed to list templates: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -21,22 +29,209 @@ func ListTemplates(db *sql.DB) fiber.Handler {
 		}
 
 		type templateJSON struct {
-			ID          int    `json:"id"`
-			Slug        string `json:"slug"`
-			Label       string `json:"label"`
-			Description string `json:"description"`
+			ID          int                  `json:"id"`
+			Slug        string               `json:"slug"`
+			Label       string               `json:"label"`
+			Description string               `json:"description"`
+			Builtin     bool                 `json:"builtin"`
+			Variables   []templates.Variable `json:"variables"`
 		}
 
-		result := make([]templateJSON, len(templates))
-		for i, t := range templates {
+		result := make([]templateJSON, len(all))
+		for i, t := range all {
+			vars := t.Variables()
+			if vars == nil {
+				vars = []templates.Variable{}
+			}
 			result[i] = templateJSON{
 				ID:          t.ID,
 				Slug:        t.Slug,
 				Label:       t.Label,
 				Description: t.Description,
+				Builtin:     t.Builtin(),
+				Variables:   vars,
 			}
 		}
 
 		return c.JSON(result)
 	}
 }
+
+// validTemplateSlug matches template slugs: lowercase letters, digits and
+// hyphens, as in the compose file names of the built-in templates.
+var validTemplateSlug = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,49}$`)
+
+// maxTemplateBytes caps the size of a stored compose template.
+const maxTemplateBytes = 64 << 10
+
+// TemplatesPage handles GET /templates and lists every site template.
+func TemplatesPage(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		all, err := models.GetAllTemplates(db)
+		if err != nil {
+			log.Printf("failed to list templates: %v", err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to load templates")
+		}
+		c.Set("Content-Type", "text/html")
+		return pages.Templates(all, c.Locals("role") == "admin").Render(c.Context(), c.Response().BodyWriter())
+	}
+}
+
+// TemplateDetailPage handles GET /templates/:slug and shows the template's
+// compose file, in an edit form for admins.
+func TemplateDetailPage(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		t, err := models.GetTemplateBySlug(db, c.Params("slug"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Template not found")
+		}
+		compose := t.Compose
+		if compose == "" {
+			if compose, err = templates.GetEmbeddedTemplate(t.Slug); err != nil {
+				log.Printf("template %s has no compose file: %v", t.Slug, err)
+			}
+		}
+		c.Set("Content-Type", "text/html")
+		return pages.TemplateDetail(*t, compose, c.Locals("role") == "admin").Render(c.Context(), c.Response().BodyWriter())
+	}
+}
+
+// CreateTemplateHandler handles POST /templates. The compose file must pass
+// docker.ValidateComposeTemplate.
+func CreateTemplateHandler(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		t := &models.SiteTemplate{
+			Slug:        strings.TrimSpace(c.FormValue("slug")),
+			Label:       strings.TrimSpace(c.FormValue("label")),
+			Description: strings.TrimSpace(c.FormValue("description")),
+			Compose:     normalizeNewlines(c.FormValue("compose")),
+		}
+		if !validTemplateSlug.MatchString(t.Slug) {
+			return c.Status(fiber.StatusBadRequest).SendString("Slug must be 1-50 lowercase letters, digits or hyphens")
+		}
+		if templates.IsEmbedded(t.Slug) {
+			return c.Status(fiber.StatusConflict).SendString("A built-in template already uses this slug; edit it instead")
+		}
+		if msg := validateTemplateForm(t); msg != "" {
+			return c.Status(fiber.StatusBadRequest).SendString(msg)
+		}
+
+		if err := models.CreateTemplate(db, t); err != nil {
+			if errors.Is(err, models.ErrTemplateExists) {
+				return c.Status(fiber.StatusConflict).SendString("A template with this slug already exists")
+			}
+			log.Printf("failed to create template %s: %v", t.Slug, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to create template")
+		}
+
+		models.LogActivityWithContext(db, "template", t.ID, "created", "Created template "+t.Slug, c.IP(), c.Get("User-Agent"))
+		return templateRedirect(c, "/templates/"+t.Slug)
+	}
+}
+
+// UpdateTemplateHandler handles PUT /templates/:slug. Saving a built-in
+// template with an empty compose file, or with the one in the binary,
+// clears the stored copy so it follows the binary again.
+func UpdateTemplateHandler(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		t, err := models.GetTemplateBySlug(db, c.Params("slug"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Template not found")
+		}
+		t.Label = strings.TrimSpace(c.FormValue("label"))
+		t.Description = strings.TrimSpace(c.FormValue("description"))
+		t.Compose = normalizeNewlines(c.FormValue("compose"))
+
+		if t.Builtin() {
+			embedded, _ := templates.GetEmbeddedTemplate(t.Slug)
+			if strings.TrimSpace(t.Compose) == "" || t.Compose == embedded {
+				t.Compose = ""
+			}
+		}
+		if msg := validateTemplateForm(t); msg != "" {
+			return c.Status(fiber.StatusBadRequest).SendString(msg)
+		}
+
+		if err := models.UpdateTemplate(db, t); err != nil {
+			log.Printf("failed to update template %s: %v", t.Slug, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to update template")
+		}
+
+		models.LogActivityWithContext(db, "template", t.ID, "updated", "Updated template "+t.Slug, c.IP(), c.Get("User-Agent"))
+		return templateRedirect(c, "/templates/"+t.Slug)
+	}
+}
+
+// DeleteTemplateHandler handles DELETE /templates/:slug. A template added
+// from the templates page is removed, unless a site still uses it. A
+// built-in template cannot be removed; its stored copy, if it was edited, is
+// cleared instead.
+func DeleteTemplateHandler(db *sql.DB) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		t, err := models.GetTemplateBySlug(db, c.Params("slug"))
+		if err != nil {
+			return c.Status(fiber.StatusNotFound).SendString("Template not found")
+		}
+
+		if t.Builtin() {
+			if t.Compose == "" {
+				return c.Status(fiber.StatusBadRequest).SendString("Built-in templates cannot be deleted")
+			}
+			t.Compose = ""
+			if err := models.UpdateTemplate(db, t); err != nil {
+				log.Printf("failed to reset template %s: %v", t.Slug, err)
+				return c.Status(fiber.StatusInternalServerError).SendString("Failed to reset template")
+			}
+			models.LogActivityWithContext(db, "template", t.ID, "reset", "Reset template "+t.Slug+" to the built-in compose file", c.IP(), c.Get("User-Agent"))
+			return templateRedirect(c, "/templates/"+t.Slug)
+		}
+
+		inUse, err := models.TemplateInUse(db, t.Slug)
+		if err != nil {
+			log.Printf("failed to check sites of template %s: %v", t.Slug, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to delete template")
+		}
+		if inUse {
+			return c.Status(fiber.StatusConflict).SendString("Sites (including any in the trash) still use this template")
+		}
+		if err := models.DeleteTemplate(db, t.Slug); err != nil {
+			log.Printf("failed to delete template %s: %v", t.Slug, err)
+			return c.Status(fiber.StatusInternalServerError).SendString("Failed to delete template")
+		}
+
+		models.LogActivityWithContext(db, "template", t.ID, "deleted", "Deleted template "+t.Slug, c.IP(), c.Get("User-Agent"))
+		return templateRedirect(c, "/templates")
+	}
+}
+
+// validateTemplateForm checks the fields shared by create and update and
+// returns a message for the user, or "" when they are valid. A built-in
+// template without a stored compose file uses the one in the binary.
+func validateTemplateForm(t *models.SiteTemplate) string {
+	switch {
+	case t.Label == "":
+		return "Label is required"
+	case t.Compose == "" && t.Builtin():
+		return ""
+	case len(t.Compose) > maxTemplateBytes:
+		return fmt.Sprintf("Compose template is larger than %d KB", maxTemplateBytes>>10)
+	}
+	if err := docker.ValidateComposeTemplate(t.Compose); err != nil {
+		return "Invalid compose template: " + strings.TrimPrefix(err.Error(), "template: ")
+	}
+	return ""
+}
+
+// normalizeNewlines converts the CRLF line endings browsers submit for a
+// textarea to LF.
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+func templateRedirect(c *fiber.Ctx, to string) error {
+	if c.Get("HX-Request") != "" {
+		c.Set("HX-Redirect", to)
+		return c.SendString("")
+	}
+	return c.Redirect(to)
+}
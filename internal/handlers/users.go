@@ -5,6 +5,7 @@ import (
 	"log"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"ezweb/internal/auth"
 	"ezweb/internal/models"
@@ -15,7 +16,9 @@ import (
 
 var validUsername = regexp.MustCompile(`^[a-zA-Z0-9._-]{3,50}$`)
 
-func ListUsers(db *sql.DB) fiber.Handler {
+// ListUsers renders the users page, including the login lockouts currently
+// held by the IP and username trackers.
+func ListUsers(db *sql.DB, lockout, userLockout *auth.LockoutTracker) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		users, err := models.GetAllUsers(db)
 		if err != nil {
@@ -25,7 +28,41 @@ func ListUsers(db *sql.DB) fiber.Handler {
 
 		currentUsername, _ := c.Locals("username").(string)
 		c.Set("Content-Type", "text/html")
-		return pages.Users(users, currentUsername).Render(c.Context(), c.Response().BodyWriter())
+		return pages.Users(users, currentUsername, lockout.Locked(), userLockout.Locked()).Render(c.Context(), c.Response().BodyWriter())
+	}
+}
+
+// ClearLockout handles POST /users/lockouts/clear, lifting a lockout before
+// it expires. The form names the tracker ("ip" or "user") and the key.
+func ClearLockout(db *sql.DB, lockout, userLockout *auth.LockoutTracker) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.FormValue("key")
+		if key == "" {
+			return c.Status(fiber.StatusBadRequest).SendString("Lockout key is required")
+		}
+
+		var tracker *auth.LockoutTracker
+		var what string
+		switch c.FormValue("scope") {
+		case "ip":
+			tracker, what = lockout, "IP "
+		case "user":
+			tracker, what = userLockout, "user "
+		default:
+			return c.Status(fiber.StatusBadRequest).SendString("Scope must be ip or user")
+		}
+		if !tracker.Clear(key) {
+			return c.Status(fiber.StatusNotFound).SendString("No active lockout for " + what + key)
+		}
+
+		safeKey := strings.ReplaceAll(strings.ReplaceAll(key, "\n", ""), "\r", "")
+		models.LogActivityWithContext(db, "auth", 0, "lockout_cleared", "Cleared lockout for "+what+safeKey, c.IP(), c.Get("User-Agent"))
+
+		if c.Get("HX-Request") != "" {
+			c.Set("HX-Redirect", "/users")
+			return c.SendString("")
+		}
+		return c.Redirect("/users")
 	}
 }
 
@@ -5,46 +5,30 @@ import (
 	"testing"
 )
 
-func TestValidateDomain_Valid(t *testing.T) {
-	cases := []string{
-		"example.com",
-		"sub.example.com",
-		"my-site.example.co.uk",
-	}
-	for _, c := range cases {
-		if !validateDomain(c) {
-			t.Errorf("expected %q to be valid", c)
+func TestValidateDeployTimeout(t *testing.T) {
+	for _, sec := range []int{0, 30, 600, 3600} {
+		if !validateDeployTimeout(sec) {
+			t.Errorf("expected deploy timeout %d to be valid", sec)
 		}
 	}
-}
-
-func TestValidateDomain_Invalid(t *testing.T) {
-	cases := []string{
-		"",
-		"-example.com",
-		strings.Repeat("a", 254),
-	}
-	for _, c := range cases {
-		if validateDomain(c) {
-			t.Errorf("expected %q to be invalid", c)
+	for _, sec := range []int{-1, 1, 29, 3601} {
+		if validateDeployTimeout(sec) {
+			t.Errorf("expected deploy timeout %d to be invalid", sec)
 		}
 	}
 }
 
-func TestValidatePort_Valid(t *testing.T) {
-	cases := []int{1024, 8080, 65535}
-	for _, p := range cases {
-		if !validatePort(p) {
-			t.Errorf("expected port %d to be valid", p)
+func TestValidateHealthCheck(t *testing.T) {
+	valid := [][2]string{{"", ""}, {"GET", ""}, {"GET", "ok"}, {"HEAD", ""}}
+	for _, v := range valid {
+		if msg := validateHealthCheck(v[0], v[1]); msg != "" {
+			t.Errorf("validateHealthCheck(%q, %q) = %q, want valid", v[0], v[1], msg)
 		}
 	}
-}
-
-func TestValidatePort_Invalid(t *testing.T) {
-	cases := []int{0, 80, 1023, 65536}
-	for _, p := range cases {
-		if validatePort(p) {
-			t.Errorf("expected port %d to be invalid", p)
+	invalid := [][2]string{{"POST", ""}, {"HEAD", "ok"}, {"GET", strings.Repeat("x", 201)}}
+	for _, v := range invalid {
+		if validateHealthCheck(v[0], v[1]) == "" {
+			t.Errorf("validateHealthCheck(%q, %q) should be rejected", v[0], v[1])
 		}
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net"
+	"strings"
 	"time"
 )
 
@@ -12,12 +13,19 @@ import (
 // checker from stalling on unresponsive hosts. Returns a zero time and an
 // error if the connection or certificate retrieval fails.
 func CheckCertExpiry(domain string) (time.Time, error) {
+	return checkCertExpiry(domain, true)
+}
+
+// checkCertExpiry is CheckCertExpiry with optional verification. Sites that
+// skip TLS verification (self-signed certificates) still have their
+// certificate's expiry read, without the chain being checked.
+func checkCertExpiry(domain string, verify bool) (time.Time, error) {
 	dialer := &net.Dialer{Timeout: 10 * time.Second}
 	conn, err := tls.DialWithDialer(
 		dialer,
 		"tcp",
 		domain+":443",
-		&tls.Config{InsecureSkipVerify: false},
+		&tls.Config{InsecureSkipVerify: !verify},
 	)
 	if err != nil {
 		return time.Time{}, fmt.Errorf("TLS dial failed for %s: %w", domain, err)
@@ -32,3 +40,23 @@ func CheckCertExpiry(domain string) (time.Time, error) {
 	// Index 0 is always the leaf (server) certificate.
 	return certs[0].NotAfter, nil
 }
+
+// privateSuffixes are name suffixes that public CAs never issue for.
+var privateSuffixes = []string{".localhost", ".local", ".internal", ".lan", ".home.arpa", ".test", ".invalid"}
+
+// publicCertPossible reports whether a public CA could issue a certificate
+// for domain. IP addresses, single-label names such as localhost and names
+// under reserved or local-network suffixes cannot have one, so probing them
+// for a certificate is pointless.
+func publicCertPossible(domain string) bool {
+	domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+	if !strings.Contains(domain, ".") || net.ParseIP(domain) != nil {
+		return false
+	}
+	for _, suffix := range privateSuffixes {
+		if strings.HasSuffix(domain, suffix) {
+			return false
+		}
+	}
+	return true
+}
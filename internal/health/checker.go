@@ -1,11 +1,16 @@
 package health
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -13,50 +18,85 @@ import (
 
 	"ezweb/internal/auth"
 	"ezweb/internal/docker"
+	"ezweb/internal/logging"
 	"ezweb/internal/models"
 	sshutil "ezweb/internal/ssh"
 
 	dockertypes "github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 )
 
-const maxConcurrentChecks = 10
+// defaultMaxConcurrentChecks is how many sites a checker probes at once
+// unless NewChecker is given another limit. TestAllServers uses it too.
+const defaultMaxConcurrentChecks = 10
+
+// maxHealthBodyBytes caps how much of a response body is read when a site
+// has an expected body substring, so a huge page cannot exhaust memory.
+const maxHealthBodyBytes = 1 << 20
+
+// sslProbeRetryInterval is how long the checker waits after finding no valid
+// certificate on a site before it probes for one again with AutoEnableSSL.
+const sslProbeRetryInterval = 24 * time.Hour
 
 type Checker struct {
-	DB             *sql.DB
-	Interval       time.Duration
-	Client         *http.Client
-	Webhook        *WebhookSender
-	Email          *EmailSender
+	DB                    *sql.DB
+	ReadDB                *sql.DB // optional read-only handle for the site scan; DB is used when nil
+	Interval              time.Duration
+	Client                *http.Client
+	Notifiers             []Notifier
 	AlertThreshold        int
+	Escalation            []time.Duration // re-alert intervals for a site that stays down; see escalationDue
 	HealthRetentionDays   int
 	ActivityRetentionDays int
+	TrashRetentionDays    int  // days a trashed site is kept before it is purged
+	AutoEnableSSL         bool // set ssl_enabled once a valid cert is served
 	failures              map[int]int
-	alertedSites   map[int]bool
-	mu             sync.Mutex
-	semaphore      chan struct{}
-	running        atomic.Int32
+	alertedSites          map[int]bool
+	downSince             map[int]time.Time // first failing check of the current outage
+	lastNotified          map[int]time.Time // last down alert or escalation
+	escalations           map[int]int       // escalations sent in the current outage
+	certNotified          map[int]string    // site ID -> date of last expiry warning
+	quietDown             map[int]bool      // sites seen down during their quiet hours
+	statusSeen            map[int]statusObservation
+	sslProbeFailed        map[int]time.Time // last auto-SSL probe that found no valid cert
+	certProbe             func(domain string) (time.Time, error)
+	probeClients          map[probeOptions]*http.Client
+	mu                    sync.Mutex
+	semaphore             chan struct{}
+	running               atomic.Int32
+	cycled                atomic.Bool // set once a full round has finished
 }
 
-func NewChecker(db *sql.DB, interval time.Duration, webhookURL string, webhookFormat string, alertThreshold int, healthRetentionDays int, activityRetentionDays int, email *EmailSender) *Checker {
-	var webhook *WebhookSender
-	if webhookURL != "" {
-		webhook = NewWebhookSender(webhookURL, webhookFormat)
-	}
+// NewChecker builds a health checker that fans alerts out to every notifier
+// supplied. An empty slice disables alerting entirely. maxConcurrent caps how
+// many sites are checked at once; below 1 it is defaultMaxConcurrentChecks.
+func NewChecker(db *sql.DB, interval time.Duration, notifiers []Notifier, alertThreshold int, healthRetentionDays int, activityRetentionDays int, maxConcurrent int) *Checker {
 	if alertThreshold <= 0 {
 		alertThreshold = 3
 	}
+	if maxConcurrent < 1 {
+		maxConcurrent = defaultMaxConcurrentChecks
+	}
 	return &Checker{
-		DB:             db,
-		Interval:       interval,
-		Client:         &http.Client{Timeout: 10 * time.Second},
-		Webhook:        webhook,
-		Email:          email,
-		AlertThreshold: alertThreshold,
+		DB:                    db,
+		Interval:              interval,
+		Client:                &http.Client{Timeout: 10 * time.Second},
+		Notifiers:             notifiers,
+		AlertThreshold:        alertThreshold,
 		HealthRetentionDays:   healthRetentionDays,
 		ActivityRetentionDays: activityRetentionDays,
 		failures:              make(map[int]int),
 		alertedSites:          make(map[int]bool),
-		semaphore:             make(chan struct{}, maxConcurrentChecks),
+		downSince:             make(map[int]time.Time),
+		lastNotified:          make(map[int]time.Time),
+		escalations:           make(map[int]int),
+		certNotified:          make(map[int]string),
+		quietDown:             make(map[int]bool),
+		statusSeen:            make(map[int]statusObservation),
+		sslProbeFailed:        make(map[int]time.Time),
+		certProbe:             CheckCertExpiry,
+		probeClients:          make(map[probeOptions]*http.Client),
+		semaphore:             make(chan struct{}, maxConcurrent),
 	}
 }
 
@@ -69,7 +109,7 @@ func (ch *Checker) Start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			log.Println("Health checker stopped")
+			logging.Infof("Health checker stopped")
 			return
 		case <-ticker.C:
 			ch.checkAll()
@@ -77,10 +117,16 @@ func (ch *Checker) Start(ctx context.Context) {
 	}
 }
 
+// Ready reports whether the checker has finished at least one full round, so
+// the health history and site states it maintains are current.
+func (ch *Checker) Ready() bool {
+	return ch.cycled.Load()
+}
+
 func (ch *Checker) checkAll() {
 	// Skip this cycle if the previous round has not finished yet.
 	if !ch.running.CompareAndSwap(0, 1) {
-		log.Println("Health checker: previous round still running, skipping cycle")
+		logging.Warnf("Health checker: previous round still running, skipping cycle")
 		return
 	}
 	defer ch.running.Store(0)
@@ -95,38 +141,94 @@ func (ch *Checker) checkAll() {
 	auth.CleanupExpiredTokens(ch.DB)
 	// Prune used TOTP codes older than 2 minutes.
 	models.CleanupUsedTOTPCodes(ch.DB)
-
-	sites, err := models.GetAllSites(ch.DB)
+	// Purge sites whose trash window has passed.
+	ch.purgeTrash(time.Now())
+	// Generate the next period's payment for recurring payments.
+	ch.spawnRecurringPayments()
+
+	readDB := ch.ReadDB
+	if readDB == nil {
+		readDB = ch.DB
+	}
+	sites, err := models.GetAllSites(readDB)
 	if err != nil {
 		log.Printf("Health checker: failed to get sites: %v", err)
 		return
 	}
 
+	// Sites on the same server share one SSH connection for this round.
+	pool := newSSHPool()
+	defer pool.close()
+
 	var wg sync.WaitGroup
 	for _, site := range sites {
+		// Pending sites have nothing to probe yet, and a deploying site's
+		// containers are expected to be down while they are recreated.
 		if site.Status == "pending" {
 			continue
 		}
+		if site.Status == "deploying" {
+			ch.resetFailures(site.ID)
+			continue
+		}
 		wg.Add(1)
 		// Acquire a semaphore slot before launching to cap concurrency.
 		ch.semaphore <- struct{}{}
 		go func(s models.Site) {
 			defer wg.Done()
 			defer func() { <-ch.semaphore }()
-			ch.checkSite(s)
+			ch.checkSite(s, pool)
 		}(site)
 	}
 	wg.Wait()
+	ch.cycled.Store(true)
+}
+
+// resetFailures clears the consecutive-failure count for a site so the first
+// check after a deploy starts from zero instead of inheriting failures
+// recorded while the old containers were being torn down. The counter lives
+// only in memory (it is not persisted), so a restart has the same effect. The
+// alerted flag is left alone: if a down alert went out before the redeploy, the
+// recovery notice is still sent once the site comes back healthy, and no
+// duplicate down alert is sent if it stays down. Status observations are
+// dropped for the same reason.
+func (ch *Checker) resetFailures(siteID int) {
+	ch.mu.Lock()
+	delete(ch.failures, siteID)
+	delete(ch.statusSeen, siteID)
+	ch.mu.Unlock()
 }
 
-func (ch *Checker) checkSite(site models.Site) {
+// ResetSiteState forgets everything the checker remembers about sites:
+// failure counts, outstanding alerts and outages, certificate warnings and
+// status observations. It is for when the sites table has been replaced, as
+// by a database restore, after which a site ID may belong to another site or
+// to none. A site that is still down is alerted again once it reaches the
+// threshold, and no recovery is sent for an alert from before the reset.
+func (ch *Checker) ResetSiteState() {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	clear(ch.failures)
+	clear(ch.alertedSites)
+	clear(ch.downSince)
+	clear(ch.lastNotified)
+	clear(ch.escalations)
+	clear(ch.certNotified)
+	clear(ch.quietDown)
+	clear(ch.statusSeen)
+	clear(ch.sslProbeFailed)
+}
+
+func (ch *Checker) checkSite(site models.Site, pool *sshPool) {
 	hc := &models.HealthCheck{
 		SiteID: site.ID,
 	}
 
 	// httpSkipped is set to true when we intentionally omit the HTTP probe so
 	// that a zero HTTPStatus is not misread as a network failure below.
-	var httpSkipped bool
+	// bodyMissing is set when the site expects text in the response body and
+	// it was not there, which counts as down even on a 2xx.
+	var httpSkipped, bodyMissing bool
 
 	// HTTP check
 	if site.IsLocal {
@@ -139,131 +241,431 @@ func (ch *Checker) checkSite(site models.Site) {
 			// on container status (e.g. shared-infra.local).
 			httpSkipped = true
 		} else {
-			start := time.Now()
-			resp, err := ch.Client.Get(probeURL)
-			latency := time.Since(start).Milliseconds()
-			if err != nil {
-				hc.HTTPStatus = 0
-				hc.LatencyMs = int(latency)
-			} else {
-				hc.HTTPStatus = resp.StatusCode
-				hc.LatencyMs = int(latency)
-				resp.Body.Close()
-			}
+			bodyMissing = ch.probeHTTP(site, probeURL, hc)
 		}
 	} else if site.Domain != "" {
 		scheme := "http"
 		if site.SSLEnabled {
 			scheme = "https"
 		}
-		url := fmt.Sprintf("%s://%s", scheme, site.Domain)
-		start := time.Now()
-		resp, err := ch.Client.Get(url)
-		latency := time.Since(start).Milliseconds()
-
-		if err != nil {
-			hc.HTTPStatus = 0
-			hc.LatencyMs = int(latency)
-		} else {
-			hc.HTTPStatus = resp.StatusCode
-			hc.LatencyMs = int(latency)
-			resp.Body.Close()
-		}
+		bodyMissing = ch.probeHTTP(site, fmt.Sprintf("%s://%s", scheme, models.PrimaryDomain(site.Domain)), hc)
 	}
 
 	// SSL certificate expiry check — only performed for SSL-enabled sites with
-	// a known domain. The result is stored on the site record and a webhook
-	// alert is sent when the cert expires within 14 days.
+	// a known domain. The result is stored on the site record and a warning
+	// goes to every notifier when the cert expires within 14 days.
 	if site.SSLEnabled && site.Domain != "" {
-		if expiry, certErr := CheckCertExpiry(site.Domain); certErr == nil {
-			if updateErr := models.UpdateSiteSSLExpiry(ch.DB, site.ID, expiry); updateErr != nil {
-				log.Printf("Health checker: failed to store ssl_expiry for site %d: %v", site.ID, updateErr)
-			}
-			daysUntilExpiry := int(time.Until(expiry).Hours() / 24)
-			if daysUntilExpiry <= 14 && daysUntilExpiry > 0 && ch.Webhook != nil {
-				msg := fmt.Sprintf("SSL certificate expires in %d days", daysUntilExpiry)
-				if err := ch.Webhook.SendAlert(site.Domain, 0, msg); err != nil {
-					log.Printf("Webhook cert-expiry alert failed for %s: %v", site.Domain, err)
-				}
-			}
+		if expiry, certErr := checkCertExpiry(models.PrimaryDomain(site.Domain), !site.HealthCheckInsecure); certErr == nil {
+			ch.handleCertExpiry(site, expiry, time.Now())
 		} else {
 			log.Printf("Health checker: cert check failed for %s: %v", site.Domain, certErr)
 		}
+	} else if ch.AutoEnableSSL && site.Domain != "" {
+		ch.maybeEnableSSL(site, time.Now())
 	}
 
-	// Container status check
+	// Container status check. The image is only kept while the container
+	// is running; anything else shows as unknown.
+	var image string
 	if site.IsLocal {
-		ch.checkLocalContainer(site, hc)
+		image = ch.checkLocalContainer(site, hc)
 	} else if site.ServerID.Valid {
-		ch.checkRemoteContainer(site, hc)
+		image = ch.checkRemoteContainer(site, hc, pool)
+	}
+	if site.IsLocal || site.ServerID.Valid {
+		if hc.ContainerStatus != "running" {
+			image = ""
+		}
+		if err := models.UpdateSiteContainerImage(ch.DB, site.ID, image); err != nil {
+			log.Printf("Health checker: %v", err)
+		}
 	}
 
-	if err := models.CreateHealthCheck(ch.DB, hc); err != nil {
-		log.Printf("Health checker: failed to save check for site %d: %v", site.ID, err)
+	// A multi-container stack is only healthy when every service it
+	// declares is running, not just the site's own container.
+	if services := site.ExpectedServices(); len(services) > 0 {
+		if site.IsLocal {
+			hc.Services = ch.checkLocalServices(site, services)
+		} else if site.ServerID.Valid {
+			hc.Services = ch.checkRemoteServices(site, services, pool)
+		}
 	}
 
 	// Align with MCP definition: any 4xx or 5xx response, or a network failure
 	// (status 0), is treated as the site being down. When the HTTP probe was
 	// intentionally skipped (local site with no usable endpoint) a zero status
 	// is not a failure — health is determined by container status alone.
-	httpDown := !httpSkipped && (hc.HTTPStatus == 0 || hc.HTTPStatus >= 400)
-	isDown := httpDown || hc.ContainerStatus == "not_found" || hc.ContainerStatus == "exited"
+	// A site that is not meant to redirect is down when it answers with one.
+	httpDown := !httpSkipped && (hc.HTTPStatus == 0 || hc.HTTPStatus >= 400 || bodyMissing ||
+		(site.HealthCheckNoRedirect && hc.HTTPStatus >= 300))
+	servicesDown := hc.DownServices()
+	isDown := httpDown || hc.ContainerStatus == "not_found" || hc.ContainerStatus == "exited" || len(servicesDown) > 0
+	hc.Up = !isDown
+
+	if err := models.CreateHealthCheck(ch.DB, hc); err != nil {
+		log.Printf("Health checker: failed to save check for site %d: %v", site.ID, err)
+	}
+	logging.Debugf("Health checker: site %d (%s) http=%d latency=%dms container=%s restarts=%d", site.ID, site.Domain, hc.HTTPStatus, hc.LatencyMs, hc.ContainerStatus, hc.RestartCount)
+
+	// A site in maintenance answers 503 on purpose. Keep recording checks
+	// but hold the failure count at zero so no down alert is sent; any
+	// outstanding alert is resolved once the site is back out of maintenance.
+	// Its status is left as the drain or the user set it.
+	if site.Maintenance {
+		ch.mu.Lock()
+		ch.failures[site.ID] = 0
+		ch.mu.Unlock()
+		return
+	}
+
+	ch.reconcileStatus(site, hc)
+
+	now := time.Now()
+	decision := ch.updateAlertState(site.ID, isDown, site.InQuietHours(now), now)
+
+	// Perform notifier I/O outside the lock to avoid holding it during network
+	// calls, which could block other goroutines from updating their state.
+	if decision.alert || decision.escalate {
+		errMsg := fmt.Sprintf("HTTP: %d, Container: %s", hc.HTTPStatus, hc.ContainerStatus)
+		if bodyMissing {
+			errMsg += fmt.Sprintf(", response body missing %q", site.HealthCheckExpect)
+		}
+		if len(servicesDown) > 0 {
+			errMsg += ", services down: " + formatServiceStates(servicesDown)
+		}
+		if decision.escalate {
+			ch.notifyEscalation(site.Domain, decision.downFor, decision.failures, errMsg)
+		} else if !ch.notifyAlert(site.Domain, decision.failures, errMsg) && len(ch.Notifiers) > 0 {
+			// Every channel failed — roll back the alerted flag so the next
+			// cycle can retry.
+			ch.mu.Lock()
+			ch.alertedSites[site.ID] = false
+			ch.mu.Unlock()
+		}
+	}
 
-	// Hold the lock across the entire read-modify-decide block so that the
-	// failure counter and the alerted flag are always updated atomically.
-	// Only the webhook I/O (which can block) is performed outside the lock.
-	var shouldAlert bool
-	var shouldRecover bool
+	if decision.recover {
+		ch.notifyRecovery(site.Domain, decision.downFor)
+	}
+}
 
+// alertDecision is what updateAlertState decided a check calls for.
+type alertDecision struct {
+	alert    bool // the first down alert of an outage
+	escalate bool // a repeat alert for a site still down
+	recover  bool // a recovery notice
+	failures int  // consecutive failures counted so far
+	// downFor is how long the site has been down, from the first failing
+	// check of the outage, for escalations and recoveries.
+	downFor time.Duration
+}
+
+// updateAlertState records the outcome of a check made at now and decides
+// whether a down alert, an escalation or a recovery notice is due. The lock
+// is held across the whole read-modify-decide block so the failure counter
+// and the alerted flag are always updated atomically; the caller does the
+// notifier I/O afterwards.
+//
+// During the site's quiet hours a down check neither counts toward the alert
+// threshold nor alerts or escalates. It is remembered instead, and if the
+// site is up at the first check after the window a recovery notice reports
+// that; if it is still down, counting resumes and the usual down alert
+// follows. Recoveries of a site alerted before the window are never held
+// back.
+func (ch *Checker) updateAlertState(siteID int, isDown, quiet bool, now time.Time) alertDecision {
 	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	var d alertDecision
 	if isDown {
-		ch.failures[site.ID]++
-		count := ch.failures[site.ID]
-		alerted := ch.alertedSites[site.ID]
-		if count >= ch.AlertThreshold && !alerted {
+		if _, ok := ch.downSince[siteID]; !ok {
+			ch.downSince[siteID] = now
+		}
+	}
+
+	switch {
+	case isDown && quiet:
+		ch.quietDown[siteID] = true
+		d.failures = ch.failures[siteID]
+	case isDown:
+		delete(ch.quietDown, siteID)
+		ch.failures[siteID]++
+		d.failures = ch.failures[siteID]
+		alerted := ch.alertedSites[siteID]
+		if d.failures >= ch.AlertThreshold && !alerted {
 			// Mark as alerted now, before releasing the lock, so a concurrent
 			// goroutine racing on the same site cannot also trigger an alert.
-			ch.alertedSites[site.ID] = true
-			shouldAlert = true
+			ch.alertedSites[siteID] = true
+			ch.lastNotified[siteID] = now
+			ch.escalations[siteID] = 0
+			d.alert = true
+		} else if alerted && ch.escalationDue(siteID, now) {
+			ch.lastNotified[siteID] = now
+			ch.escalations[siteID]++
+			d.escalate = true
+			d.downFor = now.Sub(ch.downSince[siteID])
+		}
+	default:
+		// The alerted flag alone decides recovery: a redeploy may have zeroed
+		// the failure count while the down alert is still outstanding.
+		alerted := ch.alertedSites[siteID]
+		ch.failures[siteID] = 0
+		ch.alertedSites[siteID] = false
+		d.recover = alerted || (!quiet && ch.quietDown[siteID])
+		if d.recover || !quiet {
+			delete(ch.quietDown, siteID)
+		}
+		if since, ok := ch.downSince[siteID]; ok && d.recover {
+			d.downFor = now.Sub(since)
 		}
+		// A recovery held back by quiet hours still needs the start of the
+		// outage once it is reported.
+		if !ch.quietDown[siteID] {
+			delete(ch.downSince, siteID)
+		}
+		delete(ch.lastNotified, siteID)
+		delete(ch.escalations, siteID)
+	}
+	return d
+}
+
+// escalationDue reports whether the next escalation of an alerted site is
+// due at now. The first is due Escalation[0] after the down alert, each
+// later one the next interval after the one before, and the last interval
+// repeats for as long as the site stays down. The caller holds ch.mu.
+func (ch *Checker) escalationDue(siteID int, now time.Time) bool {
+	if len(ch.Escalation) == 0 {
+		return false
+	}
+	last, ok := ch.lastNotified[siteID]
+	if !ok {
+		// Alerted before a restart wiped the state; count from now.
+		ch.lastNotified[siteID] = now
+		return false
+	}
+	step := ch.escalations[siteID]
+	if step >= len(ch.Escalation) {
+		step = len(ch.Escalation) - 1
+	}
+	return !now.Before(last.Add(ch.Escalation[step]))
+}
+
+// probeOptions are the per-site settings that need their own HTTP client.
+type probeOptions struct {
+	insecure   bool
+	noRedirect bool
+}
+
+// clientFor returns the HTTP client for probing site. Sites with default
+// settings share ch.Client; the others get a client per combination of
+// options, created on first use with ch.Client's timeout and kept so their
+// connections are reused between checks.
+func (ch *Checker) clientFor(site models.Site) *http.Client {
+	opts := probeOptions{insecure: site.HealthCheckInsecure, noRedirect: site.HealthCheckNoRedirect}
+	if opts == (probeOptions{}) {
+		return ch.Client
+	}
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if c, ok := ch.probeClients[opts]; ok {
+		return c
+	}
+	c := &http.Client{Timeout: ch.Client.Timeout, Transport: ch.Client.Transport}
+	if opts.insecure {
+		base, ok := ch.Client.Transport.(*http.Transport)
+		if !ok || base == nil {
+			base = http.DefaultTransport.(*http.Transport)
+		}
+		t := base.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{}
+		}
+		t.TLSClientConfig.InsecureSkipVerify = true
+		c.Transport = t
+	}
+	if opts.noRedirect {
+		c.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+	ch.probeClients[opts] = c
+	return c
+}
+
+// probeHTTP requests url with the site's health check method and records the
+// status and latency on hc. A network error leaves the status at 0. When the
+// site has an expected body substring, up to maxHealthBodyBytes of the body
+// are read and probeHTTP reports whether the substring was missing.
+func (ch *Checker) probeHTTP(site models.Site, url string, hc *models.HealthCheck) (bodyMissing bool) {
+	req, err := http.NewRequest(site.HealthCheckHTTPMethod(), url, nil)
+	if err != nil {
+		log.Printf("Health checker: bad probe request for site %d: %v", site.ID, err)
+		return false
+	}
+
+	start := time.Now()
+	resp, err := ch.clientFor(site).Do(req)
+	hc.LatencyMs = int(time.Since(start).Milliseconds())
+	if err != nil {
+		hc.HTTPStatus = 0
+		return false
+	}
+	defer resp.Body.Close()
+	hc.HTTPStatus = resp.StatusCode
+
+	if site.HealthCheckExpect != "" && resp.StatusCode < 400 {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxHealthBodyBytes))
+		if err != nil || !bytes.Contains(body, []byte(site.HealthCheckExpect)) {
+			bodyMissing = true
+			logging.Debugf("Health checker: site %d (%s) response did not contain %q", site.ID, site.Domain, site.HealthCheckExpect)
+		}
+	}
+	return bodyMissing
+}
+
+// maybeEnableSSL flips ssl_enabled on for a site whose domain already serves
+// a valid certificate, typically right after Caddy has obtained one. A site
+// without one is probed again after sslProbeRetryInterval, and names that
+// cannot get a public certificate are never probed.
+func (ch *Checker) maybeEnableSSL(site models.Site, now time.Time) {
+	domain := models.PrimaryDomain(site.Domain)
+	if !publicCertPossible(domain) {
+		return
+	}
+	ch.mu.Lock()
+	failedAt, failed := ch.sslProbeFailed[site.ID]
+	ch.mu.Unlock()
+	if failed && now.Sub(failedAt) < sslProbeRetryInterval {
+		return
+	}
+
+	expiry, err := ch.certProbe(domain)
+	if err == nil && !now.Before(expiry) {
+		err = fmt.Errorf("certificate expired on %s", expiry.Format("2006-01-02"))
+	}
+	ch.mu.Lock()
+	if err != nil {
+		ch.sslProbeFailed[site.ID] = now
 	} else {
-		wasDown := ch.failures[site.ID] > 0
-		alerted := ch.alertedSites[site.ID]
-		ch.failures[site.ID] = 0
-		ch.alertedSites[site.ID] = false
-		shouldRecover = wasDown && alerted
+		delete(ch.sslProbeFailed, site.ID)
 	}
 	ch.mu.Unlock()
+	if err != nil {
+		logging.Debugf("Health checker: no valid certificate for %s yet, probing again in %s: %v", site.Domain, sslProbeRetryInterval, err)
+		return
+	}
+	enabled, err := models.EnableSiteSSL(ch.DB, site.ID)
+	if err != nil {
+		log.Printf("Health checker: %v", err)
+		return
+	}
+	if !enabled {
+		return
+	}
+	if err := models.UpdateSiteSSLExpiry(ch.DB, site.ID, expiry); err != nil {
+		log.Printf("Health checker: failed to store ssl_expiry for site %d: %v", site.ID, err)
+	}
+	logging.Infof("Health checker: enabled SSL for %s (certificate valid until %s)", site.Domain, expiry.Format("2006-01-02"))
+	models.LogActivityWithContext(ch.DB, "site", site.ID, "ssl_enabled",
+		fmt.Sprintf("SSL enabled automatically for %s; certificate valid until %s", site.Domain, expiry.Format("2006-01-02")), "", "")
+}
 
-	// Perform webhook I/O outside the lock to avoid holding it during network
-	// calls, which could block other goroutines from updating their state.
-	if shouldAlert && ch.Webhook != nil {
-		errMsg := fmt.Sprintf("HTTP: %d, Container: %s", hc.HTTPStatus, hc.ContainerStatus)
-		if err := ch.Webhook.SendAlert(site.Domain, ch.failures[site.ID], errMsg); err != nil {
-			log.Printf("Webhook alert failed for %s: %v", site.Domain, err)
-			// Roll back the alerted flag so the next cycle can retry.
-			ch.mu.Lock()
-			ch.alertedSites[site.ID] = false
-			ch.mu.Unlock()
+// notifyAlert sends a down alert to every notifier. Each channel is attempted
+// independently so one failing integration cannot silence the others. It
+// reports whether at least one channel delivered the alert.
+func (ch *Checker) notifyAlert(domain string, failures int, lastError string) bool {
+	delivered := false
+	for _, n := range ch.Notifiers {
+		if err := n.SendAlert(domain, failures, lastError); err != nil {
+			log.Printf("%s alert failed for %s: %v", n.Name(), domain, err)
+			continue
 		}
+		delivered = true
 	}
+	return delivered
+}
 
-	if shouldRecover && ch.Webhook != nil {
-		if err := ch.Webhook.SendRecovery(site.Domain); err != nil {
-			log.Printf("Webhook recovery failed for %s: %v", site.Domain, err)
+// certWarningDays is how many days before expiry the warnings start.
+const certWarningDays = 14
+
+// certDaysLeft returns the whole days from now until expiry. It compares
+// instants, so neither value's time zone shifts the count.
+func certDaysLeft(expiry, now time.Time) int {
+	return int(expiry.Sub(now).Hours() / 24)
+}
+
+// handleCertExpiry stores the expiry a site's certificate was just seen with
+// and warns if it is within certWarningDays.
+func (ch *Checker) handleCertExpiry(site models.Site, expiry, now time.Time) {
+	if err := models.UpdateSiteSSLExpiry(ch.DB, site.ID, expiry); err != nil {
+		log.Printf("Health checker: failed to store ssl_expiry for site %d: %v", site.ID, err)
+	}
+	daysLeft := certDaysLeft(expiry, now)
+	if daysLeft <= certWarningDays && daysLeft > 0 {
+		ch.notifyCertExpiry(site.ID, site.Domain, daysLeft, expiry, now)
+	} else if daysLeft > certWarningDays {
+		ch.clearCertNotified(site.ID)
+	}
+}
+
+// notifyCertExpiry sends a certificate expiry warning to every notifier, at
+// most once per site per calendar day so a 5-minute check interval does not
+// flood inboxes for two weeks.
+func (ch *Checker) notifyCertExpiry(siteID int, domain string, daysLeft int, expiry, now time.Time) {
+	today := now.Format("2006-01-02")
+	ch.mu.Lock()
+	if ch.certNotified[siteID] == today {
+		ch.mu.Unlock()
+		return
+	}
+	ch.certNotified[siteID] = today
+	ch.mu.Unlock()
+
+	msg := fmt.Sprintf("SSL certificate expires in %d days", daysLeft)
+	for _, n := range ch.Notifiers {
+		var err error
+		if cn, ok := n.(CertExpiryNotifier); ok {
+			err = cn.SendCertExpiry(domain, daysLeft, expiry)
+		} else {
+			err = n.SendAlert(domain, 0, msg)
+		}
+		if err != nil {
+			log.Printf("%s cert-expiry alert failed for %s: %v", n.Name(), domain, err)
 		}
 	}
+}
 
-	if shouldAlert && ch.Email != nil {
-		errMsg := fmt.Sprintf("HTTP: %d, Container: %s", hc.HTTPStatus, hc.ContainerStatus)
-		if err := ch.Email.SendAlert(site.Domain, ch.failures[site.ID], errMsg); err != nil {
-			log.Printf("Email alert failed for %s: %v", site.Domain, err)
+// clearCertNotified forgets a site's last expiry warning once its certificate
+// has been renewed, so the next renewal problem is reported straight away.
+func (ch *Checker) clearCertNotified(siteID int) {
+	ch.mu.Lock()
+	delete(ch.certNotified, siteID)
+	ch.mu.Unlock()
+}
+
+// notifyEscalation tells every notifier a site is still down after downFor.
+// Channels that do not implement EscalationNotifier get a down alert that
+// says so.
+func (ch *Checker) notifyEscalation(domain string, downFor time.Duration, failures int, lastError string) {
+	for _, n := range ch.Notifiers {
+		var err error
+		if en, ok := n.(EscalationNotifier); ok {
+			err = en.SendEscalation(domain, downFor, failures, lastError)
+		} else {
+			err = n.SendAlert(domain, failures, fmt.Sprintf("still down after %s; %s", FormatDowntime(downFor), lastError))
+		}
+		if err != nil {
+			log.Printf("%s escalation failed for %s: %v", n.Name(), domain, err)
 		}
 	}
+}
 
-	if shouldRecover && ch.Email != nil {
-		if err := ch.Email.SendRecovery(site.Domain); err != nil {
-			log.Printf("Email recovery failed for %s: %v", site.Domain, err)
+// notifyRecovery sends a recovery notice to every notifier.
+func (ch *Checker) notifyRecovery(domain string, downFor time.Duration) {
+	for _, n := range ch.Notifiers {
+		if err := n.SendRecovery(domain, downFor); err != nil {
+			log.Printf("%s recovery failed for %s: %v", n.Name(), domain, err)
 		}
 	}
 }
@@ -303,11 +705,13 @@ func localProbeURL(site models.Site) string {
 	return ""
 }
 
-func (ch *Checker) checkLocalContainer(site models.Site, hc *models.HealthCheck) {
+// checkLocalContainer fills in the container fields of hc and returns the
+// container's image.
+func (ch *Checker) checkLocalContainer(site models.Site, hc *models.HealthCheck) string {
 	cli, err := docker.NewLocalClient()
 	if err != nil {
 		hc.ContainerStatus = "docker_error"
-		return
+		return ""
 	}
 	defer cli.Close()
 
@@ -316,7 +720,7 @@ func (ch *Checker) checkLocalContainer(site models.Site, hc *models.HealthCheck)
 
 	containerName := site.ContainerName
 	if containerName == "" {
-		containerName = strings.ReplaceAll(site.Domain, ".", "-")
+		containerName = strings.ReplaceAll(models.PrimaryDomain(site.Domain), ".", "-")
 	}
 
 	inspect, err := cli.ContainerInspect(ctx, containerName)
@@ -329,37 +733,251 @@ func (ch *Checker) checkLocalContainer(site models.Site, hc *models.HealthCheck)
 					for _, name := range c.Names {
 						if strings.Contains(name, containerName) {
 							hc.ContainerStatus = c.State
-							return
+							hc.StoppedCleanly = c.State == "exited" && cleanExitCode(listedExitCode(c.Status))
+							return c.Image
 						}
 					}
 				}
 			}
 		}
 		hc.ContainerStatus = "not_found"
-		return
+		return ""
 	}
 
 	hc.ContainerStatus = inspect.State.Status
+	hc.StoppedCleanly = inspect.State.Status == "exited" && cleanExitCode(inspect.State.ExitCode)
+	hc.RestartCount = inspect.RestartCount
+	hc.ContainerStartedAt = normalizeStartedAt(inspect.State.StartedAt)
+	if inspect.Config != nil {
+		return inspect.Config.Image
+	}
+	return ""
 }
 
-func (ch *Checker) checkRemoteContainer(site models.Site, hc *models.HealthCheck) {
+// checkRemoteContainer is checkLocalContainer for a site on a remote server.
+func (ch *Checker) checkRemoteContainer(site models.Site, hc *models.HealthCheck, pool *sshPool) string {
 	server, err := models.GetServerByID(ch.DB, int(site.ServerID.Int64))
 	if err != nil {
-		return
+		return ""
 	}
 
-	client, err := sshutil.NewClientWithHostKey(server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey)
-	if err != nil {
+	if _, err := pool.get(server); err != nil {
 		hc.ContainerStatus = "ssh_error"
-		return
+		return ""
+	}
+
+	if server.DeployMode == docker.DeployModeSwarm {
+		output, err := pool.run(server, docker.SwarmServicesCommand(server.DockerRemote(), site.ContainerName))
+		if err != nil {
+			hc.ContainerStatus = remoteErrorStatus(err)
+			return ""
+		}
+		services := docker.ParseSwarmServices(site.ContainerName, output)
+		var image string
+		hc.ContainerStatus, image = swarmStackStatus(services)
+		hc.StoppedCleanly = hc.ContainerStatus == "exited" && swarmScaledDown(services)
+		return image
+	}
+
+	// docker's complaint about a missing container is discarded, and with it
+	// sudo's; check sudo separately so a refusal is not taken for not_found.
+	notFound := "echo 'not_found'"
+	if server.UseSudo {
+		notFound = "{ sudo -n true && echo 'not_found'; }"
+	}
+	output, err := pool.run(server, fmt.Sprintf("%s inspect --format='{{.State.Status}}|{{.RestartCount}}|{{.State.StartedAt}}|{{.Config.Image}}|{{.State.ExitCode}}' %s 2>/dev/null || %s", server.DockerRemote().Docker(), site.ContainerName, notFound))
+	if err != nil {
+		hc.ContainerStatus = remoteErrorStatus(err)
+		return ""
+	}
+
+	var image string
+	var exitCode int
+	hc.ContainerStatus, hc.RestartCount, hc.ContainerStartedAt, image, exitCode = parseContainerInspect(output)
+	hc.StoppedCleanly = hc.ContainerStatus == "exited" && cleanExitCode(exitCode)
+	return image
+}
+
+// composeServiceLabel is the label docker compose puts on each container
+// with the name of the service it belongs to.
+const composeServiceLabel = "com.docker.compose.service"
+
+// composeProjectFilter returns the label filter that selects a site's
+// compose containers: by project directory when it is known, otherwise by
+// the project name compose derives from the container name.
+func composeProjectFilter(site models.Site, dir string) string {
+	if dir != "" {
+		return "com.docker.compose.project.working_dir=" + dir
+	}
+	return "com.docker.compose.project=" + strings.ToLower(site.ContainerName)
+}
+
+// checkLocalServices returns the state of each of a local site's expected
+// compose services.
+func (ch *Checker) checkLocalServices(site models.Site, services []string) []models.ServiceState {
+	cli, err := docker.NewLocalClient()
+	if err != nil {
+		return serviceStates(services, nil, "docker_error")
 	}
-	defer client.Close()
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	output, err := sshutil.RunCommand(client, fmt.Sprintf("docker inspect --format='{{.State.Status}}' %s 2>/dev/null || echo 'not found'", site.ContainerName))
+	containers, err := cli.ContainerList(ctx, dockertypes.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", composeProjectFilter(site, site.ComposePath))),
+	})
 	if err != nil {
-		hc.ContainerStatus = "unknown"
+		return serviceStates(services, nil, "docker_error")
+	}
+	found := make(map[string]string)
+	for _, c := range containers {
+		addServiceState(found, c.Labels[composeServiceLabel], c.State)
+	}
+	return serviceStates(services, found, "")
+}
+
+// checkRemoteServices is checkLocalServices for a site on a remote server.
+func (ch *Checker) checkRemoteServices(site models.Site, services []string, pool *sshPool) []models.ServiceState {
+	server, err := models.GetServerByID(ch.DB, int(site.ServerID.Int64))
+	if err != nil {
+		return serviceStates(services, nil, "unknown")
+	}
+	dir, err := docker.RemoteSiteDir(server.DeployPath, site.ContainerName)
+	if err != nil {
+		return serviceStates(services, nil, "unknown")
+	}
+	if _, err := pool.get(server); err != nil {
+		return serviceStates(services, nil, "ssh_error")
+	}
+
+	if server.DeployMode == docker.DeployModeSwarm {
+		output, err := pool.run(server, docker.SwarmServicesCommand(server.DockerRemote(), site.ContainerName))
+		if err != nil {
+			return serviceStates(services, nil, remoteErrorStatus(err))
+		}
+		found := make(map[string]string)
+		for _, svc := range docker.ParseSwarmServices(site.ContainerName, output) {
+			found[svc.Service] = svc.State()
+		}
+		return serviceStates(services, found, "")
+	}
+
+	output, err := pool.run(server, fmt.Sprintf(
+		`%s ps -a --filter label=%s --format '{{.Label "%s"}}|{{.State}}'`,
+		server.DockerRemote().Docker(), composeProjectFilter(site, dir), composeServiceLabel))
+	if err != nil {
+		return serviceStates(services, nil, remoteErrorStatus(err))
+	}
+	found := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		svc, state, ok := strings.Cut(strings.TrimSpace(line), "|")
+		if ok {
+			addServiceState(found, svc, state)
+		}
+	}
+	return serviceStates(services, found, "")
+}
+
+// remoteErrorStatus is the container status recorded when a docker command
+// on a remote server fails: "sudo_error" when sudo wanted a password,
+// otherwise "unknown".
+func remoteErrorStatus(err error) string {
+	if errors.Is(err, sshutil.ErrSudoPassword) {
+		return "sudo_error"
+	}
+	return "unknown"
+}
+
+// swarmStackStatus sums up a swarm site's services as a container status:
+// "running" when every service has all its desired replicas, "exited" when
+// any is short of them (the same rule addServiceState applies to compose
+// replicas), and "not_found" when the stack has no services. The image is
+// only known when the stack has a single service.
+func swarmStackStatus(services []docker.SwarmService) (status, image string) {
+	if len(services) == 0 {
+		return "not_found", ""
+	}
+	if len(services) == 1 {
+		image = services[0].Image
+	}
+	for _, svc := range services {
+		if svc.State() != "running" {
+			return "exited", image
+		}
+	}
+	return "running", image
+}
+
+// addServiceState records the state of one of a service's containers. A
+// service with several replicas is only running if all of them are.
+func addServiceState(found map[string]string, service, state string) {
+	if service == "" {
 		return
 	}
+	if prev, ok := found[service]; !ok || prev == "running" {
+		found[service] = state
+	}
+}
+
+// serviceStates returns the state of each expected service. When the
+// containers could not be listed at all, failure (e.g. "ssh_error") is
+// reported for every service; otherwise a service with no container is
+// "not_found".
+func serviceStates(expected []string, found map[string]string, failure string) []models.ServiceState {
+	states := make([]models.ServiceState, len(expected))
+	for i, svc := range expected {
+		status := failure
+		if status == "" {
+			status = found[svc]
+			if status == "" {
+				status = "not_found"
+			}
+		}
+		states[i] = models.ServiceState{Service: svc, Status: status}
+	}
+	return states
+}
+
+// formatServiceStates lists service states for an alert, e.g.
+// "db (exited), redis (not_found)".
+func formatServiceStates(states []models.ServiceState) string {
+	parts := make([]string, len(states))
+	for i, st := range states {
+		parts[i] = fmt.Sprintf("%s (%s)", st.Service, st.Status)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseContainerInspect splits the "status|restarts|startedAt|image|exitCode"
+// line printed by the remote docker inspect. A bare status (e.g.
+// "not_found") leaves the other fields at their zero values.
+func parseContainerInspect(output string) (status string, restarts int, startedAt, image string, exitCode int) {
+	parts := strings.SplitN(strings.TrimSpace(output), "|", 5)
+	status = parts[0]
+	if len(parts) > 1 {
+		restarts, _ = strconv.Atoi(parts[1])
+	}
+	if len(parts) > 2 {
+		startedAt = normalizeStartedAt(parts[2])
+	}
+	if len(parts) > 3 {
+		image = parts[3]
+	}
+	if len(parts) > 4 {
+		exitCode, _ = strconv.Atoi(parts[4])
+	}
+	return status, restarts, startedAt, image, exitCode
+}
 
-	hc.ContainerStatus = strings.TrimSpace(output)
+// normalizeStartedAt converts docker's nanosecond StartedAt timestamp to
+// RFC 3339 in UTC. Docker reports the zero time for containers that have
+// never started, which is stored as empty.
+func normalizeStartedAt(s string) string {
+	t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(s))
+	if err != nil || t.IsZero() || t.Year() <= 1 {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
 }
@@ -0,0 +1,432 @@
+package health
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+)
+
+func TestProbeHTTP_ExpectedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Write([]byte("<html>maintenance mode</html>"))
+	}))
+	defer srv.Close()
+
+	ch := NewChecker(nil, 0, nil, 3, 30, 90, 0)
+	tests := []struct {
+		name        string
+		site        models.Site
+		wantStatus  int
+		wantMissing bool
+	}{
+		{"no expectation", models.Site{}, http.StatusOK, false},
+		{"expected text present", models.Site{HealthCheckExpect: "maintenance"}, http.StatusOK, false},
+		{"expected text missing on 200", models.Site{HealthCheckExpect: "Welcome"}, http.StatusOK, true},
+		{"head method", models.Site{HealthCheckMethod: "HEAD"}, http.StatusNoContent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &models.HealthCheck{}
+			missing := ch.probeHTTP(tt.site, srv.URL, hc)
+			if hc.HTTPStatus != tt.wantStatus {
+				t.Errorf("status = %d, want %d", hc.HTTPStatus, tt.wantStatus)
+			}
+			if missing != tt.wantMissing {
+				t.Errorf("bodyMissing = %v, want %v", missing, tt.wantMissing)
+			}
+		})
+	}
+}
+
+func TestProbeHTTP_BodyReadIsCapped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("a", maxHealthBodyBytes)))
+		w.Write([]byte("needle"))
+	}))
+	defer srv.Close()
+
+	ch := NewChecker(nil, 0, nil, 3, 30, 90, 0)
+	hc := &models.HealthCheck{}
+	if !ch.probeHTTP(models.Site{HealthCheckExpect: "needle"}, srv.URL, hc) {
+		t.Error("text past the read cap should not be seen")
+	}
+}
+
+func TestProbeHTTP_InsecureAndNoRedirect(t *testing.T) {
+	tlsSrv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer tlsSrv.Close()
+	redirSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+		w.Write([]byte("login"))
+	}))
+	defer redirSrv.Close()
+
+	ch := NewChecker(nil, 0, nil, 3, 30, 90, 0)
+	tests := []struct {
+		name       string
+		site       models.Site
+		url        string
+		wantStatus int
+	}{
+		{"self-signed rejected", models.Site{}, tlsSrv.URL, 0},
+		{"self-signed allowed", models.Site{HealthCheckInsecure: true}, tlsSrv.URL, http.StatusOK},
+		{"redirect followed", models.Site{}, redirSrv.URL, http.StatusOK},
+		{"redirect not followed", models.Site{HealthCheckNoRedirect: true}, redirSrv.URL, http.StatusFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hc := &models.HealthCheck{}
+			ch.probeHTTP(tt.site, tt.url, hc)
+			if hc.HTTPStatus != tt.wantStatus {
+				t.Errorf("status = %d, want %d", hc.HTTPStatus, tt.wantStatus)
+			}
+		})
+	}
+
+	if ch.clientFor(models.Site{}) != ch.Client {
+		t.Error("sites with default settings should share the checker's client")
+	}
+	a := ch.clientFor(models.Site{ID: 1, HealthCheckInsecure: true})
+	b := ch.clientFor(models.Site{ID: 2, HealthCheckInsecure: true})
+	if a != b {
+		t.Error("sites with the same settings should share a client")
+	}
+}
+
+func TestParseContainerInspect(t *testing.T) {
+	tests := []struct {
+		in          string
+		wantStatus  string
+		wantRestart int
+		wantStarted string
+		wantImage   string
+		wantExit    int
+	}{
+		{"running|3|2024-05-01T12:00:00.123456789Z|ghcr.io/acme/shop:1.4.2|0\n", "running", 3, "2024-05-01T12:00:00Z", "ghcr.io/acme/shop:1.4.2", 0},
+		{"created|0|0001-01-01T00:00:00Z|nginx:alpine", "created", 0, "", "nginx:alpine", 0},
+		{"exited|0|2024-05-01T12:00:00Z|nginx:alpine|137", "exited", 0, "2024-05-01T12:00:00Z", "nginx:alpine", 137},
+		{"running|1|2024-05-01T12:00:00Z", "running", 1, "2024-05-01T12:00:00Z", "", 0},
+		{"not_found\n", "not_found", 0, "", "", 0},
+	}
+	for _, tt := range tests {
+		status, restarts, started, image, exit := parseContainerInspect(tt.in)
+		if status != tt.wantStatus || restarts != tt.wantRestart || started != tt.wantStarted || image != tt.wantImage || exit != tt.wantExit {
+			t.Errorf("parseContainerInspect(%q) = %q, %d, %q, %q, %d; want %q, %d, %q, %q, %d",
+				tt.in, status, restarts, started, image, exit, tt.wantStatus, tt.wantRestart, tt.wantStarted, tt.wantImage, tt.wantExit)
+		}
+	}
+}
+
+func TestSwarmStackStatus(t *testing.T) {
+	tests := []struct {
+		services   []docker.SwarmService
+		wantStatus string
+		wantImage  string
+	}{
+		{nil, "not_found", ""},
+		{[]docker.SwarmService{{Service: "app", Running: 1, Desired: 1, Image: "nginx:alpine"}}, "running", "nginx:alpine"},
+		{[]docker.SwarmService{{Service: "app", Running: 0, Desired: 0, Image: "nginx:alpine"}}, "exited", "nginx:alpine"},
+		{[]docker.SwarmService{
+			{Service: "app", Running: 2, Desired: 2, Image: "shop:1"},
+			{Service: "db", Running: 0, Desired: 1, Image: "postgres:16"},
+		}, "exited", ""},
+	}
+	for _, tt := range tests {
+		status, image := swarmStackStatus(tt.services)
+		if status != tt.wantStatus || image != tt.wantImage {
+			t.Errorf("swarmStackStatus(%v) = %q, %q; want %q, %q", tt.services, status, image, tt.wantStatus, tt.wantImage)
+		}
+	}
+}
+
+func TestServiceStates(t *testing.T) {
+	found := make(map[string]string)
+	addServiceState(found, "app", "running")
+	addServiceState(found, "worker", "running")
+	addServiceState(found, "worker", "restarting")
+	addServiceState(found, "worker", "running")
+	addServiceState(found, "", "running")
+
+	got := serviceStates([]string{"app", "worker", "db"}, found, "")
+	want := []models.ServiceState{{Service: "app", Status: "running"}, {Service: "worker", Status: "restarting"}, {Service: "db", Status: "not_found"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("serviceStates = %v, want %v", got, want)
+	}
+	hc := models.HealthCheck{Services: got}
+	if msg := formatServiceStates(hc.DownServices()); msg != "worker (restarting), db (not_found)" {
+		t.Errorf("down services = %q", msg)
+	}
+
+	unreachable := models.HealthCheck{Services: serviceStates([]string{"app", "db"}, nil, "ssh_error")}
+	if down := unreachable.DownServices(); len(down) != 0 {
+		t.Errorf("an SSH failure counted services as down: %v", down)
+	}
+}
+
+func TestUpdateAlertState_QuietHours(t *testing.T) {
+	type step struct {
+		down, quiet            bool
+		wantAlert, wantRecover bool
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"down checks in the window are not counted", []step{
+			{down: true, quiet: true},
+			{down: true, quiet: true},
+			{down: true, quiet: true},
+			{down: true, quiet: true},
+		}},
+		{"still down after the window alerts as usual", []step{
+			{down: true, quiet: true},
+			{down: true, quiet: true},
+			{down: true},
+			{down: true, wantAlert: true},
+		}},
+		{"recovered by the end of the window reports recovery", []step{
+			{down: true, quiet: true},
+			{down: false, quiet: true},
+			{down: false, wantRecover: true},
+			{down: false},
+		}},
+		{"recovery of an earlier alert is not held back", []step{
+			{down: true},
+			{down: true, wantAlert: true},
+			{down: false, quiet: true, wantRecover: true},
+			{down: false},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := NewChecker(nil, 0, nil, 2, 30, 90, 0)
+			for i, s := range tt.steps {
+				d := ch.updateAlertState(1, s.down, s.quiet, time.Now())
+				if d.alert != s.wantAlert || d.recover != s.wantRecover {
+					t.Errorf("step %d: alert=%v recover=%v, want alert=%v recover=%v", i, d.alert, d.recover, s.wantAlert, s.wantRecover)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateAlertState_Escalation(t *testing.T) {
+	ch := NewChecker(nil, 0, nil, 2, 30, 90, 0)
+	ch.Escalation = []time.Duration{30 * time.Minute, time.Hour}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// A check every 10 minutes: down from 12:00, recovered at 14:50.
+	var alerts, escalations []string
+	var recovered time.Duration
+	for at := start; !at.After(start.Add(170 * time.Minute)); at = at.Add(10 * time.Minute) {
+		quiet := at.Hour() == 13 && at.Minute() >= 30 && at.Minute() < 50
+		d := ch.updateAlertState(1, at.Before(start.Add(170*time.Minute)), quiet, at)
+		switch {
+		case d.alert:
+			alerts = append(alerts, at.Format("15:04"))
+		case d.escalate:
+			escalations = append(escalations, at.Format("15:04")+" "+FormatDowntime(d.downFor))
+		case d.recover:
+			recovered = d.downFor
+		}
+	}
+
+	if got := strings.Join(alerts, ","); got != "12:10" {
+		t.Errorf("alerts at %s, want 12:10", got)
+	}
+	// 12:40 is 30 minutes after the alert. The hourly one due at 13:40 is
+	// held back by quiet hours until 13:50, and the next would be 14:50.
+	if got, want := strings.Join(escalations, ","), "12:40 40m,13:50 1h 50m"; got != want {
+		t.Errorf("escalations %q, want %q", got, want)
+	}
+	if recovered != 170*time.Minute {
+		t.Errorf("recovery downtime = %v, want 2h50m", recovered)
+	}
+
+	// The next outage starts counting afresh.
+	at := start.Add(4 * time.Hour)
+	ch.updateAlertState(1, true, false, at)
+	if d := ch.updateAlertState(1, true, false, at.Add(time.Minute)); !d.alert {
+		t.Error("expected a new outage to alert again")
+	}
+	if d := ch.updateAlertState(1, false, false, at.Add(2*time.Minute)); !d.recover || d.downFor != 2*time.Minute {
+		t.Errorf("recovery = %+v, want downtime 2m", d)
+	}
+}
+
+func TestUpdateAlertState_NoEscalationByDefault(t *testing.T) {
+	ch := NewChecker(nil, 0, nil, 1, 30, 90, 0)
+	start := time.Now()
+	for i := 0; i < 50; i++ {
+		if d := ch.updateAlertState(1, true, false, start.Add(time.Duration(i)*time.Hour)); d.escalate {
+			t.Fatalf("escalated at check %d with no escalation configured", i)
+		}
+	}
+}
+
+func TestNewChecker_Concurrency(t *testing.T) {
+	for _, tt := range []struct{ in, want int }{{25, 25}, {1, 1}, {0, defaultMaxConcurrentChecks}, {-3, defaultMaxConcurrentChecks}} {
+		if got := cap(NewChecker(nil, 0, nil, 3, 30, 90, tt.in).semaphore); got != tt.want {
+			t.Errorf("NewChecker(..., %d) allows %d concurrent checks, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestResetSiteState(t *testing.T) {
+	ch := NewChecker(nil, 0, nil, 1, 30, 90, 0)
+	now := time.Now()
+	if d := ch.updateAlertState(1, true, false, now); !d.alert {
+		t.Fatal("expected the first down check to alert")
+	}
+	ch.certNotified[1] = "2026-03-01"
+
+	ch.ResetSiteState()
+
+	if d := ch.updateAlertState(1, false, false, now.Add(time.Minute)); d.recover {
+		t.Error("expected no recovery for an alert from before the reset")
+	}
+	if d := ch.updateAlertState(1, true, false, now.Add(2*time.Minute)); !d.alert {
+		t.Error("expected a site down after the reset to alert again")
+	}
+	if len(ch.certNotified) != 0 {
+		t.Errorf("certNotified = %v, want empty", ch.certNotified)
+	}
+}
+
+func TestHandleCertExpiry_ServerTimeZone(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	saved := time.Local
+	defer func() { time.Local = saved }()
+
+	for _, offset := range []int{-10, -5, 0, 5, 14} {
+		time.Local = time.FixedZone("server", offset*3600)
+		site := &models.Site{Domain: fmt.Sprintf("tz%d.example.com", offset+10), TemplateSlug: "static-site", Status: "running", SSLEnabled: true}
+		if err := models.CreateSite(database, site); err != nil {
+			t.Fatal(err)
+		}
+
+		email := &fakeCertNotifier{fakeNotifier: fakeNotifier{name: "email"}}
+		ch := NewChecker(database, 0, []Notifier{email}, 3, 30, 90, 0)
+		now := time.Now()
+		expiry := now.Add(13 * 24 * time.Hour).In(time.Local)
+
+		ch.handleCertExpiry(*site, expiry, now)
+		if email.certWarnings != 1 || email.daysLeft != 13 {
+			t.Errorf("UTC%+d: warnings=%d daysLeft=%d, want one 13-day warning", offset, email.certWarnings, email.daysLeft)
+		}
+
+		stored, err := models.GetSiteByID(database, site.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := stored.SSLExpiry.Time
+		if !stored.SSLExpiry.Valid || !got.Equal(expiry) || got.Location() != time.UTC {
+			t.Errorf("UTC%+d: stored expiry %v (valid=%v), want %v in UTC", offset, got, stored.SSLExpiry.Valid, expiry.UTC())
+		}
+		if days := certDaysLeft(got, now); days != 13 {
+			t.Errorf("UTC%+d: stored expiry is %d days out, want 13", offset, days)
+		}
+	}
+}
+
+func TestPublicCertPossible(t *testing.T) {
+	for domain, want := range map[string]bool{
+		"shop.example.com":   true,
+		"Blog.Example.COM.":  true,
+		"localhost":          false,
+		"app.localhost":      false,
+		"shared-infra.local": false,
+		"nas.home.arpa":      false,
+		"db.internal":        false,
+		"192.168.1.10":       false,
+		"::1":                false,
+		"intranet":           false,
+	} {
+		if got := publicCertPossible(domain); got != want {
+			t.Errorf("publicCertPossible(%q) = %v, want %v", domain, got, want)
+		}
+	}
+}
+
+func TestMaybeEnableSSL(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &models.Site{Domain: "shop.example.com", ContainerName: "shop", Port: 8080, Status: "running"}
+	local := &models.Site{Domain: "nas.local", ContainerName: "nas", Port: 8081, Status: "running", IsLocal: true}
+	for _, s := range []*models.Site{site, local} {
+		if err := models.CreateSite(database, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch := NewChecker(database, 0, nil, 3, 30, 90, 0)
+	var probed []string
+	var expiry time.Time
+	probeErr := fmt.Errorf("TLS dial failed")
+	ch.certProbe = func(domain string) (time.Time, error) {
+		probed = append(probed, domain)
+		return expiry, probeErr
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	ch.maybeEnableSSL(*local, now)
+	if len(probed) != 0 {
+		t.Fatalf("probed %v for a local-network name", probed)
+	}
+
+	// A failed probe holds the next one back for a day.
+	ch.maybeEnableSSL(*site, now)
+	ch.maybeEnableSSL(*site, now.Add(time.Hour))
+	if len(probed) != 1 {
+		t.Fatalf("probes within a day of a failure = %d, want 1", len(probed))
+	}
+
+	// An expired certificate counts as a failure.
+	probeErr, expiry = nil, now.Add(-time.Hour)
+	ch.maybeEnableSSL(*site, now.Add(sslProbeRetryInterval))
+	if len(probed) != 2 {
+		t.Fatalf("probes after the retry interval = %d, want 2", len(probed))
+	}
+	if got, _ := models.GetSiteByID(database, site.ID); got.SSLEnabled {
+		t.Fatal("SSL enabled on an expired certificate")
+	}
+
+	expiry = now.Add(90 * 24 * time.Hour)
+	ch.maybeEnableSSL(*site, now.Add(2*sslProbeRetryInterval))
+	got, err := models.GetSiteByID(database, site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.SSLEnabled || !got.SSLExpiry.Valid || !got.SSLExpiry.Time.Equal(expiry) {
+		t.Errorf("site = ssl %v expiry %v, want SSL enabled until %v", got.SSLEnabled, got.SSLExpiry.Time, expiry)
+	}
+	if _, held := ch.sslProbeFailed[site.ID]; held {
+		t.Error("back-off kept after a successful probe")
+	}
+}
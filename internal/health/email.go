@@ -1,11 +1,28 @@
 package health
 
 import (
+	"crypto/tls"
 	"fmt"
+	"net"
 	"net/smtp"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// SMTP TLS modes, set with SMTP_TLS.
+const (
+	// SMTPTLSAuto uses implicit TLS on port 465 and otherwise upgrades with
+	// STARTTLS when the server offers it.
+	SMTPTLSAuto     = "auto"
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls" // STARTTLS is required
+	SMTPTLSImplicit = "tls"      // TLS from the first byte, usually port 465
+)
+
+// smtpTimeout bounds a whole SMTP session, from connecting to QUIT.
+const smtpTimeout = 30 * time.Second
+
 type EmailSender struct {
 	Host     string
 	Port     int
@@ -13,9 +30,10 @@ type EmailSender struct {
 	To       []string
 	Username string
 	Password string
+	TLSMode  string // one of the SMTPTLS* modes; empty means SMTPTLSAuto
 }
 
-func NewEmailSender(host string, port int, from string, to string, username string, password string) *EmailSender {
+func NewEmailSender(host string, port int, from string, to string, username string, password string, tlsMode string) *EmailSender {
 	if host == "" || from == "" || to == "" {
 		return nil
 	}
@@ -30,31 +48,147 @@ func NewEmailSender(host string, port int, from string, to string, username stri
 		To:       recipients,
 		Username: username,
 		Password: password,
+		TLSMode:  tlsMode,
 	}
 }
 
+// Name returns the channel label used in logs.
+func (es *EmailSender) Name() string {
+	return "email"
+}
+
 func (es *EmailSender) SendAlert(domain string, failures int, lastError string) error {
 	subject := fmt.Sprintf("Site Down: %s", domain)
 	body := fmt.Sprintf("Site %s is DOWN.\n\n%d consecutive health check failures.\n\nLast error: %s", domain, failures, lastError)
 	return es.send(subject, body)
 }
 
-func (es *EmailSender) SendRecovery(domain string) error {
+// SendEscalation reports that domain is still down after downFor.
+func (es *EmailSender) SendEscalation(domain string, downFor time.Duration, failures int, lastError string) error {
+	subject := fmt.Sprintf("Site Still Down: %s", domain)
+	body := fmt.Sprintf("Site %s is STILL DOWN after %s.\n\n%d consecutive health check failures.\n\nLast error: %s", domain, FormatDowntime(downFor), failures, lastError)
+	return es.send(subject, body)
+}
+
+func (es *EmailSender) SendRecovery(domain string, downFor time.Duration) error {
 	subject := fmt.Sprintf("Site Recovered: %s", domain)
 	body := fmt.Sprintf("Site %s is back UP and responding normally.", domain)
+	if downFor > 0 {
+		body += fmt.Sprintf("\n\nTotal downtime: %s.", FormatDowntime(downFor))
+	}
+	return es.send(subject, body)
+}
+
+// SendCertExpiry warns that the TLS certificate for domain expires soon.
+func (es *EmailSender) SendCertExpiry(domain string, daysLeft int, expiry time.Time) error {
+	subject := fmt.Sprintf("SSL Certificate Expiring: %s", domain)
+	body := fmt.Sprintf("The SSL certificate for %s expires in %d days (%s).\n\nCaddy normally renews certificates well before this point, so check its logs for ACME errors.",
+		domain, daysLeft, expiry.UTC().Format("2006-01-02 15:04 UTC"))
 	return es.send(subject, body)
 }
 
+// TestConnection connects to the SMTP server, sets up TLS and logs in as
+// a send would, then issues NOOP and QUIT without sending anything.
+func (es *EmailSender) TestConnection() error {
+	c, err := es.dial()
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Noop(); err != nil {
+		return fmt.Errorf("NOOP: %w", err)
+	}
+	return c.Quit()
+}
+
+// mode resolves TLSMode, turning auto into implicit TLS on port 465.
+func (es *EmailSender) mode() string {
+	switch es.TLSMode {
+	case SMTPTLSNone, SMTPTLSStartTLS, SMTPTLSImplicit:
+		return es.TLSMode
+	}
+	if es.Port == 465 {
+		return SMTPTLSImplicit
+	}
+	return SMTPTLSAuto
+}
+
+// dial opens an SMTP session with TLS set up according to TLSMode and, when
+// a username is set, authenticated. Credentials are only ever sent over TLS
+// (or to localhost): net/smtp's PLAIN auth refuses anything else.
+func (es *EmailSender) dial() (*smtp.Client, error) {
+	addr := net.JoinHostPort(es.Host, strconv.Itoa(es.Port))
+	tlsConfig := &tls.Config{ServerName: es.Host}
+	dialer := &net.Dialer{Timeout: smtpTimeout}
+	mode := es.mode()
+
+	var conn net.Conn
+	var err error
+	if mode == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s (%s): %w", addr, mode, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, es.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SMTP greeting from %s: %w", addr, err)
+	}
+
+	if mode == SMTPTLSStartTLS || mode == SMTPTLSAuto {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(tlsConfig); err != nil {
+				c.Close()
+				return nil, fmt.Errorf("STARTTLS with %s: %w", addr, err)
+			}
+		} else if mode == SMTPTLSStartTLS {
+			c.Close()
+			return nil, fmt.Errorf("%s does not offer STARTTLS", addr)
+		}
+	}
+
+	if es.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", es.Username, es.Password, es.Host)); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("SMTP auth as %s: %w", es.Username, err)
+		}
+	}
+	return c, nil
+}
+
 func (es *EmailSender) send(subject, body string) error {
 	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
 		es.From, strings.Join(es.To, ", "), subject, body)
 
-	addr := fmt.Sprintf("%s:%d", es.Host, es.Port)
-
-	var auth smtp.Auth
-	if es.Username != "" {
-		auth = smtp.PlainAuth("", es.Username, es.Password, es.Host)
+	c, err := es.dial()
+	if err != nil {
+		return err
 	}
+	defer c.Close()
 
-	return smtp.SendMail(addr, auth, es.From, es.To, []byte(msg))
+	if err := c.Mail(es.From); err != nil {
+		return fmt.Errorf("MAIL FROM %s: %w", es.From, err)
+	}
+	for _, rcpt := range es.To {
+		if err := c.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("RCPT TO %s: %w", rcpt, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	if _, err := w.Write([]byte(msg)); err != nil {
+		w.Close()
+		return fmt.Errorf("write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send message: %w", err)
+	}
+	return c.Quit()
 }
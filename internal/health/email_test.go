@@ -0,0 +1,103 @@
+package health
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP serves one plain SMTP session at a time that offers no
+// extensions beyond PIPELINING, and records the commands it receives.
+func fakeSMTP(t *testing.T) (host string, port int, commands chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	commands = make(chan string, 32)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				conn.Write([]byte("220 fake ESMTP\r\n"))
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					cmd := strings.ToUpper(strings.Fields(line + " x")[0])
+					commands <- cmd
+					switch cmd {
+					case "EHLO":
+						conn.Write([]byte("250-fake\r\n250 PIPELINING\r\n"))
+					case "QUIT":
+						conn.Write([]byte("221 bye\r\n"))
+						return
+					default:
+						conn.Write([]byte("250 OK\r\n"))
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, commands
+}
+
+func TestEmailSender_TestConnection(t *testing.T) {
+	host, port, commands := fakeSMTP(t)
+
+	es := NewEmailSender(host, port, "ezweb@example.com", "ops@example.com", "", "", SMTPTLSNone)
+	if err := es.TestConnection(); err != nil {
+		t.Fatalf("TestConnection: %v", err)
+	}
+	var got []string
+	for len(commands) > 0 {
+		got = append(got, <-commands)
+	}
+	if strings.Join(got, " ") != "EHLO NOOP QUIT" {
+		t.Errorf("commands = %v, want EHLO NOOP QUIT and no mail", got)
+	}
+
+	// Auto falls back to plain SMTP when STARTTLS is not offered, but a
+	// required STARTTLS must fail rather than send in the clear.
+	es.TLSMode = SMTPTLSAuto
+	if err := es.TestConnection(); err != nil {
+		t.Errorf("auto without STARTTLS: %v", err)
+	}
+	es.TLSMode = SMTPTLSStartTLS
+	if err := es.TestConnection(); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("starttls against a server without it: err = %v", err)
+	}
+}
+
+func TestEmailSender_Mode(t *testing.T) {
+	cases := []struct {
+		mode string
+		port int
+		want string
+	}{
+		{"", 465, SMTPTLSImplicit},
+		{SMTPTLSAuto, 465, SMTPTLSImplicit},
+		{SMTPTLSAuto, 587, SMTPTLSAuto},
+		{SMTPTLSStartTLS, 465, SMTPTLSStartTLS},
+		{SMTPTLSNone, 25, SMTPTLSNone},
+		{SMTPTLSImplicit, 2465, SMTPTLSImplicit},
+	}
+	for _, tc := range cases {
+		es := &EmailSender{Port: tc.port, TLSMode: tc.mode}
+		if got := es.mode(); got != tc.want {
+			t.Errorf("mode(%q, port %s) = %q, want %q", tc.mode, strconv.Itoa(tc.port), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package health
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Values used by SendTestAlerts. They are chosen so the resulting message is
+// obviously not a real outage in any channel's rendering.
+const (
+	TestAlertDomain  = "example.com (EzWeb test alert)"
+	testAlertMessage = "This is a test alert sent from EzWeb settings. No site is down."
+	testAlertTimeout = 30 * time.Second
+)
+
+// TestResult is the outcome of sending a test alert through one channel.
+type TestResult struct {
+	Channel string `json:"channel"`
+	OK      bool   `json:"ok"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Notifier is an alert channel the health checker can fan out to. Webhook
+// and email senders both implement it.
+type Notifier interface {
+	// Name identifies the channel in log output (e.g. "slack webhook").
+	Name() string
+	SendAlert(domain string, failures int, lastError string) error
+	// SendRecovery reports that domain is back up after downFor of
+	// downtime; zero means the start of the outage is not known.
+	SendRecovery(domain string, downFor time.Duration) error
+}
+
+// EscalationNotifier is implemented by channels that word the repeat alert
+// for a site that is still down differently from the first one. Channels
+// without it receive the escalation through SendAlert.
+type EscalationNotifier interface {
+	SendEscalation(domain string, downFor time.Duration, failures int, lastError string) error
+}
+
+// CertExpiryNotifier is implemented by channels that format certificate
+// expiry warnings differently from down alerts. Channels without it receive
+// the warning through SendAlert.
+type CertExpiryNotifier interface {
+	SendCertExpiry(domain string, daysLeft int, expiry time.Time) error
+}
+
+// ConnectionTester is implemented by channels that can check their settings
+// without delivering anything, such as the SMTP sender.
+type ConnectionTester interface {
+	TestConnection() error
+}
+
+// FormatDowntime renders an outage length for a notification, such as
+// "2h 5m" or "45s". Anything from a minute up is rounded to the minute.
+func FormatDowntime(d time.Duration) string {
+	if d < time.Minute {
+		return fmt.Sprintf("%ds", int(d.Round(time.Second)/time.Second))
+	}
+	d = d.Round(time.Minute)
+	h, m := int(d/time.Hour), int(d%time.Hour/time.Minute)
+	switch {
+	case h == 0:
+		return fmt.Sprintf("%dm", m)
+	case m == 0:
+		return fmt.Sprintf("%dh", h)
+	default:
+		return fmt.Sprintf("%dh %dm", h, m)
+	}
+}
+
+// BuildNotifiers assembles the notifier list from config. The legacy single
+// webhook (url/format) is kept for backward compatibility and is combined with
+// the comma-separated urls list; formats pairs positionally with urls and any
+// missing entry falls back to defaultFormat. Duplicate URLs are skipped. Every
+// webhook signs its requests with secret when it is set. The email sender is
+// appended when configured (non-nil).
+func BuildNotifiers(url, defaultFormat string, urls, formats []string, secret string, email *EmailSender) []Notifier {
+	var notifiers []Notifier
+	seen := make(map[string]bool)
+
+	add := func(u, format string) {
+		u = strings.TrimSpace(u)
+		if u == "" || seen[u] {
+			return
+		}
+		seen[u] = true
+		format = strings.TrimSpace(format)
+		if format == "" {
+			format = defaultFormat
+		}
+		ws := NewWebhookSender(u, format)
+		ws.Secret = secret
+		notifiers = append(notifiers, ws)
+	}
+
+	add(url, defaultFormat)
+	for i, u := range urls {
+		format := ""
+		if i < len(formats) {
+			format = formats[i]
+		}
+		add(u, format)
+	}
+
+	if email != nil {
+		notifiers = append(notifiers, email)
+	}
+	return notifiers
+}
+
+// SendTestAlerts sends a sample down alert through every notifier in parallel
+// and reports the outcome per channel, including the exact error returned
+// (e.g. an SMTP auth failure or a webhook 404). Channels that implement
+// ConnectionTester are tested first, so a TLS or login problem is reported
+// as such. Channels that do not answer within testAlertTimeout are reported
+// as timed out.
+func SendTestAlerts(notifiers []Notifier) []TestResult {
+	results := make([]TestResult, len(notifiers))
+	var wg sync.WaitGroup
+	for i, n := range notifiers {
+		wg.Add(1)
+		go func(i int, n Notifier) {
+			defer wg.Done()
+			res := TestResult{Channel: n.Name()}
+
+			done := make(chan error, 1)
+			go func() {
+				if ct, ok := n.(ConnectionTester); ok {
+					if err := ct.TestConnection(); err != nil {
+						done <- fmt.Errorf("connection test: %w", err)
+						return
+					}
+				}
+				done <- n.SendAlert(TestAlertDomain, 0, testAlertMessage)
+			}()
+
+			select {
+			case err := <-done:
+				if err != nil {
+					res.Error = err.Error()
+				} else {
+					res.OK = true
+				}
+			case <-time.After(testAlertTimeout):
+				res.Error = fmt.Sprintf("timed out after %s", testAlertTimeout)
+			}
+			results[i] = res
+		}(i, n)
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,160 @@
+package health
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeNotifier struct {
+	name       string
+	err        error
+	alerts     int
+	recoveries int
+}
+
+func (f *fakeNotifier) Name() string { return f.name }
+
+func (f *fakeNotifier) SendAlert(domain string, failures int, lastError string) error {
+	f.alerts++
+	return f.err
+}
+
+func (f *fakeNotifier) SendRecovery(domain string, downFor time.Duration) error {
+	f.recoveries++
+	return f.err
+}
+
+// fakeCertNotifier also implements CertExpiryNotifier, like EmailSender.
+type fakeCertNotifier struct {
+	fakeNotifier
+	certWarnings int
+	daysLeft     int
+}
+
+func (f *fakeCertNotifier) SendCertExpiry(domain string, daysLeft int, expiry time.Time) error {
+	f.certWarnings++
+	f.daysLeft = daysLeft
+	return f.err
+}
+
+func TestNotifyAlert_FailingChannelDoesNotBlockOthers(t *testing.T) {
+	broken := &fakeNotifier{name: "broken", err: errors.New("boom")}
+	ok := &fakeNotifier{name: "ok"}
+	ch := NewChecker(nil, 0, []Notifier{broken, ok}, 3, 30, 90, 0)
+
+	if !ch.notifyAlert("example.com", 3, "HTTP: 0") {
+		t.Error("expected alert to be reported as delivered when one channel succeeds")
+	}
+	if broken.alerts != 1 || ok.alerts != 1 {
+		t.Errorf("expected every channel to be attempted once, got broken=%d ok=%d", broken.alerts, ok.alerts)
+	}
+
+	ch.notifyRecovery("example.com", time.Minute)
+	if broken.recoveries != 1 || ok.recoveries != 1 {
+		t.Errorf("expected every channel to receive recovery, got broken=%d ok=%d", broken.recoveries, ok.recoveries)
+	}
+}
+
+func TestNotifyAlert_AllChannelsFailing(t *testing.T) {
+	ch := NewChecker(nil, 0, []Notifier{&fakeNotifier{name: "a", err: errors.New("x")}}, 3, 30, 90, 0)
+	if ch.notifyAlert("example.com", 3, "") {
+		t.Error("expected delivery to be false when every channel fails")
+	}
+}
+
+func TestFormatDowntime(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{45 * time.Second, "45s"},
+		{90 * time.Second, "2m"},
+		{30 * time.Minute, "30m"},
+		{2 * time.Hour, "2h"},
+		{2*time.Hour + 5*time.Minute, "2h 5m"},
+		{26*time.Hour + 59*time.Minute + 40*time.Second, "27h"},
+	}
+	for _, tt := range tests {
+		if got := FormatDowntime(tt.d); got != tt.want {
+			t.Errorf("FormatDowntime(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestBuildNotifiers_CombinesLegacyAndList(t *testing.T) {
+	email := &EmailSender{Host: "smtp.example.com"}
+	got := BuildNotifiers(
+		"https://discord.example/a", "discord",
+		[]string{"https://hooks.slack.example/b", "https://discord.example/a", "https://discord.example/c"},
+		[]string{"slack"},
+		"",
+		email,
+	)
+
+	if len(got) != 4 {
+		t.Fatalf("expected 4 notifiers (3 unique webhooks + email), got %d", len(got))
+	}
+	want := []string{"discord webhook", "slack webhook", "discord webhook", "email"}
+	for i, n := range got {
+		if n.Name() != want[i] {
+			t.Errorf("notifier %d = %q, want %q", i, n.Name(), want[i])
+		}
+	}
+}
+
+func TestBuildNotifiers_NilEmailSkipped(t *testing.T) {
+	if got := BuildNotifiers("", "discord", nil, nil, "", nil); len(got) != 0 {
+		t.Errorf("expected no notifiers, got %d", len(got))
+	}
+}
+
+func TestSendTestAlerts_ReportsPerChannel(t *testing.T) {
+	broken := &fakeNotifier{name: "email", err: errors.New("535 authentication failed")}
+	ok := &fakeNotifier{name: "slack webhook"}
+
+	results := SendTestAlerts([]Notifier{broken, ok})
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if results[0].Channel != "email" || results[0].OK || results[0].Error != "535 authentication failed" {
+		t.Errorf("unexpected result for failing channel: %+v", results[0])
+	}
+	if results[1].Channel != "slack webhook" || !results[1].OK || results[1].Error != "" {
+		t.Errorf("unexpected result for working channel: %+v", results[1])
+	}
+}
+
+func TestNotifyCertExpiry_OncePerDayPerSite(t *testing.T) {
+	hook := &fakeNotifier{name: "discord webhook"}
+	email := &fakeCertNotifier{fakeNotifier: fakeNotifier{name: "email"}}
+	ch := NewChecker(nil, 0, []Notifier{hook, email}, 3, 30, 90, 0)
+
+	day1 := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	expiry := day1.AddDate(0, 0, 10)
+
+	ch.notifyCertExpiry(1, "a.example.com", 10, expiry, day1)
+	ch.notifyCertExpiry(1, "a.example.com", 10, expiry, day1.Add(5*time.Minute))
+	if hook.alerts != 1 || email.certWarnings != 1 {
+		t.Fatalf("expected one warning per channel on day 1, got webhook=%d email=%d", hook.alerts, email.certWarnings)
+	}
+	if email.alerts != 0 {
+		t.Errorf("email should get the cert-specific message, not a down alert")
+	}
+
+	ch.notifyCertExpiry(2, "b.example.com", 10, expiry, day1)
+	if email.certWarnings != 2 {
+		t.Errorf("a different site should be warned independently, got %d", email.certWarnings)
+	}
+
+	ch.notifyCertExpiry(1, "a.example.com", 9, expiry, day1.AddDate(0, 0, 1))
+	if email.certWarnings != 3 {
+		t.Errorf("expected a fresh warning the next day, got %d", email.certWarnings)
+	}
+
+	ch.clearCertNotified(1)
+	ch.notifyCertExpiry(1, "a.example.com", 9, expiry, day1.AddDate(0, 0, 1))
+	if email.certWarnings != 4 {
+		t.Errorf("expected a warning after the flag was cleared, got %d", email.certWarnings)
+	}
+}
@@ -0,0 +1,116 @@
+package health
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"ezweb/internal/docker"
+	"ezweb/internal/logging"
+	"ezweb/internal/models"
+)
+
+// reconcileAfter is how many checks in a row must disagree with a site's
+// status, the same way, before the status is corrected. A container caught
+// mid-restart or a single failed inspect does not flip it.
+const reconcileAfter = 2
+
+// statusObservation counts consecutive checks that showed a site in a
+// status other than the one it has.
+type statusObservation struct {
+	status string
+	count  int
+}
+
+// observedSiteStatus returns the site status a check shows: running for a
+// running container, stopped for one that was stopped, and error for one
+// that crashed, is crash-looping or does not exist. It returns "" when the
+// check says nothing certain, e.g. the server could not be reached.
+//
+// A container that exits with an error after the site was stopped is
+// expected, since not every process exits cleanly on SIGTERM, so a stopped
+// site stays stopped.
+func observedSiteStatus(site models.Site, hc *models.HealthCheck) string {
+	switch hc.ContainerStatus {
+	case "running":
+		return "running"
+	case "exited":
+		if hc.StoppedCleanly || site.Status == "stopped" {
+			return "stopped"
+		}
+		return "error"
+	case "not_found", "dead", "restarting":
+		return "error"
+	}
+	return ""
+}
+
+// reconcileStatus brings sites.status in line with what the check found,
+// once reconcileAfter checks in a row agree. The update only applies if the
+// status is still the one read at the start of the round.
+func (ch *Checker) reconcileStatus(site models.Site, hc *models.HealthCheck) {
+	observed := observedSiteStatus(site, hc)
+
+	ch.mu.Lock()
+	if observed == "" || observed == site.Status {
+		delete(ch.statusSeen, site.ID)
+		ch.mu.Unlock()
+		return
+	}
+	seen := ch.statusSeen[site.ID]
+	if seen.status != observed {
+		seen = statusObservation{status: observed}
+	}
+	seen.count++
+	if seen.count < reconcileAfter {
+		ch.statusSeen[site.ID] = seen
+		ch.mu.Unlock()
+		return
+	}
+	delete(ch.statusSeen, site.ID)
+	ch.mu.Unlock()
+
+	changed, err := models.ReconcileSiteStatus(ch.DB, site.ID, site.Status, observed)
+	if err != nil {
+		log.Printf("Health checker: %v", err)
+		return
+	}
+	if changed {
+		logging.Infof("Health checker: site %d (%s) status %s -> %s (container %s)", site.ID, site.Domain, site.Status, observed, hc.ContainerStatus)
+	}
+}
+
+// cleanExitCode reports whether a container's exit code means it was
+// stopped: 0, or 143 for a process that died of docker stop's SIGTERM.
+func cleanExitCode(code int) bool {
+	return code == 0 || code == 143
+}
+
+// listedExitCode reads the exit code from a container list status such as
+// "Exited (137) 2 hours ago". It returns -1 when there is none.
+func listedExitCode(status string) int {
+	rest, ok := strings.CutPrefix(status, "Exited (")
+	if !ok {
+		return -1
+	}
+	code, _, ok := strings.Cut(rest, ")")
+	if !ok {
+		return -1
+	}
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// swarmScaledDown reports whether every service of a swarm stack is scaled
+// to zero, which is how a swarm site is stopped.
+func swarmScaledDown(services []docker.SwarmService) bool {
+	for _, svc := range services {
+		if svc.Desired != 0 {
+			return false
+		}
+	}
+	return len(services) > 0
+}
@@ -0,0 +1,95 @@
+package health
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+)
+
+func TestObservedSiteStatus(t *testing.T) {
+	tests := []struct {
+		siteStatus string
+		hc         models.HealthCheck
+		want       string
+	}{
+		{"error", models.HealthCheck{ContainerStatus: "running"}, "running"},
+		{"running", models.HealthCheck{ContainerStatus: "exited", StoppedCleanly: true}, "stopped"},
+		{"running", models.HealthCheck{ContainerStatus: "exited"}, "error"},
+		{"stopped", models.HealthCheck{ContainerStatus: "exited"}, "stopped"},
+		{"running", models.HealthCheck{ContainerStatus: "not_found"}, "error"},
+		{"running", models.HealthCheck{ContainerStatus: "restarting"}, "error"},
+		{"running", models.HealthCheck{ContainerStatus: "ssh_error"}, ""},
+		{"running", models.HealthCheck{ContainerStatus: "sudo_error"}, ""},
+		{"running", models.HealthCheck{}, ""},
+	}
+	for _, tt := range tests {
+		got := observedSiteStatus(models.Site{Status: tt.siteStatus}, &tt.hc)
+		if got != tt.want {
+			t.Errorf("observedSiteStatus(%s, %+v) = %q, want %q", tt.siteStatus, tt.hc, got, tt.want)
+		}
+	}
+}
+
+func TestListedExitCode(t *testing.T) {
+	tests := map[string]int{
+		"Exited (0) 3 minutes ago":    0,
+		"Exited (137) 2 hours ago":    137,
+		"Up 5 minutes":                -1,
+		"Exited (x) 2 hours ago":      -1,
+		"Restarting (1) 1 second ago": -1,
+	}
+	for in, want := range tests {
+		if got := listedExitCode(in); got != want {
+			t.Errorf("listedExitCode(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestReconcileStatus(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &models.Site{Domain: "shop.example.com", TemplateSlug: "static-site", Status: "running"}
+	if err := models.CreateSite(database, site); err != nil {
+		t.Fatal(err)
+	}
+	status := func() string {
+		t.Helper()
+		s, err := models.GetSiteByID(database, site.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.Status
+	}
+	ch := NewChecker(database, 0, nil, 3, 30, 90, 0)
+	crashed := &models.HealthCheck{ContainerStatus: "exited"}
+
+	// One bad check is not enough, and a good one in between starts over.
+	ch.reconcileStatus(*site, crashed)
+	ch.reconcileStatus(*site, &models.HealthCheck{ContainerStatus: "running"})
+	ch.reconcileStatus(*site, crashed)
+	if got := status(); got != "running" {
+		t.Fatalf("status after non-consecutive failures = %q, want running", got)
+	}
+	ch.reconcileStatus(*site, crashed)
+	if got := status(); got != "error" {
+		t.Fatalf("status after %d crashed checks = %q, want error", reconcileAfter, got)
+	}
+
+	// A status changed since the round started is left alone.
+	if err := models.UpdateSiteStatus(database, site.ID, "deploying"); err != nil {
+		t.Fatal(err)
+	}
+	site.Status = "error"
+	running := &models.HealthCheck{ContainerStatus: "running"}
+	ch.reconcileStatus(*site, running)
+	ch.reconcileStatus(*site, running)
+	if got := status(); got != "deploying" {
+		t.Errorf("status = %q, want deploying to be kept", got)
+	}
+}
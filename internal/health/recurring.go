@@ -0,0 +1,39 @@
+package health
+
+import (
+	"log"
+
+	"ezweb/internal/models"
+)
+
+// maxRecurringRounds bounds how many periods one run can catch up on, in case
+// a payment's due date is far in the past.
+const maxRecurringRounds = 24
+
+// spawnRecurringPayments generates successors for recurring payments that
+// have been paid or have passed their due date. A generated payment that is
+// itself already overdue is picked up in the next round, so a long gap is
+// filled one period at a time.
+func (ch *Checker) spawnRecurringPayments() {
+	for round := 0; round < maxRecurringRounds; round++ {
+		ids, err := models.GetRecurringPaymentsToSpawn(ch.DB)
+		if err != nil {
+			log.Printf("Health checker: failed to list recurring payments: %v", err)
+			return
+		}
+		spawned := 0
+		for _, id := range ids {
+			next, err := models.SpawnRecurringPayment(ch.DB, id, "", "")
+			if err != nil {
+				log.Printf("Health checker: failed to generate next payment for #%d: %v", id, err)
+				continue
+			}
+			if next != nil {
+				spawned++
+			}
+		}
+		if spawned == 0 {
+			return
+		}
+	}
+}
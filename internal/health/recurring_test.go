@@ -0,0 +1,50 @@
+package health
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+)
+
+func TestSpawnRecurringPayments_CatchesUpOverduePeriods(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	cust := &models.Customer{Name: "Acme"}
+	if err := models.CreateCustomer(database, cust); err != nil {
+		t.Fatal(err)
+	}
+	// Due on the 1st three months back, so the following periods are
+	// overdue too until one falls due today or later.
+	now := time.Now()
+	first := time.Date(now.Year(), now.Month()-3, 1, 0, 0, 0, 0, time.UTC)
+	today := now.Format("2006-01-02")
+	want := 1
+	for due := first; due.Format("2006-01-02") < today; due = models.NextDueDate(due, models.PaymentRecurrenceMonthly, 1) {
+		want++
+	}
+	p := &models.Payment{CustomerID: cust.ID, Amount: 10, DueDate: first.Format("2006-01-02"), Recurrence: models.PaymentRecurrenceMonthly}
+	if err := models.CreatePayment(database, p); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := NewChecker(database, 0, nil, 3, 30, 90, 0)
+	ch.spawnRecurringPayments()
+	ch.spawnRecurringPayments()
+
+	// Running the job twice must not add more.
+	if n, _ := models.CountPayments(database); n != want {
+		t.Errorf("CountPayments = %d, want %d", n, want)
+	}
+	var recurred int
+	database.QueryRow("SELECT COUNT(*) FROM activity_log WHERE action = 'recurred'").Scan(&recurred)
+	if recurred != want-1 {
+		t.Errorf("recurred activity entries = %d, want %d", recurred, want-1)
+	}
+}
@@ -0,0 +1,145 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"ezweb/internal/models"
+	sshutil "ezweb/internal/ssh"
+)
+
+// serverTestTimeout bounds a single server's connection test in a bulk run,
+// so one host that accepts the TCP connection but never answers `docker info`
+// cannot hold up the batch.
+const serverTestTimeout = 30 * time.Second
+
+// ServerTestResult is the outcome of testing one server in TestAllServers.
+type ServerTestResult struct {
+	Server   models.Server
+	Previous string // status before the test
+	Status   string // "online" or "offline"
+	Version  string // Docker server version when online
+	Error    string
+}
+
+// Changed reports whether the test moved the server between online and
+// offline. A never-tested server ("unknown") counts as changed.
+func (r ServerTestResult) Changed() bool {
+	prev := r.Previous
+	if prev == "active" {
+		prev = "online"
+	}
+	return prev != r.Status
+}
+
+// PinHostKey fetches and stores the server's SSH host key on first contact,
+// so every later connection is verified against it. It does nothing when a
+// key is already pinned.
+func PinHostKey(db *sql.DB, server *models.Server) error {
+	return pinHostKey(context.Background(), db, server)
+}
+
+func pinHostKey(ctx context.Context, db *sql.DB, server *models.Server) error {
+	if server.SSHHostKey != "" {
+		return nil
+	}
+	hostKey, err := sshutil.GetHostKeyContext(ctx, server.Host, server.SSHPort)
+	if err != nil {
+		return err
+	}
+	if err := models.UpdateServerHostKey(db, server.ID, hostKey); err != nil {
+		log.Printf("failed to store host key for server %d: %v", server.ID, err)
+	}
+	server.SSHHostKey = hostKey
+	return nil
+}
+
+// ErrHostKeyChanged is returned by RepinHostKey when the server's key is no
+// longer the one the admin confirmed.
+var ErrHostKeyChanged = errors.New("host key changed since it was confirmed")
+
+// RepinHostKey replaces the server's pinned host key with the one it presents
+// now, after a rebuild. confirmed is the fingerprint the admin checked; the
+// key is only stored if it still matches, so a key that changed again in the
+// meantime is never pinned unseen. The old and new fingerprints are returned.
+func RepinHostKey(db *sql.DB, server *models.Server, confirmed string) (oldFP, newFP string, err error) {
+	hostKey, err := sshutil.GetHostKey(server.Host, server.SSHPort)
+	if err != nil {
+		return "", "", err
+	}
+	newFP = sshutil.Fingerprint(hostKey)
+	if newFP == "" || newFP != confirmed {
+		return "", newFP, ErrHostKeyChanged
+	}
+	if err := models.UpdateServerHostKey(db, server.ID, hostKey); err != nil {
+		return "", "", err
+	}
+	oldFP = sshutil.Fingerprint(server.SSHHostKey)
+	server.SSHHostKey = hostKey
+	return oldFP, newFP, nil
+}
+
+// testServer pins the host key if needed and checks SSH and Docker access,
+// giving up when ctx is done.
+func testServer(ctx context.Context, db *sql.DB, server *models.Server) (string, error) {
+	if err := pinHostKey(ctx, db, server); err != nil {
+		return "", fmt.Errorf("failed to retrieve host key: %w", err)
+	}
+	return sshutil.TestConnectionContext(ctx, server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.UseSudo)
+}
+
+// TestAllServers tests every server concurrently, at most
+// defaultMaxConcurrentChecks at a time, and records each server's new status.
+// Results are returned in the order of servers.
+func TestAllServers(db *sql.DB, servers []models.Server) []ServerTestResult {
+	return testServers(db, servers, testServer, serverTestTimeout)
+}
+
+// testServers runs test on each server with a context that times out after
+// timeout. test must return once its context is done; a server's slot is
+// only freed when it has, so no connection outlives the batch.
+func testServers(db *sql.DB, servers []models.Server, test func(context.Context, *sql.DB, *models.Server) (string, error), timeout time.Duration) []ServerTestResult {
+	results := make([]ServerTestResult, len(servers))
+	sem := make(chan struct{}, defaultMaxConcurrentChecks)
+	var wg sync.WaitGroup
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			server := servers[i]
+			res := ServerTestResult{Server: server, Previous: server.Status, Status: "offline"}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			version, err := test(ctx, db, &server)
+			switch {
+			case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+				res.Error = fmt.Sprintf("timed out after %s", timeout)
+			case err != nil:
+				res.Error = err.Error()
+			default:
+				res.Status = "online"
+				res.Version = version
+			}
+			cancel()
+
+			if res.Error != "" {
+				log.Printf("connection test failed for server %d (%s): %s", server.ID, server.Host, res.Error)
+			}
+			if err := models.UpdateServerStatus(db, server.ID, res.Status); err != nil {
+				log.Printf("failed to update status for server %d: %v", server.ID, err)
+			}
+			res.Server.Status = res.Status
+			results[i] = res
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
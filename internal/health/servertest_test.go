@@ -0,0 +1,78 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+)
+
+func TestTestServers_HungServerDoesNotBlockBatch(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	var servers []models.Server
+	for _, name := range []string{"up", "down", "hung"} {
+		s := &models.Server{Name: name, Host: name + ".example.com", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k", Status: "unknown"}
+		if err := models.CreateServer(database, s); err != nil {
+			t.Fatalf("CreateServer(%s): %v", name, err)
+		}
+		servers = append(servers, *s)
+	}
+
+	// The hung server's test runs until its context is done, as an SSH
+	// session to a host that never answers does.
+	var running atomic.Int32
+	test := func(ctx context.Context, _ *sql.DB, s *models.Server) (string, error) {
+		running.Add(1)
+		defer running.Add(-1)
+		switch s.Name {
+		case "up":
+			return "27.0.1", nil
+		case "down":
+			return "", errors.New("connection refused")
+		}
+		<-ctx.Done()
+		return "", ctx.Err()
+	}
+
+	start := time.Now()
+	results := testServers(database, servers, test, 50*time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("batch took %s; a hung server blocked it", elapsed)
+	}
+	if n := running.Load(); n != 0 {
+		t.Errorf("%d tests still running after the batch returned", n)
+	}
+
+	if r := results[2]; !strings.Contains(r.Error, "timed out") {
+		t.Errorf("hung: error = %q, want a timeout", r.Error)
+	}
+
+	want := map[string]string{"up": "online", "down": "offline", "hung": "offline"}
+	for _, r := range results {
+		if r.Status != want[r.Server.Name] {
+			t.Errorf("%s: status = %q, want %q", r.Server.Name, r.Status, want[r.Server.Name])
+		}
+		if !r.Changed() {
+			t.Errorf("%s: expected change from unknown", r.Server.Name)
+		}
+		stored, err := models.GetServerByID(database, r.Server.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Status != r.Status {
+			t.Errorf("%s: stored status = %q, want %q", r.Server.Name, stored.Status, r.Status)
+		}
+	}
+}
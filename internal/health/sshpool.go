@@ -0,0 +1,125 @@
+package health
+
+import (
+	"sync"
+
+	"ezweb/internal/models"
+	sshutil "ezweb/internal/ssh"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// maxSessionsPerServer caps the sessions a pool opens at once on one
+// server. sshd refuses sessions beyond MaxSessions (10 by default) on a
+// connection, and a refused session would read as an unknown container
+// rather than a failure, so the cap stays below it with room to spare.
+const maxSessionsPerServer = 8
+
+// sshPool shares one SSH client per server for the duration of a single
+// checkAll round, so sites on the same server do not each dial their own
+// connection. Sessions are multiplexed over the shared client, at most
+// maxSessionsPerServer at a time; checks beyond that wait for a free one.
+// close must be called when the round ends.
+type sshPool struct {
+	dial func(server *models.Server) (*ssh.Client, error)
+
+	mu    sync.Mutex
+	conns map[int]*pooledConn
+}
+
+// pooledConn is the per-server slot. Its own mutex serialises dialing so
+// concurrent checks for one server wait for a single dial instead of racing.
+type pooledConn struct {
+	mu       sync.Mutex
+	client   *ssh.Client
+	err      error         // dial error, cached for the rest of the round
+	sessions chan struct{} // one token per open session
+}
+
+func newSSHPool() *sshPool {
+	return &sshPool{
+		dial: func(s *models.Server) (*ssh.Client, error) {
+			return sshutil.NewClientWithHostKey(s.Host, s.SSHPort, s.SSHUser, s.SSHKeyPath, s.SSHHostKey)
+		},
+		conns: make(map[int]*pooledConn),
+	}
+}
+
+func (p *sshPool) slot(serverID int) *pooledConn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc, ok := p.conns[serverID]
+	if !ok {
+		pc = &pooledConn{sessions: make(chan struct{}, maxSessionsPerServer)}
+		p.conns[serverID] = pc
+	}
+	return pc
+}
+
+// get returns the shared client for server, dialing it on first use. A failed
+// dial is remembered so an unreachable server is not redialed by every one of
+// its sites in the same round.
+func (p *sshPool) get(server *models.Server) (*ssh.Client, error) {
+	pc := p.slot(server.ID)
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.client == nil && pc.err == nil {
+		pc.client, pc.err = p.dial(server)
+	}
+	return pc.client, pc.err
+}
+
+// run executes cmd on server over the pooled client, once a session is free.
+// If the command fails and the connection no longer answers a keepalive, the
+// client is replaced with a fresh dial and the command retried once.
+func (p *sshPool) run(server *models.Server, cmd string) (string, error) {
+	pc := p.slot(server.ID)
+	pc.sessions <- struct{}{}
+	defer func() { <-pc.sessions }()
+
+	client, err := p.get(server)
+	if err != nil {
+		return "", err
+	}
+	out, err := sshutil.RunCommand(client, cmd)
+	if err == nil || connAlive(client) {
+		return out, err
+	}
+
+	client, err = p.redial(server, client)
+	if err != nil {
+		return "", err
+	}
+	return sshutil.RunCommand(client, cmd)
+}
+
+// redial replaces dead with a new client. If another check already replaced
+// it, the newer client is returned without dialing again.
+func (p *sshPool) redial(server *models.Server, dead *ssh.Client) (*ssh.Client, error) {
+	pc := p.slot(server.ID)
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.client != dead && pc.client != nil {
+		return pc.client, nil
+	}
+	dead.Close()
+	pc.client, pc.err = p.dial(server)
+	return pc.client, pc.err
+}
+
+// close closes every client opened during the round.
+func (p *sshPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, pc := range p.conns {
+		if pc.client != nil {
+			pc.client.Close()
+		}
+		delete(p.conns, id)
+	}
+}
+
+func connAlive(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err == nil
+}
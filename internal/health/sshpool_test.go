@@ -0,0 +1,201 @@
+package health
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ezweb/internal/models"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testSSHServer answers every exec request with "ok" and exit status 0,
+// after delay. It records the most sessions it had open at once.
+type testSSHServer struct {
+	addr  string
+	delay time.Duration
+	mu    sync.Mutex
+	conns []net.Conn
+
+	open, maxOpen atomic.Int32
+}
+
+func startTestSSHServer(t *testing.T) *testSSHServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+
+	srv := &testSSHServer{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			srv.mu.Lock()
+			srv.conns = append(srv.conns, conn)
+			srv.mu.Unlock()
+			go srv.serve(conn, cfg)
+		}
+	}()
+	return srv
+}
+
+func (s *testSSHServer) serve(conn net.Conn, cfg *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			for req := range chReqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				req.Reply(true, nil)
+				n := s.open.Add(1)
+				for m := s.maxOpen.Load(); n > m && !s.maxOpen.CompareAndSwap(m, n); m = s.maxOpen.Load() {
+				}
+				time.Sleep(s.delay)
+				s.open.Add(-1)
+				ch.Write([]byte("ok\n"))
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+			}
+		}()
+	}
+}
+
+// dropAll closes every accepted connection from the server side.
+func (s *testSSHServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func newTestPool(addr string, dials *atomic.Int32) *sshPool {
+	p := newSSHPool()
+	p.dial = func(*models.Server) (*ssh.Client, error) {
+		dials.Add(1)
+		return ssh.Dial("tcp", addr, &ssh.ClientConfig{User: "test", HostKeyCallback: ssh.InsecureIgnoreHostKey()})
+	}
+	return p
+}
+
+func TestSSHPool_SharesConnectionPerServer(t *testing.T) {
+	srv := startTestSSHServer(t)
+	var dials atomic.Int32
+	pool := newTestPool(srv.addr, &dials)
+	defer pool.close()
+
+	server := &models.Server{ID: 1}
+	var wg sync.WaitGroup
+	for i := 0; i < defaultMaxConcurrentChecks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := pool.run(server, "docker inspect x"); err != nil || out != "ok" {
+				t.Errorf("run = %q, %v", out, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := dials.Load(); n != 1 {
+		t.Errorf("dialed %d times, want 1", n)
+	}
+}
+
+func TestSSHPool_CapsSessionsPerServer(t *testing.T) {
+	srv := startTestSSHServer(t)
+	srv.delay = 20 * time.Millisecond
+	var dials atomic.Int32
+	pool := newTestPool(srv.addr, &dials)
+	defer pool.close()
+
+	server := &models.Server{ID: 1}
+	var wg sync.WaitGroup
+	for i := 0; i < 3*maxSessionsPerServer; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if out, err := pool.run(server, "docker inspect x"); err != nil || out != "ok" {
+				t.Errorf("run = %q, %v", out, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := srv.maxOpen.Load(); n > maxSessionsPerServer {
+		t.Errorf("%d sessions open at once, want at most %d", n, maxSessionsPerServer)
+	}
+}
+
+func TestSSHPool_ReconnectsAfterDroppedConnection(t *testing.T) {
+	srv := startTestSSHServer(t)
+	var dials atomic.Int32
+	pool := newTestPool(srv.addr, &dials)
+	defer pool.close()
+
+	server := &models.Server{ID: 1}
+	if _, err := pool.run(server, "true"); err != nil {
+		t.Fatalf("first run: %v", err)
+	}
+	srv.dropAll()
+
+	out, err := pool.run(server, "true")
+	if err != nil || out != "ok" {
+		t.Fatalf("run after drop = %q, %v", out, err)
+	}
+	if n := dials.Load(); n != 2 {
+		t.Errorf("dialed %d times, want 2", n)
+	}
+}
+
+func TestSSHPool_CachesDialFailure(t *testing.T) {
+	var dials atomic.Int32
+	pool := newSSHPool()
+	pool.dial = func(*models.Server) (*ssh.Client, error) {
+		dials.Add(1)
+		return nil, errors.New("connection refused")
+	}
+
+	server := &models.Server{ID: 7}
+	for i := 0; i < 3; i++ {
+		if _, err := pool.get(server); err == nil {
+			t.Fatal("expected dial error")
+		}
+	}
+	if n := dials.Load(); n != 1 {
+		t.Errorf("dialed %d times, want 1", n)
+	}
+}
@@ -0,0 +1,61 @@
+package health
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"ezweb/internal/docker"
+	"ezweb/internal/models"
+)
+
+// PurgeSite permanently deletes a site: its remote containers are removed
+// (when it runs on a server), then the row and its activity history. Health
+// checks and env vars go with the row via ON DELETE CASCADE. A failed remote
+// cleanup is logged and does not stop the delete.
+func PurgeSite(db *sql.DB, site *models.Site) error {
+	if !site.IsLocal && site.ServerID.Valid {
+		server, err := models.GetServerByID(db, int(site.ServerID.Int64))
+		if err == nil {
+			if rmErr := docker.RemoveSiteRemote(
+				server.Host, server.SSHPort, server.SSHUser, server.SSHKeyPath, server.SSHHostKey, server.DeployPath, site.ContainerName, server.DockerRemote(),
+			); rmErr != nil {
+				log.Printf("remote cleanup failed for site %d: %v (continuing with DB delete)", site.ID, rmErr)
+			}
+		}
+	}
+
+	if err := models.DeleteSite(db, site.ID); err != nil {
+		return err
+	}
+
+	// Clean up orphaned activity_log entries (no FK cascade for activity_log).
+	if _, err := db.Exec("DELETE FROM activity_log WHERE entity_type = 'site' AND entity_id = ?", site.ID); err != nil {
+		log.Printf("failed to clean activity log for site %d: %v", site.ID, err)
+	}
+	return nil
+}
+
+// purgeTrash permanently deletes sites that have been in the trash for
+// longer than TrashRetentionDays.
+func (ch *Checker) purgeTrash(now time.Time) {
+	sites, err := models.GetTrashedSites(ch.DB)
+	if err != nil {
+		log.Printf("Health checker: failed to list trashed sites: %v", err)
+		return
+	}
+	cutoff := now.AddDate(0, 0, -ch.TrashRetentionDays)
+	for i := range sites {
+		site := &sites[i]
+		if !site.DeletedAt.Valid || site.DeletedAt.Time.After(cutoff) {
+			continue
+		}
+		if err := PurgeSite(ch.DB, site); err != nil {
+			log.Printf("Health checker: failed to purge trashed site %d: %v", site.ID, err)
+			continue
+		}
+		models.LogActivityWithContext(ch.DB, "site", site.ID, "deleted",
+			fmt.Sprintf("Purged site %s after %d day(s) in the trash", site.Domain, ch.TrashRetentionDays), "", "")
+	}
+}
@@ -2,16 +2,28 @@ package health
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
 )
 
+// SignatureHeader carries the signature of a webhook request when the sender
+// has a Secret.
+const SignatureHeader = "X-EzWeb-Signature"
+
 type WebhookSender struct {
 	URL    string
 	Format string
 	Client *http.Client
+	// Secret, when set, signs every request: SignatureHeader is "sha256="
+	// followed by the hex HMAC-SHA256, keyed with Secret, of the exact body
+	// bytes posted. Receivers should compute it over the raw body before
+	// parsing the JSON, and compare in constant time.
+	Secret string
 }
 
 func NewWebhookSender(url, format string) *WebhookSender {
@@ -22,6 +34,15 @@ func NewWebhookSender(url, format string) *WebhookSender {
 	}
 }
 
+// Name returns the channel label used in logs, e.g. "slack webhook".
+func (ws *WebhookSender) Name() string {
+	format := ws.Format
+	if format == "" {
+		format = "discord"
+	}
+	return format + " webhook"
+}
+
 func (ws *WebhookSender) SendAlert(domain string, failures int, lastError string) error {
 	if ws.URL == "" {
 		return nil
@@ -51,7 +72,49 @@ func (ws *WebhookSender) SendAlert(domain string, failures int, lastError string
 		return fmt.Errorf("failed to marshal webhook payload: %w", err)
 	}
 
-	resp, err := ws.Client.Post(ws.URL, "application/json", bytes.NewReader(payload))
+	resp, err := ws.post(payload)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// SendEscalation reports that domain is still down after downFor.
+func (ws *WebhookSender) SendEscalation(domain string, downFor time.Duration, failures int, lastError string) error {
+	if ws.URL == "" {
+		return nil
+	}
+
+	var payload []byte
+	var err error
+
+	switch ws.Format {
+	case "slack":
+		payload, err = json.Marshal(map[string]string{
+			"text": fmt.Sprintf("*%s* is STILL DOWN — down for %s, %d consecutive failures\nLast error: %s", domain, FormatDowntime(downFor), failures, lastError),
+		})
+	default:
+		payload, err = json.Marshal(map[string]interface{}{
+			"embeds": []map[string]interface{}{
+				{
+					"title":       fmt.Sprintf("Site Still Down: %s", domain),
+					"description": fmt.Sprintf("Down for %s, %d consecutive health check failures\n\nLast error: %s", FormatDowntime(downFor), failures, lastError),
+					"color":       16744192,
+					"timestamp":   time.Now().UTC().Format(time.RFC3339),
+				},
+			},
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	resp, err := ws.post(payload)
 	if err != nil {
 		return fmt.Errorf("webhook request failed: %w", err)
 	}
@@ -63,25 +126,32 @@ func (ws *WebhookSender) SendAlert(domain string, failures int, lastError string
 	return nil
 }
 
-func (ws *WebhookSender) SendRecovery(domain string) error {
+func (ws *WebhookSender) SendRecovery(domain string, downFor time.Duration) error {
 	if ws.URL == "" {
 		return nil
 	}
 
+	text := fmt.Sprintf("*%s* is back UP", domain)
+	description := "Site is responding normally again."
+	if downFor > 0 {
+		text += " after " + FormatDowntime(downFor) + " of downtime"
+		description += fmt.Sprintf("\n\nTotal downtime: %s", FormatDowntime(downFor))
+	}
+
 	var payload []byte
 	var err error
 
 	switch ws.Format {
 	case "slack":
 		payload, err = json.Marshal(map[string]string{
-			"text": fmt.Sprintf("*%s* is back UP", domain),
+			"text": text,
 		})
 	default:
 		payload, err = json.Marshal(map[string]interface{}{
 			"embeds": []map[string]interface{}{
 				{
 					"title":       fmt.Sprintf("Site Recovered: %s", domain),
-					"description": "Site is responding normally again.",
+					"description": description,
 					"color":       65280,
 					"timestamp":   time.Now().UTC().Format(time.RFC3339),
 				},
@@ -92,10 +162,30 @@ func (ws *WebhookSender) SendRecovery(domain string) error {
 		return err
 	}
 
-	resp, err := ws.Client.Post(ws.URL, "application/json", bytes.NewReader(payload))
+	resp, err := ws.post(payload)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 	return nil
 }
+
+// post sends payload as JSON, signed when the sender has a secret.
+func (ws *WebhookSender) post(payload []byte) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, ws.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if ws.Secret != "" {
+		req.Header.Set(SignatureHeader, signPayload(ws.Secret, payload))
+	}
+	return ws.Client.Do(req)
+}
+
+// signPayload returns the SignatureHeader value for body.
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
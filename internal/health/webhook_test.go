@@ -0,0 +1,53 @@
+package health
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSignPayload_KnownVector(t *testing.T) {
+	got := signPayload("It's a Secret to Everybody", []byte("Hello, World!"))
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got != want {
+		t.Errorf("signPayload = %q, want %q", got, want)
+	}
+}
+
+func TestWebhookSender_SignsBody(t *testing.T) {
+	type request struct {
+		body, signature string
+	}
+	var got []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got = append(got, request{string(body), r.Header.Get(SignatureHeader)})
+	}))
+	defer srv.Close()
+
+	ws := NewWebhookSender(srv.URL, "slack")
+	ws.Secret = "s3cret"
+	if err := ws.SendAlert("shop.example.com", 3, "HTTP: 502"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.SendRecovery("shop.example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+	ws.Secret = ""
+	if err := ws.SendRecovery("shop.example.com", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("received %d requests, want 3", len(got))
+	}
+	for _, r := range got[:2] {
+		if want := signPayload("s3cret", []byte(r.body)); r.signature != want {
+			t.Errorf("signature %q does not match body %s (want %q)", r.signature, r.body, want)
+		}
+	}
+	if got[2].signature != "" {
+		t.Errorf("unsigned sender sent signature %q", got[2].signature)
+	}
+}
@@ -0,0 +1,138 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]Level{
+		"":        LevelInfo,
+		"debug":   LevelDebug,
+		"INFO":    LevelInfo,
+		"warn":    LevelWarn,
+		"warning": LevelWarn,
+		"error":   LevelError,
+	}
+	for in, want := range cases {
+		got, err := ParseLevel(in)
+		if err != nil {
+			t.Errorf("ParseLevel(%q) returned error: %v", in, err)
+		}
+		if got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", in, got, want)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("ParseLevel(\"verbose\") should return an error")
+	}
+}
+
+func TestLeveledLogging_SuppressesBelowMinimum(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		minLevel.Store(int32(LevelInfo))
+	})
+
+	minLevel.Store(int32(LevelWarn))
+	Infof("routine message")
+	Warnf("something odd")
+
+	out := buf.String()
+	if strings.Contains(out, "routine message") {
+		t.Errorf("info message should be suppressed at warn level, got %q", out)
+	}
+	if !strings.Contains(out, "WARN something odd") {
+		t.Errorf("warn message should be written, got %q", out)
+	}
+}
+
+func TestSetup_JSONFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ezweb.log")
+	closer, err := Setup(Options{Level: "info", Output: "file", FilePath: path, MaxSizeMB: 1, Format: "json"})
+	if err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+	t.Cleanup(func() {
+		closer.Close()
+		if _, err := Setup(Options{}); err != nil {
+			t.Errorf("reset logging: %v", err)
+		}
+	})
+
+	Debugf("hidden")
+	Infof("started on %s", ":3000")
+	log.Printf("plain failure")
+	Log(LevelInfo, "request", "method", "GET", "status", 200)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %q", len(lines), data)
+	}
+	var entries []map[string]any
+	for _, line := range lines {
+		var e map[string]any
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("line is not JSON: %q", line)
+		}
+		entries = append(entries, e)
+	}
+	if entries[0]["level"] != "INFO" || entries[0]["msg"] != "started on :3000" {
+		t.Errorf("leveled entry = %v", entries[0])
+	}
+	if entries[1]["level"] != "ERROR" || entries[1]["msg"] != "plain failure" {
+		t.Errorf("log.Printf entry = %v", entries[1])
+	}
+	if entries[2]["method"] != "GET" || entries[2]["status"] != float64(200) {
+		t.Errorf("structured entry = %v", entries[2])
+	}
+}
+
+func TestSetup_RejectsUnknownFormat(t *testing.T) {
+	if _, err := Setup(Options{Format: "xml"}); err == nil {
+		t.Error("Setup should reject an unknown format")
+	}
+}
+
+func TestRotatingWriter_RotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ezweb.log")
+	w, err := NewRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatalf("NewRotatingWriter: %v", err)
+	}
+	defer w.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := w.Write([]byte(line)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	assertFile := func(name, want string) {
+		t.Helper()
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("read %s: %v", name, err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	assertFile(path, "dddddddd\n")
+	assertFile(path+".1", "cccccccc\n")
+	assertFile(path+".2", "bbbbbbbb\n")
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+}
@@ -0,0 +1,45 @@
+package logging
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestLogger logs one line per request with the method, path, status,
+// latency and, for authenticated requests, the user id the session
+// middleware stored in locals.
+func RequestLogger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+
+		// A returned error is turned into a response by the app's
+		// ErrorHandler after the middleware chain unwinds, so the status
+		// has to be derived from the error here.
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fe *fiber.Error
+			if errors.As(err, &fe) {
+				status = fe.Code
+			}
+		}
+
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"latency_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP(),
+		}
+		if uid, ok := c.Locals("user_id").(int); ok {
+			attrs = append(attrs, "user_id", uid)
+		}
+		Log(LevelInfo, "request", attrs...)
+
+		return err
+	}
+}
@@ -0,0 +1,102 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingWriter is an io.Writer that appends to a file and rotates it once
+// it exceeds maxBytes. Rotated files are named path.1 (newest) through
+// path.N (oldest); anything beyond maxBackups is discarded.
+type RotatingWriter struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingWriter opens (or creates) the log file at path. A maxBytes of
+// zero or less disables rotation.
+func NewRotatingWriter(path string, maxBytes int64, maxBackups int) (*RotatingWriter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %w", err)
+	}
+	if maxBackups < 0 {
+		maxBackups = 0
+	}
+	w := &RotatingWriter{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *RotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open log file %s: %w", w.path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to stat log file %s: %w", w.path, err)
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			// Keep logging to the current file rather than dropping the line.
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rotate shifts path.N-1 → path.N … path → path.1 and reopens a fresh file.
+// Caller must hold w.mu.
+func (w *RotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	if w.maxBackups == 0 {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return w.open()
+	}
+
+	_ = os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxBackups))
+	for i := w.maxBackups - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", w.path, i)
+		if _, err := os.Stat(src); err == nil {
+			_ = os.Rename(src, fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+	}
+	if err := os.Rename(w.path, w.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return w.open()
+}
+
+// Close closes the underlying file.
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
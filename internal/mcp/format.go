@@ -6,41 +6,54 @@ import (
 )
 
 type SiteDTO struct {
-	ID            int    `json:"id"`
-	Domain        string `json:"domain"`
-	ServerID      *int64 `json:"server_id,omitempty"`
-	ServerName    string `json:"server_name,omitempty"`
-	TemplateSlug  string `json:"template_slug,omitempty"`
-	CustomerID    *int64 `json:"customer_id,omitempty"`
-	CustomerName  string `json:"customer_name,omitempty"`
-	ContainerName string `json:"container_name,omitempty"`
-	Port          int    `json:"port"`
-	Status        string `json:"status"`
-	SSLEnabled    bool   `json:"ssl_enabled"`
-	IsLocal       bool   `json:"is_local"`
-	ComposePath   string `json:"compose_path,omitempty"`
-	CreatedAt     string `json:"created_at"`
-	UpdatedAt     string `json:"updated_at"`
+	ID             int     `json:"id"`
+	Domain         string  `json:"domain"`
+	ServerID       *int64  `json:"server_id,omitempty"`
+	ServerName     string  `json:"server_name,omitempty"`
+	TemplateSlug   string  `json:"template_slug,omitempty"`
+	CustomerID     *int64  `json:"customer_id,omitempty"`
+	CustomerName   string  `json:"customer_name,omitempty"`
+	ContainerName  string  `json:"container_name,omitempty"`
+	Port           int     `json:"port"`
+	Status         string  `json:"status"`
+	SSLEnabled     bool    `json:"ssl_enabled"`
+	IsLocal        bool    `json:"is_local"`
+	Maintenance    bool    `json:"maintenance"`
+	ComposePath    string  `json:"compose_path,omitempty"`
+	ContainerImage string  `json:"container_image"`
+	LastDeployedAt *string `json:"last_deployed_at"`
+	CreatedAt      string  `json:"created_at"`
+	UpdatedAt      string  `json:"updated_at"`
 }
 
 type ServerDTO struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	Host      string `json:"host"`
-	SSHPort   int    `json:"ssh_port"`
-	SSHUser   string `json:"ssh_user"`
-	Status    string `json:"status"`
-	CreatedAt string `json:"created_at"`
-	UpdatedAt string `json:"updated_at"`
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	Host      string   `json:"host"`
+	SSHPort   int      `json:"ssh_port"`
+	SSHUser   string   `json:"ssh_user"`
+	Tags      []string `json:"tags,omitempty"`
+	Status    string   `json:"status"`
+	CreatedAt string   `json:"created_at"`
+	UpdatedAt string   `json:"updated_at"`
 }
 
 type HealthCheckDTO struct {
-	ID              int    `json:"id"`
-	SiteID          int    `json:"site_id"`
-	HTTPStatus      int    `json:"http_status"`
-	LatencyMs       int    `json:"latency_ms"`
-	ContainerStatus string `json:"container_status"`
-	CheckedAt       string `json:"checked_at"`
+	ID                 int    `json:"id"`
+	SiteID             int    `json:"site_id"`
+	HTTPStatus         int    `json:"http_status"`
+	LatencyMs          int    `json:"latency_ms"`
+	ContainerStatus    string `json:"container_status"`
+	RestartCount       int    `json:"restart_count"`
+	ContainerStartedAt string `json:"container_started_at,omitempty"`
+	// Services is set for sites that declare compose services.
+	Services  []ServiceStateDTO `json:"services,omitempty"`
+	CheckedAt string            `json:"checked_at"`
+}
+
+type ServiceStateDTO struct {
+	Service string `json:"service"`
+	Status  string `json:"status"`
 }
 
 type ActivityDTO struct {
@@ -71,16 +84,22 @@ func SiteToDTO(s models.Site) SiteDTO {
 		Status:        s.Status,
 		SSLEnabled:    s.SSLEnabled,
 		IsLocal:       s.IsLocal,
+		Maintenance:   s.Maintenance,
 		ComposePath:   s.ComposePath,
 		CreatedAt:     formatTime(s.CreatedAt),
 		UpdatedAt:     formatTime(s.UpdatedAt),
 	}
+	dto.ContainerImage = s.ImageLabel()
 	if s.ServerID.Valid {
 		dto.ServerID = &s.ServerID.Int64
 	}
 	if s.CustomerID.Valid {
 		dto.CustomerID = &s.CustomerID.Int64
 	}
+	if s.LastDeployedAt.Valid {
+		t := formatTime(s.LastDeployedAt.Time)
+		dto.LastDeployedAt = &t
+	}
 	return dto
 }
 
@@ -91,6 +110,7 @@ func ServerToDTO(s models.Server) ServerDTO {
 		Host:      s.Host,
 		SSHPort:   s.SSHPort,
 		SSHUser:   s.SSHUser,
+		Tags:      s.TagList(),
 		Status:    s.Status,
 		CreatedAt: formatTime(s.CreatedAt),
 		UpdatedAt: formatTime(s.UpdatedAt),
@@ -99,13 +119,24 @@ func ServerToDTO(s models.Server) ServerDTO {
 
 func HealthCheckToDTO(h models.HealthCheck) HealthCheckDTO {
 	return HealthCheckDTO{
-		ID:              h.ID,
-		SiteID:          h.SiteID,
-		HTTPStatus:      h.HTTPStatus,
-		LatencyMs:       h.LatencyMs,
-		ContainerStatus: h.ContainerStatus,
-		CheckedAt:       h.CheckedAt,
+		ID:                 h.ID,
+		SiteID:             h.SiteID,
+		HTTPStatus:         h.HTTPStatus,
+		LatencyMs:          h.LatencyMs,
+		ContainerStatus:    h.ContainerStatus,
+		RestartCount:       h.RestartCount,
+		ContainerStartedAt: h.ContainerStartedAt,
+		Services:           serviceStatesToDTO(h.Services),
+		CheckedAt:          h.CheckedAt,
+	}
+}
+
+func serviceStatesToDTO(states []models.ServiceState) []ServiceStateDTO {
+	var out []ServiceStateDTO
+	for _, st := range states {
+		out = append(out, ServiceStateDTO{Service: st.Service, Status: st.Status})
 	}
+	return out
 }
 
 func ActivityToDTO(a models.Activity) ActivityDTO {
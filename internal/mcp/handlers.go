@@ -4,10 +4,15 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"strconv"
 	"strings"
+	"time"
 
+	"ezweb/internal/backup"
+	"ezweb/internal/caddy"
 	"ezweb/internal/docker"
 	"ezweb/internal/models"
 	sshutil "ezweb/internal/ssh"
@@ -16,7 +21,10 @@ import (
 )
 
 type handlers struct {
-	db *sql.DB
+	db     *sql.DB
+	dbPath string
+	backup *backup.Manager
+	caddy  *caddy.Manager
 }
 
 func (h *handlers) resolveSite(args map[string]any) (*models.Site, error) {
@@ -37,33 +45,51 @@ func (h *handlers) resolveSite(args map[string]any) (*models.Site, error) {
 	return nil, fmt.Errorf("provide either site_id or domain")
 }
 
+// listSitesDefaultLimit and listSitesMaxLimit bound a list_sites page so a
+// large fleet does not flood the assistant's context.
+const (
+	listSitesDefaultLimit = 50
+	listSitesMaxLimit     = 200
+)
+
 func (h *handlers) listSites(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := req.GetArguments()
 
-	sites, err := models.GetAllSites(h.db)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("failed to list sites: %v", err)), nil
-	}
-
-	// Apply filters
 	statusFilter, _ := args["status"].(string)
 	var serverIDFilter int
 	if sid, ok := args["server_id"]; ok {
 		serverIDFilter, _ = toInt(sid)
 	}
-
-	var filtered []SiteDTO
-	for _, s := range sites {
-		if statusFilter != "" && s.Status != statusFilter {
-			continue
+	limit := listSitesDefaultLimit
+	if l, ok := args["limit"]; ok {
+		if v, err := toInt(l); err == nil && v > 0 {
+			limit = min(v, listSitesMaxLimit)
 		}
-		if serverIDFilter > 0 && (!s.ServerID.Valid || int(s.ServerID.Int64) != serverIDFilter) {
-			continue
+	}
+	offset := 0
+	if o, ok := args["offset"]; ok {
+		if v, err := toInt(o); err == nil && v > 0 {
+			offset = v
 		}
-		filtered = append(filtered, SiteToDTO(s))
 	}
 
-	return jsonResult(filtered)
+	sites, total, err := models.ListSitesPage(h.db, statusFilter, serverIDFilter, limit, offset)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to list sites: %v", err)), nil
+	}
+
+	dtos := make([]SiteDTO, 0, len(sites))
+	for _, s := range sites {
+		dtos = append(dtos, SiteToDTO(s))
+	}
+
+	return jsonResult(map[string]any{
+		"sites":    dtos,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+		"has_more": offset+len(sites) < total,
+	})
 }
 
 func (h *handlers) getSiteLogs(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -92,14 +118,17 @@ func (h *handlers) getSiteLogs(_ context.Context, req mcp.CallToolRequest) (*mcp
 		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("server not found: %v", err)), nil
 		}
+		remotePath, err := docker.RemoteSiteDir(srv.DeployPath, site.ContainerName)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid remote site path: %v", err)), nil
+		}
 		client, err := sshutil.NewClientWithHostKey(srv.Host, srv.SSHPort, srv.SSHUser, srv.SSHKeyPath, srv.SSHHostKey)
 		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("SSH connection failed: %v", err)), nil
 		}
 		defer client.Close()
 
-		cmd := fmt.Sprintf("cd /opt/ezweb/%s && docker compose logs --tail %d --no-color", site.ContainerName, tail)
-		logs, err = sshutil.RunCommand(client, cmd)
+		logs, err = sshutil.RunCommand(client, docker.RemoteLogsCommand(srv.DockerRemote(), remotePath, site.ContainerName, tail))
 		if err != nil {
 			return mcp.NewToolResultError(fmt.Sprintf("failed to get remote logs: %v", err)), nil
 		}
@@ -147,9 +176,116 @@ func (h *handlers) getSiteHealth(_ context.Context, req mcp.CallToolRequest) (*m
 		"status":  site.Status,
 		"checks":  dtos,
 	}
+	// Checks are newest first. A recreate resets the count, so only a rise
+	// is reported.
+	if len(checks) > 1 {
+		if d := checks[0].RestartCount - checks[len(checks)-1].RestartCount; d > 0 {
+			result["restarts_in_window"] = d
+		}
+	}
 	return jsonResult(result)
 }
 
+func (h *handlers) healthSummary(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := req.GetArguments()
+	onlyProblems, _ := args["only_problems"].(bool)
+
+	sites, err := models.GetAllSites(h.db)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to query sites: %v", err)), nil
+	}
+	latest, err := models.GetLatestHealthChecks(h.db)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to query health checks: %v", err)), nil
+	}
+
+	type siteHealth struct {
+		SiteID          int    `json:"site_id"`
+		Domain          string `json:"domain"`
+		Status          string `json:"status"`
+		State           string `json:"state"`
+		HTTPStatus      int    `json:"http_status,omitempty"`
+		LatencyMs       int    `json:"latency_ms,omitempty"`
+		ContainerStatus string `json:"container_status,omitempty"`
+		CheckedAt       string `json:"checked_at,omitempty"`
+	}
+
+	// Sites that are not meant to be serving are "inactive" rather than down,
+	// as in the status page summary.
+	counts := map[string]int{"up": 0, "down": 0, "unchecked": 0, "inactive": 0}
+	entries := []siteHealth{}
+	for _, s := range sites {
+		e := siteHealth{SiteID: s.ID, Domain: s.Domain, Status: s.Status}
+		hc, checked := latest[s.ID]
+		if checked {
+			e.HTTPStatus = hc.HTTPStatus
+			e.LatencyMs = hc.LatencyMs
+			e.ContainerStatus = hc.ContainerStatus
+			e.CheckedAt = hc.CheckedAt
+		}
+		switch {
+		case s.Status == "pending" || s.Status == "deploying" || s.Status == "stopped":
+			e.State = "inactive"
+		case !checked:
+			e.State = "unchecked"
+		case hc.Up:
+			e.State = "up"
+		default:
+			e.State = "down"
+		}
+		counts[e.State]++
+		if onlyProblems && e.State != "down" {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	return jsonResult(map[string]any{
+		"counts": counts,
+		"sites":  entries,
+	})
+}
+
+func (h *handlers) getExpiringCerts(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := req.GetArguments()
+
+	days := models.CertExpiryWindowDays
+	if d, ok := args["days"]; ok {
+		if v, err := toInt(d); err == nil && v > 0 {
+			days = v
+		}
+	}
+
+	sites, err := models.GetSitesWithExpiringCerts(h.db, days)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to query certificates: %v", err)), nil
+	}
+
+	type expiringCert struct {
+		SiteID   int    `json:"site_id"`
+		Domain   string `json:"domain"`
+		Status   string `json:"status"`
+		Expiry   string `json:"expiry"`
+		DaysLeft int    `json:"days_left"`
+	}
+
+	certs := []expiringCert{}
+	for _, s := range sites {
+		certs = append(certs, expiringCert{
+			SiteID:   s.ID,
+			Domain:   s.Domain,
+			Status:   s.Status,
+			Expiry:   formatTime(s.SSLExpiry.Time),
+			DaysLeft: s.CertDaysLeft(),
+		})
+	}
+
+	return jsonResult(map[string]any{
+		"days":  days,
+		"certs": certs,
+	})
+}
+
 func (h *handlers) getSiteErrors(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := req.GetArguments()
 
@@ -240,26 +376,55 @@ func (h *handlers) getActivityLog(_ context.Context, req mcp.CallToolRequest) (*
 		}
 	}
 
-	activities, err := models.GetRecentActivities(h.db, limit)
+	entityType, _ := args["entity_type"].(string)
+
+	var entityID int
+	if v, ok := args["entity_id"]; ok {
+		id, err := toInt(v)
+		if err != nil || id <= 0 {
+			return mcp.NewToolResultError("entity_id must be a positive integer"), nil
+		}
+		entityID = id
+	}
+
+	var since time.Time
+	if v, _ := args["since"].(string); v != "" {
+		t, err := parseTimeArg(v)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid since: %v", err)), nil
+		}
+		since = t
+	}
+
+	activities, _, err := models.SearchActivities(h.db, models.ActivityQuery{
+		EntityType: entityType,
+		EntityID:   entityID,
+		Since:      since,
+	}, limit, 0)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to get activities: %v", err)), nil
 	}
 
-	entityFilter, _ := args["entity_type"].(string)
-
 	var dtos []ActivityDTO
 	for _, a := range activities {
-		if entityFilter != "" && a.EntityType != entityFilter {
-			continue
-		}
 		dtos = append(dtos, ActivityToDTO(a))
 	}
 
 	return jsonResult(dtos)
 }
 
-func (h *handlers) listServers(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	servers, err := models.GetAllServers(h.db)
+func (h *handlers) listServers(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := req.GetArguments()
+
+	var (
+		servers []models.Server
+		err     error
+	)
+	if tag, _ := args["tag"].(string); strings.TrimSpace(tag) != "" {
+		servers, err = models.GetServersByTag(h.db, tag)
+	} else {
+		servers, err = models.GetAllServers(h.db)
+	}
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("failed to list servers: %v", err)), nil
 	}
@@ -290,7 +455,7 @@ func (h *handlers) getServerStatus(_ context.Context, req mcp.CallToolRequest) (
 		return mcp.NewToolResultError(fmt.Sprintf("server not found: %v", err)), nil
 	}
 
-	dockerVersion, testErr := sshutil.TestConnection(srv.Host, srv.SSHPort, srv.SSHUser, srv.SSHKeyPath, srv.SSHHostKey)
+	dockerVersion, testErr := sshutil.TestConnection(srv.Host, srv.SSHPort, srv.SSHUser, srv.SSHKeyPath, srv.SSHHostKey, srv.UseSudo)
 
 	status := "online"
 	if testErr != nil {
@@ -314,40 +479,338 @@ func (h *handlers) getServerStatus(_ context.Context, req mcp.CallToolRequest) (
 	return jsonResult(result)
 }
 
-func (h *handlers) backupDatabase(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+// getServerStats reports CPU, memory, disk, uptime and load for a server.
+// Values the remote host could not provide are "N/A" and listed under
+// "unavailable", so a partial failure still returns what was collected.
+func (h *handlers) getServerStats(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	args := req.GetArguments()
 
-	backupPath := "./ezweb.db.bak"
-	if p, ok := args["path"].(string); ok && p != "" {
-		backupPath = p
+	sid, ok := args["server_id"]
+	if !ok {
+		return mcp.NewToolResultError("server_id is required"), nil
+	}
+
+	serverID, err := toInt(sid)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid server_id: %v", err)), nil
 	}
 
-	// Reject path traversal attempts.
-	if strings.Contains(backupPath, "..") {
-		return mcp.NewToolResultError("invalid backup path: path must not contain '..'"), nil
+	srv, err := models.GetServerByID(h.db, serverID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("server not found: %v", err)), nil
+	}
+	if srv.SSHHostKey == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("server %q has no pinned SSH host key yet; test its connection in the dashboard first", srv.Name)), nil
 	}
 
-	// Only allow .db and .bak extensions to prevent writing arbitrary files.
-	if !strings.HasSuffix(backupPath, ".db") && !strings.HasSuffix(backupPath, ".bak") {
-		return mcp.NewToolResultError("invalid backup path: path must end with .db or .bak"), nil
+	client, err := sshutil.NewClientWithHostKey(srv.Host, srv.SSHPort, srv.SSHUser, srv.SSHKeyPath, srv.SSHHostKey)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("SSH connection failed: %v", err)), nil
 	}
+	defer client.Close()
 
-	// Use SQLite's built-in online backup via VACUUM INTO, which produces a
-	// consistent copy without requiring the database to be offline.
-	_, err := h.db.Exec("VACUUM INTO ?", backupPath)
+	stats, err := docker.GetRemoteServerStats(client)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to get server stats: %v", err)), nil
+	}
+
+	fields := []struct {
+		key, value string
+	}{
+		{"cpu_usage", stats.CPUUsage},
+		{"memory_total", stats.MemoryTotal},
+		{"memory_used", stats.MemoryUsed},
+		{"memory_percent", stats.MemoryPercent},
+		{"disk_total", stats.DiskTotal},
+		{"disk_used", stats.DiskUsed},
+		{"disk_percent", stats.DiskPercent},
+		{"uptime", stats.Uptime},
+		{"load_average", stats.LoadAverage},
+	}
+	result := map[string]any{
+		"server_id": srv.ID,
+		"name":      srv.Name,
+		"host":      srv.Host,
+	}
+	var unavailable []string
+	for _, f := range fields {
+		result[f.key] = f.value
+		if f.value == "N/A" || f.value == "" {
+			unavailable = append(unavailable, f.key)
+		}
+	}
+	if len(unavailable) > 0 {
+		result["unavailable"] = unavailable
+	}
+
+	return jsonResult(result)
+}
+
+func (h *handlers) backupDatabase(_ context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if h.backup == nil {
+		return mcp.NewToolResultError("backups are not configured"), nil
+	}
+
+	bi, err := h.backup.BackupDatabase(h.dbPath)
 	if err != nil {
 		return mcp.NewToolResultError(fmt.Sprintf("backup failed: %v", err)), nil
 	}
+	removed := h.backup.CleanOldBackups()
 
 	result := map[string]any{
-		"status": "success",
-		"path":   backupPath,
+		"status":          "success",
+		"name":            bi.Name,
+		"path":            bi.Path,
+		"size_bytes":      bi.Size,
+		"size":            backup.FormatSize(bi.Size),
+		"expired_removed": removed,
 	}
 	return jsonResult(result)
 }
 
+// validateCaddyConfig generates the Caddyfile from every site and runs
+// "caddy validate" on a temporary copy, as the web Caddyfile preview does.
+// The live Caddyfile is not written and Caddy is not reloaded.
+func (h *handlers) validateCaddyConfig(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if h.caddy == nil {
+		return mcp.NewToolResultError("Caddy is not configured"), nil
+	}
+
+	sites, err := models.GetAllSites(h.db)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to load sites: %v", err)), nil
+	}
+	preview, err := h.caddy.Preview(sites)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to validate Caddyfile: %v", err)), nil
+	}
+
+	result := map[string]any{
+		"valid":  preview.Valid,
+		"sites":  len(sites),
+		"output": preview.ValidationOutput,
+	}
+	// Content is empty when generation itself failed; there is nothing to
+	// compare or show then.
+	if preview.Content != "" {
+		result["differs_from_live"] = preview.Changed()
+		if include, _ := req.GetArguments()["include_caddyfile"].(bool); include {
+			result["caddyfile"] = preview.Content
+		}
+	}
+	return jsonResult(result)
+}
+
+// createSite mirrors the web CreateSite handler: the same domain, compose
+// path, container name and port rules apply, and Caddy is reloaded afterwards.
+func (h *handlers) createSite(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := req.GetArguments()
+
+	domain, _ := args["domain"].(string)
+	domain = strings.TrimSpace(domain)
+	if domain == "" {
+		return mcp.NewToolResultError("domain is required"), nil
+	}
+	domain, err := models.NormalizeDomains(domain)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	templateSlug, _ := args["template_slug"].(string)
+	templateSlug = strings.TrimSpace(templateSlug)
+	composePath, _ := args["compose_path"].(string)
+	composePath = strings.TrimSpace(composePath)
+	isLocal, _ := args["is_local"].(bool)
+
+	if !models.ValidateComposePath(composePath) {
+		return mcp.NewToolResultError("compose_path must be an absolute path with no traversal"), nil
+	}
+	if templateSlug == "" && composePath == "" {
+		return mcp.NewToolResultError("provide either template_slug or compose_path"), nil
+	}
+	if templateSlug != "" {
+		if _, err := models.GetTemplateBySlug(h.db, templateSlug); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("unknown template %q", templateSlug)), nil
+		}
+	}
+
+	containerName := strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-")
+	if err := docker.ValidateContainerName(containerName); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid container name: %v", err)), nil
+	}
+	if taken, err := models.ContainerNameTaken(h.db, containerName, 0); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to validate container name: %v", err)), nil
+	} else if taken {
+		return mcp.NewToolResultError(fmt.Sprintf("container name %q is already used by another site", containerName)), nil
+	}
+
+	port, autoPort := 0, false
+	if p, ok := args["port"]; ok {
+		v, err := toInt(p)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid port: %v", err)), nil
+		}
+		port = v
+	}
+	if port == 0 {
+		v, err := models.NextAvailablePort(h.db, isLocal)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to assign port: %v", err)), nil
+		}
+		port, autoPort = v, true
+	}
+	if !models.ValidatePort(port) {
+		return mcp.NewToolResultError("port must be between 1024 and 65535"), nil
+	}
+
+	var serverID sql.NullInt64
+	if sid, ok := args["server_id"]; ok {
+		v, err := toInt(sid)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid server_id: %v", err)), nil
+		}
+		if _, err := models.GetServerByID(h.db, v); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("server %d not found", v)), nil
+		}
+		serverID = sql.NullInt64{Int64: int64(v), Valid: true}
+	}
+
+	var customerID sql.NullInt64
+	if cid, ok := args["customer_id"]; ok {
+		v, err := toInt(cid)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("invalid customer_id: %v", err)), nil
+		}
+		if _, err := models.GetCustomerByID(h.db, v); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("customer %d not found", v)), nil
+		}
+		customerID = sql.NullInt64{Int64: int64(v), Valid: true}
+	}
+
+	site := &models.Site{
+		Domain:        domain,
+		ServerID:      serverID,
+		TemplateSlug:  templateSlug,
+		CustomerID:    customerID,
+		ContainerName: containerName,
+		Port:          port,
+		AutoPort:      autoPort,
+		Status:        "pending",
+		IsLocal:       isLocal,
+		ComposePath:   composePath,
+	}
+	if err := caddy.CreateSite(h.db, site); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to create site: %v", err)), nil
+	}
+
+	if h.caddy != nil {
+		if err := h.caddy.AddSite(h.db, *site); err != nil {
+			log.Printf("caddy reload failed after creating site %s: %v", domain, err)
+		}
+	}
+
+	models.LogActivityWithContext(h.db, "site", site.ID, "created", "Created site "+site.Domain+" via MCP", "", "")
+
+	created, err := models.GetSiteByID(h.db, site.ID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("site created but failed to reload it: %v", err)), nil
+	}
+	return jsonResult(SiteToDTO(*created))
+}
+
+// importRemoteProject mirrors the web ImportRemoteProject handler: a compose
+// project already running on a server is added as a running site assigned to
+// that server, and Caddy is reloaded.
+func (h *handlers) importRemoteProject(_ context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := req.GetArguments()
+
+	sid, ok := args["server_id"]
+	if !ok {
+		return mcp.NewToolResultError("server_id is required"), nil
+	}
+	serverID, err := toInt(sid)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid server_id: %v", err)), nil
+	}
+
+	domain, _ := args["domain"].(string)
+	domain = strings.TrimSpace(domain)
+	composePath, _ := args["compose_path"].(string)
+	composePath = strings.TrimSpace(composePath)
+	if domain == "" || composePath == "" {
+		return mcp.NewToolResultError("domain and compose_path are required"), nil
+	}
+	domain, err = models.NormalizeDomains(domain)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if !models.ValidateComposePath(composePath) {
+		return mcp.NewToolResultError("compose_path must be an absolute path with no traversal"), nil
+	}
+
+	server, err := models.GetServerByID(h.db, serverID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("server %d not found", serverID)), nil
+	}
+
+	if existing, err := models.GetImportedSite(h.db, server.ID, composePath); err == nil {
+		return mcp.NewToolResultError(fmt.Sprintf("project %s is already imported as site %d (%s)", composePath, existing.ID, existing.Domain)), nil
+	} else if !errors.Is(err, sql.ErrNoRows) {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to check for an existing import: %v", err)), nil
+	}
+
+	// Another project may already use the name derived from the domain (for
+	// example the same app on a different server); take the next free suffix.
+	containerName := strings.ReplaceAll(models.PrimaryDomain(domain), ".", "-")
+	if err := docker.ValidateContainerName(containerName); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("invalid container name: %v", err)), nil
+	}
+	containerName, err = models.FreeContainerName(h.db, containerName)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to pick a container name: %v", err)), nil
+	}
+
+	site := &models.Site{
+		Domain:        domain,
+		ServerID:      sql.NullInt64{Int64: int64(server.ID), Valid: true},
+		ContainerName: containerName,
+		Status:        "running",
+		ComposePath:   composePath,
+	}
+	if err := caddy.CreateSite(h.db, site); err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to import project: %v", err)), nil
+	}
+
+	models.LogActivityWithContext(h.db, "site", site.ID, "created", "Imported remote project "+domain+" from server "+server.Name+" via MCP", "", "")
+
+	if h.caddy != nil {
+		if err := h.caddy.AddSite(h.db, *site); err != nil {
+			log.Printf("caddy reload failed after importing %s: %v", domain, err)
+		}
+	}
+
+	created, err := models.GetSiteByID(h.db, site.ID)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("site imported but failed to reload it: %v", err)), nil
+	}
+	return jsonResult(SiteToDTO(*created))
+}
+
 // helpers
 
+// parseTimeArg accepts either an RFC 3339 timestamp or a plain YYYY-MM-DD
+// date (interpreted as midnight UTC).
+func parseTimeArg(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected RFC 3339 timestamp or YYYY-MM-DD date, got %q", v)
+	}
+	return t, nil
+}
+
 func toInt(v any) (int, error) {
 	switch val := v.(type) {
 	case float64:
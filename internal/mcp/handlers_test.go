@@ -0,0 +1,75 @@
+package mcptools
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+	"ezweb/internal/models"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestCreateSite_DomainConflict(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("db.Open: %v", err)
+	}
+	defer database.Close()
+
+	owner := &models.Site{
+		Domain:        "shop.example.com",
+		ContainerName: "shop-example-com",
+		Port:          3100,
+		Status:        "running",
+		RoutingConfig: &models.RoutingConfig{
+			Rules:           []models.RoutingRule{{Upstream: "localhost:3100"}},
+			RedirectDomains: []string{"www.shop.example.com"},
+		},
+	}
+	if err := models.CreateSite(database, owner); err != nil {
+		t.Fatal(err)
+	}
+	server := &models.Server{Name: "edge", Host: "127.0.0.1", SSHPort: 22, SSHUser: "root", Status: "online"}
+	if err := models.CreateServer(database, server); err != nil {
+		t.Fatal(err)
+	}
+
+	h := &handlers{db: database}
+	call := func(tool func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error), args map[string]any) *mcp.CallToolResult {
+		t.Helper()
+		var req mcp.CallToolRequest
+		req.Params.Arguments = args
+		res, err := tool(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	text := func(res *mcp.CallToolResult) string {
+		if len(res.Content) == 0 {
+			return ""
+		}
+		tc, _ := res.Content[0].(mcp.TextContent)
+		return tc.Text
+	}
+
+	for name, res := range map[string]*mcp.CallToolResult{
+		"create_site":           call(h.createSite, map[string]any{"domain": "www.shop.example.com", "template_slug": "nodejs"}),
+		"import_remote_project": call(h.importRemoteProject, map[string]any{"server_id": float64(server.ID), "domain": "www.shop.example.com", "compose_path": "/srv/shop"}),
+	} {
+		if !res.IsError || !strings.Contains(text(res), "www.shop.example.com") {
+			t.Errorf("%s onto a redirect domain = %q (error %v), want a conflict", name, text(res), res.IsError)
+		}
+	}
+	if n, _ := models.CountSites(database); n != 1 {
+		t.Errorf("CountSites = %d after refused creates, want 1", n)
+	}
+
+	res := call(h.createSite, map[string]any{"domain": "blog.example.com", "template_slug": "nodejs"})
+	if res.IsError {
+		t.Fatalf("create_site on a free domain: %s", text(res))
+	}
+}
@@ -3,20 +3,30 @@ package mcptools
 import (
 	"database/sql"
 
+	"ezweb/internal/backup"
+	"ezweb/internal/caddy"
+
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func RegisterTools(s *server.MCPServer, db *sql.DB) {
-	h := &handlers{db: db}
+// RegisterTools adds the EzWeb tools to s. dbPath and bm are used by
+// backup_database; bm may be nil, in which case that tool reports an error.
+// cm reloads Caddy after create_site and import_remote_project, and generates
+// the Caddyfile validate_caddy_config checks; when nil the reload is skipped
+// and that tool reports an error.
+func RegisterTools(s *server.MCPServer, db *sql.DB, dbPath string, bm *backup.Manager, cm *caddy.Manager) {
+	h := &handlers{db: db, dbPath: dbPath, backup: bm, caddy: cm}
 
 	s.AddTool(
 		mcp.NewTool("list_sites",
-			mcp.WithDescription("List all managed sites with their status, domain, server, and template info. Optionally filter by status or server."),
+			mcp.WithDescription("List managed sites with their status, domain, server, and template info, newest first. Optionally filter by status or server. Results are paged: the response has total and has_more; pass offset to fetch the next page."),
 			mcp.WithReadOnlyHintAnnotation(true),
 			mcp.WithDestructiveHintAnnotation(false),
 			mcp.WithString("status", mcp.Description("Filter by site status (running, stopped, error, pending, deploying)")),
 			mcp.WithNumber("server_id", mcp.Description("Filter by server ID")),
+			mcp.WithNumber("limit", mcp.Description("Maximum number of sites to return (default 50, max 200)")),
+			mcp.WithNumber("offset", mcp.Description("Number of matching sites to skip (default 0)")),
 		),
 		h.listSites,
 	)
@@ -45,6 +55,16 @@ func RegisterTools(s *server.MCPServer, db *sql.DB) {
 		h.getSiteHealth,
 	)
 
+	s.AddTool(
+		mcp.NewTool("health_summary",
+			mcp.WithDescription("Get the latest health check of every site in one call: domain, HTTP status, latency, container status, and a state of \"up\", \"down\", \"unchecked\" (no check yet), or \"inactive\" (pending, deploying, or stopped). Includes a count per state."),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithBoolean("only_problems", mcp.Description("Only return sites that are down")),
+		),
+		h.healthSummary,
+	)
+
 	s.AddTool(
 		mcp.NewTool("get_site_errors",
 			mcp.WithDescription("Find sites with problems: error/stopped status or recent failed health checks."),
@@ -55,22 +75,45 @@ func RegisterTools(s *server.MCPServer, db *sql.DB) {
 		h.getSiteErrors,
 	)
 
+	s.AddTool(
+		mcp.NewTool("get_expiring_certs",
+			mcp.WithDescription("List SSL sites whose TLS certificate expires within the given number of days (already expired ones included), soonest first. Sites whose certificate has never been checked are left out."),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithNumber("days", mcp.Description("Look ahead period in days (default 30)")),
+		),
+		h.getExpiringCerts,
+	)
+
+	s.AddTool(
+		mcp.NewTool("validate_caddy_config",
+			mcp.WithDescription("Generate the Caddyfile from the current sites and check it with `caddy validate` on a temporary file, without writing the live Caddyfile or reloading Caddy. Returns valid (true or false), the validation output, and differs_from_live, which is true when the live Caddyfile is not what EzWeb would write now. Use it to confirm a routing change compiles."),
+			mcp.WithReadOnlyHintAnnotation(true),
+			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithBoolean("include_caddyfile", mcp.Description("Also return the generated Caddyfile")),
+		),
+		h.validateCaddyConfig,
+	)
+
 	s.AddTool(
 		mcp.NewTool("get_activity_log",
-			mcp.WithDescription("Get recent activity feed showing site deployments, status changes, and other events."),
+			mcp.WithDescription("Get recent activity feed showing site deployments, status changes, and other events. Combine entity_type and entity_id to see everything that happened to one record."),
 			mcp.WithReadOnlyHintAnnotation(true),
 			mcp.WithDestructiveHintAnnotation(false),
 			mcp.WithNumber("limit", mcp.Description("Number of activities to return (default 20)")),
 			mcp.WithString("entity_type", mcp.Description("Filter by entity type (site, server, customer, payment)")),
+			mcp.WithNumber("entity_id", mcp.Description("Filter by entity ID, e.g. a site ID (best combined with entity_type)")),
+			mcp.WithString("since", mcp.Description("Only return activity at or after this time (RFC 3339 timestamp or YYYY-MM-DD)")),
 		),
 		h.getActivityLog,
 	)
 
 	s.AddTool(
 		mcp.NewTool("list_servers",
-			mcp.WithDescription("List all configured servers with their connection details and status."),
+			mcp.WithDescription("List all configured servers with their connection details, tags, and status. Optionally filter by tag."),
 			mcp.WithReadOnlyHintAnnotation(true),
 			mcp.WithDestructiveHintAnnotation(false),
+			mcp.WithString("tag", mcp.Description("Only list servers carrying this tag (e.g. prod, staging)")),
 		),
 		h.listServers,
 	)
@@ -86,12 +129,49 @@ func RegisterTools(s *server.MCPServer, db *sql.DB) {
 	)
 
 	s.AddTool(
-		mcp.NewTool("backup_database",
-			mcp.WithDescription("Create a backup of the EzWeb SQLite database. Returns the path to the backup file."),
+		mcp.NewTool("get_server_stats",
+			mcp.WithDescription("Get CPU, memory, disk (root filesystem), uptime, and load average for a server over SSH. Fields the server could not report are \"N/A\" and listed in \"unavailable\". The server's connection must have been tested once so its host key is pinned."),
 			mcp.WithReadOnlyHintAnnotation(true),
 			mcp.WithDestructiveHintAnnotation(false),
-			mcp.WithString("path", mcp.Description("Backup file path (default: ./ezweb.db.bak)")),
+			mcp.WithNumber("server_id", mcp.Description("Server ID to inspect"), mcp.Required()),
+		),
+		h.getServerStats,
+	)
+
+	s.AddTool(
+		mcp.NewTool("backup_database",
+			mcp.WithDescription("Create a gzip-compressed backup of the EzWeb SQLite database in the configured backup directory (BACKUP_DIR), then remove backups past the retention period. Returns the backup filename and size."),
+			mcp.WithReadOnlyHintAnnotation(false),
+			mcp.WithDestructiveHintAnnotation(false),
 		),
 		h.backupDatabase,
 	)
+
+	s.AddTool(
+		mcp.NewTool("create_site",
+			mcp.WithDescription("Create a new site in pending state and reload Caddy. Provide template_slug for a template site or compose_path to import an existing compose project. A free port is assigned when port is omitted; the container name is derived from the domain. Returns the created site."),
+			mcp.WithReadOnlyHintAnnotation(false),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithString("domain", mcp.Description("Site domain name"), mcp.Required()),
+			mcp.WithString("template_slug", mcp.Description("Template to deploy (required unless compose_path is given)")),
+			mcp.WithString("compose_path", mcp.Description("Absolute path to an existing compose project to import")),
+			mcp.WithBoolean("is_local", mcp.Description("Run the site on the EzWeb host instead of a remote server")),
+			mcp.WithNumber("server_id", mcp.Description("Server to deploy to")),
+			mcp.WithNumber("port", mcp.Description("Host port (1024-65535); assigned automatically when omitted")),
+			mcp.WithNumber("customer_id", mcp.Description("Customer the site belongs to")),
+		),
+		h.createSite,
+	)
+
+	s.AddTool(
+		mcp.NewTool("import_remote_project",
+			mcp.WithDescription("Import a Docker Compose project already running on a remote server as a running site, then reload Caddy. Use list_servers to find the server ID. The container name is derived from the domain. Returns the created site."),
+			mcp.WithReadOnlyHintAnnotation(false),
+			mcp.WithDestructiveHintAnnotation(true),
+			mcp.WithNumber("server_id", mcp.Description("Server the project runs on"), mcp.Required()),
+			mcp.WithString("domain", mcp.Description("Domain to serve the project on"), mcp.Required()),
+			mcp.WithString("compose_path", mcp.Description("Absolute path of the compose project directory on the server"), mcp.Required()),
+		),
+		h.importRemoteProject,
+	)
 }
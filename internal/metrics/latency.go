@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Request latencies are kept in log-linear buckets: exact below 8µs, then
+// every power of two split into 8 sub-buckets, so a reported percentile is
+// within 12.5% of the true value. 36 doublings cover about 19 hours.
+const (
+	latencySubBuckets = 8
+	latencyBuckets    = latencySubBuckets + 36*latencySubBuckets
+)
+
+// latencySlots is the sliding window for percentiles, in minutes. Each slot
+// holds one minute of samples and is cleared when its minute comes round
+// again, so percentiles always describe the last latencySlots minutes (the
+// current one partially) no matter how often or by whom they are scraped.
+const latencySlots = 5
+
+type latencySlot struct {
+	minute atomic.Int64 // Unix minute the counts belong to
+	counts [latencyBuckets]atomic.Int64
+}
+
+// latencyWindow is a lock-free sliding-window histogram. Recording is one
+// atomic add, plus a clear of the slot on the first request of each minute.
+// Requests recorded by other goroutines while a slot is being cleared may be
+// dropped, which is acceptable for monitoring.
+type latencyWindow struct {
+	slots [latencySlots]latencySlot
+}
+
+func latencyBucket(d time.Duration) int {
+	us := uint64(d.Microseconds())
+	if d < 0 {
+		us = 0
+	}
+	if us < latencySubBuckets {
+		return int(us)
+	}
+	exp := bits.Len64(us) - 1 // >= 3
+	sub := (us >> (exp - 3)) & (latencySubBuckets - 1)
+	idx := latencySubBuckets + (exp-3)*latencySubBuckets + int(sub)
+	if idx >= latencyBuckets {
+		idx = latencyBuckets - 1
+	}
+	return idx
+}
+
+// latencyBucketUpper returns the exclusive upper edge of bucket idx in
+// microseconds, the value reported for samples that fall in it.
+func latencyBucketUpper(idx int) float64 {
+	if idx < latencySubBuckets {
+		return float64(idx + 1)
+	}
+	exp := (idx-latencySubBuckets)/latencySubBuckets + 3
+	sub := (idx - latencySubBuckets) % latencySubBuckets
+	return float64(uint64(latencySubBuckets+sub+1) << (exp - 3))
+}
+
+func (w *latencyWindow) record(d time.Duration, now time.Time) {
+	minute := now.Unix() / 60
+	s := &w.slots[minute%latencySlots]
+	if old := s.minute.Load(); old != minute && s.minute.CompareAndSwap(old, minute) {
+		for i := range s.counts {
+			s.counts[i].Store(0)
+		}
+	}
+	s.counts[latencyBucket(d)].Add(1)
+}
+
+// percentiles returns the latency in milliseconds at each quantile q (0-1)
+// over the window ending at now, or zeros if nothing was recorded.
+func (w *latencyWindow) percentiles(now time.Time, qs ...float64) []float64 {
+	minute := now.Unix() / 60
+	var counts [latencyBuckets]int64
+	var total int64
+	for i := range w.slots {
+		s := &w.slots[i]
+		if m := s.minute.Load(); m > minute-latencySlots && m <= minute {
+			for j := range s.counts {
+				n := s.counts[j].Load()
+				counts[j] += n
+				total += n
+			}
+		}
+	}
+
+	out := make([]float64, len(qs))
+	if total == 0 {
+		return out
+	}
+	for i, q := range qs {
+		rank := int64(math.Ceil(q * float64(total)))
+		if rank < 1 {
+			rank = 1
+		}
+		var seen int64
+		for j, n := range counts {
+			seen += n
+			if seen >= rank {
+				out[i] = latencyBucketUpper(j) / 1000
+				break
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBucketBounds(t *testing.T) {
+	for _, d := range []time.Duration{0, 5 * time.Microsecond, 9 * time.Microsecond, 1500 * time.Microsecond, 250 * time.Millisecond, 3 * time.Second} {
+		upper := latencyBucketUpper(latencyBucket(d))
+		us := float64(d.Microseconds())
+		if upper <= us || upper > us*1.125+1 {
+			t.Errorf("%s: bucket upper edge %.0fµs, want just above %.0fµs", d, upper, us)
+		}
+	}
+}
+
+func TestLatencyWindowPercentiles(t *testing.T) {
+	var w latencyWindow
+	now := time.Date(2024, 1, 1, 12, 0, 30, 0, time.UTC)
+	for i := 1; i <= 100; i++ {
+		w.record(time.Duration(i)*time.Millisecond, now)
+	}
+
+	p := w.percentiles(now, 0.50, 0.95, 0.99)
+	for i, want := range []float64{50, 95, 99} {
+		if p[i] < want || p[i] > want*1.125 {
+			t.Errorf("quantile %d = %.2fms, want about %.0fms", i, p[i], want)
+		}
+	}
+
+	// Samples age out of the window.
+	later := now.Add(latencySlots * time.Minute)
+	if p := w.percentiles(later, 0.99); p[0] != 0 {
+		t.Errorf("p99 after the window passed = %.2fms, want 0", p[0])
+	}
+	// A new minute reuses and clears the old slot.
+	w.record(2*time.Millisecond, later)
+	if p := w.percentiles(later, 0.99); p[0] > 2.25 {
+		t.Errorf("p99 after slot reuse = %.2fms, want about 2ms", p[0])
+	}
+}
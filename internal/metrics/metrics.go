@@ -13,6 +13,7 @@ type Collector struct {
 	ErrorCount      atomic.Int64
 	RequestDuration atomic.Int64 // nanoseconds total
 	ActiveRequests  atomic.Int64
+	latency         latencyWindow // per-request durations for percentiles
 	startTime       time.Time
 }
 
@@ -25,10 +26,12 @@ func Middleware() fiber.Handler {
 
 		err := c.Next()
 
-		duration := time.Since(start)
+		end := time.Now()
+		duration := end.Sub(start)
 		Default.ActiveRequests.Add(-1)
 		Default.RequestCount.Add(1)
 		Default.RequestDuration.Add(duration.Nanoseconds())
+		Default.latency.record(duration, end)
 
 		if c.Response().StatusCode() >= 500 {
 			Default.ErrorCount.Add(1)
@@ -50,6 +53,9 @@ func Handler() fiber.Handler {
 		if totalRequests > 0 {
 			avgDuration = float64(totalDuration) / float64(totalRequests) / 1e6 // milliseconds
 		}
+		// Percentiles cover a sliding window of the last few minutes rather
+		// than all time, and scraping does not reset them.
+		p := Default.latency.percentiles(time.Now(), 0.50, 0.95, 0.99)
 
 		c.Set("Content-Type", "text/plain; version=0.0.4")
 
@@ -74,6 +80,14 @@ ezweb_http_active_requests %d
 ezweb_http_request_duration_avg_ms %.2f
 `, uptime, totalRequests, totalErrors, activeReqs, avgDuration)
 
+		for i, name := range []string{"p50", "p95", "p99"} {
+			body += fmt.Sprintf(`
+# HELP ezweb_http_request_duration_%[1]s_ms %[1]s request duration in milliseconds over the last %[2]d minutes
+# TYPE ezweb_http_request_duration_%[1]s_ms gauge
+ezweb_http_request_duration_%[1]s_ms %.3[3]f
+`, name, latencySlots, p[i])
+		}
+
 		return c.SendString(body)
 	}
 }
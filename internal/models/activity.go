@@ -4,6 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
+	"time"
+
+	"ezweb/internal/logging"
 )
 
 type Activity struct {
@@ -37,9 +41,12 @@ func LogActivityAt(db *sql.DB, entityType string, entityID int, action string, d
 	}
 }
 
+// GetRecentActivities returns the newest activity entries for the dashboard
+// feed. Per-request audit entries are left out; they duplicate the
+// entity-specific entries and are only shown on the activity log page.
 func GetRecentActivities(db *sql.DB, limit int) ([]Activity, error) {
 	rows, err := db.Query(
-		"SELECT id, entity_type, COALESCE(entity_id,0), action, COALESCE(details,''), COALESCE(ip_address,''), COALESCE(user_agent,''), created_at FROM activity_log ORDER BY created_at DESC LIMIT ?",
+		"SELECT id, entity_type, COALESCE(entity_id,0), action, COALESCE(details,''), COALESCE(ip_address,''), COALESCE(user_agent,''), created_at FROM activity_log WHERE entity_type != 'request' ORDER BY created_at DESC LIMIT ?",
 		limit,
 	)
 	if err != nil {
@@ -58,6 +65,98 @@ func GetRecentActivities(db *sql.DB, limit int) ([]Activity, error) {
 	return activities, rows.Err()
 }
 
+// ActivityQuery filters the activity log. A zero value for any field means
+// "no filter" for that field.
+type ActivityQuery struct {
+	EntityType string
+	EntityID   int
+	Since      time.Time
+	Until      time.Time
+	// Search is a case-insensitive substring match on the details column.
+	Search string
+}
+
+// where builds the WHERE clause and arguments for q. Filtering happens in SQL
+// so the (entity_type, entity_id, created_at) index can serve per-entity
+// lookups such as "everything that happened to site 42".
+func (q ActivityQuery) where() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if q.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, q.EntityType)
+	}
+	if q.EntityID > 0 {
+		conditions = append(conditions, "entity_id = ?")
+		args = append(args, q.EntityID)
+	}
+	// created_at is stored as "YYYY-MM-DD HH:MM:SS" in UTC, so compare against
+	// the same representation to keep the comparison index-friendly.
+	if !q.Since.IsZero() {
+		conditions = append(conditions, "created_at >= datetime(?, 'unixepoch')")
+		args = append(args, q.Since.Unix())
+	}
+	if !q.Until.IsZero() {
+		conditions = append(conditions, "created_at < datetime(?, 'unixepoch')")
+		args = append(args, q.Until.Unix())
+	}
+	if q.Search != "" {
+		conditions = append(conditions, "details LIKE ? ESCAPE '\\'")
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q.Search)
+		args = append(args, "%"+escaped+"%")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// CountActivities returns the number of activity entries matching q.
+func CountActivities(db *sql.DB, q ActivityQuery) (int, error) {
+	whereClause, args := q.where()
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM activity_log"+whereClause, args...).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to count activities: %w", err)
+	}
+	return total, nil
+}
+
+// SearchActivities returns a page of activity entries matching q, newest
+// first, along with the total number of matching rows for pagination.
+func SearchActivities(db *sql.DB, q ActivityQuery, limit, offset int) ([]Activity, int, error) {
+	total, err := CountActivities(db, q)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	whereClause, args := q.where()
+	listArgs := append(args, limit, offset)
+	rows, err := db.Query(
+		"SELECT id, entity_type, COALESCE(entity_id,0), action, COALESCE(details,''), COALESCE(ip_address,''), COALESCE(user_agent,''), created_at FROM activity_log"+
+			whereClause+" ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?",
+		listArgs...,
+	)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query activities: %w", err)
+	}
+	defer rows.Close()
+
+	var activities []Activity
+	for rows.Next() {
+		var a Activity
+		if err := rows.Scan(&a.ID, &a.EntityType, &a.EntityID, &a.Action, &a.Details, &a.IPAddress, &a.UserAgent, &a.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		activities = append(activities, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("activity row iteration error: %w", err)
+	}
+	return activities, total, nil
+}
+
 // BackfillActivities seeds the activity_log with entries for existing entities
 // that have no activity recorded yet. Safe to call on every startup.
 func BackfillActivities(db *sql.DB) {
@@ -67,7 +166,7 @@ func BackfillActivities(db *sql.DB) {
 		return // already has data, skip backfill
 	}
 
-	log.Println("Backfilling activity log for existing entities...")
+	logging.Infof("Backfilling activity log for existing entities...")
 
 	// Backfill sites
 	rows, err := db.Query("SELECT id, domain, status, created_at FROM sites ORDER BY created_at ASC")
@@ -111,5 +210,5 @@ func BackfillActivities(db *sql.DB) {
 		cRows.Close()
 	}
 
-	log.Println("Activity log backfill complete")
+	logging.Infof("Activity log backfill complete")
 }
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestSearchActivities_DetailsSearchIsEscaped(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	LogActivityWithContext(database, "site", 1, "updated", "Set discount to 100% off", "", "")
+	LogActivityWithContext(database, "site", 2, "updated", "Set discount to 100 dollars off", "", "")
+	LogActivityWithContext(database, "server", 1, "created", "Added server 100%", "", "")
+
+	tests := []struct {
+		name string
+		q    ActivityQuery
+		want int
+	}{
+		{"literal percent", ActivityQuery{Search: "100%"}, 2},
+		{"case insensitive", ActivityQuery{Search: "DISCOUNT"}, 2},
+		{"underscore is literal", ActivityQuery{Search: "100_"}, 0},
+		{"combined with type", ActivityQuery{EntityType: "site", Search: "100%"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total, err := SearchActivities(database, tt.q, 10, 0)
+			if err != nil {
+				t.Fatalf("SearchActivities: %v", err)
+			}
+			if total != tt.want || len(got) != tt.want {
+				t.Errorf("got %d rows (total %d), want %d", len(got), total, tt.want)
+			}
+		})
+	}
+}
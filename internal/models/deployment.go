@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// DeployHistoryKeep is how many of a site's most recent deployments keep
+// their compose file, and so can be rolled back to.
+const DeployHistoryKeep = 10
+
+// Deployment outcomes.
+const (
+	DeploySucceeded = "succeeded"
+	DeployFailed    = "failed"
+)
+
+// Deployment records one deploy or rollback of a site.
+type Deployment struct {
+	ID           int
+	SiteID       int
+	Username     string
+	TemplateSlug string
+	// Compose is the compose file that was uploaded. It is empty for local
+	// sites and sites deployed from git, which deploy their own compose
+	// file, and for deployments older than the last DeployHistoryKeep.
+	Compose string
+	Status  string
+	Error   string
+	// RollbackOf is the deployment this one re-deployed, or 0.
+	RollbackOf int
+	CreatedAt  string
+}
+
+// CanRollBack reports whether the deployment can be deployed again.
+func (d *Deployment) CanRollBack() bool {
+	return d.Status == DeploySucceeded && d.Compose != ""
+}
+
+// RecordDeployment stores d and clears the compose file of the site's
+// deployments beyond the newest DeployHistoryKeep.
+func RecordDeployment(db *sql.DB, d *Deployment) error {
+	var rollbackOf sql.NullInt64
+	if d.RollbackOf > 0 {
+		rollbackOf = sql.NullInt64{Int64: int64(d.RollbackOf), Valid: true}
+	}
+	result, err := db.Exec(
+		`INSERT INTO deployments (site_id, username, template_slug, compose, status, error, rollback_of)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		d.SiteID, d.Username, d.TemplateSlug, d.Compose, d.Status, d.Error, rollbackOf,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record deployment: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	d.ID = int(id)
+
+	if _, err := db.Exec(
+		`UPDATE deployments SET compose = NULL
+		 WHERE site_id = ? AND compose IS NOT NULL AND id NOT IN (
+		     SELECT id FROM deployments WHERE site_id = ? ORDER BY id DESC LIMIT ?)`,
+		d.SiteID, d.SiteID, DeployHistoryKeep,
+	); err != nil {
+		return fmt.Errorf("failed to prune deployment history: %w", err)
+	}
+	return nil
+}
+
+const deploymentColumns = `id, site_id, COALESCE(username,''), COALESCE(template_slug,''), COALESCE(compose,''),
+	status, COALESCE(error,''), COALESCE(rollback_of,0), created_at`
+
+func scanDeployment(scanner interface{ Scan(dest ...interface{}) error }) (*Deployment, error) {
+	var d Deployment
+	if err := scanner.Scan(&d.ID, &d.SiteID, &d.Username, &d.TemplateSlug, &d.Compose,
+		&d.Status, &d.Error, &d.RollbackOf, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// GetDeploymentsBySiteID returns a site's deployments, newest first.
+func GetDeploymentsBySiteID(db *sql.DB, siteID int, limit int) ([]Deployment, error) {
+	rows, err := db.Query(
+		`SELECT `+deploymentColumns+` FROM deployments WHERE site_id = ? ORDER BY id DESC LIMIT ?`,
+		siteID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query deployments: %w", err)
+	}
+	defer rows.Close()
+
+	var deployments []Deployment
+	for rows.Next() {
+		d, err := scanDeployment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan deployment row: %w", err)
+		}
+		deployments = append(deployments, *d)
+	}
+	return deployments, rows.Err()
+}
+
+// GetDeployment returns deployment id of site siteID.
+func GetDeployment(db *sql.DB, siteID, id int) (*Deployment, error) {
+	d, err := scanDeployment(db.QueryRow(
+		`SELECT `+deploymentColumns+` FROM deployments WHERE id = ? AND site_id = ?`, id, siteID,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("deployment not found: %w", err)
+	}
+	return d, nil
+}
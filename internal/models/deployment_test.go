@@ -0,0 +1,67 @@
+package models
+
+import (
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestRecordDeploymentKeepsRecentComposeFiles(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &Site{Domain: "deploy.example.com", ContainerName: "deploy", Port: 8080, Status: "running"}
+	if err := CreateSite(database, site); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	total := DeployHistoryKeep + 2
+	for i := 1; i <= total; i++ {
+		d := &Deployment{
+			SiteID:       site.ID,
+			Username:     "admin",
+			TemplateSlug: "static",
+			Compose:      "version: " + strconv.Itoa(i),
+			Status:       DeploySucceeded,
+		}
+		if i == total {
+			d.Status, d.Error = DeployFailed, "compose up failed"
+		}
+		if err := RecordDeployment(database, d); err != nil {
+			t.Fatalf("RecordDeployment(%d): %v", i, err)
+		}
+	}
+
+	deployments, err := GetDeploymentsBySiteID(database, site.ID, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments) != total {
+		t.Fatalf("got %d deployments, want %d", len(deployments), total)
+	}
+	if deployments[0].Status != DeployFailed || deployments[0].CanRollBack() {
+		t.Errorf("newest deployment = %+v, want a failed one that cannot be rolled back to", deployments[0])
+	}
+	if !deployments[1].CanRollBack() {
+		t.Errorf("newest successful deployment cannot be rolled back to")
+	}
+	for i, d := range deployments {
+		kept := i < DeployHistoryKeep
+		if (d.Compose != "") != kept {
+			t.Errorf("deployment %d (position %d): compose kept = %v, want %v", d.ID, i, d.Compose != "", kept)
+		}
+	}
+
+	oldest := deployments[total-1]
+	if _, err := GetDeployment(database, site.ID, oldest.ID); err != nil {
+		t.Errorf("GetDeployment(oldest): %v", err)
+	}
+	if _, err := GetDeployment(database, site.ID+1, oldest.ID); err == nil {
+		t.Error("GetDeployment found a deployment under another site")
+	}
+}
@@ -4,19 +4,58 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+
+	"ezweb/internal/templates"
 )
 
+// envSecretColumn is the additional data bound to encrypted env var values.
+const envSecretColumn = "site_env_vars.value"
+
+// MaxEnvValueLen caps the size of one env var value in bytes. Values are
+// written into the .env file uploaded on every deploy, so anything larger
+// (a certificate bundle, say) belongs in a file on the server instead.
+const MaxEnvValueLen = 16 * 1024
+
+// ValidateEnvValue rejects values that are too long or that hold a line
+// break or NUL byte. RenderEnvFile would escape a line break, but a .env
+// value is one line, and a multi-line one is almost always a paste mistake.
+func ValidateEnvValue(value string) error {
+	if len(value) > MaxEnvValueLen {
+		return fmt.Errorf("value is %d bytes, the limit is %d", len(value), MaxEnvValueLen)
+	}
+	if strings.ContainsAny(value, "\n\r\x00") {
+		return fmt.Errorf("value must be a single line without NUL bytes")
+	}
+	return nil
+}
+
+// EnvVar is a site environment variable. For a secret, Value holds the
+// stored form, which is ciphertext when ENCRYPTION_KEY is set; use
+// PlainValue to read it.
 type EnvVar struct {
 	ID        int
 	SiteID    int
 	Key       string
 	Value     string
+	IsSecret  bool
 	CreatedAt string
 }
 
+// PlainValue returns the variable's value, decrypting it if it is a secret.
+func (v EnvVar) PlainValue() (string, error) {
+	if !v.IsSecret {
+		return v.Value, nil
+	}
+	plain, err := decryptField(envSecretColumn, v.Value)
+	if err != nil {
+		return "", fmt.Errorf("env var %s: %w", v.Key, err)
+	}
+	return plain, nil
+}
+
 func GetEnvVarsBySiteID(db *sql.DB, siteID int) ([]EnvVar, error) {
 	rows, err := db.Query(
-		"SELECT id, site_id, key, value, created_at FROM site_env_vars WHERE site_id = ? ORDER BY key ASC",
+		"SELECT id, site_id, key, value, COALESCE(is_secret, 0), created_at FROM site_env_vars WHERE site_id = ? ORDER BY key ASC",
 		siteID,
 	)
 	if err != nil {
@@ -27,7 +66,7 @@ func GetEnvVarsBySiteID(db *sql.DB, siteID int) ([]EnvVar, error) {
 	var vars []EnvVar
 	for rows.Next() {
 		var v EnvVar
-		if err := rows.Scan(&v.ID, &v.SiteID, &v.Key, &v.Value, &v.CreatedAt); err != nil {
+		if err := rows.Scan(&v.ID, &v.SiteID, &v.Key, &v.Value, &v.IsSecret, &v.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan env var: %w", err)
 		}
 		vars = append(vars, v)
@@ -35,10 +74,31 @@ func GetEnvVarsBySiteID(db *sql.DB, siteID int) ([]EnvVar, error) {
 	return vars, rows.Err()
 }
 
-func CreateEnvVar(db *sql.DB, siteID int, key, value string) error {
+// GetEnvVar returns one of a site's env vars.
+func GetEnvVar(db *sql.DB, id int, siteID int) (*EnvVar, error) {
+	v := &EnvVar{}
+	err := db.QueryRow(
+		"SELECT id, site_id, key, value, COALESCE(is_secret, 0), created_at FROM site_env_vars WHERE id = ? AND site_id = ?",
+		id, siteID,
+	).Scan(&v.ID, &v.SiteID, &v.Key, &v.Value, &v.IsSecret, &v.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get env var: %w", err)
+	}
+	return v, nil
+}
+
+// CreateEnvVar sets a site env var, replacing any existing value for key.
+// Secret values are encrypted at rest when ENCRYPTION_KEY is set.
+func CreateEnvVar(db *sql.DB, siteID int, key, value string, secret bool) error {
+	if secret {
+		var err error
+		if value, err = encryptField(envSecretColumn, value); err != nil {
+			return err
+		}
+	}
 	_, err := db.Exec(
-		"INSERT INTO site_env_vars (site_id, key, value) VALUES (?, ?, ?) ON CONFLICT(site_id, key) DO UPDATE SET value = excluded.value",
-		siteID, key, value,
+		"INSERT INTO site_env_vars (site_id, key, value, is_secret) VALUES (?, ?, ?, ?) ON CONFLICT(site_id, key) DO UPDATE SET value = excluded.value, is_secret = excluded.is_secret",
+		siteID, key, value, secret,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create env var: %w", err)
@@ -72,11 +132,107 @@ func RenderEnvFile(db *sql.DB, siteID int) (string, error) {
 	}
 	var content string
 	for _, v := range vars {
-		val := v.Value
-		if strings.ContainsAny(val, " \t\n\r\"'\\=$#!`") {
-			val = "\"" + strings.ReplaceAll(strings.ReplaceAll(val, "\\", "\\\\"), "\"", "\\\"") + "\""
+		val, err := v.PlainValue()
+		if err != nil {
+			return "", err
+		}
+		content += envLine(v.Key, val)
+	}
+	return content, nil
+}
+
+// RenderDeployEnvFile is RenderEnvFile for deploying the site with
+// templateSlug. Variables the template declares but the site does not set
+// are added with their defaults. If a declared variable has neither, a
+// *templates.MissingVariablesError is returned and nothing should be
+// deployed.
+func RenderDeployEnvFile(db *sql.DB, siteID int, templateSlug string) (string, error) {
+	return renderDeployEnvFile(db, siteID, templateSlug, false)
+}
+
+// MaskedEnvValue stands in for secret values in RenderMaskedDeployEnvFile.
+const MaskedEnvValue = "********"
+
+// RenderMaskedDeployEnvFile is RenderDeployEnvFile with the value of every
+// secret env var replaced by MaskedEnvValue, for showing to a user.
+func RenderMaskedDeployEnvFile(db *sql.DB, siteID int, templateSlug string) (string, error) {
+	return renderDeployEnvFile(db, siteID, templateSlug, true)
+}
+
+func renderDeployEnvFile(db *sql.DB, siteID int, templateSlug string, mask bool) (string, error) {
+	vars, err := GetEnvVarsBySiteID(db, siteID)
+	if err != nil {
+		return "", err
+	}
+	set := make(map[string]string, len(vars))
+	for _, v := range vars {
+		if set[v.Key], err = v.PlainValue(); err != nil {
+			return "", err
+		}
+	}
+	resolved, err := templates.Resolve(templateSlug, set)
+	if err != nil {
+		return "", err
+	}
+
+	var content string
+	for _, v := range vars {
+		if _, declared := resolved[v.Key]; declared && set[v.Key] == "" {
+			continue // written below with its default
+		}
+		if mask && v.IsSecret {
+			content += v.Key + "=" + MaskedEnvValue + "\n"
+			continue
+		}
+		content += envLine(v.Key, set[v.Key])
+	}
+	for _, v := range templates.Variables(templateSlug) {
+		if set[v.Name] == "" {
+			content += envLine(v.Name, resolved[v.Name])
 		}
-		content += v.Key + "=" + val + "\n"
 	}
 	return content, nil
 }
+
+// ComposeExtraVars returns the variables a site's compose template can use
+// as {{ .Extra.NAME }}: the site's env vars, with the template's declared
+// defaults for any it leaves empty. Secret env vars are left out, since the
+// rendered compose file is shown in previews and kept in the deploy history;
+// they reach the containers through the .env file only.
+func ComposeExtraVars(db *sql.DB, siteID int, templateSlug string) (map[string]string, error) {
+	vars, err := GetEnvVarsBySiteID(db, siteID)
+	if err != nil {
+		return nil, err
+	}
+	extra := make(map[string]string, len(vars))
+	for _, v := range templates.Variables(templateSlug) {
+		if v.Default != "" {
+			extra[v.Name] = v.Default
+		}
+	}
+	for _, v := range vars {
+		if !v.IsSecret && v.Value != "" {
+			extra[v.Key] = v.Value
+		}
+	}
+	return extra, nil
+}
+
+// envEscaper escapes a value for a double-quoted .env entry. docker compose
+// unescapes \\, \" and \$ there, and turns \n and \r back into line breaks,
+// so the value comes through unchanged, is never interpolated, and cannot
+// end its line early.
+var envEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"\"", "\\\"",
+	"$", "\\$",
+	"\n", "\\n",
+	"\r", "\\r",
+)
+
+func envLine(key, val string) string {
+	if strings.ContainsAny(val, " \t\n\r\"'\\=$#!`") {
+		val = "\"" + envEscaper.Replace(val) + "\""
+	}
+	return key + "=" + val + "\n"
+}
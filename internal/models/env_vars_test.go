@@ -0,0 +1,207 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestRenderDeployEnvFile_AddsTemplateDefaults(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &Site{Domain: "app.example.com", TemplateSlug: "nodejs", ContainerName: "app", Port: 8080, Status: "pending"}
+	if err := CreateSite(database, site); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if err := CreateEnvVar(database, site.ID, "API_URL", "https://api.example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := RenderDeployEnvFile(database, site.ID, "nodejs")
+	if err != nil {
+		t.Fatalf("RenderDeployEnvFile: %v", err)
+	}
+	if want := "API_URL=https://api.example.com\nNODE_ENV=production\n"; got != want {
+		t.Errorf("env file = %q, want %q", got, want)
+	}
+
+	// A site value overrides the default, and an empty one falls back to it.
+	if err := CreateEnvVar(database, site.ID, "NODE_ENV", "staging", false); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = RenderDeployEnvFile(database, site.ID, "nodejs")
+	if want := "API_URL=https://api.example.com\nNODE_ENV=staging\n"; got != want {
+		t.Errorf("env file with override = %q, want %q", got, want)
+	}
+	if err := CreateEnvVar(database, site.ID, "NODE_ENV", "", false); err != nil {
+		t.Fatal(err)
+	}
+	got, _ = RenderDeployEnvFile(database, site.ID, "nodejs")
+	if want := "API_URL=https://api.example.com\nNODE_ENV=production\n"; got != want {
+		t.Errorf("env file with empty value = %q, want %q", got, want)
+	}
+}
+
+func TestCreateEnvVar_SecretEncryptedAtRest(t *testing.T) {
+	withEncryptionKey(t, "test-key")
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &Site{Domain: "app.example.com", TemplateSlug: "static", ContainerName: "app", Port: 8080, Status: "pending"}
+	if err := CreateSite(database, site); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if err := CreateEnvVar(database, site.ID, "API_KEY", "s3cret", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateEnvVar(database, site.ID, "MODE", "live", false); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	if err := database.QueryRow("SELECT value FROM site_env_vars WHERE key = 'API_KEY'").Scan(&stored); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		t.Errorf("secret stored as %q, want ciphertext", stored)
+	}
+
+	vars, err := GetEnvVarsBySiteID(database, site.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !vars[0].IsSecret || vars[0].Value == "s3cret" {
+		t.Errorf("listed secret = %+v, want it flagged and still encrypted", vars[0])
+	}
+	if plain, err := vars[0].PlainValue(); err != nil || plain != "s3cret" {
+		t.Errorf("PlainValue() = %q, %v", plain, err)
+	}
+
+	got, err := RenderEnvFile(database, site.ID)
+	if err != nil {
+		t.Fatalf("RenderEnvFile: %v", err)
+	}
+	if got != "API_KEY=s3cret\nMODE=live\n" {
+		t.Errorf("env file = %q", got)
+	}
+}
+
+func TestEnvLine_Escaping(t *testing.T) {
+	tests := []struct {
+		name, val, want string
+	}{
+		{"plain", "simple", "K=simple\n"},
+		{"empty", "", "K=\n"},
+		{"space", "two words", "K=\"two words\"\n"},
+		{"double quote", `foo"bar`, `K="foo\"bar"` + "\n"},
+		{"backslash", `a\nb`, `K="a\\nb"` + "\n"},
+		{"trailing backslash", `ends\`, `K="ends\\"` + "\n"},
+		{"dollar", "pa$$word${HOME}", `K="pa\$\$word\$` + "{HOME}\"\n"},
+		{"newline", "line1\nline2=x", `K="line1\nline2=x"` + "\n"},
+		{"carriage return", "a\rb", `K="a\rb"` + "\n"},
+		{"single quote", "it's", "K=\"it's\"\n"},
+		{"backtick", "`id`", "K=\"`id`\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := envLine("K", tt.val)
+			if got != tt.want {
+				t.Errorf("envLine(%q) = %q, want %q", tt.val, got, tt.want)
+			}
+			if strings.Count(got, "\n") != 1 {
+				t.Errorf("envLine(%q) spans more than one line: %q", tt.val, got)
+			}
+		})
+	}
+}
+
+func TestValidateEnvValue(t *testing.T) {
+	for _, ok := range []string{"", "value", `foo"bar`, `a\nb`, strings.Repeat("x", MaxEnvValueLen)} {
+		if err := ValidateEnvValue(ok); err != nil {
+			t.Errorf("ValidateEnvValue(%.20q) = %v, want nil", ok, err)
+		}
+	}
+	for _, bad := range []string{"a\nb", "a\rb", "nul\x00", strings.Repeat("x", MaxEnvValueLen+1)} {
+		if err := ValidateEnvValue(bad); err == nil {
+			t.Errorf("ValidateEnvValue(%.20q) = nil, want an error", bad)
+		}
+	}
+}
+
+func TestComposeExtraVars(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &Site{Domain: "app.example.com", TemplateSlug: "wordpress", ContainerName: "app", Port: 8080, Status: "pending"}
+	if err := CreateSite(database, site); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	for _, v := range []struct {
+		key, value string
+		secret     bool
+	}{
+		{"IMAGE_TAG", "6.7", false},
+		{"API_KEY", "hunter2", true},
+		{"EMPTY", "", false},
+	} {
+		if err := CreateEnvVar(database, site.ID, v.key, v.value, v.secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	extra, err := ComposeExtraVars(database, site.ID, "wordpress")
+	if err != nil {
+		t.Fatalf("ComposeExtraVars: %v", err)
+	}
+	want := map[string]string{"IMAGE_TAG": "6.7", "WORDPRESS_TABLE_PREFIX": "wp_"}
+	if len(extra) != len(want) {
+		t.Errorf("extra = %v, want %v", extra, want)
+	}
+	for k, v := range want {
+		if extra[k] != v {
+			t.Errorf("extra[%s] = %q, want %q", k, extra[k], v)
+		}
+	}
+}
+
+func TestRenderMaskedDeployEnvFile(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	site := &Site{Domain: "app.example.com", TemplateSlug: "nodejs", ContainerName: "app", Port: 8080, Status: "pending"}
+	if err := CreateSite(database, site); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	if err := CreateEnvVar(database, site.ID, "DB_PASSWORD", "hunter2", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateEnvVar(database, site.ID, "API_URL", "https://api.example.com", false); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := RenderMaskedDeployEnvFile(database, site.ID, "nodejs")
+	if err != nil {
+		t.Fatalf("RenderMaskedDeployEnvFile: %v", err)
+	}
+	if want := "API_URL=https://api.example.com\nDB_PASSWORD=" + MaskedEnvValue + "\nNODE_ENV=production\n"; got != want {
+		t.Errorf("masked env file = %q, want %q", got, want)
+	}
+	if plain, _ := RenderDeployEnvFile(database, site.ID, "nodejs"); !strings.Contains(plain, "DB_PASSWORD=hunter2\n") {
+		t.Errorf("deploy env file = %q, want the secret value", plain)
+	}
+}
@@ -3,6 +3,8 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type HealthCheck struct {
@@ -11,14 +13,88 @@ type HealthCheck struct {
 	HTTPStatus      int
 	LatencyMs       int
 	ContainerStatus string
-	CheckedAt       string
+	// RestartCount and ContainerStartedAt come from docker inspect. A count
+	// that climbs between checks means the container is flapping even when
+	// its status reads "running". StartedAt is RFC 3339, or empty if unknown.
+	RestartCount       int
+	ContainerStartedAt string
+	// StoppedCleanly is set when the container exited after being stopped
+	// (exit code 0, or 143 from docker stop's SIGTERM), or every service of
+	// a swarm stack is scaled to zero, rather than crashing. It is not
+	// stored.
+	StoppedCleanly bool
+	// Services holds the state of each compose service the site declares
+	// (see Site.ExpectedServices), in declared order. It is empty for sites
+	// that declare none.
+	Services []ServiceState
+	// Up is the health checker's verdict on the check. It is stored rather
+	// than derived from the other fields, which do not record everything
+	// the checker weighs (a skipped probe, a missing response body, a
+	// redirect the site should not answer with).
+	Up        bool
+	CheckedAt string
+}
+
+// ServiceState is the state of one compose service at a health check:
+// docker's container state (e.g. "running", "exited"), or "not_found" when
+// the service has no container.
+type ServiceState struct {
+	Service string
+	Status  string
+}
+
+// Down reports whether the service is known not to be running. The states
+// recorded when the checker could not list containers at all
+// ("docker_error", "ssh_error", "sudo_error", "unknown") say nothing about
+// the service and do not count, just as they do not for the site's own
+// container.
+func (s ServiceState) Down() bool {
+	switch s.Status {
+	case "running", "docker_error", "ssh_error", "sudo_error", "unknown":
+		return false
+	}
+	return true
+}
+
+// DownServices returns the services that are down.
+func (hc HealthCheck) DownServices() []ServiceState {
+	var down []ServiceState
+	for _, s := range hc.Services {
+		if s.Down() {
+			down = append(down, s)
+		}
+	}
+	return down
+}
+
+// encodeServiceStates stores states as "app=running,db=exited".
+func encodeServiceStates(states []ServiceState) string {
+	parts := make([]string, len(states))
+	for i, s := range states {
+		parts[i] = s.Service + "=" + s.Status
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseServiceStates(raw string) []ServiceState {
+	if raw == "" {
+		return nil
+	}
+	var states []ServiceState
+	for _, part := range strings.Split(raw, ",") {
+		name, status, _ := strings.Cut(part, "=")
+		states = append(states, ServiceState{Service: name, Status: status})
+	}
+	return states
 }
 
 func CreateHealthCheck(db *sql.DB, h *HealthCheck) error {
 	result, err := db.Exec(
-		`INSERT INTO health_checks (site_id, http_status, latency_ms, container_status)
-		 VALUES (?, ?, ?, ?)`,
-		h.SiteID, h.HTTPStatus, h.LatencyMs, h.ContainerStatus,
+		`INSERT INTO health_checks (site_id, http_status, latency_ms, container_status, restart_count, container_started_at,
+		 service_status, services_down, is_up)
+		 VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?)`,
+		h.SiteID, h.HTTPStatus, h.LatencyMs, h.ContainerStatus, h.RestartCount, h.ContainerStartedAt,
+		encodeServiceStates(h.Services), len(h.DownServices()), h.Up,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create health check: %w", err)
@@ -34,7 +110,8 @@ func CreateHealthCheck(db *sql.DB, h *HealthCheck) error {
 func GetHealthChecksBySiteID(db *sql.DB, siteID int, limit int) ([]HealthCheck, error) {
 	rows, err := db.Query(
 		`SELECT id, site_id, COALESCE(http_status,0), COALESCE(latency_ms,0),
-		        COALESCE(container_status,''), checked_at
+		        COALESCE(container_status,''), COALESCE(restart_count,0),
+		        COALESCE(container_started_at,''), COALESCE(service_status,''), COALESCE(is_up,0), checked_at
 		 FROM health_checks
 		 WHERE site_id = ?
 		 ORDER BY checked_at DESC
@@ -49,9 +126,11 @@ func GetHealthChecksBySiteID(db *sql.DB, siteID int, limit int) ([]HealthCheck,
 	var checks []HealthCheck
 	for rows.Next() {
 		var hc HealthCheck
-		if err := rows.Scan(&hc.ID, &hc.SiteID, &hc.HTTPStatus, &hc.LatencyMs, &hc.ContainerStatus, &hc.CheckedAt); err != nil {
+		var services string
+		if err := rows.Scan(&hc.ID, &hc.SiteID, &hc.HTTPStatus, &hc.LatencyMs, &hc.ContainerStatus, &hc.RestartCount, &hc.ContainerStartedAt, &services, &hc.Up, &hc.CheckedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan health check row: %w", err)
 		}
+		hc.Services = parseServiceStates(services)
 		checks = append(checks, hc)
 	}
 	return checks, rows.Err()
@@ -62,7 +141,8 @@ func GetHealthChecksBySiteID(db *sql.DB, siteID int, limit int) ([]HealthCheck,
 func GetLatestHealthChecks(db *sql.DB) (map[int]*HealthCheck, error) {
 	rows, err := db.Query(
 		`SELECT hc.id, hc.site_id, COALESCE(hc.http_status,0), COALESCE(hc.latency_ms,0),
-		        COALESCE(hc.container_status,''), hc.checked_at
+		        COALESCE(hc.container_status,''), COALESCE(hc.restart_count,0),
+		        COALESCE(hc.container_started_at,''), COALESCE(hc.service_status,''), COALESCE(hc.is_up,0), hc.checked_at
 		 FROM health_checks hc
 		 INNER JOIN (
 		     SELECT site_id, MAX(checked_at) AS max_checked
@@ -77,9 +157,11 @@ func GetLatestHealthChecks(db *sql.DB) (map[int]*HealthCheck, error) {
 	result := make(map[int]*HealthCheck)
 	for rows.Next() {
 		var hc HealthCheck
-		if err := rows.Scan(&hc.ID, &hc.SiteID, &hc.HTTPStatus, &hc.LatencyMs, &hc.ContainerStatus, &hc.CheckedAt); err != nil {
+		var services string
+		if err := rows.Scan(&hc.ID, &hc.SiteID, &hc.HTTPStatus, &hc.LatencyMs, &hc.ContainerStatus, &hc.RestartCount, &hc.ContainerStartedAt, &services, &hc.Up, &hc.CheckedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan health check row: %w", err)
 		}
+		hc.Services = parseServiceStates(services)
 		result[hc.SiteID] = &hc
 	}
 	return result, rows.Err()
@@ -87,17 +169,111 @@ func GetLatestHealthChecks(db *sql.DB) (map[int]*HealthCheck, error) {
 
 func GetLatestHealthCheck(db *sql.DB, siteID int) (*HealthCheck, error) {
 	hc := &HealthCheck{}
+	var services string
 	err := db.QueryRow(
 		`SELECT id, site_id, COALESCE(http_status,0), COALESCE(latency_ms,0),
-		        COALESCE(container_status,''), checked_at
+		        COALESCE(container_status,''), COALESCE(restart_count,0),
+		        COALESCE(container_started_at,''), COALESCE(service_status,''), COALESCE(is_up,0), checked_at
 		 FROM health_checks
 		 WHERE site_id = ?
 		 ORDER BY checked_at DESC
 		 LIMIT 1`,
 		siteID,
-	).Scan(&hc.ID, &hc.SiteID, &hc.HTTPStatus, &hc.LatencyMs, &hc.ContainerStatus, &hc.CheckedAt)
+	).Scan(&hc.ID, &hc.SiteID, &hc.HTTPStatus, &hc.LatencyMs, &hc.ContainerStatus, &hc.RestartCount, &hc.ContainerStartedAt, &services, &hc.Up, &hc.CheckedAt)
 	if err != nil {
 		return nil, fmt.Errorf("health check not found: %w", err)
 	}
+	hc.Services = parseServiceStates(services)
 	return hc, nil
 }
+
+// HealthBucket is one fixed-width time slot of aggregated health checks.
+// AvgLatencyMs and UpRatio are nil when no checks fell inside the bucket, so
+// chart consumers can render a gap instead of a misleading zero.
+type HealthBucket struct {
+	Start        time.Time
+	Checks       int
+	AvgLatencyMs *float64
+	UpRatio      *float64
+}
+
+// GetHealthTimeSeries groups a site's health checks in [since, until) into
+// buckets of bucketSeconds width using strftime, returning one entry per
+// bucket including empty ones for periods with no recorded checks.
+func GetHealthTimeSeries(db *sql.DB, siteID int, since, until time.Time, bucketSeconds int) ([]HealthBucket, error) {
+	if bucketSeconds <= 0 {
+		return nil, fmt.Errorf("bucket size must be positive")
+	}
+	bucket := int64(bucketSeconds)
+	start := since.Unix() / bucket * bucket
+	end := until.Unix()
+
+	rows, err := db.Query(
+		`SELECT (CAST(strftime('%s', checked_at) AS INTEGER) / ?) * ? AS bucket,
+		        COUNT(*), AVG(COALESCE(latency_ms,0)),
+		        AVG(CASE WHEN is_up = 1 THEN 1.0 ELSE 0.0 END)
+		 FROM health_checks
+		 WHERE site_id = ? AND checked_at >= datetime(?, 'unixepoch') AND checked_at < datetime(?, 'unixepoch')
+		 GROUP BY bucket
+		 ORDER BY bucket`,
+		bucket, bucket, siteID, start, end,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query health time series: %w", err)
+	}
+	defer rows.Close()
+
+	filled := make(map[int64]HealthBucket)
+	for rows.Next() {
+		var ts int64
+		var hb HealthBucket
+		var avgLatency, upRatio float64
+		if err := rows.Scan(&ts, &hb.Checks, &avgLatency, &upRatio); err != nil {
+			return nil, fmt.Errorf("failed to scan health bucket: %w", err)
+		}
+		hb.AvgLatencyMs = &avgLatency
+		hb.UpRatio = &upRatio
+		filled[ts] = hb
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("health bucket iteration error: %w", err)
+	}
+
+	var series []HealthBucket
+	for ts := start; ts < end; ts += bucket {
+		hb, ok := filled[ts]
+		if !ok {
+			hb = HealthBucket{}
+		}
+		hb.Start = time.Unix(ts, 0).UTC()
+		series = append(series, hb)
+	}
+	return series, nil
+}
+
+// HealthSummary counts sites by the outcome of their most recent health
+// check. Only sites that are expected to be serving traffic are included.
+type HealthSummary struct {
+	Checked int
+	Failing int
+}
+
+// GetHealthSummary aggregates the latest health check of every site that is
+// not pending, deploying, or intentionally stopped, in a single query. A
+// non-empty domainFilter counts only sites whose domain contains it.
+func GetHealthSummary(db *sql.DB, domainFilter string) (HealthSummary, error) {
+	var hs HealthSummary
+	err := db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_up = 1 THEN 0 ELSE 1 END),0)
+		 FROM health_checks
+		 INNER JOIN (SELECT MAX(id) AS id FROM health_checks GROUP BY site_id) latest ON health_checks.id = latest.id
+		 INNER JOIN sites s ON s.id = health_checks.site_id
+		 WHERE s.deleted_at IS NULL AND COALESCE(s.status,'pending') NOT IN ('pending','deploying','stopped')
+		 AND (? = '' OR instr(s.domain, ?) > 0)`,
+		domainFilter, domainFilter,
+	).Scan(&hs.Checked, &hs.Failing)
+	if err != nil {
+		return hs, fmt.Errorf("failed to summarise health checks: %w", err)
+	}
+	return hs, nil
+}
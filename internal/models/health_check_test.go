@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+)
+
+// The checker's verdict is stored as given, not re-derived from the other
+// fields, and the aggregate queries count it.
+func TestHealthCheckVerdict_Stored(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	cases := []HealthCheck{
+		{HTTPStatus: 200, ContainerStatus: "running", Up: true},
+		// A local site whose HTTP probe was skipped.
+		{HTTPStatus: 0, ContainerStatus: "running", Up: true},
+		// A 200 without the expected body text, and a redirect from a site
+		// that should not answer with one.
+		{HTTPStatus: 200, ContainerStatus: "running", Up: false},
+		{HTTPStatus: 301, ContainerStatus: "running", Up: false},
+		{HTTPStatus: 200, ContainerStatus: "running", Services: []ServiceState{{"app", "running"}, {"db", "exited"}}, Up: false},
+	}
+	for i, hc := range cases {
+		site := &Site{Domain: fmt.Sprintf("s%d.example.com", i), ContainerName: fmt.Sprintf("s%d", i), Port: 8080 + i, Status: "running"}
+		if err := CreateSite(database, site); err != nil {
+			t.Fatal(err)
+		}
+		hc.SiteID = site.ID
+		if err := CreateHealthCheck(database, &hc); err != nil {
+			t.Fatal(err)
+		}
+
+		stored, err := GetLatestHealthCheck(database, site.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Up != hc.Up {
+			t.Errorf("%d/%q: stored Up = %v, want %v", hc.HTTPStatus, hc.ContainerStatus, stored.Up, hc.Up)
+		}
+		if fmt.Sprint(stored.Services) != fmt.Sprint(hc.Services) {
+			t.Errorf("stored services = %v, want %v", stored.Services, hc.Services)
+		}
+		series, err := GetHealthTimeSeries(database, site.ID, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), 7200)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ratio float64
+		for _, b := range series {
+			if b.UpRatio != nil {
+				ratio = *b.UpRatio
+			}
+		}
+		if want := map[bool]float64{true: 1, false: 0}[hc.Up]; ratio != want {
+			t.Errorf("%d/%q: up ratio = %v, want %v", hc.HTTPStatus, hc.ContainerStatus, ratio, want)
+		}
+	}
+
+	summary, err := GetHealthSummary(database, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Checked != 5 || summary.Failing != 3 {
+		t.Errorf("summary = %+v, want 5 checked, 3 failing", summary)
+	}
+}
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 )
 
 type Payment struct {
@@ -16,6 +17,15 @@ type Payment struct {
 	Notes      string
 	CreatedAt  string
 
+	// Recurrence is one of the PaymentRecurrence* values. NextPaymentID is
+	// set once the following period's payment has been generated.
+	Recurrence    string
+	NextPaymentID sql.NullInt64
+	// AnchorDay is the day of month a recurring series falls due on, kept
+	// across periods in which it had to be clamped. 0 means the due date's
+	// own day, as for the first payment of a series.
+	AnchorDay int
+
 	// Display fields populated via JOIN
 	CustomerName string
 	SiteDomain   string
@@ -29,6 +39,7 @@ type SiteDropdown struct {
 
 const paymentSelectColumns = `
 	p.id, p.customer_id, p.site_id, p.amount, p.due_date, p.paid_at, p.notes, p.created_at,
+	COALESCE(p.recurrence, 'none'), p.next_payment_id, COALESCE(p.anchor_day, 0),
 	COALESCE(c.name, '') as customer_name,
 	COALESCE(s.domain, '') as site_domain,
 	CASE
@@ -49,6 +60,7 @@ func scanPayment(row interface{ Scan(dest ...any) error }) (*Payment, error) {
 	var p Payment
 	err := row.Scan(
 		&p.ID, &p.CustomerID, &p.SiteID, &p.Amount, &p.DueDate, &p.PaidAt, &p.Notes, &p.CreatedAt,
+		&p.Recurrence, &p.NextPaymentID, &p.AnchorDay,
 		&p.CustomerName, &p.SiteDomain, &p.Status,
 	)
 	if err != nil {
@@ -105,9 +117,12 @@ func GetPaymentsByCustomerID(db *sql.DB, customerID int) ([]Payment, error) {
 }
 
 func CreatePayment(db *sql.DB, p *Payment) error {
+	if p.Recurrence == "" {
+		p.Recurrence = PaymentRecurrenceNone
+	}
 	result, err := db.Exec(
-		"INSERT INTO payments (customer_id, site_id, amount, due_date, notes) VALUES (?, ?, ?, ?, ?)",
-		p.CustomerID, p.SiteID, p.Amount, p.DueDate, p.Notes,
+		"INSERT INTO payments (customer_id, site_id, amount, due_date, notes, recurrence) VALUES (?, ?, ?, ?, ?, ?)",
+		p.CustomerID, p.SiteID, p.Amount, p.DueDate, p.Notes, p.Recurrence,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create payment: %w", err)
@@ -120,10 +135,16 @@ func CreatePayment(db *sql.DB, p *Payment) error {
 	return nil
 }
 
+// UpdatePayment saves p. Moving the due date also moves the day of month the
+// series recurs on.
 func UpdatePayment(db *sql.DB, p *Payment) error {
+	if p.Recurrence == "" {
+		p.Recurrence = PaymentRecurrenceNone
+	}
 	_, err := db.Exec(
-		"UPDATE payments SET customer_id = ?, site_id = ?, amount = ?, due_date = ?, notes = ? WHERE id = ?",
-		p.CustomerID, p.SiteID, p.Amount, p.DueDate, p.Notes, p.ID,
+		`UPDATE payments SET customer_id = ?, site_id = ?, amount = ?, due_date = ?, notes = ?, recurrence = ?,
+		 anchor_day = CASE WHEN due_date = ? THEN anchor_day END WHERE id = ?`,
+		p.CustomerID, p.SiteID, p.Amount, p.DueDate, p.Notes, p.Recurrence, p.DueDate, p.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update payment: %w", err)
@@ -150,6 +171,49 @@ func DeletePayment(db *sql.DB, id int) error {
 	return nil
 }
 
+// MarkPaymentsPaid marks the given payments paid in one transaction and
+// returns the IDs that changed. Payments that are already paid or do not
+// exist are skipped.
+func MarkPaymentsPaid(db *sql.DB, ids []int) ([]int, error) {
+	return bulkPaymentUpdate(db, ids, "mark payments as paid",
+		"UPDATE payments SET paid_at = datetime('now'), status = 'paid' WHERE id = ? AND status != 'paid'")
+}
+
+// DeletePayments deletes the given payments in one transaction and returns
+// the IDs that were deleted.
+func DeletePayments(db *sql.DB, ids []int) ([]int, error) {
+	return bulkPaymentUpdate(db, ids, "delete payments", "DELETE FROM payments WHERE id = ?")
+}
+
+func bulkPaymentUpdate(db *sql.DB, ids []int, what, query string) ([]int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", what, err)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", what, err)
+	}
+	defer stmt.Close()
+
+	var changed []int
+	for _, id := range ids {
+		result, err := stmt.Exec(id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to %s (payment %d): %w", what, id, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n > 0 {
+			changed = append(changed, id)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to %s: %w", what, err)
+	}
+	return changed, nil
+}
+
 func CountOverduePayments(db *sql.DB) (int, error) {
 	var count int
 	err := db.QueryRow(
@@ -170,11 +234,61 @@ func CountPayments(db *sql.DB) (int, error) {
 	return count, nil
 }
 
-func GetPaymentsPaginated(db *sql.DB, limit, offset int) ([]Payment, error) {
-	query := "SELECT " + paymentSelectColumns + paymentFromJoins + " ORDER BY p.due_date ASC LIMIT ? OFFSET ?"
-	rows, err := db.Query(query, limit, offset)
+// Computed payment statuses, as returned in Payment.Status.
+var PaymentStatuses = []string{"pending", "due_soon", "overdue", "paid"}
+
+// PaymentFilter narrows SearchPayments. Zero fields do not filter.
+type PaymentFilter struct {
+	Query      string // substring of the customer name or site domain
+	Status     string // one of PaymentStatuses
+	CustomerID int
+	DueFrom    string // YYYY-MM-DD, inclusive
+	DueTo      string // YYYY-MM-DD, inclusive
+}
+
+// SearchPayments returns a page of payments matching f, soonest due first,
+// and the total number of matches. The status filter applies to the
+// computed status, so "overdue" tracks the current date.
+func SearchPayments(db *sql.DB, f PaymentFilter, page, perPage int) ([]Payment, int, error) {
+	var conditions []string
+	var args []interface{}
+	if f.Query != "" {
+		escaped := "%" + strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(f.Query) + "%"
+		conditions = append(conditions, `(c.name LIKE ? ESCAPE '\' OR s.domain LIKE ? ESCAPE '\')`)
+		args = append(args, escaped, escaped)
+	}
+	if f.CustomerID > 0 {
+		conditions = append(conditions, "p.customer_id = ?")
+		args = append(args, f.CustomerID)
+	}
+	if f.DueFrom != "" {
+		conditions = append(conditions, "p.due_date >= ?")
+		args = append(args, f.DueFrom)
+	}
+	if f.DueTo != "" {
+		conditions = append(conditions, "p.due_date <= ?")
+		args = append(args, f.DueTo)
+	}
+	inner := "SELECT " + paymentSelectColumns + paymentFromJoins
+	if len(conditions) > 0 {
+		inner += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// computed_status is a select alias, so filter on it from outside.
+	outerWhere := ""
+	if f.Status != "" {
+		outerWhere = " WHERE computed_status = ?"
+		args = append(args, f.Status)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM ("+inner+")"+outerWhere, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count filtered payments: %w", err)
+	}
+
+	query := "SELECT * FROM (" + inner + ")" + outerWhere + " ORDER BY due_date ASC, id ASC LIMIT ? OFFSET ?"
+	rows, err := db.Query(query, append(args, perPage, (page-1)*perPage)...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query payments: %w", err)
+		return nil, 0, fmt.Errorf("failed to query filtered payments: %w", err)
 	}
 	defer rows.Close()
 
@@ -182,15 +296,18 @@ func GetPaymentsPaginated(db *sql.DB, limit, offset int) ([]Payment, error) {
 	for rows.Next() {
 		p, err := scanPayment(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan payment: %w", err)
+			return nil, 0, fmt.Errorf("failed to scan payment: %w", err)
 		}
 		payments = append(payments, *p)
 	}
-	return payments, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("payment row iteration error: %w", err)
+	}
+	return payments, total, nil
 }
 
 func GetSitesForDropdown(db *sql.DB) ([]SiteDropdown, error) {
-	rows, err := db.Query("SELECT id, domain FROM sites ORDER BY domain ASC")
+	rows, err := db.Query("SELECT id, domain FROM sites WHERE deleted_at IS NULL ORDER BY domain ASC")
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sites: %w", err)
 	}
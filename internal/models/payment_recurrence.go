@@ -0,0 +1,156 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Payment recurrence values.
+const (
+	PaymentRecurrenceNone      = "none"
+	PaymentRecurrenceMonthly   = "monthly"
+	PaymentRecurrenceQuarterly = "quarterly"
+	PaymentRecurrenceYearly    = "yearly"
+)
+
+// ValidPaymentRecurrence reports whether r is a recognised recurrence.
+func ValidPaymentRecurrence(r string) bool {
+	switch r {
+	case PaymentRecurrenceNone, PaymentRecurrenceMonthly, PaymentRecurrenceQuarterly, PaymentRecurrenceYearly:
+		return true
+	}
+	return false
+}
+
+// NextDueDate returns the due date one recurrence period after due, on day
+// anchorDay of the month, or due's own day when anchorDay is 0. The day is
+// clamped to the month, so a series anchored on the 31st falls due on Feb
+// 28/29 and then on Mar 31 again rather than rolling over or drifting.
+func NextDueDate(due time.Time, recurrence string, anchorDay int) time.Time {
+	months := 0
+	switch recurrence {
+	case PaymentRecurrenceMonthly:
+		months = 1
+	case PaymentRecurrenceQuarterly:
+		months = 3
+	case PaymentRecurrenceYearly:
+		months = 12
+	}
+	first := time.Date(due.Year(), due.Month()+time.Month(months), 1, 0, 0, 0, 0, due.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := anchorDay
+	if day == 0 {
+		day = due.Day()
+	}
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, due.Location())
+}
+
+// GetRecurringPaymentsToSpawn returns the IDs of recurring payments whose next
+// period has not been generated yet and that are either paid or past due.
+func GetRecurringPaymentsToSpawn(db *sql.DB) ([]int, error) {
+	rows, err := db.Query(`SELECT id FROM payments
+		WHERE COALESCE(recurrence, 'none') != 'none'
+		  AND next_payment_id IS NULL
+		  AND (paid_at IS NOT NULL OR due_date < date('now'))
+		ORDER BY due_date ASC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recurring payments: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan recurring payment: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// SpawnNextPayment generates the next period's payment for a recurring
+// payment and links it via next_payment_id. It returns nil without error
+// when the payment does not recur or its successor already exists, so it is
+// safe to call more than once: the insert and the link happen in one
+// transaction that is rolled back if another caller linked a successor first.
+func SpawnNextPayment(db *sql.DB, id int) (*Payment, error) {
+	parent, err := GetPaymentByID(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if parent.Recurrence == PaymentRecurrenceNone || !ValidPaymentRecurrence(parent.Recurrence) || parent.NextPaymentID.Valid {
+		return nil, nil
+	}
+	// The driver may return a DATE column as a full RFC 3339 timestamp.
+	dueStr := parent.DueDate
+	if len(dueStr) > len("2006-01-02") {
+		dueStr = dueStr[:len("2006-01-02")]
+	}
+	due, err := time.Parse("2006-01-02", dueStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse due date %q of payment %d: %w", parent.DueDate, id, err)
+	}
+
+	anchor := parent.AnchorDay
+	if anchor == 0 {
+		anchor = due.Day()
+	}
+	next := &Payment{
+		CustomerID: parent.CustomerID,
+		SiteID:     parent.SiteID,
+		Amount:     parent.Amount,
+		DueDate:    NextDueDate(due, parent.Recurrence, anchor).Format("2006-01-02"),
+		Notes:      parent.Notes,
+		Recurrence: parent.Recurrence,
+		AnchorDay:  anchor,
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO payments (customer_id, site_id, amount, due_date, notes, recurrence, anchor_day) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		next.CustomerID, next.SiteID, next.Amount, next.DueDate, next.Notes, next.Recurrence, next.AnchorDay,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recurring payment: %w", err)
+	}
+	nextID, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	res, err := tx.Exec("UPDATE payments SET next_payment_id = ? WHERE id = ? AND next_payment_id IS NULL", nextID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link recurring payment: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recurring payment: %w", err)
+	}
+	next.ID = int(nextID)
+	return next, nil
+}
+
+// SpawnRecurringPayment generates the next period's payment for payment id
+// and records it in the activity log. It returns nil when nothing was
+// generated because the payment does not recur or already has a successor.
+func SpawnRecurringPayment(db *sql.DB, id int, ip, userAgent string) (*Payment, error) {
+	next, err := SpawnNextPayment(db, id)
+	if err != nil || next == nil {
+		return nil, err
+	}
+	LogActivityWithContext(db, "payment", next.ID, "recurred",
+		fmt.Sprintf("Generated %s payment of $%.2f due %s from payment #%d", next.Recurrence, next.Amount, next.DueDate, id),
+		ip, userAgent)
+	return next, nil
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+)
+
+func TestNextDueDate(t *testing.T) {
+	tests := []struct {
+		due        string
+		recurrence string
+		anchor     int
+		want       string
+	}{
+		{"2024-01-15", PaymentRecurrenceMonthly, 0, "2024-02-15"},
+		{"2024-01-31", PaymentRecurrenceMonthly, 0, "2024-02-29"},
+		{"2023-01-31", PaymentRecurrenceMonthly, 0, "2023-02-28"},
+		{"2024-11-30", PaymentRecurrenceQuarterly, 0, "2025-02-28"},
+		{"2024-02-29", PaymentRecurrenceYearly, 0, "2025-02-28"},
+		{"2024-12-05", PaymentRecurrenceMonthly, 0, "2025-01-05"},
+		// A clamped date recurs on the anchor day again.
+		{"2023-02-28", PaymentRecurrenceMonthly, 31, "2023-03-31"},
+		{"2023-03-31", PaymentRecurrenceMonthly, 31, "2023-04-30"},
+		{"2025-02-28", PaymentRecurrenceYearly, 29, "2026-02-28"},
+		{"2024-02-28", PaymentRecurrenceMonthly, 28, "2024-03-28"},
+	}
+	for _, tt := range tests {
+		due, _ := time.Parse("2006-01-02", tt.due)
+		if got := NextDueDate(due, tt.recurrence, tt.anchor).Format("2006-01-02"); got != tt.want {
+			t.Errorf("NextDueDate(%s, %s, %d) = %s, want %s", tt.due, tt.recurrence, tt.anchor, got, tt.want)
+		}
+	}
+}
+
+func TestSpawnNextPayment_OnlyOnce(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	cust := &Customer{Name: "Acme"}
+	if err := CreateCustomer(database, cust); err != nil {
+		t.Fatal(err)
+	}
+	recurring := &Payment{CustomerID: cust.ID, Amount: 25, DueDate: "2024-01-31", Recurrence: PaymentRecurrenceMonthly}
+	oneOff := &Payment{CustomerID: cust.ID, Amount: 99, DueDate: "2024-01-31"}
+	for _, p := range []*Payment{recurring, oneOff} {
+		if err := CreatePayment(database, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := GetRecurringPaymentsToSpawn(database)
+	if err != nil || len(ids) != 1 || ids[0] != recurring.ID {
+		t.Fatalf("GetRecurringPaymentsToSpawn = %v, %v; want [%d]", ids, err, recurring.ID)
+	}
+
+	next, err := SpawnNextPayment(database, recurring.ID)
+	if err != nil || next == nil {
+		t.Fatalf("SpawnNextPayment = %v, %v", next, err)
+	}
+	if next.DueDate != "2024-02-29" || next.Amount != 25 || next.Recurrence != PaymentRecurrenceMonthly {
+		t.Errorf("next payment = %+v", next)
+	}
+
+	again, err := SpawnNextPayment(database, recurring.ID)
+	if err != nil || again != nil {
+		t.Errorf("second SpawnNextPayment = %v, %v; want nil, nil", again, err)
+	}
+	if none, err := SpawnNextPayment(database, oneOff.ID); err != nil || none != nil {
+		t.Errorf("SpawnNextPayment on one-off = %v, %v; want nil, nil", none, err)
+	}
+	if n, _ := CountPayments(database); n != 3 {
+		t.Errorf("CountPayments = %d, want 3", n)
+	}
+
+	parent, err := GetPaymentByID(database, recurring.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !parent.NextPaymentID.Valid || int(parent.NextPaymentID.Int64) != next.ID {
+		t.Errorf("parent next_payment_id = %v, want %d", parent.NextPaymentID, next.ID)
+	}
+}
+
+func TestSpawnNextPayment_KeepsAnchorDay(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	cust := &Customer{Name: "Acme"}
+	if err := CreateCustomer(database, cust); err != nil {
+		t.Fatal(err)
+	}
+	p := &Payment{CustomerID: cust.ID, Amount: 25, DueDate: "2023-01-31", Recurrence: PaymentRecurrenceMonthly}
+	if err := CreatePayment(database, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Feb clamps to the 28th; March goes back to the 31st instead of
+	// drifting to the 28th.
+	id := p.ID
+	for _, want := range []string{"2023-02-28", "2023-03-31", "2023-04-30", "2023-05-31"} {
+		next, err := SpawnNextPayment(database, id)
+		if err != nil || next == nil {
+			t.Fatalf("SpawnNextPayment(%d) = %v, %v", id, next, err)
+		}
+		if next.DueDate != want {
+			t.Errorf("next due date = %s, want %s", next.DueDate, want)
+		}
+		id = next.ID
+	}
+
+	// Moving a payment's due date moves the day the series recurs on.
+	last, err := GetPaymentByID(database, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last.DueDate = "2023-05-15"
+	if err := UpdatePayment(database, last); err != nil {
+		t.Fatal(err)
+	}
+	next, err := SpawnNextPayment(database, id)
+	if err != nil || next == nil || next.DueDate != "2023-06-15" {
+		t.Errorf("after moving to the 15th: next = %+v, %v; want due 2023-06-15", next, err)
+	}
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestBulkPaymentUpdates(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	cust := &Customer{Name: "Acme"}
+	if err := CreateCustomer(database, cust); err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for i := 0; i < 3; i++ {
+		p := &Payment{CustomerID: cust.ID, Amount: 10, DueDate: "2024-01-31"}
+		if err := CreatePayment(database, p); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, p.ID)
+	}
+	if err := MarkPaymentPaid(database, ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := GetPaymentByID(database, ids[0])
+
+	changed, err := MarkPaymentsPaid(database, []int{ids[0], ids[1], ids[1], 9999})
+	if err != nil {
+		t.Fatalf("MarkPaymentsPaid: %v", err)
+	}
+	if !reflect.DeepEqual(changed, []int{ids[1]}) {
+		t.Errorf("MarkPaymentsPaid changed %v, want [%d]", changed, ids[1])
+	}
+	if after, _ := GetPaymentByID(database, ids[0]); after.PaidAt != before.PaidAt {
+		t.Errorf("already-paid payment's paid_at changed from %v to %v", before.PaidAt, after.PaidAt)
+	}
+	if p, _ := GetPaymentByID(database, ids[1]); p.Status != "paid" {
+		t.Errorf("payment %d status = %q, want paid", ids[1], p.Status)
+	}
+
+	changed, err = DeletePayments(database, []int{ids[1], ids[2], 9999})
+	if err != nil {
+		t.Fatalf("DeletePayments: %v", err)
+	}
+	if !reflect.DeepEqual(changed, []int{ids[1], ids[2]}) {
+		t.Errorf("DeletePayments deleted %v, want %v", changed, ids[1:])
+	}
+	if n, _ := CountPayments(database); n != 1 {
+		t.Errorf("CountPayments = %d, want 1", n)
+	}
+}
+
+func TestSearchPayments(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	acme := &Customer{Name: "Acme"}
+	other := &Customer{Name: "Other 100%"}
+	for _, c := range []*Customer{acme, other} {
+		if err := CreateCustomer(database, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, p := range []*Payment{
+		{CustomerID: acme.ID, Amount: 10, DueDate: "2000-01-31"},
+		{CustomerID: acme.ID, Amount: 20, DueDate: "2000-02-29"},
+		{CustomerID: other.ID, Amount: 30, DueDate: "2000-02-15"},
+		{CustomerID: acme.ID, Amount: 40, DueDate: "2999-01-01"},
+	} {
+		if err := CreatePayment(database, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paid, _, _ := SearchPayments(database, PaymentFilter{DueFrom: "2000-02-29", DueTo: "2000-02-29"}, 1, 10)
+	if err := MarkPaymentPaid(database, paid[0].ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		filter PaymentFilter
+		want   []float64
+	}{
+		{"all", PaymentFilter{}, []float64{10, 30, 20, 40}},
+		{"overdue", PaymentFilter{Status: "overdue"}, []float64{10, 30}},
+		{"paid", PaymentFilter{Status: "paid"}, []float64{20}},
+		{"customer", PaymentFilter{CustomerID: acme.ID, Status: "overdue"}, []float64{10}},
+		{"due range", PaymentFilter{DueFrom: "2000-02-01", DueTo: "2000-02-28"}, []float64{30}},
+		{"literal percent", PaymentFilter{Query: "100%"}, []float64{30}},
+	} {
+		got, total, err := SearchPayments(database, tc.filter, 1, 10)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		var amounts []float64
+		for _, p := range got {
+			amounts = append(amounts, p.Amount)
+		}
+		if !reflect.DeepEqual(amounts, tc.want) || total != len(tc.want) {
+			t.Errorf("%s: got %v (total %d), want %v", tc.name, amounts, total, tc.want)
+		}
+	}
+
+	if page, total, _ := SearchPayments(database, PaymentFilter{}, 2, 3); len(page) != 1 || total != 4 || page[0].Amount != 40 {
+		t.Errorf("page 2 = %v, total %d", page, total)
+	}
+}
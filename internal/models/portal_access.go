@@ -0,0 +1,107 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// PortalAccessToken is a read-only portal link issued to a customer. The
+// plain token is only shown when the link is created; TokenPrefix (its first
+// characters) lets the admin tell links apart afterwards.
+type PortalAccessToken struct {
+	ID          int
+	CustomerID  int
+	TokenHash   string
+	TokenPrefix string
+	CreatedBy   string
+	// LastUsedAt is empty until the link is first opened.
+	LastUsedAt string
+	CreatedAt  string
+}
+
+const portalAccessTokenColumns = `id, customer_id, token_hash, token_prefix, COALESCE(created_by,''),
+	COALESCE(last_used_at,''), created_at`
+
+func scanPortalAccessToken(scanner interface {
+	Scan(dest ...interface{}) error
+}) (*PortalAccessToken, error) {
+	var t PortalAccessToken
+	if err := scanner.Scan(&t.ID, &t.CustomerID, &t.TokenHash, &t.TokenPrefix, &t.CreatedBy,
+		&t.LastUsedAt, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreatePortalAccessToken stores a new portal link for t.CustomerID.
+func CreatePortalAccessToken(db *sql.DB, t *PortalAccessToken) error {
+	result, err := db.Exec(
+		"INSERT INTO portal_access_tokens (customer_id, token_hash, token_prefix, created_by) VALUES (?, ?, ?, ?)",
+		t.CustomerID, t.TokenHash, t.TokenPrefix, t.CreatedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create portal access token: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	t.ID = int(id)
+	return nil
+}
+
+// GetPortalAccessTokensByCustomerID returns a customer's portal links, newest
+// first.
+func GetPortalAccessTokensByCustomerID(db *sql.DB, customerID int) ([]PortalAccessToken, error) {
+	rows, err := db.Query(
+		`SELECT `+portalAccessTokenColumns+` FROM portal_access_tokens WHERE customer_id = ? ORDER BY id DESC`,
+		customerID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query portal access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []PortalAccessToken
+	for rows.Next() {
+		t, err := scanPortalAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan portal access token row: %w", err)
+		}
+		tokens = append(tokens, *t)
+	}
+	return tokens, rows.Err()
+}
+
+// GetPortalAccessTokenByHash looks up a portal link by the hash of its token.
+func GetPortalAccessTokenByHash(db *sql.DB, hash string) (*PortalAccessToken, error) {
+	t, err := scanPortalAccessToken(db.QueryRow(
+		`SELECT `+portalAccessTokenColumns+` FROM portal_access_tokens WHERE token_hash = ?`, hash,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("portal access token not found: %w", err)
+	}
+	return t, nil
+}
+
+// TouchPortalAccessToken records that a portal link was just opened.
+func TouchPortalAccessToken(db *sql.DB, id int) error {
+	_, err := db.Exec("UPDATE portal_access_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to update portal access token: %w", err)
+	}
+	return nil
+}
+
+// RevokePortalAccessToken deletes portal link id of customer customerID. It
+// returns sql.ErrNoRows when the customer has no such link.
+func RevokePortalAccessToken(db *sql.DB, customerID, id int) error {
+	result, err := db.Exec("DELETE FROM portal_access_tokens WHERE id = ? AND customer_id = ?", id, customerID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke portal access token: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestPortalAccessTokenLifecycle(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	var customers [2]int
+	for i, name := range []string{"Acme", "Other"} {
+		res, err := database.Exec("INSERT INTO customers (name) VALUES (?)", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		id, _ := res.LastInsertId()
+		customers[i] = int(id)
+	}
+
+	tok := &PortalAccessToken{CustomerID: customers[0], TokenHash: "hash-a", TokenPrefix: "abcd1234", CreatedBy: "admin"}
+	if err := CreatePortalAccessToken(database, tok); err != nil {
+		t.Fatalf("CreatePortalAccessToken: %v", err)
+	}
+
+	got, err := GetPortalAccessTokenByHash(database, "hash-a")
+	if err != nil {
+		t.Fatalf("GetPortalAccessTokenByHash: %v", err)
+	}
+	if got.ID != tok.ID || got.CustomerID != customers[0] || got.LastUsedAt != "" {
+		t.Errorf("got %+v", got)
+	}
+	if err := TouchPortalAccessToken(database, tok.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := GetPortalAccessTokenByHash(database, "hash-a"); got == nil || got.LastUsedAt == "" {
+		t.Errorf("last_used_at not set: %+v", got)
+	}
+
+	if err := RevokePortalAccessToken(database, customers[1], tok.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("revoking another customer's link: err = %v, want sql.ErrNoRows", err)
+	}
+	if err := RevokePortalAccessToken(database, customers[0], tok.ID); err != nil {
+		t.Fatalf("RevokePortalAccessToken: %v", err)
+	}
+	if _, err := GetPortalAccessTokenByHash(database, "hash-a"); err == nil {
+		t.Error("revoked link still resolves")
+	}
+	tokens, err := GetPortalAccessTokensByCustomerID(database, customers[0])
+	if err != nil || len(tokens) != 0 {
+		t.Errorf("tokens after revoke = %v, %v", tokens, err)
+	}
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// Embed the zone database so quiet hours time zones resolve on hosts and
+	// containers without /usr/share/zoneinfo.
+	_ "time/tzdata"
+)
+
+// MaxQuietWindows caps how many quiet hours windows a site may have.
+const MaxQuietWindows = 8
+
+// QuietWindow is a daily window, in minutes after midnight, during which a
+// site's down alerts are held back. A window whose End is before its Start
+// wraps past midnight.
+type QuietWindow struct {
+	Start int
+	End   int
+}
+
+func (w QuietWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// contains reports whether minute (0-1439) falls inside the window. The end
+// minute is excluded, so 02:00-04:00 is quiet until 03:59.
+func (w QuietWindow) contains(minute int) bool {
+	if w.Start < w.End {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", strings.TrimSpace(s))
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ParseQuietHours parses a comma-separated list of HH:MM-HH:MM windows, such
+// as "02:00-04:00, 22:30-23:00". An empty spec means no quiet hours.
+func ParseQuietHours(spec string) ([]QuietWindow, error) {
+	var windows []QuietWindow
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("invalid window %q, use HH:MM-HH:MM", part)
+		}
+		start, err := parseClock(from)
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(to)
+		if err != nil {
+			return nil, err
+		}
+		if start == end {
+			return nil, fmt.Errorf("window %q is empty", part)
+		}
+		windows = append(windows, QuietWindow{Start: start, End: end})
+	}
+	if len(windows) > MaxQuietWindows {
+		return nil, fmt.Errorf("at most %d quiet hours windows are allowed", MaxQuietWindows)
+	}
+	return windows, nil
+}
+
+// NormalizeQuietHours validates spec and returns it in canonical form
+// ("02:00-04:00,22:30-23:00").
+func NormalizeQuietHours(spec string) (string, error) {
+	windows, err := ParseQuietHours(spec)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, len(windows))
+	for i, w := range windows {
+		parts[i] = w.String()
+	}
+	return strings.Join(parts, ","), nil
+}
+
+// ValidateQuietHoursTZ returns an error unless tz is empty (the server's
+// local time) or a known IANA time zone such as "Europe/Berlin".
+func ValidateQuietHoursTZ(tz string) error {
+	if tz == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return fmt.Errorf("unknown time zone %q", tz)
+	}
+	return nil
+}
+
+// InQuietHours reports whether t falls inside one of the site's quiet hours
+// windows, read in the site's time zone. Invalid stored values are treated
+// as no quiet hours, so alerts are never lost to a bad setting.
+func (s *Site) InQuietHours(t time.Time) bool {
+	if s.QuietHours == "" {
+		return false
+	}
+	windows, err := ParseQuietHours(s.QuietHours)
+	if err != nil {
+		return false
+	}
+	loc := time.Local
+	if s.QuietHoursTZ != "" {
+		if loc, err = time.LoadLocation(s.QuietHoursTZ); err != nil {
+			return false
+		}
+	}
+	local := t.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	for _, w := range windows {
+		if w.contains(minute) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeQuietHours(t *testing.T) {
+	tests := []struct {
+		in, want string
+		wantErr  bool
+	}{
+		{"", "", false},
+		{" 2:00-4:00 , 22:30-01:15", "02:00-04:00,22:30-01:15", false},
+		{"02:00", "", true},
+		{"02:00-02:00", "", true},
+		{"25:00-26:00", "", true},
+		{"02:00-04:00,", "02:00-04:00", false},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeQuietHours(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeQuietHours(%q) = %q, %v; want %q, err %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSiteInQuietHours(t *testing.T) {
+	site := Site{QuietHours: "02:00-04:00,23:00-00:30", QuietHoursTZ: "America/New_York"}
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		at   time.Time
+		want bool
+	}{
+		{time.Date(2024, 6, 1, 2, 0, 0, 0, ny), true},
+		{time.Date(2024, 6, 1, 3, 59, 0, 0, ny), true},
+		{time.Date(2024, 6, 1, 4, 0, 0, 0, ny), false},
+		{time.Date(2024, 6, 1, 23, 30, 0, 0, ny), true},
+		{time.Date(2024, 6, 2, 0, 15, 0, 0, ny), true},
+		{time.Date(2024, 6, 1, 12, 0, 0, 0, ny), false},
+		// 07:00 UTC is 03:00 in New York during daylight saving time.
+		{time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		if got := site.InQuietHours(tt.at); got != tt.want {
+			t.Errorf("InQuietHours(%s) = %v, want %v", tt.at, got, tt.want)
+		}
+	}
+
+	if (&Site{QuietHours: "02:00-04:00", QuietHoursTZ: "Nowhere/Invalid"}).InQuietHours(time.Date(2024, 6, 1, 3, 0, 0, 0, time.Local)) {
+		t.Error("an invalid time zone should disable quiet hours")
+	}
+}
@@ -1,5 +1,14 @@
 package models
 
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"ezweb/internal/auth"
+)
+
 type RoutingConfig struct {
 	Rules           []RoutingRule `json:"rules"`
 	RedirectDomains []string      `json:"redirect_domains,omitempty"` // e.g. ["www.jadenrazo.dev"] → redirect to primary
@@ -7,6 +16,58 @@ type RoutingConfig struct {
 	TLSKeyPath      string        `json:"tls_key_path,omitempty"`
 	HTTPOnly        bool          `json:"http_only,omitempty"`        // no TLS, serve on :80 only
 	ExtraDirectives []string      `json:"extra_directives,omitempty"` // raw Caddyfile lines injected into site block
+	SecurityHeaders bool          `json:"security_headers,omitempty"` // HSTS (unless HTTPOnly), nosniff and Referrer-Policy on every response
+	// WebSocket and GRPC set how a simple site (one without rules) proxies to
+	// its port: WebSocket streams responses unbuffered, GRPC talks to the
+	// upstream over h2c. Routed sites set the same options per rule.
+	WebSocket bool `json:"websocket,omitempty"`
+	GRPC      bool `json:"grpc,omitempty"`
+	// RemoteUpstream makes a simple site proxy to its assigned server's host
+	// instead of localhost, for sites whose container runs on a different
+	// machine than Caddy.
+	RemoteUpstream bool `json:"remote_upstream,omitempty"`
+}
+
+// worthStoring reports whether rc carries anything a site is saved with.
+// Without rules only the security header preset and the simple site proxy
+// modes and upstream are kept; the other settings apply to routed sites.
+func (rc *RoutingConfig) worthStoring() bool {
+	return rc != nil && (len(rc.Rules) > 0 || rc.SecurityHeaders || rc.WebSocket || rc.GRPC || rc.RemoteUpstream)
+}
+
+// ValidateProxyModes rejects WebSocket and gRPC combinations Caddy cannot
+// serve. gRPC clients need HTTP/2, which Caddy only offers over TLS, so it
+// does not work on HTTP-only sites; and an h2c upstream cannot carry the
+// HTTP/1.1 upgrade a WebSocket needs, so the two are exclusive.
+func (rc *RoutingConfig) ValidateProxyModes() error {
+	if rc == nil {
+		return nil
+	}
+	if err := validateProxyMode(rc.WebSocket, rc.GRPC, rc.HTTPOnly, ""); err != nil {
+		return err
+	}
+	for i, r := range rc.Rules {
+		if err := validateProxyMode(r.WebSocket, r.GRPC, rc.HTTPOnly, r.Upstream); err != nil {
+			return fmt.Errorf("rule %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func validateProxyMode(websocket, grpc, httpOnly bool, upstream string) error {
+	if !grpc {
+		return nil
+	}
+	if websocket {
+		return fmt.Errorf("gRPC and WebSocket cannot both be enabled")
+	}
+	if httpOnly {
+		return fmt.Errorf("gRPC needs HTTPS and cannot be used on an HTTP-only site")
+	}
+	if strings.HasPrefix(upstream, "https://") {
+		return fmt.Errorf("gRPC upstreams are reached over h2c and cannot use https://")
+	}
+	return nil
 }
 
 type RoutingRule struct {
@@ -15,8 +76,19 @@ type RoutingRule struct {
 	StripPrefix string            `json:"strip_prefix,omitempty"`  // prefix to strip, e.g. "/api/v1" turns /api/v1/urls/x into /urls/x
 	RewritePath string            `json:"rewrite_path,omitempty"`  // full rewrite, e.g. "/api/v1/devpanel/health"
 	WebSocket   bool              `json:"websocket,omitempty"`
+	GRPC        bool              `json:"grpc,omitempty"`          // proxy over h2c for gRPC backends
 	Headers     map[string]string `json:"headers,omitempty"`       // response headers
 	CORS        *CORSConfig       `json:"cors,omitempty"`
+	BasicAuth   *BasicAuth        `json:"basic_auth,omitempty"`   // password wall enforced by Caddy
+}
+
+// BasicAuth protects a routing rule with HTTP basic auth. Password is only
+// accepted as input: HashBasicAuth replaces it with a bcrypt PasswordHash
+// before the config is stored, so plaintext never reaches the database.
+type BasicAuth struct {
+	Username     string `json:"username"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	Password     string `json:"password,omitempty"`
 }
 
 type CORSConfig struct {
@@ -26,3 +98,111 @@ type CORSConfig struct {
 	Credentials bool     `json:"credentials,omitempty"`
 	MaxAge      int      `json:"max_age,omitempty"`
 }
+
+// CloneFor returns a deep copy of the routing config for a cloned site.
+// Redirect domains and TLS certificate paths belong to the original domain
+// and are dropped. Upstreams that point at the original site's local port
+// are re-pointed at newPort so the clone never proxies to the original.
+func (rc *RoutingConfig) CloneFor(oldPort, newPort int) *RoutingConfig {
+	if rc == nil {
+		return nil
+	}
+	out := &RoutingConfig{
+		HTTPOnly:        rc.HTTPOnly,
+		ExtraDirectives: append([]string(nil), rc.ExtraDirectives...),
+		SecurityHeaders: rc.SecurityHeaders,
+		WebSocket:       rc.WebSocket,
+		GRPC:            rc.GRPC,
+		RemoteUpstream:  rc.RemoteUpstream,
+	}
+	for _, r := range rc.Rules {
+		rule := r
+		rule.Upstream = repointUpstream(r.Upstream, oldPort, newPort)
+		if r.Headers != nil {
+			rule.Headers = make(map[string]string, len(r.Headers))
+			for k, v := range r.Headers {
+				rule.Headers[k] = v
+			}
+		}
+		if r.CORS != nil {
+			cors := *r.CORS
+			cors.Origins = append([]string(nil), r.CORS.Origins...)
+			rule.CORS = &cors
+		}
+		if r.BasicAuth != nil {
+			ba := *r.BasicAuth
+			rule.BasicAuth = &ba
+		}
+		out.Rules = append(out.Rules, rule)
+	}
+	return out
+}
+
+// repointPort re-points, in place, the upstreams that point at the site's
+// local port oldPort at newPort.
+func (rc *RoutingConfig) repointPort(oldPort, newPort int) {
+	if rc == nil {
+		return
+	}
+	for i := range rc.Rules {
+		rc.Rules[i].Upstream = repointUpstream(rc.Rules[i].Upstream, oldPort, newPort)
+	}
+}
+
+// HashBasicAuth bcrypt-hashes any plaintext basic auth password on the rules
+// and clears it. A password (or hash) without a username, or a username with
+// neither, is rejected. Errors never include the password.
+func (rc *RoutingConfig) HashBasicAuth() error {
+	if rc == nil {
+		return nil
+	}
+	for i := range rc.Rules {
+		ba := rc.Rules[i].BasicAuth
+		if ba == nil {
+			continue
+		}
+		ba.Username = strings.TrimSpace(ba.Username)
+		if ba.Username == "" {
+			if ba.Password != "" || ba.PasswordHash != "" {
+				return fmt.Errorf("rule %d: basic auth username is required when a password is set", i+1)
+			}
+			rc.Rules[i].BasicAuth = nil
+			continue
+		}
+		if ba.Password != "" {
+			hash, err := auth.HashBcrypt(ba.Password)
+			if err != nil {
+				return fmt.Errorf("rule %d: failed to hash basic auth password: %w", i+1, err)
+			}
+			ba.PasswordHash = hash
+			ba.Password = ""
+		}
+		if ba.PasswordHash == "" {
+			return fmt.Errorf("rule %d: basic auth password is required for user %q", i+1, ba.Username)
+		}
+	}
+	return nil
+}
+
+// repointUpstream swaps oldPort for newPort when upstream targets the local
+// host (localhost, 127.0.0.1, or [::1]) on oldPort, and returns it unchanged
+// otherwise.
+func repointUpstream(upstream string, oldPort, newPort int) string {
+	scheme := ""
+	hostPort := upstream
+	for _, p := range []string{"http://", "https://"} {
+		if strings.HasPrefix(upstream, p) {
+			scheme, hostPort = p, strings.TrimPrefix(upstream, p)
+			break
+		}
+	}
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil || port != strconv.Itoa(oldPort) {
+		return upstream
+	}
+	switch host {
+	case "localhost", "127.0.0.1", "::1":
+		return scheme + net.JoinHostPort(host, strconv.Itoa(newPort))
+	}
+	return upstream
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"ezweb/internal/auth"
+)
+
+func TestRoutingConfigCloneFor(t *testing.T) {
+	orig := &RoutingConfig{
+		RedirectDomains: []string{"www.example.com"},
+		TLSCertPath:     "/etc/ssl/example.pem",
+		TLSKeyPath:      "/etc/ssl/example.key",
+		Rules: []RoutingRule{
+			{PathPrefix: "/api", Upstream: "localhost:8080", Headers: map[string]string{"X-A": "1"}},
+			{Upstream: "http://127.0.0.1:8080", CORS: &CORSConfig{Origins: []string{"https://example.com"}}},
+			{Upstream: "localhost:9000"},
+			{Upstream: "10.0.0.5:8080"},
+		},
+	}
+
+	clone := orig.CloneFor(8080, 8095)
+
+	if len(clone.RedirectDomains) != 0 || clone.TLSCertPath != "" || clone.TLSKeyPath != "" {
+		t.Errorf("clone kept domain-specific settings: %+v", clone)
+	}
+	want := []string{"localhost:8095", "http://127.0.0.1:8095", "localhost:9000", "10.0.0.5:8080"}
+	for i, w := range want {
+		if got := clone.Rules[i].Upstream; got != w {
+			t.Errorf("rule %d upstream = %q, want %q", i, got, w)
+		}
+	}
+
+	clone.Rules[0].Headers["X-A"] = "2"
+	clone.Rules[1].CORS.Origins[0] = "changed"
+	if orig.Rules[0].Headers["X-A"] != "1" || orig.Rules[1].CORS.Origins[0] != "https://example.com" {
+		t.Error("modifying the clone changed the original")
+	}
+}
+
+func TestRoutingConfigHashBasicAuth(t *testing.T) {
+	rc := &RoutingConfig{Rules: []RoutingRule{
+		{PathPrefix: "/admin", Upstream: "localhost:8080", BasicAuth: &BasicAuth{Username: "ops", Password: "s3cret-pass"}},
+		{Upstream: "localhost:8080", BasicAuth: &BasicAuth{}},
+	}}
+	if err := rc.HashBasicAuth(); err != nil {
+		t.Fatalf("HashBasicAuth: %v", err)
+	}
+	ba := rc.Rules[0].BasicAuth
+	if ba.Password != "" {
+		t.Error("plaintext password was not cleared")
+	}
+	if !auth.CheckPassword(ba.PasswordHash, "s3cret-pass") {
+		t.Errorf("stored hash %q does not match the password", ba.PasswordHash)
+	}
+	if rc.Rules[1].BasicAuth != nil {
+		t.Error("empty basic auth should be dropped")
+	}
+
+	for _, bad := range []*BasicAuth{
+		{Password: "s3cret-pass"},
+		{Username: " ", PasswordHash: ba.PasswordHash},
+		{Username: "ops"},
+	} {
+		rc := &RoutingConfig{Rules: []RoutingRule{{Upstream: "localhost:8080", BasicAuth: bad}}}
+		err := rc.HashBasicAuth()
+		if err == nil {
+			t.Errorf("HashBasicAuth(%+v) should fail", bad)
+		} else if strings.Contains(err.Error(), "s3cret") {
+			t.Errorf("error leaks the password: %v", err)
+		}
+	}
+}
+
+func TestRoutingConfigValidateProxyModes(t *testing.T) {
+	for _, tc := range []struct {
+		rc *RoutingConfig
+		ok bool
+	}{
+		{nil, true},
+		{&RoutingConfig{WebSocket: true, HTTPOnly: true}, true},
+		{&RoutingConfig{GRPC: true}, true},
+		{&RoutingConfig{GRPC: true, HTTPOnly: true}, false},
+		{&RoutingConfig{GRPC: true, WebSocket: true}, false},
+		{&RoutingConfig{Rules: []RoutingRule{{Upstream: "localhost:9000", GRPC: true}}}, true},
+		{&RoutingConfig{Rules: []RoutingRule{{Upstream: "https://api.internal:9000", GRPC: true}}}, false},
+		{&RoutingConfig{HTTPOnly: true, Rules: []RoutingRule{{Upstream: "localhost:9000", GRPC: true}}}, false},
+	} {
+		if err := tc.rc.ValidateProxyModes(); (err == nil) != tc.ok {
+			t.Errorf("ValidateProxyModes(%+v) = %v, want ok=%v", tc.rc, err, tc.ok)
+		}
+	}
+}
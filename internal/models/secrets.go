@@ -0,0 +1,209 @@
+package models
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// encryptedPrefix marks a column value as AES-GCM ciphertext. Values without
+// it are plaintext from before encryption was enabled and are read as-is.
+const encryptedPrefix = "enc:v1:"
+
+var (
+	fieldCipherMu sync.RWMutex
+	fieldCipher   cipher.AEAD
+)
+
+// SetEncryptionKey enables at-rest encryption of sensitive columns. The key
+// may be any string; it is stretched to a 256-bit AES key with SHA-256. Call
+// it once at startup before any server rows are read or written.
+func SetEncryptionKey(key string) error {
+	if key == "" {
+		return errors.New("encryption key is empty")
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return fmt.Errorf("failed to create GCM: %w", err)
+	}
+	fieldCipherMu.Lock()
+	fieldCipher = gcm
+	fieldCipherMu.Unlock()
+	return nil
+}
+
+func currentCipher() cipher.AEAD {
+	fieldCipherMu.RLock()
+	defer fieldCipherMu.RUnlock()
+	return fieldCipher
+}
+
+// encryptField encrypts a column value. The column name is bound as
+// additional data so a ciphertext cannot be copied into a different column.
+// Without a configured key, or for empty values, the input is returned as-is.
+func encryptField(column, plain string) (string, error) {
+	gcm := currentCipher()
+	if gcm == nil || plain == "" || strings.HasPrefix(plain, encryptedPrefix) {
+		return plain, nil
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), []byte(column))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField reverses encryptField. Plaintext values (no prefix) pass
+// through unchanged so databases created before encryption keep working.
+func decryptField(column, stored string) (string, error) {
+	if !strings.HasPrefix(stored, encryptedPrefix) {
+		return stored, nil
+	}
+	gcm := currentCipher()
+	if gcm == nil {
+		return "", fmt.Errorf("%s is encrypted but ENCRYPTION_KEY is not set", column)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode %s: %w", column, err)
+	}
+	if len(raw) < gcm.NonceSize() {
+		return "", fmt.Errorf("failed to decrypt %s: ciphertext too short", column)
+	}
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plain, err := gcm.Open(nil, nonce, ciphertext, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s (wrong ENCRYPTION_KEY?): %w", column, err)
+	}
+	return string(plain), nil
+}
+
+// EncryptServerSecrets encrypts any plaintext ssh_key_path and ssh_host_key
+// values left over from before ENCRYPTION_KEY was set. Already-encrypted rows
+// are skipped, so it is safe to call on every startup. It returns the number
+// of rows rewritten.
+func EncryptServerSecrets(db *sql.DB) (int, error) {
+	if currentCipher() == nil {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, COALESCE(ssh_key_path,''), COALESCE(ssh_host_key,'') FROM servers")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query servers: %w", err)
+	}
+	type secretRow struct {
+		id               int
+		keyPath, hostKey string
+	}
+	var pending []secretRow
+	for rows.Next() {
+		var r secretRow
+		if err := rows.Scan(&r.id, &r.keyPath, &r.hostKey); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan server row: %w", err)
+		}
+		if needsEncryption(r.keyPath) || needsEncryption(r.hostKey) {
+			pending = append(pending, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("server row iteration error: %w", err)
+	}
+
+	for _, r := range pending {
+		keyPath, err := encryptField("ssh_key_path", r.keyPath)
+		if err != nil {
+			return 0, err
+		}
+		hostKey, err := encryptField("ssh_host_key", r.hostKey)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(
+			"UPDATE servers SET ssh_key_path = ?, ssh_host_key = NULLIF(?, '') WHERE id = ?",
+			keyPath, hostKey, r.id,
+		); err != nil {
+			return 0, fmt.Errorf("failed to encrypt secrets for server %d: %w", r.id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit server secret encryption: %w", err)
+	}
+	return len(pending), nil
+}
+
+// EncryptEnvVarSecrets encrypts the values of secret env vars stored in
+// plaintext before ENCRYPTION_KEY was set. Like EncryptServerSecrets it is
+// safe to call on every startup, and returns the number of rows rewritten.
+func EncryptEnvVarSecrets(db *sql.DB) (int, error) {
+	if currentCipher() == nil {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, value FROM site_env_vars WHERE is_secret = 1")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query env vars: %w", err)
+	}
+	pending := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var value string
+		if err := rows.Scan(&id, &value); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan env var row: %w", err)
+		}
+		if needsEncryption(value) {
+			pending[id] = value
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("env var row iteration error: %w", err)
+	}
+
+	for id, value := range pending {
+		enc, err := encryptField(envSecretColumn, value)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec("UPDATE site_env_vars SET value = ? WHERE id = ?", enc, id); err != nil {
+			return 0, fmt.Errorf("failed to encrypt env var %d: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit env var encryption: %w", err)
+	}
+	return len(pending), nil
+}
+
+func needsEncryption(v string) bool {
+	return v != "" && !strings.HasPrefix(v, encryptedPrefix)
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func withEncryptionKey(t *testing.T, key string) {
+	t.Helper()
+	if err := SetEncryptionKey(key); err != nil {
+		t.Fatalf("SetEncryptionKey: %v", err)
+	}
+	t.Cleanup(func() {
+		fieldCipherMu.Lock()
+		fieldCipher = nil
+		fieldCipherMu.Unlock()
+	})
+}
+
+func TestEncryptField_RoundTrip(t *testing.T) {
+	withEncryptionKey(t, "test-key-that-is-long-enough-for-prod")
+
+	enc, err := encryptField("ssh_host_key", "ssh-ed25519 AAAAC3Nza")
+	if err != nil {
+		t.Fatalf("encryptField: %v", err)
+	}
+	if !strings.HasPrefix(enc, encryptedPrefix) || strings.Contains(enc, "AAAAC3Nza") {
+		t.Fatalf("encryptField returned %q, want opaque ciphertext", enc)
+	}
+
+	dec, err := decryptField("ssh_host_key", enc)
+	if err != nil {
+		t.Fatalf("decryptField: %v", err)
+	}
+	if dec != "ssh-ed25519 AAAAC3Nza" {
+		t.Errorf("decryptField = %q, want original value", dec)
+	}
+
+	if _, err := decryptField("ssh_key_path", enc); err == nil {
+		t.Error("ciphertext moved to another column should fail to decrypt")
+	}
+}
+
+func TestDecryptField_PlaintextPassesThrough(t *testing.T) {
+	got, err := decryptField("ssh_key_path", "/root/.ssh/id_ed25519")
+	if err != nil || got != "/root/.ssh/id_ed25519" {
+		t.Errorf("decryptField(plaintext) = %q, %v; want value unchanged", got, err)
+	}
+}
+
+func TestDecryptField_EncryptedWithoutKey(t *testing.T) {
+	withEncryptionKey(t, "test-key-that-is-long-enough-for-prod")
+	enc, err := encryptField("ssh_key_path", "/root/.ssh/id_ed25519")
+	if err != nil {
+		t.Fatalf("encryptField: %v", err)
+	}
+
+	fieldCipherMu.Lock()
+	fieldCipher = nil
+	fieldCipherMu.Unlock()
+
+	if _, err := decryptField("ssh_key_path", enc); err == nil {
+		t.Error("decrypting without a key should return an error")
+	}
+}
@@ -3,7 +3,12 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
+
+	"ezweb/internal/docker"
 )
 
 type Server struct {
@@ -14,15 +19,45 @@ type Server struct {
 	SSHUser    string
 	SSHKeyPath string
 	SSHHostKey string
+	DeployPath string // remote compose base directory; empty means /opt/ezweb
+	DeployMode string // "compose" or "swarm", see docker.DeployModeSwarm
+	UseSudo    bool   // run docker through sudo -n; the SSH user is not in the docker group
+	Tags       string // normalized comma-separated set, see NormalizeServerTags
 	Status     string
 	CreatedAt  time.Time
 	UpdatedAt  time.Time
 }
 
+const serverColumns = "id, name, host, ssh_port, ssh_user, ssh_key_path, COALESCE(ssh_host_key,''), COALESCE(deploy_path,''), COALESCE(deploy_mode,'compose'), COALESCE(docker_sudo,0), COALESCE(tags,''), status, created_at, updated_at"
+
+func scanServer(row interface{ Scan(...any) error }, s *Server) error {
+	return row.Scan(&s.ID, &s.Name, &s.Host, &s.SSHPort, &s.SSHUser, &s.SSHKeyPath, &s.SSHHostKey, &s.DeployPath, &s.DeployMode, &s.UseSudo, &s.Tags, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+}
+
+// DockerRemote returns how docker commands are run on the server.
+func (s Server) DockerRemote() docker.Remote {
+	return docker.Remote{Mode: s.DeployMode, Sudo: s.UseSudo}
+}
+
 func GetAllServers(db *sql.DB) ([]Server, error) {
-	rows, err := db.Query(
-		"SELECT id, name, host, ssh_port, ssh_user, ssh_key_path, COALESCE(ssh_host_key,''), status, created_at, updated_at FROM servers ORDER BY created_at DESC",
+	return queryServers(db, "SELECT "+serverColumns+" FROM servers ORDER BY created_at DESC")
+}
+
+// GetServersByTag returns the servers carrying tag. The tag is normalized
+// first, so "Prod" matches servers tagged "prod".
+func GetServersByTag(db *sql.DB, tag string) ([]Server, error) {
+	tag, err := NormalizeServerTags(tag)
+	if err != nil || tag == "" || strings.Contains(tag, ",") {
+		return nil, fmt.Errorf("invalid tag filter %q", tag)
+	}
+	return queryServers(db,
+		"SELECT "+serverColumns+" FROM servers WHERE instr(',' || COALESCE(tags,'') || ',', ?) > 0 ORDER BY created_at DESC",
+		","+tag+",",
 	)
+}
+
+func queryServers(db *sql.DB, query string, args ...any) ([]Server, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query servers: %w", err)
 	}
@@ -31,9 +66,12 @@ func GetAllServers(db *sql.DB) ([]Server, error) {
 	var servers []Server
 	for rows.Next() {
 		var s Server
-		if err := rows.Scan(&s.ID, &s.Name, &s.Host, &s.SSHPort, &s.SSHUser, &s.SSHKeyPath, &s.SSHHostKey, &s.Status, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		if err := scanServer(rows, &s); err != nil {
 			return nil, fmt.Errorf("failed to scan server row: %w", err)
 		}
+		if err := decryptServerSecrets(&s); err != nil {
+			return nil, err
+		}
 		servers = append(servers, s)
 	}
 	return servers, rows.Err()
@@ -41,20 +79,40 @@ func GetAllServers(db *sql.DB) ([]Server, error) {
 
 func GetServerByID(db *sql.DB, id int) (*Server, error) {
 	s := &Server{}
-	err := db.QueryRow(
-		"SELECT id, name, host, ssh_port, ssh_user, ssh_key_path, COALESCE(ssh_host_key,''), status, created_at, updated_at FROM servers WHERE id = ?",
-		id,
-	).Scan(&s.ID, &s.Name, &s.Host, &s.SSHPort, &s.SSHUser, &s.SSHKeyPath, &s.SSHHostKey, &s.Status, &s.CreatedAt, &s.UpdatedAt)
+	err := scanServer(db.QueryRow("SELECT "+serverColumns+" FROM servers WHERE id = ?", id), s)
 	if err != nil {
 		return nil, fmt.Errorf("server not found: %w", err)
 	}
+	if err := decryptServerSecrets(s); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
+// decryptServerSecrets decrypts the sensitive columns of a freshly scanned
+// server in place. See SetEncryptionKey.
+func decryptServerSecrets(s *Server) error {
+	keyPath, err := decryptField("ssh_key_path", s.SSHKeyPath)
+	if err != nil {
+		return fmt.Errorf("server %d: %w", s.ID, err)
+	}
+	hostKey, err := decryptField("ssh_host_key", s.SSHHostKey)
+	if err != nil {
+		return fmt.Errorf("server %d: %w", s.ID, err)
+	}
+	s.SSHKeyPath = keyPath
+	s.SSHHostKey = hostKey
+	return nil
+}
+
 func CreateServer(db *sql.DB, s *Server) error {
+	keyPath, err := encryptField("ssh_key_path", s.SSHKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt ssh key path: %w", err)
+	}
 	result, err := db.Exec(
-		"INSERT INTO servers (name, host, ssh_port, ssh_user, ssh_key_path, status) VALUES (?, ?, ?, ?, ?, ?)",
-		s.Name, s.Host, s.SSHPort, s.SSHUser, s.SSHKeyPath, s.Status,
+		"INSERT INTO servers (name, host, ssh_port, ssh_user, ssh_key_path, deploy_path, deploy_mode, docker_sudo, tags, status) VALUES (?, ?, ?, ?, ?, NULLIF(?, ''), COALESCE(NULLIF(?, ''), 'compose'), ?, ?, ?)",
+		s.Name, s.Host, s.SSHPort, s.SSHUser, keyPath, s.DeployPath, s.DeployMode, s.UseSudo, s.Tags, s.Status,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create server: %w", err)
@@ -68,9 +126,13 @@ func CreateServer(db *sql.DB, s *Server) error {
 }
 
 func UpdateServer(db *sql.DB, s *Server) error {
-	_, err := db.Exec(
-		"UPDATE servers SET name = ?, host = ?, ssh_port = ?, ssh_user = ?, ssh_key_path = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		s.Name, s.Host, s.SSHPort, s.SSHUser, s.SSHKeyPath, s.ID,
+	keyPath, err := encryptField("ssh_key_path", s.SSHKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt ssh key path: %w", err)
+	}
+	_, err = db.Exec(
+		"UPDATE servers SET name = ?, host = ?, ssh_port = ?, ssh_user = ?, ssh_key_path = ?, deploy_path = NULLIF(?, ''), deploy_mode = COALESCE(NULLIF(?, ''), 'compose'), docker_sudo = ?, tags = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		s.Name, s.Host, s.SSHPort, s.SSHUser, keyPath, s.DeployPath, s.DeployMode, s.UseSudo, s.Tags, s.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update server: %w", err)
@@ -78,6 +140,16 @@ func UpdateServer(db *sql.DB, s *Server) error {
 	return nil
 }
 
+// ServerHasSites reports whether any site, including one in the trash, is
+// assigned to server id.
+func ServerHasSites(db *sql.DB, id int) (bool, error) {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sites WHERE server_id = ?", id).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to count server sites: %w", err)
+	}
+	return n > 0, nil
+}
+
 func DeleteServer(db *sql.DB, id int) error {
 	_, err := db.Exec("DELETE FROM servers WHERE id = ?", id)
 	if err != nil {
@@ -87,9 +159,13 @@ func DeleteServer(db *sql.DB, id int) error {
 }
 
 func UpdateServerHostKey(db *sql.DB, id int, hostKey string) error {
-	_, err := db.Exec(
+	stored, err := encryptField("ssh_host_key", hostKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt server host key: %w", err)
+	}
+	_, err = db.Exec(
 		"UPDATE servers SET ssh_host_key = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		hostKey, id,
+		stored, id,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update server host key: %w", err)
@@ -116,3 +192,90 @@ func CountServers(db *sql.DB) (int, error) {
 	}
 	return count, nil
 }
+
+// ServerStatusCounts summarises server reachability. Servers whose status is
+// neither online/active nor offline (e.g. never probed) count as unknown.
+type ServerStatusCounts struct {
+	Total   int
+	Online  int
+	Offline int
+	Unknown int
+}
+
+// CountServersByStatus aggregates server statuses in a single query.
+func CountServersByStatus(db *sql.DB) (ServerStatusCounts, error) {
+	var c ServerStatusCounts
+	err := db.QueryRow(`SELECT
+		COUNT(*),
+		COALESCE(SUM(CASE WHEN status IN ('online','active') THEN 1 ELSE 0 END),0),
+		COALESCE(SUM(CASE WHEN status = 'offline' THEN 1 ELSE 0 END),0),
+		COALESCE(SUM(CASE WHEN status NOT IN ('online','active','offline') THEN 1 ELSE 0 END),0)
+		FROM servers`).Scan(&c.Total, &c.Online, &c.Offline, &c.Unknown)
+	if err != nil {
+		return c, fmt.Errorf("failed to count servers by status: %w", err)
+	}
+	return c, nil
+}
+
+// maxServerTags caps how many tags one server can carry.
+const maxServerTags = 10
+
+var serverTagRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// NormalizeServerTags turns user input such as " Prod, us-east,prod " into the
+// stored form "prod,us-east": tags are trimmed, lowercased, de-duplicated and
+// sorted. Each tag must be 1-32 characters of letters, digits, '-' or '_'.
+func NormalizeServerTags(raw string) (string, error) {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, t := range strings.Split(raw, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		if !serverTagRe.MatchString(t) {
+			return "", fmt.Errorf("invalid tag %q: use letters, digits, '-' or '_' (max 32 characters)", t)
+		}
+		seen[t] = true
+		tags = append(tags, t)
+	}
+	if len(tags) > maxServerTags {
+		return "", fmt.Errorf("a server can have at most %d tags", maxServerTags)
+	}
+	sort.Strings(tags)
+	return strings.Join(tags, ","), nil
+}
+
+// TagList returns the server's tags as a slice.
+func (s Server) TagList() []string {
+	if s.Tags == "" {
+		return nil
+	}
+	return strings.Split(s.Tags, ",")
+}
+
+// GetAllServerTags returns every tag in use, sorted, for building filters.
+func GetAllServerTags(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT tags FROM servers WHERE COALESCE(tags,'') != ''")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query server tags: %w", err)
+	}
+	defer rows.Close()
+
+	seen := make(map[string]bool)
+	var tags []string
+	for rows.Next() {
+		var s Server
+		if err := rows.Scan(&s.Tags); err != nil {
+			return nil, fmt.Errorf("failed to scan server tags: %w", err)
+		}
+		for _, t := range s.TagList() {
+			if !seen[t] {
+				seen[t] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags, rows.Err()
+}
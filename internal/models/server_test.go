@@ -0,0 +1,134 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestNormalizeServerTags(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{" Prod, us-east ,prod,, ", "prod,us-east", false},
+		{"staging,eu_west", "eu_west,staging", false},
+		{"prod env", "", true},
+		{"-prod", "", true},
+		{strings.Repeat("a", 33), "", true},
+		{"a,b,c,d,e,f,g,h,i,j,k", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeServerTags(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("NormalizeServerTags(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestGetServersByTag(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	for _, s := range []*Server{
+		{Name: "web1", Host: "10.0.0.1", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k", Tags: "prod,us-east"},
+		{Name: "web2", Host: "10.0.0.2", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k", Tags: "prod-eu"},
+		{Name: "stage", Host: "10.0.0.3", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k", Tags: "staging"},
+	} {
+		if err := CreateServer(database, s); err != nil {
+			t.Fatalf("CreateServer(%s): %v", s.Name, err)
+		}
+	}
+
+	servers, err := GetServersByTag(database, "PROD")
+	if err != nil {
+		t.Fatalf("GetServersByTag: %v", err)
+	}
+	if len(servers) != 1 || servers[0].Name != "web1" {
+		t.Errorf("GetServersByTag(prod) = %v; want only web1", servers)
+	}
+	if _, err := GetServersByTag(database, "prod,staging"); err == nil {
+		t.Error("filtering by more than one tag should fail")
+	}
+
+	tags, err := GetAllServerTags(database)
+	if err != nil {
+		t.Fatalf("GetAllServerTags: %v", err)
+	}
+	if got := strings.Join(tags, ","); got != "prod,prod-eu,staging,us-east" {
+		t.Errorf("GetAllServerTags = %q", got)
+	}
+}
+
+func TestServerDeployMode(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	s := &Server{Name: "web1", Host: "10.0.0.1", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k"}
+	if err := CreateServer(database, s); err != nil {
+		t.Fatalf("CreateServer: %v", err)
+	}
+	got, err := GetServerByID(database, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DeployMode != "compose" {
+		t.Errorf("default DeployMode = %q, want compose", got.DeployMode)
+	}
+
+	s.DeployMode = "swarm"
+	if err := UpdateServer(database, s); err != nil {
+		t.Fatalf("UpdateServer: %v", err)
+	}
+	if got, _ := GetServerByID(database, s.ID); got == nil || got.DeployMode != "swarm" {
+		t.Errorf("DeployMode after update = %+v", got)
+	}
+
+	if has, err := ServerHasSites(database, s.ID); err != nil || has {
+		t.Errorf("ServerHasSites = %v, %v; want false", has, err)
+	}
+	if _, err := database.Exec("INSERT INTO sites (domain, server_id, deleted_at) VALUES ('a.example.com', ?, CURRENT_TIMESTAMP)", s.ID); err != nil {
+		t.Fatal(err)
+	}
+	if has, err := ServerHasSites(database, s.ID); err != nil || !has {
+		t.Errorf("ServerHasSites with a trashed site = %v, %v; want true", has, err)
+	}
+}
+
+func TestServerUseSudo(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	s := &Server{Name: "web1", Host: "10.0.0.1", SSHPort: 22, SSHUser: "deploy", SSHKeyPath: "/k", UseSudo: true}
+	if err := CreateServer(database, s); err != nil {
+		t.Fatalf("CreateServer: %v", err)
+	}
+	got, err := GetServerByID(database, s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.UseSudo || got.DockerRemote().Docker() != "sudo -n docker" {
+		t.Errorf("UseSudo = %v, docker = %q; want sudo", got.UseSudo, got.DockerRemote().Docker())
+	}
+
+	s.UseSudo = false
+	if err := UpdateServer(database, s); err != nil {
+		t.Fatalf("UpdateServer: %v", err)
+	}
+	if got, _ := GetServerByID(database, s.ID); got == nil || got.UseSudo {
+		t.Errorf("UseSudo after update = %+v", got)
+	}
+}
@@ -3,9 +3,12 @@ package models
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
+
+	"ezweb/internal/docker"
 )
 
 type Site struct {
@@ -22,17 +25,146 @@ type Site struct {
 	ComposePath   string
 	RoutingConfig *RoutingConfig
 	SSLExpiry     sql.NullTime
+	// DeployTimeoutSec overrides the default deploy timeout; 0 means use the
+	// default (see DeployTimeout).
+	DeployTimeoutSec int
+	// LastDeployedAt is set on each successful deploy; it is NULL for a
+	// site that has never been deployed.
+	LastDeployedAt sql.NullTime
+	// HealthCheckMethod is the HTTP method used by the health checker; empty
+	// means GET. HealthCheckExpect, when set, must appear in the response
+	// body for the site to count as up.
+	HealthCheckMethod string
+	HealthCheckExpect string
+	// HealthCheckInsecure skips TLS certificate verification, for sites
+	// with self-signed certificates. HealthCheckNoRedirect reports the
+	// first response instead of following redirects, and counts a 3xx as
+	// down.
+	HealthCheckInsecure   bool
+	HealthCheckNoRedirect bool
+	// Maintenance makes Caddy serve a 503 maintenance page instead of
+	// proxying to the site, and suppresses health alerts.
+	Maintenance   bool
+	// QuietHours lists daily HH:MM-HH:MM windows (see ParseQuietHours) in
+	// which checks still run but down alerts are held back. QuietHoursTZ is
+	// the IANA zone they are read in; empty means the server's local time.
+	QuietHours   string
+	QuietHoursTZ string
+	// ContainerImage is the image reference (e.g. nginx:1.27) of the site's
+	// primary container, as last seen running by the health checker. It is
+	// empty when the container was not found or not running.
+	ContainerImage string
+	// Drained is set while a server drain has the site stopped, so resuming
+	// the server starts only the sites the drain stopped: DrainStopped, or
+	// DrainMaintenance when the drain also put the site in maintenance mode.
+	Drained string
+	// ComposeServices is a comma-separated list of the compose services the
+	// health checker expects to be running (see ExpectedServices). Empty
+	// means only the site's own container is checked.
+	ComposeServices string
+	// GitURL, when set, makes the site deploy from a git repository: each
+	// deploy checks out the latest commit of GitBranch in the site directory
+	// and brings up the compose file there instead of rendering the
+	// template. GitKeyPath is a deploy key on this host for a private
+	// repository; it is encrypted at rest like a server's SSH key path.
+	GitURL     string
+	GitBranch  string
+	GitKeyPath string
+	// AutoPort marks Port as picked by NextAvailablePort rather than by the
+	// user, so CreateSite may move the site to another free port if a
+	// concurrent creation takes it first. It is not stored.
+	AutoPort bool
+	// DeletedAt is set when the site is moved to the trash; trashed sites
+	// are hidden from every lookup except the trash queries below.
+	DeletedAt     sql.NullTime
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 
 	// Joined fields (not stored in DB)
 	ServerName   string
+	ServerHost   string
 	CustomerName string
 }
 
+// Deploy timeout bounds, in seconds. Per-site overrides outside this range
+// are rejected by the handlers.
+const (
+	MinDeployTimeoutSec = 30
+	MaxDeployTimeoutSec = 3600
+)
+
+// HTTP methods a site's health check may use, and the longest expected-body
+// substring accepted.
+var HealthCheckMethods = []string{"GET", "HEAD"}
+
+const MaxHealthCheckExpectLen = 200
+
+// ImageLabel returns ContainerImage, or "unknown" when it is not known.
+func (s *Site) ImageLabel() string {
+	if s.ContainerImage == "" {
+		return "unknown"
+	}
+	return s.ContainerImage
+}
+
+// ExpectedServices returns the compose services the site declares.
+func (s *Site) ExpectedServices() []string {
+	return SplitComposeServices(s.ComposeServices)
+}
+
+// IsGit reports whether the site is deployed from a git repository.
+func (s *Site) IsGit() bool {
+	return s.GitURL != ""
+}
+
+// GitSource returns the repository the site deploys from, or nil when it
+// deploys from its template.
+func (s *Site) GitSource() *docker.GitSource {
+	if !s.IsGit() {
+		return nil
+	}
+	return &docker.GitSource{URL: s.GitURL, Branch: s.GitBranch, KeyPath: s.GitKeyPath}
+}
+
+// GitBranchLabel returns GitBranch, or the branch deployed when it is empty.
+func (s *Site) GitBranchLabel() string {
+	return docker.GitSource{Branch: s.GitBranch}.BranchName()
+}
+
+// HealthCheckHTTPMethod returns the method the health checker should use.
+func (s *Site) HealthCheckHTTPMethod() string {
+	if s.HealthCheckMethod == "" {
+		return "GET"
+	}
+	return s.HealthCheckMethod
+}
+
+// Default deploy timeouts used when a site has no override. A site that has
+// never been deployed gets a longer allowance because its first compose up
+// usually has to pull every image from scratch.
+const (
+	DefaultLocalDeployTimeout  = 2 * time.Minute
+	DefaultRemoteDeployTimeout = 5 * time.Minute
+	DefaultFirstDeployTimeout  = 15 * time.Minute
+)
+
+// DeployTimeout returns how long a deploy of this site may run.
+func (s *Site) DeployTimeout() time.Duration {
+	if s.DeployTimeoutSec > 0 {
+		return time.Duration(s.DeployTimeoutSec) * time.Second
+	}
+	if s.Status == "pending" {
+		return DefaultFirstDeployTimeout
+	}
+	if s.IsLocal {
+		return DefaultLocalDeployTimeout
+	}
+	return DefaultRemoteDeployTimeout
+}
+
 // routingConfigJSON returns the JSON string for DB storage, or empty string if nil.
 func (s *Site) routingConfigJSON() string {
-	if s.RoutingConfig == nil || len(s.RoutingConfig.Rules) == 0 {
+	if !s.RoutingConfig.worthStoring() {
 		return ""
 	}
 	b, err := json.Marshal(s.RoutingConfig)
@@ -51,7 +183,7 @@ func parseRoutingConfig(raw string) *RoutingConfig {
 	if err := json.Unmarshal([]byte(raw), &rc); err != nil {
 		return nil
 	}
-	if len(rc.Rules) == 0 {
+	if !rc.worthStoring() {
 		return nil
 	}
 	return &rc
@@ -61,35 +193,58 @@ const siteSelectColumns = `
 	s.id, s.domain, s.server_id, COALESCE(s.template_slug,''), s.customer_id,
 	COALESCE(s.container_name,''), COALESCE(s.port,0), COALESCE(s.status,'pending'),
 	COALESCE(s.ssl_enabled,0), COALESCE(s.is_local,0), COALESCE(s.compose_path,''),
-	COALESCE(s.routing_config,''), s.ssl_expiry, s.created_at, s.updated_at,
-	COALESCE(srv.name,''), COALESCE(c.name,'')`
+	COALESCE(s.routing_config,''), s.ssl_expiry, COALESCE(s.deploy_timeout_sec,0), s.last_deployed_at,
+	COALESCE(s.health_check_method,''), COALESCE(s.health_check_expect,''), COALESCE(s.maintenance,0), COALESCE(s.quiet_hours,''), COALESCE(s.quiet_hours_tz,''),
+	COALESCE(s.health_check_insecure,0), COALESCE(s.health_check_no_redirect,0), COALESCE(s.container_image,''), COALESCE(s.drained,''), COALESCE(s.compose_services,''),
+	COALESCE(s.git_url,''), COALESCE(s.git_branch,''), COALESCE(s.git_key_path,''),
+	s.deleted_at, s.created_at, s.updated_at,
+	COALESCE(srv.name,''), COALESCE(srv.host,''), COALESCE(c.name,'')`
 
 const siteFromJoins = `
 	FROM sites s
 	LEFT JOIN servers srv ON s.server_id = srv.id
 	LEFT JOIN customers c ON s.customer_id = c.id`
 
+// siteNotTrashed restricts a query on sites s to live (non-trashed) rows.
+const siteNotTrashed = ` s.deleted_at IS NULL`
+
 func scanSite(scanner interface{ Scan(dest ...interface{}) error }) (*Site, error) {
 	var s Site
-	var sslInt, localInt int
+	var sslInt, localInt, maintInt, insecureInt, noRedirectInt int
 	var routingRaw string
 	if err := scanner.Scan(
 		&s.ID, &s.Domain, &s.ServerID, &s.TemplateSlug, &s.CustomerID,
 		&s.ContainerName, &s.Port, &s.Status,
 		&sslInt, &localInt, &s.ComposePath,
-		&routingRaw, &s.SSLExpiry, &s.CreatedAt, &s.UpdatedAt,
-		&s.ServerName, &s.CustomerName,
+		&routingRaw, &s.SSLExpiry, &s.DeployTimeoutSec, &s.LastDeployedAt,
+		&s.HealthCheckMethod, &s.HealthCheckExpect, &maintInt, &s.QuietHours, &s.QuietHoursTZ,
+		&insecureInt, &noRedirectInt, &s.ContainerImage, &s.Drained, &s.ComposeServices,
+		&s.GitURL, &s.GitBranch, &s.GitKeyPath,
+		&s.DeletedAt, &s.CreatedAt, &s.UpdatedAt,
+		&s.ServerName, &s.ServerHost, &s.CustomerName,
 	); err != nil {
 		return nil, err
 	}
 	s.SSLEnabled = sslInt == 1
 	s.IsLocal = localInt == 1
+	s.Maintenance = maintInt == 1
+	s.HealthCheckInsecure = insecureInt == 1
+	s.HealthCheckNoRedirect = noRedirectInt == 1
 	s.RoutingConfig = parseRoutingConfig(routingRaw)
+	keyPath, err := decryptField("git_key_path", s.GitKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("site %d: %w", s.ID, err)
+	}
+	s.GitKeyPath = keyPath
+	// Older rows may carry a local offset; present every expiry in UTC.
+	if s.SSLExpiry.Valid {
+		s.SSLExpiry.Time = s.SSLExpiry.Time.UTC()
+	}
 	return &s, nil
 }
 
 func GetAllSites(db *sql.DB) ([]Site, error) {
-	rows, err := db.Query(`SELECT ` + siteSelectColumns + siteFromJoins + ` ORDER BY s.created_at DESC`)
+	rows, err := db.Query(`SELECT ` + siteSelectColumns + siteFromJoins + ` WHERE` + siteNotTrashed + ` ORDER BY s.created_at DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sites: %w", err)
 	}
@@ -107,7 +262,7 @@ func GetAllSites(db *sql.DB) ([]Site, error) {
 }
 
 func GetSiteByID(db *sql.DB, id int) (*Site, error) {
-	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.id = ?`, id)
+	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.id = ? AND`+siteNotTrashed, id)
 	s, err := scanSite(row)
 	if err != nil {
 		return nil, fmt.Errorf("site not found: %w", err)
@@ -117,7 +272,7 @@ func GetSiteByID(db *sql.DB, id int) (*Site, error) {
 
 func GetSitesByServerID(db *sql.DB, serverID int) ([]Site, error) {
 	rows, err := db.Query(
-		`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.server_id = ? ORDER BY s.created_at DESC`,
+		`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.server_id = ? AND`+siteNotTrashed+` ORDER BY s.created_at DESC`,
 		serverID,
 	)
 	if err != nil {
@@ -138,7 +293,7 @@ func GetSitesByServerID(db *sql.DB, serverID int) ([]Site, error) {
 
 func GetSitesByCustomerID(db *sql.DB, customerID int) ([]Site, error) {
 	rows, err := db.Query(
-		`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.customer_id = ? ORDER BY s.created_at DESC`,
+		`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.customer_id = ? AND`+siteNotTrashed+` ORDER BY s.created_at DESC`,
 		customerID,
 	)
 	if err != nil {
@@ -157,7 +312,47 @@ func GetSitesByCustomerID(db *sql.DB, customerID int) ([]Site, error) {
 	return sites, rows.Err()
 }
 
+// ErrPortTaken is returned by CreateSite when the site's port belongs to
+// another site.
+var ErrPortTaken = errors.New("port is already used by another site")
+
+// createSiteAttempts bounds how often CreateSite re-picks an AutoPort port
+// that was taken between NextAvailablePort and the INSERT.
+const createSiteAttempts = 5
+
+// CreateSite inserts s. NextAvailablePort cannot reserve the port it returns,
+// so two sites created at once can pick the same one; the UNIQUE index on
+// sites(port) rejects the second. For an AutoPort site the next free port is
+// picked instead, with routing rules that pointed at the old port following
+// it. Otherwise, or once the attempts run out, ErrPortTaken is returned.
 func CreateSite(db *sql.DB, s *Site) error {
+	for attempt := 1; ; attempt++ {
+		err := insertSite(db, s)
+		if err == nil || !isPortConflict(err) {
+			return err
+		}
+		if !s.AutoPort {
+			return fmt.Errorf("failed to create site on port %d: %w", s.Port, ErrPortTaken)
+		}
+		if attempt == createSiteAttempts {
+			return fmt.Errorf("failed to create site: every port picked in %d attempts was taken by a concurrent creation: %w", attempt, ErrPortTaken)
+		}
+		port, err := NextAvailablePort(db, s.IsLocal)
+		if err != nil {
+			return fmt.Errorf("failed to pick another port: %w", err)
+		}
+		s.RoutingConfig.repointPort(s.Port, port)
+		s.Port = port
+	}
+}
+
+// isPortConflict reports whether err is the UNIQUE index on sites(port)
+// rejecting an INSERT or UPDATE.
+func isPortConflict(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed: sites.port")
+}
+
+func insertSite(db *sql.DB, s *Site) error {
 	sslInt := 0
 	if s.SSLEnabled {
 		sslInt = 1
@@ -167,11 +362,22 @@ func CreateSite(db *sql.DB, s *Site) error {
 		localInt = 1
 	}
 
+	gitKeyPath, err := encryptField("git_key_path", s.GitKeyPath)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt git key path: %w", err)
+	}
+
 	result, err := db.Exec(
-		`INSERT INTO sites (domain, server_id, template_slug, customer_id, container_name, port, status, ssl_enabled, is_local, compose_path, routing_config)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO sites (domain, server_id, template_slug, customer_id, container_name, port, status, ssl_enabled, is_local, compose_path, routing_config, deploy_timeout_sec,
+		 health_check_method, health_check_expect, quiet_hours, quiet_hours_tz, health_check_insecure, health_check_no_redirect,
+		 compose_services, git_url, git_branch, git_key_path)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''), ?, ?, NULLIF(?, ''),
+		 NULLIF(?, ''), NULLIF(?, ''), NULLIF(?, ''))`,
 		s.Domain, s.ServerID, s.TemplateSlug, s.CustomerID,
 		s.ContainerName, s.Port, s.Status, sslInt, localInt, s.ComposePath, s.routingConfigJSON(),
+		s.DeployTimeoutSec, s.HealthCheckMethod, s.HealthCheckExpect, s.QuietHours, s.QuietHoursTZ,
+		s.HealthCheckInsecure, s.HealthCheckNoRedirect, s.ComposeServices,
+		s.GitURL, s.GitBranch, gitKeyPath,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create site: %w", err)
@@ -197,11 +403,16 @@ func UpdateSite(db *sql.DB, s *Site) error {
 	_, err := db.Exec(
 		`UPDATE sites SET domain = ?, server_id = ?, template_slug = ?, customer_id = ?,
 		 container_name = ?, port = ?, status = ?, ssl_enabled = ?, is_local = ?, compose_path = ?,
-		 routing_config = ?, updated_at = CURRENT_TIMESTAMP
+		 routing_config = ?, deploy_timeout_sec = NULLIF(?, 0),
+		 health_check_method = NULLIF(?, ''), health_check_expect = NULLIF(?, ''),
+		 quiet_hours = NULLIF(?, ''), quiet_hours_tz = NULLIF(?, ''),
+		 health_check_insecure = ?, health_check_no_redirect = ?, compose_services = NULLIF(?, ''),
+		 updated_at = CURRENT_TIMESTAMP
 		 WHERE id = ?`,
 		s.Domain, s.ServerID, s.TemplateSlug, s.CustomerID,
 		s.ContainerName, s.Port, s.Status, sslInt, localInt, s.ComposePath,
-		s.routingConfigJSON(), s.ID,
+		s.routingConfigJSON(), s.DeployTimeoutSec, s.HealthCheckMethod, s.HealthCheckExpect,
+		s.QuietHours, s.QuietHoursTZ, s.HealthCheckInsecure, s.HealthCheckNoRedirect, s.ComposeServices, s.ID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update site: %w", err)
@@ -209,6 +420,28 @@ func UpdateSite(db *sql.DB, s *Site) error {
 	return nil
 }
 
+// UpdateSiteGitSource sets the repository a site deploys from. An empty
+// URL clears the branch and deploy key too, so the site deploys from its
+// template again. UpdateSite leaves these columns alone.
+func UpdateSiteGitSource(db *sql.DB, id int, url, branch, keyPath string) error {
+	if url == "" {
+		branch, keyPath = "", ""
+	}
+	encKeyPath, err := encryptField("git_key_path", keyPath)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt git key path: %w", err)
+	}
+	_, err = db.Exec(
+		`UPDATE sites SET git_url = NULLIF(?, ''), git_branch = NULLIF(?, ''), git_key_path = NULLIF(?, ''),
+		 updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		url, branch, encKeyPath, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update site git source: %w", err)
+	}
+	return nil
+}
+
 func UpdateSiteStatus(db *sql.DB, id int, status string) error {
 	_, err := db.Exec(
 		"UPDATE sites SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
@@ -220,6 +453,148 @@ func UpdateSiteStatus(db *sql.DB, id int, status string) error {
 	return nil
 }
 
+// ReconcileSiteStatus sets a site's status to status if it is still from.
+// It reports whether the status changed, so a change made since from was
+// read (a deploy starting, the user stopping the site) is not overwritten.
+func ReconcileSiteStatus(db *sql.DB, id int, from, status string) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE sites SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		status, id, from,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reconcile site status: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// MarkSiteDeployed records a successful deploy: the site is set to running
+// and last_deployed_at to the current time.
+func MarkSiteDeployed(db *sql.DB, id int) error {
+	_, err := db.Exec(
+		"UPDATE sites SET status = 'running', last_deployed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark site %d deployed: %w", id, err)
+	}
+	return nil
+}
+
+// SetSiteMaintenance turns maintenance mode on or off for a site.
+func SetSiteMaintenance(db *sql.DB, id int, on bool) error {
+	v := 0
+	if on {
+		v = 1
+	}
+	_, err := db.Exec(
+		"UPDATE sites SET maintenance = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		v, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to set maintenance for site %d: %w", id, err)
+	}
+	return nil
+}
+
+// Drain states recorded in Site.Drained.
+const (
+	DrainStopped     = "stopped"
+	DrainMaintenance = "maintenance"
+)
+
+// MarkSiteDrained records that a server drain stopped the site. With
+// maintenance the site is also put in maintenance mode, which
+// ResumeDrainedSite turns off again.
+func MarkSiteDrained(db *sql.DB, id int, maintenance bool) error {
+	query := "UPDATE sites SET status = 'stopped', drained = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+	state := DrainStopped
+	if maintenance {
+		query = "UPDATE sites SET status = 'stopped', drained = ?, maintenance = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ?"
+		state = DrainMaintenance
+	}
+	if _, err := db.Exec(query, state, id); err != nil {
+		return fmt.Errorf("failed to mark site %d drained: %w", id, err)
+	}
+	return nil
+}
+
+// ResumeDrainedSite sets a drained site running again and clears its drain
+// state, along with the maintenance mode the drain turned on, if any.
+func ResumeDrainedSite(db *sql.DB, id int) error {
+	_, err := db.Exec(
+		`UPDATE sites SET status = 'running',
+		 maintenance = CASE WHEN drained = ? THEN 0 ELSE maintenance END,
+		 drained = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ?`,
+		DrainMaintenance, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to resume site %d: %w", id, err)
+	}
+	return nil
+}
+
+// TrashSite moves a site to the trash by setting deleted_at. Trashed sites
+// keep their row, port and container name until they are purged.
+func TrashSite(db *sql.DB, id int) error {
+	res, err := db.Exec(
+		"UPDATE sites SET deleted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NULL",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to trash site %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("site %d not found", id)
+	}
+	return nil
+}
+
+// RestoreTrashedSite clears deleted_at on a trashed site. It returns an error
+// if the site does not exist or is not in the trash.
+func RestoreTrashedSite(db *sql.DB, id int) error {
+	res, err := db.Exec(
+		"UPDATE sites SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND deleted_at IS NOT NULL",
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to restore site %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("site %d is not in the trash", id)
+	}
+	return nil
+}
+
+// GetTrashedSiteByID returns a site that is in the trash.
+func GetTrashedSiteByID(db *sql.DB, id int) (*Site, error) {
+	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.id = ? AND s.deleted_at IS NOT NULL`, id)
+	s, err := scanSite(row)
+	if err != nil {
+		return nil, fmt.Errorf("trashed site not found: %w", err)
+	}
+	return s, nil
+}
+
+// GetTrashedSites returns trashed sites, most recently deleted first.
+func GetTrashedSites(db *sql.DB) ([]Site, error) {
+	rows, err := db.Query(`SELECT ` + siteSelectColumns + siteFromJoins + ` WHERE s.deleted_at IS NOT NULL ORDER BY s.deleted_at DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query trashed sites: %w", err)
+	}
+	defer rows.Close()
+
+	var sites []Site
+	for rows.Next() {
+		s, err := scanSite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan site row: %w", err)
+		}
+		sites = append(sites, *s)
+	}
+	return sites, rows.Err()
+}
+
 func DeleteSite(db *sql.DB, id int) error {
 	_, err := db.Exec("DELETE FROM sites WHERE id = ?", id)
 	if err != nil {
@@ -230,15 +605,78 @@ func DeleteSite(db *sql.DB, id int) error {
 
 func CountSites(db *sql.DB) (int, error) {
 	var count int
-	err := db.QueryRow("SELECT COUNT(*) FROM sites").Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM sites WHERE deleted_at IS NULL").Scan(&count)
 	if err != nil {
 		return 0, fmt.Errorf("failed to count sites: %w", err)
 	}
 	return count, nil
 }
 
+// CountSitesByStatus returns the number of sites in each status along with
+// the overall total, using a single grouped query. A non-empty domainFilter
+// counts only sites whose domain contains it.
+func CountSitesByStatus(db *sql.DB, domainFilter string) (map[string]int, int, error) {
+	rows, err := db.Query("SELECT COALESCE(status,'pending'), COUNT(*) FROM sites WHERE deleted_at IS NULL AND (? = '' OR instr(domain, ?) > 0) GROUP BY 1", domainFilter, domainFilter)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count sites by status: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	total := 0
+	for rows.Next() {
+		var status string
+		var n int
+		if err := rows.Scan(&status, &n); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan site status count: %w", err)
+		}
+		counts[status] = n
+		total += n
+	}
+	return counts, total, rows.Err()
+}
+
+// CertExpiryWindowDays is how far ahead the dashboard and the
+// get_expiring_certs MCP tool look for certificates about to expire.
+const CertExpiryWindowDays = 30
+
+// GetSitesWithExpiringCerts returns SSL sites whose recorded certificate
+// expiry falls before now plus days, soonest first. Already expired
+// certificates are included; sites with no recorded expiry (never checked,
+// or not SSL) are not.
+func GetSitesWithExpiringCerts(db *sql.DB, days int) ([]Site, error) {
+	cutoff := time.Now().UTC().AddDate(0, 0, days)
+	rows, err := db.Query(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE`+siteNotTrashed+`
+		AND COALESCE(s.ssl_enabled,0) = 1 AND s.ssl_expiry IS NOT NULL AND s.ssl_expiry <= ?
+		ORDER BY s.ssl_expiry ASC`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expiring certificates: %w", err)
+	}
+	defer rows.Close()
+
+	var sites []Site
+	for rows.Next() {
+		s, err := scanSite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan site row: %w", err)
+		}
+		sites = append(sites, *s)
+	}
+	return sites, rows.Err()
+}
+
+// CertDaysLeft returns the whole days from now until the site's recorded
+// certificate expiry, negative once it has passed. It is 0 when no expiry is
+// recorded, so check SSLExpiry.Valid first.
+func (s *Site) CertDaysLeft() int {
+	if !s.SSLExpiry.Valid {
+		return 0
+	}
+	return int(time.Until(s.SSLExpiry.Time).Hours() / 24)
+}
+
 func GetSiteByDomain(db *sql.DB, domain string) (*Site, error) {
-	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.domain = ?`, domain)
+	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.domain = ? AND`+siteNotTrashed, domain)
 	s, err := scanSite(row)
 	if err != nil {
 		return nil, fmt.Errorf("site not found: %w", err)
@@ -246,6 +684,66 @@ func GetSiteByDomain(db *sql.DB, domain string) (*Site, error) {
 	return s, nil
 }
 
+// GetTrashedSiteByDomain returns the trashed site with the given domain.
+// Trashed sites keep their domain, so a new site cannot take it until the
+// trashed one is purged.
+func GetTrashedSiteByDomain(db *sql.DB, domain string) (*Site, error) {
+	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.domain = ? AND s.deleted_at IS NOT NULL`, domain)
+	s, err := scanSite(row)
+	if err != nil {
+		return nil, fmt.Errorf("trashed site not found: %w", err)
+	}
+	return s, nil
+}
+
+// ContainerNameTaken reports whether a site other than excludeID already uses
+// containerName. Pass excludeID 0 when creating a site.
+func ContainerNameTaken(db *sql.DB, containerName string, excludeID int) (bool, error) {
+	var n int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM sites WHERE container_name = ? AND id != ?",
+		containerName, excludeID,
+	).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check container name: %w", err)
+	}
+	return n > 0, nil
+}
+
+// FreeContainerName returns base, or base with the smallest numeric suffix
+// ("-2", "-3", ...) that no other site uses.
+func FreeContainerName(db *sql.DB, base string) (string, error) {
+	name := base
+	for i := 2; i <= 100; i++ {
+		taken, err := ContainerNameTaken(db, name, 0)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+	return "", fmt.Errorf("no free container name for %s", base)
+}
+
+// GetImportedSite returns the site already created from the compose project
+// at composePath on server serverID, or on this host when serverID is 0.
+// Trashed sites are included, since they still own the project.
+func GetImportedSite(db *sql.DB, serverID int, composePath string) (*Site, error) {
+	var row *sql.Row
+	if serverID == 0 {
+		row = db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.compose_path = ? AND s.is_local = 1`, composePath)
+	} else {
+		row = db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.compose_path = ? AND s.server_id = ?`, composePath, serverID)
+	}
+	s, err := scanSite(row)
+	if err != nil {
+		return nil, fmt.Errorf("site not found by project: %w", err)
+	}
+	return s, nil
+}
+
 func GetSiteByComposePath(db *sql.DB, composePath string) (*Site, error) {
 	row := db.QueryRow(`SELECT `+siteSelectColumns+siteFromJoins+` WHERE s.compose_path = ?`, composePath)
 	s, err := scanSite(row)
@@ -260,7 +758,18 @@ func GetSiteByComposePath(db *sql.DB, composePath string) (*Site, error) {
 // string to indicate "no filter". It also returns the total count of matching
 // rows so the caller can compute pagination metadata.
 func SearchSites(db *sql.DB, query, status string, page, perPage int) ([]Site, int, error) {
-	var conditions []string
+	return searchSites(db, query, status, 0, perPage, (page-1)*perPage)
+}
+
+// ListSitesPage returns up to limit sites starting at offset, optionally
+// filtered by exact status and by server (serverID 0 means any server), along
+// with the total number of matching sites.
+func ListSitesPage(db *sql.DB, status string, serverID, limit, offset int) ([]Site, int, error) {
+	return searchSites(db, "", status, serverID, limit, offset)
+}
+
+func searchSites(db *sql.DB, query, status string, serverID, limit, offset int) ([]Site, int, error) {
+	conditions := []string{siteNotTrashed}
 	var args []interface{}
 
 	if query != "" {
@@ -272,12 +781,13 @@ func SearchSites(db *sql.DB, query, status string, page, perPage int) ([]Site, i
 		conditions = append(conditions, "s.status = ?")
 		args = append(args, status)
 	}
-
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " WHERE " + strings.Join(conditions, " AND ")
+	if serverID > 0 {
+		conditions = append(conditions, "s.server_id = ?")
+		args = append(args, serverID)
 	}
 
+	whereClause := " WHERE " + strings.Join(conditions, " AND ")
+
 	// Count total matching rows for pagination metadata.
 	var total int
 	countArgs := make([]interface{}, len(args))
@@ -287,11 +797,11 @@ func SearchSites(db *sql.DB, query, status string, page, perPage int) ([]Site, i
 		return nil, 0, fmt.Errorf("failed to count filtered sites: %w", err)
 	}
 
-	// Fetch the requested page.
-	offset := (page - 1) * perPage
-	listArgs := append(args, perPage, offset)
+	// Fetch the requested page. The id tiebreak keeps pages stable when
+	// several sites share a created_at second.
+	listArgs := append(args, limit, offset)
 	listQuery := `SELECT ` + siteSelectColumns + siteFromJoins + whereClause +
-		` ORDER BY s.created_at DESC LIMIT ? OFFSET ?`
+		` ORDER BY s.created_at DESC, s.id DESC LIMIT ? OFFSET ?`
 
 	rows, err := db.Query(listQuery, listArgs...)
 	if err != nil {
@@ -313,12 +823,46 @@ func SearchSites(db *sql.DB, query, status string, page, perPage int) ([]Site, i
 	return sites, total, nil
 }
 
+// EnableSiteSSL sets ssl_enabled on a site that does not have it yet. It
+// reports whether the flag was changed, so callers can act only on the first
+// transition.
+func EnableSiteSSL(db *sql.DB, id int) (bool, error) {
+	res, err := db.Exec(
+		"UPDATE sites SET ssl_enabled = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND COALESCE(ssl_enabled, 0) = 0",
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to enable ssl for site %d: %w", id, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to enable ssl for site %d: %w", id, err)
+	}
+	return n > 0, nil
+}
+
+// UpdateSiteContainerImage records the image of a site's primary container,
+// or clears it with "". The row is only written when the image changed, so
+// the health checker can call it on every check.
+func UpdateSiteContainerImage(db *sql.DB, siteID int, image string) error {
+	_, err := db.Exec(
+		"UPDATE sites SET container_image = ? WHERE id = ? AND COALESCE(container_image,'') != ?",
+		image, siteID, image,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update container image for site %d: %w", siteID, err)
+	}
+	return nil
+}
+
 // UpdateSiteSSLExpiry stores the latest observed certificate expiry time for
 // a site. It is called by the health checker after a successful TLS handshake.
+// The time is stored in UTC, like SQLite's own timestamps, so it compares
+// correctly in SQL and reads back the same whatever the server's time zone.
 func UpdateSiteSSLExpiry(db *sql.DB, siteID int, expiry time.Time) error {
 	_, err := db.Exec(
 		"UPDATE sites SET ssl_expiry = ? WHERE id = ?",
-		expiry, siteID,
+		expiry.UTC(), siteID,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update ssl_expiry for site %d: %w", siteID, err)
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ezweb/internal/db"
+)
+
+func TestGetSitesWithExpiringCerts(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	now := time.Now()
+	sites := []struct {
+		domain string
+		ssl    bool
+		expiry time.Time // zero means never checked
+	}{
+		{"later.example.com", true, now.Add(20 * 24 * time.Hour)},
+		{"soon.example.com", true, now.Add(3 * 24 * time.Hour)},
+		{"expired.example.com", true, now.Add(-24 * time.Hour)},
+		{"fine.example.com", true, now.Add(80 * 24 * time.Hour)},
+		{"unchecked.example.com", true, time.Time{}},
+		{"plain.example.com", false, now.Add(2 * 24 * time.Hour)},
+	}
+	for i, tc := range sites {
+		s := &Site{Domain: tc.domain, ContainerName: tc.domain, Port: 8080 + i, Status: "running", SSLEnabled: tc.ssl}
+		if err := CreateSite(database, s); err != nil {
+			t.Fatalf("CreateSite(%s): %v", tc.domain, err)
+		}
+		if !tc.expiry.IsZero() {
+			if err := UpdateSiteSSLExpiry(database, s.ID, tc.expiry); err != nil {
+				t.Fatalf("UpdateSiteSSLExpiry(%s): %v", tc.domain, err)
+			}
+		}
+	}
+
+	got, err := GetSitesWithExpiringCerts(database, CertExpiryWindowDays)
+	if err != nil {
+		t.Fatalf("GetSitesWithExpiringCerts: %v", err)
+	}
+	want := []string{"expired.example.com", "soon.example.com", "later.example.com"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d sites, want %v", len(got), want)
+	}
+	for i, s := range got {
+		if s.Domain != want[i] {
+			t.Errorf("site %d = %s, want %s", i, s.Domain, want[i])
+		}
+	}
+	if d := got[0].CertDaysLeft(); d != -1 && d != 0 {
+		t.Errorf("expired cert CertDaysLeft = %d, want 0 or -1", d)
+	}
+	if d := got[1].CertDaysLeft(); d != 2 && d != 3 {
+		t.Errorf("CertDaysLeft = %d, want about 3", d)
+	}
+}
+
+func TestEnableSiteSSL(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	s := &Site{Domain: "plain.example.com", ContainerName: "plain", Port: 8080, Status: "running"}
+	if err := CreateSite(database, s); err != nil {
+		t.Fatal(err)
+	}
+
+	if changed, err := EnableSiteSSL(database, s.ID); err != nil || !changed {
+		t.Fatalf("EnableSiteSSL = %v, %v; want the flag changed", changed, err)
+	}
+	got, err := GetSiteByID(database, s.ID)
+	if err != nil || !got.SSLEnabled {
+		t.Fatalf("site after EnableSiteSSL = %+v, %v; want ssl_enabled", got, err)
+	}
+	if changed, err := EnableSiteSSL(database, s.ID); err != nil || changed {
+		t.Errorf("second EnableSiteSSL = %v, %v; want no change", changed, err)
+	}
+	if changed, err := EnableSiteSSL(database, s.ID+100); err != nil || changed {
+		t.Errorf("EnableSiteSSL on a missing site = %v, %v; want no change", changed, err)
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestContainerNameTaken(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	var sites [2]*Site
+	for i, name := range []string{"shop", "blog"} {
+		sites[i] = &Site{Domain: name + ".example.com", ContainerName: name, Port: 8080 + i, Status: "stopped", IsLocal: true}
+		if err := CreateSite(database, sites[i]); err != nil {
+			t.Fatalf("CreateSite(%s): %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		container string
+		excludeID int
+		want      bool
+	}{
+		{"new site reusing a name", "shop", 0, true},
+		{"other site renamed to a used name", "shop", sites[1].ID, true},
+		{"site keeping its own name", "shop", sites[0].ID, false},
+		{"unused name", "wiki", 0, false},
+		{"unused name on update", "wiki", sites[0].ID, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ContainerNameTaken(database, tt.container, tt.excludeID)
+			if err != nil {
+				t.Fatalf("ContainerNameTaken: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("ContainerNameTaken(%q, %d) = %v, want %v", tt.container, tt.excludeID, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestDrainAndResumeSite(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	plain := &Site{Domain: "plain.example.com", ContainerName: "plain", Port: 8080, Status: "running"}
+	paged := &Site{Domain: "paged.example.com", ContainerName: "paged", Port: 8081, Status: "running"}
+	for _, s := range []*Site{plain, paged} {
+		if err := CreateSite(database, s); err != nil {
+			t.Fatalf("CreateSite(%s): %v", s.Domain, err)
+		}
+	}
+
+	if err := MarkSiteDrained(database, plain.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := MarkSiteDrained(database, paged.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id          int
+		drained     string
+		maintenance bool
+	}{
+		{plain.ID, DrainStopped, false},
+		{paged.ID, DrainMaintenance, true},
+	} {
+		s, err := GetSiteByID(database, tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Status != "stopped" || s.Drained != tc.drained || s.Maintenance != tc.maintenance {
+			t.Errorf("%s after drain: status %q, drained %q, maintenance %v", s.Domain, s.Status, s.Drained, s.Maintenance)
+		}
+	}
+
+	// A site the admin put in maintenance before the drain keeps it.
+	if err := SetSiteMaintenance(database, plain.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int{plain.ID, paged.ID} {
+		if err := ResumeDrainedSite(database, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		id          int
+		maintenance bool
+	}{
+		{plain.ID, true},
+		{paged.ID, false},
+	} {
+		s, err := GetSiteByID(database, tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Status != "running" || s.Drained != "" || s.Maintenance != tc.maintenance {
+			t.Errorf("%s after resume: status %q, drained %q, maintenance %v", s.Domain, s.Status, s.Drained, s.Maintenance)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestSiteGitSource(t *testing.T) {
+	withEncryptionKey(t, "test-key-that-is-long-enough-for-prod")
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	s := &Site{Domain: "git.example.com", ContainerName: "git-example-com", Port: 8080, Status: "pending",
+		GitURL: "https://github.com/owner/repo.git"}
+	if err := CreateSite(database, s); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+	got, err := GetSiteByID(database, s.ID)
+	if err != nil {
+		t.Fatalf("GetSiteByID: %v", err)
+	}
+	if !got.IsGit() || got.GitBranchLabel() != "main" {
+		t.Fatalf("created site: IsGit %v, branch %q; want git site on main", got.IsGit(), got.GitBranchLabel())
+	}
+
+	keyPath := "/root/.ssh/deploy_key"
+	if err := UpdateSiteGitSource(database, s.ID, "git@github.com:owner/repo.git", "release", keyPath); err != nil {
+		t.Fatalf("UpdateSiteGitSource: %v", err)
+	}
+	var stored string
+	if err := database.QueryRow("SELECT git_key_path FROM sites WHERE id = ?", s.ID).Scan(&stored); err != nil {
+		t.Fatalf("read git_key_path: %v", err)
+	}
+	if strings.Contains(stored, "deploy_key") {
+		t.Errorf("git_key_path stored as %q, want it encrypted", stored)
+	}
+	got, err = GetSiteByID(database, s.ID)
+	if err != nil {
+		t.Fatalf("GetSiteByID: %v", err)
+	}
+	g := got.GitSource()
+	if g == nil || g.URL != "git@github.com:owner/repo.git" || g.Branch != "release" || g.KeyPath != keyPath {
+		t.Fatalf("GitSource() = %+v, want the updated source", g)
+	}
+
+	// Clearing the URL clears the branch and key along with it.
+	if err := UpdateSiteGitSource(database, s.ID, "", "release", keyPath); err != nil {
+		t.Fatalf("UpdateSiteGitSource(clear): %v", err)
+	}
+	got, err = GetSiteByID(database, s.ID)
+	if err != nil {
+		t.Fatalf("GetSiteByID: %v", err)
+	}
+	if got.IsGit() || got.GitSource() != nil || got.GitBranch != "" || got.GitKeyPath != "" {
+		t.Errorf("cleared site: %q %q %q, want no git source", got.GitURL, got.GitBranch, got.GitKeyPath)
+	}
+}
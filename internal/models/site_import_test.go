@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestImportCollisions(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	var servers [2]*Server
+	for i, name := range []string{"web1", "web2"} {
+		servers[i] = &Server{Name: name, Host: "10.0.0.1", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k"}
+		if err := CreateServer(database, servers[i]); err != nil {
+			t.Fatalf("CreateServer(%s): %v", name, err)
+		}
+	}
+
+	if name, err := FreeContainerName(database, "app-example-com"); err != nil || name != "app-example-com" {
+		t.Fatalf("FreeContainerName on empty db = %q, %v", name, err)
+	}
+
+	site := &Site{
+		Domain:        "app.example.com",
+		ServerID:      sql.NullInt64{Int64: int64(servers[0].ID), Valid: true},
+		ContainerName: "app-example-com",
+		Status:        "running",
+		ComposePath:   "/opt/app/docker-compose.yml",
+	}
+	if err := CreateSite(database, site); err != nil {
+		t.Fatalf("CreateSite: %v", err)
+	}
+
+	if name, _ := FreeContainerName(database, "app-example-com"); name != "app-example-com-2" {
+		t.Errorf("FreeContainerName with the base taken = %q, want app-example-com-2", name)
+	}
+
+	got, err := GetImportedSite(database, servers[0].ID, site.ComposePath)
+	if err != nil || got.ID != site.ID {
+		t.Fatalf("GetImportedSite same server = %v, %v", got, err)
+	}
+	if _, err := GetImportedSite(database, servers[1].ID, site.ComposePath); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetImportedSite other server: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := GetImportedSite(database, 0, site.ComposePath); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetImportedSite local: err = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := TrashSite(database, site.ID); err != nil {
+		t.Fatalf("TrashSite: %v", err)
+	}
+	if got, err := GetImportedSite(database, servers[0].ID, site.ComposePath); err != nil || !got.DeletedAt.Valid {
+		t.Errorf("GetImportedSite should still find a trashed site: %v, %v", got, err)
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestListSitesPage(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	srv := &Server{Name: "web1", Host: "10.0.0.1", SSHPort: 22, SSHUser: "root", SSHKeyPath: "/k"}
+	if err := CreateServer(database, srv); err != nil {
+		t.Fatalf("CreateServer: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		s := &Site{Domain: fmt.Sprintf("s%d.example.com", i), ContainerName: fmt.Sprintf("s%d", i), Port: 8080 + i, Status: "running"}
+		if i%2 == 0 {
+			s.ServerID = sql.NullInt64{Int64: int64(srv.ID), Valid: true}
+		} else {
+			s.Status = "stopped"
+		}
+		if err := CreateSite(database, s); err != nil {
+			t.Fatalf("CreateSite(%s): %v", s.Domain, err)
+		}
+	}
+
+	seen := map[int]bool{}
+	for offset := 0; offset < 5; offset += 2 {
+		sites, total, err := ListSitesPage(database, "", 0, 2, offset)
+		if err != nil {
+			t.Fatalf("ListSitesPage offset %d: %v", offset, err)
+		}
+		if total != 5 {
+			t.Errorf("total = %d, want 5", total)
+		}
+		for _, s := range sites {
+			if seen[s.ID] {
+				t.Errorf("site %d returned on more than one page", s.ID)
+			}
+			seen[s.ID] = true
+		}
+	}
+	if len(seen) != 5 {
+		t.Errorf("paged through %d sites, want 5", len(seen))
+	}
+
+	if sites, total, _ := ListSitesPage(database, "running", srv.ID, 10, 0); total != 3 || len(sites) != 3 {
+		t.Errorf("running on server: %d sites, total %d; want 3", len(sites), total)
+	}
+	if _, total, _ := ListSitesPage(database, "stopped", srv.ID, 10, 0); total != 0 {
+		t.Errorf("stopped on server: total %d, want 0", total)
+	}
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestCreateSite_RepicksTakenAutoPort(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	port, err := NextAvailablePort(database, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Another creation inserts the port between NextAvailablePort and the
+	// INSERT below.
+	if err := CreateSite(database, &Site{Domain: "a.example.com", ContainerName: "a", Port: port, Status: "pending"}); err != nil {
+		t.Fatalf("CreateSite(a): %v", err)
+	}
+
+	b := &Site{
+		Domain: "b.example.com", ContainerName: "b", Port: port, AutoPort: true, Status: "pending",
+		RoutingConfig: &RoutingConfig{Rules: []RoutingRule{
+			{PathPrefix: "/api", Upstream: "localhost:9000"},
+			{Upstream: fmt.Sprintf("localhost:%d", port)},
+		}},
+	}
+	if err := CreateSite(database, b); err != nil {
+		t.Fatalf("CreateSite(b): %v", err)
+	}
+	if b.Port == port {
+		t.Fatalf("b kept the taken port %d", port)
+	}
+	got, err := GetSiteByID(database, b.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Port != b.Port {
+		t.Errorf("stored port = %d, want %d", got.Port, b.Port)
+	}
+	if up := got.RoutingConfig.Rules[1].Upstream; up != fmt.Sprintf("localhost:%d", b.Port) {
+		t.Errorf("upstream = %q, want it re-pointed at %d", up, b.Port)
+	}
+	if up := got.RoutingConfig.Rules[0].Upstream; up != "localhost:9000" {
+		t.Errorf("unrelated upstream changed to %q", up)
+	}
+
+	// A port the user chose is never changed behind their back.
+	err = CreateSite(database, &Site{Domain: "c.example.com", ContainerName: "c", Port: port, Status: "pending"})
+	if !errors.Is(err, ErrPortTaken) {
+		t.Errorf("CreateSite with a taken explicit port: err = %v, want ErrPortTaken", err)
+	}
+}
+
+func TestCreateSite_ConcurrentAutoPorts(t *testing.T) {
+	// Several connections, as in production, so the creations really run
+	// at once between NextAvailablePort and the INSERT.
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 4, 4)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	// Each creation can lose the race at most once to every other one, so
+	// this many always fit in the attempts CreateSite makes.
+	const n = createSiteAttempts
+	sites := make([]*Site, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := range sites {
+		sites[i] = &Site{Domain: fmt.Sprintf("s%d.example.com", i), ContainerName: fmt.Sprintf("s%d", i), AutoPort: true, Status: "pending"}
+		wg.Add(1)
+		go func(s *Site, err *error) {
+			defer wg.Done()
+			if s.Port, *err = NextAvailablePort(database, false); *err == nil {
+				*err = CreateSite(database, s)
+			}
+		}(sites[i], &errs[i])
+	}
+	wg.Wait()
+
+	seen := make(map[int]string)
+	for i, s := range sites {
+		if errs[i] != nil {
+			t.Errorf("create %s: %v", s.Domain, errs[i])
+			continue
+		}
+		if other, dup := seen[s.Port]; dup {
+			t.Errorf("%s and %s both got port %d", other, s.Domain, s.Port)
+		}
+		seen[s.Port] = s.Domain
+	}
+}
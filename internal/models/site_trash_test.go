@@ -0,0 +1,73 @@
+package models
+
+import (
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestTrashSite_HidesSiteUntilRestored(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+
+	keep := &Site{Domain: "keep.example.com", ContainerName: "keep", Port: 8080, Status: "running"}
+	gone := &Site{Domain: "gone.example.com", ContainerName: "gone", Port: 8081, Status: "running"}
+	for _, s := range []*Site{keep, gone} {
+		if err := CreateSite(database, s); err != nil {
+			t.Fatalf("CreateSite(%s): %v", s.Domain, err)
+		}
+	}
+
+	if err := TrashSite(database, gone.ID); err != nil {
+		t.Fatalf("TrashSite: %v", err)
+	}
+	if err := TrashSite(database, gone.ID); err == nil {
+		t.Error("trashing an already trashed site should fail")
+	}
+
+	sites, err := GetAllSites(database)
+	if err != nil || len(sites) != 1 || sites[0].ID != keep.ID {
+		t.Fatalf("GetAllSites = %v, %v; want only %s", sites, err, keep.Domain)
+	}
+	if _, err := GetSiteByID(database, gone.ID); err == nil {
+		t.Error("GetSiteByID should not return a trashed site")
+	}
+	if n, _ := CountSites(database); n != 1 {
+		t.Errorf("CountSites = %d, want 1", n)
+	}
+	if _, total, _ := SearchSites(database, "example", "", 1, 10); total != 1 {
+		t.Errorf("SearchSites total = %d, want 1", total)
+	}
+
+	trashed, err := GetTrashedSites(database)
+	if err != nil || len(trashed) != 1 || trashed[0].ID != gone.ID || !trashed[0].DeletedAt.Valid {
+		t.Fatalf("GetTrashedSites = %v, %v", trashed, err)
+	}
+
+	if s, err := GetTrashedSiteByDomain(database, gone.Domain); err != nil || s.ID != gone.ID {
+		t.Errorf("GetTrashedSiteByDomain = %v, %v; want %s", s, err, gone.Domain)
+	}
+	if _, err := GetTrashedSiteByDomain(database, keep.Domain); err == nil {
+		t.Error("GetTrashedSiteByDomain should not return a live site")
+	}
+	if s, err := GetTrashedSiteByID(database, gone.ID); err != nil || s.Domain != gone.Domain {
+		t.Errorf("GetTrashedSiteByID = %v, %v; want %s", s, err, gone.Domain)
+	}
+	if _, err := GetTrashedSiteByID(database, keep.ID); err == nil {
+		t.Error("GetTrashedSiteByID should not return a live site")
+	}
+
+	if err := RestoreTrashedSite(database, gone.ID); err != nil {
+		t.Fatalf("RestoreTrashedSite: %v", err)
+	}
+	if _, err := GetSiteByID(database, gone.ID); err != nil {
+		t.Errorf("restored site not found: %v", err)
+	}
+	if err := RestoreTrashedSite(database, keep.ID); err == nil {
+		t.Error("restoring a live site should fail")
+	}
+}
@@ -0,0 +1,201 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var domainRegex = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]*[a-zA-Z0-9])?$`)
+
+// ValidateDomain reports whether domain is a syntactically valid hostname.
+func ValidateDomain(domain string) bool {
+	if len(domain) == 0 || len(domain) > 253 {
+		return false
+	}
+	return domainRegex.MatchString(domain)
+}
+
+// SplitDomains returns the host names in a site's comma-separated domain
+// field: trimmed, lower-cased and de-duplicated, in their original order.
+// The first is the site's primary domain.
+func SplitDomains(domain string) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, d := range strings.Split(domain, ",") {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		hosts = append(hosts, d)
+	}
+	return hosts
+}
+
+// PrimaryDomain returns the first host name of a comma-separated domain
+// field, the one health checks probe and redirect domains point at.
+func PrimaryDomain(domain string) string {
+	if hosts := SplitDomains(domain); len(hosts) > 0 {
+		return hosts[0]
+	}
+	return ""
+}
+
+// NormalizeDomains validates each entry of a comma-separated domain field
+// and returns the list in the form it is stored in ("example.com,
+// www.example.com"), without duplicates.
+func NormalizeDomains(domain string) (string, error) {
+	hosts := SplitDomains(domain)
+	if len(hosts) == 0 {
+		return "", fmt.Errorf("domain is required")
+	}
+	for _, h := range hosts {
+		if !ValidateDomain(h) {
+			return "", fmt.Errorf("invalid domain format: %q", h)
+		}
+	}
+	return strings.Join(hosts, ", "), nil
+}
+
+// MaxComposeServices bounds how many services a site may declare for the
+// health checker to watch.
+const MaxComposeServices = 20
+
+var composeServiceRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// SplitComposeServices returns the service names in a site's comma-separated
+// compose services field, trimmed and de-duplicated, in their original order.
+func SplitComposeServices(raw string) []string {
+	var services []string
+	seen := make(map[string]bool)
+	for _, svc := range strings.Split(raw, ",") {
+		svc = strings.TrimSpace(svc)
+		if svc == "" || seen[svc] {
+			continue
+		}
+		seen[svc] = true
+		services = append(services, svc)
+	}
+	return services
+}
+
+// NormalizeComposeServices validates a comma-separated list of compose
+// service names and returns it in the form it is stored in ("app, db").
+// An empty list is valid and means only the site's container is checked.
+func NormalizeComposeServices(raw string) (string, error) {
+	services := SplitComposeServices(raw)
+	if len(services) > MaxComposeServices {
+		return "", fmt.Errorf("At most %d compose services can be listed", MaxComposeServices)
+	}
+	for _, svc := range services {
+		if len(svc) > 64 || !composeServiceRegex.MatchString(svc) {
+			return "", fmt.Errorf("Invalid compose service name: %q", svc)
+		}
+	}
+	return strings.Join(services, ", "), nil
+}
+
+// ValidatePort reports whether port is in the unprivileged range sites may use.
+func ValidatePort(port int) bool {
+	return port >= 1024 && port <= 65535
+}
+
+// ValidateComposePath checks that a compose path is absolute, clean, and
+// contains no path traversal components. An empty path is accepted.
+func ValidateComposePath(p string) bool {
+	if p == "" {
+		return true
+	}
+	if !filepath.IsAbs(p) {
+		return false
+	}
+	cleaned := filepath.Clean(p)
+	if cleaned != p {
+		return false
+	}
+	for _, part := range strings.Split(cleaned, string(filepath.Separator)) {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// Port range handed out to new sites by NextAvailablePort.
+const (
+	sitePortMin = 8080
+	sitePortMax = 65535
+)
+
+// NextAvailablePort returns the lowest port at or above 8080 that no site is
+// using, so ports freed by deleted sites are reused. When probeLocal is true
+// (the site runs on this host) each candidate is also test-bound on the
+// loopback interface and skipped if another process already holds it.
+//
+// The SELECT runs inside a transaction so concurrent site creations read a
+// consistent snapshot of the assigned ports, reducing (though not
+// eliminating) the window for a port collision. The UNIQUE index on
+// sites(port) acts as the final guard; CreateSite picks again when a site
+// marked AutoPort loses the race.
+func NextAvailablePort(db *sql.DB, probeLocal bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	rows, err := tx.Query("SELECT DISTINCT port FROM sites WHERE port >= ? ORDER BY port", sitePortMin)
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[int]bool)
+	for rows.Next() {
+		var p int
+		if err := rows.Scan(&p); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		used[p] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	port := 0
+	for candidate := sitePortMin; candidate <= sitePortMax; candidate++ {
+		if used[candidate] {
+			continue
+		}
+		if probeLocal && !localPortFree(candidate) {
+			continue
+		}
+		port = candidate
+		break
+	}
+	if port == 0 {
+		return 0, fmt.Errorf("no free port available in range %d-%d", sitePortMin, sitePortMax)
+	}
+
+	// Commit the read-only transaction; the actual write happens in CreateSite.
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return port, nil
+}
+
+// localPortFree reports whether the TCP port can currently be bound on the
+// loopback interface.
+func localPortFree(port int) bool {
+	ln, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDomain_Valid(t *testing.T) {
+	cases := []string{
+		"example.com",
+		"sub.example.com",
+		"my-site.example.co.uk",
+	}
+	for _, c := range cases {
+		if !ValidateDomain(c) {
+			t.Errorf("expected %q to be valid", c)
+		}
+	}
+}
+
+func TestValidateDomain_Invalid(t *testing.T) {
+	cases := []string{
+		"",
+		"-example.com",
+		strings.Repeat("a", 254),
+	}
+	for _, c := range cases {
+		if ValidateDomain(c) {
+			t.Errorf("expected %q to be invalid", c)
+		}
+	}
+}
+
+func TestNormalizeDomains(t *testing.T) {
+	got, err := NormalizeDomains(" Example.com,www.example.com , example.com,, ")
+	if err != nil {
+		t.Fatalf("NormalizeDomains: %v", err)
+	}
+	if want := "example.com, www.example.com"; got != want {
+		t.Errorf("NormalizeDomains = %q, want %q", got, want)
+	}
+	if p := PrimaryDomain(got); p != "example.com" {
+		t.Errorf("PrimaryDomain = %q, want example.com", p)
+	}
+
+	for _, in := range []string{"", " , ", "example.com, -bad.com", "example.com www.example.com"} {
+		if _, err := NormalizeDomains(in); err == nil {
+			t.Errorf("NormalizeDomains(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestNormalizeComposeServices(t *testing.T) {
+	got, err := NormalizeComposeServices(" app,db , app,, redis_cache")
+	if err != nil {
+		t.Fatalf("NormalizeComposeServices: %v", err)
+	}
+	if want := "app, db, redis_cache"; got != want {
+		t.Errorf("NormalizeComposeServices = %q, want %q", got, want)
+	}
+	if got, err := NormalizeComposeServices(" , "); err != nil || got != "" {
+		t.Errorf("blank list = %q, %v; want empty", got, err)
+	}
+	for _, in := range []string{"app, -db", "app db", "app;rm -rf /"} {
+		if _, err := NormalizeComposeServices(in); err == nil {
+			t.Errorf("NormalizeComposeServices(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestValidatePort_Valid(t *testing.T) {
+	cases := []int{1024, 8080, 65535}
+	for _, p := range cases {
+		if !ValidatePort(p) {
+			t.Errorf("expected port %d to be valid", p)
+		}
+	}
+}
+
+func TestValidatePort_Invalid(t *testing.T) {
+	cases := []int{0, 80, 1023, 65536}
+	for _, p := range cases {
+		if ValidatePort(p) {
+			t.Errorf("expected port %d to be invalid", p)
+		}
+	}
+}
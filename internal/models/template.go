@@ -2,8 +2,12 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
+
+	"ezweb/internal/templates"
 )
 
 type SiteTemplate struct {
@@ -11,12 +15,41 @@ type SiteTemplate struct {
 	Slug        string
 	Label       string
 	Description string
-	CreatedAt   time.Time
+	// Compose is the stored compose template, set for templates added from
+	// the templates page and for built-in ones edited there. It is empty
+	// for a built-in template that uses the file in the binary.
+	Compose   string
+	CreatedAt time.Time
+}
+
+// Variables returns the environment variables the template's compose file
+// declares.
+func (t SiteTemplate) Variables() []templates.Variable {
+	if t.Compose != "" {
+		return templates.ParseVariables(t.Compose)
+	}
+	return templates.Variables(t.Slug)
+}
+
+// Builtin reports whether the template ships with EzWeb.
+func (t SiteTemplate) Builtin() bool {
+	return templates.IsEmbedded(t.Slug)
+}
+
+// ErrTemplateExists is returned by CreateTemplate when the slug is taken.
+var ErrTemplateExists = errors.New("a template with this slug already exists")
+
+const templateColumns = "id, slug, label, COALESCE(description,''), COALESCE(compose,''), created_at"
+
+func scanTemplate(row interface {
+	Scan(dest ...interface{}) error
+}, t *SiteTemplate) error {
+	return row.Scan(&t.ID, &t.Slug, &t.Label, &t.Description, &t.Compose, &t.CreatedAt)
 }
 
 func GetAllTemplates(db *sql.DB) ([]SiteTemplate, error) {
 	rows, err := db.Query(
-		"SELECT id, slug, label, COALESCE(description,''), created_at FROM site_templates ORDER BY label ASC",
+		"SELECT " + templateColumns + " FROM site_templates ORDER BY label ASC",
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query templates: %w", err)
@@ -26,7 +59,7 @@ func GetAllTemplates(db *sql.DB) ([]SiteTemplate, error) {
 	var templates []SiteTemplate
 	for rows.Next() {
 		var t SiteTemplate
-		if err := rows.Scan(&t.ID, &t.Slug, &t.Label, &t.Description, &t.CreatedAt); err != nil {
+		if err := scanTemplate(rows, &t); err != nil {
 			return nil, fmt.Errorf("failed to scan template row: %w", err)
 		}
 		templates = append(templates, t)
@@ -36,12 +69,81 @@ func GetAllTemplates(db *sql.DB) ([]SiteTemplate, error) {
 
 func GetTemplateBySlug(db *sql.DB, slug string) (*SiteTemplate, error) {
 	t := &SiteTemplate{}
-	err := db.QueryRow(
-		"SELECT id, slug, label, COALESCE(description,''), created_at FROM site_templates WHERE slug = ?",
+	err := scanTemplate(db.QueryRow(
+		"SELECT "+templateColumns+" FROM site_templates WHERE slug = ?",
 		slug,
-	).Scan(&t.ID, &t.Slug, &t.Label, &t.Description, &t.CreatedAt)
+	), t)
 	if err != nil {
 		return nil, fmt.Errorf("template not found: %w", err)
 	}
 	return t, nil
 }
+
+// CreateTemplate stores a new template with its compose file.
+func CreateTemplate(db *sql.DB, t *SiteTemplate) error {
+	result, err := db.Exec(
+		"INSERT INTO site_templates (slug, label, description, compose) VALUES (?, ?, ?, ?)",
+		t.Slug, t.Label, t.Description, t.Compose,
+	)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrTemplateExists
+		}
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+	id, _ := result.LastInsertId()
+	t.ID = int(id)
+	return nil
+}
+
+// UpdateTemplate saves a template's label, description and compose file. An
+// empty Compose stores NULL, which puts a built-in template back to the file
+// in the binary.
+func UpdateTemplate(db *sql.DB, t *SiteTemplate) error {
+	var compose any
+	if t.Compose != "" {
+		compose = t.Compose
+	}
+	_, err := db.Exec(
+		"UPDATE site_templates SET label = ?, description = ?, compose = ? WHERE slug = ?",
+		t.Label, t.Description, compose, t.Slug,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update template: %w", err)
+	}
+	return nil
+}
+
+func DeleteTemplate(db *sql.DB, slug string) error {
+	_, err := db.Exec("DELETE FROM site_templates WHERE slug = ?", slug)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+	return nil
+}
+
+// TemplateInUse reports whether any site, including trashed ones, is built
+// from the template.
+func TemplateInUse(db *sql.DB, slug string) (bool, error) {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sites WHERE template_slug = ?", slug).Scan(&n); err != nil {
+		return false, fmt.Errorf("failed to count sites using template: %w", err)
+	}
+	return n > 0, nil
+}
+
+// TemplateSource returns a templates.Source that reads stored compose files
+// from db, for templates.SetSource.
+func TemplateSource(db *sql.DB) templates.Source {
+	return func(slug string) (string, bool, error) {
+		var compose sql.NullString
+		err := db.QueryRow("SELECT compose FROM site_templates WHERE slug = ?", slug).Scan(&compose)
+		if err == sql.ErrNoRows {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, fmt.Errorf("failed to load template %q: %w", slug, err)
+		}
+		return compose.String, compose.Valid && compose.String != "", nil
+	}
+}
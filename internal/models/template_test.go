@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"ezweb/internal/db"
+)
+
+func TestTemplateStore(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "ezweb.db"), 1, 1)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	defer database.Close()
+	source := TemplateSource(database)
+
+	// Seeded built-in templates have no stored compose file.
+	if _, ok, err := source("wordpress"); ok || err != nil {
+		t.Errorf("source(wordpress) = %v, %v; want the embedded file", ok, err)
+	}
+
+	tmpl := &SiteTemplate{Slug: "ghost-blog", Label: "Ghost", Compose: "services: {}\n"}
+	if err := CreateTemplate(database, tmpl); err != nil {
+		t.Fatalf("CreateTemplate: %v", err)
+	}
+	if err := CreateTemplate(database, &SiteTemplate{Slug: "ghost-blog", Label: "Again", Compose: "x"}); !errors.Is(err, ErrTemplateExists) {
+		t.Errorf("duplicate CreateTemplate = %v, want ErrTemplateExists", err)
+	}
+	if content, ok, err := source("ghost-blog"); !ok || err != nil || content != tmpl.Compose {
+		t.Errorf("source(ghost-blog) = %q, %v, %v", content, ok, err)
+	}
+	if got, err := GetTemplateBySlug(database, "ghost-blog"); err != nil || got.Builtin() || got.Compose != tmpl.Compose {
+		t.Errorf("GetTemplateBySlug = %+v, %v", got, err)
+	}
+
+	// Editing a built-in stores a copy; clearing it goes back to the file.
+	wp, err := GetTemplateBySlug(database, "wordpress")
+	if err != nil || !wp.Builtin() {
+		t.Fatalf("wordpress template = %+v, %v", wp, err)
+	}
+	wp.Compose = "services: {wp: {}}\n"
+	if err := UpdateTemplate(database, wp); err != nil {
+		t.Fatal(err)
+	}
+	if content, ok, _ := source("wordpress"); !ok || content != wp.Compose {
+		t.Errorf("edited built-in: source = %q, %v", content, ok)
+	}
+	wp.Compose = ""
+	if err := UpdateTemplate(database, wp); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := source("wordpress"); ok {
+		t.Error("reset built-in still has a stored compose file")
+	}
+
+	if inUse, err := TemplateInUse(database, "ghost-blog"); err != nil || inUse {
+		t.Errorf("TemplateInUse = %v, %v; want false", inUse, err)
+	}
+	if _, err := database.Exec("INSERT INTO sites (domain, template_slug, deleted_at) VALUES ('blog.example.com', 'ghost-blog', CURRENT_TIMESTAMP)"); err != nil {
+		t.Fatal(err)
+	}
+	if inUse, err := TemplateInUse(database, "ghost-blog"); err != nil || !inUse {
+		t.Errorf("TemplateInUse with a trashed site = %v, %v; want true", inUse, err)
+	}
+
+	if err := DeleteTemplate(database, "ghost-blog"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := source("ghost-blog"); ok || err != nil {
+		t.Errorf("deleted template: source = %v, %v", ok, err)
+	}
+}
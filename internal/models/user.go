@@ -142,7 +142,8 @@ func CleanupUsedTOTPCodes(db *sql.DB) {
 
 // EnsureAdminExists creates the admin user if it doesn't exist, or updates
 // the stored password hash when the configured plain-text password no longer
-// matches — so changes to ADMIN_PASS in .env take effect on restart.
+// matches — so changes to ADMIN_PASS in .env take effect on restart. A
+// matching hash made with an older cost or algorithm is upgraded too.
 func EnsureAdminExists(db *sql.DB, username, plainPassword string) error {
 	var currentHash string
 	err := db.QueryRow("SELECT password FROM users WHERE username = ?", username).Scan(&currentHash)
@@ -159,9 +160,10 @@ func EnsureAdminExists(db *sql.DB, username, plainPassword string) error {
 		return fmt.Errorf("failed to check admin existence: %w", err)
 	}
 
-	// User exists — check whether the stored hash still matches the configured password.
-	if !auth.CheckPassword(currentHash, plainPassword) {
-		// Hash mismatch: the .env password was changed, so re-hash and update.
+	// User exists — check whether the stored hash still matches the configured
+	// password, and was made with the current hashing settings.
+	if !auth.CheckPassword(currentHash, plainPassword) || auth.NeedsRehash(currentHash) {
+		// Hash mismatch or outdated hash: re-hash and update.
 		hash, err := auth.HashPassword(plainPassword)
 		if err != nil {
 			return fmt.Errorf("failed to hash updated admin password: %w", err)
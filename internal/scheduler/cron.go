@@ -0,0 +1,167 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression. It matches a minute when every field
+// matches, except that when both day-of-month and day-of-week are restricted
+// a day matching either one is enough, as in cron.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+}
+
+// field bounds, in the order fields appear in an expression.
+var fieldBounds = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+var shorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+}
+
+// Parse parses a five-field cron expression ("minute hour day-of-month month
+// day-of-week", e.g. "30 3 * * *" for 03:30 every day) or one of @hourly,
+// @daily, @midnight, @weekly and @monthly. Fields accept *, numbers, ranges
+// (1-5), lists (1,15) and steps (*/15, 0-30/10). Day of week 0 and 7 are
+// both Sunday.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if s, ok := shorthands[strings.ToLower(expr)]; ok {
+		expr = s
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != len(fieldBounds) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var bits [5]uint64
+	for i, f := range fields {
+		b, err := parseField(f, fieldBounds[i].min, fieldBounds[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("%s field: %w", fieldBounds[i].name, err)
+		}
+		bits[i] = b
+	}
+	// Sunday may be written as 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+	return &Schedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+			step = n
+		}
+
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = parseValue(a, min, max); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(b, min, max); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("invalid range %q", rng)
+			}
+		default:
+			v, err := parseValue(rng, min, max)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(s string, min, max int) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+	if v < min || v > max {
+		return 0, fmt.Errorf("value %d out of range %d-%d", v, min, max)
+	}
+	return v, nil
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first matching minute strictly after t, in t's location,
+// or the zero time if none falls within the next five years (for example
+// "0 0 30 2 *").
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,117 @@
+// Package scheduler runs background jobs on cron schedules.
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ezweb/internal/logging"
+)
+
+// job is a task run on a schedule. A run that is due while the previous one
+// is still going is skipped rather than queued.
+type job struct {
+	name     string
+	schedule *Schedule
+	run      func(ctx context.Context) error
+
+	running atomic.Int32
+}
+
+// Scheduler runs jobs at the times their schedules match, in the server's
+// local time zone.
+type Scheduler struct {
+	jobs []*job
+	wg   sync.WaitGroup
+}
+
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers a job. It must be called before Start.
+func (s *Scheduler) Add(name string, schedule *Schedule, run func(ctx context.Context) error) {
+	s.jobs = append(s.jobs, &job{name: name, schedule: schedule, run: run})
+}
+
+// Start runs jobs until ctx is cancelled. Each run gets its own goroutine and
+// the ctx, so a long job does not delay others and can notice shutdown. Use
+// Wait to let runs in progress finish.
+func (s *Scheduler) Start(ctx context.Context) {
+	if len(s.jobs) == 0 {
+		return
+	}
+	for {
+		now := time.Now()
+		var next time.Time
+		var due []*job
+		for _, j := range s.jobs {
+			t := j.schedule.Next(now)
+			if t.IsZero() {
+				continue
+			}
+			switch {
+			case next.IsZero() || t.Before(next):
+				next, due = t, []*job{j}
+			case t.Equal(next):
+				due = append(due, j)
+			}
+		}
+		if next.IsZero() {
+			logging.Warnf("Scheduler: no job has an upcoming run, stopping")
+			return
+		}
+
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			logging.Infof("Scheduler stopped")
+			return
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		for _, j := range due {
+			s.run(ctx, j)
+		}
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, j *job) {
+	// Skip this run if the previous one has not finished yet.
+	if !j.running.CompareAndSwap(0, 1) {
+		logging.Warnf("Scheduler: %s still running, skipping this run", j.name)
+		return
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer j.running.Store(0)
+		start := time.Now()
+		if err := j.run(ctx); err != nil {
+			logging.Warnf("Scheduler: %s failed after %s: %v", j.name, time.Since(start).Round(time.Second), err)
+			return
+		}
+		logging.Infof("Scheduler: %s finished in %s", j.name, time.Since(start).Round(time.Second))
+	}()
+}
+
+// Wait blocks until runs in progress finish or timeout passes, and reports
+// whether they finished.
+func (s *Scheduler) Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "5-1 * * * *", "*/0 * * * *", "@yearly", "a * * * *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	base := time.Date(2024, 3, 15, 10, 20, 30, 0, time.UTC) // a Friday
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"30 3 * * *", time.Date(2024, 3, 16, 3, 30, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC)},
+		{"0 2 * * 0", time.Date(2024, 3, 17, 2, 0, 0, 0, time.UTC)},
+		{"0 2 * * 7", time.Date(2024, 3, 17, 2, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 9 1-5 * 1", time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)}, // day 1-5 or Monday
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"20 10 15 3 *", time.Date(2025, 3, 15, 10, 20, 0, 0, time.UTC)}, // strictly after
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(base); !got.Equal(tt.want) {
+			t.Errorf("%q: Next = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+
+	s, _ := Parse("0 0 30 2 *")
+	if got := s.Next(base); !got.IsZero() {
+		t.Errorf("impossible schedule: Next = %s, want zero", got)
+	}
+}
+
+func TestSchedulerSkipsOverlappingRun(t *testing.T) {
+	s := New()
+	release := make(chan struct{})
+	runs := 0
+	s.Add("slow", nil, func(context.Context) error {
+		runs++
+		<-release
+		return nil
+	})
+
+	s.run(context.Background(), s.jobs[0])
+	// The first run is still blocked, so this one is skipped.
+	s.run(context.Background(), s.jobs[0])
+	close(release)
+	if !s.Wait(time.Second) {
+		t.Fatal("job did not finish")
+	}
+	if runs != 1 {
+		t.Errorf("runs = %d, want 1", runs)
+	}
+
+	// Once finished, the job runs again.
+	s.run(context.Background(), s.jobs[0])
+	if !s.Wait(time.Second) {
+		t.Fatal("second run did not finish")
+	}
+	if runs != 2 {
+		t.Errorf("runs = %d, want 2", runs)
+	}
+}
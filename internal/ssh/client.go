@@ -1,14 +1,47 @@
 package sshutil
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
+var hostnameRe = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?$`)
+
+// NormalizeHost validates a server host entered by a user and returns it in
+// the form stored in the database: IP addresses in canonical form without
+// brackets, hostnames unchanged. Both "2001:db8::1" and "[2001:db8::1]" are
+// accepted for IPv6.
+func NormalizeHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+	if host == "" {
+		return "", fmt.Errorf("host is required")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), nil
+	}
+	if len(host) > 253 || !hostnameRe.MatchString(host) {
+		return "", fmt.Errorf("%q is not a valid hostname or IP address", host)
+	}
+	return host, nil
+}
+
+// Addr returns the dial address for host and port, bracketing IPv6 literals.
+func Addr(host string, port int) string {
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(port))
+}
+
 // NewClient establishes an SSH connection to the given host using public key
 // authentication. The connection has a 10-second timeout.
 func NewClient(host string, port int, user string, keyPath string) (*ssh.Client, error) {
@@ -16,6 +49,12 @@ func NewClient(host string, port int, user string, keyPath string) (*ssh.Client,
 }
 
 func NewClientWithHostKey(host string, port int, user string, keyPath string, knownHostKey string) (*ssh.Client, error) {
+	return NewClientContext(context.Background(), host, port, user, keyPath, knownHostKey)
+}
+
+// NewClientContext is NewClientWithHostKey that also gives up when ctx is
+// done, during the TCP connect or the SSH handshake.
+func NewClientContext(ctx context.Context, host string, port int, user string, keyPath string, knownHostKey string) (*ssh.Client, error) {
 	signer, err := LoadPrivateKey(keyPath)
 	if err != nil {
 		return nil, err
@@ -29,7 +68,16 @@ func NewClientWithHostKey(host string, port int, user string, keyPath string, kn
 	if err != nil {
 		return nil, fmt.Errorf("invalid stored host key: %w", err)
 	}
-	hostKeyCallback := ssh.FixedHostKey(pubKey)
+	hostKeyCallback := func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if bytes.Equal(key.Marshal(), pubKey.Marshal()) {
+			return nil
+		}
+		return &HostKeyMismatchError{
+			Addr:    Addr(host, port),
+			Pinned:  ssh.FingerprintSHA256(pubKey),
+			Offered: ssh.FingerprintSHA256(key),
+		}
+	}
 
 	config := &ssh.ClientConfig{
 		User: user,
@@ -40,16 +88,67 @@ func NewClientWithHostKey(host string, port int, user string, keyPath string, kn
 		Timeout:         10 * time.Second,
 	}
 
-	addr := fmt.Sprintf("%s:%d", host, port)
-	client, err := ssh.Dial("tcp", addr, config)
+	addr := Addr(host, port)
+	client, err := dialContext(ctx, addr, config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
 	}
 	return client, nil
 }
 
+// dialContext is ssh.Dial bounded by ctx as well as config.Timeout. A server
+// that accepts the connection but stalls the handshake is cut off when ctx
+// is done.
+func dialContext(ctx context.Context, addr string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	d := net.Dialer{Timeout: config.Timeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// HostKeyMismatchError is returned when a server presents a host key other
+// than the pinned one, as after a rebuild, or if the connection is being
+// intercepted. Callers can tell it apart from a failure to connect with
+// errors.As. The fingerprints are in the SHA256:... form ssh-keygen prints.
+type HostKeyMismatchError struct {
+	Addr    string
+	Pinned  string
+	Offered string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("host key mismatch for %s: server offered %s, pinned key is %s", e.Addr, e.Offered, e.Pinned)
+}
+
+// Fingerprint returns the SHA256 fingerprint of a host key in authorized_keys
+// format, as stored for a server, or "" if it cannot be parsed.
+func Fingerprint(authorizedKey string) string {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(authorizedKey))
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(key)
+}
+
 func GetHostKey(host string, port int) (string, error) {
-	addr := fmt.Sprintf("%s:%d", host, port)
+	return GetHostKeyContext(context.Background(), host, port)
+}
+
+// GetHostKeyContext is GetHostKey that gives up when ctx is done.
+func GetHostKeyContext(ctx context.Context, host string, port int) (string, error) {
+	addr := Addr(host, port)
 	var hostKey ssh.PublicKey
 
 	config := &ssh.ClientConfig{
@@ -61,7 +160,7 @@ func GetHostKey(host string, port int) (string, error) {
 		Timeout: 10 * time.Second,
 	}
 
-	conn, err := ssh.Dial("tcp", addr, config)
+	conn, err := dialContext(ctx, addr, config)
 	if conn != nil {
 		conn.Close()
 	}
@@ -84,25 +183,121 @@ func RunCommand(client *ssh.Client, cmd string) (string, error) {
 	defer session.Close()
 
 	output, err := session.CombinedOutput(cmd)
+	out := strings.TrimSpace(string(output))
 	if err != nil {
-		return strings.TrimSpace(string(output)), fmt.Errorf("command failed: %w", err)
+		return out, fmt.Errorf("command failed: %w", commandError(err, out))
+	}
+	return out, nil
+}
+
+// RunCommandInput is RunCommand with r fed to the command's stdin.
+func RunCommandInput(client *ssh.Client, cmd string, r io.Reader) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	session.Stdin = r
+	output, err := session.CombinedOutput(cmd)
+	out := strings.TrimSpace(string(output))
+	if err != nil {
+		return out, fmt.Errorf("command failed: %w", commandError(err, out))
+	}
+	return out, nil
+}
+
+// RunCommandStream executes a single command on the remote host, copying its
+// combined stdout+stderr output to w as it is produced.
+func RunCommandStream(client *ssh.Client, cmd string, w io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	watch := &sudoWatcher{w: w}
+	session.Stdout = watch
+	session.Stderr = watch
+	if err := session.Run(cmd); err != nil {
+		if watch.failed() {
+			err = ErrSudoPassword
+		}
+		return fmt.Errorf("command failed: %w", err)
+	}
+	return nil
+}
+
+// StreamCommand runs a long-lived command on the remote host, copying its
+// output to w until it exits or ctx is done. The command gets a
+// pseudo-terminal so that when the session is torn down the remote sshd
+// hangs it up; without one, a command such as `docker compose logs -f` would
+// keep running until it next failed to write. On cancellation the command is
+// also sent SIGTERM before the session is closed.
+func StreamCommand(ctx context.Context, client *ssh.Client, cmd string, w io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// No echo, and no \n to \r\n translation of the output.
+	modes := ssh.TerminalModes{ssh.ECHO: 0, ssh.OPOST: 0}
+	if err := session.RequestPty("dumb", 40, 200, modes); err != nil {
+		return fmt.Errorf("failed to request pty: %w", err)
+	}
+	watch := &sudoWatcher{w: w}
+	session.Stdout = watch
+	session.Stderr = watch
+	if err := session.Start(cmd); err != nil {
+		return fmt.Errorf("failed to start command: %w", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- session.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			if watch.failed() {
+				err = ErrSudoPassword
+			}
+			return fmt.Errorf("command failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		_ = session.Signal(ssh.SIGTERM)
+		session.Close()
+		<-done
+		return ctx.Err()
 	}
-	return strings.TrimSpace(string(output)), nil
 }
 
 // TestConnection verifies SSH access and checks for a running Docker daemon
-// by executing `docker info` on the remote host. Returns the Docker server
-// version string on success. The hostKey parameter is required — callers
-// must probe and store the host key via GetHostKey before calling this.
-func TestConnection(host string, port int, user string, keyPath string, hostKey string) (string, error) {
-	client, err := NewClientWithHostKey(host, port, user, keyPath, hostKey)
+// by executing `docker info` on the remote host, through sudo when sudo is
+// set (see Docker). Returns the Docker server version string on success.
+// The hostKey parameter is required — callers must probe and store the host
+// key via GetHostKey before calling this.
+func TestConnection(host string, port int, user string, keyPath string, hostKey string, sudo bool) (string, error) {
+	return TestConnectionContext(context.Background(), host, port, user, keyPath, hostKey, sudo)
+}
+
+// TestConnectionContext is TestConnection that gives up when ctx is done.
+// The connection is closed then, which ends the `docker info` session
+// however unresponsive the server is.
+func TestConnectionContext(ctx context.Context, host string, port int, user string, keyPath string, hostKey string, sudo bool) (string, error) {
+	client, err := NewClientContext(ctx, host, port, user, keyPath, hostKey)
 	if err != nil {
 		return "", err
 	}
 	defer client.Close()
+	stop := context.AfterFunc(ctx, func() { client.Close() })
+	defer stop()
 
-	version, err := RunCommand(client, "docker info --format '{{.ServerVersion}}'")
+	version, err := RunCommand(client, Docker(sudo)+" info --format '{{.ServerVersion}}'")
 	if err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
 		return "", fmt.Errorf("docker not available: %w", err)
 	}
 	return version, nil
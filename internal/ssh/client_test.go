@@ -0,0 +1,220 @@
+package sshutil
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNormalizeHost(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"2001:db8::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{" 2001:DB8:0:0:0:0:0:1 ", "2001:db8::1"},
+		{"192.0.2.10", "192.0.2.10"},
+		{"web-1.example.com", "web-1.example.com"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeHost(tt.in)
+		if err != nil {
+			t.Errorf("NormalizeHost(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizeHost(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "[]", "host:22", "2001:db8::zz", "-host", "user@host", "a b"} {
+		if _, err := NormalizeHost(bad); err == nil {
+			t.Errorf("NormalizeHost(%q) should fail", bad)
+		}
+	}
+}
+
+func TestAddr(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"2001:db8::1", "[2001:db8::1]:22"},
+		{"[2001:db8::1]", "[2001:db8::1]:22"},
+		{"192.0.2.10", "192.0.2.10:22"},
+		{"example.com", "example.com:22"},
+	}
+	for _, tt := range tests {
+		if got := Addr(tt.host, 22); got != tt.want {
+			t.Errorf("Addr(%q, 22) = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
+
+// TestGetHostKey_IPv6 probes a throwaway SSH server listening on the IPv6
+// loopback address to check the dial address is bracketed correctly.
+func TestGetHostKey_IPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(signer)
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// The handshake is enough for the client to see the host key; the
+		// probe disconnects afterwards, so the error here is expected.
+		_, _, _, _ = ssh.NewServerConn(conn, cfg)
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	got, err := GetHostKey("::1", port)
+	if err != nil {
+		t.Fatalf("GetHostKey: %v", err)
+	}
+	want := string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	if strings.TrimSpace(got) != strings.TrimSpace(want) {
+		t.Errorf("GetHostKey returned %q, want %q", got, want)
+	}
+}
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// TestNewClientWithHostKey_Mismatch connects to a server whose host key is
+// not the pinned one, as after a rebuild.
+func TestNewClientWithHostKey_Mismatch(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	rebuilt := newTestSigner(t)
+	cfg := &ssh.ServerConfig{NoClientAuth: true}
+	cfg.AddHostKey(rebuilt)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _, _, _ = ssh.NewServerConn(conn, cfg)
+	}()
+
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	old := newTestSigner(t)
+	pinned := string(ssh.MarshalAuthorizedKey(old.PublicKey()))
+	port := ln.Addr().(*net.TCPAddr).Port
+	_, err = NewClientWithHostKey("127.0.0.1", port, "deploy", keyPath, pinned)
+
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("err = %v, want a HostKeyMismatchError", err)
+	}
+	if mismatch.Pinned != Fingerprint(pinned) || mismatch.Offered != ssh.FingerprintSHA256(rebuilt.PublicKey()) {
+		t.Errorf("fingerprints pinned=%s offered=%s, want %s and %s",
+			mismatch.Pinned, mismatch.Offered, Fingerprint(pinned), ssh.FingerprintSHA256(rebuilt.PublicKey()))
+	}
+
+	if _, err := NewClientWithHostKey("127.0.0.1", 1, "deploy", keyPath, pinned); err == nil || errors.As(err, &mismatch) {
+		t.Errorf("refused connection: err = %v, want a plain connection error", err)
+	}
+}
+
+// TestTestConnectionContext_StalledServer connects to a host that accepts
+// the TCP connection but never speaks SSH, which the dial timeout alone
+// does not cover.
+func TestTestConnectionContext_StalledServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	_, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, err := ssh.MarshalPrivateKey(clientKey, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pinned := string(ssh.MarshalAuthorizedKey(newTestSigner(t).PublicKey()))
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = TestConnectionContext(ctx, "127.0.0.1", port, "deploy", keyPath, pinned, false)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's deadline", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("gave up after %s", d)
+	}
+
+	if _, err := GetHostKeyContext(ctx, "127.0.0.1", port); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("GetHostKeyContext after the deadline: err = %v, want the context's deadline", err)
+	}
+}
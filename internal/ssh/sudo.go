@@ -0,0 +1,81 @@
+package sshutil
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Docker returns the command that runs docker on a server. With sudo set,
+// for SSH users that are not in the docker group, it is "sudo -n docker":
+// -n makes sudo fail at once instead of waiting for a password nobody will
+// type, and the command then fails with ErrSudoPassword.
+func Docker(sudo bool) string {
+	if sudo {
+		return "sudo -n docker"
+	}
+	return "docker"
+}
+
+// ErrSudoPassword is returned by the Run and Stream functions when sudo
+// refused to run a command without a password.
+var ErrSudoPassword = errors.New("sudo requires a password for the SSH user; allow it to run docker without one (NOPASSWD in sudoers)")
+
+// sudoPasswordMessages are what sudo -n prints when it would have to ask
+// for a password. Older versions complain about the missing terminal.
+var sudoPasswordMessages = []string{
+	"sudo: a password is required",
+	"sudo: a terminal is required",
+}
+
+func isSudoPasswordFailure(output string) bool {
+	for _, msg := range sudoPasswordMessages {
+		if strings.Contains(output, msg) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandError wraps the error of a failed command, as ErrSudoPassword when
+// its output shows sudo asking for a password.
+func commandError(err error, output string) error {
+	if isSudoPasswordFailure(output) {
+		return ErrSudoPassword
+	}
+	return err
+}
+
+// sudoWatcher passes output through to w while remembering the last
+// stretch of it, so a streamed command can be checked for a sudo failure
+// once it exits. sudo fails before the command writes anything, so the
+// start of the output is what matters; keeping the tail as well catches a
+// sudo later in a pipeline.
+type sudoWatcher struct {
+	w    io.Writer
+	mu   sync.Mutex
+	head []byte
+	tail []byte
+}
+
+const sudoWatchBytes = 512
+
+func (s *sudoWatcher) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	if n := sudoWatchBytes - len(s.head); n > 0 {
+		s.head = append(s.head, p[:min(n, len(p))]...)
+	}
+	s.tail = append(s.tail, p...)
+	if len(s.tail) > sudoWatchBytes {
+		s.tail = s.tail[len(s.tail)-sudoWatchBytes:]
+	}
+	s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *sudoWatcher) failed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return isSudoPasswordFailure(string(s.head)) || isSudoPasswordFailure(string(s.tail))
+}
@@ -0,0 +1,46 @@
+package sshutil
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDocker(t *testing.T) {
+	if got := Docker(false); got != "docker" {
+		t.Errorf("Docker(false) = %q", got)
+	}
+	if got := Docker(true); got != "sudo -n docker" {
+		t.Errorf("Docker(true) = %q", got)
+	}
+}
+
+func TestCommandError_SudoPassword(t *testing.T) {
+	exit := errors.New("Process exited with status 1")
+	if err := commandError(exit, "sudo: a password is required"); !errors.Is(err, ErrSudoPassword) {
+		t.Errorf("err = %v, want ErrSudoPassword", err)
+	}
+	if err := commandError(exit, "Error response from daemon: No such container: shop"); err != exit {
+		t.Errorf("err = %v, want the exit error unchanged", err)
+	}
+}
+
+func TestSudoWatcher(t *testing.T) {
+	var out bytes.Buffer
+	w := &sudoWatcher{w: &out}
+	w.Write([]byte("sudo: a pass"))
+	w.Write([]byte("word is required\n"))
+	if !w.failed() {
+		t.Error("sudo failure split across writes not detected")
+	}
+	if out.String() != "sudo: a password is required\n" {
+		t.Errorf("passed through %q", out.String())
+	}
+
+	w = &sudoWatcher{w: &out}
+	w.Write([]byte(strings.Repeat("pulling layer\n", 100)))
+	if w.failed() {
+		t.Error("ordinary output reported as a sudo failure")
+	}
+}
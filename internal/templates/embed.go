@@ -1,14 +1,61 @@
 package templates
 
-import "embed"
+import (
+	"embed"
+	"sync"
+)
 
 //go:embed composes/*.yml
 var ComposeFS embed.FS
 
+// Source looks up a compose template stored outside the binary, such as
+// one added from the templates page. ok is false when it has none for slug.
+type Source func(slug string) (content string, ok bool, err error)
+
+var (
+	sourceMu sync.RWMutex
+	source   Source
+)
+
+// SetSource makes GetComposeTemplate consult s before the embedded
+// templates, so a stored template is used in place of a built-in one with
+// the same slug. Call it once at startup.
+func SetSource(s Source) {
+	sourceMu.Lock()
+	source = s
+	sourceMu.Unlock()
+}
+
+// GetComposeTemplate returns the compose template for slug: the stored one
+// when the Source set with SetSource has it, the embedded one otherwise.
 func GetComposeTemplate(slug string) (string, error) {
+	sourceMu.RLock()
+	s := source
+	sourceMu.RUnlock()
+	if s != nil {
+		content, ok, err := s(slug)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return content, nil
+		}
+	}
+	return GetEmbeddedTemplate(slug)
+}
+
+// GetEmbeddedTemplate returns the compose template built into the binary
+// for slug, ignoring any stored one.
+func GetEmbeddedTemplate(slug string) (string, error) {
 	data, err := ComposeFS.ReadFile("composes/" + slug + ".yml")
 	if err != nil {
 		return "", err
 	}
 	return string(data), nil
 }
+
+// IsEmbedded reports whether slug is one of the built-in templates.
+func IsEmbedded(slug string) bool {
+	_, err := GetEmbeddedTemplate(slug)
+	return err == nil
+}
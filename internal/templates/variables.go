@@ -0,0 +1,116 @@
+package templates
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Variable is an environment variable a compose template needs in the site's
+// .env file. A variable with a default may be left unset on the site; one
+// without must be provided.
+type Variable struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     string `json:"default,omitempty"`
+}
+
+// variableRef matches a compose interpolation: ${NAME}, ${NAME:-default} or
+// ${NAME:?message}, with or without the colon. "$${" is compose's escape
+// for a literal "${" and is skipped by the caller.
+var variableRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])([^}]*))?\}`)
+
+// ParseVariables returns the variables a compose template declares, in the
+// order they first appear. Compose templates declare a variable by
+// referencing it with compose's own interpolation syntax:
+//
+//	${NAME:?Description}   required; the message is its description
+//	${NAME:-default}       optional, with a default
+//	${NAME}                required, with no description
+//
+// A "# comment" after an optional variable on the same line describes it.
+// Values EzWeb generates itself (container name, port, database passwords)
+// are Go template fields such as {{.Port}} and are not variables.
+func ParseVariables(content string) []Variable {
+	var vars []Variable
+	seen := make(map[string]int)
+	for _, line := range strings.Split(content, "\n") {
+		comment := ""
+		if i := strings.Index(line, " #"); i >= 0 {
+			comment = strings.TrimSpace(line[i+2:])
+		}
+		for _, m := range variableRef.FindAllStringSubmatchIndex(line, -1) {
+			if m[0] > 0 && line[m[0]-1] == '$' {
+				continue
+			}
+			v := Variable{Name: line[m[2]:m[3]]}
+			if m[4] >= 0 {
+				op, arg := line[m[4]:m[5]], line[m[6]:m[7]]
+				if strings.HasSuffix(op, "?") {
+					v.Description = arg
+				} else {
+					v.Default = arg
+					v.Description = comment
+				}
+			}
+			i, ok := seen[v.Name]
+			if !ok {
+				seen[v.Name] = len(vars)
+				vars = append(vars, v)
+				continue
+			}
+			if vars[i].Default == "" {
+				vars[i].Default = v.Default
+			}
+			if vars[i].Description == "" {
+				vars[i].Description = v.Description
+			}
+		}
+	}
+	return vars
+}
+
+// Variables returns the variables the template declares, read from its
+// compose file as GetComposeTemplate finds it, or nil if it needs none or
+// has no compose file.
+func Variables(slug string) []Variable {
+	content, err := GetComposeTemplate(slug)
+	if err != nil {
+		return nil
+	}
+	return ParseVariables(content)
+}
+
+// MissingVariablesError lists required variables that have neither a site
+// value nor a default.
+type MissingVariablesError struct {
+	Template string
+	Names    []string
+}
+
+func (e *MissingVariablesError) Error() string {
+	return fmt.Sprintf("template %s requires %s", e.Template, strings.Join(e.Names, ", "))
+}
+
+// Resolve returns the value of every variable the template declares, taking
+// it from set when present and non-empty and from the default otherwise. If
+// a variable has neither, a *MissingVariablesError naming all such variables
+// is returned.
+func Resolve(slug string, set map[string]string) (map[string]string, error) {
+	values := make(map[string]string)
+	var missing []string
+	for _, v := range Variables(slug) {
+		switch {
+		case set[v.Name] != "":
+			values[v.Name] = set[v.Name]
+		case v.Default != "":
+			values[v.Name] = v.Default
+		default:
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, &MissingVariablesError{Template: slug, Names: missing}
+	}
+	return values, nil
+}
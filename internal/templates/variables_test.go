@@ -0,0 +1,87 @@
+package templates
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseVariables(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Variable
+	}{
+		{"none", "image: nginx\nports:\n  - \"{{.Port}}:80\"\n", nil},
+		{"required", `FROM: "${MAIL_FROM:?Sender address}"`, []Variable{{Name: "MAIL_FROM", Description: "Sender address"}}},
+		{"bare", "HOST=${HOST}", []Variable{{Name: "HOST"}}},
+		{"default with comment", `MODE: "${MODE:-prod}" # Run mode`, []Variable{{Name: "MODE", Description: "Run mode", Default: "prod"}}},
+		{"default without colon", "MODE=${MODE-prod}", []Variable{{Name: "MODE", Default: "prod"}}},
+		{"escaped", "cmd: echo $${HOME}", nil},
+		{
+			"repeated fills in",
+			"A=${KEY}\nB=${KEY:-k} # The key\n",
+			[]Variable{{Name: "KEY", Description: "The key", Default: "k"}},
+		},
+		{
+			"order of first use",
+			"${B:-1} ${A:?a}\n${B}",
+			[]Variable{{Name: "B", Default: "1"}, {Name: "A", Description: "a"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseVariables(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseVariables = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVariables_ShippedTemplates(t *testing.T) {
+	// Ghost cannot send sign-in codes without a mail server, and there is
+	// no sensible default for one.
+	_, err := Resolve("ghost", map[string]string{"SMTP_HOST": "smtp.example.com"})
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) || !reflect.DeepEqual(missing.Names, []string{"MAIL_FROM"}) {
+		t.Fatalf("Resolve(ghost) without MAIL_FROM: got %v, want MAIL_FROM missing", err)
+	}
+	values, err := Resolve("ghost", map[string]string{"SMTP_HOST": "smtp.example.com", "MAIL_FROM": "blog@example.com"})
+	if err != nil {
+		t.Fatalf("Resolve(ghost): %v", err)
+	}
+	if values["SMTP_PORT"] != "587" {
+		t.Errorf("SMTP_PORT = %q, want the default 587", values["SMTP_PORT"])
+	}
+
+	if values, err := Resolve("nodejs", nil); err != nil || values["NODE_ENV"] != "production" {
+		t.Errorf("Resolve(nodejs) = %v, %v, want NODE_ENV=production", values, err)
+	}
+	if values, err := Resolve("static", nil); err != nil || len(values) != 0 {
+		t.Errorf("Resolve for a template without variables = %v, %v", values, err)
+	}
+}
+
+func TestResolve_StoredTemplate(t *testing.T) {
+	SetSource(func(slug string) (string, bool, error) {
+		if slug != "test-app" {
+			return "", false, nil
+		}
+		return "API_KEY=${API_KEY:?API key}\nMODE=${MODE:-prod}\n", true, nil
+	})
+	defer SetSource(nil)
+
+	_, err := Resolve("test-app", map[string]string{"MODE": "dev"})
+	var missing *MissingVariablesError
+	if !errors.As(err, &missing) || len(missing.Names) != 1 || missing.Names[0] != "API_KEY" {
+		t.Fatalf("Resolve without API_KEY: got %v, want API_KEY missing", err)
+	}
+
+	values, err := Resolve("test-app", map[string]string{"API_KEY": "k", "OTHER": "x"})
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if values["API_KEY"] != "k" || values["MODE"] != "prod" || len(values) != 2 {
+		t.Errorf("Resolve = %v, want API_KEY=k MODE=prod", values)
+	}
+}
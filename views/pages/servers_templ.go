@@ -14,10 +14,11 @@ import (
 	"ezweb/views/components"
 	"ezweb/views/layouts"
 	"ezweb/views/partials"
+	"net/url"
 	"strconv"
 )
 
-func Servers(localInfo docker.LocalServerInfo, servers []models.Server) templ.Component {
+func Servers(localInfo docker.LocalServerInfo, servers []models.Server, allTags []string, activeTag string) templ.Component {
 	return templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 		templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 		if templ_7745c5c3_CtxErr := ctx.Err(); templ_7745c5c3_CtxErr != nil {
@@ -58,11 +59,97 @@ func Servers(localInfo docker.LocalServerInfo, servers []models.Server) templ.Co
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<main class=\"flex-1 p-6 lg:p-10 pt-16 lg:pt-10\" x-data=\"serverFilter()\"><div class=\"flex flex-col sm:flex-row items-start sm:items-center justify-between gap-4 mb-8\"><div><h2 class=\"text-2xl font-bold text-gray-900\">Servers</h2><p class=\"text-sm text-gray-500 mt-1\">Manage your hosting infrastructure and SSH connections</p></div><button data-modal-open=\"add-server\" class=\"inline-flex items-center gap-2 px-4 py-2 bg-gradient-to-r from-blue-600 to-blue-700 hover:from-blue-700 hover:to-blue-800 text-white rounded-lg font-medium text-sm shadow-sm hover:shadow-md transition-all duration-150\"><svg class=\"w-4 h-4\" fill=\"none\" stroke=\"currentColor\" viewBox=\"0 0 24 24\" stroke-width=\"2.5\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" d=\"M12 4.5v15m7.5-7.5h-15\"></path></svg> Add Server</button></div><!-- Search Bar --><div class=\"mb-4 flex flex-wrap items-center gap-3 p-3 bg-white rounded-xl border border-gray-200 shadow-sm\"><div class=\"w-full sm:flex-1 sm:min-w-[200px]\"><input type=\"text\" placeholder=\"Search by name or host...\" x-model=\"searchQuery\" class=\"w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\"></div><button x-show=\"searchQuery\" x-cloak @click=\"searchQuery = ''\" class=\"px-3 py-2 text-xs font-medium text-gray-500 hover:text-gray-700 bg-gray-100 hover:bg-gray-200 rounded-lg transition-colors\">Clear</button></div>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 2, "<main class=\"flex-1 p-6 lg:p-10 pt-16 lg:pt-10\" x-data=\"serverFilter()\"><div class=\"flex flex-col sm:flex-row items-start sm:items-center justify-between gap-4 mb-8\"><div><h2 class=\"text-2xl font-bold text-gray-900\">Servers</h2><p class=\"text-sm text-gray-500 mt-1\">Manage your hosting infrastructure and SSH connections</p></div><div class=\"flex items-center gap-2\"><button type=\"button\" hx-post=\"/servers/test-all\" hx-target=\"#server-test-results\" hx-swap=\"innerHTML\" hx-disabled-elt=\"this\" class=\"inline-flex items-center gap-2 px-4 py-2 text-sm font-medium text-blue-700 bg-blue-50 hover:bg-blue-100 border border-blue-200 rounded-lg transition-colors disabled:opacity-50\">Test All</button> <button data-modal-open=\"add-server\" class=\"inline-flex items-center gap-2 px-4 py-2 bg-gradient-to-r from-blue-600 to-blue-700 hover:from-blue-700 hover:to-blue-800 text-white rounded-lg font-medium text-sm shadow-sm hover:shadow-md transition-all duration-150\"><svg class=\"w-4 h-4\" fill=\"none\" stroke=\"currentColor\" viewBox=\"0 0 24 24\" stroke-width=\"2.5\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" d=\"M12 4.5v15m7.5-7.5h-15\"></path></svg> Add Server</button></div></div><div id=\"server-test-results\" class=\"empty:hidden mb-4 p-4 bg-white rounded-xl border border-gray-200 shadow-sm\"></div><!-- Search Bar --><div class=\"mb-4 flex flex-wrap items-center gap-3 p-3 bg-white rounded-xl border border-gray-200 shadow-sm\"><div class=\"w-full sm:flex-1 sm:min-w-[200px]\"><input type=\"text\" placeholder=\"Search by name or host...\" x-model=\"searchQuery\" class=\"w-full px-3 py-2 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\"></div><button x-show=\"searchQuery\" x-cloak @click=\"searchQuery = ''\" class=\"px-3 py-2 text-xs font-medium text-gray-500 hover:text-gray-700 bg-gray-100 hover:bg-gray-200 rounded-lg transition-colors\">Clear</button> ")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Var3 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+			if len(allTags) > 0 {
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<div class=\"w-full flex flex-wrap items-center gap-1.5\"><span class=\"text-xs font-semibold text-gray-500 uppercase tracking-wide mr-1\">Tags</span> ")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var3 = []any{"px-2.5 py-1 text-xs font-medium rounded-full border transition-colors", templ.KV("bg-blue-600 text-white border-blue-600", activeTag == ""), templ.KV("bg-white text-gray-600 border-gray-200 hover:bg-gray-50", activeTag != "")}
+				templ_7745c5c3_Err = templ.RenderCSSItems(ctx, templ_7745c5c3_Buffer, templ_7745c5c3_Var3...)
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "<a href=\"/servers\" class=\"")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				var templ_7745c5c3_Var4 string
+				templ_7745c5c3_Var4, templ_7745c5c3_Err = templ.JoinStringErrs(templ.CSSClasses(templ_7745c5c3_Var3).String())
+				if templ_7745c5c3_Err != nil {
+					return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/pages/servers.templ`, Line: 1, Col: 0}
+				}
+				_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var4))
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "\">All</a> ")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+				for _, t := range allTags {
+					var templ_7745c5c3_Var5 = []any{"px-2.5 py-1 text-xs font-medium rounded-full border transition-colors", templ.KV("bg-blue-600 text-white border-blue-600", activeTag == t), templ.KV("bg-white text-gray-600 border-gray-200 hover:bg-gray-50", activeTag != t)}
+					templ_7745c5c3_Err = templ.RenderCSSItems(ctx, templ_7745c5c3_Buffer, templ_7745c5c3_Var5...)
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "<a href=\"")
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					var templ_7745c5c3_Var6 templ.SafeURL
+					templ_7745c5c3_Var6, templ_7745c5c3_Err = templ.JoinURLErrs(templ.SafeURL("/servers?tag=" + url.QueryEscape(t)))
+					if templ_7745c5c3_Err != nil {
+						return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/pages/servers.templ`, Line: 76, Col: 67}
+					}
+					_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var6))
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 7, "\" class=\"")
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					var templ_7745c5c3_Var7 string
+					templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(templ.CSSClasses(templ_7745c5c3_Var5).String())
+					if templ_7745c5c3_Err != nil {
+						return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/pages/servers.templ`, Line: 1, Col: 0}
+					}
+					_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 8, "\">")
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					var templ_7745c5c3_Var8 string
+					templ_7745c5c3_Var8, templ_7745c5c3_Err = templ.JoinStringErrs(t)
+					if templ_7745c5c3_Err != nil {
+						return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/pages/servers.templ`, Line: 79, Col: 12}
+					}
+					_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var8))
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 9, "</a>")
+					if templ_7745c5c3_Err != nil {
+						return templ_7745c5c3_Err
+					}
+				}
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 10, "</div>")
+				if templ_7745c5c3_Err != nil {
+					return templ_7745c5c3_Err
+				}
+			}
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 11, "</div>")
+			if templ_7745c5c3_Err != nil {
+				return templ_7745c5c3_Err
+			}
+			templ_7745c5c3_Var9 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 				templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 				templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
 				if !templ_7745c5c3_IsBuffer {
@@ -74,7 +161,7 @@ func Servers(localInfo docker.LocalServerInfo, servers []models.Server) templ.Co
 					}()
 				}
 				ctx = templ.InitializeContext(ctx)
-				templ_7745c5c3_Var4 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+				templ_7745c5c3_Var10 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 					templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 					templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
 					if !templ_7745c5c3_IsBuffer {
@@ -86,13 +173,15 @@ func Servers(localInfo docker.LocalServerInfo, servers []models.Server) templ.Co
 						}()
 					}
 					ctx = templ.InitializeContext(ctx)
-					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 3, "<thead><tr class=\"bg-gray-50 border-b border-gray-200\"><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Name</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Host</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">SSH Port</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">SSH User</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Status</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Actions</th></tr></thead> <tbody id=\"server-list\">")
+					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 12, "<thead><tr class=\"bg-gray-50 border-b border-gray-200\"><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Name</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Host</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">SSH Port</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">SSH User</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Status</th><th class=\"px-6 py-3 text-left text-xs font-semibold text-gray-500 uppercase tracking-wider\">Actions</th></tr></thead> <tbody id=\"server-list\">")
 					if templ_7745c5c3_Err != nil {
 						return templ_7745c5c3_Err
 					}
-					templ_7745c5c3_Err = partials.LocalhostRow(localInfo).Render(ctx, templ_7745c5c3_Buffer)
-					if templ_7745c5c3_Err != nil {
-						return templ_7745c5c3_Err
+					if activeTag == "" {
+						templ_7745c5c3_Err = partials.LocalhostRow(localInfo).Render(ctx, templ_7745c5c3_Buffer)
+						if templ_7745c5c3_Err != nil {
+							return templ_7745c5c3_Err
+						}
 					}
 					for _, s := range servers {
 						templ_7745c5c3_Err = partials.ServerRow(s).Render(ctx, templ_7745c5c3_Buffer)
@@ -100,23 +189,23 @@ func Servers(localInfo docker.LocalServerInfo, servers []models.Server) templ.Co
 							return templ_7745c5c3_Err
 						}
 					}
-					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 4, "</tbody>")
+					templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 13, "</tbody>")
 					if templ_7745c5c3_Err != nil {
 						return templ_7745c5c3_Err
 					}
 					return nil
 				})
-				templ_7745c5c3_Err = components.Table().Render(templ.WithChildren(ctx, templ_7745c5c3_Var4), templ_7745c5c3_Buffer)
+				templ_7745c5c3_Err = components.Table().Render(templ.WithChildren(ctx, templ_7745c5c3_Var10), templ_7745c5c3_Buffer)
 				if templ_7745c5c3_Err != nil {
 					return templ_7745c5c3_Err
 				}
 				return nil
 			})
-			templ_7745c5c3_Err = components.Card("").Render(templ.WithChildren(ctx, templ_7745c5c3_Var3), templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = components.Card("").Render(templ.WithChildren(ctx, templ_7745c5c3_Var9), templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Var5 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
+			templ_7745c5c3_Var11 := templruntime.GeneratedTemplate(func(templ_7745c5c3_Input templruntime.GeneratedComponentInput) (templ_7745c5c3_Err error) {
 				templ_7745c5c3_W, ctx := templ_7745c5c3_Input.Writer, templ_7745c5c3_Input.Context
 				templ_7745c5c3_Buffer, templ_7745c5c3_IsBuffer := templruntime.GetBuffer(templ_7745c5c3_W)
 				if !templ_7745c5c3_IsBuffer {
@@ -128,17 +217,17 @@ func Servers(localInfo docker.LocalServerInfo, servers []models.Server) templ.Co
 					}()
 				}
 				ctx = templ.InitializeContext(ctx)
-				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 5, "<form hx-post=\"/servers\" hx-target=\"#server-list\" hx-swap=\"beforeend\" hx-on:htmx:after-request=\"if(event.detail.successful) EzModal.close()\" class=\"space-y-5\"><details><summary class=\"inline-flex items-center gap-1.5 text-xs font-medium text-blue-600 hover:text-blue-800 transition-colors cursor-pointer\"><svg class=\"w-3.5 h-3.5\" fill=\"none\" stroke=\"currentColor\" viewBox=\"0 0 24 24\" stroke-width=\"2\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" d=\"M9.879 7.519c1.171-1.025 3.071-1.025 4.242 0 1.172 1.025 1.172 2.687 0 3.712-.203.179-.43.326-.67.442-.745.361-1.45.999-1.45 1.827v.75M21 12a9 9 0 11-18 0 9 9 0 0118 0zm-9 5.25h.008v.008H12v-.008z\"></path></svg> <span class=\"label-closed\">What do I enter?</span> <span class=\"label-open\">Hide field guide</span></summary><div class=\"mt-2 p-3 bg-blue-50 border border-blue-100 rounded-lg text-xs text-gray-700 space-y-2\"><p><span class=\"font-semibold text-gray-900\">Server Name</span> — A friendly label to identify this server (e.g., \"Production VPS\", \"Staging Server\").</p><p><span class=\"font-semibold text-gray-900\">Host / IP</span> — The server's IP address or hostname that EzWeb will SSH into (e.g., \"192.168.1.50\", \"vps.example.com\").</p><p><span class=\"font-semibold text-gray-900\">SSH Port</span> — Defaults to 22. Only change this if your server uses a non-standard SSH port.</p><p><span class=\"font-semibold text-gray-900\">SSH User</span> — Defaults to \"root\". Use whichever user has Docker permissions on the remote machine.</p><p><span class=\"font-semibold text-gray-900\">SSH Key Path</span> — Absolute file path to the private key on this machine (e.g., \"/root/.ssh/id_ed25519\"). The key file must already exist.</p><p class=\"text-gray-500 italic\">After adding, click \"Test Connection\" to verify SSH access.</p></div></details><div><label for=\"name\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Server Name</label> <input type=\"text\" id=\"name\" name=\"name\" required class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"My Production Server\"></div><div><label for=\"host\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Host / IP</label> <input type=\"text\" id=\"host\" name=\"host\" required class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"192.168.1.100 or server.example.com\"></div><div class=\"grid grid-cols-1 sm:grid-cols-2 gap-4\"><div><label for=\"ssh_port\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">SSH Port</label> <input type=\"number\" id=\"ssh_port\" name=\"ssh_port\" value=\"22\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\"></div><div><label for=\"ssh_user\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">SSH User</label> <input type=\"text\" id=\"ssh_user\" name=\"ssh_user\" value=\"root\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\"></div></div><div><label for=\"ssh_key_path\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">SSH Key Path</label> <input type=\"text\" id=\"ssh_key_path\" name=\"ssh_key_path\" required class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"/root/.ssh/id_rsa\"></div><div class=\"flex justify-end gap-3 pt-2 border-t border-gray-100\"><button type=\"submit\" formmethod=\"dialog\" formnovalidate class=\"px-4 py-2 text-sm text-gray-600 bg-gray-100 hover:bg-gray-200 rounded-lg font-medium transition-colors\">Cancel</button> <button type=\"submit\" class=\"inline-flex items-center gap-2 px-4 py-2 bg-gradient-to-r from-blue-600 to-blue-700 hover:from-blue-700 hover:to-blue-800 text-white rounded-lg font-medium text-sm shadow-sm transition-all duration-150\">Add Server</button></div></form>")
+				templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 14, "<form hx-post=\"/servers\" hx-target=\"#server-list\" hx-swap=\"beforeend\" hx-on:htmx:after-request=\"if(event.detail.successful) EzModal.close()\" class=\"space-y-5\"><details><summary class=\"inline-flex items-center gap-1.5 text-xs font-medium text-blue-600 hover:text-blue-800 transition-colors cursor-pointer\"><svg class=\"w-3.5 h-3.5\" fill=\"none\" stroke=\"currentColor\" viewBox=\"0 0 24 24\" stroke-width=\"2\"><path stroke-linecap=\"round\" stroke-linejoin=\"round\" d=\"M9.879 7.519c1.171-1.025 3.071-1.025 4.242 0 1.172 1.025 1.172 2.687 0 3.712-.203.179-.43.326-.67.442-.745.361-1.45.999-1.45 1.827v.75M21 12a9 9 0 11-18 0 9 9 0 0118 0zm-9 5.25h.008v.008H12v-.008z\"></path></svg> <span class=\"label-closed\">What do I enter?</span> <span class=\"label-open\">Hide field guide</span></summary><div class=\"mt-2 p-3 bg-blue-50 border border-blue-100 rounded-lg text-xs text-gray-700 space-y-2\"><p><span class=\"font-semibold text-gray-900\">Server Name</span> — A friendly label to identify this server (e.g., \"Production VPS\", \"Staging Server\").</p><p><span class=\"font-semibold text-gray-900\">Host / IP</span> — The server's IP address or hostname that EzWeb will SSH into (e.g., \"192.168.1.50\", \"vps.example.com\").</p><p><span class=\"font-semibold text-gray-900\">SSH Port</span> — Defaults to 22. Only change this if your server uses a non-standard SSH port.</p><p><span class=\"font-semibold text-gray-900\">SSH User</span> — Defaults to \"root\". Use whichever user has Docker permissions on the remote machine.</p><p><span class=\"font-semibold text-gray-900\">SSH Key Path</span> — Absolute file path to the private key on this machine (e.g., \"/root/.ssh/id_ed25519\"). The key file must already exist.</p><p><span class=\"font-semibold text-gray-900\">Tags</span> — Optional comma-separated labels such as \"prod, us-east\" for filtering the server list.</p><p class=\"text-gray-500 italic\">After adding, click \"Test Connection\" to verify SSH access.</p></div></details><div><label for=\"name\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Server Name</label> <input type=\"text\" id=\"name\" name=\"name\" required class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"My Production Server\"></div><div><label for=\"host\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Host / IP</label> <input type=\"text\" id=\"host\" name=\"host\" required class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"192.168.1.100 or server.example.com\"></div><div class=\"grid grid-cols-1 sm:grid-cols-2 gap-4\"><div><label for=\"ssh_port\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">SSH Port</label> <input type=\"number\" id=\"ssh_port\" name=\"ssh_port\" value=\"22\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\"></div><div><label for=\"ssh_user\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">SSH User</label> <input type=\"text\" id=\"ssh_user\" name=\"ssh_user\" value=\"root\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\"></div></div><div><label for=\"ssh_key_path\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">SSH Key Path</label> <input type=\"text\" id=\"ssh_key_path\" name=\"ssh_key_path\" required class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"/root/.ssh/id_rsa\"></div><div><label for=\"deploy_path\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Deploy Path</label> <input type=\"text\" id=\"deploy_path\" name=\"deploy_path\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors font-mono\" placeholder=\"/opt/ezweb\"><p class=\"text-xs text-gray-400 mt-1\">Remote directory that holds each site's compose files. Leave blank for /opt/ezweb.</p></div><div><label for=\"deploy_mode\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Deploy Mode</label> <select id=\"deploy_mode\" name=\"deploy_mode\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors appearance-none\"><option value=\"compose\" selected>Docker Compose</option> <option value=\"swarm\">Docker Swarm (stack deploy)</option></select><p class=\"text-xs text-gray-400 mt-1\">Swarm deploys each site's compose file as a stack. The server must be a swarm manager.</p></div><div class=\"flex items-start gap-3 p-3 rounded-lg bg-gray-50 border border-gray-200\"><input type=\"hidden\" name=\"use_sudo\" value=\"0\"> <input type=\"checkbox\" id=\"use_sudo\" name=\"use_sudo\" value=\"1\" class=\"mt-0.5 w-4 h-4 rounded border-gray-300 text-blue-600 focus:ring-blue-500\"> <label for=\"use_sudo\" class=\"text-sm text-gray-700\"><span class=\"font-medium\">Run docker with sudo</span> <span class=\"block text-xs text-gray-400 mt-0.5\">For SSH users outside the docker group. The user must be allowed to run docker through sudo without a password.</span></label></div><div><label for=\"tags\" class=\"block text-xs font-semibold text-gray-500 uppercase tracking-wide mb-1.5\">Tags</label> <input type=\"text\" id=\"tags\" name=\"tags\" class=\"w-full px-3 py-2.5 border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500 focus:border-transparent bg-gray-50 focus:bg-white transition-colors\" placeholder=\"prod, us-east\"><p class=\"text-xs text-gray-400 mt-1\">Comma-separated. Letters, digits, '-' and '_' only.</p></div><div class=\"flex justify-end gap-3 pt-2 border-t border-gray-100\"><button type=\"submit\" formmethod=\"dialog\" formnovalidate class=\"px-4 py-2 text-sm text-gray-600 bg-gray-100 hover:bg-gray-200 rounded-lg font-medium transition-colors\">Cancel</button> <button type=\"submit\" class=\"inline-flex items-center gap-2 px-4 py-2 bg-gradient-to-r from-blue-600 to-blue-700 hover:from-blue-700 hover:to-blue-800 text-white rounded-lg font-medium text-sm shadow-sm transition-all duration-150\">Add Server</button></div></form>")
 				if templ_7745c5c3_Err != nil {
 					return templ_7745c5c3_Err
 				}
 				return nil
 			})
-			templ_7745c5c3_Err = components.Modal("add-server", "Add Server").Render(templ.WithChildren(ctx, templ_7745c5c3_Var5), templ_7745c5c3_Buffer)
+			templ_7745c5c3_Err = components.Modal("add-server", "Add Server").Render(templ.WithChildren(ctx, templ_7745c5c3_Var11), templ_7745c5c3_Buffer)
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
-			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 6, "</main><script>\nfunction serverFilter() {\n    return {\n        searchQuery: '',\n        filterRows() {\n            var rows = document.querySelectorAll('#server-list tr[data-name]');\n            var q = this.searchQuery.toLowerCase();\n            rows.forEach(function(row) {\n                var name = row.getAttribute('data-name') || '';\n                var host = row.getAttribute('data-host') || '';\n                var show = !q || name.indexOf(q) !== -1 || host.indexOf(q) !== -1;\n                row.style.display = show ? '' : 'none';\n            });\n        },\n        init() {\n            this.$watch('searchQuery', () => this.filterRows());\n        }\n    }\n}\n\t\t\t</script></div>")
+			templ_7745c5c3_Err = templruntime.WriteString(templ_7745c5c3_Buffer, 15, "</main><script>\nfunction serverFilter() {\n    return {\n        searchQuery: '',\n        filterRows() {\n            var rows = document.querySelectorAll('#server-list tr[data-name]');\n            var q = this.searchQuery.toLowerCase();\n            rows.forEach(function(row) {\n                var name = row.getAttribute('data-name') || '';\n                var host = row.getAttribute('data-host') || '';\n                var show = !q || name.indexOf(q) !== -1 || host.indexOf(q) !== -1;\n                row.style.display = show ? '' : 'none';\n            });\n        },\n        init() {\n            this.$watch('searchQuery', () => this.filterRows());\n        }\n    }\n}\n\t\t\t</script></div>")
 			if templ_7745c5c3_Err != nil {
 				return templ_7745c5c3_Err
 			}
@@ -168,17 +257,17 @@ func ServersCount(count int) templ.Component {
 			}()
 		}
 		ctx = templ.InitializeContext(ctx)
-		templ_7745c5c3_Var6 := templ.GetChildren(ctx)
-		if templ_7745c5c3_Var6 == nil {
-			templ_7745c5c3_Var6 = templ.NopComponent
+		templ_7745c5c3_Var12 := templ.GetChildren(ctx)
+		if templ_7745c5c3_Var12 == nil {
+			templ_7745c5c3_Var12 = templ.NopComponent
 		}
 		ctx = templ.ClearChildren(ctx)
-		var templ_7745c5c3_Var7 string
-		templ_7745c5c3_Var7, templ_7745c5c3_Err = templ.JoinStringErrs(strconv.Itoa(count))
+		var templ_7745c5c3_Var13 string
+		templ_7745c5c3_Var13, templ_7745c5c3_Err = templ.JoinStringErrs(strconv.Itoa(count))
 		if templ_7745c5c3_Err != nil {
-			return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/pages/servers.templ`, Line: 166, Col: 22}
+			return templ.Error{Err: templ_7745c5c3_Err, FileName: `views/pages/servers.templ`, Line: 234, Col: 22}
 		}
-		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var7))
+		_, templ_7745c5c3_Err = templ_7745c5c3_Buffer.WriteString(templ.EscapeString(templ_7745c5c3_Var13))
 		if templ_7745c5c3_Err != nil {
 			return templ_7745c5c3_Err
 		}